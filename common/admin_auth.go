@@ -0,0 +1,133 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Admin roles, from least to most privileged; each role includes the permissions of the ones before it
+//   - viewer: read inventory, DLQ and control state (dashboards)
+//   - operator: pause/resume items, drain, reload scripts, reset DLQ counters
+//   - admin: change stock (restock, blue/green cutover)
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+var roleRank = map[string]int{RoleViewer: 1, RoleOperator: 2, RoleAdmin: 3}
+
+// Admin token errors
+var (
+	ErrAdminTokenMissing = errors.New("admin token missing")
+	ErrAdminTokenInvalid = errors.New("admin token invalid")
+	ErrAdminTokenExpired = errors.New("admin token expired")
+)
+
+// AdminClaims identify the caller of the admin API
+type AdminClaims struct {
+	Subject   string `json:"sub"`  // Actor recorded in logs (person or service account)
+	Role      string `json:"role"` // RoleViewer, RoleOperator or RoleAdmin
+	ExpiresAt int64  `json:"exp"`  // Unix seconds
+}
+
+// Allows reports whether the claims grant role
+func (c *AdminClaims) Allows(role string) bool {
+	return roleRank[c.Role] >= roleRank[role]
+}
+
+// AdminAuth issues and verifies admin bearer tokens (HMAC-signed AdminClaims)
+type AdminAuth struct {
+	secret []byte
+}
+
+// NewAdminAuth creates an authenticator from ADMIN_TOKEN_SECRET
+func NewAdminAuth(secret string) (*AdminAuth, error) {
+	if len(secret) < 32 {
+		return nil, errors.New("admin token secret must be at least 32 bytes")
+	}
+	return &AdminAuth{secret: []byte(secret)}, nil
+}
+
+// Issue returns a token for subject with role, valid for ttl
+func (a *AdminAuth) Issue(subject, role string, ttl time.Duration) (string, error) {
+	if _, ok := roleRank[role]; !ok {
+		return "", fmt.Errorf("unknown admin role %q", role)
+	}
+	if subject == "" {
+		return "", errors.New("admin token subject is required")
+	}
+	payload, _ := json.Marshal(AdminClaims{Subject: subject, Role: role, ExpiresAt: time.Now().Add(ttl).Unix()})
+	return EncodeSignedToken(a.secret, payload), nil
+}
+
+// Verify checks a token's signature and expiry and returns its claims
+func (a *AdminAuth) Verify(token string, now time.Time) (*AdminClaims, error) {
+	if token == "" {
+		return nil, ErrAdminTokenMissing
+	}
+	payload, err := DecodeSignedToken(a.secret, token)
+	if err != nil {
+		return nil, ErrAdminTokenInvalid
+	}
+	var claims AdminClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Subject == "" {
+		return nil, ErrAdminTokenInvalid
+	}
+	if _, ok := roleRank[claims.Role]; !ok {
+		return nil, ErrAdminTokenInvalid
+	}
+	if now.Unix() > claims.ExpiresAt {
+		return nil, ErrAdminTokenExpired
+	}
+	return &claims, nil
+}
+
+type adminClaimsContextKey struct{}
+
+// AdminClaimsFromContext returns the caller's claims inside a handler wrapped by Require
+func AdminClaimsFromContext(ctx context.Context) *AdminClaims {
+	claims, _ := ctx.Value(adminClaimsContextKey{}).(*AdminClaims)
+	return claims
+}
+
+// Require wraps next so it only runs for callers whose bearer token grants role
+// Missing or invalid tokens get 401, insufficient roles 403
+func (a *AdminAuth) Require(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		claims, err := a.Verify(strings.TrimSpace(token), time.Now())
+		if err != nil {
+			Logger.WithError(err).WithFields(map[string]interface{}{
+				"event": "admin_unauthenticated",
+				"path":  r.URL.Path,
+			}).Warn("Admin request rejected")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeAdminError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if !claims.Allows(role) {
+			Logger.WithFields(map[string]interface{}{
+				"event":         "admin_forbidden",
+				"path":          r.URL.Path,
+				"actor":         claims.Subject,
+				"role":          claims.Role,
+				"required_role": role,
+			}).Warn("Admin request forbidden")
+			writeAdminError(w, http.StatusForbidden, fmt.Sprintf("role %s required", role))
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), adminClaimsContextKey{}, claims)))
+	}
+}
+
+func writeAdminError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
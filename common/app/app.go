@@ -0,0 +1,251 @@
+// Package app is the bootstrap shared by every service binary: shared flags, logging, the
+// startup configuration snapshot, Redis, the endpoints every service serves (/metrics,
+// /version, /health, /live, /ready, /admin/config), signal handling and ordered shutdown
+//
+// A main creates the App with New, registers its own flags, calls Parse and Start, builds its
+// dependencies (registering how to close each with OnShutdown), then blocks in Run
+package app
+
+import (
+	"context"
+	"flag"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// ShutdownTimeout bounds how long shutdown hooks may take altogether
+const ShutdownTimeout = 30 * time.Second
+
+// App is one running service
+type App struct {
+	Name   string
+	Logger *logrus.Logger
+	Config *common.ConfigReport // Resolved once in Start; settings are only read at startup
+	Health *HealthRegistry
+	Mux    *http.ServeMux // Services register their handlers here (http.DefaultServeMux)
+
+	RedisAddr string // REDIS_ADDR
+	KafkaAddr string // KAFKA_ADDR
+
+	configure      func() *common.ConfigReport
+	validateConfig *bool
+	signals        chan os.Signal
+	hooks          []shutdownHook
+}
+
+type shutdownHook struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// New creates the app for service and registers the shared flags
+// configure resolves the service's configuration for -validate-config and GET /admin/config
+func New(service string, configure func() *common.ConfigReport) *App {
+	return &App{
+		Name:           service,
+		Health:         NewHealthRegistry(),
+		Mux:            http.DefaultServeMux,
+		configure:      configure,
+		validateConfig: flag.Bool("validate-config", false, "Check the configuration, print the effective values (secrets redacted) and exit; exits 1 on errors"),
+	}
+}
+
+// Parse parses the command line; -validate-config is handled here and exits
+func (a *App) Parse() {
+	flag.Parse()
+	if *a.validateConfig {
+		report := a.configure()
+		report.Print(os.Stdout)
+		if !report.OK() {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+}
+
+// Start initializes logging, logs the build, resolves the configuration and starts listening
+// for shutdown signals; everything after Start may log through a.Logger
+func (a *App) Start() {
+	a.Logger = common.InitLogger(a.Name)
+	build := common.GetBuildInfo(a.Name)
+	a.Logger.WithFields(map[string]interface{}{
+		"version":    build.Version,
+		"commit":     build.Commit,
+		"build_time": build.BuildTime,
+	}).Info("Service starting...")
+
+	a.Config = a.configure()
+	a.Config.Log(a.Logger)
+
+	a.RedisAddr = os.Getenv("REDIS_ADDR")
+	if a.RedisAddr == "" {
+		a.RedisAddr = "redis-service:6379" // Default for k8s
+	}
+	a.KafkaAddr = os.Getenv("KAFKA_ADDR")
+	if a.KafkaAddr == "" {
+		a.KafkaAddr = "kafka-service:9092" // Default for k8s
+	}
+	// Passing checks slower than HEALTH_SLOW_THRESHOLD report degraded (default: 500ms, 0 disables)
+	if value, err := time.ParseDuration(os.Getenv("HEALTH_SLOW_THRESHOLD")); err == nil {
+		a.Health.SetSlowThreshold(value)
+	}
+
+	a.signals = make(chan os.Signal, 1)
+	signal.Notify(a.signals, os.Interrupt, syscall.SIGTERM)
+}
+
+// ConfigureItemLabels applies the item_id label cardinality guard settings
+// (METRIC_ITEM_LABEL_LIMIT, default: 100; METRIC_PINNED_ITEMS) to the service's metrics
+func (a *App) ConfigureItemLabels(guard *common.ItemLabelGuard) {
+	if err := guard.ConfigureFromEnv(); err != nil {
+		a.Logger.WithError(err).Fatal("Invalid metric label configuration")
+	}
+}
+
+// ConfigureCampaignLabels applies the campaign label limit (METRIC_CAMPAIGN_LABEL_LIMIT,
+// default: 20) to the service's campaign metrics
+func (a *App) ConfigureCampaignLabels(campaigns *common.CampaignMetrics) {
+	if err := campaigns.ConfigureFromEnv(); err != nil {
+		a.Logger.WithError(err).Fatal("Invalid metric label configuration")
+	}
+}
+
+// KafkaConfig returns a new sarama config with the KAFKA_VERSION, KAFKA_TLS_* and KAFKA_SASL_*
+// settings applied (see common.NewKafkaConfig); every Kafka client of the service starts from it
+func (a *App) KafkaConfig() *sarama.Config {
+	config, err := common.NewKafkaConfig()
+	if err != nil {
+		a.Logger.WithError(err).Fatal("Invalid Kafka client configuration")
+	}
+	return config
+}
+
+// BootstrapTopics creates the engine's Kafka topics with configured partitions and retention
+// instead of relying on broker auto-create defaults
+func (a *App) BootstrapTopics() {
+	if err := common.BootstrapTopics([]string{a.KafkaAddr}, a.KafkaConfig(), common.DefaultTopicSpecs(), a.Logger); err != nil {
+		a.Logger.WithError(err).Fatal("Failed to bootstrap Kafka topics")
+	}
+}
+
+// NewRedisClient creates the client for REDIS_ADDR, checked by /health and closed on shutdown
+// Its commands are recorded in metrics and logged when slow (see common.InstrumentRedis)
+func (a *App) NewRedisClient(metrics *common.RedisCommandMetrics) *redis.Client {
+	client := redis.NewClient(&redis.Options{Addr: a.RedisAddr, ContextTimeoutEnabled: true})
+	common.InstrumentRedis(client, metrics, "primary", a.Logger)
+	a.Health.Register("redis", func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	})
+	a.OnShutdown("Redis client", func(context.Context) error {
+		return client.Close()
+	})
+	return client
+}
+
+// NewRedisDegradation tracks Redis OOM errors (REDIS_OOM_HOLD, default: 30s after the last one)
+// /health reports redis_memory degraded meanwhile
+func (a *App) NewRedisDegradation(gauge prometheus.Gauge) *common.RedisDegradation {
+	holdFor := 30 * time.Second
+	if value, err := time.ParseDuration(os.Getenv("REDIS_OOM_HOLD")); err == nil {
+		holdFor = value
+	}
+	degradation := common.NewRedisDegradation(holdFor, gauge, a.Logger)
+	a.Health.Register("redis_memory", func(context.Context) error {
+		if degradation.Degraded() {
+			return Degraded("out of memory, non-essential writes suspended")
+		}
+		return nil
+	})
+	return degradation
+}
+
+// AdminAuth returns the admin token verifier, or nil when ADMIN_TOKEN_SECRET is unset
+func (a *App) AdminAuth() *common.AdminAuth {
+	secret := os.Getenv("ADMIN_TOKEN_SECRET")
+	if secret == "" {
+		return nil
+	}
+	auth, err := common.NewAdminAuth(secret)
+	if err != nil {
+		a.Logger.WithError(err).Fatal("Invalid ADMIN_TOKEN_SECRET")
+	}
+	return auth
+}
+
+// RegisterEndpoints adds the endpoints every service serves: /metrics, GET /version, /health,
+// the /live and /ready probes and, when auth is non-nil, GET /admin/config
+func (a *App) RegisterEndpoints(auth *common.AdminAuth) {
+	a.Mux.Handle("/metrics", promhttp.Handler())
+	a.Mux.HandleFunc("GET /version", common.VersionHandler(a.Name))
+	a.Mux.HandleFunc("/health", a.Health.Handler())
+	a.Mux.HandleFunc("GET /live", a.Health.LiveHandler())
+	a.Mux.HandleFunc("GET /ready", a.Health.ReadyHandler())
+	if auth != nil {
+		a.Mux.HandleFunc("GET /admin/config", auth.Require(common.RoleViewer, common.ConfigHandler(a.Config)))
+	}
+}
+
+// Serve runs server in the background; wrap, if set, wraps its listener (e.g. PROXY protocol)
+// The server stops accepting requests first on shutdown and in-flight requests are drained
+func (a *App) Serve(server *http.Server, wrap func(net.Listener) net.Listener) {
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		a.Logger.WithError(err).WithField("addr", server.Addr).Fatal("HTTP server failed")
+	}
+	if wrap != nil {
+		listener = wrap(listener)
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			a.Logger.WithError(err).WithField("addr", server.Addr).Fatal("HTTP server failed")
+		}
+	}()
+	a.OnShutdown("HTTP server "+server.Addr, server.Shutdown)
+	a.Logger.WithField("addr", server.Addr).Info("HTTP server listening")
+}
+
+// OnShutdown registers run to be called on shutdown
+// Hooks run in reverse order of registration, so a dependency registered when it is created
+// is closed after everything built on top of it
+func (a *App) OnShutdown(name string, run func(ctx context.Context) error) {
+	a.hooks = append(a.hooks, shutdownHook{name: name, run: run})
+}
+
+// Run blocks until a shutdown signal arrives or stopped is closed, then shuts down
+func (a *App) Run(stopped <-chan struct{}) {
+	select {
+	case sig := <-a.signals:
+		a.Logger.WithField("signal", sig.String()).Info("Shutdown signal received, draining...")
+	case <-stopped:
+		a.Logger.Info("Service stopped, shutting down...")
+	}
+	// Readiness fails right away so load balancers stop routing here while requests drain
+	a.Health.SetDraining()
+	a.Shutdown()
+}
+
+// Shutdown runs every shutdown hook within ShutdownTimeout; hooks still run after the
+// timeout so connections get closed, but anything waiting on ctx gives up
+func (a *App) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	for i := len(a.hooks) - 1; i >= 0; i-- {
+		hook := a.hooks[i]
+		if err := hook.run(ctx); err != nil {
+			a.Logger.WithError(err).WithField("hook", hook.name).Error("Error during shutdown")
+		}
+	}
+	a.hooks = nil
+	a.Logger.Info("Shutdown complete")
+}
@@ -0,0 +1,206 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// healthCheckTimeout bounds each check so a hung dependency can't stall probes
+const healthCheckTimeout = 2 * time.Second
+
+// DefaultSlowThreshold is the check latency above which a reachable dependency counts as
+// degraded (HEALTH_SLOW_THRESHOLD)
+const DefaultSlowThreshold = 500 * time.Millisecond
+
+// Health status levels, from the worst check
+const (
+	StatusHealthy   = "healthy"
+	StatusDegraded  = "degraded"  // Serving, but a dependency is slow or partly impaired
+	StatusUnhealthy = "unhealthy" // A dependency is down; the service shouldn't get traffic
+	StatusDraining  = "draining"  // Shutting down; in-flight requests finish but new ones go elsewhere
+)
+
+// degradedError is a check failure that leaves the dependency usable
+type degradedError struct {
+	reason string
+}
+
+func (e *degradedError) Error() string { return e.reason }
+
+// Degraded returns a check error that reports the dependency as degraded rather than down,
+// e.g. a circuit breaker probing recovery or a Redis replica falling behind
+func Degraded(reason string) error {
+	return &degradedError{reason: reason}
+}
+
+// HealthRegistry collects the dependency checks behind /health and /ready
+// Checks decide the status; details only add context to the response
+type HealthRegistry struct {
+	mu            sync.Mutex
+	checks        []healthCheck
+	details       []healthDetail
+	slowThreshold time.Duration
+	draining      atomic.Bool
+}
+
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+type healthDetail struct {
+	name  string
+	value func() interface{}
+}
+
+// CheckResult is the outcome of one check in the /health response
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Reason    string  `json:"reason,omitempty"`
+}
+
+// NewHealthRegistry creates an empty registry; with no checks the service is always healthy
+func NewHealthRegistry() *HealthRegistry {
+	return &HealthRegistry{slowThreshold: DefaultSlowThreshold}
+}
+
+// SetSlowThreshold sets the latency above which a passing check reports degraded; 0 disables it
+func (h *HealthRegistry) SetSlowThreshold(threshold time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.slowThreshold = threshold
+}
+
+// SetDraining marks the service as shutting down: /health and /ready answer 503 from now on
+func (h *HealthRegistry) SetDraining() {
+	h.draining.Store(true)
+}
+
+// Draining reports whether SetDraining was called
+func (h *HealthRegistry) Draining() bool {
+	return h.draining.Load()
+}
+
+// Register adds a check reported under name. A nil error is healthy (degraded when slower than
+// the slow threshold), an error from Degraded is degraded, and any other error is unhealthy
+func (h *HealthRegistry) Register(name string, check func(ctx context.Context) error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, healthCheck{name: name, check: check})
+}
+
+// Detail adds an informational field to the response, e.g. a circuit breaker state
+func (h *HealthRegistry) Detail(name string, value func() interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.details = append(h.details, healthDetail{name: name, value: value})
+}
+
+// Check runs every check concurrently and returns the overall status with the response body:
+// name: false for each unhealthy check (true otherwise), per-check results under "checks",
+// the reasons for anything not healthy, and the details
+func (h *HealthRegistry) Check(ctx context.Context) (string, map[string]interface{}) {
+	h.mu.Lock()
+	checks := append([]healthCheck(nil), h.checks...)
+	details := append([]healthDetail(nil), h.details...)
+	slowThreshold := h.slowThreshold
+	h.mu.Unlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c healthCheck) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, c, slowThreshold)
+		}(i, c)
+	}
+	wg.Wait()
+
+	status := StatusHealthy
+	reasons := []string{}
+	byName := make(map[string]CheckResult, len(checks))
+	body := make(map[string]interface{}, len(checks)+len(details)+3)
+	for i, c := range checks {
+		result := results[i]
+		byName[c.name] = result
+		body[c.name] = result.Status != StatusUnhealthy
+		if result.Status == StatusHealthy {
+			continue
+		}
+		reasons = append(reasons, c.name+": "+result.Reason)
+		if result.Status == StatusUnhealthy || status == StatusHealthy {
+			status = result.Status
+		}
+	}
+	for _, d := range details {
+		body[d.name] = d.value()
+	}
+	body["status"] = status
+	body["checks"] = byName
+	body["reasons"] = reasons
+	return status, body
+}
+
+func runCheck(ctx context.Context, c healthCheck, slowThreshold time.Duration) CheckResult {
+	checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	start := time.Now()
+	err := c.check(checkCtx)
+	latency := time.Since(start)
+	result := CheckResult{Status: StatusHealthy, LatencyMs: float64(latency.Microseconds()) / 1000}
+	var degraded *degradedError
+	switch {
+	case errors.As(err, &degraded):
+		result.Status, result.Reason = StatusDegraded, degraded.reason
+	case err != nil:
+		result.Status, result.Reason = StatusUnhealthy, err.Error()
+	case slowThreshold > 0 && latency > slowThreshold:
+		result.Status, result.Reason = StatusDegraded, "slow but reachable ("+latency.Round(time.Millisecond).String()+")"
+	}
+	return result
+}
+
+// Handler serves /health, the full report for operators and dashboards
+// Returns 200 OK while healthy or degraded, 503 Service Unavailable when unhealthy or draining
+func (h *HealthRegistry) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, body := h.Check(r.Context())
+		if h.Draining() {
+			status = StatusDraining
+			body["status"] = status
+		}
+		code := http.StatusOK
+		if status == StatusUnhealthy || status == StatusDraining {
+			code = http.StatusServiceUnavailable
+		}
+		writeHealth(w, code, body)
+	}
+}
+
+// ReadyHandler serves /ready for readiness probes: like /health, so a degraded instance keeps
+// its traffic, an unhealthy one is taken out of the load balancer until it recovers and a
+// draining one is taken out for good
+func (h *HealthRegistry) ReadyHandler() http.HandlerFunc {
+	return h.Handler()
+}
+
+// LiveHandler serves /live for liveness probes: 200 OK as long as the process serves HTTP
+// Dependencies aren't checked, so a Redis or Kafka brownout never gets the pod restarted
+func (h *HealthRegistry) LiveHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, http.StatusOK, map[string]interface{}{"status": "alive"})
+	}
+}
+
+func writeHealth(w http.ResponseWriter, code int, body map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,208 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// DefaultCampaignLabelLimit is the number of campaign label values exported by default
+const DefaultCampaignLabelLimit = 20
+
+// Campaign labels used when an order's real campaign isn't exported
+const (
+	CampaignLabelNone  = "none"  // Order for an item outside every active campaign
+	CampaignLabelOther = "other" // Campaign beyond the label limit (see CampaignMetrics)
+)
+
+// campaignLabelIdle is how long a campaign must go without orders before a new campaign
+// may take its label once the limit is reached
+const campaignLabelIdle = 6 * time.Hour
+
+// HeaderCampaign carries the campaign of an order routed to a campaign topic, so it keeps its
+// campaign label through the DLQ and replays to the shared orders topic
+const HeaderCampaign = "campaign"
+
+// CampaignFromTopic returns the campaign whose orders topic is topic, or "" for the shared topics
+func CampaignFromTopic(topic string) string {
+	if !IsCampaignTopic(topic) {
+		return ""
+	}
+	return strings.TrimPrefix(topic, TopicOrders+"-")
+}
+
+// CampaignSummary is one campaign's orders on this instance since it started
+type CampaignSummary struct {
+	Campaign      string                  `json:"campaign"`
+	Orders        uint64                  `json:"orders"`
+	Outcomes      map[OrderOutcome]uint64 `json:"outcomes"`
+	FirstOrderAt  time.Time               `json:"first_order_at"`
+	LastOrderAt   time.Time               `json:"last_order_at"`
+	AvgDurationMs float64                 `json:"avg_end_to_end_ms,omitempty"` // Processor only
+	durationSum   time.Duration
+	durationCount uint64
+}
+
+// CampaignMetrics records campaign_orders_total{service, campaign, outcome} and
+// campaign_order_duration_seconds{service, campaign} for one service, with a per-campaign summary
+// for GET /admin/campaigns/metrics
+// Campaigns take a label value in order of their first order, at most limit of them; later
+// campaigns are "other" until a labeled campaign has been idle for campaignLabelIdle, which then
+// gives up its label and has its series and summary deleted
+type CampaignMetrics struct {
+	service  string
+	counter  *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+
+	mu        sync.Mutex
+	limit     int
+	summaries map[string]*CampaignSummary // Label value -> summary, including none and other
+}
+
+func newCampaignMetrics(service string) *CampaignMetrics {
+	return &CampaignMetrics{
+		service: service,
+		counter: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "campaign_orders_total",
+			Help: "Total number of orders by service, campaign and outcome (\"none\" outside campaigns, \"other\" beyond the label limit)",
+		}, []string{"service", "campaign", "outcome"}),
+		duration: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "campaign_order_duration_seconds",
+			Help:    "Time from gateway acceptance to the order's terminal state by campaign",
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+		}, []string{"service", "campaign"}),
+		limit:     DefaultCampaignLabelLimit,
+		summaries: make(map[string]*CampaignSummary),
+	}
+}
+
+// ConfigureFromEnv applies METRIC_CAMPAIGN_LABEL_LIMIT (default: DefaultCampaignLabelLimit);
+// must be called before any order is recorded
+func (c *CampaignMetrics) ConfigureFromEnv() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if value := os.Getenv("METRIC_CAMPAIGN_LABEL_LIMIT"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return fmt.Errorf("invalid METRIC_CAMPAIGN_LABEL_LIMIT %q", value)
+		}
+		c.limit = limit
+	}
+	return nil
+}
+
+// Record counts one order of campaign ("" outside campaigns) with outcome
+func (c *CampaignMetrics) Record(campaign string, outcome OrderOutcome) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	summary := c.summary(campaign, time.Now())
+	summary.Orders++
+	summary.Outcomes[outcome]++
+	c.counter.WithLabelValues(c.service, summary.Campaign, string(outcome)).Inc()
+}
+
+// ObserveDuration records the end-to-end latency of one of campaign's orders
+func (c *CampaignMetrics) ObserveDuration(campaign string, elapsed time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	summary := c.summary(campaign, time.Now())
+	summary.durationSum += elapsed
+	summary.durationCount++
+	c.duration.WithLabelValues(c.service, summary.Campaign).Observe(elapsed.Seconds())
+}
+
+// summary returns campaign's summary, taking a label for it if one is free; c.mu must be held
+func (c *CampaignMetrics) summary(campaign string, now time.Time) *CampaignSummary {
+	label := campaign
+	switch {
+	case campaign == "":
+		label = CampaignLabelNone
+	case c.summaries[campaign] != nil:
+	case c.labeled() >= c.limit && !c.evictIdle(now):
+		label = CampaignLabelOther
+	}
+	summary, ok := c.summaries[label]
+	if !ok {
+		summary = &CampaignSummary{Campaign: label, Outcomes: make(map[OrderOutcome]uint64), FirstOrderAt: now}
+		c.summaries[label] = summary
+	}
+	summary.LastOrderAt = now
+	return summary
+}
+
+// labeled counts the campaigns holding a label; c.mu must be held
+func (c *CampaignMetrics) labeled() int {
+	n := len(c.summaries)
+	for _, label := range []string{CampaignLabelNone, CampaignLabelOther} {
+		if c.summaries[label] != nil {
+			n--
+		}
+	}
+	return n
+}
+
+// evictIdle frees the label of the campaign idle the longest, if it has been idle for
+// campaignLabelIdle; c.mu must be held
+func (c *CampaignMetrics) evictIdle(now time.Time) bool {
+	var idlest *CampaignSummary
+	for label, summary := range c.summaries {
+		if label == CampaignLabelNone || label == CampaignLabelOther {
+			continue
+		}
+		if idlest == nil || summary.LastOrderAt.Before(idlest.LastOrderAt) {
+			idlest = summary
+		}
+	}
+	if idlest == nil || now.Sub(idlest.LastOrderAt) < campaignLabelIdle {
+		return false
+	}
+	delete(c.summaries, idlest.Campaign)
+	c.counter.DeletePartialMatch(prometheus.Labels{"campaign": idlest.Campaign})
+	c.duration.DeletePartialMatch(prometheus.Labels{"campaign": idlest.Campaign})
+	return true
+}
+
+// Summaries returns a copy of every campaign's summary, busiest first
+func (c *CampaignMetrics) Summaries() []CampaignSummary {
+	c.mu.Lock()
+	summaries := make([]CampaignSummary, 0, len(c.summaries))
+	for _, summary := range c.summaries {
+		copied := *summary
+		copied.Outcomes = make(map[OrderOutcome]uint64, len(summary.Outcomes))
+		for outcome, n := range summary.Outcomes {
+			copied.Outcomes[outcome] = n
+		}
+		if summary.durationCount > 0 {
+			copied.AvgDurationMs = float64(summary.durationSum) / float64(summary.durationCount) / float64(time.Millisecond)
+		}
+		summaries = append(summaries, copied)
+	}
+	c.mu.Unlock()
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Orders != summaries[j].Orders {
+			return summaries[i].Orders > summaries[j].Orders
+		}
+		return summaries[i].Campaign < summaries[j].Campaign
+	})
+	return summaries
+}
+
+// SummaryHandler serves this instance's campaign summaries (GET /admin/campaigns/metrics)
+func (c *CampaignMetrics) SummaryHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"service":   c.service,
+			"campaigns": c.Summaries(),
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// CampaignTopicsKey is the Redis hash of campaign topics (campaign name -> CampaignTopic JSON)
+// The processor admin API writes it; gateways read it to route orders
+const CampaignTopicsKey = "campaign_topics"
+
+// campaignNamePattern keeps topic names valid and readable: orders-<campaign>
+var campaignNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+// CampaignTopic routes a campaign's items to a dedicated orders topic
+// so its backlog and failures never queue up in front of other campaigns' orders
+type CampaignTopic struct {
+	Name      string    `json:"name"`
+	Topic     string    `json:"topic"`
+	ItemIDs   []string  `json:"item_ids"`
+	CreatedAt time.Time `json:"created_at"`
+	EndsAt    time.Time `json:"ends_at"` // Orders go back to the shared orders topic after this
+}
+
+// Active reports whether orders for the campaign's items are routed to its topic at now
+func (c CampaignTopic) Active(now time.Time) bool {
+	return now.Before(c.EndsAt)
+}
+
+// CampaignTopicName returns the orders topic for campaign
+func CampaignTopicName(campaign string) string {
+	return TopicOrders + "-" + campaign
+}
+
+// ValidateCampaignName rejects names that aren't usable in a topic name or that would
+// collide with the engine's own orders-* topics
+func ValidateCampaignName(campaign string) error {
+	if !campaignNamePattern.MatchString(campaign) {
+		return fmt.Errorf("campaign name must be 1-64 lowercase letters, digits or hyphens")
+	}
+	if IsSystemTopic(CampaignTopicName(campaign)) || campaign == CampaignLabelNone || campaign == CampaignLabelOther {
+		return fmt.Errorf("campaign name %q is reserved", campaign)
+	}
+	return nil
+}
+
+// IsSystemTopic reports whether topic is one of the engine's fixed topics
+func IsSystemTopic(topic string) bool {
+	switch topic {
+	case TopicOrders, TopicOrdersRetry5s, TopicOrdersRetry1m, TopicOrdersRetry10m, TopicOrdersDLQ, TopicOrdersQuarantine, TopicOrderResults, TopicSLABreaches, TopicFulfillment, TopicInventoryState:
+		return true
+	}
+	return false
+}
+
+// IsCampaignTopic reports whether topic is a campaign's orders topic
+func IsCampaignTopic(topic string) bool {
+	return strings.HasPrefix(topic, TopicOrders+"-") && !IsSystemTopic(topic)
+}
+
+// LoadCampaignTopics reads every registered campaign topic
+func LoadCampaignTopics(ctx context.Context, client *redis.Client) ([]CampaignTopic, error) {
+	values, err := client.HGetAll(ctx, CampaignTopicsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	campaigns := make([]CampaignTopic, 0, len(values))
+	for name, value := range values {
+		var campaign CampaignTopic
+		if err := json.Unmarshal([]byte(value), &campaign); err != nil {
+			return nil, fmt.Errorf("campaign %s: %w", name, err)
+		}
+		campaigns = append(campaigns, campaign)
+	}
+	return campaigns, nil
+}
+
+// SaveCampaignTopic registers or updates campaign
+func SaveCampaignTopic(ctx context.Context, client *redis.Client, campaign CampaignTopic) error {
+	value, err := json.Marshal(campaign)
+	if err != nil {
+		return err
+	}
+	return client.HSet(ctx, CampaignTopicsKey, campaign.Name, value).Err()
+}
@@ -0,0 +1,52 @@
+package common
+
+import "strconv"
+
+// Cart policies: what a cart order does when some of its lines can't be reserved
+const (
+	CartAllOrNothing = "all_or_nothing" // Any failed line fails the cart; reserved lines are released (default)
+	CartBestEffort   = "best_effort"    // The lines that reserved are charged and fulfilled, the others fail
+)
+
+// CartPolicies lists the valid cart_policy values
+var CartPolicies = []string{CartAllOrNothing, CartBestEffort}
+
+// IsValidCartPolicy reports whether policy is a known cart policy
+func IsValidCartPolicy(policy string) bool {
+	return policy == CartAllOrNothing || policy == CartBestEffort
+}
+
+// CartLine is one item of a cart order
+type CartLine struct {
+	ItemID string `json:"item_id"`
+	Amount int64  `json:"amount"`
+}
+
+// Cart line statuses on OrderResult.Lines; failed lines use ResultFailedSoldOut with the reason
+// the line's reservation gave
+const (
+	CartLineReserved  = ResultReserved  // Held while the cart is charged
+	CartLineCompleted = ResultCompleted // Paid and handed to fulfillment
+	CartLineReleased  = "RELEASED"      // Reserved, then given back because the cart failed
+)
+
+// ReasonCartLineFailed is the reason of a cart that failed because of its lines (see Lines)
+const ReasonCartLineFailed = "CART_LINE_FAILED"
+
+// CartLineResult is the outcome of one line of a cart order
+type CartLineResult struct {
+	ItemID   string `json:"item_id"`
+	Quantity int64  `json:"quantity"`
+	Status   string `json:"status"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// CartLineRequestID is the request ID a cart line's reservation is recorded under, so each line
+// is refunded and confirmed on its own and a retried cart continues with the lines it reserved
+// Orders without a request ID have none for their lines either
+func CartLineRequestID(requestID string, line int) string {
+	if requestID == "" {
+		return ""
+	}
+	return requestID + "#" + strconv.Itoa(line)
+}
@@ -0,0 +1,24 @@
+package common
+
+// Order source channels carried on every order for attribution, metrics and admission policies
+const (
+	ChannelWeb        = "web"
+	ChannelApp        = "app"
+	ChannelPartnerAPI = "partner-api"
+)
+
+// DefaultChannel is assumed for orders that don't name a channel (clients predating the field)
+const DefaultChannel = ChannelWeb
+
+// Channels lists the accepted channel values
+var Channels = []string{ChannelWeb, ChannelApp, ChannelPartnerAPI}
+
+// IsValidChannel reports whether channel is one of Channels
+func IsValidChannel(channel string) bool {
+	for _, c := range Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,342 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Sources of an effective configuration value
+const (
+	ConfigSourceEnv     = "env"     // Set in the environment
+	ConfigSourceFile    = "file"    // Loaded from a file named by another setting
+	ConfigSourceDefault = "default" // Not set, the built-in default applies
+)
+
+// redactedValue replaces secrets in reports
+const redactedValue = "[redacted]"
+
+// ConfigValue is one effective setting and where it came from
+type ConfigValue struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// ConfigReport resolves settings the way the services do and collects the effective values
+// with their sources, plus every problem found, without connecting to anything
+// A malformed value is an error here even though the services fall back to the default:
+// a setting that is silently ignored is exactly what a config check has to catch
+type ConfigReport struct {
+	Service    string        `json:"service"`
+	ResolvedAt time.Time     `json:"resolved_at"`
+	Values     []ConfigValue `json:"values"`
+	Errors     []string      `json:"errors"`
+	Warnings   []string      `json:"warnings"`
+}
+
+// NewConfigReport creates an empty report for service
+func NewConfigReport(service string) *ConfigReport {
+	return &ConfigReport{
+		Service:    service,
+		ResolvedAt: time.Now().UTC(),
+		Values:     []ConfigValue{},
+		Errors:     []string{},
+		Warnings:   []string{},
+	}
+}
+
+// OK reports whether no errors were found; warnings don't count
+func (r *ConfigReport) OK() bool {
+	return len(r.Errors) == 0
+}
+
+// Errorf records a problem the service fails on or silently works around
+func (r *ConfigReport) Errorf(format string, args ...interface{}) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+}
+
+// Warnf records a legal but likely unintended combination
+func (r *ConfigReport) Warnf(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Check records err, if any, as an error about name
+func (r *ConfigReport) Check(name string, err error) {
+	if err != nil {
+		r.Errorf("%s: %v", name, err)
+	}
+}
+
+// Set records a value resolved outside the typed accessors, e.g. loaded from a file
+func (r *ConfigReport) Set(name, value, source string) {
+	r.Values = append(r.Values, ConfigValue{Name: name, Value: value, Source: source})
+}
+
+// lookup returns name's raw value and records it, or defaultValue when unset
+func (r *ConfigReport) lookup(name, defaultValue string) (string, bool) {
+	if value := os.Getenv(name); value != "" {
+		r.Set(name, value, ConfigSourceEnv)
+		return value, true
+	}
+	r.Set(name, defaultValue, ConfigSourceDefault)
+	return defaultValue, false
+}
+
+// String returns name's value or defaultValue
+func (r *ConfigReport) String(name, defaultValue string) string {
+	value, _ := r.lookup(name, defaultValue)
+	return value
+}
+
+// OneOf returns name's value, which must be one of allowed; allowed[0] is the default
+func (r *ConfigReport) OneOf(name string, allowed ...string) string {
+	value, _ := r.lookup(name, allowed[0])
+	for _, candidate := range allowed {
+		if value == candidate {
+			return value
+		}
+	}
+	r.Errorf("%s=%q is not one of %s", name, value, strings.Join(allowed, "|"))
+	return allowed[0]
+}
+
+// List returns the comma-separated entries of name's value or defaultValue, ignoring blanks
+func (r *ConfigReport) List(name, defaultValue string) []string {
+	value, _ := r.lookup(name, defaultValue)
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Secret returns name's value; only whether it is set is reported
+func (r *ConfigReport) Secret(name string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		r.Set(name, "", ConfigSourceDefault)
+		return ""
+	}
+	r.Set(name, redactedValue, ConfigSourceEnv)
+	return value
+}
+
+// URL returns name's value, which must be an absolute http(s) URL; credentials are redacted
+func (r *ConfigReport) URL(name string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		r.Set(name, "", ConfigSourceDefault)
+		return ""
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		r.Set(name, redactedValue, ConfigSourceEnv)
+		r.Errorf("%s must be an absolute http(s) URL", name)
+		return value
+	}
+	r.Set(name, u.Redacted(), ConfigSourceEnv)
+	return value
+}
+
+// File returns name's path, which must name a readable file when set
+func (r *ConfigReport) File(name string) string {
+	path, set := r.lookup(name, "")
+	if set {
+		if f, err := os.Open(path); err != nil {
+			r.Errorf("%s: %v", name, err)
+		} else {
+			f.Close()
+		}
+	}
+	return path
+}
+
+// Bool returns name's value or defaultValue
+func (r *ConfigReport) Bool(name string, defaultValue bool) bool {
+	value, set := r.lookup(name, strconv.FormatBool(defaultValue))
+	if !set {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		r.Errorf("%s=%q is not a boolean; the default %t would be used", name, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// Int returns name's value or defaultValue
+func (r *ConfigReport) Int(name string, defaultValue int) int {
+	value, set := r.lookup(name, strconv.Itoa(defaultValue))
+	if !set {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		r.Errorf("%s=%q is not an integer; the default %d would be used", name, value, defaultValue)
+		return defaultValue
+	}
+	if parsed < 0 {
+		r.Errorf("%s=%d must not be negative", name, parsed)
+	}
+	return parsed
+}
+
+// Float returns name's value or defaultValue
+func (r *ConfigReport) Float(name string, defaultValue float64) float64 {
+	value, set := r.lookup(name, strconv.FormatFloat(defaultValue, 'g', -1, 64))
+	if !set {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		r.Errorf("%s=%q is not a number; the default %g would be used", name, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// Duration returns name's value or defaultValue
+func (r *ConfigReport) Duration(name string, defaultValue time.Duration) time.Duration {
+	value, set := r.lookup(name, defaultValue.String())
+	if !set {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		r.Errorf("%s=%q is not a duration (e.g. 500ms, 30s, 5m); the default %s would be used", name, value, defaultValue)
+		return defaultValue
+	}
+	if parsed < 0 {
+		r.Errorf("%s=%s must not be negative", name, parsed)
+	}
+	return parsed
+}
+
+// Print writes the effective values, warnings and errors in a readable table
+func (r *ConfigReport) Print(w io.Writer) {
+	fmt.Fprintf(w, "%s configuration\n\n", r.Service)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tVALUE\tSOURCE")
+	for _, value := range r.Values {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", value.Name, value.Value, value.Source)
+	}
+	tw.Flush()
+	if len(r.Warnings) > 0 {
+		fmt.Fprintln(w)
+		for _, warning := range r.Warnings {
+			fmt.Fprintf(w, "WARNING: %s\n", warning)
+		}
+	}
+	fmt.Fprintln(w)
+	for _, err := range r.Errors {
+		fmt.Fprintf(w, "ERROR: %s\n", err)
+	}
+	if r.OK() {
+		fmt.Fprintln(w, "Configuration OK")
+	} else {
+		fmt.Fprintf(w, "%d configuration error(s)\n", len(r.Errors))
+	}
+}
+
+// Log records every warning and error, e.g. at startup where most errors are silent fallbacks
+func (r *ConfigReport) Log(logger *logrus.Logger) {
+	for _, warning := range r.Warnings {
+		logger.WithField("event", "config_warning").Warn(warning)
+	}
+	for _, err := range r.Errors {
+		logger.WithField("event", "config_error").Warn(err)
+	}
+}
+
+// ConfigHandler serves report as JSON (GET /admin/config)
+// ?name= keeps only settings whose name starts with the given prefix, e.g. ?name=RATE_LIMIT
+func ConfigHandler(report *ConfigReport) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body := *report
+		if prefix := strings.ToUpper(r.URL.Query().Get("name")); prefix != "" {
+			body.Values = []ConfigValue{}
+			for _, value := range report.Values {
+				if strings.HasPrefix(strings.ToUpper(value.Name), prefix) {
+					body.Values = append(body.Values, value)
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+func isLogLevel(level string) bool {
+	_, err := logrus.ParseLevel(level)
+	return err == nil
+}
+
+// ReportSharedConfig adds the settings read by common code in every service: addresses,
+// Kafka client security, logging, metric labels, Kafka topic bootstrap, outbound HTTP and
+// payload protection
+func ReportSharedConfig(r *ConfigReport) {
+	r.String("REDIS_ADDR", "redis-service:6379")
+	r.String("KAFKA_ADDR", "kafka-service:9092")
+	ReportKafkaConfig(r)
+	if level := r.String("LOG_LEVEL", "info"); !isLogLevel(level) {
+		r.Errorf("LOG_LEVEL=%q is not a log level (debug|info|warn|error); info would be used", level)
+	}
+	r.Int("METRIC_ITEM_LABEL_LIMIT", 100)
+	r.List("METRIC_PINNED_ITEMS", "")
+	r.Int("METRIC_CAMPAIGN_LABEL_LIMIT", DefaultCampaignLabelLimit)
+	r.Duration("REDIS_OOM_HOLD", 30*time.Second)
+	r.Duration("REDIS_SLOW_THRESHOLD", DefaultRedisSlowThreshold)
+	r.Duration("HEALTH_SLOW_THRESHOLD", 500*time.Millisecond)
+
+	if r.Bool("KAFKA_TOPIC_BOOTSTRAP", false) {
+		if r.Int("KAFKA_TOPIC_PARTITIONS", 3) < 1 {
+			r.Errorf("KAFKA_TOPIC_PARTITIONS must be at least 1")
+		}
+		if r.Int("KAFKA_TOPIC_REPLICATION_FACTOR", 1) < 1 {
+			r.Errorf("KAFKA_TOPIC_REPLICATION_FACTOR must be at least 1")
+		}
+		r.Duration("KAFKA_TOPIC_RETENTION", 168*time.Hour)
+	}
+
+	maxIdle := r.Int("HTTP_CLIENT_MAX_IDLE_CONNS", 200)
+	maxIdlePerHost := r.Int("HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST", 64)
+	maxPerHost := r.Int("HTTP_CLIENT_MAX_CONNS_PER_HOST", 0)
+	r.Duration("HTTP_CLIENT_IDLE_CONN_TIMEOUT", 90*time.Second)
+	r.Duration("HTTP_CLIENT_DIAL_TIMEOUT", 5*time.Second)
+	r.Duration("HTTP_CLIENT_KEEP_ALIVE", 30*time.Second)
+	r.Duration("HTTP_CLIENT_TLS_HANDSHAKE_TIMEOUT", 5*time.Second)
+	if maxIdle > 0 && maxIdlePerHost > maxIdle {
+		r.Warnf("HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST (%d) exceeds HTTP_CLIENT_MAX_IDLE_CONNS (%d); the total cap wins", maxIdlePerHost, maxIdle)
+	}
+	if maxPerHost > 0 && maxIdlePerHost > maxPerHost {
+		r.Warnf("HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST (%d) exceeds HTTP_CLIENT_MAX_CONNS_PER_HOST (%d); idle connections beyond the cap are never used", maxIdlePerHost, maxPerHost)
+	}
+
+	// The loaders validate key formats and the active key; only their outcome is reported
+	// Keys from the file are reported under PAYLOAD_ENCRYPTION_KEYS unless the variable is set too
+	if keysFile := r.File("PAYLOAD_ENCRYPTION_KEYS_FILE"); keysFile != "" && os.Getenv("PAYLOAD_ENCRYPTION_KEYS") == "" {
+		r.Set("PAYLOAD_ENCRYPTION_KEYS", redactedValue, ConfigSourceFile)
+	} else {
+		r.Secret("PAYLOAD_ENCRYPTION_KEYS")
+	}
+	r.String("PAYLOAD_ENCRYPTION_KEY_ID", "")
+	_, err := LoadPayloadCipher()
+	r.Check("payload encryption keys", err)
+	r.Secret("MESSAGE_SIGNING_KEYS")
+	r.String("MESSAGE_SIGNING_KEY_ID", "")
+	_, err = LoadMessageSigner()
+	r.Check("message signing keys", err)
+}
@@ -0,0 +1,44 @@
+package common
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// TopicFulfillment receives confirmed orders for warehouse and delivery systems, keyed by request_id
+const TopicFulfillment = "fulfillment"
+
+// FulfillmentSchemaVersion is incremented on incompatible FulfillmentEvent changes
+const FulfillmentSchemaVersion = 1
+
+// FulfillmentEvent is the normalized confirmed-order record sent to fulfillment systems
+// (TopicFulfillment or the fulfillment webhook)
+// Consumers must deduplicate on EventID: delivery is at least once
+type FulfillmentEvent struct {
+	SchemaVersion   int               `json:"schema_version"`
+	EventID         string            `json:"event_id"` // RequestID, or CartLineRequestID for each line of a cart order
+	RequestID       string            `json:"request_id"`
+	UserID          string            `json:"user_id"`                     // Buyer
+	RecipientUserID string            `json:"recipient_user_id,omitempty"` // Entitled user of a gift order; deliver to them
+	ItemID          string            `json:"item_id"`
+	Quantity        int64             `json:"quantity"`
+	Channel         string            `json:"channel"`
+	ConfirmedAt     time.Time         `json:"confirmed_at"`
+	Metadata        map[string]string `json:"metadata,omitempty"` // Client passthrough, e.g. shipping method or cart ID
+	Address         *ShippingAddress  `json:"shipping_address,omitempty"`
+}
+
+// NewFulfillmentMessage builds the fulfillment-topic message, keyed by request_id
+func NewFulfillmentMessage(event FulfillmentEvent) (*sarama.ProducerMessage, error) {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	return &sarama.ProducerMessage{
+		Topic: TopicFulfillment,
+		Key:   sarama.StringEncoder(event.RequestID),
+		Value: sarama.ByteEncoder(value),
+	}, nil
+}
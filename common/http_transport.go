@@ -0,0 +1,206 @@
+package common
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// HTTPTransportConfig tunes the connection pool shared by a service's outbound HTTP clients
+type HTTPTransportConfig struct {
+	MaxIdleConns        int           // Idle connections kept across all hosts
+	MaxIdleConnsPerHost int           // Idle connections kept per host; Go's default of 2 forces reconnects under load
+	MaxConnsPerHost     int           // Cap on connections per host, 0 for no cap
+	IdleConnTimeout     time.Duration // How long an idle connection stays pooled
+	DialTimeout         time.Duration // TCP connect timeout
+	KeepAlive           time.Duration // TCP keep-alive probe interval
+	TLSHandshakeTimeout time.Duration
+}
+
+// HTTPTransportConfigFromEnv reads the pool settings from HTTP_CLIENT_* environment variables
+func HTTPTransportConfigFromEnv() HTTPTransportConfig {
+	return HTTPTransportConfig{
+		MaxIdleConns:        envInt("HTTP_CLIENT_MAX_IDLE_CONNS", 200),
+		MaxIdleConnsPerHost: envInt("HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST", 64),
+		MaxConnsPerHost:     envInt("HTTP_CLIENT_MAX_CONNS_PER_HOST", 0),
+		IdleConnTimeout:     envDuration("HTTP_CLIENT_IDLE_CONN_TIMEOUT", 90*time.Second),
+		DialTimeout:         envDuration("HTTP_CLIENT_DIAL_TIMEOUT", 5*time.Second),
+		KeepAlive:           envDuration("HTTP_CLIENT_KEEP_ALIVE", 30*time.Second),
+		TLSHandshakeTimeout: envDuration("HTTP_CLIENT_TLS_HANDSHAKE_TIMEOUT", 5*time.Second),
+	}
+}
+
+// HTTPClientMetrics instruments outbound HTTP calls by target (the client's name, e.g. payment)
+type HTTPClientMetrics struct {
+	RequestDuration *prometheus.HistogramVec
+	InFlight        *prometheus.GaugeVec
+	Connections     *prometheus.CounterVec
+	DNSDuration     *prometheus.HistogramVec
+	ConnectDuration *prometheus.HistogramVec
+	TLSDuration     *prometheus.HistogramVec
+}
+
+func newHTTPClientMetrics(service string) *HTTPClientMetrics {
+	phaseBuckets := []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+	return &HTTPClientMetrics{
+		RequestDuration: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    service + "_http_client_request_duration_seconds",
+			Help:    "Outbound HTTP request duration in seconds by target and result (2xx, 3xx, 4xx, 5xx, error)",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"target", "result"}),
+		InFlight: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: service + "_http_client_in_flight_requests",
+			Help: "Outbound HTTP requests currently in flight by target",
+		}, []string{"target"}),
+		Connections: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: service + "_http_client_connections_total",
+			Help: "Connections obtained for outbound HTTP requests by target and whether they were reused from the pool",
+		}, []string{"target", "reused"}),
+		DNSDuration: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    service + "_http_client_dns_duration_seconds",
+			Help:    "DNS lookup duration for new outbound HTTP connections in seconds",
+			Buckets: phaseBuckets,
+		}, []string{"target"}),
+		ConnectDuration: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    service + "_http_client_connect_duration_seconds",
+			Help:    "TCP connect duration for new outbound HTTP connections in seconds",
+			Buckets: phaseBuckets,
+		}, []string{"target"}),
+		TLSDuration: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    service + "_http_client_tls_handshake_duration_seconds",
+			Help:    "TLS handshake duration for new outbound HTTP connections in seconds",
+			Buckets: phaseBuckets,
+		}, []string{"target"}),
+	}
+}
+
+// HTTPTransport is one pooled http.Transport shared by all of a service's outbound clients
+// Clients created with Client share its connections and are told apart in metrics by target
+type HTTPTransport struct {
+	base    *http.Transport
+	metrics *HTTPClientMetrics
+}
+
+// NewHTTPTransport creates a shared transport with config's pool settings
+func NewHTTPTransport(config HTTPTransportConfig, metrics *HTTPClientMetrics) *HTTPTransport {
+	dialer := &net.Dialer{Timeout: config.DialTimeout, KeepAlive: config.KeepAlive}
+	return &HTTPTransport{
+		base: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          config.MaxIdleConns,
+			MaxIdleConnsPerHost:   config.MaxIdleConnsPerHost,
+			MaxConnsPerHost:       config.MaxConnsPerHost,
+			IdleConnTimeout:       config.IdleConnTimeout,
+			TLSHandshakeTimeout:   config.TLSHandshakeTimeout,
+			ExpectContinueTimeout: time.Second,
+		},
+		metrics: metrics,
+	}
+}
+
+// Client returns an http.Client for target using the shared pool
+// timeout bounds each whole request, as http.Client.Timeout does
+func (t *HTTPTransport) Client(target string, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &instrumentedRoundTripper{transport: t, target: target},
+	}
+}
+
+// CloseIdleConnections closes pooled connections, e.g. on shutdown
+func (t *HTTPTransport) CloseIdleConnections() {
+	t.base.CloseIdleConnections()
+}
+
+type instrumentedRoundTripper struct {
+	transport *HTTPTransport
+	target    string
+}
+
+func (rt *instrumentedRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	m := rt.transport.metrics
+	inFlight := m.InFlight.WithLabelValues(rt.target)
+	inFlight.Inc()
+	defer inFlight.Dec()
+
+	phases := &connectionPhases{metrics: m, target: rt.target}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), phases.trace()))
+
+	start := time.Now()
+	resp, err := rt.transport.base.RoundTrip(req)
+	result := "error"
+	if err == nil {
+		result = strconv.Itoa(resp.StatusCode/100) + "xx"
+	}
+	m.RequestDuration.WithLabelValues(rt.target, result).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// connectionPhases times the phases of opening a connection for one request
+// Dials run on their own goroutines and may race each other (e.g. IPv4 and IPv6), hence the lock
+type connectionPhases struct {
+	metrics *HTTPClientMetrics
+	target  string
+
+	mu       sync.Mutex
+	dnsStart time.Time
+	connects map[string]time.Time
+	tlsStart time.Time
+}
+
+func (p *connectionPhases) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			p.mu.Lock()
+			p.dnsStart = time.Now()
+			p.mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if !p.dnsStart.IsZero() {
+				p.metrics.DNSDuration.WithLabelValues(p.target).Observe(time.Since(p.dnsStart).Seconds())
+			}
+		},
+		ConnectStart: func(network, addr string) {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if p.connects == nil {
+				p.connects = make(map[string]time.Time)
+			}
+			p.connects[addr] = time.Now()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			// Only successful connects are timed; failures surface as request errors
+			if started, ok := p.connects[addr]; ok && err == nil {
+				p.metrics.ConnectDuration.WithLabelValues(p.target).Observe(time.Since(started).Seconds())
+			}
+		},
+		TLSHandshakeStart: func() {
+			p.mu.Lock()
+			p.tlsStart = time.Now()
+			p.mu.Unlock()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if !p.tlsStart.IsZero() && err == nil {
+				p.metrics.TLSDuration.WithLabelValues(p.target).Observe(time.Since(p.tlsStart).Seconds())
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			p.metrics.Connections.WithLabelValues(p.target, strconv.FormatBool(info.Reused)).Inc()
+		},
+	}
+}
@@ -0,0 +1,320 @@
+package common
+
+import "strconv"
+
+// Inventory keys and Lua scripts of the processor's Redis inventory store, shared with the
+// simulate command so it runs the same scripts
+
+// InventoryVersionKey holds itemID's active inventory version (missing = 0, the legacy key)
+func InventoryVersionKey(itemID string) string {
+	return "inventory_version:" + itemID
+}
+
+// InventoryKeyForVersion returns the counter key for itemID at version (0 = legacy key)
+func InventoryKeyForVersion(itemID string, version int64) string {
+	if version <= 0 {
+		return "inventory:" + itemID
+	}
+	return "inventory:v" + strconv.FormatInt(version, 10) + ":" + itemID
+}
+
+// InventoryBucketsKey returns the allocation bucket hash for itemID
+func InventoryBucketsKey(itemID string) string {
+	return "inventory_buckets:" + itemID
+}
+
+// InventoryReservationsKey records which buckets each open reservation of an item drew from
+// (request_id -> "quantity|bucket:units,..."); entries are removed on confirm and refund
+func InventoryReservationsKey(itemID string) string {
+	return "inventory_reservations:" + itemID
+}
+
+// InventoryCountsKey returns the unit counts hash for itemID
+func InventoryCountsKey(itemID string) string {
+	return "inventory_counts:" + itemID
+}
+
+// LuaCheckInventoryScript atomically checks and decrements inventory by the order quantity
+// KEYS[1] is inventory_version:{item_id} and KEYS[2] the counter of the version the caller resolved
+// (ARGV[2]); the script rejects the call with VERSION_CHANGED if a cutover happened in between, so
+// an order never decrements a counter that is no longer active (see processor/inventory_versions.go)
+// KEYS[3] is the allocation bucket hash inventory_buckets:{item_id} and ARGV[4] the order's channel
+// (see processor/channel_buckets.go); KEYS[4] is the unit counts hash inventory_counts:{item_id}, whose
+// reserved field is incremented with the decrement (see processor/inventory_projection.go)
+// KEYS[5] is the reservation hash inventory_reservations:{item_id}: with a request_id (ARGV[5]) the
+// reservation is recorded there as "quantity|bucket:units,...|capped" so the refund gives every
+// bucket back exactly what was taken from it, and the confirmation or refund removes it. The record also
+// makes the reservation idempotent: a request_id that already holds units (a retry after a timeout
+// that did reserve) gets ALREADY_RESERVED with success=1 and nothing is taken again
+// ARGV[1] is the quantity (positive integer) and ARGV[3] the reserves of other channels as
+// "channel:percent,..." (empty = none): each channel's reserve is its percentage of the item's
+// units (available plus reserved plus sold) less what it holds already, counted per channel in the
+// channel:{name} fields of KEYS[4], and the order may not take stock below the remaining reserves
+// KEYS[6] is the buyer's purchase counter purchased:{item_id}:{user_id}: with a cap (ARGV[6] > 0)
+// the order is rejected with PURCHASE_LIMIT if the counter plus the quantity exceeds it, else the
+// quantity is added to it with the reservation (expiring ARGV[7] seconds after the first unit), so
+// only reserved units count against the cap. The refund takes them off again
+// Every key is declared in KEYS so the script runs on Redis Cluster when the item's keys share a
+// hash slot (item IDs with a hash tag, e.g. {101})
+// Returns {success: 0|1, stock: int, reason: string, version: int} where:
+//   - success=0: Item sold out (stock < quantity), remaining stock reserved for other channels
+//     (CHANNEL_RESERVED), buyer's purchase cap reached (PURCHASE_LIMIT) or invalid quantity,
+//     inventory already refunded
+//   - success=1: Inventory reserved successfully (SUCCESS), or earlier (ALREADY_RESERVED)
+//
+// This script ensures DECRBY and conditional refund are atomic, preventing race conditions
+// Edge cases handled:
+//   - Missing key: Treated as NOT_INITIALIZED without creating the key
+//   - Invalid quantity: Non-integer, zero or negative quantities are rejected without touching stock
+//   - Redis OOM: Script fails with error (handled in Go code)
+//   - Timeout: Redis will timeout script execution (handled in Go code)
+const LuaCheckInventoryScript = `
+local version = tonumber(redis.call('GET', KEYS[1]) or '0')
+if version ~= tonumber(ARGV[2]) then
+    return redis.error_reply('VERSION_CHANGED')
+end
+local inventory_key = KEYS[2]
+local quantity = tonumber(ARGV[1])
+
+-- The request already holds its units
+if ARGV[5] ~= '' and redis.call('HEXISTS', KEYS[5], ARGV[5]) == 1 then
+    return {1, tonumber(redis.call('GET', inventory_key) or '0'), 'ALREADY_RESERVED', version}
+end
+
+-- Reject fractional, zero or negative quantities so stock can never be increased by an order
+if not quantity or quantity <= 0 or quantity % 1 ~= 0 then
+    return {0, 0, 'INVALID_QUANTITY', version}  -- {success, stock, reason, version}
+end
+
+-- Check if key exists first to handle missing inventory gracefully
+local exists = redis.call('EXISTS', inventory_key)
+if exists == 0 then
+    -- Key doesn't exist - treat as sold out (inventory not initialized)
+    return {0, -1, 'NOT_INITIALIZED', version}  -- {success, stock, reason, version}
+end
+
+-- Per-buyer purchase cap (ARGV[6], 0 = none), counted in KEYS[6] only if the units are reserved
+local cap = tonumber(ARGV[6]) or 0
+if cap > 0 and tonumber(redis.call('GET', KEYS[6]) or '0') + quantity > cap then
+    return {0, tonumber(redis.call('GET', inventory_key)) - quantity, 'PURCHASE_LIMIT', version}
+end
+
+-- Atomically decrement inventory
+local current_stock = redis.call('DECRBY', inventory_key, quantity)
+
+-- Stock still reserved for other channels: their share of the item's units less what they hold
+local floor = 0
+if ARGV[3] ~= '' then
+    local counts = redis.call('HMGET', KEYS[4], 'reserved', 'sold')
+    local units = current_stock + quantity + (tonumber(counts[1]) or 0) + (tonumber(counts[2]) or 0)
+    for reserved_channel, percent in string.gmatch(ARGV[3], '([^,:]+):([%d.]+)') do
+        local held = tonumber(redis.call('HGET', KEYS[4], 'channel:' .. reserved_channel) or '0')
+        floor = floor + math.max(0, math.ceil(units * tonumber(percent) / 100) - held)
+    end
+end
+
+if current_stock < 0 then
+    -- Sold out: refund the decrement immediately to keep inventory accurate
+    redis.call('INCRBY', inventory_key, quantity)
+    return {0, current_stock, 'SOLD_OUT', version}  -- {success, stock, reason, version}
+elseif current_stock < floor then
+    -- Only stock reserved for other channels is left: refund and reject
+    redis.call('INCRBY', inventory_key, quantity)
+    return {0, current_stock, 'CHANNEL_RESERVED', version}  -- {success, stock, reason, version}
+end
+
+-- Units taken from each allocation bucket, recorded for the refund
+local takes = {}
+
+-- Channel allocation buckets: before spill_after an order may use its own channel's bucket plus
+-- stock not allocated to any bucket; afterwards every bucket spills into a shared pool
+local buckets = redis.call('HGETALL', KEYS[3])
+if #buckets > 0 then
+    local channel = ARGV[4]
+    local stock_before = current_stock + quantity
+    local spill_after = nil
+    local own = 0
+    local allocated = 0
+    local others = {}
+    for i = 1, #buckets, 2 do
+        local value = tonumber(buckets[i + 1]) or 0
+        if buckets[i] == 'spill_after' then
+            spill_after = value
+        elseif value > 0 then
+            allocated = allocated + value
+            if buckets[i] == channel then
+                own = value
+            else
+                others[#others + 1] = {buckets[i], value}
+            end
+        end
+    end
+
+    local spilling = spill_after ~= nil and tonumber(redis.call('TIME')[1]) >= spill_after
+    local unallocated = math.max(0, stock_before - allocated)
+    if not spilling and own + unallocated < quantity then
+        redis.call('INCRBY', inventory_key, quantity)
+        return {0, current_stock, 'CHANNEL_RESERVED', version}  -- {success, stock, reason, version}
+    end
+
+    -- Consume the channel's own bucket first, then unallocated stock, then (after spill) other buckets
+    local from_own = math.min(own, quantity)
+    if from_own > 0 then
+        redis.call('HINCRBY', KEYS[3], channel, -from_own)
+        takes[#takes + 1] = channel .. ':' .. from_own
+    end
+    local remaining = quantity - from_own - math.min(unallocated, quantity - from_own)
+    for _, bucket in ipairs(others) do
+        if remaining <= 0 then
+            break
+        end
+        local take = math.min(bucket[2], remaining)
+        redis.call('HINCRBY', KEYS[3], bucket[1], -take)
+        takes[#takes + 1] = bucket[1] .. ':' .. take
+        remaining = remaining - take
+    end
+end
+
+-- The units are held until the order is paid (confirmed) or refunded
+redis.call('HINCRBY', KEYS[4], 'reserved', quantity)
+redis.call('HINCRBY', KEYS[4], 'channel:' .. ARGV[4], quantity)
+local capped = '0'
+if cap > 0 then
+    redis.call('INCRBY', KEYS[6], quantity)
+    if redis.call('TTL', KEYS[6]) < 0 then
+        redis.call('EXPIRE', KEYS[6], ARGV[7])
+    end
+    capped = '1'
+end
+if ARGV[5] ~= '' then
+    redis.call('HSET', KEYS[5], ARGV[5], quantity .. '|' .. table.concat(takes, ',') .. '|' .. capped)
+    -- Records of orders lost before their confirm or refund go with the sale
+    redis.call('EXPIRE', KEYS[5], 86400)
+end
+return {1, current_stock, 'SUCCESS', version}  -- {success, stock, reason, version}
+`
+
+// LuaRefundInventoryScript atomically refunds inventory
+// Used when payment processing fails or order needs to be cancelled
+// KEYS[1] is inventory_version:{item_id} and KEYS[2] the active counter resolved by the caller
+// (ARGV[3]); a cutover in between is rejected with VERSION_CHANGED, like the reservation
+// KEYS[3] is the allocation bucket hash and KEYS[5] the reservation hash: the reservation of
+// request_id ARGV[4] gives each bucket back the units it took and is removed. A request_id without
+// a record holds nothing (never reserved, or already refunded or sold), so nothing is returned;
+// this makes refunds safe to repeat and to attempt when it is unknown whether a reservation ran.
+// Without a request_id the units go to the bucket of channel ARGV[2], if it has one
+// KEYS[4] is the unit counts hash; the refunded units are no longer reserved, nor held by the
+// order's channel ARGV[2]
+// KEYS[6] is the buyer's purchase counter; a reservation that counted against the cap takes its
+// units off again, without going below zero or recreating an expired counter
+// Returns {success: 0|1|2, new_stock: int} where:
+//   - success=1: Refund successful
+//   - success=0: Invalid refund amount
+//   - success=2: Nothing reserved under the request_id, new_stock is the unchanged stock
+//
+// Edge cases handled:
+//   - Missing key: INCRBY on non-existent key initializes to refund_amount
+//   - Invalid amount: Returns 0 if amount is nil, fractional or <= 0
+const LuaRefundInventoryScript = `
+if tonumber(redis.call('GET', KEYS[1]) or '0') ~= tonumber(ARGV[3]) then
+    return redis.error_reply('VERSION_CHANGED')
+end
+local inventory_key = KEYS[2]
+local refund_amount = tonumber(ARGV[1])
+
+-- Validate refund amount
+if not refund_amount or refund_amount <= 0 or refund_amount % 1 ~= 0 then
+    return {0, 0}  -- {success, new_stock}
+end
+
+local record = false
+if ARGV[4] ~= '' then
+    record = redis.call('HGET', KEYS[5], ARGV[4])
+    if not record then
+        return {2, tonumber(redis.call('GET', inventory_key) or '0')}  -- {success, new_stock}
+    end
+end
+
+-- Atomically increment inventory (creates key if doesn't exist)
+local new_stock = redis.call('INCRBY', inventory_key, refund_amount)
+if record then
+    redis.call('HDEL', KEYS[5], ARGV[4])
+    local _, takes, capped = string.match(record, '^(%d+)|([^|]*)|?(%d*)$')
+    for bucket, units in string.gmatch(takes or '', '([^,:]+):(%d+)') do
+        redis.call('HINCRBY', KEYS[3], bucket, tonumber(units))
+    end
+    local purchased = tonumber(redis.call('GET', KEYS[6]) or '0')
+    if capped == '1' and purchased > 0 then
+        redis.call('DECRBY', KEYS[6], math.min(purchased, refund_amount))
+    end
+elseif ARGV[2] ~= '' and redis.call('HEXISTS', KEYS[3], ARGV[2]) == 1 then
+    redis.call('HINCRBY', KEYS[3], ARGV[2], refund_amount)
+end
+local reserved = redis.call('HINCRBY', KEYS[4], 'reserved', -refund_amount)
+if reserved < 0 then
+    redis.call('HSET', KEYS[4], 'reserved', 0)
+end
+if ARGV[2] ~= '' and redis.call('HINCRBY', KEYS[4], 'channel:' .. ARGV[2], -refund_amount) < 0 then
+    redis.call('HSET', KEYS[4], 'channel:' .. ARGV[2], 0)
+end
+return {1, new_stock}  -- {success, new_stock}
+`
+
+// LuaAddStockScript atomically adds restocked units to an initialized item
+// Unlike a refund it never creates the counter: restocking an unknown item is an operator error
+// KEYS[1] is inventory_version:{item_id} and KEYS[2] the active counter resolved by the caller
+// (ARGV[2]); a cutover in between is rejected with VERSION_CHANGED
+// Returns {success: 0|1, stock_before: int, stock_after: int}; success=0 means not initialized
+const LuaAddStockScript = `
+if tonumber(redis.call('GET', KEYS[1]) or '0') ~= tonumber(ARGV[2]) then
+    return redis.error_reply('VERSION_CHANGED')
+end
+local current = redis.call('GET', KEYS[2])
+if not current then
+    return {0, 0, 0}
+end
+return {1, tonumber(current), redis.call('INCRBY', KEYS[2], ARGV[1])}
+`
+
+// LuaConfirmInventoryScript moves a paid order's units from reserved to sold
+// KEYS[1] is inventory_version:{item_id}, KEYS[2] the active counter resolved by the caller
+// (ARGV[2]) and KEYS[3] the unit counts hash inventory_counts:{item_id}; ARGV[1] is the quantity
+// KEYS[4] is the reservation hash; the sold order's reservation (request_id ARGV[3]) is removed
+// A cutover in between is rejected with VERSION_CHANGED before anything is moved
+// An order whose reservation is gone (confirmed or refunded before, e.g. a redelivered confirm)
+// moves nothing, so confirming twice never counts its units as sold twice; without a request_id
+// the units are moved unconditionally
+// Reserved never goes below zero, e.g. for orders reserved before the counts were maintained
+// Returns {available: int, reserved: int, sold: int} (available is -1 if the item has no stock level)
+const LuaConfirmInventoryScript = `
+if tonumber(redis.call('GET', KEYS[1]) or '0') ~= tonumber(ARGV[2]) then
+    return redis.error_reply('VERSION_CHANGED')
+end
+if ARGV[3] ~= '' and redis.call('HEXISTS', KEYS[4], ARGV[3]) == 0 then
+    local counts = redis.call('HMGET', KEYS[3], 'reserved', 'sold')
+    return {tonumber(redis.call('GET', KEYS[2]) or '-1'), tonumber(counts[1] or '0'), tonumber(counts[2] or '0')}
+end
+local quantity = tonumber(ARGV[1])
+local reserved = redis.call('HINCRBY', KEYS[3], 'reserved', -quantity)
+if reserved < 0 then
+    reserved = 0
+    redis.call('HSET', KEYS[3], 'reserved', 0)
+end
+local sold = redis.call('HINCRBY', KEYS[3], 'sold', quantity)
+if ARGV[3] ~= '' then
+    redis.call('HDEL', KEYS[4], ARGV[3])
+end
+return {tonumber(redis.call('GET', KEYS[2]) or '-1'), reserved, sold}
+`
+
+// LuaInventoryProjectionScript reads an item's active counter and unit counts in one step, so
+// a unit moving between them is never counted twice or missed
+// KEYS[1..3] as for LuaConfirmInventoryScript, ARGV[1] is the version the caller resolved
+// Returns {available: int, reserved: int, sold: int} (available is -1 if the item has no stock level)
+const LuaInventoryProjectionScript = `
+if tonumber(redis.call('GET', KEYS[1]) or '0') ~= tonumber(ARGV[1]) then
+    return redis.error_reply('VERSION_CHANGED')
+end
+local counts = redis.call('HMGET', KEYS[3], 'reserved', 'sold')
+return {tonumber(redis.call('GET', KEYS[2]) or '-1'), tonumber(counts[1] or '0'), tonumber(counts[2] or '0')}
+`
@@ -0,0 +1,93 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// TopicInventoryState is a compacted topic keyed by item_id holding the latest stock level
+// Consumers read it from the beginning to rebuild current stock and sold-out flags
+const TopicInventoryState = "inventory-state"
+
+// InventoryState is the value published to TopicInventoryState for an item
+type InventoryState struct {
+	ItemID    string    `json:"item_id"`
+	Stock     int64     `json:"stock"`
+	SoldOut   bool      `json:"sold_out"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NewInventoryStateMessage builds the compacted-topic message for an item's stock level
+// The item_id key lets log compaction retain only the latest state per item
+func NewInventoryStateMessage(itemID string, stock int64) (*sarama.ProducerMessage, error) {
+	state := InventoryState{
+		ItemID:    itemID,
+		Stock:     stock,
+		SoldOut:   stock <= 0,
+		UpdatedAt: time.Now().UTC(),
+	}
+	value, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	return &sarama.ProducerMessage{
+		Topic: TopicInventoryState,
+		Key:   sarama.StringEncoder(itemID),
+		Value: sarama.ByteEncoder(value),
+	}, nil
+}
+
+// ReadInventoryState reads the compacted inventory-state topic up to its current end and
+// returns the latest state per item
+// Tombstones (nil values) remove an item from the result
+func ReadInventoryState(client sarama.Client) (map[string]InventoryState, error) {
+	partitions, err := client.Partitions(TopicInventoryState)
+	if err != nil {
+		return nil, fmt.Errorf("list %s partitions: %w", TopicInventoryState, err)
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return nil, fmt.Errorf("create consumer: %w", err)
+	}
+	defer consumer.Close()
+
+	states := make(map[string]InventoryState)
+	for _, partition := range partitions {
+		// Snapshot the end of the partition so the read terminates even while new updates arrive
+		newest, err := client.GetOffset(TopicInventoryState, partition, sarama.OffsetNewest)
+		if err != nil {
+			return nil, fmt.Errorf("get offset for partition %d: %w", partition, err)
+		}
+		oldest, err := client.GetOffset(TopicInventoryState, partition, sarama.OffsetOldest)
+		if err != nil {
+			return nil, fmt.Errorf("get offset for partition %d: %w", partition, err)
+		}
+		if newest <= oldest {
+			continue
+		}
+
+		pc, err := consumer.ConsumePartition(TopicInventoryState, partition, oldest)
+		if err != nil {
+			return nil, fmt.Errorf("consume partition %d: %w", partition, err)
+		}
+		for msg := range pc.Messages() {
+			if msg.Value == nil {
+				delete(states, string(msg.Key))
+			} else {
+				var state InventoryState
+				if err := json.Unmarshal(msg.Value, &state); err == nil {
+					states[state.ItemID] = state
+				}
+			}
+			if msg.Offset >= newest-1 {
+				break
+			}
+		}
+		pc.Close()
+	}
+	return states, nil
+}
@@ -0,0 +1,136 @@
+package common
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/IBM/sarama"
+)
+
+// SASL mechanisms accepted in KAFKA_SASL_MECHANISM
+const (
+	KafkaSASLPlain       = "PLAIN"
+	KafkaSASLSCRAMSHA256 = "SCRAM-SHA-256"
+	KafkaSASLSCRAMSHA512 = "SCRAM-SHA-512"
+)
+
+// NewKafkaConfig returns a sarama config for the brokers at KAFKA_ADDR, so the engine can run
+// against managed Kafka (MSK, Confluent Cloud); every Kafka client of a service starts from it
+//   - KAFKA_VERSION: broker protocol version to pin, e.g. 3.6.0 (default: sarama's)
+//   - KAFKA_TLS_ENABLED: connect over TLS (default: false)
+//   - KAFKA_TLS_CA_FILE: PEM CA bundle for the brokers' certificates (default: system roots)
+//   - KAFKA_TLS_CERT_FILE, KAFKA_TLS_KEY_FILE: PEM client certificate and key for mutual TLS
+//   - KAFKA_TLS_SERVER_NAME: name to verify the brokers' certificates against
+//   - KAFKA_TLS_INSECURE_SKIP_VERIFY: skip certificate verification; for testing only
+//   - KAFKA_SASL_MECHANISM: PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512 (default: no SASL)
+//   - KAFKA_SASL_USERNAME, KAFKA_SASL_PASSWORD: SASL credentials
+func NewKafkaConfig() (*sarama.Config, error) {
+	config := sarama.NewConfig()
+	if value := os.Getenv("KAFKA_VERSION"); value != "" {
+		version, err := sarama.ParseKafkaVersion(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid KAFKA_VERSION %q: %w", value, err)
+		}
+		config.Version = version
+	}
+
+	if envBool("KAFKA_TLS_ENABLED") {
+		tlsConfig, err := kafkaTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+
+	switch mechanism := strings.ToUpper(os.Getenv("KAFKA_SASL_MECHANISM")); mechanism {
+	case "":
+	case KafkaSASLPlain, KafkaSASLSCRAMSHA256, KafkaSASLSCRAMSHA512:
+		config.Net.SASL.Enable = true
+		config.Net.SASL.Handshake = true
+		config.Net.SASL.Mechanism = sarama.SASLMechanism(mechanism)
+		config.Net.SASL.User = os.Getenv("KAFKA_SASL_USERNAME")
+		config.Net.SASL.Password = os.Getenv("KAFKA_SASL_PASSWORD")
+		if config.Net.SASL.User == "" || config.Net.SASL.Password == "" {
+			return nil, fmt.Errorf("KAFKA_SASL_MECHANISM=%s needs KAFKA_SASL_USERNAME and KAFKA_SASL_PASSWORD", mechanism)
+		}
+		switch mechanism {
+		case KafkaSASLSCRAMSHA256:
+			config.Net.SASL.SCRAMClientGeneratorFunc = scramSHA256
+		case KafkaSASLSCRAMSHA512:
+			config.Net.SASL.SCRAMClientGeneratorFunc = scramSHA512
+		}
+	default:
+		return nil, fmt.Errorf("invalid KAFKA_SASL_MECHANISM %q (PLAIN|SCRAM-SHA-256|SCRAM-SHA-512)", mechanism)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("kafka config: %w", err)
+	}
+	return config, nil
+}
+
+func kafkaTLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         os.Getenv("KAFKA_TLS_SERVER_NAME"),
+		InsecureSkipVerify: envBool("KAFKA_TLS_INSECURE_SKIP_VERIFY"),
+	}
+	if caFile := os.Getenv("KAFKA_TLS_CA_FILE"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("KAFKA_TLS_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("KAFKA_TLS_CA_FILE %s holds no PEM certificates", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	certFile, keyFile := os.Getenv("KAFKA_TLS_CERT_FILE"), os.Getenv("KAFKA_TLS_KEY_FILE")
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("KAFKA_TLS_CERT_FILE and KAFKA_TLS_KEY_FILE must be set together")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("kafka client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// ReportKafkaConfig adds the KAFKA_VERSION, KAFKA_TLS_* and KAFKA_SASL_* settings and checks
+// that NewKafkaConfig accepts them
+func ReportKafkaConfig(r *ConfigReport) {
+	r.String("KAFKA_VERSION", "")
+	tlsEnabled := r.Bool("KAFKA_TLS_ENABLED", false)
+	if tlsEnabled {
+		r.File("KAFKA_TLS_CA_FILE")
+		r.File("KAFKA_TLS_CERT_FILE")
+		r.File("KAFKA_TLS_KEY_FILE")
+		r.String("KAFKA_TLS_SERVER_NAME", "")
+		if r.Bool("KAFKA_TLS_INSECURE_SKIP_VERIFY", false) {
+			r.Warnf("KAFKA_TLS_INSECURE_SKIP_VERIFY is set; broker certificates are not verified")
+		}
+	}
+	if mechanism := r.String("KAFKA_SASL_MECHANISM", ""); mechanism != "" {
+		r.String("KAFKA_SASL_USERNAME", "")
+		r.Secret("KAFKA_SASL_PASSWORD")
+		if strings.EqualFold(mechanism, KafkaSASLPlain) && !tlsEnabled {
+			r.Warnf("KAFKA_SASL_MECHANISM=PLAIN without KAFKA_TLS_ENABLED sends the password in clear text")
+		}
+	}
+	_, err := NewKafkaConfig()
+	r.Check("kafka client config", err)
+}
+
+func envBool(key string) bool {
+	value, _ := strconv.ParseBool(os.Getenv(key))
+	return value
+}
@@ -0,0 +1,140 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"github.com/IBM/sarama"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// scramClient implements sarama.SCRAMClient (RFC 5802) for SCRAM-SHA-256 and SCRAM-SHA-512
+// Usernames and passwords are used as given, without SASLprep normalization, which matches
+// the ASCII credentials MSK and Confluent Cloud issue
+type scramClient struct {
+	newHash func() hash.Hash
+
+	username, password, authzID string
+	step                        int
+	nonce                       string
+	clientFirstBare             string
+	serverSignature             []byte
+	done                        bool
+}
+
+func newSCRAMClientGenerator(newHash func() hash.Hash) func() sarama.SCRAMClient {
+	return func() sarama.SCRAMClient { return &scramClient{newHash: newHash} }
+}
+
+var (
+	scramSHA256 = newSCRAMClientGenerator(sha256.New)
+	scramSHA512 = newSCRAMClientGenerator(sha512.New)
+)
+
+// Begin starts a new exchange for username
+func (c *scramClient) Begin(username, password, authzID string) error {
+	nonce := make([]byte, 24)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	*c = scramClient{newHash: c.newHash, username: username, password: password, authzID: authzID,
+		nonce: base64.RawStdEncoding.EncodeToString(nonce)}
+	return nil
+}
+
+// Step answers the server's challenge: client-first, then client-final, then the server's
+// signature is verified
+func (c *scramClient) Step(challenge string) (string, error) {
+	c.step++
+	switch c.step {
+	case 1:
+		c.clientFirstBare = "n=" + scramName(c.username) + ",r=" + c.nonce
+		return c.gs2Header() + c.clientFirstBare, nil
+	case 2:
+		return c.clientFinal(challenge)
+	case 3:
+		c.done = true
+		attributes := scramAttributes(challenge)
+		if message, ok := attributes["e"]; ok {
+			return "", fmt.Errorf("scram: server rejected authentication: %s", message)
+		}
+		signature, err := base64.StdEncoding.DecodeString(attributes["v"])
+		if err != nil || !hmac.Equal(signature, c.serverSignature) {
+			return "", errors.New("scram: server signature mismatch")
+		}
+		return "", nil
+	}
+	return "", errors.New("scram: unexpected challenge after the exchange completed")
+}
+
+// Done reports whether the server's signature has been checked
+func (c *scramClient) Done() bool {
+	return c.done
+}
+
+func (c *scramClient) gs2Header() string {
+	if c.authzID == "" {
+		return "n,,"
+	}
+	return "n,a=" + scramName(c.authzID) + ","
+}
+
+func (c *scramClient) clientFinal(serverFirst string) (string, error) {
+	attributes := scramAttributes(serverFirst)
+	nonce, salt64, iterations := attributes["r"], attributes["s"], attributes["i"]
+	if !strings.HasPrefix(nonce, c.nonce) || len(nonce) == len(c.nonce) {
+		return "", errors.New("scram: server nonce does not extend the client nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(salt64)
+	if err != nil {
+		return "", fmt.Errorf("scram: invalid salt: %w", err)
+	}
+	rounds, err := strconv.Atoi(iterations)
+	if err != nil || rounds < 1 {
+		return "", fmt.Errorf("scram: invalid iteration count %q", iterations)
+	}
+
+	saltedPassword := pbkdf2.Key([]byte(c.password), salt, rounds, c.newHash().Size(), c.newHash)
+	clientKey := c.hmac(saltedPassword, "Client Key")
+	storedKey := c.newHash()
+	storedKey.Write(clientKey)
+	withoutProof := "c=" + base64.StdEncoding.EncodeToString([]byte(c.gs2Header())) + ",r=" + nonce
+	authMessage := c.clientFirstBare + "," + serverFirst + "," + withoutProof
+
+	proof := c.hmac(storedKey.Sum(nil), authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+	c.serverSignature = c.hmac(c.hmac(saltedPassword, "Server Key"), authMessage)
+	return withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+func (c *scramClient) hmac(key []byte, message string) []byte {
+	mac := hmac.New(c.newHash, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// scramName escapes a username for the n= and a= attributes
+func scramName(name string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(name)
+}
+
+// scramAttributes splits a server message into its single-letter attributes
+func scramAttributes(message string) map[string]string {
+	attributes := make(map[string]string)
+	for _, field := range strings.Split(message, ",") {
+		if key, value, ok := strings.Cut(field, "="); ok {
+			attributes[key] = value
+		}
+	}
+	return attributes
+}
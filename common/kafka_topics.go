@@ -0,0 +1,201 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sirupsen/logrus"
+)
+
+// Topic names shared by gateway and processor
+const (
+	TopicOrders           = "orders"
+	TopicOrdersRetry5s    = "orders-retry-5s" // Retry tiers for transient failures, see HeaderRetryAttempt
+	TopicOrdersRetry1m    = "orders-retry-1m"
+	TopicOrdersRetry10m   = "orders-retry-10m"
+	TopicOrdersDLQ        = "orders-dlq"
+	TopicOrdersQuarantine = "orders-quarantine" // DLQ messages that must not be retried
+	TopicOrderResults     = "order-results"
+	TopicSLABreaches      = "order-sla-breaches"
+)
+
+// UserKeyPrefix starts order message keys derived from user_id (gateway ORDER_PARTITION_KEY_MODE=user);
+// other keys are "item_id" or "item_id#shard"
+const UserKeyPrefix = "user:"
+
+// HeaderReplayAttempt counts how often an order was replayed from the DLQ; it is carried back
+// into the DLQ so a replayed order that fails again isn't retried forever
+const HeaderReplayAttempt = "replay_attempt"
+
+// HeaderRetryAttempt counts how often an order was sent to a retry topic after a transient
+// failure; the processor moves it to the DLQ once ORDER_RETRY_MAX_ATTEMPTS is reached
+const HeaderRetryAttempt = "retry_attempt"
+
+// TopicSpec describes how a topic should be created
+type TopicSpec struct {
+	Name              string
+	Partitions        int32
+	ReplicationFactor int16
+	Retention         time.Duration // 0 keeps the broker default
+	Compacted         bool          // cleanup.policy=compact instead of delete
+}
+
+// DefaultTopicSpecs returns the topics required by the engine
+// Defaults come from KAFKA_TOPIC_PARTITIONS (3), KAFKA_TOPIC_REPLICATION_FACTOR (1) and
+// KAFKA_TOPIC_RETENTION (168h); each can be overridden per topic, e.g.
+// KAFKA_TOPIC_ORDERS_DLQ_RETENTION=720h or KAFKA_TOPIC_ORDERS_PARTITIONS=12
+// Every partition of the order topics is consumed: the processor consumer group assigns them all
+func DefaultTopicSpecs() []TopicSpec {
+	names := []string{TopicOrders, TopicOrdersRetry5s, TopicOrdersRetry1m, TopicOrdersRetry10m, TopicOrdersDLQ, TopicOrdersQuarantine, TopicOrderResults, TopicSLABreaches, TopicFulfillment}
+	specs := make([]TopicSpec, 0, len(names)+1)
+	for _, name := range names {
+		specs = append(specs, topicSpecFromEnv(name))
+	}
+
+	// inventory-state is compacted rather than time-limited: the latest state per item must survive
+	inventoryState := topicSpecFromEnv(TopicInventoryState)
+	inventoryState.Retention = 0
+	inventoryState.Compacted = true
+	specs = append(specs, inventoryState)
+
+	return specs
+}
+
+// CampaignTopicSpec returns the spec for campaign's orders topic
+// Campaign topics are created like the shared orders topic (KAFKA_TOPIC_ORDERS_* overrides apply)
+func CampaignTopicSpec(campaign string) TopicSpec {
+	spec := topicSpecFromEnv(TopicOrders)
+	spec.Name = CampaignTopicName(campaign)
+	return spec
+}
+
+func topicSpecFromEnv(name string) TopicSpec {
+	prefix := "KAFKA_TOPIC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+
+	partitions := envInt(prefix+"PARTITIONS", envInt("KAFKA_TOPIC_PARTITIONS", 3))
+	replication := envInt(prefix+"REPLICATION_FACTOR", envInt("KAFKA_TOPIC_REPLICATION_FACTOR", 1))
+	retention := envDuration(prefix+"RETENTION", envDuration("KAFKA_TOPIC_RETENTION", 168*time.Hour))
+
+	return TopicSpec{
+		Name:              name,
+		Partitions:        int32(partitions),
+		ReplicationFactor: int16(replication),
+		Retention:         retention,
+	}
+}
+
+// BootstrapTopics creates any missing topics from specs using the Kafka admin client
+// Existing topics, including ones another service creates meanwhile, are left untouched; a
+// warning is logged if they have fewer partitions than configured, since partition counts can
+// only be raised deliberately by an operator
+func BootstrapTopics(brokers []string, config *sarama.Config, specs []TopicSpec, logger *logrus.Logger) error {
+	if config == nil {
+		config = sarama.NewConfig()
+	}
+	admin, err := sarama.NewClusterAdmin(brokers, config)
+	if err != nil {
+		return fmt.Errorf("create cluster admin: %w", err)
+	}
+	defer admin.Close()
+
+	existing, err := admin.ListTopics()
+	if err != nil {
+		return fmt.Errorf("list topics: %w", err)
+	}
+
+	for _, spec := range specs {
+		entry := logger.WithFields(logrus.Fields{
+			"topic":              spec.Name,
+			"partitions":         spec.Partitions,
+			"replication_factor": spec.ReplicationFactor,
+		})
+
+		if detail, ok := existing[spec.Name]; ok {
+			if detail.NumPartitions < spec.Partitions {
+				entry.WithField("actual_partitions", detail.NumPartitions).
+					Warn("Topic exists with fewer partitions than configured")
+			} else {
+				entry.Debug("Topic already exists")
+			}
+			continue
+		}
+
+		// Gateways and processors bootstrap concurrently, so another service may create it first
+		err := admin.CreateTopic(spec.Name, spec.topicDetail(), false)
+		if errors.Is(err, sarama.ErrTopicAlreadyExists) {
+			entry.Debug("Topic created concurrently")
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("create topic %s: %w", spec.Name, err)
+		}
+		entry.Info("Topic created")
+	}
+	return nil
+}
+
+// CreateTopic creates spec's topic; an existing topic is left untouched and is not an error
+func CreateTopic(brokers []string, config *sarama.Config, spec TopicSpec) error {
+	admin, err := sarama.NewClusterAdmin(brokers, config)
+	if err != nil {
+		return fmt.Errorf("create cluster admin: %w", err)
+	}
+	defer admin.Close()
+	if err := admin.CreateTopic(spec.Name, spec.topicDetail(), false); err != nil && !errors.Is(err, sarama.ErrTopicAlreadyExists) {
+		return fmt.Errorf("create topic %s: %w", spec.Name, err)
+	}
+	return nil
+}
+
+// DeleteTopic deletes topic and its messages; a missing topic is not an error
+func DeleteTopic(brokers []string, config *sarama.Config, topic string) error {
+	admin, err := sarama.NewClusterAdmin(brokers, config)
+	if err != nil {
+		return fmt.Errorf("create cluster admin: %w", err)
+	}
+	defer admin.Close()
+	if err := admin.DeleteTopic(topic); err != nil && !errors.Is(err, sarama.ErrUnknownTopicOrPartition) {
+		return fmt.Errorf("delete topic %s: %w", topic, err)
+	}
+	return nil
+}
+
+func (spec TopicSpec) topicDetail() *sarama.TopicDetail {
+	configEntries := make(map[string]*string)
+	if spec.Retention > 0 {
+		retentionMs := strconv.FormatInt(spec.Retention.Milliseconds(), 10)
+		configEntries["retention.ms"] = &retentionMs
+	}
+	if spec.Compacted {
+		policy := "compact"
+		configEntries["cleanup.policy"] = &policy
+	}
+	return &sarama.TopicDetail{
+		NumPartitions:     spec.Partitions,
+		ReplicationFactor: spec.ReplicationFactor,
+		ConfigEntries:     configEntries,
+	}
+}
+
+func envInt(key string, defaultValue int) int {
+	if val := os.Getenv(key); val != "" {
+		if intVal, err := strconv.Atoi(val); err == nil {
+			return intVal
+		}
+	}
+	return defaultValue
+}
+
+func envDuration(key string, defaultValue time.Duration) time.Duration {
+	if val := os.Getenv(key); val != "" {
+		if duration, err := time.ParseDuration(val); err == nil {
+			return duration
+		}
+	}
+	return defaultValue
+}
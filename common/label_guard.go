@@ -0,0 +1,130 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultItemLabelLimit is the number of item_id label values exported by default
+const DefaultItemLabelLimit = 100
+
+// ItemLabelGuard bounds the item_id label cardinality of a service's metrics
+// The limit busiest items (by observed orders) get their own label value and every other item
+// is "other", so a campaign with tens of thousands of SKUs exports at most limit+1 values per metric
+// Pinned items always keep their label. When an unlabeled item becomes busier than twice the
+// quietest labeled one it takes that item's place, and the demoted item's series are deleted
+// from the guarded metrics
+type ItemLabelGuard struct {
+	mu      sync.Mutex
+	limit   int
+	pinned  map[string]bool
+	counts  map[string]uint64 // Observed orders per item, labeled or not
+	labeled map[string]bool
+	vecs    []*prometheus.MetricVec
+}
+
+// NewItemLabelGuard creates a guard exporting at most limit items, including pinned ones
+func NewItemLabelGuard(limit int, pinned []string) *ItemLabelGuard {
+	g := &ItemLabelGuard{
+		limit:   limit,
+		pinned:  make(map[string]bool, len(pinned)),
+		counts:  make(map[string]uint64),
+		labeled: make(map[string]bool),
+	}
+	for _, itemID := range pinned {
+		g.pinned[itemID] = true
+		g.labeled[itemID] = true
+	}
+	return g
+}
+
+// ConfigureFromEnv applies the environment; must be called before any item is observed
+//   - METRIC_ITEM_LABEL_LIMIT: item_id label values per metric (default: DefaultItemLabelLimit)
+//   - METRIC_PINNED_ITEMS: comma-separated item IDs that always keep their label
+func (g *ItemLabelGuard) ConfigureFromEnv() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if value := os.Getenv("METRIC_ITEM_LABEL_LIMIT"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return fmt.Errorf("invalid METRIC_ITEM_LABEL_LIMIT %q", value)
+		}
+		g.limit = limit
+	}
+	for _, itemID := range strings.Split(os.Getenv("METRIC_PINNED_ITEMS"), ",") {
+		if itemID = strings.TrimSpace(itemID); itemID != "" {
+			g.pinned[itemID] = true
+			g.labeled[itemID] = true
+		}
+	}
+	return nil
+}
+
+// Guard registers metric vectors whose series for demoted items are deleted
+// Each vector must have an item_id label
+func (g *ItemLabelGuard) Guard(vecs ...*prometheus.MetricVec) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.vecs = append(g.vecs, vecs...)
+}
+
+// Observe counts one order for itemID and returns its label value
+func (g *ItemLabelGuard) Observe(itemID string) string {
+	if itemID == "" {
+		return ItemLabelUnknown
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.counts[itemID]++
+	if g.labeled[itemID] {
+		return itemID
+	}
+	if len(g.labeled) < g.limit {
+		g.labeled[itemID] = true
+		return itemID
+	}
+
+	quietest, quietestCount := "", uint64(0)
+	for labeled := range g.labeled {
+		if g.pinned[labeled] {
+			continue
+		}
+		if quietest == "" || g.counts[labeled] < quietestCount {
+			quietest, quietestCount = labeled, g.counts[labeled]
+		}
+	}
+	// The factor of two keeps items of similar volume from swapping places on every order
+	if quietest == "" || g.counts[itemID] <= 2*quietestCount {
+		return ItemLabelOther
+	}
+	delete(g.labeled, quietest)
+	for _, vec := range g.vecs {
+		vec.DeletePartialMatch(prometheus.Labels{"item_id": quietest})
+	}
+	g.labeled[itemID] = true
+	return itemID
+}
+
+// Label returns itemID's label value without counting an order, or "other"
+func (g *ItemLabelGuard) Label(itemID string) string {
+	if itemID == "" {
+		return ItemLabelUnknown
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.labeled[itemID] {
+		return itemID
+	}
+	return ItemLabelOther
+}
+
+// Labeled reports whether itemID currently has its own label value
+// Gauges skip other items: a shared "other" gauge would only hold the last item's value
+func (g *ItemLabelGuard) Labeled(itemID string) bool {
+	return g.Label(itemID) == itemID
+}
@@ -7,31 +7,126 @@ import (
 
 // GatewayMetrics holds all Prometheus metrics for the gateway service
 type GatewayMetrics struct {
-	OrdersReceived      prometheus.Counter
-	OrdersSuccessful    prometheus.Counter
-	OrdersFailed        prometheus.Counter
-	OrdersValidationFailed prometheus.Counter
-	OrdersIdempotencyRejected prometheus.Counter
-	RequestDuration     prometheus.Histogram
-	CircuitBreakerState prometheus.Gauge
+	OrdersReceived             prometheus.Counter
+	OrdersSuccessful           prometheus.Counter
+	OrdersFailed               prometheus.Counter
+	OrdersValidationFailed     *prometheus.CounterVec
+	OrdersIdempotencyRejected  prometheus.Counter
+	OrdersDuplicateIntent      prometheus.Counter
+	OrdersBuffered             prometheus.Counter
+	OutageBufferSize           prometheus.Gauge
+	OrdersQueuedByChannel      *prometheus.CounterVec
+	RedisDegraded              prometheus.Gauge
+	IPLimited                  *prometheus.CounterVec
+	GeoAdmission               *prometheus.CounterVec
+	DeviceTokens               *prometheus.CounterVec
+	RiskDecisions              *prometheus.CounterVec
+	PurchaseTokens             *prometheus.CounterVec
+	PurchaseAdmission          *prometheus.CounterVec
+	ItemAdmissionRate          *prometheus.CounterVec
+	AdmissionPolicyDecisions   *prometheus.CounterVec
+	AdmissionPolicyDuration    *prometheus.HistogramVec
+	OrderAmendments            *prometheus.CounterVec
+	Waitlist                   *prometheus.CounterVec
+	Orders                     *OrderOutcomes
+	ItemLabels                 *ItemLabelGuard
+	RateLimitDecisions         *prometheus.CounterVec
+	RateLimitObservedRate      *prometheus.HistogramVec
+	RateLimitExemptions        *prometheus.CounterVec
+	RequestBudgetExceeded      *prometheus.CounterVec
+	BuyRequestsInFlight        prometheus.Gauge
+	BuyRequestsRefusedDraining prometheus.Counter
+	KafkaAsyncErrors           prometheus.Counter
+	HTTPClients                *HTTPClientMetrics
+	Redis                      *RedisCommandMetrics
+	RequestDuration            prometheus.Histogram
+	CircuitBreakerState        prometheus.Gauge
+	BuildInfo                  *prometheus.GaugeVec
 }
 
 // ProcessorMetrics holds all Prometheus metrics for the processor service
 type ProcessorMetrics struct {
-	OrdersProcessed     prometheus.Counter
+	OrdersProcessed        prometheus.Counter
 	OrdersProcessedSuccess prometheus.Counter
-	OrdersProcessedFailed prometheus.Counter
-	OrdersSoldOut       prometheus.Counter
-	OrdersMovedToDLQ    prometheus.Counter
-	ProcessingDuration prometheus.Histogram
-	DLQSize            prometheus.Gauge
-	DLQAge             prometheus.Gauge
-	InventoryLevels    *prometheus.GaugeVec
+	OrdersProcessedFailed  prometheus.Counter
+	OrdersSoldOut          prometheus.Counter
+	OrdersMovedToDLQ       prometheus.Counter
+	ProcessingDuration     prometheus.Histogram
+	DLQSize                prometheus.Gauge
+	DLQAge                 prometheus.Gauge
+	DLQSpilled             *prometheus.CounterVec
+	DeliveryAudit          *prometheus.CounterVec
+	DeliveryAuditStuck     prometheus.Gauge
+	DLQSpillPending        prometheus.Gauge
+	DLQReplayed            *prometheus.CounterVec
+	InventoryLevels        *prometheus.GaugeVec
+	InventoryUnits         *prometheus.GaugeVec
+	OrderEndToEndDuration  prometheus.Histogram
+	SLABreaches            *prometheus.CounterVec
+	ParkedOrders           prometheus.Gauge
+	UnauthenticatedOrders  prometheus.Counter
+	OrdersByChannel        *prometheus.CounterVec
+	RedisDegraded          prometheus.Gauge
+	FulfillmentEvents      *prometheus.CounterVec
+	DigitalCodesRemaining  *prometheus.GaugeVec
+	PaymentCharges         *prometheus.CounterVec
+	DigitalCodesExhausted  *prometheus.CounterVec
+	Orders                 *OrderOutcomes
+	ItemLabels             *ItemLabelGuard
+	CanaryLatency          prometheus.Histogram
+	CanaryRuns             *prometheus.CounterVec
+	CanaryLastSuccess      prometheus.Gauge
+	HTTPClients            *HTTPClientMetrics
+	Redis                  *RedisCommandMetrics
+	TopicMessages          *prometheus.CounterVec
+	OrdersExpired          *prometheus.CounterVec
+	Workers                prometheus.Gauge
+	WorkersBusy            prometheus.Gauge
+	DuplicateOrderCopies   prometheus.Counter
+	OrderRetries           *prometheus.CounterVec
+	OrderRetriesExhausted  *prometheus.CounterVec
+	TopicLag               *prometheus.GaugeVec
+	SubscribedTopics       prometheus.Gauge
+	OrderStoreWrites       *prometheus.CounterVec
+	OrderOutboxEvents      *prometheus.CounterVec
+	OrderOutboxPending     prometheus.Gauge
+	RetentionRecords       *prometheus.CounterVec
+	RetentionRuns          *prometheus.CounterVec
+	CampaignExports        *prometheus.CounterVec
+	CampaignExportRows     *prometheus.CounterVec
+	BuildInfo              *prometheus.GaugeVec
+}
+
+// NotifierMetrics holds all Prometheus metrics for the notifier service
+type NotifierMetrics struct {
+	ResultsConsumed   *prometheus.CounterVec
+	Notifications     *prometheus.CounterVec
+	EmailDeliveries   *prometheus.CounterVec
+	EmailSendDuration *prometheus.HistogramVec
+	EmailThrottled    *prometheus.CounterVec
+	SMSSpend          prometheus.Counter
+	HTTPClients       *HTTPClientMetrics
+	Redis             *RedisCommandMetrics
+	BuildInfo         *prometheus.GaugeVec
+}
+
+// ProjectorMetrics holds all Prometheus metrics for the projector service
+type ProjectorMetrics struct {
+	EventsProjected  *prometheus.CounterVec
+	ProjectionDelay  prometheus.Histogram
+	WarehouseRows    *prometheus.CounterVec
+	WarehouseBatches *prometheus.CounterVec
+	WarehouseDelay   prometheus.Histogram
+	HTTPClients      *HTTPClientMetrics
+	Redis            *RedisCommandMetrics
+	BuildInfo        *prometheus.GaugeVec
 }
 
 var (
 	GatewayMetricsInstance   *GatewayMetrics
 	ProcessorMetricsInstance *ProcessorMetrics
+	NotifierMetricsInstance  *NotifierMetrics
+	ProjectorMetricsInstance *ProjectorMetrics
 )
 
 // InitGatewayMetrics initializes Prometheus metrics for gateway
@@ -49,14 +144,79 @@ func InitGatewayMetrics() *GatewayMetrics {
 			Name: "gateway_orders_failed_total",
 			Help: "Total number of orders that failed to queue",
 		}),
-		OrdersValidationFailed: promauto.NewCounter(prometheus.CounterOpts{
+		OrdersValidationFailed: promauto.NewCounterVec(prometheus.CounterOpts{
 			Name: "gateway_orders_validation_failed_total",
-			Help: "Total number of orders rejected due to validation errors",
-		}),
+			Help: "Total number of order validation errors by failing field and rule (validation error code)",
+		}, []string{"field", "rule"}),
 		OrdersIdempotencyRejected: promauto.NewCounter(prometheus.CounterOpts{
 			Name: "gateway_orders_idempotency_rejected_total",
 			Help: "Total number of duplicate orders rejected",
 		}),
+		OrdersDuplicateIntent: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "gateway_orders_duplicate_intent_total",
+			Help: "Total number of purchase attempts flagged as duplicate user+item intents",
+		}),
+		OrdersBuffered: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "gateway_orders_buffered_total",
+			Help: "Total number of orders accepted into the outage buffer while Kafka was unavailable",
+		}),
+		OutageBufferSize: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "gateway_outage_buffer_size",
+			Help: "Number of orders currently held in the outage buffer",
+		}),
+		OrdersQueuedByChannel: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_orders_queued_by_channel_total",
+			Help: "Total number of orders accepted (queued or buffered) by source channel",
+		}, []string{"channel"}),
+		RedisDegraded: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "gateway_redis_degraded",
+			Help: "Redis degradation state (0=normal, 1=out of memory, non-essential writes suspended)",
+		}),
+		IPLimited: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_ip_limited_total",
+			Help: "Total number of requests rejected by per-IP limits",
+		}, []string{"limit"}),
+		GeoAdmission: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_geo_admission_total",
+			Help: "Total number of orders evaluated by geo admission rules by outcome (allowed or denial reason)",
+		}, []string{"outcome"}),
+		DeviceTokens: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_device_tokens_total",
+			Help: "Total number of device tokens checked by result (valid, missing, invalid, expired)",
+		}, []string{"result"}),
+		RiskDecisions: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_risk_decisions_total",
+			Help: "Total number of risk-scored orders by outcome (allowed, blocked, error)",
+		}, []string{"outcome"}),
+		PurchaseTokens: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_purchase_tokens_total",
+			Help: "Total number of purchase token events by result (issued, denied, gate_error, valid, missing, invalid, expired, mismatch)",
+		}, []string{"result"}),
+		PurchaseAdmission: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_purchase_admission_total",
+			Help: "Total number of registration and purchase cap decisions by result (registered, admitted, not_registered, cap_exceeded, error)",
+		}, []string{"result"}),
+		ItemAdmissionRate: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_item_admission_rate_total",
+			Help: "Total number of fleet-wide item admission rate decisions by result (admitted, rejected, error)",
+		}, []string{"result"}),
+		AdmissionPolicyDecisions: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_admission_policy_decisions_total",
+			Help: "Total number of /buy admission policy decisions by policy and result (admitted, rejected)",
+		}, []string{"policy", "result"}),
+		AdmissionPolicyDuration: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "gateway_admission_policy_duration_seconds",
+			Help:    "Time each /buy admission policy took to decide in seconds",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+		}, []string{"policy"}),
+		OrderAmendments: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_order_amendments_total",
+			Help: "Total number of order amendment requests by action (cancel, quantity) and outcome",
+		}, []string{"action", "outcome"}),
+		Waitlist: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_waitlist_events_total",
+			Help: "Total number of back-in-stock waitlist events by result (joined, offered)",
+		}, []string{"result"}),
 		RequestDuration: promauto.NewHistogram(prometheus.HistogramOpts{
 			Name:    "gateway_request_duration_seconds",
 			Help:    "Request processing duration in seconds",
@@ -66,7 +226,41 @@ func InitGatewayMetrics() *GatewayMetrics {
 			Name: "gateway_circuit_breaker_state",
 			Help: "Circuit breaker state (0=closed, 1=open, 2=half-open)",
 		}),
+		ItemLabels: NewItemLabelGuard(DefaultItemLabelLimit, nil),
+		RateLimitDecisions: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_rate_limit_decisions_total",
+			Help: "Total number of rate limiter decisions by policy (user, ip) and result (allowed, rejected, error)",
+		}, []string{"policy", "result"}),
+		RateLimitObservedRate: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "gateway_rate_limit_observed_rate",
+			Help:    "Requests per minute in the caller's rate limit window, observed on each request",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+		}, []string{"policy"}),
+		RateLimitExemptions: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_rate_limit_exemptions_total",
+			Help: "Requests presenting a rate limit exemption token by result (exempted, quota_exceeded, invalid, expired, revoked, error)",
+		}, []string{"result"}),
+		RequestBudgetExceeded: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_request_budget_exceeded_total",
+			Help: "Buy requests that ran out of BUY_REQUEST_TIMEOUT by stage (rate_limit, admission, idempotency, status, publish)",
+		}, []string{"stage"}),
+		BuyRequestsInFlight: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "gateway_buy_requests_in_flight",
+			Help: "Buy requests currently being handled, waited for on shutdown",
+		}),
+		BuyRequestsRefusedDraining: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "gateway_buy_requests_refused_draining_total",
+			Help: "Buy requests refused with 503 because the gateway was shutting down",
+		}),
+		KafkaAsyncErrors: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "gateway_kafka_async_errors_total",
+			Help: "Orders the batching producer (KAFKA_PRODUCER_MODE=async) failed to deliver; each is rolled back by its request",
+		}),
 	}
+	metrics.Orders = newOrderOutcomes("gateway", metrics.ItemLabels)
+	metrics.HTTPClients = newHTTPClientMetrics("gateway")
+	metrics.Redis = newRedisCommandMetrics("gateway")
+	metrics.BuildInfo = newBuildInfoMetric("gateway")
 	GatewayMetricsInstance = metrics
 	return metrics
 }
@@ -107,12 +301,228 @@ func InitProcessorMetrics() *ProcessorMetrics {
 			Name: "processor_dlq_oldest_message_age_seconds",
 			Help: "Age of oldest message in DLQ in seconds",
 		}),
+		DeliveryAudit: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "processor_delivery_audit_orders_total",
+			Help: "Orders checked by the delivery audit by result (terminal, stuck past the deadline, late when a stuck order finished afterwards)",
+		}, []string{"result"}),
+		DeliveryAuditStuck: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "processor_delivery_audit_stuck",
+			Help: "Orders consumed that have no terminal status past DELIVERY_AUDIT_DEADLINE",
+		}),
+		DLQSpilled: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "processor_dlq_spill_messages_total",
+			Help: "DLQ messages that failed to publish by result (spilled to Redis, republished from the spill, lost when the spill failed too)",
+		}, []string{"result"}),
+		DLQSpillPending: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "processor_dlq_spill_pending",
+			Help: "DLQ messages spilled to Redis waiting to be republished",
+		}),
+		DLQReplayed: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "processor_dlq_replay_messages_total",
+			Help: "DLQ messages routed by admin replays by result (republished, quarantined, already_routed, failed)",
+		}, []string{"result"}),
 		InventoryLevels: promauto.NewGaugeVec(prometheus.GaugeOpts{
 			Name: "processor_inventory_level",
 			Help: "Current inventory level for items",
 		}, []string{"item_id"}),
+		InventoryUnits: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "processor_inventory_units",
+			Help: "Inventory units by state (available, reserved by unpaid orders, sold); their sum is the item's total",
+		}, []string{"item_id", "state"}),
+		OrderEndToEndDuration: promauto.NewHistogram(prometheus.HistogramOpts{
+			Name:    "processor_order_end_to_end_duration_seconds",
+			Help:    "Time from gateway acceptance to the order's terminal state in seconds",
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+		}),
+		SLABreaches: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "processor_sla_breaches_total",
+			Help: "Total number of orders that reached a terminal state after the SLA target",
+		}, []string{"outcome"}),
+		ParkedOrders: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "processor_parked_orders",
+			Help: "Orders parked for paused items minus those released by this instance; sum over instances for the total",
+		}),
+		UnauthenticatedOrders: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "processor_unauthenticated_orders_total",
+			Help: "Total number of order messages rejected for a missing or invalid signature",
+		}),
+		OrdersByChannel: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "processor_orders_by_channel_total",
+			Help: "Total number of orders reaching a terminal outcome by source channel",
+		}, []string{"channel", "outcome"}),
+		RedisDegraded: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "processor_redis_degraded",
+			Help: "Redis degradation state (0=normal, 1=out of memory)",
+		}),
+		FulfillmentEvents: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "processor_fulfillment_events_total",
+			Help: "Total number of fulfillment deliveries by result (published, retried, failed)",
+		}, []string{"result"}),
+		PaymentCharges: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "processor_payment_charges_total",
+			Help: "Total number of payment charges by result (succeeded, declined, pending, error, already_charged)",
+		}, []string{"result"}),
+		DigitalCodesRemaining: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "processor_digital_codes_remaining",
+			Help: "Codes left in each digital item's pool after the last assignment",
+		}, []string{"item_id"}),
+		DigitalCodesExhausted: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "processor_digital_codes_exhausted_total",
+			Help: "Total number of confirmed digital orders that found the code pool empty",
+		}, []string{"item_id"}),
+		ItemLabels: NewItemLabelGuard(DefaultItemLabelLimit, nil),
+		CanaryLatency: promauto.NewHistogram(prometheus.HistogramOpts{
+			Name:    "processor_canary_latency_seconds",
+			Help:    "Time from publishing a canary order to its processed result in seconds",
+			Buckets: []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		}),
+		CanaryRuns: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "processor_canary_runs_total",
+			Help: "Total number of canary orders by result (success, timeout, failed)",
+		}, []string{"result"}),
+		CanaryLastSuccess: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "processor_canary_last_success_timestamp_seconds",
+			Help: "Unix time of the last canary order processed successfully",
+		}),
+		Workers: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "processor_workers",
+			Help: "Number of order processing workers (PROCESSOR_WORKERS)",
+		}),
+		WorkersBusy: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "processor_workers_busy",
+			Help: "Number of order processing workers currently processing an order",
+		}),
+		OrdersExpired: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "processor_orders_expired_total",
+			Help: "Total number of orders expired on consume instead of processed, by reason (max_age, sale_ended)",
+		}, []string{"reason"}),
+		DuplicateOrderCopies: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "processor_duplicate_order_copies_total",
+			Help: "Total number of order copies skipped because another copy of the same request_id was already processed",
+		}),
+		OrderRetries: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "processor_order_retries_total",
+			Help: "Total number of orders sent to a retry topic after a transient failure by topic and reason",
+		}, []string{"topic", "reason"}),
+		OrderRetriesExhausted: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "processor_order_retries_exhausted_total",
+			Help: "Total number of orders moved to the DLQ after ORDER_RETRY_MAX_ATTEMPTS retries by reason",
+		}, []string{"reason"}),
+		TopicMessages: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "processor_topic_messages_total",
+			Help: "Total number of order messages handed to processing by topic",
+		}, []string{"topic"}),
+		TopicLag: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "processor_topic_lag",
+			Help: "Messages behind the end of each consumed partition, measured as each order is picked up",
+		}, []string{"topic", "partition"}),
+		SubscribedTopics: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "processor_subscribed_topics",
+			Help: "Number of order topics consumed (ORDER_TOPIC_PATTERN)",
+		}),
+		OrderStoreWrites: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "processor_order_store_writes_total",
+			Help: "Order results written to the order store, by result (written, failed, dropped when the queue is full)",
+		}, []string{"result"}),
+		OrderOutboxEvents: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "processor_order_outbox_events_total",
+			Help: "Order result events relayed from the order store outbox, by result (published, failed, invalid)",
+		}, []string{"result"}),
+		OrderOutboxPending: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "processor_order_outbox_pending",
+			Help: "Order result events in the outbox waiting to be published",
+		}),
+		RetentionRecords: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "processor_retention_records_total",
+			Help: "Records removed by the retention job, by dataset and action (soft_deleted, archived, purged)",
+		}, []string{"dataset", "action"}),
+		RetentionRuns: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "processor_retention_runs_total",
+			Help: "Retention passes run by this instance, by result (completed, failed)",
+		}, []string{"result"}),
+		CampaignExports: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "processor_campaign_exports_total",
+			Help: "Campaign exports to object storage run by this instance, by result (completed, failed)",
+		}, []string{"result"}),
+		CampaignExportRows: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "processor_campaign_export_rows_total",
+			Help: "Rows written by campaign exports, by dataset (orders, dlq)",
+		}, []string{"dataset"}),
 	}
+	metrics.Orders = newOrderOutcomes("processor", metrics.ItemLabels)
+	metrics.HTTPClients = newHTTPClientMetrics("processor")
+	metrics.Redis = newRedisCommandMetrics("processor")
+	metrics.BuildInfo = newBuildInfoMetric("processor")
+	metrics.ItemLabels.Guard(metrics.InventoryLevels.MetricVec, metrics.InventoryUnits.MetricVec)
 	ProcessorMetricsInstance = metrics
 	return metrics
 }
 
+// InitNotifierMetrics initializes Prometheus metrics for notifier
+func InitNotifierMetrics() *NotifierMetrics {
+	metrics := &NotifierMetrics{
+		ResultsConsumed: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "notifier_results_consumed_total",
+			Help: "Total number of order results consumed by status (ignored statuses included)",
+		}, []string{"status"}),
+		Notifications: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "notifier_notifications_total",
+			Help: "Total number of notifications by channel (webhook, email, log) and result (sent, retried, failed, duplicate, skipped)",
+		}, []string{"channel", "result"}),
+		EmailDeliveries: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "notifier_email_deliveries_total",
+			Help: "Total number of email send attempts by provider and status (accepted, rejected, failed)",
+		}, []string{"provider", "status"}),
+		EmailSendDuration: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "notifier_email_send_duration_seconds",
+			Help:    "Time the email provider took to accept or refuse a message in seconds",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"provider"}),
+		EmailThrottled: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "notifier_email_throttled_total",
+			Help: "Total number of email sends delayed by the provider rate limit",
+		}, []string{"provider"}),
+		SMSSpend: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "notifier_sms_spend_total",
+			Help: "Cost of sent SMS notifications in NOTIFIER_SMS_COST units",
+		}),
+	}
+	metrics.HTTPClients = newHTTPClientMetrics("notifier")
+	metrics.Redis = newRedisCommandMetrics("notifier")
+	metrics.BuildInfo = newBuildInfoMetric("notifier")
+	NotifierMetricsInstance = metrics
+	return metrics
+}
+
+// InitProjectorMetrics initializes Prometheus metrics for projector
+func InitProjectorMetrics() *ProjectorMetrics {
+	metrics := &ProjectorMetrics{
+		EventsProjected: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "projector_events_total",
+			Help: "Order results consumed by outcome (applied, duplicate, stale, ignored, failed)",
+		}, []string{"result"}),
+		ProjectionDelay: promauto.NewHistogram(prometheus.HistogramOpts{
+			Name:    "projector_projection_delay_seconds",
+			Help:    "Time from an order result to its projection into the read models in seconds",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300},
+		}),
+		WarehouseRows: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "projector_warehouse_rows_total",
+			Help: "Order result rows written to the data warehouse by sink",
+		}, []string{"sink"}),
+		WarehouseBatches: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "projector_warehouse_batches_total",
+			Help: "Data warehouse insert attempts by sink and result (inserted, failed)",
+		}, []string{"sink", "result"}),
+		WarehouseDelay: promauto.NewHistogram(prometheus.HistogramOpts{
+			Name:    "projector_warehouse_delay_seconds",
+			Help:    "Time from an order result to its insert into the data warehouse in seconds",
+			Buckets: []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 900},
+		}),
+	}
+	metrics.HTTPClients = newHTTPClientMetrics("projector")
+	metrics.Redis = newRedisCommandMetrics("projector")
+	metrics.BuildInfo = newBuildInfoMetric("projector")
+	ProjectorMetricsInstance = metrics
+	return metrics
+}
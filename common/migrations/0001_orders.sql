@@ -0,0 +1,25 @@
+-- Latest result of every order, for support searches (GET /admin/orders)
+-- Every search is ordered by (updated_at, request_id) for keyset pagination, so each index ends
+-- with those columns and a filtered page is a single index range scan:
+--   - item_id + status: "failed orders for item X in the last hour"
+--   - item_id: all orders of an item
+--   - user_id: a customer's orders
+--   - status: e.g. every FAILED order across items
+--   - the primary sort alone: unfiltered time ranges
+-- Each index costs a write per result; add one only for a filter support actually uses
+-- IF NOT EXISTS adopts tables created by releases that ran this DDL inline on startup
+CREATE TABLE IF NOT EXISTS orders (
+    request_id TEXT PRIMARY KEY,
+    user_id    TEXT NOT NULL DEFAULT '',
+    item_id    TEXT NOT NULL DEFAULT '',
+    quantity   BIGINT NOT NULL DEFAULT 0,
+    status     TEXT NOT NULL,
+    reason     TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS orders_item_status_updated ON orders (item_id, status, updated_at, request_id);
+CREATE INDEX IF NOT EXISTS orders_item_updated ON orders (item_id, updated_at, request_id);
+CREATE INDEX IF NOT EXISTS orders_user_updated ON orders (user_id, updated_at, request_id);
+CREATE INDEX IF NOT EXISTS orders_status_updated ON orders (status, updated_at, request_id);
+CREATE INDEX IF NOT EXISTS orders_updated ON orders (updated_at, request_id);
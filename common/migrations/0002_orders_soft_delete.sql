@@ -0,0 +1,4 @@
+-- deleted_at marks orders soft-deleted by the retention job (processor/retention.go): they are
+-- hidden from searches and purged once ORDER_PURGE_GRACE_DAYS have passed
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS orders_deleted ON orders (deleted_at) WHERE deleted_at IS NOT NULL;
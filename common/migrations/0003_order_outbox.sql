@@ -0,0 +1,8 @@
+-- Order result events committed with their orders row (ORDER_STORE_OUTBOX) and deleted once the
+-- relay has published them, in id order
+CREATE TABLE IF NOT EXISTS order_outbox (
+    id         BIGSERIAL PRIMARY KEY,
+    request_id TEXT NOT NULL,
+    payload    JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
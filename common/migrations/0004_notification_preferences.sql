@@ -0,0 +1,8 @@
+-- Users' notification preferences, written by the gateway and read by the notifier
+-- Rows have no expiry: preferences last until the user changes them
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id    TEXT PRIMARY KEY,
+    channels   TEXT[] NOT NULL,
+    opt_out    TEXT[] NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
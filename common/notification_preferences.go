@@ -0,0 +1,98 @@
+package common
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Notification channels users can choose in their preferences
+const (
+	NotificationChannelWebhook = "webhook"
+	NotificationChannelEmail   = "email"
+	NotificationChannelSMS     = "sms" // Opt-in: never used without a stored preference
+)
+
+// NotificationChannels lists the channels accepted in preferences
+var NotificationChannels = []string{NotificationChannelWebhook, NotificationChannelEmail, NotificationChannelSMS}
+
+// NotificationPreferences is a user's choice of notification channels and results
+type NotificationPreferences struct {
+	UserID string `json:"user_id"`
+	// Channels the user wants notifications on; empty opts out of every channel
+	Channels []string `json:"channels"`
+	// OptOut lists result statuses the user doesn't want to hear about (e.g. FAILED_SOLD_OUT)
+	OptOut    []string  `json:"opt_out"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NotificationPreferencesStore keeps users' notification preferences in the order store's
+// Postgres database (ORDER_STORE_DSN), written by the gateway and read by the notifier
+type NotificationPreferencesStore struct {
+	db *sql.DB
+}
+
+// NewNotificationPreferencesStore connects to the order store at dsn, migrating it if needed
+// (notification_preferences table, see common/migrations)
+func NewNotificationPreferencesStore(ctx context.Context, dsn string) (*NotificationPreferencesStore, error) {
+	db, err := OpenOrderStore(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &NotificationPreferencesStore{db: db}, nil
+}
+
+// Close closes the database connection
+func (s *NotificationPreferencesStore) Close() error {
+	return s.db.Close()
+}
+
+// Load reads userID's preferences; nil if none were stored
+func (s *NotificationPreferencesStore) Load(ctx context.Context, userID string) (*NotificationPreferences, error) {
+	preferences := NotificationPreferences{UserID: userID}
+	err := s.db.QueryRowContext(ctx,
+		`SELECT channels, opt_out, updated_at FROM notification_preferences WHERE user_id = $1`, userID,
+	).Scan(pq.Array(&preferences.Channels), pq.Array(&preferences.OptOut), &preferences.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Keep empty lists as [] rather than null; an empty channel list is a deliberate opt-out
+	if preferences.Channels == nil {
+		preferences.Channels = []string{}
+	}
+	if preferences.OptOut == nil {
+		preferences.OptOut = []string{}
+	}
+	preferences.UpdatedAt = preferences.UpdatedAt.UTC()
+	return &preferences, nil
+}
+
+// Save replaces the user's preferences
+func (s *NotificationPreferencesStore) Save(ctx context.Context, preferences NotificationPreferences) error {
+	if preferences.UpdatedAt.IsZero() {
+		preferences.UpdatedAt = time.Now().UTC()
+	}
+	// pq.Array writes nil slices as NULL, which the NOT NULL columns reject
+	channels, optOut := preferences.Channels, preferences.OptOut
+	if channels == nil {
+		channels = []string{}
+	}
+	if optOut == nil {
+		optOut = []string{}
+	}
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO notification_preferences (user_id, channels, opt_out, updated_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id) DO UPDATE SET
+    channels = EXCLUDED.channels,
+    opt_out = EXCLUDED.opt_out,
+    updated_at = EXCLUDED.updated_at`,
+		preferences.UserID, pq.Array(channels), pq.Array(optOut), preferences.UpdatedAt)
+	return err
+}
@@ -0,0 +1,31 @@
+package common
+
+import "time"
+
+// HeaderAmendable marks orders whose client may amend them until the processor claims them
+const HeaderAmendable = "amendable"
+
+// Order amendment actions
+const (
+	AmendmentCancel   = "cancel"
+	AmendmentQuantity = "quantity"
+)
+
+// OrderAmendment is the marker a gateway leaves for a queued order; the processor applies it
+// when it claims the order, instead of acting on the original message
+type OrderAmendment struct {
+	Action    string    `json:"action"`
+	Amount    int64     `json:"amount,omitempty"` // New quantity (AmendmentQuantity only)
+	AmendedAt time.Time `json:"amended_at"`
+}
+
+// OrderAmendmentKey holds the JSON OrderAmendment for requestID
+func OrderAmendmentKey(requestID string) string {
+	return "order_amendment:" + requestID
+}
+
+// OrderClaimKey is set by the processor when it starts acting on requestID; amendments are
+// refused from then on
+func OrderClaimKey(requestID string) string {
+	return "order_claimed:" + requestID
+}
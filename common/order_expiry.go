@@ -0,0 +1,27 @@
+package common
+
+import (
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// HeaderExpiresAt carries the end of an order's sale window (RFC 3339); the processor expires
+// orders it consumes after this instead of reserving stock for a sale that is over
+const HeaderExpiresAt = "expires_at"
+
+// ResultExpired is published for orders consumed too late to be fulfilled fairly
+const ResultExpired = "EXPIRED"
+
+// OrderExpiresAt returns the sale window end carried by headers, or the zero time
+func OrderExpiresAt(headers []*sarama.RecordHeader) time.Time {
+	for _, header := range headers {
+		if string(header.Key) != HeaderExpiresAt {
+			continue
+		}
+		if expiresAt, err := time.Parse(time.RFC3339Nano, string(header.Value)); err == nil {
+			return expiresAt
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,5 @@
+package common
+
+// HeaderItemID carries the order's item_id in clear, so processors can route the order to a
+// worker without decoding (or decrypting) its payload
+const HeaderItemID = "item_id"
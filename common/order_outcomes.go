@@ -0,0 +1,54 @@
+package common
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// OrderOutcome is the outcome label of the orders_total metric
+type OrderOutcome string
+
+// Order outcomes recorded in orders_total
+// The gateway records queued, rejected_rate_limit and duplicate; the processor sold_out, confirmed,
+// expired and dlq
+const (
+	OrderOutcomeQueued            OrderOutcome = "queued"
+	OrderOutcomeRejectedRateLimit OrderOutcome = "rejected_rate_limit"
+	OrderOutcomeDuplicate         OrderOutcome = "duplicate"
+	OrderOutcomeSoldOut           OrderOutcome = "sold_out"
+	OrderOutcomeConfirmed         OrderOutcome = "confirmed"
+	OrderOutcomeDLQ               OrderOutcome = "dlq"
+	OrderOutcomeExpired           OrderOutcome = "expired"
+)
+
+// Item labels used when an order's real item_id isn't exported
+const (
+	ItemLabelOther   = "other"   // Item outside the guard's labeled items (see ItemLabelGuard)
+	ItemLabelUnknown = "unknown" // Order rejected before its body was read
+)
+
+// OrderOutcomes records orders_total{service, outcome, item_id} for one service
+// Both services export the same metric name, so one query covers an order's whole path
+// Every recorded order is an observation for the service's item label guard, and is also
+// counted by campaign in Campaigns
+type OrderOutcomes struct {
+	service   string
+	counter   *prometheus.CounterVec
+	items     *ItemLabelGuard
+	Campaigns *CampaignMetrics
+}
+
+func newOrderOutcomes(service string, items *ItemLabelGuard) *OrderOutcomes {
+	counter := promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "orders_total",
+		Help: "Total number of orders by service, outcome and item (items outside the busiest ones are \"other\")",
+	}, []string{"service", "outcome", "item_id"})
+	items.Guard(counter.MetricVec)
+	return &OrderOutcomes{service: service, counter: counter, items: items, Campaigns: newCampaignMetrics(service)}
+}
+
+// Record counts one order with outcome for itemID of campaign ("" outside campaigns)
+func (o *OrderOutcomes) Record(outcome OrderOutcome, itemID, campaign string) {
+	o.counter.WithLabelValues(o.service, string(outcome), o.items.Observe(itemID)).Inc()
+	o.Campaigns.Record(campaign, outcome)
+}
@@ -0,0 +1,183 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/redis/go-redis/v9"
+)
+
+// Order result statuses published by the processor
+const (
+	ResultReserved      = "RESERVED"        // Inventory reserved for the order
+	ResultFailedSoldOut = "FAILED_SOLD_OUT" // Item unavailable to the order: insufficient inventory, not initialized, reserved for other channels or the buyer's purchase cap reached (Reason)
+	ResultFailedPayment = "FAILED_PAYMENT"  // Reservation released after a payment failure
+	ResultFailed        = "FAILED"          // Order could not be processed and was moved to the DLQ
+	ResultDelivered     = "DELIVERED"       // Digital item code assigned after confirmation (DeliveryCode)
+	ResultCancelled     = "CANCELLED"       // Cancelled by the client while queued (PATCH /order)
+	ResultCompleted     = "COMPLETED"       // Paid and handed to fulfillment or delivered
+	ResultRetrying      = "RETRYING"        // Failed order sent back to the orders topic by a DLQ replay
+)
+
+// OrderResultStatuses lists every result status, for validating status filters
+var OrderResultStatuses = []string{
+	ResultReserved, ResultCompleted, ResultDelivered, ResultFailedSoldOut,
+	ResultFailedPayment, ResultFailed, ResultCancelled, ResultExpired, ResultRetrying,
+}
+
+// Order status values written by the gateway before any result
+const (
+	StatusProcessing = "PROCESSING" // Accepted and queued
+)
+
+// OrderStatusTTL is how long order_status:{request_id} is kept after its last change
+const OrderStatusTTL = 30 * time.Minute
+
+// IsTerminalStatus reports whether no further result follows status
+func IsTerminalStatus(status string) bool {
+	switch status {
+	case ResultCompleted, ResultFailedSoldOut, ResultFailedPayment, ResultFailed, ResultCancelled, ResultExpired:
+		return true
+	}
+	return false
+}
+
+// OrderStatusKey returns the key holding requestID's latest status
+func OrderStatusKey(requestID string) string {
+	return "order_status:" + requestID
+}
+
+// IdempotencyKey returns the key that lets the gateway accept requestID once; later requests get 409
+func IdempotencyKey(requestID string) string {
+	return "idempotency:" + requestID
+}
+
+// IdempotencyTTL is how long IdempotencyKey is kept after the gateway accepts the order
+// Processors extend it when they pick the order up, and claim it again if it expired while queued
+const IdempotencyTTL = 10 * time.Minute
+
+// OrderResultKey returns the key holding requestID's latest result as JSON, kept next to its
+// status (same TTL) so polling clients get the details the events endpoint streams
+func OrderResultKey(requestID string) string {
+	return "order_result:" + requestID
+}
+
+// OrderResultEventType identifies order results among the messages on TopicOrderResults
+const OrderResultEventType = "order_result"
+
+// OrderResult is a processing outcome fanned out to gateways over Redis pub/sub
+// Gateways waiting on a request (e.g. ack=reserved) subscribe to its channel before publishing
+// With ORDER_RESULTS_PUBLISH it is also published to TopicOrderResults for the notifier
+type OrderResult struct {
+	EventType string    `json:"event_type,omitempty"` // OrderResultEventType on TopicOrderResults
+	RequestID string    `json:"request_id"`
+	UserID    string    `json:"user_id,omitempty"` // Buyer; only set on TopicOrderResults
+	ItemID    string    `json:"item_id,omitempty"`
+	Quantity  int64     `json:"quantity,omitempty"` // Ordered quantity; only set on TopicOrderResults
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// DeliveryCode is the code/license assigned to a digital item order (ResultDelivered only)
+	// Only the notifier sets it, after decrypting DeliveryCodeEncrypted; shared and stored copies
+	// of a result never carry it
+	DeliveryCode string `json:"delivery_code,omitempty"`
+	// DeliveryCodeEncrypted is the code encrypted with the payload encryption keys
+	// (PayloadCipher.EncryptValue), carried on TopicOrderResults for the notifier only
+	DeliveryCodeEncrypted string `json:"delivery_code_encrypted,omitempty"`
+
+	// StockRemaining is the item's available stock right after this order was handled
+	// (RESERVED, COMPLETED and FAILED_SOLD_OUT results)
+	StockRemaining *int64 `json:"stock_remaining,omitempty"`
+	// LatencyMs is the time from the gateway accepting the order to this result
+	LatencyMs int64 `json:"latency_ms,omitempty"`
+	// Lines is the outcome of each line of a cart order, in cart order; Quantity is the cart's total
+	Lines []CartLineResult `json:"lines,omitempty"`
+}
+
+// OrderResultChannel returns the pub/sub channel carrying results for requestID
+func OrderResultChannel(requestID string) string {
+	return "order_results:" + requestID
+}
+
+// RecordOrderResult stores result's status and details as the order's latest, then publishes it
+// They are written first so a client reacting to the event reads a status at least as new
+// Neither copy carries the delivery code: GET /order and the event streams are readable by
+// anyone who knows the request_id
+func RecordOrderResult(ctx context.Context, client *redis.Client, result OrderResult) error {
+	if result.Timestamp.IsZero() {
+		result.Timestamp = time.Now().UTC()
+	}
+	result = result.WithoutDeliveryCode()
+	details, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	_, err = client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, OrderStatusKey(result.RequestID), result.Status, OrderStatusTTL)
+		pipe.Set(ctx, OrderResultKey(result.RequestID), details, OrderStatusTTL)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return PublishOrderResult(ctx, client, result)
+}
+
+// LoadOrderResult reads requestID's latest stored result; nil if there is none
+func LoadOrderResult(ctx context.Context, client *redis.Client, requestID string) (*OrderResult, error) {
+	value, err := client.Get(ctx, OrderResultKey(requestID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result OrderResult
+	if err := json.Unmarshal(value, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// PublishOrderResult publishes result, without its delivery code, to its request's channel
+// Pub/sub is fire-and-forget: results published with no subscriber are dropped
+func PublishOrderResult(ctx context.Context, client *redis.Client, result OrderResult) error {
+	if result.Timestamp.IsZero() {
+		result.Timestamp = time.Now().UTC()
+	}
+	result = result.WithoutDeliveryCode()
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return client.Publish(ctx, OrderResultChannel(result.RequestID), payload).Err()
+}
+
+// WithoutDeliveryCode returns result without its delivery code, plain or encrypted
+func (r OrderResult) WithoutDeliveryCode() OrderResult {
+	r.DeliveryCode = ""
+	r.DeliveryCodeEncrypted = ""
+	return r
+}
+
+// NewOrderResultMessage builds the results-topic message, keyed by request_id
+// A plaintext delivery code is dropped; only DeliveryCodeEncrypted goes on the topic
+func NewOrderResultMessage(result OrderResult) (*sarama.ProducerMessage, error) {
+	result.EventType = OrderResultEventType
+	result.DeliveryCode = ""
+	if result.Timestamp.IsZero() {
+		result.Timestamp = time.Now().UTC()
+	}
+	value, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	return &sarama.ProducerMessage{
+		Topic: TopicOrderResults,
+		Key:   sarama.StringEncoder(result.RequestID),
+		Value: sarama.ByteEncoder(value),
+	}, nil
+}
@@ -0,0 +1,36 @@
+package common
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// SLABreachEvent is published to TopicSLABreaches when an order reaches its terminal state
+// later than the SLA target, so downstream consumers can notify affected customers
+type SLABreachEvent struct {
+	RequestID  string    `json:"request_id"`
+	ItemID     string    `json:"item_id,omitempty"`
+	Outcome    string    `json:"outcome"`
+	AcceptedAt time.Time `json:"accepted_at"`
+	ElapsedMs  int64     `json:"elapsed_ms"`
+	TargetMs   int64     `json:"target_ms"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// NewSLABreachMessage builds the breach-topic message, keyed by request_id
+func NewSLABreachMessage(event SLABreachEvent) (*sarama.ProducerMessage, error) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	value, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	return &sarama.ProducerMessage{
+		Topic: TopicSLABreaches,
+		Key:   sarama.StringEncoder(event.RequestID),
+		Value: sarama.ByteEncoder(value),
+	}, nil
+}
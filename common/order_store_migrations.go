@@ -0,0 +1,150 @@
+package common
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	_ "github.com/lib/pq"
+)
+
+// orderStoreMigrations are the order store's schema changes, applied in version order
+// Files are named NNNN_description.sql; add a new file for every change and never edit one that
+// has been released, since databases that applied it won't run it again
+//
+//go:embed migrations/*.sql
+var orderStoreMigrations embed.FS
+
+// orderStoreMigrationLock is the Postgres advisory lock held while migrating, so services
+// starting together apply each migration once
+const orderStoreMigrationLock = 4_210_001
+
+const schemaMigrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    INTEGER PRIMARY KEY,
+    name       TEXT NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// loadOrderStoreMigrations reads the embedded migrations sorted by version
+func loadOrderStoreMigrations() ([]migration, error) {
+	entries, err := orderStoreMigrations.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	migrations := make([]migration, 0, len(entries))
+	seen := make(map[int]string)
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		prefix, _, ok := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s is not named NNNN_description.sql", entry.Name())
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", other, name, version)
+		}
+		seen[version] = name
+		body, err := orderStoreMigrations.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{version: version, name: name, sql: string(body)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// OpenOrderStore connects to the order store at dsn and applies pending migrations
+func OpenOrderStore(ctx context.Context, dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := MigrateOrderStore(ctx, db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate order store: %w", err)
+	}
+	return db, nil
+}
+
+// MigrateOrderStore applies the migrations missing from schema_migrations, each in its own
+// transaction, under an advisory lock
+func MigrateOrderStore(ctx context.Context, db *sql.DB) error {
+	migrations, err := loadOrderStoreMigrations()
+	if err != nil {
+		return err
+	}
+	// Session advisory locks belong to a connection, so hold one for the whole run
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, orderStoreMigrationLock); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, orderStoreMigrationLock)
+
+	if _, err := conn.ExecContext(ctx, schemaMigrationsTable); err != nil {
+		return err
+	}
+	applied := make(map[int]bool)
+	rows, err := conn.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[version] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, m.sql); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%s: %w", m.name, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.version, m.name); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%s: %w", m.name, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("%s: %w", m.name, err)
+		}
+		Logger.WithFields(map[string]interface{}{
+			"event":     "order_store_migrated",
+			"migration": m.name,
+		}).Info("Applied order store migration")
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Order timeline stages, in pipeline order; gateways record the first three, processors the rest
+const (
+	TimelineReceived  = "received"  // /buy request read and validated
+	TimelineAdmitted  = "admitted"  // Admission policies passed
+	TimelineQueued    = "queued"    // Published to Kafka (or the outage buffer)
+	TimelineConsumed  = "consumed"  // Picked up by a processor
+	TimelineReserved  = "reserved"  // Inventory reserved
+	TimelineCharged   = "charged"   // Payment succeeded
+	TimelineConfirmed = "confirmed" // Completed and handed to fulfillment
+	TimelineSettled   = "settled"   // Any other result (failure, expiry, digital delivery); Detail holds the status and reason
+)
+
+// maxTimelineEvents bounds an order's timeline; redeliveries and DLQ replays append again
+const maxTimelineEvents = 50
+
+// TimelineEvent is one stage an order went through
+type TimelineEvent struct {
+	Stage   string    `json:"stage"`
+	At      time.Time `json:"at"`
+	Service string    `json:"service"`
+	Detail  string    `json:"detail,omitempty"`
+}
+
+// OrderTimelineKey returns the list holding requestID's timeline events as JSON, kept as long as
+// its status (OrderStatusTTL after the last event)
+func OrderTimelineKey(requestID string) string {
+	return "order_timeline:" + requestID
+}
+
+// TimelineStageForResult returns the timeline stage of an order result status and its detail
+func TimelineStageForResult(status, reason string) (string, string) {
+	switch status {
+	case ResultReserved:
+		return TimelineReserved, ""
+	case ResultCompleted:
+		return TimelineConfirmed, ""
+	case ResultRetrying:
+		return TimelineQueued, reason
+	}
+	return TimelineSettled, strings.TrimSuffix(status+": "+reason, ": ")
+}
+
+// AppendOrderTimeline adds events to requestID's timeline in one round trip
+func AppendOrderTimeline(ctx context.Context, client *redis.Client, requestID string, events ...TimelineEvent) error {
+	values := make([]interface{}, 0, len(events))
+	for _, event := range events {
+		encoded, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		values = append(values, encoded)
+	}
+	key := OrderTimelineKey(requestID)
+	_, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, key, values...)
+		pipe.LTrim(ctx, key, 0, maxTimelineEvents-1)
+		pipe.Expire(ctx, key, OrderStatusTTL)
+		return nil
+	})
+	return err
+}
+
+// LoadOrderTimeline reads requestID's timeline ordered by time; empty if none was recorded
+// Gateways and processors append independently, so the list order alone isn't chronological
+func LoadOrderTimeline(ctx context.Context, client *redis.Client, requestID string) ([]TimelineEvent, error) {
+	values, err := client.LRange(ctx, OrderTimelineKey(requestID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	events := make([]TimelineEvent, 0, len(values))
+	for _, value := range values {
+		var event TimelineEvent
+		if err := json.Unmarshal([]byte(value), &event); err != nil {
+			continue
+		}
+		events = append(events, event)
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At.Before(events[j].At) })
+	return events, nil
+}
@@ -0,0 +1,247 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/IBM/sarama"
+)
+
+// Headers describing an encrypted payload
+// Values are ASCII so they survive the gateway outage buffer and DLQ copies unchanged
+const (
+	HeaderEncryption      = "enc"        // Payload algorithm (EncryptionAlgorithm)
+	HeaderEncryptionKeyID = "enc_key_id" // ID of the key-encryption key that wrapped the data key
+	HeaderEncryptedDEK    = "enc_dek"    // Base64 wrapped data key: nonce || AES-GCM(kek, dek)
+)
+
+// EncryptionAlgorithm is the only supported payload algorithm
+const EncryptionAlgorithm = "aes-256-gcm"
+
+// Payload decryption errors
+var (
+	ErrUnknownKeyID         = errors.New("unknown encryption key id")
+	ErrUnsupportedAlgorithm = errors.New("unsupported payload encryption algorithm")
+	ErrPayloadNotEncrypted  = errors.New("payload is not encrypted")
+)
+
+// PayloadCipher implements envelope encryption for Kafka payloads
+// Each message gets a fresh 256-bit data key (DEK) that encrypts the payload; the DEK is
+// wrapped with a key-encryption key (KEK) named by a key ID and carried in the headers
+// Only the active KEK encrypts; every configured KEK can decrypt, so keys can be rotated by
+// adding the new key everywhere first and then switching the active key ID
+type PayloadCipher struct {
+	keys        map[string][]byte
+	activeKeyID string
+}
+
+// NewPayloadCipher creates a cipher from base64-encoded 32-byte KEKs keyed by key ID
+func NewPayloadCipher(encodedKeys map[string]string, activeKeyID string) (*PayloadCipher, error) {
+	pc := &PayloadCipher{keys: make(map[string][]byte, len(encodedKeys)), activeKeyID: activeKeyID}
+	for keyID, encoded := range encodedKeys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", keyID, err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %q: must be 32 bytes, got %d", keyID, len(key))
+		}
+		pc.keys[keyID] = key
+	}
+	if _, ok := pc.keys[activeKeyID]; !ok {
+		return nil, fmt.Errorf("active key %q: %w", activeKeyID, ErrUnknownKeyID)
+	}
+	return pc, nil
+}
+
+// LoadPayloadCipher builds a cipher from the environment, or returns nil if encryption is off
+//   - PAYLOAD_ENCRYPTION_KEYS: comma-separated key_id:base64_key pairs
+//   - PAYLOAD_ENCRYPTION_KEYS_FILE: JSON object {"key_id": "base64_key"}, e.g. written by a KMS
+//     or secrets agent; merged with (and overridden by) PAYLOAD_ENCRYPTION_KEYS
+//   - PAYLOAD_ENCRYPTION_KEY_ID: ID of the key used to encrypt (required when keys are set)
+func LoadPayloadCipher() (*PayloadCipher, error) {
+	keys := make(map[string]string)
+	if path := os.Getenv("PAYLOAD_ENCRYPTION_KEYS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &keys); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+	}
+	for _, pair := range strings.Split(os.Getenv("PAYLOAD_ENCRYPTION_KEYS"), ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		keyID, encoded, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid PAYLOAD_ENCRYPTION_KEYS entry %q, expected key_id:base64_key", pair)
+		}
+		keys[keyID] = encoded
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return NewPayloadCipher(keys, os.Getenv("PAYLOAD_ENCRYPTION_KEY_ID"))
+}
+
+// ActiveKeyID returns the ID of the key used for encryption
+func (pc *PayloadCipher) ActiveKeyID() string {
+	return pc.activeKeyID
+}
+
+// EncryptMessage replaces msg's value with its encrypted form and adds the encryption headers
+func (pc *PayloadCipher) EncryptMessage(msg *sarama.ProducerMessage) error {
+	plaintext, err := msg.Value.Encode()
+	if err != nil {
+		return err
+	}
+
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return err
+	}
+	ciphertext, err := seal(dek, plaintext)
+	if err != nil {
+		return err
+	}
+	wrappedDEK, err := seal(pc.keys[pc.activeKeyID], dek)
+	if err != nil {
+		return err
+	}
+
+	msg.Value = sarama.ByteEncoder(ciphertext)
+	msg.Headers = append(msg.Headers,
+		sarama.RecordHeader{Key: []byte(HeaderEncryption), Value: []byte(EncryptionAlgorithm)},
+		sarama.RecordHeader{Key: []byte(HeaderEncryptionKeyID), Value: []byte(pc.activeKeyID)},
+		sarama.RecordHeader{Key: []byte(HeaderEncryptedDEK), Value: []byte(base64.StdEncoding.EncodeToString(wrappedDEK))},
+	)
+	return nil
+}
+
+// DecryptMessage returns the plaintext payload of an encrypted consumer message
+// Returns ErrPayloadNotEncrypted if msg has no encryption headers
+func (pc *PayloadCipher) DecryptMessage(msg *sarama.ConsumerMessage) ([]byte, error) {
+	headers := make(map[string]string, 3)
+	for _, header := range msg.Headers {
+		switch key := string(header.Key); key {
+		case HeaderEncryption, HeaderEncryptionKeyID, HeaderEncryptedDEK:
+			headers[key] = string(header.Value)
+		}
+	}
+	if headers[HeaderEncryption] == "" {
+		return nil, ErrPayloadNotEncrypted
+	}
+	if headers[HeaderEncryption] != EncryptionAlgorithm {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, headers[HeaderEncryption])
+	}
+
+	kek, ok := pc.keys[headers[HeaderEncryptionKeyID]]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKeyID, headers[HeaderEncryptionKeyID])
+	}
+	wrappedDEK, err := base64.StdEncoding.DecodeString(headers[HeaderEncryptedDEK])
+	if err != nil {
+		return nil, fmt.Errorf("decode data key: %w", err)
+	}
+	dek, err := open(kek, wrappedDEK)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	return open(dek, msg.Value)
+}
+
+// EncryptValue envelope-encrypts a value for storage (e.g. PII in Redis)
+// The result is "key_id.base64(wrapped DEK).base64(ciphertext)" so it can be decrypted after rotation
+func (pc *PayloadCipher) EncryptValue(plaintext []byte) (string, error) {
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(dek, plaintext)
+	if err != nil {
+		return "", err
+	}
+	wrappedDEK, err := seal(pc.keys[pc.activeKeyID], dek)
+	if err != nil {
+		return "", err
+	}
+	return pc.activeKeyID + "." + base64.StdEncoding.EncodeToString(wrappedDEK) + "." + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// DecryptValue reverses EncryptValue
+func (pc *PayloadCipher) DecryptValue(value string) ([]byte, error) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed encrypted value")
+	}
+	kek, ok := pc.keys[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKeyID, parts[0])
+	}
+	wrappedDEK, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("decode data key: %w", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("decode ciphertext: %w", err)
+	}
+	dek, err := open(kek, wrappedDEK)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	return open(dek, ciphertext)
+}
+
+// IsEncrypted reports whether headers mark the payload as encrypted
+func IsEncrypted(headers []*sarama.RecordHeader) bool {
+	for _, header := range headers {
+		if string(header.Key) == HeaderEncryption {
+			return true
+		}
+	}
+	return false
+}
+
+// seal encrypts plaintext with AES-GCM under key and returns nonce || ciphertext
+func seal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open reverses seal
+func open(key, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
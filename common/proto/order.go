@@ -0,0 +1,305 @@
+// Package proto encodes order payloads in the protobuf wire format of order.proto
+// The codec is written against protowire rather than generated, so building the services needs
+// no protoc toolchain; any protobuf library decodes what it writes and vice versa
+package proto
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/IBM/sarama"
+	"github.com/yourname/flash-sale-engine/common"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// HeaderContentType carries the order payload encoding; orders without it are JSON
+// It isn't covered by message signatures: a tampered value only makes the order undecodable
+const HeaderContentType = "content_type"
+
+// ContentType is the content_type header value of protobuf order payloads
+const ContentType = "application/x-protobuf"
+
+// IsProtobuf reports whether headers mark the payload as a protobuf Order
+func IsProtobuf(headers []*sarama.RecordHeader) bool {
+	for _, header := range headers {
+		if string(header.Key) == HeaderContentType {
+			return string(header.Value) == ContentType
+		}
+	}
+	return false
+}
+
+// Order field numbers (order.proto)
+const (
+	orderUserID          protowire.Number = 1
+	orderItemID          protowire.Number = 2
+	orderAmount          protowire.Number = 3
+	orderRequestID       protowire.Number = 4
+	orderChannel         protowire.Number = 5
+	orderRecipientUserID protowire.Number = 6
+	orderAddress         protowire.Number = 7
+	orderDeviceID        protowire.Number = 8
+	orderMetadata        protowire.Number = 9
+	orderLines           protowire.Number = 10
+	orderCartPolicy      protowire.Number = 11
+)
+
+// CartLine field numbers (order.proto)
+const (
+	lineItemID protowire.Number = 1
+	lineAmount protowire.Number = 2
+)
+
+// ShippingAddress field numbers (order.proto)
+const (
+	addressName       protowire.Number = 1
+	addressLine1      protowire.Number = 2
+	addressLine2      protowire.Number = 3
+	addressCity       protowire.Number = 4
+	addressRegion     protowire.Number = 5
+	addressPostalCode protowire.Number = 6
+	addressCountry    protowire.Number = 7
+	addressPhone      protowire.Number = 8
+)
+
+// ErrMalformed is returned for payloads that aren't a valid encoding of Order
+var ErrMalformed = errors.New("malformed protobuf order")
+
+// Order is the order message of order.proto
+type Order struct {
+	UserID          string
+	ItemID          string
+	Amount          int64
+	RequestID       string
+	Channel         string
+	RecipientUserID string
+	Address         *common.ShippingAddress
+	DeviceID        string
+	Metadata        map[string]string
+	Lines           []common.CartLine
+	CartPolicy      string
+}
+
+// Marshal encodes o; zero fields are omitted (proto3) and metadata is sorted by key, so equal
+// orders encode to equal bytes
+func (o *Order) Marshal() []byte {
+	var b []byte
+	b = appendString(b, orderUserID, o.UserID)
+	b = appendString(b, orderItemID, o.ItemID)
+	if o.Amount != 0 {
+		b = protowire.AppendTag(b, orderAmount, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(o.Amount))
+	}
+	b = appendString(b, orderRequestID, o.RequestID)
+	b = appendString(b, orderChannel, o.Channel)
+	b = appendString(b, orderRecipientUserID, o.RecipientUserID)
+	if o.Address != nil {
+		b = protowire.AppendTag(b, orderAddress, protowire.BytesType)
+		b = protowire.AppendBytes(b, marshalAddress(o.Address))
+	}
+	b = appendString(b, orderDeviceID, o.DeviceID)
+	keys := make([]string, 0, len(o.Metadata))
+	for key := range o.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		// A map entry is a message with the key as field 1 and the value as field 2
+		entry := appendString(nil, 1, key)
+		entry = appendString(entry, 2, o.Metadata[key])
+		b = protowire.AppendTag(b, orderMetadata, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	for _, line := range o.Lines {
+		b = protowire.AppendTag(b, orderLines, protowire.BytesType)
+		b = protowire.AppendBytes(b, marshalLine(line))
+	}
+	b = appendString(b, orderCartPolicy, o.CartPolicy)
+	return b
+}
+
+// Unmarshal decodes b into o; unknown fields are skipped, so newer producers can add fields
+func (o *Order) Unmarshal(b []byte) error {
+	*o = Order{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case orderUserID:
+			return consumeString(b, typ, &o.UserID)
+		case orderItemID:
+			return consumeString(b, typ, &o.ItemID)
+		case orderAmount:
+			return consumeInt64(b, typ, &o.Amount)
+		case orderRequestID:
+			return consumeString(b, typ, &o.RequestID)
+		case orderChannel:
+			return consumeString(b, typ, &o.Channel)
+		case orderRecipientUserID:
+			return consumeString(b, typ, &o.RecipientUserID)
+		case orderAddress:
+			var raw string
+			n, err := consumeString(b, typ, &raw)
+			if err != nil {
+				return 0, err
+			}
+			// A repeated embedded message merges into the earlier one
+			if o.Address == nil {
+				o.Address = &common.ShippingAddress{}
+			}
+			return n, unmarshalAddress([]byte(raw), o.Address)
+		case orderDeviceID:
+			return consumeString(b, typ, &o.DeviceID)
+		case orderMetadata:
+			var raw string
+			n, err := consumeString(b, typ, &raw)
+			if err != nil {
+				return 0, err
+			}
+			var key, value string
+			err = consumeFields([]byte(raw), func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+				switch num {
+				case 1:
+					return consumeString(b, typ, &key)
+				case 2:
+					return consumeString(b, typ, &value)
+				}
+				return skipField(b, num, typ)
+			})
+			if err != nil {
+				return 0, err
+			}
+			if o.Metadata == nil {
+				o.Metadata = make(map[string]string)
+			}
+			o.Metadata[key] = value
+			return n, nil
+		case orderLines:
+			var raw string
+			n, err := consumeString(b, typ, &raw)
+			if err != nil {
+				return 0, err
+			}
+			var line common.CartLine
+			if err := unmarshalLine([]byte(raw), &line); err != nil {
+				return 0, err
+			}
+			o.Lines = append(o.Lines, line)
+			return n, nil
+		case orderCartPolicy:
+			return consumeString(b, typ, &o.CartPolicy)
+		}
+		return skipField(b, num, typ)
+	})
+}
+
+func marshalLine(line common.CartLine) []byte {
+	b := appendString(nil, lineItemID, line.ItemID)
+	if line.Amount != 0 {
+		b = protowire.AppendTag(b, lineAmount, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(line.Amount))
+	}
+	return b
+}
+
+func unmarshalLine(b []byte, line *common.CartLine) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case lineItemID:
+			return consumeString(b, typ, &line.ItemID)
+		case lineAmount:
+			return consumeInt64(b, typ, &line.Amount)
+		}
+		return skipField(b, num, typ)
+	})
+}
+
+func marshalAddress(address *common.ShippingAddress) []byte {
+	var b []byte
+	b = appendString(b, addressName, address.Name)
+	b = appendString(b, addressLine1, address.Line1)
+	b = appendString(b, addressLine2, address.Line2)
+	b = appendString(b, addressCity, address.City)
+	b = appendString(b, addressRegion, address.Region)
+	b = appendString(b, addressPostalCode, address.PostalCode)
+	b = appendString(b, addressCountry, address.Country)
+	b = appendString(b, addressPhone, address.Phone)
+	return b
+}
+
+func unmarshalAddress(b []byte, address *common.ShippingAddress) error {
+	fields := map[protowire.Number]*string{
+		addressName:       &address.Name,
+		addressLine1:      &address.Line1,
+		addressLine2:      &address.Line2,
+		addressCity:       &address.City,
+		addressRegion:     &address.Region,
+		addressPostalCode: &address.PostalCode,
+		addressCountry:    &address.Country,
+		addressPhone:      &address.Phone,
+	}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if field, ok := fields[num]; ok {
+			return consumeString(b, typ, field)
+		}
+		return skipField(b, num, typ)
+	})
+}
+
+// appendString appends a string field unless it is empty (the proto3 default)
+func appendString(b []byte, num protowire.Number, value string) []byte {
+	if value == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+// consumeFields calls field for every field of the message b with the bytes after its tag;
+// field returns how many of them the value took
+func consumeFields(b []byte, field func(num protowire.Number, typ protowire.Type, b []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("%w: %v", ErrMalformed, protowire.ParseError(n))
+		}
+		b = b[n:]
+		n, err := field(num, typ, b)
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func consumeString(b []byte, typ protowire.Type, value *string) (int, error) {
+	if typ != protowire.BytesType {
+		return 0, fmt.Errorf("%w: expected a length-delimited field", ErrMalformed)
+	}
+	s, n := protowire.ConsumeString(b)
+	if n < 0 {
+		return 0, fmt.Errorf("%w: %v", ErrMalformed, protowire.ParseError(n))
+	}
+	*value = s
+	return n, nil
+}
+
+func consumeInt64(b []byte, typ protowire.Type, value *int64) (int, error) {
+	if typ != protowire.VarintType {
+		return 0, fmt.Errorf("%w: expected a varint field", ErrMalformed)
+	}
+	v, n := protowire.ConsumeVarint(b)
+	if n < 0 {
+		return 0, fmt.Errorf("%w: %v", ErrMalformed, protowire.ParseError(n))
+	}
+	*value = int64(v)
+	return n, nil
+}
+
+func skipField(b []byte, num protowire.Number, typ protowire.Type) (int, error) {
+	n := protowire.ConsumeFieldValue(num, typ, b)
+	if n < 0 {
+		return 0, fmt.Errorf("%w: %v", ErrMalformed, protowire.ParseError(n))
+	}
+	return n, nil
+}
@@ -0,0 +1,210 @@
+package proto
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/yourname/flash-sale-engine/common"
+	"google.golang.org/protobuf/encoding/protowire"
+	protolib "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func fullOrder() *Order {
+	return &Order{
+		UserID:          "user-1",
+		ItemID:          "101",
+		Amount:          3,
+		RequestID:       "req-1",
+		Channel:         "app",
+		RecipientUserID: "user-2",
+		Address: &common.ShippingAddress{
+			Name: "Ada Lovelace", Line1: "1 Main St", Line2: "Flat 2", City: "London",
+			Region: "LDN", PostalCode: "N1 1AA", Country: "GB", Phone: "+441234567890",
+		},
+		DeviceID:   "device-1",
+		Metadata:   map[string]string{"cart_id": "c-9", "campaign": "spring", "empty": ""},
+		Lines:      []common.CartLine{{ItemID: "101", Amount: 3}, {ItemID: "102", Amount: 1}},
+		CartPolicy: common.CartBestEffort,
+	}
+}
+
+// orderDescriptor builds order.proto's Order message for the protobuf library's dynamic messages,
+// so the hand-written codec is checked against the reference implementation
+func orderDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+	str := descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+	field := func(name string, number int32, typ *descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{Name: protolib.String(name), Number: protolib.Int32(number), Label: optional, Type: typ, JsonName: protolib.String(name)}
+	}
+	message := func(name string, number int32, typeName string, label *descriptorpb.FieldDescriptorProto_Label) *descriptorpb.FieldDescriptorProto {
+		f := field(name, number, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum())
+		f.TypeName, f.Label = protolib.String(typeName), label
+		return f
+	}
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    protolib.String("order_test.proto"),
+		Package: protolib.String("flashsale.order.v1"),
+		Syntax:  protolib.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: protolib.String("Order"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("user_id", 1, str), field("item_id", 2, str),
+					field("amount", 3, descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum()),
+					field("request_id", 4, str), field("channel", 5, str), field("recipient_user_id", 6, str),
+					message("address", 7, ".flashsale.order.v1.ShippingAddress", optional),
+					field("device_id", 8, str),
+					message("metadata", 9, ".flashsale.order.v1.Order.MetadataEntry", descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()),
+					message("lines", 10, ".flashsale.order.v1.CartLine", descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()),
+					field("cart_policy", 11, str),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{{
+					Name:    protolib.String("MetadataEntry"),
+					Field:   []*descriptorpb.FieldDescriptorProto{field("key", 1, str), field("value", 2, str)},
+					Options: &descriptorpb.MessageOptions{MapEntry: protolib.Bool(true)},
+				}},
+			},
+			{
+				Name: protolib.String("ShippingAddress"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("name", 1, str), field("line1", 2, str), field("line2", 3, str), field("city", 4, str),
+					field("region", 5, str), field("postal_code", 6, str), field("country", 7, str), field("phone", 8, str),
+				},
+			},
+			{
+				Name:  protolib.String("CartLine"),
+				Field: []*descriptorpb.FieldDescriptorProto{field("item_id", 1, str), field("amount", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum())},
+			},
+		},
+	}
+	fd, err := protodesc.NewFile(file, nil)
+	if err != nil {
+		t.Fatalf("build descriptor: %v", err)
+	}
+	return fd.Messages().ByName("Order")
+}
+
+func TestOrderRoundTrip(t *testing.T) {
+	for name, order := range map[string]*Order{
+		"full":            fullOrder(),
+		"empty":           {},
+		"negative amount": {ItemID: "101", Amount: -1},
+		"empty address":   {ItemID: "101", Address: &common.ShippingAddress{}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var decoded Order
+			if err := decoded.Unmarshal(order.Marshal()); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(&decoded, order) {
+				t.Fatalf("round trip = %+v, want %+v", decoded, *order)
+			}
+		})
+	}
+}
+
+func TestOrderMarshalIsDeterministic(t *testing.T) {
+	first := fullOrder().Marshal()
+	for i := 0; i < 20; i++ {
+		if !bytes.Equal(fullOrder().Marshal(), first) {
+			t.Fatal("equal orders encoded to different bytes")
+		}
+	}
+	if len((&Order{}).Marshal()) != 0 {
+		t.Fatal("zero fields are not omitted")
+	}
+}
+
+func TestOrderMatchesProtobufLibrary(t *testing.T) {
+	descriptor := orderDescriptor(t)
+	order := fullOrder()
+
+	// Written by the codec, read by the library
+	reference := dynamicpb.NewMessage(descriptor)
+	if err := protolib.Unmarshal(order.Marshal(), reference); err != nil {
+		t.Fatalf("library rejected the codec's encoding: %v", err)
+	}
+	fields := descriptor.Fields()
+	if got := reference.Get(fields.ByName("user_id")).String(); got != order.UserID {
+		t.Errorf("user_id = %q", got)
+	}
+	if got := reference.Get(fields.ByName("amount")).Int(); got != order.Amount {
+		t.Errorf("amount = %d", got)
+	}
+	address := reference.Get(fields.ByName("address")).Message()
+	if got := address.Get(address.Descriptor().Fields().ByName("postal_code")).String(); got != order.Address.PostalCode {
+		t.Errorf("address.postal_code = %q", got)
+	}
+	metadata := reference.Get(fields.ByName("metadata")).Map()
+	if metadata.Len() != len(order.Metadata) {
+		t.Errorf("metadata has %d entries, want %d", metadata.Len(), len(order.Metadata))
+	}
+	if got := metadata.Get(protoreflect.ValueOfString("cart_id").MapKey()).String(); got != "c-9" {
+		t.Errorf("metadata[cart_id] = %q", got)
+	}
+	lines := reference.Get(fields.ByName("lines")).List()
+	if lines.Len() != len(order.Lines) {
+		t.Errorf("lines has %d entries, want %d", lines.Len(), len(order.Lines))
+	} else if line := lines.Get(1).Message(); line.Get(line.Descriptor().Fields().ByName("item_id")).String() != "102" {
+		t.Errorf("lines[1] = %v", line)
+	}
+
+	// Written by the library, read by the codec
+	encoded, err := protolib.MarshalOptions{Deterministic: true}.Marshal(reference)
+	if err != nil {
+		t.Fatalf("library Marshal: %v", err)
+	}
+	var decoded Order
+	if err := decoded.Unmarshal(encoded); err != nil {
+		t.Fatalf("codec rejected the library's encoding: %v", err)
+	}
+	// The bytes may differ (the library writes empty map values, the codec omits them), the
+	// decoded order may not
+	if !reflect.DeepEqual(&decoded, order) {
+		t.Fatalf("decoded %+v, want %+v", decoded, *order)
+	}
+}
+
+func TestOrderUnmarshalSkipsUnknownFields(t *testing.T) {
+	b := (&Order{ItemID: "101", Amount: 2}).Marshal()
+	b = protowire.AppendTag(b, 42, protowire.VarintType)
+	b = protowire.AppendVarint(b, 7)
+	b = protowire.AppendTag(b, 43, protowire.BytesType)
+	b = protowire.AppendString(b, "from a newer producer")
+
+	var decoded Order
+	if err := decoded.Unmarshal(b); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if decoded.ItemID != "101" || decoded.Amount != 2 {
+		t.Fatalf("decoded %+v", decoded)
+	}
+}
+
+func TestOrderUnmarshalRejectsMalformed(t *testing.T) {
+	valid := fullOrder().Marshal()
+	wrongType := protowire.AppendTag(nil, orderAmount, protowire.BytesType)
+	wrongType = protowire.AppendString(wrongType, "3")
+	for name, b := range map[string][]byte{
+		"truncated":         valid[:len(valid)-1],
+		"amount not varint": wrongType,
+		"invalid tag":       {0x00},
+		"string not bytes":  protowire.AppendVarint(protowire.AppendTag(nil, orderItemID, protowire.VarintType), 1),
+		"json instead":      []byte(`{"item_id":"101"}`),
+		"overlong length":   append(protowire.AppendTag(nil, orderUserID, protowire.BytesType), 0x7f, 'a'),
+	} {
+		t.Run(name, func(t *testing.T) {
+			var decoded Order
+			if err := decoded.Unmarshal(b); !errors.Is(err, ErrMalformed) {
+				t.Fatalf("Unmarshal error = %v, want ErrMalformed", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// HeaderPurchaseCap carries the units an order counted against the buyer's purchase cap, so the
+// processor can give them back when the order fails
+// Only set by gateways that counted the cap at admission; the processor now counts it when it
+// reserves stock and leaves orders carrying the header to the gateway's count
+const HeaderPurchaseCap = "purchase_cap"
+
+// PurchasedKey counts the units userID bought of itemID within the purchase cap window
+func PurchasedKey(itemID, userID string) string {
+	return "purchased:" + itemID + ":" + userID
+}
+
+// PurchaseCaps are the per-user purchase limits: PerUser units of each item (PURCHASE_CAP_PER_USER),
+// overridden per item by Items (PURCHASE_CAP_ITEMS), within Window (PURCHASE_CAP_WINDOW)
+// Gateways reject orders that would already exceed a cap; processors count the units when they
+// reserve them, in the same script as the stock
+type PurchaseCaps struct {
+	PerUser int64
+	Items   map[string]int64
+	Window  time.Duration
+}
+
+// LoadPurchaseCaps reads the purchase caps from the environment
+func LoadPurchaseCaps() (PurchaseCaps, error) {
+	items, err := ParsePurchaseCaps(os.Getenv("PURCHASE_CAP_ITEMS"))
+	if err != nil {
+		return PurchaseCaps{}, err
+	}
+	return PurchaseCaps{
+		PerUser: int64(envInt("PURCHASE_CAP_PER_USER", 0)),
+		Items:   items,
+		Window:  envDuration("PURCHASE_CAP_WINDOW", 24*time.Hour),
+	}, nil
+}
+
+// For returns the units one user may buy of itemID within the window, 0 when unlimited
+func (c PurchaseCaps) For(itemID string) int64 {
+	if units, ok := c.Items[itemID]; ok {
+		return units
+	}
+	return c.PerUser
+}
+
+// Enabled reports whether any item is capped
+func (c PurchaseCaps) Enabled() bool {
+	if c.PerUser > 0 {
+		return true
+	}
+	for _, units := range c.Items {
+		if units > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePurchaseCaps parses comma-separated item_id:cap pairs (PURCHASE_CAP_ITEMS); a cap of 0
+// makes the item unlimited
+func ParsePurchaseCaps(value string) (map[string]int64, error) {
+	caps := make(map[string]int64)
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		itemID, capValue, ok := strings.Cut(pair, ":")
+		itemID = strings.TrimSpace(itemID)
+		if !ok || itemID == "" {
+			return nil, fmt.Errorf("invalid purchase cap %q, expected item_id:cap", pair)
+		}
+		units, err := strconv.ParseInt(strings.TrimSpace(capValue), 10, 64)
+		if err != nil || units < 0 {
+			return nil, fmt.Errorf("invalid purchase cap %q, cap must be a non-negative integer", pair)
+		}
+		caps[itemID] = units
+	}
+	return caps, nil
+}
+
+// luaReleasePurchaseCapScript decrements a purchase counter without taking it below zero or
+// recreating an expired one
+const luaReleasePurchaseCapScript = `
+local purchased = tonumber(redis.call('GET', KEYS[1]) or '0')
+if purchased <= 0 then
+    return 0
+end
+return redis.call('DECRBY', KEYS[1], math.min(purchased, tonumber(ARGV[1])))
+`
+
+var releasePurchaseCapScript = redis.NewScript(luaReleasePurchaseCapScript)
+
+// ReleasePurchaseCap gives units back to userID's purchase cap for itemID
+func ReleasePurchaseCap(ctx context.Context, client *redis.Client, itemID, userID string, units int64) error {
+	return releasePurchaseCapScript.Run(ctx, client, []string{PurchasedKey(itemID, userID)}, strconv.FormatInt(units, 10)).Err()
+}
@@ -0,0 +1,174 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimitExemptionHeader carries an exemption token on /buy requests
+const RateLimitExemptionHeader = "X-RateLimit-Exemption"
+
+// Redis keys of the exemption registry, shared by the processor (issuing) and gateways (verifying)
+const (
+	rateLimitExemptionsKey = "ratelimit_exemptions" // Hash: exemption ID -> RateLimitExemption JSON
+)
+
+func rateLimitExemptionRevokedKey(id string) string { return "ratelimit_exemption_revoked:" + id }
+
+func rateLimitExemptionUsageKey(id string, window int64) string {
+	return "ratelimit_exemption_usage:" + id + ":" + strconv.FormatInt(window, 10)
+}
+
+// Exemption token errors
+var (
+	ErrExemptionInvalid = errors.New("rate limit exemption token invalid")
+	ErrExemptionExpired = errors.New("rate limit exemption token expired")
+	ErrExemptionRevoked = errors.New("rate limit exemption token revoked")
+)
+
+// RateLimitExemption lets trusted automation (load tests, retail partners) bypass per-user rate
+// limits; the token carries these claims, and the registry keeps them for listing and revocation
+type RateLimitExemption struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Quota     int64  `json:"quota"` // Requests per rate limit window across all users of the token; 0 is unlimited
+	IssuedBy  string `json:"issued_by"`
+	IssuedAt  int64  `json:"issued_at"`  // Unix seconds
+	ExpiresAt int64  `json:"expires_at"` // Unix seconds
+	RevokedAt int64  `json:"revoked_at,omitempty"`
+}
+
+// RateLimitExemptions issues, verifies and revokes exemption tokens
+// Tokens are HMAC-signed with RATE_LIMIT_EXEMPTION_SECRET; revocation is checked in Redis, so a
+// revoked token stops working on every gateway at once
+type RateLimitExemptions struct {
+	secret []byte
+	client *redis.Client
+}
+
+// NewRateLimitExemptions creates the registry; secret must be at least 32 bytes
+func NewRateLimitExemptions(secret string, client *redis.Client) (*RateLimitExemptions, error) {
+	if len(secret) < 32 {
+		return nil, errors.New("rate limit exemption secret must be at least 32 bytes")
+	}
+	return &RateLimitExemptions{secret: []byte(secret), client: client}, nil
+}
+
+// Issue registers a new exemption and returns its token
+func (e *RateLimitExemptions) Issue(ctx context.Context, name string, quota int64, ttl time.Duration, issuedBy string, now time.Time) (string, *RateLimitExemption, error) {
+	exemption := &RateLimitExemption{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Quota:     quota,
+		IssuedBy:  issuedBy,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}
+	payload, _ := json.Marshal(exemption)
+	if err := e.client.HSet(ctx, rateLimitExemptionsKey, exemption.ID, payload).Err(); err != nil {
+		return "", nil, err
+	}
+	return EncodeSignedToken(e.secret, payload), exemption, nil
+}
+
+// Verify checks token's signature, expiry and revocation
+// A Redis error is returned as is, so callers can fall back to regular rate limits
+func (e *RateLimitExemptions) Verify(ctx context.Context, token string, now time.Time) (*RateLimitExemption, error) {
+	payload, err := DecodeSignedToken(e.secret, token)
+	if err != nil {
+		return nil, ErrExemptionInvalid
+	}
+	var exemption RateLimitExemption
+	if err := json.Unmarshal(payload, &exemption); err != nil || exemption.ID == "" {
+		return nil, ErrExemptionInvalid
+	}
+	if now.Unix() > exemption.ExpiresAt {
+		return &exemption, ErrExemptionExpired
+	}
+	revoked, err := e.client.Exists(ctx, rateLimitExemptionRevokedKey(exemption.ID)).Result()
+	if err != nil {
+		return &exemption, err
+	}
+	if revoked > 0 {
+		return &exemption, ErrExemptionRevoked
+	}
+	return &exemption, nil
+}
+
+// Use counts a request against exemption's quota in the window containing now and reports
+// whether it is within the quota
+func (e *RateLimitExemptions) Use(ctx context.Context, exemption *RateLimitExemption, window time.Duration, now time.Time) (bool, int64, error) {
+	start := now.Truncate(window).Unix()
+	key := rateLimitExemptionUsageKey(exemption.ID, start)
+	pipe := e.client.TxPipeline()
+	count := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return true, 0, err
+	}
+	return exemption.Quota == 0 || count.Val() <= exemption.Quota, count.Val(), nil
+}
+
+// Revoke marks id revoked until its expiry; false if no such exemption is registered
+func (e *RateLimitExemptions) Revoke(ctx context.Context, id string, now time.Time) (*RateLimitExemption, bool, error) {
+	raw, err := e.client.HGet(ctx, rateLimitExemptionsKey, id).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var exemption RateLimitExemption
+	if err := json.Unmarshal(raw, &exemption); err != nil {
+		return nil, false, err
+	}
+	if exemption.RevokedAt == 0 {
+		exemption.RevokedAt = now.Unix()
+	}
+	// Expired tokens are rejected anyway; the marker only needs to outlive the token
+	ttl := time.Until(time.Unix(exemption.ExpiresAt, 0)) + time.Minute
+	if ttl < time.Minute {
+		ttl = time.Minute
+	}
+	payload, _ := json.Marshal(exemption)
+	pipe := e.client.TxPipeline()
+	pipe.Set(ctx, rateLimitExemptionRevokedKey(id), exemption.RevokedAt, ttl)
+	pipe.HSet(ctx, rateLimitExemptionsKey, id, payload)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, false, err
+	}
+	return &exemption, true, nil
+}
+
+// List returns the registered exemptions, newest first; expired ones are dropped from the registry
+func (e *RateLimitExemptions) List(ctx context.Context, now time.Time) ([]RateLimitExemption, error) {
+	entries, err := e.client.HGetAll(ctx, rateLimitExemptionsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	exemptions := make([]RateLimitExemption, 0, len(entries))
+	var expired []string
+	for id, raw := range entries {
+		var exemption RateLimitExemption
+		if err := json.Unmarshal([]byte(raw), &exemption); err != nil {
+			continue
+		}
+		if now.Unix() > exemption.ExpiresAt {
+			expired = append(expired, id)
+			continue
+		}
+		exemptions = append(exemptions, exemption)
+	}
+	if len(expired) > 0 {
+		e.client.HDel(ctx, rateLimitExemptionsKey, expired...)
+	}
+	sort.Slice(exemptions, func(i, j int) bool { return exemptions[i].IssuedAt > exemptions[j].IssuedAt })
+	return exemptions, nil
+}
@@ -0,0 +1,68 @@
+package common
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// IsRedisOOM reports whether err is Redis refusing a write because maxmemory is reached
+// Redis replies "OOM command not allowed when used memory > 'maxmemory'" (also from scripts)
+func IsRedisOOM(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "OOM command not allowed")
+}
+
+// RedisDegradation tracks whether Redis is out of memory so callers can shed non-essential
+// writes (order status, metadata, ...) while inventory and idempotency operations continue
+// The degraded state lasts for holdFor after the most recent OOM error; there is no probe,
+// so the first non-essential write after that window tests whether memory has been freed
+type RedisDegradation struct {
+	mu            sync.Mutex
+	holdFor       time.Duration
+	degradedUntil time.Time
+	gauge         prometheus.Gauge
+	logger        *logrus.Logger
+}
+
+// NewRedisDegradation creates a tracker that reports its state (0=normal, 1=degraded) on gauge
+func NewRedisDegradation(holdFor time.Duration, gauge prometheus.Gauge, logger *logrus.Logger) *RedisDegradation {
+	gauge.Set(0)
+	return &RedisDegradation{holdFor: holdFor, gauge: gauge, logger: logger}
+}
+
+// Observe inspects a Redis error and enters (or extends) the degraded state on OOM
+// Returns true if err was an OOM error
+func (d *RedisDegradation) Observe(err error) bool {
+	if !IsRedisOOM(err) {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if time.Now().After(d.degradedUntil) {
+		d.gauge.Set(1)
+		d.logger.WithError(err).WithField("event", "redis_degraded").
+			Error("Redis out of memory, suspending non-essential writes")
+	}
+	d.degradedUntil = time.Now().Add(d.holdFor)
+	return true
+}
+
+// Degraded reports whether non-essential writes should be skipped
+func (d *RedisDegradation) Degraded() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.degradedUntil.IsZero() {
+		return false
+	}
+	if time.Now().After(d.degradedUntil) {
+		d.degradedUntil = time.Time{}
+		d.gauge.Set(0)
+		d.logger.WithField("event", "redis_degradation_cleared").Info("Resuming non-essential Redis writes")
+		return false
+	}
+	return true
+}
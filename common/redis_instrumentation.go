@@ -0,0 +1,164 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultRedisSlowThreshold is how long a command may take before it is logged as slow
+const DefaultRedisSlowThreshold = 50 * time.Millisecond
+
+// Redis command results, the result label of the Redis command metrics
+const (
+	RedisResultOK    = "ok"
+	RedisResultNil   = "nil"   // Key not found (redis.Nil); not an error
+	RedisResultError = "error" // Command failed (server error, timeout, connection)
+)
+
+// redisPipelineCommand labels a pipeline or transaction, timed as one round trip
+const redisPipelineCommand = "pipeline"
+
+// RedisCommandMetrics instruments every Redis command of a service by client (primary,
+// replica) and command name
+type RedisCommandMetrics struct {
+	Duration *prometheus.HistogramVec
+	Slow     *prometheus.CounterVec
+}
+
+func newRedisCommandMetrics(service string) *RedisCommandMetrics {
+	return &RedisCommandMetrics{
+		Duration: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    service + "_redis_command_duration_seconds",
+			Help:    "Redis command duration in seconds by client, command (pipeline for pipelines and transactions) and result (ok, nil, error)",
+			Buckets: []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+		}, []string{"client", "command", "result"}),
+		Slow: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: service + "_redis_slow_commands_total",
+			Help: "Total number of Redis commands slower than REDIS_SLOW_THRESHOLD by client and command",
+		}, []string{"client", "command"}),
+	}
+}
+
+type correlationIDContextKey struct{}
+
+// ContextWithCorrelationID returns ctx carrying correlationID, which Redis slow-command logs
+// (and anything else reading CorrelationIDFromContext) report
+func ContextWithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDContextKey{}, correlationID)
+}
+
+// CorrelationIDFromContext returns the correlation ID set by ContextWithCorrelationID, or ""
+func CorrelationIDFromContext(ctx context.Context) string {
+	correlationID, _ := ctx.Value(correlationIDContextKey{}).(string)
+	return correlationID
+}
+
+// InstrumentRedis records client's commands in metrics under the client label (primary,
+// replica) and logs commands slower than REDIS_SLOW_THRESHOLD (default:
+// DefaultRedisSlowThreshold, 0 disables the log)
+func InstrumentRedis(client *redis.Client, metrics *RedisCommandMetrics, label string, logger *logrus.Logger) {
+	client.AddHook(&redisHook{
+		metrics:       metrics,
+		label:         label,
+		slowThreshold: envDuration("REDIS_SLOW_THRESHOLD", DefaultRedisSlowThreshold),
+		logger:        logger,
+	})
+}
+
+// redisHook implements redis.Hook
+type redisHook struct {
+	metrics       *RedisCommandMetrics
+	label         string
+	slowThreshold time.Duration
+	logger        *logrus.Logger
+}
+
+func (h *redisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h *redisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		h.observe(ctx, cmd.Name(), redisCommandKey(cmd), 1, time.Since(start), err)
+		return err
+	}
+}
+
+func (h *redisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		key := ""
+		for _, cmd := range cmds {
+			if key = redisCommandKey(cmd); key != "" {
+				break
+			}
+		}
+		h.observe(ctx, redisPipelineCommand, key, len(cmds), time.Since(start), err)
+		return err
+	}
+}
+
+func (h *redisHook) observe(ctx context.Context, command, key string, commands int, elapsed time.Duration, err error) {
+	result := RedisResultOK
+	switch {
+	case errors.Is(err, redis.Nil):
+		result = RedisResultNil
+	case err != nil:
+		result = RedisResultError
+	}
+	h.metrics.Duration.WithLabelValues(h.label, command, result).Observe(elapsed.Seconds())
+	if h.slowThreshold <= 0 || elapsed < h.slowThreshold {
+		return
+	}
+	h.metrics.Slow.WithLabelValues(h.label, command).Inc()
+	fields := logrus.Fields{
+		"event":       "redis_slow_command",
+		"client":      h.label,
+		"command":     command,
+		"key":         key,
+		"duration_ms": elapsed.Milliseconds(),
+		"result":      result,
+	}
+	if commands > 1 {
+		fields["commands"] = commands
+	}
+	if correlationID := CorrelationIDFromContext(ctx); correlationID != "" {
+		fields["correlation_id"] = correlationID
+	}
+	entry := h.logger.WithFields(fields)
+	if err != nil && result == RedisResultError {
+		entry = entry.WithError(err)
+	}
+	entry.Warn("Slow Redis command")
+}
+
+// redisCommandKey returns the first key cmd operates on, for slow-command logs; "" for
+// commands without one
+func redisCommandKey(cmd redis.Cmder) string {
+	args := cmd.Args()
+	index := 1
+	switch strings.ToLower(cmd.Name()) {
+	case "eval", "evalsha", "eval_ro", "evalsha_ro", "fcall", "fcall_ro":
+		index = 3 // script, numkeys, first key
+	case "ping", "info", "time", "multi", "exec", "client", "script", "config", "dbsize":
+		return ""
+	}
+	if len(args) <= index {
+		return ""
+	}
+	key, _ := args[index].(string)
+	return key
+}
@@ -0,0 +1,40 @@
+package common
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// RestockEventType identifies restock events among the messages on TopicOrderResults
+const RestockEventType = "restock"
+
+// RestockEvent is published to TopicOrderResults when an operator restocks an item; the projector
+// adds it to the item's sales read model, while the warehouse sink and notifier skip it
+type RestockEvent struct {
+	EventType   string    `json:"event_type"` // Always RestockEventType
+	ItemID      string    `json:"item_id"`
+	Units       int64     `json:"units"`
+	StockBefore int64     `json:"stock_before"`
+	StockAfter  int64     `json:"stock_after"`
+	Actor       string    `json:"actor"` // Admin token subject
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// NewRestockMessage builds the results-topic message, keyed by item_id
+func NewRestockMessage(event RestockEvent) (*sarama.ProducerMessage, error) {
+	event.EventType = RestockEventType
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	value, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	return &sarama.ProducerMessage{
+		Topic: TopicOrderResults,
+		Key:   sarama.StringEncoder(event.ItemID),
+		Value: sarama.ByteEncoder(value),
+	}, nil
+}
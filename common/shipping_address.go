@@ -0,0 +1,15 @@
+package common
+
+// ShippingAddress is the optional delivery address of an order
+// Validated and sanitized by the gateway; carried in the order payload (encrypted in transit
+// when payload encryption is on) and passed to fulfillment events
+type ShippingAddress struct {
+	Name       string `json:"name"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city"`
+	Region     string `json:"region,omitempty"` // State, province or county
+	PostalCode string `json:"postal_code,omitempty"`
+	Country    string `json:"country"` // ISO 3166-1 alpha-2
+	Phone      string `json:"phone,omitempty"`
+}
@@ -0,0 +1,20 @@
+package common
+
+// Synthetic orders exercise the real order path (Kafka, processor, inventory scripts) without
+// touching sale inventory, payments or fulfillment
+
+// HeaderSynthetic flags a synthetic order; its value says what produced it
+const HeaderSynthetic = "synthetic"
+
+// Synthetic order sources
+const (
+	SyntheticSelftest = "selftest" // POST /admin/selftest
+	SyntheticCanary   = "canary"   // Processor canary loop (CANARY_INTERVAL)
+)
+
+// SyntheticItemID is the reserved item synthetic orders reserve against
+// The colon fails gateway item_id validation, so clients can never order it
+const SyntheticItemID = "synthetic:probe"
+
+// SyntheticResultReason is the Reason of the order result published for a processed synthetic order
+const SyntheticResultReason = "SYNTHETIC"
@@ -0,0 +1,37 @@
+package common
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// WaitlistItemsKey is the set of item IDs with a non-empty back-in-stock waitlist
+const WaitlistItemsKey = "waitlist_items"
+
+// WaitlistKey is the sorted set of users waiting for itemID, scored by join time (unix ms)
+func WaitlistKey(itemID string) string {
+	return "waitlist:" + itemID
+}
+
+// WaitlistRestockKey counts units of itemID returned to stock but not yet offered to the waitlist
+func WaitlistRestockKey(itemID string) string {
+	return "waitlist_restock:" + itemID
+}
+
+// luaNotifyRestockScript adds restocked units for the waitlist dispatcher, only while the item
+// has a waitlist, so restocks of items nobody waits for leave no keys behind
+const luaNotifyRestockScript = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+    return 0
+end
+return redis.call('INCRBY', KEYS[2], ARGV[1])
+`
+
+var notifyRestockScript = redis.NewScript(luaNotifyRestockScript)
+
+// NotifyRestock records units of itemID returned to stock (refunds, cancellations, restocks) so
+// gateways offer them to waitlisted users
+func NotifyRestock(ctx context.Context, client *redis.Client, itemID string, units int64) error {
+	return notifyRestockScript.Run(ctx, client, []string{WaitlistKey(itemID), WaitlistRestockKey(itemID)}, units).Err()
+}
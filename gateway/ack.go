@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// Acknowledgment levels requested via the ack query parameter on /buy
+const (
+	AckQueued   = "queued"   // Respond once the order is in Kafka (default)
+	AckReserved = "reserved" // Wait (bounded) for the processor's reservation result
+)
+
+// ackReservedTimeout bounds how long ack=reserved waits for a result (ACK_RESERVED_TIMEOUT)
+// On timeout the response falls back to queued semantics
+var ackReservedTimeout = 5 * time.Second
+
+// parseAckLevel reads the requested acknowledgment level, defaulting to queued
+func parseAckLevel(value string) (string, *ValidationError) {
+	switch value {
+	case "", AckQueued:
+		return AckQueued, nil
+	case AckReserved:
+		return AckReserved, nil
+	}
+	return "", &ValidationError{
+		Field:   "ack",
+		Code:    CodeValueNotAllowed,
+		Message: "ack must be one of: queued, reserved",
+	}
+}
+
+// subscribeOrderResult subscribes to requestID's result channel
+// Must be called before the order is published so a fast result cannot be missed
+func subscribeOrderResult(ctx context.Context, requestID string) (*redis.PubSub, error) {
+	sub := redisClient.Subscribe(ctx, common.OrderResultChannel(requestID))
+	// Wait for the subscription confirmation; until then published results could be lost
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+	return sub, nil
+}
+
+// awaitOrderResult waits up to timeout for the first result on sub
+// Returns nil if no result arrived in time
+func awaitOrderResult(ctx context.Context, sub *redis.PubSub, timeout time.Duration) (*common.OrderResult, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	select {
+	case <-waitCtx.Done():
+		return nil, nil
+	case msg, ok := <-sub.Channel():
+		if !ok {
+			return nil, nil
+		}
+		var result common.OrderResult
+		if err := json.Unmarshal([]byte(msg.Payload), &result); err != nil {
+			return nil, err
+		}
+		return &result, nil
+	}
+}
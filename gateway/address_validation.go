@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// Shipping address length limits (bytes)
+const (
+	maxAddressNameLength   = 100
+	maxAddressLineLength   = 200
+	maxAddressCityLength   = 100
+	maxAddressRegionLength = 100
+	maxPostalCodeLength    = 20
+	maxPhoneLength         = 30
+)
+
+var (
+	countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+	phonePattern       = regexp.MustCompile(`^\+?[0-9 ()-]+$`)
+)
+
+// addressCountryRule holds the country-specific requirements of a shipping address
+type addressCountryRule struct {
+	postalCode     *regexp.Regexp // Required and must match when set
+	regionRequired bool
+}
+
+// addressCountryRules covers the countries shipped to most; other countries only get the
+// generic checks (postal code optional)
+var addressCountryRules = map[string]addressCountryRule{
+	"US": {postalCode: regexp.MustCompile(`^[0-9]{5}(-[0-9]{4})?$`), regionRequired: true},
+	"CA": {postalCode: regexp.MustCompile(`^[A-Z][0-9][A-Z] ?[0-9][A-Z][0-9]$`), regionRequired: true},
+	"AU": {postalCode: regexp.MustCompile(`^[0-9]{4}$`), regionRequired: true},
+	"GB": {postalCode: regexp.MustCompile(`^[A-Z]{1,2}[0-9][A-Z0-9]? ?[0-9][A-Z]{2}$`)},
+	"DE": {postalCode: regexp.MustCompile(`^[0-9]{5}$`)},
+	"FR": {postalCode: regexp.MustCompile(`^[0-9]{5}$`)},
+	"ES": {postalCode: regexp.MustCompile(`^[0-9]{5}$`)},
+	"IT": {postalCode: regexp.MustCompile(`^[0-9]{5}$`)},
+	"NL": {postalCode: regexp.MustCompile(`^[0-9]{4} ?[A-Z]{2}$`)},
+	"JP": {postalCode: regexp.MustCompile(`^[0-9]{3}-?[0-9]{4}$`), regionRequired: true},
+}
+
+// sanitizeAddress normalizes address in place: control characters are removed, whitespace is
+// collapsed and trimmed, and country and postal code are upper-cased
+func sanitizeAddress(address *common.ShippingAddress) {
+	for _, field := range []*string{&address.Name, &address.Line1, &address.Line2, &address.City,
+		&address.Region, &address.PostalCode, &address.Country, &address.Phone} {
+		*field = sanitizeAddressField(*field)
+	}
+	address.Country = strings.ToUpper(address.Country)
+	address.PostalCode = strings.ToUpper(address.PostalCode)
+}
+
+func sanitizeAddressField(value string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return ' '
+		}
+		if unicode.IsControl(r) || r == unicode.ReplacementChar {
+			return -1
+		}
+		return r
+	}, value)
+	return strings.Join(strings.Fields(cleaned), " ")
+}
+
+// validateAddress checks a sanitized address; a nil address is valid (it is optional)
+func validateAddress(address *common.ShippingAddress) []ValidationError {
+	if address == nil {
+		return nil
+	}
+	var errors []ValidationError
+	check := func(field, value string, required bool, maxLength int) {
+		field = "address." + field
+		switch {
+		case value == "" && required:
+			errors = append(errors, ValidationError{Field: field, Code: CodeRequired, Message: field + " is required"})
+		case len(value) > maxLength:
+			errors = append(errors, ValidationError{
+				Field:   field,
+				Code:    CodeTooLong,
+				Message: fmt.Sprintf("%s must be at most %d characters", field, maxLength),
+				Params:  []interface{}{maxLength},
+			})
+		}
+	}
+
+	rule := addressCountryRules[address.Country]
+	check("name", address.Name, true, maxAddressNameLength)
+	check("line1", address.Line1, true, maxAddressLineLength)
+	check("line2", address.Line2, false, maxAddressLineLength)
+	check("city", address.City, true, maxAddressCityLength)
+	check("region", address.Region, rule.regionRequired, maxAddressRegionLength)
+	check("postal_code", address.PostalCode, rule.postalCode != nil, maxPostalCodeLength)
+	check("phone", address.Phone, false, maxPhoneLength)
+
+	if address.Country == "" {
+		errors = append(errors, ValidationError{Field: "address.country", Code: CodeRequired, Message: "address.country is required"})
+	} else if !countryCodePattern.MatchString(address.Country) {
+		errors = append(errors, ValidationError{
+			Field:   "address.country",
+			Code:    CodeInvalidCountry,
+			Message: "address.country must be an ISO 3166-1 alpha-2 code",
+		})
+	}
+	if rule.postalCode != nil && address.PostalCode != "" && !rule.postalCode.MatchString(address.PostalCode) {
+		errors = append(errors, ValidationError{
+			Field:   "address.postal_code",
+			Code:    CodeInvalidPostal,
+			Message: fmt.Sprintf("address.postal_code is not a valid postal code for %s", address.Country),
+			Params:  []interface{}{address.Country},
+		})
+	}
+	if address.Phone != "" && !phonePattern.MatchString(address.Phone) {
+		errors = append(errors, ValidationError{
+			Field:   "address.phone",
+			Code:    CodeInvalidPhone,
+			Message: "address.phone may only contain digits, spaces, parentheses, hyphens and a leading +",
+		})
+	}
+	return errors
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// AdmissionDebugHeader carries an operator admin token on /buy; the response then includes
+// every admission policy's decision (admission_decisions)
+const AdmissionDebugHeader = "X-Admission-Debug"
+
+// admissionDebugAllowed reports whether r carries a valid operator token in X-Admission-Debug
+// An invalid token only drops the debug output, the order itself goes on
+func admissionDebugAllowed(r *http.Request, logEntry *logrus.Entry) bool {
+	token := strings.TrimSpace(r.Header.Get(AdmissionDebugHeader))
+	if token == "" || adminAuth == nil {
+		return false
+	}
+	claims, err := adminAuth.Verify(token, time.Now())
+	if err != nil || !claims.Allows(common.RoleOperator) {
+		logEntry.WithError(err).WithField("event", "admission_debug_denied").Warn("Admission debug token rejected, decisions not returned")
+		return false
+	}
+	logEntry.WithFields(map[string]interface{}{
+		"event": "admission_debug",
+		"actor": claims.Subject,
+	}).Info("Admission decisions returned for debugging")
+	return true
+}
+
+// AdmissionEvaluation is the body of POST /admin/admission/evaluate: a hypothetical order and
+// the request attributes the policies look at
+type AdmissionEvaluation struct {
+	Order         OrderRequest `json:"order"`
+	ClientIP      string       `json:"client_ip"`
+	UserAgent     string       `json:"user_agent"`
+	PurchaseToken string       `json:"purchase_token"`
+}
+
+// handleAdminEvaluateAdmission runs a hypothetical order through the current admission policies
+// as a dry run: nothing is counted, reserved or queued, and every enabled policy is evaluated
+// even after a rejection; rejection is what /buy would have answered
+func handleAdminEvaluateAdmission(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var evaluation AdmissionEvaluation
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&evaluation); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid body: " + err.Error()})
+		return
+	}
+	order := evaluation.Order
+	if order.RequestID == "" {
+		order.RequestID = "admission-evaluate"
+	}
+	if order.Channel == "" {
+		order.Channel = common.DefaultChannel
+	}
+	if validationErrors := ValidateOrderRequest(&order); len(validationErrors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": "invalid order", "errors": validationErrors})
+		return
+	}
+
+	// Policies read the purchase token and user agent from the request, so build one
+	hypothetical := &http.Request{Header: http.Header{}}
+	hypothetical.Header.Set(PurchaseTokenHeader, evaluation.PurchaseToken)
+	hypothetical.Header.Set("User-Agent", evaluation.UserAgent)
+	actor := ""
+	if claims := common.AdminClaimsFromContext(r.Context()); claims != nil {
+		actor = claims.Subject
+	}
+	logEntry := logger.WithFields(map[string]interface{}{
+		"dry_run": true,
+		"actor":   actor,
+		"user_id": order.UserID,
+		"item_id": order.ItemID,
+	})
+	admission := &AdmissionRequest{
+		Order:    &order,
+		HTTP:     hypothetical,
+		ClientIP: evaluation.ClientIP,
+		Log:      logEntry,
+		DryRun:   true,
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), buyRequestTimeout)
+	defer cancel()
+	rejection := admissionChain.Admit(ctx, admission)
+	logEntry.WithFields(map[string]interface{}{
+		"event":    "admission_evaluated",
+		"admitted": rejection == nil,
+	}).Info("Admission dry run evaluated")
+
+	response := map[string]interface{}{
+		"admitted":  rejection == nil,
+		"policies":  admissionChain.Names(),
+		"decisions": admission.Decisions,
+	}
+	if rejection != nil {
+		response["rejection"] = map[string]interface{}{
+			"status":  rejection.Status,
+			"code":    rejection.Code,
+			"details": rejection.Details,
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
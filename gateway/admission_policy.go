@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultAdmissionPolicies is the ADMISSION_POLICIES order when unset
+const defaultAdmissionPolicies = "purchase_token,geo,risk,purchase_admission,item_rate"
+
+// denylistKey is the Redis set of user IDs whose orders the denylist policy rejects
+const denylistKey = "admission:denylist"
+
+// AdmissionRequest is a validated order going through the admission policies
+// Policies may enrich it for the policies after them and for the order log
+type AdmissionRequest struct {
+	Order    *OrderRequest
+	HTTP     *http.Request
+	ClientIP string
+	Country  string        // Set by the geo policy
+	Log      *logrus.Entry // Order log; fields added here end up on every later line
+
+	// DryRun evaluates every enabled policy without side effects or metrics (POST /admin/admission/evaluate)
+	DryRun bool
+	// Decisions records each policy's outcome in evaluation order, for admission debugging
+	Decisions []AdmissionDecision
+
+	undo []func(ctx context.Context)
+}
+
+// AdmissionDecision is one policy's outcome for an order
+type AdmissionDecision struct {
+	Policy     string                 `json:"policy"`
+	Result     string                 `json:"result"` // admitted, rejected or disabled
+	Code       string                 `json:"code,omitempty"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	DurationMs float64                `json:"duration_ms"`
+	CartLine   int                    `json:"cart_line,omitempty"` // Line of a cart order the decision is for; 0 is the order's item
+}
+
+// count increments counter unless the request is a dry run
+func (req *AdmissionRequest) count(counter prometheus.Counter) {
+	if !req.DryRun {
+		counter.Inc()
+	}
+}
+
+// OnRollback registers fn to undo a policy's side effect (such as a counted admission slot) when
+// the order is rejected by a later policy or isn't queued
+func (req *AdmissionRequest) OnRollback(fn func(ctx context.Context)) {
+	req.undo = append(req.undo, fn)
+}
+
+// Rollback undoes the side effects of the policies that admitted the order, latest first
+func (req *AdmissionRequest) Rollback(ctx context.Context) {
+	for i := len(req.undo) - 1; i >= 0; i-- {
+		req.undo[i](ctx)
+	}
+	req.undo = nil
+}
+
+// AdmissionRejection is the response of a policy that refused the order
+type AdmissionRejection struct {
+	Status     int
+	Code       string
+	Details    map[string]interface{}
+	RetryAfter time.Duration // Sent as Retry-After when set
+}
+
+// AdmissionPolicy is one admission control of /buy
+// Policies run in ADMISSION_POLICIES order after the order is validated; the first rejection
+// ends the chain. New controls register a policy instead of editing handleBuy
+type AdmissionPolicy interface {
+	Name() string
+	// Enabled reports whether the policy is configured; disabled policies are skipped
+	Enabled() bool
+	// Admit returns nil to admit the order; policies log and count their own decisions
+	Admit(ctx context.Context, req *AdmissionRequest) *AdmissionRejection
+}
+
+var (
+	admissionPoliciesMu sync.RWMutex
+	admissionPolicies   = make(map[string]AdmissionPolicy)
+)
+
+// RegisterAdmissionPolicy makes policy available to ADMISSION_POLICIES under its name
+func RegisterAdmissionPolicy(policy AdmissionPolicy) {
+	admissionPoliciesMu.Lock()
+	defer admissionPoliciesMu.Unlock()
+	admissionPolicies[policy.Name()] = policy
+}
+
+func init() {
+	RegisterAdmissionPolicy(purchaseTokenPolicy{})
+	RegisterAdmissionPolicy(geoPolicy{})
+	RegisterAdmissionPolicy(riskPolicy{})
+	RegisterAdmissionPolicy(purchaseAdmissionPolicy{})
+	RegisterAdmissionPolicy(denylistPolicy{})
+	RegisterAdmissionPolicy(itemRatePolicy{})
+}
+
+// AdmissionChain runs policies in order
+type AdmissionChain []AdmissionPolicy
+
+// admissionChain is set from ADMISSION_POLICIES at startup
+var admissionChain AdmissionChain
+
+// ParseAdmissionPolicies resolves comma-separated policy names into a chain; policies left out
+// are disabled
+func ParseAdmissionPolicies(value string) (AdmissionChain, error) {
+	admissionPoliciesMu.RLock()
+	defer admissionPoliciesMu.RUnlock()
+	var chain AdmissionChain
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		policy, ok := admissionPolicies[name]
+		if !ok {
+			registered := make([]string, 0, len(admissionPolicies))
+			for registeredName := range admissionPolicies {
+				registered = append(registered, registeredName)
+			}
+			sort.Strings(registered)
+			return nil, fmt.Errorf("unknown admission policy %q (registered: %s)", name, strings.Join(registered, ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("admission policy %q listed twice", name)
+		}
+		seen[name] = true
+		chain = append(chain, policy)
+	}
+	return chain, nil
+}
+
+// Names returns the policy names in evaluation order
+func (c AdmissionChain) Names() []string {
+	names := make([]string, len(c))
+	for i, policy := range c {
+		names[i] = policy.Name()
+	}
+	return names
+}
+
+// Admit runs the enabled policies until one rejects the order; on rejection the side effects of
+// the policies before it are rolled back
+// Dry runs go on after a rejection so every policy's outcome is reported; the first rejection
+// is still the one returned
+func (c AdmissionChain) Admit(ctx context.Context, req *AdmissionRequest) *AdmissionRejection {
+	var first *AdmissionRejection
+	for _, policy := range c {
+		if !policy.Enabled() {
+			req.Decisions = append(req.Decisions, AdmissionDecision{Policy: policy.Name(), Result: "disabled"})
+			continue
+		}
+		start := time.Now()
+		rejection := policy.Admit(ctx, req)
+		elapsed := time.Since(start)
+		decision := AdmissionDecision{Policy: policy.Name(), Result: "admitted", DurationMs: float64(elapsed.Microseconds()) / 1000}
+		if rejection != nil {
+			decision.Result, decision.Code, decision.Details = "rejected", rejection.Code, rejection.Details
+		}
+		req.Decisions = append(req.Decisions, decision)
+		if req.DryRun {
+			if first == nil {
+				first = rejection
+			}
+			continue
+		}
+		metrics.AdmissionPolicyDuration.WithLabelValues(policy.Name()).Observe(elapsed.Seconds())
+		metrics.AdmissionPolicyDecisions.WithLabelValues(policy.Name(), decision.Result).Inc()
+		if rejection != nil {
+			rollbackCtx, cancel := rollbackContext(ctx)
+			req.Rollback(rollbackCtx)
+			cancel()
+			return rejection
+		}
+	}
+	return first
+}
+
+// purchaseTokenPolicy requires orders to come through /session for the same user and item
+type purchaseTokenPolicy struct{}
+
+func (purchaseTokenPolicy) Name() string  { return "purchase_token" }
+func (purchaseTokenPolicy) Enabled() bool { return purchaseTokens != nil }
+
+func (purchaseTokenPolicy) Admit(ctx context.Context, req *AdmissionRequest) *AdmissionRejection {
+	claims, err := purchaseTokens.Verify(req.HTTP.Header.Get(PurchaseTokenHeader), req.Order.UserID, req.Order.ItemID, time.Now())
+	result := purchaseTokenResult(err)
+	req.count(metrics.PurchaseTokens.WithLabelValues(result))
+	if err == nil {
+		req.Log = req.Log.WithField("session_id", claims.SessionID)
+		return nil
+	}
+	if !purchaseTokenRequired && result == "missing" {
+		return nil
+	}
+	req.count(metrics.OrdersFailed)
+	req.Log.WithError(err).WithField("event", "purchase_token_rejected").Warn("Purchase token rejected")
+	return &AdmissionRejection{Status: http.StatusForbidden, Code: ErrCodePurchaseToken, Details: map[string]interface{}{
+		"reason": result,
+	}}
+}
+
+// geoPolicy applies campaign country restrictions; every decision under a rule is logged
+type geoPolicy struct{}
+
+func (geoPolicy) Name() string  { return "geo" }
+func (geoPolicy) Enabled() bool { return geoAdmission != nil }
+
+func (geoPolicy) Admit(ctx context.Context, req *AdmissionRequest) *AdmissionRejection {
+	decision := geoAdmission.Evaluate(req.ClientIP, req.Order.ItemID, req.Order.Amount)
+	if decision.Campaign == "" {
+		return nil
+	}
+	geoEntry := req.Log.WithFields(map[string]interface{}{
+		"campaign": decision.Campaign,
+		"country":  decision.Country,
+	})
+	if !decision.Allowed {
+		req.count(metrics.GeoAdmission.WithLabelValues(decision.Reason))
+		req.count(metrics.OrdersFailed)
+		geoEntry.WithFields(map[string]interface{}{
+			"event":  "geo_admission_denied",
+			"reason": decision.Reason,
+		}).Warn("Geo admission denied")
+		if decision.Reason == GeoReasonAmountExceeded {
+			return &AdmissionRejection{Status: http.StatusForbidden, Code: ErrCodeRegionLimit, Details: map[string]interface{}{
+				"max_amount": decision.MaxAmount,
+			}}
+		}
+		return &AdmissionRejection{Status: http.StatusForbidden, Code: ErrCodeRegionNotAllowed}
+	}
+	req.count(metrics.GeoAdmission.WithLabelValues("allowed"))
+	geoEntry.WithField("event", "geo_admission_allowed").Info("Geo admission allowed")
+	req.Country = decision.Country
+	req.Log = req.Log.WithField("country", decision.Country)
+	return nil
+}
+
+// riskPolicy lets registered scorers (bot-mitigation vendors) reject the order
+// It sees the country only when it runs after the geo policy
+type riskPolicy struct{}
+
+func (riskPolicy) Name() string  { return "risk" }
+func (riskPolicy) Enabled() bool { return riskScorerCount() > 0 }
+
+func (riskPolicy) Admit(ctx context.Context, req *AdmissionRequest) *AdmissionRejection {
+	order := req.Order
+	verdict := scoreOrder(ctx, RiskSignals{
+		UserID:          order.UserID,
+		RecipientUserID: order.RecipientUserID,
+		ItemID:          order.ItemID,
+		Amount:          order.Amount,
+		Channel:         order.Channel,
+		ClientIP:        req.ClientIP,
+		Country:         req.Country,
+		UserAgent:       req.HTTP.UserAgent(),
+		DeviceID:        order.DeviceID,
+	})
+	for scorer, err := range verdict.Errors {
+		req.count(metrics.RiskDecisions.WithLabelValues("error"))
+		req.Log.WithError(err).WithField("scorer", scorer).Warn("Risk scorer failed, ignoring its score")
+	}
+	riskEntry := req.Log.WithFields(map[string]interface{}{
+		"risk_score":  verdict.Score,
+		"risk_scorer": verdict.Scorer,
+		"risk_reason": verdict.Reason,
+	})
+	if verdict.Scorer != "" && verdict.Score >= riskBlockThreshold {
+		req.count(metrics.RiskDecisions.WithLabelValues("blocked"))
+		req.count(metrics.OrdersFailed)
+		riskEntry.WithField("event", "risk_blocked").Warn("Order rejected by risk scoring")
+		return &AdmissionRejection{Status: http.StatusForbidden, Code: ErrCodeRiskRejected}
+	}
+	req.count(metrics.RiskDecisions.WithLabelValues("allowed"))
+	req.Log = riskEntry
+	return nil
+}
+
+// purchaseAdmissionPolicy checks registration and turns away orders over the purchase cap; the
+// buyer (user_id) is capped, also on gift orders. Fails closed, since registration can't be
+// checked without Redis. The processor counts the units when it reserves them
+type purchaseAdmissionPolicy struct{}
+
+func (purchaseAdmissionPolicy) Name() string  { return "purchase_admission" }
+func (purchaseAdmissionPolicy) Enabled() bool { return purchaseAdmission.Enabled() }
+
+func (purchaseAdmissionPolicy) Admit(ctx context.Context, req *AdmissionRequest) *AdmissionRejection {
+	order := req.Order
+	admission, purchased, err := purchaseAdmission.Check(ctx, order.UserID, order.ItemID, order.Amount)
+	if err != nil {
+		req.count(metrics.PurchaseAdmission.WithLabelValues("error"))
+		if !budgetExceeded(ctx, BudgetStageAdmission, err) {
+			redisHealth.Observe(err)
+		}
+		req.Log.WithError(err).Error("Purchase admission check failed")
+		return &AdmissionRejection{Status: http.StatusServiceUnavailable, Code: ErrCodeServiceUnavailable}
+	}
+	switch admission {
+	case AdmissionNotRegistered:
+		req.count(metrics.PurchaseAdmission.WithLabelValues("not_registered"))
+		req.count(metrics.OrdersFailed)
+		req.Log.WithField("event", "order_not_registered").Warn("User not registered for campaign")
+		return &AdmissionRejection{Status: http.StatusForbidden, Code: ErrCodeNotRegistered}
+	case AdmissionCapExceeded:
+		req.count(metrics.PurchaseAdmission.WithLabelValues("cap_exceeded"))
+		req.count(metrics.OrdersFailed)
+		req.Log.WithFields(map[string]interface{}{
+			"event":     "purchase_cap_exceeded",
+			"purchased": purchased,
+		}).Warn("Purchase cap exceeded")
+		return &AdmissionRejection{Status: http.StatusForbidden, Code: ErrCodePurchaseCap, Details: map[string]interface{}{
+			"limit":     purchaseAdmission.CapFor(order.ItemID),
+			"purchased": purchased,
+		}}
+	}
+	req.count(metrics.PurchaseAdmission.WithLabelValues("admitted"))
+	return nil
+}
+
+// denylistPolicy rejects orders from users in the Redis set admission:denylist
+// Manage it with redis-cli SADD/SREM on the primary; it is read from a replica when one is healthy
+// Fails open on Redis errors, like the rate limiter
+type denylistPolicy struct{}
+
+func (denylistPolicy) Name() string  { return "denylist" }
+func (denylistPolicy) Enabled() bool { return true }
+
+func (denylistPolicy) Admit(ctx context.Context, req *AdmissionRequest) *AdmissionRejection {
+	denied, err := redisRouter.ReadClient().SIsMember(ctx, denylistKey, req.Order.UserID).Result()
+	if err != nil {
+		if !budgetExceeded(ctx, BudgetStageAdmission, err) {
+			redisHealth.Observe(err)
+		}
+		req.Log.WithError(err).Warn("Denylist check failed, allowing request")
+		return nil
+	}
+	if !denied {
+		return nil
+	}
+	req.count(metrics.OrdersFailed)
+	req.Log.WithField("event", "order_denylisted").Warn("Order rejected, user is denylisted")
+	return &AdmissionRejection{Status: http.StatusForbidden, Code: ErrCodeRiskRejected}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// Kafka producer modes (KAFKA_PRODUCER_MODE)
+const (
+	ProducerModeSync  = "sync"  // One produce request per order (default)
+	ProducerModeAsync = "async" // Orders from concurrent requests share batched produce requests
+)
+
+// messageSender is the part of a Kafka producer the circuit breaker sends orders through
+type messageSender interface {
+	SendMessage(msg *sarama.ProducerMessage) (partition int32, offset int64, err error)
+	Close() error
+}
+
+// batchingProducer sends through a sarama.AsyncProducer so orders of concurrent /buy requests
+// are batched (and compressed together) into shared produce requests, while each caller still
+// waits for its own order's ack: the circuit breaker, rollbacks and the outage buffer work as
+// with the sync producer
+// Successes() and Errors() are drained by one goroutine that hands every outcome back to its
+// sender; a failed order is then rolled back by its request like a failed sync send
+type batchingProducer struct {
+	producer sarama.AsyncProducer
+	mu       sync.RWMutex // Held for reading while sending, so Close never races an Input
+	closed   bool
+	done     chan struct{}
+}
+
+// configureProducerBatching applies the batching settings of KAFKA_PRODUCER_MODE=async to config:
+//   - KAFKA_BATCH_LINGER: how long a batch waits to fill before it is sent (default: 5ms)
+//   - KAFKA_BATCH_MAX_MESSAGES: orders that trigger a send before the linger ends (default: 500)
+//   - KAFKA_BATCH_MAX_BYTES: batch size that triggers a send (default: 1MB)
+func configureProducerBatching(config *sarama.Config) {
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	config.Producer.Flush.Frequency = getEnvDuration("KAFKA_BATCH_LINGER", 5*time.Millisecond)
+	config.Producer.Flush.Messages = getEnvInt("KAFKA_BATCH_MAX_MESSAGES", 500)
+	config.Producer.Flush.Bytes = getEnvInt("KAFKA_BATCH_MAX_BYTES", 1000000)
+}
+
+// producerCompression returns the codec for KAFKA_COMPRESSION (none|gzip|snappy|lz4|zstd, default: none)
+func producerCompression() (sarama.CompressionCodec, error) {
+	value := os.Getenv("KAFKA_COMPRESSION")
+	if value == "" {
+		return sarama.CompressionNone, nil
+	}
+	var codec sarama.CompressionCodec
+	if err := codec.UnmarshalText([]byte(value)); err != nil {
+		return sarama.CompressionNone, fmt.Errorf("invalid KAFKA_COMPRESSION %q (none|gzip|snappy|lz4|zstd)", value)
+	}
+	return codec, nil
+}
+
+// newBatchingProducer starts an async producer on client; configureProducerBatching must have
+// been applied to the client's config
+func newBatchingProducer(client sarama.Client) (*batchingProducer, error) {
+	producer, err := sarama.NewAsyncProducerFromClient(client)
+	if err != nil {
+		return nil, err
+	}
+	bp := &batchingProducer{producer: producer, done: make(chan struct{})}
+	go bp.dispatch()
+	return bp, nil
+}
+
+// sendOutcome is delivered to a waiting sender through its message's Metadata
+type sendOutcome struct {
+	partition int32
+	offset    int64
+	err       error
+}
+
+// dispatch hands every ack and error back to the sender waiting on it until both channels close
+func (bp *batchingProducer) dispatch() {
+	defer close(bp.done)
+	successes, errs := bp.producer.Successes(), bp.producer.Errors()
+	for successes != nil || errs != nil {
+		select {
+		case msg, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
+			}
+			deliverOutcome(msg, sendOutcome{partition: msg.Partition, offset: msg.Offset})
+		case producerErr, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			metrics.KafkaAsyncErrors.Inc()
+			deliverOutcome(producerErr.Msg, sendOutcome{err: producerErr.Err})
+		}
+	}
+}
+
+func deliverOutcome(msg *sarama.ProducerMessage, outcome sendOutcome) {
+	if waiter, ok := msg.Metadata.(chan sendOutcome); ok {
+		waiter <- outcome
+	}
+}
+
+// SendMessage queues msg for the next batch and waits for its outcome
+// The producer's own timeouts (KAFKA_SEND_TIMEOUT as the broker ack timeout, retries) bound the wait
+func (bp *batchingProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	waiter := make(chan sendOutcome, 1)
+	msg.Metadata = waiter
+	bp.mu.RLock()
+	if bp.closed {
+		bp.mu.RUnlock()
+		return 0, 0, sarama.ErrClosedClient
+	}
+	bp.producer.Input() <- msg
+	bp.mu.RUnlock()
+	outcome := <-waiter
+	return outcome.partition, outcome.offset, outcome.err
+}
+
+// Close flushes buffered orders, delivers their outcomes and stops the producer
+func (bp *batchingProducer) Close() error {
+	bp.mu.Lock()
+	bp.closed = true
+	bp.mu.Unlock()
+	bp.producer.AsyncClose()
+	<-bp.done
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// saleEndGrace is how long after its campaign ends a campaign order may still be processed
+// (ORDER_SALE_END_GRACE); later orders expire instead of reserving stock
+var saleEndGrace = 5 * time.Minute
+
+// CampaignRouter sends orders for items of an active campaign to the campaign's own topic
+// Campaigns are registered through the processor admin API and read from Redis on an interval,
+// so a newly created campaign takes effect on every gateway within one refresh
+type CampaignRouter struct {
+	redisClient *redis.Client
+
+	mu        sync.RWMutex
+	campaigns map[string]common.CampaignTopic // item_id -> campaign
+}
+
+// NewCampaignRouter creates a router with no campaigns; call Refresh or Run to load them
+func NewCampaignRouter(redisClient *redis.Client) *CampaignRouter {
+	return &CampaignRouter{redisClient: redisClient, campaigns: make(map[string]common.CampaignTopic)}
+}
+
+// Route returns the topic for an order of itemID and the end of its sale window: its campaign's
+// topic and end while the campaign is active, otherwise the shared orders topic and the zero time
+func (cr *CampaignRouter) Route(itemID string) (string, time.Time) {
+	cr.mu.RLock()
+	campaign, ok := cr.campaigns[itemID]
+	cr.mu.RUnlock()
+	if ok && campaign.Active(time.Now()) {
+		return campaign.Topic, campaign.EndsAt
+	}
+	return common.TopicOrders, time.Time{}
+}
+
+// Campaign returns the name of itemID's active campaign, or "" when it has none
+func (cr *CampaignRouter) Campaign(itemID string) string {
+	cr.mu.RLock()
+	campaign, ok := cr.campaigns[itemID]
+	cr.mu.RUnlock()
+	if ok && campaign.Active(time.Now()) {
+		return campaign.Name
+	}
+	return ""
+}
+
+// orderCampaign returns the campaign label source of an order for itemID: its active campaign,
+// or "" without campaign routing
+func orderCampaign(itemID string) string {
+	if campaignRouter == nil {
+		return ""
+	}
+	return campaignRouter.Campaign(itemID)
+}
+
+// Refresh reloads campaigns from Redis; on error the previous routes stay in place
+func (cr *CampaignRouter) Refresh(ctx context.Context) error {
+	campaigns, err := common.LoadCampaignTopics(ctx, cr.redisClient)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	byItem := make(map[string]common.CampaignTopic)
+	for _, campaign := range campaigns {
+		if !campaign.Active(now) {
+			continue
+		}
+		for _, itemID := range campaign.ItemIDs {
+			byItem[itemID] = campaign
+		}
+	}
+	cr.mu.Lock()
+	cr.campaigns = byItem
+	cr.mu.Unlock()
+	return nil
+}
+
+// Run refreshes campaigns every interval until ctx is cancelled
+func (cr *CampaignRouter) Run(ctx context.Context, interval time.Duration, logger *logrus.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cr.Refresh(ctx); err != nil {
+				logger.WithError(err).WithField("event", "campaign_routes_refresh_failed").Warn("Failed to refresh campaign topics")
+			}
+		}
+	}
+}
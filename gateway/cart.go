@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// cartMaxLines is the most lines a cart order may have (CART_MAX_LINES); 0 disables cart orders
+var cartMaxLines int
+
+// cartDefaultPolicy applies to cart orders without a cart_policy (CART_DEFAULT_POLICY)
+var cartDefaultPolicy = common.CartAllOrNothing
+
+// applyCartLines fills in a cart order's item_id and amount from its first line, and its policy
+// from CART_DEFAULT_POLICY; single-item orders are left alone
+func applyCartLines(order *OrderRequest) {
+	if len(order.Lines) == 0 {
+		return
+	}
+	if order.ItemID == "" && order.Amount == 0 {
+		order.ItemID, order.Amount = order.Lines[0].ItemID, order.Lines[0].Amount
+	}
+	if order.CartPolicy == "" {
+		order.CartPolicy = cartDefaultPolicy
+	}
+}
+
+// validateCartLines checks a cart order's lines and policy
+// Every line is validated like a single-item order's item_id and amount, and an item appears
+// in one line only so each line reserves, refunds and confirms on its own
+func validateCartLines(order *OrderRequest) []ValidationError {
+	if len(order.Lines) == 0 {
+		if order.CartPolicy != "" {
+			return []ValidationError{{
+				Field:   "cart_policy",
+				Code:    CodeValueNotAllowed,
+				Message: "cart_policy is only allowed on orders with lines",
+			}}
+		}
+		return nil
+	}
+	if cartMaxLines <= 0 {
+		return []ValidationError{{
+			Field:   "lines",
+			Code:    CodeValueNotAllowed,
+			Message: "cart orders are not enabled",
+		}}
+	}
+
+	var errors []ValidationError
+	if len(order.Lines) > cartMaxLines {
+		errors = append(errors, ValidationError{
+			Field:   "lines",
+			Code:    CodeTooManyEntries,
+			Message: fmt.Sprintf("lines must have at most %d entries", cartMaxLines),
+			Params:  []interface{}{cartMaxLines},
+		})
+		return errors
+	}
+	if first := order.Lines[0]; order.ItemID != first.ItemID || order.Amount != first.Amount {
+		errors = append(errors, ValidationError{
+			Field:   "item_id",
+			Code:    CodeValueNotAllowed,
+			Message: "item_id and amount must be omitted or match the first line on cart orders",
+		})
+	}
+	if order.RecipientUserID != "" {
+		errors = append(errors, ValidationError{
+			Field:   "recipient_user_id",
+			Code:    CodeValueNotAllowed,
+			Message: "cart orders can't be gifts",
+		})
+	}
+	if !common.IsValidCartPolicy(order.CartPolicy) {
+		policies := strings.Join(common.CartPolicies, ", ")
+		errors = append(errors, ValidationError{
+			Field:   "cart_policy",
+			Code:    CodeValueNotAllowed,
+			Message: fmt.Sprintf("cart_policy must be one of: %s", policies),
+			Params:  []interface{}{policies},
+		})
+	}
+
+	seen := make(map[string]bool, len(order.Lines))
+	for i, line := range order.Lines {
+		field := fmt.Sprintf("lines[%d].item_id", i)
+		errors = append(errors, validateID(field, line.ItemID, maxItemIDLength)...)
+		errors = append(errors, validateAmount(fmt.Sprintf("lines[%d].amount", i), line.Amount)...)
+		if seen[line.ItemID] {
+			errors = append(errors, ValidationError{
+				Field:   field,
+				Code:    CodeValueNotAllowed,
+				Message: field + " repeats the item of an earlier line",
+			})
+		}
+		seen[line.ItemID] = true
+	}
+	return errors
+}
+
+// admitCartLines runs the admission chain for each line of a cart order after the first, which
+// was admitted as the order itself; nil for single-item orders
+// The lines' side effects are rolled back with the order's: all of them on a rejection here,
+// or through admission.Rollback when the order isn't queued
+func admitCartLines(ctx context.Context, admission *AdmissionRequest) *AdmissionRejection {
+	order := admission.Order
+	for i := 1; i < len(order.Lines); i++ {
+		lineOrder := *order
+		lineOrder.ItemID, lineOrder.Amount = order.Lines[i].ItemID, order.Lines[i].Amount
+		line := &AdmissionRequest{
+			Order:    &lineOrder,
+			HTTP:     admission.HTTP,
+			ClientIP: admission.ClientIP,
+			Log:      admission.Log.WithField("cart_line", i),
+			DryRun:   admission.DryRun,
+		}
+		rejection := admissionChain.Admit(ctx, line)
+		for _, decision := range line.Decisions {
+			decision.CartLine = i
+			admission.Decisions = append(admission.Decisions, decision)
+		}
+		admission.undo = append(admission.undo, line.undo...)
+		if rejection != nil {
+			rollbackCtx, cancel := rollbackContext(ctx)
+			admission.Rollback(rollbackCtx)
+			cancel()
+			details := map[string]interface{}{"cart_line": i, "item_id": lineOrder.ItemID}
+			for k, v := range rejection.Details {
+				details[k] = v
+			}
+			rejected := *rejection
+			rejected.Details = details
+			return &rejected
+		}
+	}
+	return nil
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math"
 	"os"
 	"strconv"
@@ -9,19 +12,61 @@ import (
 
 	"github.com/IBM/sarama"
 	"github.com/sony/gobreaker"
+	"github.com/yourname/flash-sale-engine/common"
 )
 
+// Half-open probe modes (CIRCUIT_BREAKER_PROBE_MODE)
+const (
+	ProbeModeOrder    = "order"    // Real orders act as half-open probes (default)
+	ProbeModeMetadata = "metadata" // A Kafka metadata refresh probes recovery; orders are never probes
+)
+
+// defaultSendTimeout bounds one send through the circuit breaker (KAFKA_SEND_TIMEOUT)
+const defaultSendTimeout = 10 * time.Second
+
+// SendTimeoutError is returned when a send doesn't finish within the per-send timeout or before
+// the caller's context is done. Unlike a circuit-open error the message may still be delivered:
+// the producer keeps sending it, and Late receives the outcome once it's known
+type SendTimeoutError struct {
+	Err  error // context.DeadlineExceeded or context.Canceled
+	Late <-chan error
+}
+
+func (e *SendTimeoutError) Error() string { return "kafka send timed out: " + e.Err.Error() }
+
+func (e *SendTimeoutError) Unwrap() error { return e.Err }
+
+// Circuit breaker refusals: nothing was sent, and RetryAfter tells when sending may work again
+var (
+	ErrCircuitOpen     = errors.New("kafka circuit breaker is open")
+	ErrCircuitHalfOpen = errors.New("kafka circuit breaker is half-open and its probe requests are in flight")
+)
+
+// ProducerError is a send the circuit breaker let through that the Kafka producer failed
+type ProducerError struct {
+	Err error
+}
+
+func (e *ProducerError) Error() string { return "kafka producer: " + e.Err.Error() }
+
+func (e *ProducerError) Unwrap() error { return e.Err }
+
 // CircuitBreaker wraps Kafka producer with circuit breaker pattern
 // Implements exponential backoff for timeout calculation
 type CircuitBreaker struct {
-	producer     sarama.SyncProducer
+	producer     messageSender // sarama.SyncProducer or batchingProducer (KAFKA_PRODUCER_MODE)
 	cb           *gobreaker.CircuitBreaker
 	mu           sync.RWMutex
 	lastError    error
 	lastErrorAt  time.Time
 	baseTimeout  time.Duration
 	maxTimeout   time.Duration
-	failureCount uint32 // Track consecutive failures for exponential backoff
+	failureCount uint32        // Track consecutive failures for exponential backoff
+	client       sarama.Client // Used for metadata probes; nil disables metadata probing
+	probeMode    string
+	probes       int // Successful probes required in half-open state before closing
+	sendTimeout  time.Duration
+	openedAt     time.Time // Last transition to open
 }
 
 // NewCircuitBreaker creates a new circuit breaker wrapper for Kafka producer
@@ -30,34 +75,65 @@ type CircuitBreaker struct {
 //   - CIRCUIT_BREAKER_FAILURE_THRESHOLD (default: 5)
 //   - CIRCUIT_BREAKER_SUCCESS_THRESHOLD (default: 2)
 //   - CIRCUIT_BREAKER_BASE_TIMEOUT (default: 30s)
-func NewCircuitBreaker(producer sarama.SyncProducer) *CircuitBreaker {
+//   - CIRCUIT_BREAKER_HALF_OPEN_PROBES (default: success threshold)
+//   - CIRCUIT_BREAKER_PROBE_MODE (order|metadata, default: order)
+//   - KAFKA_SEND_TIMEOUT (default: 10s)
+//
+// client is used for metadata probes and may be nil (probe mode falls back to order)
+func NewCircuitBreaker(producer messageSender, client sarama.Client) *CircuitBreaker {
 	// Read configuration from environment or use defaults
 	failureThreshold := getEnvInt("CIRCUIT_BREAKER_FAILURE_THRESHOLD", 5)
 	successThreshold := getEnvInt("CIRCUIT_BREAKER_SUCCESS_THRESHOLD", 2)
+	probes := getEnvInt("CIRCUIT_BREAKER_HALF_OPEN_PROBES", successThreshold)
+	if probes < 1 {
+		probes = 1
+	}
+	probeMode := os.Getenv("CIRCUIT_BREAKER_PROBE_MODE")
+	if probeMode != ProbeModeMetadata || client == nil {
+		probeMode = ProbeModeOrder
+	}
 	baseTimeout := getEnvDuration("CIRCUIT_BREAKER_BASE_TIMEOUT", 30*time.Second)
 	maxTimeout := getEnvDuration("CIRCUIT_BREAKER_MAX_TIMEOUT", 300*time.Second) // 5 minutes max
+	sendTimeout := getEnvDuration("KAFKA_SEND_TIMEOUT", defaultSendTimeout)
 
-	cb := gobreaker.NewCircuitBreaker(gobreaker.Settings{
+	breaker := &CircuitBreaker{
+		producer:    producer,
+		baseTimeout: baseTimeout,
+		maxTimeout:  maxTimeout,
+		client:      client,
+		probeMode:   probeMode,
+		probes:      probes,
+		sendTimeout: sendTimeout,
+	}
+	breaker.cb = gobreaker.NewCircuitBreaker(gobreaker.Settings{
 		Name:        "kafka-producer",
-		MaxRequests: uint32(successThreshold), // Allow N requests in half-open state
-		Interval:    60 * time.Second,         // Reset counts after 60 seconds
-		Timeout:     baseTimeout,              // Base timeout (will use exponential backoff)
+		MaxRequests: uint32(probes),   // Allow N probe requests in half-open state
+		Interval:    60 * time.Second, // Reset counts after 60 seconds
+		Timeout:     baseTimeout,      // Base timeout (will use exponential backoff)
 		ReadyToTrip: func(counts gobreaker.Counts) bool {
 			// Open circuit after N consecutive failures
 			return counts.ConsecutiveFailures >= uint32(failureThreshold)
 		},
+		// A caller going away says nothing about Kafka; timeouts do count as failures
+		IsSuccessful: func(err error) bool {
+			return err == nil || errors.Is(err, context.Canceled)
+		},
 		OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
-			// Log state transitions for monitoring
 			// State changes: Closed -> Open -> HalfOpen -> Closed
+			// The open time tells refused callers when to retry
+			if to == gobreaker.StateOpen {
+				breaker.mu.Lock()
+				breaker.openedAt = time.Now()
+				breaker.mu.Unlock()
+			}
 		},
 	})
+	return breaker
+}
 
-	return &CircuitBreaker{
-		producer:    producer,
-		cb:          cb,
-		baseTimeout: baseTimeout,
-		maxTimeout:  maxTimeout,
-	}
+// ProbeMode returns the configured half-open probe mode
+func (cb *CircuitBreaker) ProbeMode() string {
+	return cb.probeMode
 }
 
 // Helper functions for environment variable parsing
@@ -70,6 +146,24 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvBool(key string, defaultValue bool) bool {
+	if val := os.Getenv(key); val != "" {
+		if boolVal, err := strconv.ParseBool(val); err == nil {
+			return boolVal
+		}
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if val := os.Getenv(key); val != "" {
+		if floatVal, err := strconv.ParseFloat(val, 64); err == nil {
+			return floatVal
+		}
+	}
+	return defaultValue
+}
+
 func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 	if val := os.Getenv(key); val != "" {
 		if duration, err := time.ParseDuration(val); err == nil {
@@ -80,21 +174,63 @@ func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 }
 
 // SendMessage sends a message through the circuit breaker
-// Returns error if circuit is open or if Kafka producer fails
+// Returns ErrCircuitOpen or ErrCircuitHalfOpen if the circuit refused the send, and a
+// *ProducerError if Kafka failed it
 // Circuit breaker prevents overwhelming Kafka when it's down
 // Uses exponential backoff: timeout increases with consecutive failures
-func (cb *CircuitBreaker) SendMessage(msg *sarama.ProducerMessage) (partition int32, offset int64, err error) {
+// The send is bounded by ctx and KAFKA_SEND_TIMEOUT; running out of either returns a
+// *SendTimeoutError. If ctx is already done nothing is sent and ctx.Err() is returned
+func (cb *CircuitBreaker) SendMessage(ctx context.Context, msg *sarama.ProducerMessage) (partition int32, offset int64, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, cb.sendTimeout)
+	defer cancel()
+
+	// In metadata probe mode, recovery is tested with lightweight metadata calls so customer
+	// orders are never used as half-open probes
+	if cb.probeMode == ProbeModeMetadata && cb.cb.State() == gobreaker.StateHalfOpen {
+		if err := cb.probe(msg.Topic); err != nil {
+			if errors.Is(err, gobreaker.ErrTooManyRequests) || errors.Is(err, gobreaker.ErrOpenState) {
+				return 0, 0, cb.refusal(err)
+			}
+			// The failed probe reopened the circuit
+			return 0, 0, fmt.Errorf("%w: metadata probe failed: %v", ErrCircuitOpen, err)
+		}
+	}
+
 	// Execute Kafka send through circuit breaker
 	// Circuit breaker will open after N consecutive failures
+	type sendResult struct {
+		partition int32
+		offset    int64
+		err       error
+	}
 	result, err := cb.cb.Execute(func() (interface{}, error) {
-		partition, offset, err := cb.producer.SendMessage(msg)
-		if err != nil {
+		// sarama's SyncProducer can't be cancelled: the send runs on its own and is abandoned
+		// (still bounded by the producer's timeouts) when ctx is done first
+		done := make(chan sendResult, 1)
+		go func() {
+			partition, offset, err := cb.producer.SendMessage(msg)
+			done <- sendResult{partition, offset, err}
+		}()
+		var res sendResult
+		select {
+		case res = <-done:
+		case <-ctx.Done():
+			late := make(chan error, 1)
+			go func() { late <- (<-done).err }()
+			res.err = &SendTimeoutError{Err: ctx.Err(), Late: late}
+		}
+		if res.err != nil {
 			cb.mu.Lock()
-			cb.lastError = err
+			cb.lastError = res.err
 			cb.lastErrorAt = time.Now()
-			cb.failureCount++
+			if !errors.Is(res.err, context.Canceled) {
+				cb.failureCount++
+			}
 			cb.mu.Unlock()
-			return nil, err
+			return nil, res.err
 		}
 
 		// Reset failure count on success
@@ -102,24 +238,73 @@ func (cb *CircuitBreaker) SendMessage(msg *sarama.ProducerMessage) (partition in
 		cb.failureCount = 0
 		cb.mu.Unlock()
 
-		return map[string]interface{}{
-			"partition": partition,
-			"offset":    offset,
-		}, nil
+		return res, nil
 	})
 
 	if err != nil {
 		// Circuit breaker is open (Kafka unavailable) or execution failed
-		return 0, 0, err
+		var timeout *SendTimeoutError
+		switch {
+		case errors.Is(err, gobreaker.ErrOpenState), errors.Is(err, gobreaker.ErrTooManyRequests):
+			return 0, 0, cb.refusal(err)
+		case errors.As(err, &timeout):
+			return 0, 0, err
+		}
+		return 0, 0, &ProducerError{Err: err}
 	}
 
 	// Extract partition and offset from successful result
-	if result != nil {
-		res := result.(map[string]interface{})
-		return res["partition"].(int32), res["offset"].(int64), nil
+	res := result.(sendResult)
+	return res.partition, res.offset, nil
+}
+
+// refusal maps gobreaker's refusal errors to the circuit breaker's own
+func (cb *CircuitBreaker) refusal(err error) error {
+	if errors.Is(err, gobreaker.ErrTooManyRequests) {
+		return ErrCircuitHalfOpen
+	}
+	return ErrCircuitOpen
+}
+
+// RetryAfter estimates when a refused send may succeed: when the open circuit turns half-open,
+// or shortly while half-open probes are in flight; never less than a second
+func (cb *CircuitBreaker) RetryAfter() time.Duration {
+	if cb.cb.State() != gobreaker.StateOpen {
+		return time.Second
+	}
+	cb.mu.RLock()
+	remaining := cb.baseTimeout - time.Since(cb.openedAt)
+	cb.mu.RUnlock()
+	if remaining < time.Second {
+		return time.Second
 	}
+	return remaining.Round(time.Second)
+}
 
-	return 0, 0, nil
+// probe runs metadata probes until the circuit leaves the half-open state
+// Returns an error if a probe fails (circuit reopens) or probe slots are exhausted by
+// concurrent callers
+func (cb *CircuitBreaker) probe(topic string) error {
+	if topic == "" {
+		topic = common.TopicOrders
+	}
+	for i := 0; i < cb.probes && cb.cb.State() == gobreaker.StateHalfOpen; i++ {
+		_, err := cb.cb.Execute(func() (interface{}, error) {
+			return nil, cb.client.RefreshMetadata(topic)
+		})
+		if err != nil {
+			if errors.Is(err, gobreaker.ErrTooManyRequests) {
+				// Another request is probing; don't count this order as a probe
+				return err
+			}
+			cb.mu.Lock()
+			cb.lastError = err
+			cb.lastErrorAt = time.Now()
+			cb.mu.Unlock()
+			return err
+		}
+	}
+	return nil
 }
 
 // GetTimeout calculates exponential backoff timeout based on failure count
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// startupConfig is the configuration resolved at startup, served at GET /admin/config
+var startupConfig *common.ConfigReport
+
+// gatewayConfig resolves the gateway's configuration without connecting to Redis or Kafka
+// and checks the combinations main can't catch on its own (-validate-config)
+// Defaults mirror main; keep both in step when adding a setting
+func gatewayConfig() *common.ConfigReport {
+	r := common.NewConfigReport("gateway")
+	common.ReportSharedConfig(r)
+	if signer, err := common.LoadMessageSigner(); err == nil && signer != nil && !signer.CanSign() {
+		r.Errorf("MESSAGE_SIGNING_KEY_ID is required when MESSAGE_SIGNING_KEYS is set")
+	}
+
+	// Redis replicas and status reads
+	replicas := r.List("REDIS_REPLICA_ADDRS", "")
+	maxLag := r.Duration("REDIS_REPLICA_MAX_LAG", 5*time.Second)
+	if checkInterval := r.Duration("REDIS_REPLICA_CHECK_INTERVAL", 1*time.Second); len(replicas) > 0 && checkInterval >= maxLag {
+		r.Warnf("REDIS_REPLICA_CHECK_INTERVAL (%s) is not below REDIS_REPLICA_MAX_LAG (%s); lagging replicas are noticed too late", checkInterval, maxLag)
+	}
+	consistency := r.OneOf("STATUS_READ_CONSISTENCY", ConsistencyEventual, ConsistencyReadYourWrite, ConsistencyWait)
+	r.Duration("STATUS_RYW_WINDOW", 30*time.Second)
+	r.Int("STATUS_WAIT_REPLICAS", 1)
+	r.Duration("STATUS_WAIT_TIMEOUT", 100*time.Millisecond)
+	if consistency != ConsistencyEventual && len(replicas) == 0 {
+		r.Warnf("STATUS_READ_CONSISTENCY=%s has no effect without REDIS_REPLICA_ADDRS", consistency)
+	}
+
+	// Kafka producer
+	failureThreshold := r.Int("CIRCUIT_BREAKER_FAILURE_THRESHOLD", 5)
+	if failureThreshold == 0 {
+		r.Errorf("CIRCUIT_BREAKER_FAILURE_THRESHOLD must be at least 1, or the circuit opens on the first order")
+	}
+	r.Int("CIRCUIT_BREAKER_HALF_OPEN_PROBES", r.Int("CIRCUIT_BREAKER_SUCCESS_THRESHOLD", 2))
+	r.OneOf("CIRCUIT_BREAKER_PROBE_MODE", ProbeModeOrder, ProbeModeMetadata)
+	baseTimeout := r.Duration("CIRCUIT_BREAKER_BASE_TIMEOUT", 30*time.Second)
+	if maxTimeout := r.Duration("CIRCUIT_BREAKER_MAX_TIMEOUT", 300*time.Second); baseTimeout > maxTimeout {
+		r.Errorf("CIRCUIT_BREAKER_BASE_TIMEOUT (%s) exceeds CIRCUIT_BREAKER_MAX_TIMEOUT (%s)", baseTimeout, maxTimeout)
+	}
+	buyTimeout := r.Duration("BUY_REQUEST_TIMEOUT", 30*time.Second)
+	if buyTimeout <= 0 {
+		r.Errorf("BUY_REQUEST_TIMEOUT must be positive")
+	}
+	sendTimeout := r.Duration("KAFKA_SEND_TIMEOUT", defaultSendTimeout)
+	if sendTimeout <= 0 {
+		r.Errorf("KAFKA_SEND_TIMEOUT must be positive")
+	} else if sendTimeout >= buyTimeout {
+		r.Warnf("KAFKA_SEND_TIMEOUT (%s) is not below BUY_REQUEST_TIMEOUT (%s); slow sends end the request instead", sendTimeout, buyTimeout)
+	}
+	if r.Int("KAFKA_MAX_MESSAGE_BYTES", 1000000) <= 0 {
+		r.Errorf("KAFKA_MAX_MESSAGE_BYTES must be positive")
+	}
+	r.String("KAFKA_COMPRESSION", "none")
+	_, err := producerCompression()
+	r.Check("Kafka compression", err)
+	if r.OneOf("KAFKA_PRODUCER_MODE", ProducerModeSync, ProducerModeAsync) == ProducerModeAsync {
+		if linger := r.Duration("KAFKA_BATCH_LINGER", 5*time.Millisecond); linger < 0 || linger >= sendTimeout {
+			r.Errorf("KAFKA_BATCH_LINGER (%s) must be at least 0 and below KAFKA_SEND_TIMEOUT (%s)", linger, sendTimeout)
+		}
+		if r.Int("KAFKA_BATCH_MAX_MESSAGES", 500) < 0 {
+			r.Errorf("KAFKA_BATCH_MAX_MESSAGES must not be negative")
+		}
+		if r.Int("KAFKA_BATCH_MAX_BYTES", 1000000) < 0 {
+			r.Errorf("KAFKA_BATCH_MAX_BYTES must not be negative")
+		}
+	}
+	r.OneOf("ORDER_PAYLOAD_FORMAT", OrderPayloadJSON, OrderPayloadProtobuf)
+	keyMode := r.OneOf("ORDER_PARTITION_KEY_MODE", PartitionKeyNone, PartitionKeyItem, PartitionKeyItemSharded, PartitionKeyUser)
+	if shards := r.Int("ORDER_KEY_SHARDS", 8); keyMode == PartitionKeyItemSharded && shards < 1 {
+		r.Errorf("ORDER_KEY_SHARDS must be at least 1 with ORDER_PARTITION_KEY_MODE=item_sharded")
+	}
+	if r.Bool("OUTAGE_BUFFER_ENABLED", false) {
+		if r.Int("OUTAGE_BUFFER_CAPACITY", 1000) == 0 {
+			r.Errorf("OUTAGE_BUFFER_CAPACITY must be at least 1")
+		}
+		r.String("OUTAGE_BUFFER_FILE", "")
+		r.Duration("OUTAGE_BUFFER_FLUSH_INTERVAL", 1*time.Second)
+	}
+	if r.Bool("CAMPAIGN_TOPICS_ENABLED", false) {
+		r.Duration("CAMPAIGN_TOPICS_REFRESH", 10*time.Second)
+		r.Duration("ORDER_SALE_END_GRACE", saleEndGrace)
+	}
+
+	// Rate limiting and client IPs
+	backend := r.OneOf("RATE_LIMIT_BACKEND", RateLimitBackendRedis, RateLimitBackendMemcached, RateLimitBackendMemory)
+	if memcachedAddrs := r.List("MEMCACHED_ADDRS", ""); backend == RateLimitBackendMemcached && len(memcachedAddrs) == 0 {
+		r.Errorf("RATE_LIMIT_BACKEND=memcached requires MEMCACHED_ADDRS")
+	}
+	if r.Int("RATE_LIMIT_MAX_REQUESTS", 60) == 0 {
+		r.Errorf("RATE_LIMIT_MAX_REQUESTS must be at least 1, or every request is rejected")
+	}
+	windowSize := r.Duration("RATE_LIMIT_WINDOW", 1*time.Minute)
+	r.Int("IP_RATE_LIMIT_MAX_REQUESTS", 0)
+	r.Duration("IP_RATE_LIMIT_WINDOW", windowSize)
+	r.Int("IP_MAX_CONCURRENT_REQUESTS", 0)
+	r.Int("IP_FORWARDED_HOPS", 0)
+	trustedProxies, err := ParseTrustedProxies(r.String("TRUSTED_PROXIES", ""))
+	r.Check("TRUSTED_PROXIES", err)
+	if r.Bool("PROXY_PROTOCOL", false) && len(trustedProxies) == 0 {
+		r.Errorf("PROXY_PROTOCOL requires TRUSTED_PROXIES")
+	}
+
+	// Admission
+	r.OneOf("DUPLICATE_INTENT_MODE", DuplicateIntentOff, DuplicateIntentFlag, DuplicateIntentBlock)
+	r.Duration("DUPLICATE_INTENT_WINDOW", 5*time.Minute)
+	r.List("REGISTRATION_ITEMS", "")
+	r.Int("PURCHASE_CAP_PER_USER", 0)
+	_, err = common.ParsePurchaseCaps(r.String("PURCHASE_CAP_ITEMS", ""))
+	r.Check("PURCHASE_CAP_ITEMS", err)
+	r.Duration("PURCHASE_CAP_WINDOW", 24*time.Hour)
+	itemRate := r.Int("ITEM_ADMISSION_RATE", 0)
+	itemRates, err := ParseItemRates(r.String("ITEM_ADMISSION_RATE_ITEMS", ""))
+	r.Check("ITEM_ADMISSION_RATE_ITEMS", err)
+	chain, err := ParseAdmissionPolicies(r.String("ADMISSION_POLICIES", defaultAdmissionPolicies))
+	r.Check("ADMISSION_POLICIES", err)
+	if NewItemRateLimiter(nil, int64(itemRate), itemRates).Enabled() && err == nil && !slices.Contains(chain.Names(), "item_rate") {
+		r.Warnf("ITEM_ADMISSION_RATE is set but ADMISSION_POLICIES leaves out item_rate; orders are not rate limited per item")
+	}
+	rulesFile := r.File("GEOIP_RULES_FILE")
+	databaseFile := r.File("GEOIP_DATABASE_FILE")
+	if rulesFile != "" {
+		if databaseFile == "" {
+			r.Errorf("GEOIP_RULES_FILE requires GEOIP_DATABASE_FILE")
+		} else if geoDB, err := LoadCSVGeoIPDatabase(databaseFile); err != nil {
+			r.Check("GEOIP_DATABASE_FILE", err)
+		} else {
+			geo, err := LoadGeoAdmission(geoDB, rulesFile)
+			r.Check("GEOIP_RULES_FILE", err)
+			if err == nil {
+				r.Set("geo_admission_rules", fmt.Sprintf("%d items, %d networks", geo.RuleCount(), len(geoDB.networks)), common.ConfigSourceFile)
+			}
+		}
+	}
+	if rulesFile := r.File("VALIDATION_RULES_FILE"); rulesFile != "" {
+		count, err := LoadValidationRules(rulesFile)
+		r.Check("VALIDATION_RULES_FILE", err)
+		if err == nil {
+			r.Set("validation_rules", fmt.Sprintf("%d rules", count), common.ConfigSourceFile)
+		}
+	}
+
+	// Bot mitigation and purchase sessions
+	deviceSecret := r.Secret("DEVICE_TOKEN_SECRET")
+	deviceMaxAge := r.Duration("DEVICE_TOKEN_MAX_AGE", 10*time.Minute)
+	if deviceSecret != "" {
+		_, err := NewDeviceTokenVerifier(deviceSecret, deviceMaxAge)
+		r.Check("DEVICE_TOKEN_SECRET", err)
+	}
+	if r.Bool("DEVICE_TOKEN_REQUIRED", false) && deviceSecret == "" {
+		r.Errorf("DEVICE_TOKEN_REQUIRED requires DEVICE_TOKEN_SECRET")
+	}
+	if r.URL("RISK_SCORER_URL") != "" {
+		r.Duration("RISK_SCORER_TIMEOUT", 200*time.Millisecond)
+	}
+	if threshold := r.Float("RISK_BLOCK_THRESHOLD", 0.9); threshold < 0 || threshold > 1 {
+		r.Errorf("RISK_BLOCK_THRESHOLD must be between 0 and 1")
+	}
+	if secret := r.Secret("RATE_LIMIT_EXEMPTION_SECRET"); secret != "" {
+		_, err := common.NewRateLimitExemptions(secret, nil)
+		r.Check("RATE_LIMIT_EXEMPTION_SECRET", err)
+	}
+	purchaseSecret := r.Secret("PURCHASE_TOKEN_SECRET")
+	purchaseTTL := r.Duration("PURCHASE_TOKEN_TTL", 2*time.Minute)
+	if purchaseSecret != "" {
+		_, err := NewPurchaseTokenIssuer(purchaseSecret, purchaseTTL)
+		r.Check("PURCHASE_TOKEN_SECRET", err)
+	}
+	userSecret := r.Secret("USER_TOKEN_SECRET")
+	if userSecret != "" {
+		_, err := NewUserTokenVerifier(userSecret)
+		r.Check("USER_TOKEN_SECRET", err)
+	}
+	if r.Bool("PURCHASE_TOKEN_REQUIRED", false) {
+		if purchaseSecret == "" {
+			r.Errorf("PURCHASE_TOKEN_REQUIRED requires PURCHASE_TOKEN_SECRET")
+		}
+		if userSecret == "" {
+			r.Errorf("PURCHASE_TOKEN_REQUIRED requires USER_TOKEN_SECRET, so /session only admits the user's own bearer token")
+		}
+	}
+	if r.Bool("WAITLIST_ENABLED", false) {
+		if purchaseSecret == "" {
+			r.Errorf("WAITLIST_ENABLED requires PURCHASE_TOKEN_SECRET")
+		}
+		r.Duration("WAITLIST_OFFER_TTL", 10*time.Minute)
+		r.Duration("WAITLIST_DISPATCH_INTERVAL", 1*time.Second)
+	}
+	if r.Bool("NOTIFICATION_PREFERENCES_ENABLED", false) {
+		if userSecret == "" {
+			r.Errorf("NOTIFICATION_PREFERENCES_ENABLED requires USER_TOKEN_SECRET")
+		}
+		if r.Secret("ORDER_STORE_DSN") == "" {
+			r.Errorf("NOTIFICATION_PREFERENCES_ENABLED requires ORDER_STORE_DSN")
+		}
+	}
+
+	if secret := r.Secret("ADMIN_TOKEN_SECRET"); secret != "" {
+		_, err := common.NewAdminAuth(secret)
+		r.Check("ADMIN_TOKEN_SECRET", err)
+	}
+
+	// Order API
+	r.Bool("GENERATE_REQUEST_ID", false)
+	r.Bool("ORDER_AMENDMENTS_ENABLED", false)
+	if r.Int("CART_MAX_LINES", 0) < 0 {
+		r.Errorf("CART_MAX_LINES must not be negative")
+	}
+	r.OneOf("CART_DEFAULT_POLICY", common.CartPolicies...)
+	r.Duration("ACK_RESERVED_TIMEOUT", ackReservedTimeout)
+	r.URL("PUBLIC_BASE_URL")
+	r.Duration("ORDER_EVENTS_TIMEOUT", orderEventsTimeout)
+	r.Bool("ORDER_TIMELINE_ENABLED", false)
+	return r
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+const (
+	maxRequestBodyBytes = 8 * 1024 // 8KB is far above any legitimate order payload
+	maxJSONDepth        = 4        // Order payloads are flat; deep nesting indicates a client bug or abuse
+)
+
+// DecodeOrderRequest strictly decodes the request body into an OrderRequest
+// Rejects unknown fields, mistyped fields, trailing data, oversized bodies and deeply nested JSON
+// Returns structured validation errors so client integration bugs surface immediately
+func DecodeOrderRequest(w http.ResponseWriter, r *http.Request, order *OrderRequest) []ValidationError {
+	// Limit body size to protect the gateway from oversized payloads
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return []ValidationError{{
+				Field:   "body",
+				Code:    CodeBodyTooLarge,
+				Message: fmt.Sprintf("request body must be at most %d bytes", maxRequestBodyBytes),
+				Params:  []interface{}{maxRequestBodyBytes},
+			}}
+		}
+		return []ValidationError{{Field: "body", Code: CodeInvalidBody, Message: "failed to read request body"}}
+	}
+
+	if depth, err := jsonDepth(body); err != nil {
+		return []ValidationError{decodeErrorToValidationError(err)}
+	} else if depth > maxJSONDepth {
+		return []ValidationError{{
+			Field:   "body",
+			Code:    CodeBodyTooDeep,
+			Message: fmt.Sprintf("request body must be nested at most %d levels deep", maxJSONDepth),
+			Params:  []interface{}{maxJSONDepth},
+		}}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(order); err != nil {
+		return []ValidationError{decodeErrorToValidationError(err)}
+	}
+
+	// Reject trailing data after the JSON object (e.g. two concatenated objects)
+	if decoder.More() {
+		return []ValidationError{{Field: "body", Code: CodeTrailingData, Message: "request body must contain a single JSON object"}}
+	}
+
+	return nil
+}
+
+// decodeErrorToValidationError maps encoding/json errors to field-level validation errors
+func decodeErrorToValidationError(err error) ValidationError {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		return ValidationError{
+			Field:   "body",
+			Code:    CodeMalformedJSON,
+			Message: fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset),
+			Params:  []interface{}{syntaxErr.Offset},
+		}
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			field = "body"
+		}
+		if strings.HasPrefix(typeErr.Value, "number") && isIntegerKind(typeErr.Type.Kind()) {
+			// A JSON number that doesn't fit the integer field: fractional (1.5) or out of range (1e30)
+			return ValidationError{
+				Field:   field,
+				Code:    CodeNotWholeNumber,
+				Message: fmt.Sprintf("%s must be a whole number within range", field),
+			}
+		}
+		return ValidationError{
+			Field:   field,
+			Code:    CodeInvalidType,
+			Message: fmt.Sprintf("%s must be of type %s", field, typeErr.Type.String()),
+			Params:  []interface{}{typeErr.Type.String()},
+		}
+	case errors.Is(err, io.EOF):
+		return ValidationError{Field: "body", Code: CodeRequired, Message: "request body is required"}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return ValidationError{Field: "body", Code: CodeBodyTruncated, Message: "request body is truncated"}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no typed error for unknown fields, so parse the quoted name
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return ValidationError{
+			Field:   field,
+			Code:    CodeUnknownField,
+			Message: fmt.Sprintf("unknown field %q", field),
+		}
+	default:
+		return ValidationError{Field: "body", Code: CodeInvalidBody, Message: "invalid request body"}
+	}
+}
+
+// isIntegerKind reports whether k is a signed or unsigned integer kind
+func isIntegerKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// jsonDepth returns the maximum nesting depth of objects and arrays in a JSON document
+func jsonDepth(data []byte) (int, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	depth, maxDepth := 0, 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return maxDepth, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+			if depth > maxDepth {
+				maxDepth = depth
+			}
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// DeviceTokenHeader carries the signed device fingerprint token issued by the client-side
+// fingerprinting SDK (or the bot-mitigation vendor's edge)
+const DeviceTokenHeader = "X-Device-Token"
+
+// Device token errors
+var (
+	ErrDeviceTokenMalformed = errors.New("malformed device token")
+	ErrDeviceTokenSignature = errors.New("device token signature mismatch")
+	ErrDeviceTokenExpired   = errors.New("device token expired")
+)
+
+// DeviceFingerprint is the verified content of a device token
+type DeviceFingerprint struct {
+	ID       string `json:"id"`                // Stable device identifier
+	IssuedAt int64  `json:"iat"`               // Unix seconds
+	Channel  string `json:"channel,omitempty"` // Channel the issuer vouches for (app SDK, partner edge)
+}
+
+// DeviceTokenVerifier validates device tokens of the form base64url(payload).base64url(HMAC-SHA256(payload))
+// where payload is the JSON DeviceFingerprint
+type DeviceTokenVerifier struct {
+	secret []byte
+	maxAge time.Duration
+}
+
+// NewDeviceTokenVerifier creates a verifier; tokens older than maxAge are rejected
+func NewDeviceTokenVerifier(secret string, maxAge time.Duration) (*DeviceTokenVerifier, error) {
+	if len(secret) < 32 {
+		return nil, errors.New("device token secret must be at least 32 bytes")
+	}
+	return &DeviceTokenVerifier{secret: []byte(secret), maxAge: maxAge}, nil
+}
+
+// Verify checks token's signature and age and returns its fingerprint
+func (v *DeviceTokenVerifier) Verify(token string, now time.Time) (*DeviceFingerprint, error) {
+	payload, err := common.DecodeSignedToken(v.secret, token)
+	if errors.Is(err, common.ErrTokenSignature) {
+		return nil, ErrDeviceTokenSignature
+	} else if err != nil {
+		return nil, ErrDeviceTokenMalformed
+	}
+
+	var fingerprint DeviceFingerprint
+	if err := json.Unmarshal(payload, &fingerprint); err != nil || fingerprint.ID == "" ||
+		(fingerprint.Channel != "" && !common.IsValidChannel(fingerprint.Channel)) {
+		return nil, ErrDeviceTokenMalformed
+	}
+	issuedAt := time.Unix(fingerprint.IssuedAt, 0)
+	if now.Sub(issuedAt) > v.maxAge || issuedAt.After(now.Add(time.Minute)) {
+		return nil, ErrDeviceTokenExpired
+	}
+	return &fingerprint, nil
+}
+
+// orderChannel returns the channel an order is attributed to: the one a verified device token
+// vouches for, else the web storefront
+// The body's channel is client-supplied and therefore not trusted, since channel reserves and
+// allocation buckets hold stock back for the channels it names
+func orderChannel(device *DeviceFingerprint) string {
+	if device != nil && device.Channel != "" {
+		return device.Channel
+	}
+	return common.DefaultChannel
+}
+
+// RiskSignals describes an order for risk scoring
+type RiskSignals struct {
+	UserID          string `json:"user_id"`
+	RecipientUserID string `json:"recipient_user_id,omitempty"` // Set on gift orders
+	ItemID          string `json:"item_id"`
+	Amount          int64  `json:"amount"`
+	Channel         string `json:"channel"`
+	ClientIP        string `json:"client_ip"`
+	Country         string `json:"country,omitempty"`
+	UserAgent       string `json:"user_agent,omitempty"`
+	DeviceID        string `json:"device_id,omitempty"` // Empty without a verified device token
+}
+
+// RiskScore is a scorer's verdict; Score ranges from 0 (human) to 1 (bot)
+type RiskScore struct {
+	Score  float64 `json:"score"`
+	Reason string  `json:"reason,omitempty"`
+}
+
+// RiskScorer scores orders before admission
+// Deployments plug in bot-mitigation vendors by registering a scorer; the highest score of all
+// registered scorers is compared against RISK_BLOCK_THRESHOLD
+type RiskScorer interface {
+	Name() string
+	Score(ctx context.Context, signals RiskSignals) (RiskScore, error)
+}
+
+var (
+	riskScorersMu sync.RWMutex
+	riskScorers   []RiskScorer
+)
+
+// RegisterRiskScorer adds a scorer consulted for every order
+func RegisterRiskScorer(scorer RiskScorer) {
+	riskScorersMu.Lock()
+	defer riskScorersMu.Unlock()
+	riskScorers = append(riskScorers, scorer)
+}
+
+// riskScorerCount returns the number of registered scorers
+func riskScorerCount() int {
+	riskScorersMu.RLock()
+	defer riskScorersMu.RUnlock()
+	return len(riskScorers)
+}
+
+// RiskVerdict is the combined result of all registered scorers
+type RiskVerdict struct {
+	Score  float64
+	Scorer string // Scorer that produced Score
+	Reason string
+	Errors map[string]error // Failed scorers are skipped (fail open)
+}
+
+// scoreOrder runs every registered scorer and keeps the highest score
+func scoreOrder(ctx context.Context, signals RiskSignals) RiskVerdict {
+	riskScorersMu.RLock()
+	defer riskScorersMu.RUnlock()
+
+	var verdict RiskVerdict
+	for _, scorer := range riskScorers {
+		score, err := scorer.Score(ctx, signals)
+		if err != nil {
+			if verdict.Errors == nil {
+				verdict.Errors = make(map[string]error)
+			}
+			verdict.Errors[scorer.Name()] = err
+			continue
+		}
+		if score.Score > verdict.Score || verdict.Scorer == "" {
+			verdict.Score, verdict.Scorer, verdict.Reason = score.Score, scorer.Name(), score.Reason
+		}
+	}
+	return verdict
+}
+
+// HTTPRiskScorer posts RiskSignals as JSON to a vendor endpoint and expects a RiskScore back
+type HTTPRiskScorer struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPRiskScorer creates a scorer calling url with client; the client's timeout applies per order
+func NewHTTPRiskScorer(url string, client *http.Client) *HTTPRiskScorer {
+	return &HTTPRiskScorer{url: url, client: client}
+}
+
+// Name identifies the scorer in logs
+func (s *HTTPRiskScorer) Name() string {
+	return "http"
+}
+
+// Score calls the vendor endpoint
+func (s *HTTPRiskScorer) Score(ctx context.Context, signals RiskSignals) (RiskScore, error) {
+	body, _ := json.Marshal(signals)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return RiskScore{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return RiskScore{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return RiskScore{}, fmt.Errorf("risk scorer returned %s", resp.Status)
+	}
+	var score RiskScore
+	if err := json.NewDecoder(resp.Body).Decode(&score); err != nil {
+		return RiskScore{}, fmt.Errorf("decode risk score: %w", err)
+	}
+	return score, nil
+}
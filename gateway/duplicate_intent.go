@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// Duplicate-intent detection modes (DUPLICATE_INTENT_MODE)
+const (
+	DuplicateIntentOff   = "off"   // Detection disabled
+	DuplicateIntentFlag  = "flag"  // Log and count the duplicate, but let the order through
+	DuplicateIntentBlock = "block" // Reject the duplicate with 409 Conflict
+)
+
+// luaReleaseIntentScript deletes the intent key only if it still belongs to the given request
+// Prevents a rolled-back request from clearing an intent recorded by a newer request
+const luaReleaseIntentScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+    return redis.call('DEL', KEYS[1])
+end
+return 0
+`
+
+// DuplicateIntentDetector catches clients that regenerate request IDs on retry by tracking
+// the most recent purchase attempt per user+item within a time window
+// Complements exact request_id idempotency, which cannot see through regenerated IDs
+type DuplicateIntentDetector struct {
+	redisClient   *redis.Client
+	statusStore   *OrderStatusStore
+	mode          string
+	window        time.Duration
+	releaseScript *redis.Script
+}
+
+// NewDuplicateIntentDetector creates a new detector
+// mode: off, flag or block
+// window: how long a purchase attempt blocks/flags subsequent attempts for the same user+item
+func NewDuplicateIntentDetector(redisClient *redis.Client, statusStore *OrderStatusStore, mode string, window time.Duration) *DuplicateIntentDetector {
+	switch mode {
+	case DuplicateIntentFlag, DuplicateIntentBlock:
+	default:
+		mode = DuplicateIntentOff
+	}
+	return &DuplicateIntentDetector{
+		redisClient:   redisClient,
+		statusStore:   statusStore,
+		mode:          mode,
+		window:        window,
+		releaseScript: redis.NewScript(luaReleaseIntentScript),
+	}
+}
+
+// Mode returns the configured detection mode
+func (d *DuplicateIntentDetector) Mode() string {
+	return d.mode
+}
+
+// Check records the purchase intent for userID+itemID and reports whether it duplicates
+// an earlier attempt within the window
+// An earlier attempt that terminally failed (order status FAILED_*) does not count, so users
+// can retry after a sold-out or payment failure
+// Returns the request ID of the earlier attempt when a duplicate is detected
+func (d *DuplicateIntentDetector) Check(ctx context.Context, userID, itemID, requestID string) (bool, string, error) {
+	if d.mode == DuplicateIntentOff {
+		return false, "", nil
+	}
+
+	key := intentKey(userID, itemID)
+	isNew, err := d.redisClient.SetNX(ctx, key, requestID, d.window).Result()
+	if err != nil {
+		return false, "", err
+	}
+	if isNew {
+		return false, "", nil
+	}
+
+	previousID, err := d.redisClient.Get(ctx, key).Result()
+	if err == redis.Nil {
+		// Intent expired between SETNX and GET - record this attempt instead
+		return false, "", d.redisClient.Set(ctx, key, requestID, d.window).Err()
+	}
+	if err != nil {
+		return false, "", err
+	}
+
+	// Same request_id is an exact retry; idempotency handles it
+	if previousID == requestID {
+		return false, "", nil
+	}
+
+	status, err := d.statusStore.GetStatus(ctx, previousID)
+	if err != nil {
+		return false, "", err
+	}
+	if strings.HasPrefix(status, "FAILED") || status == common.ResultExpired {
+		// Earlier attempt terminally failed - this is a legitimate retry
+		return false, "", d.redisClient.Set(ctx, key, requestID, d.window).Err()
+	}
+
+	return true, previousID, nil
+}
+
+// Release removes the intent recorded by requestID
+// Called when the order is rolled back before being queued so the user can retry immediately
+func (d *DuplicateIntentDetector) Release(ctx context.Context, userID, itemID, requestID string) error {
+	if d.mode == DuplicateIntentOff {
+		return nil
+	}
+	return d.releaseScript.Run(ctx, d.redisClient, []string{intentKey(userID, itemID)}, requestID).Err()
+}
+
+func intentKey(userID, itemID string) string {
+	return "intent:" + userID + ":" + itemID
+}
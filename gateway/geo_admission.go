@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+// GeoIPDatabase maps client addresses to ISO 3166-1 alpha-2 country codes
+// Implementations must be safe for concurrent use
+type GeoIPDatabase interface {
+	Country(ip net.IP) (string, bool)
+}
+
+// geoNetwork is one network of a CSVGeoIPDatabase
+type geoNetwork struct {
+	prefix  netip.Prefix
+	country string
+}
+
+// CSVGeoIPDatabase is an in-memory GeoIP database loaded from a "network,country_code" CSV
+// (e.g. GeoLite2 country blocks joined with their locations); networks must not overlap
+type CSVGeoIPDatabase struct {
+	networks []geoNetwork // Sorted by first address
+}
+
+// LoadCSVGeoIPDatabase reads a GeoIP database; a header row and blank country codes are skipped
+func LoadCSVGeoIPDatabase(path string) (*CSVGeoIPDatabase, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	db := &CSVGeoIPDatabase{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("%s:%d: expected network,country_code", path, line)
+		}
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(record[0]))
+		if err != nil {
+			if line == 1 {
+				continue // Header
+			}
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		country := strings.ToUpper(strings.TrimSpace(record[1]))
+		if country == "" {
+			continue
+		}
+		db.networks = append(db.networks, geoNetwork{prefix: prefix.Masked(), country: country})
+	}
+	sort.Slice(db.networks, func(i, j int) bool {
+		return db.networks[i].prefix.Addr().Less(db.networks[j].prefix.Addr())
+	})
+	return db, nil
+}
+
+// Country returns the country of ip, or false if ip is in no known network
+func (db *CSVGeoIPDatabase) Country(ip net.IP) (string, bool) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return "", false
+	}
+	addr = addr.Unmap()
+	// Last network starting at or before addr is the only one that can contain it
+	i := sort.Search(len(db.networks), func(i int) bool {
+		return addr.Less(db.networks[i].prefix.Addr())
+	})
+	if i == 0 || !db.networks[i-1].prefix.Contains(addr) {
+		return "", false
+	}
+	return db.networks[i-1].country, true
+}
+
+// GeoAdmissionRule restricts where a campaign's items can be bought from
+//
+// Example file:
+//
+//	[
+//	  {"campaign": "spring-drop", "item_ids": ["101", "102"], "allowed_countries": ["US", "CA"],
+//	   "max_amount_by_country": {"CA": 1}, "unknown_country": "deny"},
+//	  {"campaign": "global", "item_ids": ["*"], "blocked_countries": ["KP"]}
+//	]
+type GeoAdmissionRule struct {
+	Campaign           string           `json:"campaign"`
+	ItemIDs            []string         `json:"item_ids"`                        // "*" applies the rule to every item without its own rule
+	AllowedCountries   []string         `json:"allowed_countries,omitempty"`     // Empty allows every country not blocked
+	BlockedCountries   []string         `json:"blocked_countries,omitempty"`     // High-risk regions rejected outright
+	MaxAmountByCountry map[string]int64 `json:"max_amount_by_country,omitempty"` // Stricter per-order limits for high-risk regions
+	UnknownCountry     string           `json:"unknown_country,omitempty"`       // allow|deny addresses missing from the database (default: allow)
+}
+
+// Geo admission denial reasons, used in logs and as the gateway_geo_admission_total outcome
+const (
+	GeoReasonNotAllowed     = "country_not_allowed"
+	GeoReasonBlocked        = "country_blocked"
+	GeoReasonUnknown        = "country_unknown"
+	GeoReasonAmountExceeded = "country_amount_exceeded"
+)
+
+// GeoDecision is the outcome of evaluating an order against its geo admission rule
+type GeoDecision struct {
+	Campaign  string // Empty when no rule applies to the item
+	Country   string // Empty when the client address isn't in the database
+	Allowed   bool
+	Reason    string // Denial reason (GeoReason*)
+	MaxAmount int64  // Country limit, set for GeoReasonAmountExceeded
+}
+
+// GeoAdmission evaluates orders against per-campaign country rules
+type GeoAdmission struct {
+	db    GeoIPDatabase
+	rules map[string]*GeoAdmissionRule // By item_id; "*" is the fallback
+}
+
+// LoadGeoAdmission reads rules from a JSON file (GEOIP_RULES_FILE) and validates them
+// Country codes are normalized to upper case; items listed in more than one rule are rejected
+func LoadGeoAdmission(db GeoIPDatabase, path string) (*GeoAdmission, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []*GeoAdmissionRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	ga := &GeoAdmission{db: db, rules: make(map[string]*GeoAdmissionRule)}
+	for _, rule := range rules {
+		if len(rule.ItemIDs) == 0 {
+			return nil, fmt.Errorf("campaign %q: item_ids is required", rule.Campaign)
+		}
+		switch rule.UnknownCountry {
+		case "", "allow", "deny":
+		default:
+			return nil, fmt.Errorf("campaign %q: unknown_country must be allow or deny", rule.Campaign)
+		}
+		rule.AllowedCountries = upperAll(rule.AllowedCountries)
+		rule.BlockedCountries = upperAll(rule.BlockedCountries)
+		limits := make(map[string]int64, len(rule.MaxAmountByCountry))
+		for country, max := range rule.MaxAmountByCountry {
+			if max < 1 {
+				return nil, fmt.Errorf("campaign %q: max_amount_by_country for %s must be positive", rule.Campaign, country)
+			}
+			limits[strings.ToUpper(country)] = max
+		}
+		rule.MaxAmountByCountry = limits
+
+		for _, itemID := range rule.ItemIDs {
+			if _, exists := ga.rules[itemID]; exists {
+				return nil, fmt.Errorf("item %q is listed in more than one geo rule", itemID)
+			}
+			ga.rules[itemID] = rule
+		}
+	}
+	if len(ga.rules) == 0 {
+		return nil, errors.New("no geo admission rules defined")
+	}
+	return ga, nil
+}
+
+// RuleCount returns the number of items (including "*") with a rule
+func (ga *GeoAdmission) RuleCount() int {
+	return len(ga.rules)
+}
+
+// Evaluate decides whether an order for itemID and amount from ip is admitted
+func (ga *GeoAdmission) Evaluate(ip string, itemID string, amount int64) GeoDecision {
+	rule, ok := ga.rules[itemID]
+	if !ok {
+		if rule, ok = ga.rules["*"]; !ok {
+			return GeoDecision{Allowed: true}
+		}
+	}
+	decision := GeoDecision{Campaign: rule.Campaign}
+
+	country, known := "", false
+	if parsed := net.ParseIP(ip); parsed != nil {
+		country, known = ga.db.Country(parsed)
+	}
+	decision.Country = country
+	switch {
+	case !known:
+		if rule.UnknownCountry == "deny" {
+			decision.Reason = GeoReasonUnknown
+			return decision
+		}
+	case contains(rule.BlockedCountries, country):
+		decision.Reason = GeoReasonBlocked
+		return decision
+	case len(rule.AllowedCountries) > 0 && !contains(rule.AllowedCountries, country):
+		decision.Reason = GeoReasonNotAllowed
+		return decision
+	}
+	if max, limited := rule.MaxAmountByCountry[country]; known && limited && amount > max {
+		decision.Reason = GeoReasonAmountExceeded
+		decision.MaxAmount = max
+		return decision
+	}
+	decision.Allowed = true
+	return decision
+}
+
+func upperAll(values []string) []string {
+	upper := make([]string, len(values))
+	for i, value := range values {
+		upper[i] = strings.ToUpper(strings.TrimSpace(value))
+	}
+	return upper
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Validation error codes
+// Codes are part of the API contract and must stay stable; only messages are localized
+const (
+	CodeRequired         = "required"
+	CodeTooLong          = "too_long"
+	CodeInvalidFormat    = "invalid_format"
+	CodeTooSmall         = "too_small"
+	CodeTooLarge         = "too_large"
+	CodeWhitespaceOnly   = "whitespace_only"
+	CodeTooManyEntries   = "too_many_entries"
+	CodeBodyTooLarge     = "body_too_large"
+	CodeBodyTooDeep      = "body_too_deep"
+	CodeBodyTruncated    = "body_truncated"
+	CodeMalformedJSON    = "malformed_json"
+	CodeInvalidType      = "invalid_type"
+	CodeNotWholeNumber   = "not_whole_number"
+	CodeUnknownField     = "unknown_field"
+	CodeTrailingData     = "trailing_data"
+	CodeInvalidBody      = "invalid_body"
+	CodePatternMismatch  = "pattern_mismatch"
+	CodePrefixNotAllowed = "prefix_not_allowed"
+	CodeValueNotAllowed  = "value_not_allowed"
+	CodeRuleViolation    = "rule_violation"
+	CodeInvalidCountry   = "invalid_country"
+	CodeInvalidPostal    = "invalid_postal_code"
+	CodeInvalidPhone     = "invalid_phone"
+	CodeSameAsBuyer      = "same_as_user_id"
+)
+
+// Response error codes returned in the top-level "code" field of error responses
+const (
+	ErrCodeInvalidBody        = "invalid_body"
+	ErrCodeValidationFailed   = "validation_failed"
+	ErrCodeRateLimited        = "rate_limited"
+	ErrCodeDuplicateRequest   = "duplicate_request"
+	ErrCodeDuplicateIntent    = "duplicate_intent"
+	ErrCodeInternal           = "internal_error"
+	ErrCodeServiceUnavailable = "service_unavailable"
+	ErrCodeQueueFailed        = "queue_failed"
+	ErrCodeQueueTimeout       = "queue_timeout"
+	ErrCodeTooManyConcurrent  = "too_many_concurrent_requests"
+	ErrCodeRegionNotAllowed   = "region_not_allowed"
+	ErrCodeRegionLimit        = "region_limit_exceeded"
+	ErrCodeInvalidDevice      = "invalid_device_token"
+	ErrCodeRiskRejected       = "order_rejected"
+	ErrCodeSessionDenied      = "session_not_admitted"
+	ErrCodePurchaseToken      = "invalid_purchase_token"
+	ErrCodeNotRegistered      = "not_registered"
+	ErrCodePurchaseCap        = "purchase_limit_exceeded"
+	ErrCodeOrderNotFound      = "order_not_found"
+	ErrCodeOrderNotAmendable  = "order_not_amendable"
+	ErrCodeItemBusy           = "item_busy"
+	ErrCodeUnauthorized       = "unauthorized"
+	ErrCodeForbidden          = "forbidden"
+)
+
+const defaultLanguage = "en"
+
+// validationCatalogs holds localized validation message templates keyed by language then code
+// Templates receive the field name as %[1]v followed by ValidationError.Params
+// English messages are produced inline by the validators, so "en" has no catalog
+var validationCatalogs = map[string]map[string]string{
+	"es": {
+		CodeRequired:         "%[1]v es obligatorio",
+		CodeTooLong:          "%[1]v debe tener como máximo %[2]v caracteres",
+		CodeInvalidFormat:    "%[1]v contiene caracteres no válidos (solo se permiten alfanuméricos, guion bajo y guion)",
+		CodeTooSmall:         "%[1]v debe ser al menos %[2]v",
+		CodeTooLarge:         "%[1]v debe ser como máximo %[2]v",
+		CodeWhitespaceOnly:   "%[1]v no puede estar vacío ni contener solo espacios",
+		CodeTooManyEntries:   "%[1]v debe tener como máximo %[2]v entradas",
+		CodeBodyTooLarge:     "el cuerpo de la solicitud debe tener como máximo %[2]v bytes",
+		CodeBodyTooDeep:      "el cuerpo de la solicitud debe tener como máximo %[2]v niveles de anidamiento",
+		CodeBodyTruncated:    "el cuerpo de la solicitud está truncado",
+		CodeMalformedJSON:    "JSON mal formado en la posición %[2]v",
+		CodeInvalidType:      "%[1]v debe ser de tipo %[2]v",
+		CodeNotWholeNumber:   "%[1]v debe ser un número entero dentro del rango",
+		CodeUnknownField:     "campo desconocido %[1]q",
+		CodeTrailingData:     "el cuerpo de la solicitud debe contener un único objeto JSON",
+		CodeInvalidBody:      "cuerpo de la solicitud no válido",
+		CodePatternMismatch:  "%[1]v no coincide con el patrón requerido %[2]v",
+		CodePrefixNotAllowed: "%[1]v debe comenzar con uno de: %[2]v",
+		CodeValueNotAllowed:  "el valor de %[1]v no está permitido",
+		CodeInvalidCountry:   "%[1]v debe ser un código de país ISO 3166-1 alfa-2",
+		CodeInvalidPostal:    "%[1]v no es un código postal válido para %[2]v",
+		CodeInvalidPhone:     "%[1]v solo puede contener dígitos, espacios, paréntesis, guiones y un + inicial",
+		CodeSameAsBuyer:      "%[1]v debe ser distinto de user_id",
+	},
+	"fr": {
+		CodeRequired:         "%[1]v est obligatoire",
+		CodeTooLong:          "%[1]v doit comporter au plus %[2]v caractères",
+		CodeInvalidFormat:    "%[1]v contient des caractères non valides (seuls les caractères alphanumériques, le tiret bas et le tiret sont autorisés)",
+		CodeTooSmall:         "%[1]v doit être au moins %[2]v",
+		CodeTooLarge:         "%[1]v doit être au plus %[2]v",
+		CodeWhitespaceOnly:   "%[1]v ne peut pas être vide ou composé uniquement d'espaces",
+		CodeTooManyEntries:   "%[1]v doit comporter au plus %[2]v entrées",
+		CodeBodyTooLarge:     "le corps de la requête doit faire au plus %[2]v octets",
+		CodeBodyTooDeep:      "le corps de la requête doit comporter au plus %[2]v niveaux d'imbrication",
+		CodeBodyTruncated:    "le corps de la requête est tronqué",
+		CodeMalformedJSON:    "JSON mal formé à la position %[2]v",
+		CodeInvalidType:      "%[1]v doit être de type %[2]v",
+		CodeNotWholeNumber:   "%[1]v doit être un nombre entier dans la plage autorisée",
+		CodeUnknownField:     "champ inconnu %[1]q",
+		CodeTrailingData:     "le corps de la requête doit contenir un seul objet JSON",
+		CodeInvalidBody:      "corps de requête non valide",
+		CodePatternMismatch:  "%[1]v ne correspond pas au format requis %[2]v",
+		CodePrefixNotAllowed: "%[1]v doit commencer par l'un de : %[2]v",
+		CodeValueNotAllowed:  "la valeur de %[1]v n'est pas autorisée",
+		CodeInvalidCountry:   "%[1]v doit être un code pays ISO 3166-1 alpha-2",
+		CodeInvalidPostal:    "%[1]v n'est pas un code postal valide pour %[2]v",
+		CodeInvalidPhone:     "%[1]v ne peut contenir que des chiffres, des espaces, des parenthèses, des tirets et un + initial",
+		CodeSameAsBuyer:      "%[1]v doit être différent de user_id",
+	},
+	"de": {
+		CodeRequired:         "%[1]v ist erforderlich",
+		CodeTooLong:          "%[1]v darf höchstens %[2]v Zeichen lang sein",
+		CodeInvalidFormat:    "%[1]v enthält ungültige Zeichen (nur alphanumerische Zeichen, Unterstrich und Bindestrich erlaubt)",
+		CodeTooSmall:         "%[1]v muss mindestens %[2]v sein",
+		CodeTooLarge:         "%[1]v darf höchstens %[2]v sein",
+		CodeWhitespaceOnly:   "%[1]v darf nicht leer sein oder nur aus Leerzeichen bestehen",
+		CodeTooManyEntries:   "%[1]v darf höchstens %[2]v Einträge haben",
+		CodeBodyTooLarge:     "der Anfragetext darf höchstens %[2]v Bytes groß sein",
+		CodeBodyTooDeep:      "der Anfragetext darf höchstens %[2]v Ebenen tief verschachtelt sein",
+		CodeBodyTruncated:    "der Anfragetext ist unvollständig",
+		CodeMalformedJSON:    "fehlerhaftes JSON an Position %[2]v",
+		CodeInvalidType:      "%[1]v muss vom Typ %[2]v sein",
+		CodeNotWholeNumber:   "%[1]v muss eine ganze Zahl im gültigen Bereich sein",
+		CodeUnknownField:     "unbekanntes Feld %[1]q",
+		CodeTrailingData:     "der Anfragetext muss genau ein JSON-Objekt enthalten",
+		CodeInvalidBody:      "ungültiger Anfragetext",
+		CodePatternMismatch:  "%[1]v entspricht nicht dem erforderlichen Muster %[2]v",
+		CodePrefixNotAllowed: "%[1]v muss mit einem der folgenden Präfixe beginnen: %[2]v",
+		CodeValueNotAllowed:  "der Wert von %[1]v ist nicht erlaubt",
+		CodeInvalidCountry:   "%[1]v muss ein ISO-3166-1-Alpha-2-Ländercode sein",
+		CodeInvalidPostal:    "%[1]v ist keine gültige Postleitzahl für %[2]v",
+		CodeInvalidPhone:     "%[1]v darf nur Ziffern, Leerzeichen, Klammern, Bindestriche und ein führendes + enthalten",
+		CodeSameAsBuyer:      "%[1]v muss sich von user_id unterscheiden",
+	},
+}
+
+// errorCatalogs holds localized top-level error messages keyed by language then response error code
+var errorCatalogs = map[string]map[string]string{
+	"en": {
+		ErrCodeInvalidBody:        "Invalid request body",
+		ErrCodeValidationFailed:   "Validation failed",
+		ErrCodeRateLimited:        "Rate limit exceeded",
+		ErrCodeDuplicateRequest:   "Duplicate Request Detected",
+		ErrCodeDuplicateIntent:    "A purchase for this item is already in progress",
+		ErrCodeInternal:           "Internal server error",
+		ErrCodeServiceUnavailable: "Service temporarily unavailable",
+		ErrCodeQueueFailed:        "Failed to queue order",
+		ErrCodeQueueTimeout:       "Queueing the order timed out; check the order status",
+		ErrCodeTooManyConcurrent:  "Too many concurrent requests from this address",
+		ErrCodeRegionNotAllowed:   "Purchases are not available in your region",
+		ErrCodeRegionLimit:        "The requested amount exceeds the limit for your region",
+		ErrCodeInvalidDevice:      "Missing or invalid device token",
+		ErrCodeRiskRejected:       "The order was rejected",
+		ErrCodeSessionDenied:      "Unable to start a purchase session right now",
+		ErrCodePurchaseToken:      "Missing, expired or invalid purchase token",
+		ErrCodeNotRegistered:      "This sale requires registration before purchase",
+		ErrCodePurchaseCap:        "The requested amount exceeds your purchase limit for this item",
+		ErrCodeOrderNotFound:      "Order not found",
+		ErrCodeOrderNotAmendable:  "The order can no longer be changed",
+		ErrCodeItemBusy:           "Too many orders for this item right now; please retry shortly",
+		ErrCodeUnauthorized:       "Missing, expired or invalid user token",
+		ErrCodeForbidden:          "This token does not belong to the requested user",
+	},
+	"es": {
+		ErrCodeInvalidBody:        "Cuerpo de la solicitud no válido",
+		ErrCodeValidationFailed:   "La validación ha fallado",
+		ErrCodeRateLimited:        "Límite de solicitudes excedido",
+		ErrCodeDuplicateRequest:   "Solicitud duplicada detectada",
+		ErrCodeDuplicateIntent:    "Ya hay una compra en curso para este artículo",
+		ErrCodeInternal:           "Error interno del servidor",
+		ErrCodeServiceUnavailable: "Servicio temporalmente no disponible",
+		ErrCodeQueueFailed:        "No se pudo encolar el pedido",
+		ErrCodeQueueTimeout:       "Se agotó el tiempo al encolar el pedido; consulte el estado del pedido",
+		ErrCodeTooManyConcurrent:  "Demasiadas solicitudes simultáneas desde esta dirección",
+		ErrCodeRegionNotAllowed:   "Las compras no están disponibles en tu región",
+		ErrCodeRegionLimit:        "La cantidad solicitada supera el límite para tu región",
+		ErrCodeInvalidDevice:      "Token de dispositivo ausente o no válido",
+		ErrCodeRiskRejected:       "El pedido ha sido rechazado",
+		ErrCodeSessionDenied:      "No es posible iniciar una sesión de compra en este momento",
+		ErrCodePurchaseToken:      "Token de compra ausente, caducado o no válido",
+		ErrCodeNotRegistered:      "Esta venta requiere registrarse antes de comprar",
+		ErrCodePurchaseCap:        "La cantidad solicitada supera tu límite de compra para este artículo",
+		ErrCodeOrderNotFound:      "Pedido no encontrado",
+		ErrCodeOrderNotAmendable:  "El pedido ya no se puede modificar",
+		ErrCodeItemBusy:           "Hay demasiados pedidos para este artículo en este momento; inténtalo de nuevo en breve",
+		ErrCodeUnauthorized:       "Token de usuario ausente, caducado o no válido",
+		ErrCodeForbidden:          "Este token no pertenece al usuario solicitado",
+	},
+	"fr": {
+		ErrCodeInvalidBody:        "Corps de requête non valide",
+		ErrCodeValidationFailed:   "La validation a échoué",
+		ErrCodeRateLimited:        "Limite de requêtes dépassée",
+		ErrCodeDuplicateRequest:   "Requête en double détectée",
+		ErrCodeDuplicateIntent:    "Un achat de cet article est déjà en cours",
+		ErrCodeInternal:           "Erreur interne du serveur",
+		ErrCodeServiceUnavailable: "Service temporairement indisponible",
+		ErrCodeQueueFailed:        "Impossible de mettre la commande en file d'attente",
+		ErrCodeQueueTimeout:       "Délai dépassé lors de la mise en file d'attente; vérifiez le statut de la commande",
+		ErrCodeTooManyConcurrent:  "Trop de requêtes simultanées depuis cette adresse",
+		ErrCodeRegionNotAllowed:   "Les achats ne sont pas disponibles dans votre région",
+		ErrCodeRegionLimit:        "La quantité demandée dépasse la limite pour votre région",
+		ErrCodeInvalidDevice:      "Jeton d'appareil manquant ou non valide",
+		ErrCodeRiskRejected:       "La commande a été refusée",
+		ErrCodeSessionDenied:      "Impossible de démarrer une session d'achat pour le moment",
+		ErrCodePurchaseToken:      "Jeton d'achat manquant, expiré ou non valide",
+		ErrCodeNotRegistered:      "Cette vente nécessite une inscription préalable",
+		ErrCodePurchaseCap:        "La quantité demandée dépasse votre limite d'achat pour cet article",
+		ErrCodeOrderNotFound:      "Commande introuvable",
+		ErrCodeOrderNotAmendable:  "La commande ne peut plus être modifiée",
+		ErrCodeItemBusy:           "Trop de commandes pour cet article en ce moment; réessayez dans un instant",
+		ErrCodeUnauthorized:       "Jeton utilisateur manquant, expiré ou non valide",
+		ErrCodeForbidden:          "Ce jeton n'appartient pas à l'utilisateur demandé",
+	},
+	"de": {
+		ErrCodeInvalidBody:        "Ungültiger Anfragetext",
+		ErrCodeValidationFailed:   "Validierung fehlgeschlagen",
+		ErrCodeRateLimited:        "Anfragelimit überschritten",
+		ErrCodeDuplicateRequest:   "Doppelte Anfrage erkannt",
+		ErrCodeDuplicateIntent:    "Für diesen Artikel läuft bereits ein Kauf",
+		ErrCodeInternal:           "Interner Serverfehler",
+		ErrCodeServiceUnavailable: "Dienst vorübergehend nicht verfügbar",
+		ErrCodeQueueFailed:        "Bestellung konnte nicht eingereiht werden",
+		ErrCodeQueueTimeout:       "Zeitüberschreitung beim Einreihen der Bestellung; Bestellstatus prüfen",
+		ErrCodeTooManyConcurrent:  "Zu viele gleichzeitige Anfragen von dieser Adresse",
+		ErrCodeRegionNotAllowed:   "Käufe sind in Ihrer Region nicht verfügbar",
+		ErrCodeRegionLimit:        "Die angeforderte Menge überschreitet das Limit für Ihre Region",
+		ErrCodeInvalidDevice:      "Gerätetoken fehlt oder ist ungültig",
+		ErrCodeRiskRejected:       "Die Bestellung wurde abgelehnt",
+		ErrCodeSessionDenied:      "Eine Kaufsitzung kann derzeit nicht gestartet werden",
+		ErrCodePurchaseToken:      "Kauftoken fehlt, ist abgelaufen oder ungültig",
+		ErrCodeNotRegistered:      "Für diesen Verkauf ist eine vorherige Registrierung erforderlich",
+		ErrCodePurchaseCap:        "Die angeforderte Menge überschreitet dein Kauflimit für diesen Artikel",
+		ErrCodeOrderNotFound:      "Bestellung nicht gefunden",
+		ErrCodeOrderNotAmendable:  "Die Bestellung kann nicht mehr geändert werden",
+		ErrCodeItemBusy:           "Gerade gehen zu viele Bestellungen für diesen Artikel ein; bitte gleich erneut versuchen",
+		ErrCodeUnauthorized:       "Benutzertoken fehlt, ist abgelaufen oder ungültig",
+		ErrCodeForbidden:          "Dieses Token gehört nicht zum angeforderten Benutzer",
+	},
+}
+
+// NegotiateLanguage picks the best supported language from an Accept-Language header
+// Honors q-values and falls back from regional tags (fr-CH) to the base language (fr)
+// Returns defaultLanguage when nothing matches
+func NegotiateLanguage(acceptLanguage string) string {
+	type candidate struct {
+		tag     string
+		quality float64
+	}
+
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		tag, quality := part, 1.0
+		if i := strings.Index(part, ";"); i >= 0 {
+			tag = strings.TrimSpace(part[:i])
+			if q := strings.TrimSpace(part[i+1:]); strings.HasPrefix(q, "q=") {
+				if parsed, err := strconv.ParseFloat(q[2:], 64); err == nil {
+					quality = parsed
+				}
+			}
+		}
+		if quality <= 0 {
+			continue
+		}
+		candidates = append(candidates, candidate{tag: strings.ToLower(tag), quality: quality})
+	}
+
+	// Stable sort keeps header order for equal q-values
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].quality > candidates[j].quality
+	})
+
+	for _, c := range candidates {
+		base := c.tag
+		if i := strings.Index(base, "-"); i >= 0 {
+			base = base[:i]
+		}
+		if _, ok := errorCatalogs[base]; ok {
+			return base
+		}
+	}
+	return defaultLanguage
+}
+
+// LocalizeValidationErrors returns a copy of errs with messages rendered in lang
+// Errors without a catalog entry (e.g. deployment-specific overrides) keep their original message
+func LocalizeValidationErrors(errs []ValidationError, lang string) []ValidationError {
+	catalog, ok := validationCatalogs[lang]
+	if !ok {
+		return errs
+	}
+
+	localized := make([]ValidationError, len(errs))
+	for i, e := range errs {
+		localized[i] = e
+		if tmpl, ok := catalog[e.Code]; ok {
+			args := append([]interface{}{e.Field}, e.Params...)
+			localized[i].Message = fmt.Sprintf(tmpl, args...)
+		}
+	}
+	return localized
+}
+
+// localizedErrorMessage returns the human-readable message for a response error code
+func localizedErrorMessage(code string, lang string) string {
+	if msg, ok := errorCatalogs[lang][code]; ok {
+		return msg
+	}
+	return errorCatalogs[defaultLanguage][code]
+}
+
+// writeError writes a JSON error response with a stable code and a message localized
+// according to the request's Accept-Language header
+// extra fields (validation errors, retry hints) are merged into the response body
+func writeError(w http.ResponseWriter, r *http.Request, status int, code string, correlationID string, extra map[string]interface{}) {
+	lang := NegotiateLanguage(r.Header.Get("Accept-Language"))
+
+	body := map[string]interface{}{
+		"error":          localizedErrorMessage(code, lang),
+		"code":           code,
+		"correlation_id": correlationID,
+	}
+	for k, v := range extra {
+		if errs, ok := v.([]ValidationError); ok {
+			v = LocalizeValidationErrors(errs, lang)
+		}
+		body[k] = v
+	}
+
+	w.Header().Set("Content-Language", lang)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// drainReportInterval is how often the remaining /buy requests are logged while draining
+const drainReportInterval = 5 * time.Second
+
+// BuyTracker tracks in-flight /buy requests so shutdown can wait for them
+// Once draining, new orders are refused while the ones already accepted run to completion
+type BuyTracker struct {
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	draining bool
+	requests map[string]time.Time // correlation ID -> start
+}
+
+// NewBuyTracker creates an empty tracker
+func NewBuyTracker() *BuyTracker {
+	return &BuyTracker{requests: make(map[string]time.Time)}
+}
+
+// Begin registers a request; false means the gateway is draining and the order must be refused
+// Every successful Begin must be paired with End
+func (t *BuyTracker) Begin(correlationID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return false
+	}
+	t.requests[correlationID] = time.Now()
+	t.wg.Add(1)
+	metrics.BuyRequestsInFlight.Inc()
+	return true
+}
+
+// End unregisters a request started with Begin
+func (t *BuyTracker) End(correlationID string) {
+	t.mu.Lock()
+	delete(t.requests, correlationID)
+	t.mu.Unlock()
+	metrics.BuyRequestsInFlight.Dec()
+	t.wg.Done()
+}
+
+// InFlight returns the number of requests still running
+func (t *BuyTracker) InFlight() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.requests)
+}
+
+// Drain refuses new orders and waits for the in-flight ones until ctx is done, logging the
+// remaining count as it goes; requests still running at the deadline are logged one by one
+// with their correlation IDs and ctx's error is returned
+func (t *BuyTracker) Drain(ctx context.Context, logger *logrus.Logger) error {
+	t.mu.Lock()
+	t.draining = true
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+	logger.WithFields(logrus.Fields{
+		"event":     "buy_drain_started",
+		"in_flight": t.InFlight(),
+	}).Info("Refusing new orders, draining in-flight /buy requests")
+
+	ticker := time.NewTicker(drainReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			logger.WithField("event", "buy_drain_complete").Info("All in-flight /buy requests finished")
+			return nil
+		case <-ticker.C:
+			logger.WithFields(logrus.Fields{
+				"event":     "buy_drain_progress",
+				"in_flight": t.InFlight(),
+			}).Info("Still draining /buy requests")
+		case <-ctx.Done():
+			t.logAbandoned(logger)
+			return ctx.Err()
+		}
+	}
+}
+
+// logAbandoned logs each request still running, oldest first
+func (t *BuyTracker) logAbandoned(logger *logrus.Logger) {
+	type abandoned struct {
+		correlationID string
+		started       time.Time
+	}
+	t.mu.Lock()
+	remaining := make([]abandoned, 0, len(t.requests))
+	for id, started := range t.requests {
+		remaining = append(remaining, abandoned{id, started})
+	}
+	t.mu.Unlock()
+	sort.Slice(remaining, func(i, j int) bool { return remaining[i].started.Before(remaining[j].started) })
+
+	now := time.Now()
+	for _, req := range remaining {
+		logger.WithFields(logrus.Fields{
+			"event":          "buy_request_abandoned",
+			"correlation_id": req.correlationID,
+			"running_ms":     now.Sub(req.started).Milliseconds(),
+		}).Error("In-flight /buy request abandoned at the shutdown deadline")
+	}
+	logger.WithFields(logrus.Fields{
+		"event":     "buy_drain_incomplete",
+		"abandoned": len(remaining),
+	}).Error("Shutdown deadline reached before the /buy drain finished")
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// ipRateLimitWindow is the per-IP rate limit window, reported to clients as retry_after_seconds
+var ipRateLimitWindow time.Duration
+
+// IPConcurrencyLimiter caps in-flight requests per client IP on this gateway instance
+// Bots rotate user_id freely, but holding many slow requests open still needs many addresses
+type IPConcurrencyLimiter struct {
+	mu       sync.Mutex
+	inFlight map[string]int
+	max      int
+}
+
+// NewIPConcurrencyLimiter creates a limiter allowing max concurrent requests per IP
+func NewIPConcurrencyLimiter(max int) *IPConcurrencyLimiter {
+	return &IPConcurrencyLimiter{inFlight: make(map[string]int), max: max}
+}
+
+// Acquire reserves a slot for ip; callers must Release it when the request completes
+// Returns false if ip already has max requests in flight
+func (l *IPConcurrencyLimiter) Acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[ip] >= l.max {
+		return false
+	}
+	l.inFlight[ip]++
+	return true
+}
+
+// Release frees a slot acquired for ip
+func (l *IPConcurrencyLimiter) Release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[ip] <= 1 {
+		delete(l.inFlight, ip)
+		return
+	}
+	l.inFlight[ip]--
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// itemRateKeyPrefix starts the admission counters of an item: item_admission:{item_id}, a hash
+// of unix second -> orders admitted in that second
+const itemRateKeyPrefix = "item_admission:"
+
+// itemRateScript admits one order if the item's sliding one-second count stays within the limit
+// The count is the current second's counter plus the previous second's weighted by how much of
+// it still falls in the last second. Time comes from Redis so gateway clock skew doesn't split
+// the window. The counters are fields of the one declared key, so the script also runs on
+// Redis Cluster; fields older than the previous second are dropped as new ones are written
+// KEYS[1] = item_admission:{item_id}; ARGV[1] = limit, ARGV[2] = 1 to count the order, 0 to peek
+// Returns {admitted (1/0), second counted in, sliding count before this order}
+var itemRateScript = redis.NewScript(`
+local now = redis.call('TIME')
+local second = tonumber(now[1])
+local elapsed = tonumber(now[2]) / 1000000
+local current = tonumber(redis.call('HGET', KEYS[1], second) or '0')
+local previous = tonumber(redis.call('HGET', KEYS[1], second - 1) or '0')
+local count = math.floor(previous * (1 - elapsed) + current)
+if count + 1 > tonumber(ARGV[1]) then
+    return {0, second, count}
+end
+if ARGV[2] == '1' then
+    redis.call('HINCRBY', KEYS[1], second, 1)
+    for _, field in ipairs(redis.call('HKEYS', KEYS[1])) do
+        if tonumber(field) < second - 1 then
+            redis.call('HDEL', KEYS[1], field)
+        end
+    end
+    redis.call('EXPIRE', KEYS[1], 3)
+end
+return {1, second, count}
+`)
+
+// ItemRateLimiter caps the orders admitted per item per second across every gateway replica
+// (ITEM_ADMISSION_RATE, overridden per item by ITEM_ADMISSION_RATE_ITEMS), so scaling the gateway
+// out doesn't multiply the rate the processor fleet was sized for
+// Counters live in Redis; on Redis errors orders are admitted, like the rate limiter
+type ItemRateLimiter struct {
+	redisClient *redis.Client
+	rate        int64
+	itemRates   map[string]int64
+}
+
+// NewItemRateLimiter creates a limiter admitting rate orders per second per item; 0 disables it
+// for items without an override
+func NewItemRateLimiter(redisClient *redis.Client, rate int64, itemRates map[string]int64) *ItemRateLimiter {
+	return &ItemRateLimiter{redisClient: redisClient, rate: rate, itemRates: itemRates}
+}
+
+// Enabled reports whether any item is limited
+func (l *ItemRateLimiter) Enabled() bool {
+	if l == nil {
+		return false
+	}
+	if l.rate > 0 {
+		return true
+	}
+	for _, rate := range l.itemRates {
+		if rate > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// RateFor returns itemID's orders per second; 0 means unlimited
+func (l *ItemRateLimiter) RateFor(itemID string) int64 {
+	if rate, ok := l.itemRates[itemID]; ok {
+		return rate
+	}
+	return l.rate
+}
+
+// Admit counts an order for itemID if the item is within its rate
+// Returns whether it was admitted, the sliding count it saw and the second it was counted in,
+// which Release needs
+func (l *ItemRateLimiter) Admit(ctx context.Context, itemID string) (bool, int64, int64, error) {
+	return l.run(ctx, itemID, true)
+}
+
+// Peek reports whether an order for itemID would be admitted without counting it
+func (l *ItemRateLimiter) Peek(ctx context.Context, itemID string) (bool, int64, int64, error) {
+	return l.run(ctx, itemID, false)
+}
+
+func (l *ItemRateLimiter) run(ctx context.Context, itemID string, count bool) (bool, int64, int64, error) {
+	rate := l.RateFor(itemID)
+	if rate <= 0 {
+		return true, 0, 0, nil
+	}
+	mode := "0"
+	if count {
+		mode = "1"
+	}
+	values, err := itemRateScript.Run(ctx, l.redisClient, []string{itemRateKeyPrefix + itemID}, rate, mode).Int64Slice()
+	if err != nil {
+		return true, 0, 0, err
+	}
+	if len(values) != 3 {
+		return true, 0, 0, fmt.Errorf("unexpected item admission reply %v", values)
+	}
+	return values[0] == 1, values[2], values[1], nil
+}
+
+// Release gives back an admitted order's slot when the order isn't queued after all
+// Slots of past seconds age out on their own; only a slot still counting is decremented
+func (l *ItemRateLimiter) Release(ctx context.Context, itemID string, second int64) error {
+	if second == 0 || time.Now().Unix()-second > 1 {
+		return nil
+	}
+	return l.redisClient.HIncrBy(ctx, itemRateKeyPrefix+itemID, strconv.FormatInt(second, 10), -1).Err()
+}
+
+// ParseItemRates parses ITEM_ADMISSION_RATE_ITEMS: comma-separated item_id:orders_per_second
+func ParseItemRates(value string) (map[string]int64, error) {
+	rates := make(map[string]int64)
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		itemID, rateValue, ok := strings.Cut(pair, ":")
+		itemID = strings.TrimSpace(itemID)
+		if !ok || itemID == "" {
+			return nil, fmt.Errorf("invalid item admission rate %q, expected item_id:rate", pair)
+		}
+		rate, err := strconv.ParseInt(strings.TrimSpace(rateValue), 10, 64)
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("invalid item admission rate %q, rate must be a non-negative integer", pair)
+		}
+		rates[itemID] = rate
+	}
+	return rates, nil
+}
+
+// itemRatePolicy rejects orders beyond their item's fleet-wide admission rate with 429
+// Runs last by default so orders rejected by other policies don't use up the item's rate
+type itemRatePolicy struct{}
+
+func (itemRatePolicy) Name() string  { return "item_rate" }
+func (itemRatePolicy) Enabled() bool { return itemRateLimiter.Enabled() }
+
+func (itemRatePolicy) Admit(ctx context.Context, req *AdmissionRequest) *AdmissionRejection {
+	order := req.Order
+	admit := itemRateLimiter.Admit
+	if req.DryRun {
+		admit = itemRateLimiter.Peek
+	}
+	admitted, count, second, err := admit(ctx, order.ItemID)
+	if err != nil {
+		req.count(metrics.ItemAdmissionRate.WithLabelValues("error"))
+		if !budgetExceeded(ctx, BudgetStageAdmission, err) {
+			redisHealth.Observe(err)
+		}
+		req.Log.WithError(err).Warn("Item admission rate check failed, allowing request")
+		return nil
+	}
+	if !admitted {
+		req.count(metrics.ItemAdmissionRate.WithLabelValues("rejected"))
+		req.count(metrics.OrdersFailed)
+		req.Log.WithFields(map[string]interface{}{
+			"event":      "item_admission_rate_exceeded",
+			"item_rate":  itemRateLimiter.RateFor(order.ItemID),
+			"item_count": count,
+		}).Warn("Item admission rate exceeded")
+		return &AdmissionRejection{Status: http.StatusTooManyRequests, Code: ErrCodeItemBusy, RetryAfter: time.Second, Details: map[string]interface{}{
+			"retry_after_seconds": 1,
+		}}
+	}
+	req.count(metrics.ItemAdmissionRate.WithLabelValues("admitted"))
+	if second != 0 && !req.DryRun {
+		log := req.Log
+		req.OnRollback(func(ctx context.Context) {
+			if err := itemRateLimiter.Release(ctx, order.ItemID, second); err != nil {
+				log.WithError(err).Warn("Failed to release item admission slot")
+			}
+		})
+	}
+	return nil
+}
@@ -3,56 +3,132 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/IBM/sarama"
 	"github.com/google/uuid"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
+	"github.com/sony/gobreaker"
 	"github.com/yourname/flash-sale-engine/common"
+	"github.com/yourname/flash-sale-engine/common/app"
 )
 
 var (
-	redisClient *redis.Client
-	producer    *CircuitBreaker
-	rateLimiter *RateLimiter
-	logger      *logrus.Logger
-	metrics     *common.GatewayMetrics
-	ctx         = context.Background()
+	redisClient         *redis.Client
+	redisRouter         *RedisRouter
+	statusStore         *OrderStatusStore
+	producer            *CircuitBreaker
+	rateLimiter         RateLimiter
+	ipRateLimiter       RateLimiter                 // nil unless IP_RATE_LIMIT_MAX_REQUESTS > 0
+	ipConcurrency       *IPConcurrencyLimiter       // nil unless IP_MAX_CONCURRENT_REQUESTS > 0
+	geoAdmission        *GeoAdmission               // nil unless GEOIP_RULES_FILE is set
+	deviceTokens        *DeviceTokenVerifier        // nil unless DEVICE_TOKEN_SECRET is set
+	purchaseTokens      *PurchaseTokenIssuer        // nil unless PURCHASE_TOKEN_SECRET is set
+	rateLimitExemptions *common.RateLimitExemptions // nil unless RATE_LIMIT_EXEMPTION_SECRET is set
+	intents             *DuplicateIntentDetector
+	purchaseAdmission   *PurchaseAdmission
+	itemRateLimiter     *ItemRateLimiter
+	orderKeyer          *OrderKeyer
+	outageBuffer        *OutageBuffer         // nil unless OUTAGE_BUFFER_ENABLED
+	campaignRouter      *CampaignRouter       // nil unless CAMPAIGN_TOPICS_ENABLED
+	payloadCipher       *common.PayloadCipher // nil unless payload encryption keys are configured
+	signer              *common.MessageSigner // nil unless MESSAGE_SIGNING_KEYS is set
+	redisHealth         *common.RedisDegradation
+	adminAuth           *common.AdminAuth // nil unless ADMIN_TOKEN_SECRET is set
+	buyTracker          = NewBuyTracker()
+	logger              *logrus.Logger
+	metrics             *common.GatewayMetrics
+	ctx                 = context.Background()
+
+	// generateRequestIDs enables server-side request_id generation when clients omit it
+	generateRequestIDs bool
+
+	// deviceTokenRequired rejects orders without a valid device token
+	deviceTokenRequired bool
+
+	// purchaseTokenRequired rejects /buy requests without a purchase token from /session
+	purchaseTokenRequired bool
+
+	// riskBlockThreshold is the risk score at or above which orders are rejected
+	riskBlockThreshold float64
 )
 
 type OrderRequest struct {
 	UserID    string `json:"user_id"`
 	ItemID    string `json:"item_id"`
-	Amount    int    `json:"amount"`
+	Amount    int64  `json:"amount"`     // Quantity; int64 so fractional or overflowing JSON numbers fail at decode time
 	RequestID string `json:"request_id"` // Unique request identifier for idempotency checks
+	Channel   string `json:"channel"`    // Order source (web, app, partner-api); set from the device token
+
+	// RecipientUserID makes the order a gift: rate limits and purchase caps apply to UserID (the
+	// buyer), the item is granted to the recipient
+	RecipientUserID string `json:"recipient_user_id,omitempty"`
+
+	// Address is the optional shipping address, sanitized and validated by the gateway
+	Address *common.ShippingAddress `json:"address,omitempty"`
+
+	// DeviceID comes from the verified device token, never from the request body
+	DeviceID string `json:"device_id,omitempty"`
+
+	// Metadata is an optional, size-limited passthrough map (cart IDs, campaign tags, ...)
+	// Carried through Kafka and echoed back to the client without interpretation
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Lines makes the order a cart of several items (CART_MAX_LINES); the first line is also
+	// the order's item_id and amount, which route, key and rate limit it
+	Lines []common.CartLine `json:"lines,omitempty"`
+	// CartPolicy is what the processor does when only some lines can be reserved (see cart.go)
+	CartPolicy string `json:"cart_policy,omitempty"`
 }
 
 func main() {
-	// Initialize structured logger with service name
-	logger = common.InitLogger("gateway")
-	logger.Info("Gateway starting...")
+	a := app.New("gateway", gatewayConfig)
+	bootstrapOnly := flag.Bool("bootstrap-topics", false, "Create required Kafka topics and exit")
+	issueUserToken := flag.String("issue-user-token", "", "Print a user token for this user_id and exit (uses USER_TOKEN_SECRET)")
+	userTokenTTL := flag.Duration("user-token-ttl", time.Hour, "Lifetime of the token printed by -issue-user-token")
+	a.Parse()
 
-	// Get service addresses from environment or use defaults
-	redisAddr := os.Getenv("REDIS_ADDR")
-	if redisAddr == "" {
-		redisAddr = "redis-service:6379" // Default for k8s
+	if *issueUserToken != "" {
+		verifier, err := NewUserTokenVerifier(os.Getenv("USER_TOKEN_SECRET"))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(verifier.Issue(*issueUserToken, *userTokenTTL))
+		return
 	}
 
-	kafkaAddr := os.Getenv("KAFKA_ADDR")
-	if kafkaAddr == "" {
-		kafkaAddr = "kafka-service:9092" // Default for k8s
+	// Logger, build info, startup configuration (GET /admin/config) and signal handling
+	a.Start()
+	logger = a.Logger
+	startupConfig = a.Config
+
+	// Initialize Prometheus metrics before anything that records them (HTTP clients)
+	metrics = common.InitGatewayMetrics()
+	a.ConfigureItemLabels(metrics.ItemLabels)
+	a.ConfigureCampaignLabels(metrics.Orders.Campaigns)
+
+	// Create required Kafka topics with configured partitions/retention instead of relying on
+	// broker auto-create defaults (KAFKA_TOPIC_BOOTSTRAP=true, or run once with -bootstrap-topics)
+	if *bootstrapOnly || getEnvBool("KAFKA_TOPIC_BOOTSTRAP", false) {
+		a.BootstrapTopics()
+		if *bootstrapOnly {
+			logger.Info("Kafka topics bootstrapped")
+			return
+		}
 	}
 
 	// 1. Connect to Redis
-	redisClient = redis.NewClient(&redis.Options{
-		Addr: redisAddr,
-	})
+	redisClient = a.NewRedisClient(metrics.Redis)
 
 	// Test Redis connection
 	ctx := context.Background()
@@ -61,239 +137,1005 @@ func main() {
 	}
 	logger.Info("Connected to Redis")
 
+	// Optional Redis replicas for read-heavy endpoints (REDIS_REPLICA_ADDRS, comma-separated)
+	// Replicas lagging beyond REDIS_REPLICA_MAX_LAG (default: 5s) are skipped; reads fall back to the primary
+	var replicaClients []*redis.Client
+	for _, replicaAddr := range strings.Split(os.Getenv("REDIS_REPLICA_ADDRS"), ",") {
+		if replicaAddr = strings.TrimSpace(replicaAddr); replicaAddr != "" {
+			replica := redis.NewClient(&redis.Options{Addr: replicaAddr, ContextTimeoutEnabled: true})
+			common.InstrumentRedis(replica, metrics.Redis, "replica", logger)
+			replicaClients = append(replicaClients, replica)
+			a.OnShutdown("Redis replica client", func(context.Context) error { return replica.Close() })
+		}
+	}
+	redisRouter = NewRedisRouter(redisClient, replicaClients, getEnvDuration("REDIS_REPLICA_MAX_LAG", 5*time.Second))
+	// Background loops (replica lag, outage buffer, campaign routes, waitlist) stop on shutdown
+	monitorCtx, stopMonitor := context.WithCancel(context.Background())
+	a.OnShutdown("background loops", func(context.Context) error {
+		stopMonitor()
+		return nil
+	})
+	go redisRouter.MonitorLag(monitorCtx, getEnvDuration("REDIS_REPLICA_CHECK_INTERVAL", 1*time.Second))
+
+	// STATUS_READ_CONSISTENCY (eventual|read_your_writes|wait, default: eventual) controls stale-read protection
+	statusStore = NewOrderStatusStore(
+		redisRouter,
+		os.Getenv("STATUS_READ_CONSISTENCY"),
+		getEnvDuration("STATUS_RYW_WINDOW", 30*time.Second),
+		getEnvInt("STATUS_WAIT_REPLICAS", 1),
+		getEnvDuration("STATUS_WAIT_TIMEOUT", 100*time.Millisecond),
+	)
+	logger.WithFields(map[string]interface{}{
+		"replicas":    len(replicaClients),
+		"consistency": statusStore.Consistency(),
+	}).Info("Order status store initialized")
+
 	// 2. Connect to Kafka with Circuit Breaker
-	config := sarama.NewConfig()
+	config := a.KafkaConfig()
 	config.Producer.Return.Successes = true
-	rawProducer, err := sarama.NewSyncProducer([]string{kafkaAddr}, config)
+	// Brokers give up waiting for acks within the send timeout, so an abandoned send ends soon after it
+	config.Producer.Timeout = getEnvDuration("KAFKA_SEND_TIMEOUT", defaultSendTimeout)
+	config.Producer.MaxMessageBytes = getEnvInt("KAFKA_MAX_MESSAGE_BYTES", config.Producer.MaxMessageBytes)
+	// KAFKA_COMPRESSION (default: none) applies to both producer modes
+	compression, err := producerCompression()
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid Kafka producer configuration")
+	}
+	config.Producer.Compression = compression
+	// KAFKA_PRODUCER_MODE=async (default: sync) batches orders of concurrent requests into shared
+	// produce requests (KAFKA_BATCH_LINGER, KAFKA_BATCH_MAX_MESSAGES, KAFKA_BATCH_MAX_BYTES)
+	producerMode := os.Getenv("KAFKA_PRODUCER_MODE")
+	if producerMode == "" {
+		producerMode = ProducerModeSync
+	}
+	if producerMode == ProducerModeAsync {
+		configureProducerBatching(config)
+	}
+	kafkaClient, err := sarama.NewClient([]string{a.KafkaAddr}, config)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to connect to Kafka")
+	}
+	a.OnShutdown("Kafka client", func(context.Context) error { return kafkaClient.Close() })
+	var rawProducer messageSender
+	if producerMode == ProducerModeAsync {
+		rawProducer, err = newBatchingProducer(kafkaClient)
+	} else {
+		rawProducer, err = sarama.NewSyncProducerFromClient(kafkaClient)
+	}
 	if err != nil {
 		logger.WithError(err).Fatal("Failed to start Kafka producer")
 	}
+	logger.WithFields(map[string]interface{}{
+		"mode":        producerMode,
+		"compression": config.Producer.Compression.String(),
+	}).Info("Kafka producer started")
 
-	// Wrap producer with circuit breaker
-	producer = NewCircuitBreaker(rawProducer)
-	logger.Info("Kafka producer initialized with circuit breaker")
+	// Wrap producer with circuit breaker (client enables metadata probes in half-open state)
+	producer = NewCircuitBreaker(rawProducer, kafkaClient)
+	a.OnShutdown("Kafka producer", func(context.Context) error { return producer.Close() })
+	// Kafka counts as down while the circuit is open, unless orders are buffered meanwhile, and as
+	// degraded while it probes recovery; /health also reports replica and breaker state
+	a.Health.Register("kafka", func(context.Context) error {
+		switch producer.State() {
+		case gobreaker.StateOpen:
+			if outageBuffer != nil {
+				return app.Degraded("circuit breaker open, orders buffered")
+			}
+			return errors.New("circuit breaker open")
+		case gobreaker.StateHalfOpen:
+			return app.Degraded("circuit breaker half-open, probing recovery")
+		}
+		return nil
+	})
+	// Reads fall back to the primary without healthy replicas, which still serves everything
+	if redisRouter.HasReplicas() {
+		a.Health.Register("redis_replicas", func(context.Context) error {
+			if healthy := redisRouter.HealthyReplicas(); healthy < redisRouter.Replicas() {
+				return app.Degraded(fmt.Sprintf("%d of %d replicas healthy, reads served by the rest", healthy, redisRouter.Replicas()))
+			}
+			return nil
+		})
+	}
+	a.Health.Detail("redis_healthy_replicas", func() interface{} { return redisRouter.HealthyReplicas() })
+	a.Health.Detail("circuit_breaker_state", func() interface{} { return producer.State().String() })
+	logger.WithField("probe_mode", producer.ProbeMode()).Info("Kafka producer initialized with circuit breaker")
 
 	// Initialize rate limiter
-	// Configurable via environment: RATE_LIMIT_MAX_REQUESTS (default: 60), RATE_LIMIT_WINDOW (default: 1m)
+	// Configurable via environment: RATE_LIMIT_MAX_REQUESTS (default: 60), RATE_LIMIT_WINDOW (default: 1m),
+	// RATE_LIMIT_BACKEND (redis|memcached|memory, default: redis), MEMCACHED_ADDRS (comma-separated)
 	maxRequests := getEnvInt("RATE_LIMIT_MAX_REQUESTS", 60)
 	windowSize := getEnvDuration("RATE_LIMIT_WINDOW", 1*time.Minute)
-	rateLimiter = NewRateLimiter(redisClient, maxRequests, windowSize)
+	var memcachedAddrs []string
+	for _, addr := range strings.Split(os.Getenv("MEMCACHED_ADDRS"), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			memcachedAddrs = append(memcachedAddrs, addr)
+		}
+	}
+	rateLimitBackend := os.Getenv("RATE_LIMIT_BACKEND")
+	if rateLimitBackend == "" {
+		rateLimitBackend = RateLimitBackendRedis
+	}
+	rateLimiter, err = NewRateLimiter(RateLimitPolicyUser, rateLimitBackend, redisClient, memcachedAddrs, maxRequests, windowSize)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to initialize rate limiter")
+	}
+	rateLimitWindow = windowSize
+	buyRequestTimeout = getEnvDuration("BUY_REQUEST_TIMEOUT", 30*time.Second)
 	logger.WithFields(map[string]interface{}{
+		"backend":      rateLimitBackend,
 		"max_requests": maxRequests,
 		"window_size":  windowSize.String(),
 	}).Info("Rate limiter initialized")
 
-	// Initialize Prometheus metrics
-	metrics = common.InitGatewayMetrics()
+	// Exemption tokens issued through the processor admin API bypass the per-user limit and are
+	// counted against their own quota instead (RATE_LIMIT_EXEMPTION_SECRET, optional)
+	if secret := os.Getenv("RATE_LIMIT_EXEMPTION_SECRET"); secret != "" {
+		rateLimitExemptions, err = common.NewRateLimitExemptions(secret, redisClient)
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid RATE_LIMIT_EXEMPTION_SECRET")
+		}
+		logger.Info("Rate limit exemption tokens enabled")
+	}
 
-	http.HandleFunc("/buy", handleBuy)
-	http.HandleFunc("/health", handleHealth)
-	http.Handle("/metrics", promhttp.Handler()) // Prometheus metrics endpoint
+	// Per-IP limits, since user_id comes from the request body and is trivially rotated
+	// Configurable via environment: IP_RATE_LIMIT_MAX_REQUESTS (default: 0, disabled), IP_RATE_LIMIT_WINDOW
+	// (default: RATE_LIMIT_WINDOW), IP_MAX_CONCURRENT_REQUESTS (default: 0, disabled) and
+	// IP_FORWARDED_HOPS (proxies setting X-Forwarded-For when TRUSTED_PROXIES is unset, default: 0)
+	forwardedHops = getEnvInt("IP_FORWARDED_HOPS", 0)
+	ipRateLimitWindow = getEnvDuration("IP_RATE_LIMIT_WINDOW", windowSize)
+	if ipMaxRequests := getEnvInt("IP_RATE_LIMIT_MAX_REQUESTS", 0); ipMaxRequests > 0 {
+		ipRateLimiter, err = NewRateLimiter(RateLimitPolicyIP, rateLimitBackend, redisClient, memcachedAddrs, ipMaxRequests, ipRateLimitWindow)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to initialize IP rate limiter")
+		}
+	}
+	if maxConcurrent := getEnvInt("IP_MAX_CONCURRENT_REQUESTS", 0); maxConcurrent > 0 {
+		ipConcurrency = NewIPConcurrencyLimiter(maxConcurrent)
+	}
+	logger.WithFields(map[string]interface{}{
+		"ip_rate_limit":      ipRateLimiter != nil,
+		"ip_max_concurrent":  getEnvInt("IP_MAX_CONCURRENT_REQUESTS", 0),
+		"forwarded_for_hops": forwardedHops,
+	}).Info("Per-IP limits initialized")
 
-	// Setup graceful shutdown
-	server := &http.Server{
-		Addr:    ":8080",
-		Handler: nil,
+	// Client address resolution behind load balancers
+	// Configurable via environment: TRUSTED_PROXIES (comma-separated CIDRs, default: none),
+	// PROXY_PROTOCOL (accept PROXY protocol headers from trusted proxies, default: false)
+	trustedProxies, err = ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid TRUSTED_PROXIES")
+	}
+	proxyProtocol := getEnvBool("PROXY_PROTOCOL", false)
+	if proxyProtocol && len(trustedProxies) == 0 {
+		logger.Fatal("PROXY_PROTOCOL requires TRUSTED_PROXIES")
+	}
+	logger.WithFields(map[string]interface{}{
+		"trusted_proxies": len(trustedProxies),
+		"proxy_protocol":  proxyProtocol,
+	}).Info("Client IP resolution initialized")
+
+	// Initialize duplicate-intent detection (same user+item within a window, regardless of request_id)
+	// Configurable via environment: DUPLICATE_INTENT_MODE (off|flag|block, default: off), DUPLICATE_INTENT_WINDOW (default: 5m)
+	intents = NewDuplicateIntentDetector(redisClient, statusStore, os.Getenv("DUPLICATE_INTENT_MODE"), getEnvDuration("DUPLICATE_INTENT_WINDOW", 5*time.Minute))
+	logger.WithField("mode", intents.Mode()).Info("Duplicate-intent detection initialized")
+
+	// Campaign pre-registration and per-user purchase caps
+	// Configurable via environment: REGISTRATION_ITEMS (comma-separated item IDs or "*"),
+	// PURCHASE_CAP_PER_USER (units per user per item, default: 0 = unlimited), PURCHASE_CAP_ITEMS
+	// (item_id:cap overrides), PURCHASE_CAP_WINDOW (default: 24h); the processor reads the same caps
+	var registrationItems []string
+	for _, itemID := range strings.Split(os.Getenv("REGISTRATION_ITEMS"), ",") {
+		if itemID = strings.TrimSpace(itemID); itemID != "" {
+			registrationItems = append(registrationItems, itemID)
+		}
+	}
+	purchaseCaps, err := common.LoadPurchaseCaps()
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid PURCHASE_CAP_ITEMS")
+	}
+	purchaseAdmission = NewPurchaseAdmission(redisRouter, registrationItems, purchaseCaps)
+	logger.WithFields(map[string]interface{}{
+		"registration_items": registrationItems,
+		"cap_per_user":       purchaseCaps.PerUser,
+		"item_caps":          purchaseCaps.Items,
+	}).Info("Purchase admission initialized")
+
+	// Fleet-wide admission rate per item, counted in Redis so every gateway replica shares it
+	// Configurable via environment: ITEM_ADMISSION_RATE (orders per second per item, default: 0 =
+	// unlimited), ITEM_ADMISSION_RATE_ITEMS (item_id:rate overrides)
+	itemRates, err := ParseItemRates(os.Getenv("ITEM_ADMISSION_RATE_ITEMS"))
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid ITEM_ADMISSION_RATE_ITEMS")
+	}
+	itemRateLimiter = NewItemRateLimiter(redisClient, int64(getEnvInt("ITEM_ADMISSION_RATE", 0)), itemRates)
+	if itemRateLimiter.Enabled() {
+		logger.WithFields(map[string]interface{}{
+			"rate":       getEnvInt("ITEM_ADMISSION_RATE", 0),
+			"item_rates": itemRates,
+		}).Info("Item admission rate initialized")
+	}
+
+	// Admission policy chain run on every validated order
+	// Configurable via environment: ADMISSION_POLICIES (comma-separated policy names in evaluation
+	// order, default: purchase_token,geo,risk,purchase_admission,item_rate; policies left out are disabled)
+	admissionPolicyNames := os.Getenv("ADMISSION_POLICIES")
+	if admissionPolicyNames == "" {
+		admissionPolicyNames = defaultAdmissionPolicies
+	}
+	admissionChain, err = ParseAdmissionPolicies(admissionPolicyNames)
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid ADMISSION_POLICIES")
+	}
+	logger.WithField("policies", admissionChain.Names()).Info("Admission policies initialized")
+
+	// Amendment of queued orders via PATCH /order/{request_id} (ORDER_AMENDMENTS_ENABLED, default: false)
+	orderAmendmentsEnabled = getEnvBool("ORDER_AMENDMENTS_ENABLED", false)
+
+	// Cart orders (CART_MAX_LINES, default: 0 = single-item orders only; CART_DEFAULT_POLICY, default: all_or_nothing)
+	// Enable only once every processor runs a release that reads lines
+	cartMaxLines = getEnvInt("CART_MAX_LINES", 0)
+	if policy := os.Getenv("CART_DEFAULT_POLICY"); policy != "" {
+		if !common.IsValidCartPolicy(policy) {
+			logger.WithField("policy", policy).Fatal("Invalid CART_DEFAULT_POLICY")
+		}
+		cartDefaultPolicy = policy
+	}
+
+	// Partition keying for order messages
+	// Configurable via environment: ORDER_PARTITION_KEY_MODE (none|item|item_sharded|user, default: none), ORDER_KEY_SHARDS (default: 8)
+	orderKeyer = NewOrderKeyer(os.Getenv("ORDER_PARTITION_KEY_MODE"), getEnvInt("ORDER_KEY_SHARDS", 8))
+	logger.WithField("mode", orderKeyer.Mode()).Info("Order partition keying initialized")
+
+	// Order payload encoding (ORDER_PAYLOAD_FORMAT: json|protobuf, default: json)
+	// Switch to protobuf only once every processor runs a release that reads it
+	if os.Getenv("ORDER_PAYLOAD_FORMAT") == OrderPayloadProtobuf {
+		orderPayloadFormat = OrderPayloadProtobuf
+	}
+
+	// Bounded wait for ack=reserved requests (ACK_RESERVED_TIMEOUT, default: 5s)
+	ackReservedTimeout = getEnvDuration("ACK_RESERVED_TIMEOUT", ackReservedTimeout)
+
+	// Links to the order status resource (PUBLIC_BASE_URL, default: relative; ORDER_EVENTS_TIMEOUT, default: 30s)
+	publicBaseURL = strings.TrimSuffix(os.Getenv("PUBLIC_BASE_URL"), "/")
+	orderEventsTimeout = getEnvDuration("ORDER_EVENTS_TIMEOUT", orderEventsTimeout)
+	// Per-order stage timeline behind GET /order/{request_id}/events?timeline=true (ORDER_TIMELINE_ENABLED, default: false)
+	orderTimelineEnabled = getEnvBool("ORDER_TIMELINE_ENABLED", false)
+
+	// Server-generated request IDs for clients that don't supply one (GENERATE_REQUEST_ID, default: false)
+	generateRequestIDs = getEnvBool("GENERATE_REQUEST_ID", false)
+
+	// Envelope encryption of order payloads for brokers operated by a third party
+	// Configurable via environment: PAYLOAD_ENCRYPTION_KEYS / PAYLOAD_ENCRYPTION_KEYS_FILE, PAYLOAD_ENCRYPTION_KEY_ID
+	payloadCipher, err = common.LoadPayloadCipher()
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load payload encryption keys")
+	}
+	if payloadCipher != nil {
+		logger.WithField("key_id", payloadCipher.ActiveKeyID()).Info("Order payload encryption enabled")
+	}
+
+	// HMAC-sign order messages so processors can reject orders injected by other producers
+	// Configurable via environment: MESSAGE_SIGNING_KEYS, MESSAGE_SIGNING_KEY_ID
+	signer, err = common.LoadMessageSigner()
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load message signing keys")
+	}
+	if signer != nil {
+		if !signer.CanSign() {
+			logger.Fatal("MESSAGE_SIGNING_KEY_ID is required when MESSAGE_SIGNING_KEYS is set")
+		}
+		logger.Info("Order message signing enabled")
+	}
+
+	// Country-based admission rules per campaign (optional)
+	// Configurable via environment: GEOIP_DATABASE_FILE (network,country_code CSV), GEOIP_RULES_FILE
+	if rulesFile := os.Getenv("GEOIP_RULES_FILE"); rulesFile != "" {
+		databaseFile := os.Getenv("GEOIP_DATABASE_FILE")
+		if databaseFile == "" {
+			logger.Fatal("GEOIP_RULES_FILE requires GEOIP_DATABASE_FILE")
+		}
+		geoDB, err := LoadCSVGeoIPDatabase(databaseFile)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to load GeoIP database")
+		}
+		geoAdmission, err = LoadGeoAdmission(geoDB, rulesFile)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to load geo admission rules")
+		}
+		logger.WithFields(map[string]interface{}{
+			"database_file": databaseFile,
+			"networks":      len(geoDB.networks),
+			"rules_file":    rulesFile,
+			"item_rules":    geoAdmission.RuleCount(),
+		}).Info("Geo admission rules loaded")
 	}
 
-	// Channel to listen for interrupt signals
-	shutdown := make(chan os.Signal, 1)
-	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
+	// Device fingerprint tokens
+	// Configurable via environment: DEVICE_TOKEN_SECRET (shared with the fingerprinting SDK),
+	// DEVICE_TOKEN_MAX_AGE (default: 10m), DEVICE_TOKEN_REQUIRED (default: false)
+	if secret := os.Getenv("DEVICE_TOKEN_SECRET"); secret != "" {
+		deviceTokens, err = NewDeviceTokenVerifier(secret, getEnvDuration("DEVICE_TOKEN_MAX_AGE", 10*time.Minute))
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid DEVICE_TOKEN_SECRET")
+		}
+	}
+	deviceTokenRequired = getEnvBool("DEVICE_TOKEN_REQUIRED", false)
+	if deviceTokenRequired && deviceTokens == nil {
+		logger.Fatal("DEVICE_TOKEN_REQUIRED requires DEVICE_TOKEN_SECRET")
+	}
 
-	// Start server in goroutine
-	go func() {
-		logger.Info("Gateway running on :8080")
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.WithError(err).Fatal("HTTP server failed")
+	// Risk scoring hook for bot-mitigation vendors; scorers fail open
+	// Configurable via environment: RISK_SCORER_URL, RISK_SCORER_TIMEOUT (default: 200ms),
+	// RISK_BLOCK_THRESHOLD (default: 0.9)
+	// Outbound calls share one pooled transport, tuned with HTTP_CLIENT_* (see common.HTTPTransportConfigFromEnv)
+	if scorerURL := os.Getenv("RISK_SCORER_URL"); scorerURL != "" {
+		httpTransport := common.NewHTTPTransport(common.HTTPTransportConfigFromEnv(), metrics.HTTPClients)
+		RegisterRiskScorer(NewHTTPRiskScorer(scorerURL, httpTransport.Client("risk_scorer", getEnvDuration("RISK_SCORER_TIMEOUT", 200*time.Millisecond))))
+	}
+	riskBlockThreshold = getEnvFloat("RISK_BLOCK_THRESHOLD", 0.9)
+	logger.WithFields(map[string]interface{}{
+		"device_tokens":         deviceTokens != nil,
+		"device_token_required": deviceTokenRequired,
+		"risk_scorers":          riskScorerCount(),
+		"risk_block_threshold":  riskBlockThreshold,
+	}).Info("Bot mitigation initialized")
+
+	// User bearer tokens signed by the account system (USER_TOKEN_SECRET), required by
+	// /session and the notification preferences
+	if secret := os.Getenv("USER_TOKEN_SECRET"); secret != "" {
+		userTokens, err = NewUserTokenVerifier(secret)
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid USER_TOKEN_SECRET")
+		}
+	}
+
+	// Purchase sessions: /session issues short-lived tokens binding user and item that /buy requires,
+	// so clients can't skip the waiting room and challenges (registered as session gates)
+	// With USER_TOKEN_SECRET, a session is only issued to the user's own bearer token
+	// Configurable via environment: PURCHASE_TOKEN_SECRET, PURCHASE_TOKEN_TTL (default: 2m),
+	// PURCHASE_TOKEN_REQUIRED (default: false, enable once clients call /session)
+	if secret := os.Getenv("PURCHASE_TOKEN_SECRET"); secret != "" {
+		purchaseTokens, err = NewPurchaseTokenIssuer(secret, getEnvDuration("PURCHASE_TOKEN_TTL", 2*time.Minute))
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid PURCHASE_TOKEN_SECRET")
 		}
-	}()
+		if userTokens != nil {
+			RegisterSessionGate(NewUserTokenGate(userTokens))
+		}
+	}
+	purchaseTokenRequired = getEnvBool("PURCHASE_TOKEN_REQUIRED", false)
+	if purchaseTokenRequired && purchaseTokens == nil {
+		logger.Fatal("PURCHASE_TOKEN_REQUIRED requires PURCHASE_TOKEN_SECRET")
+	}
+	// Without a gate /session issues a token to anyone asking, and requiring it would stop nothing
+	if purchaseTokenRequired && sessionGateCount() == 0 {
+		logger.Fatal("PURCHASE_TOKEN_REQUIRED requires a session gate: set USER_TOKEN_SECRET")
+	}
+	logger.WithFields(map[string]interface{}{
+		"enabled":       purchaseTokens != nil,
+		"required":      purchaseTokenRequired,
+		"session_gates": sessionGateCount(),
+	}).Info("Purchase sessions initialized")
+
+	// Back-in-stock waitlist: restocked units are offered as purchase tokens
+	// Configurable via environment: WAITLIST_ENABLED (default: false, requires PURCHASE_TOKEN_SECRET),
+	// WAITLIST_OFFER_TTL (default: 10m), WAITLIST_DISPATCH_INTERVAL (default: 1s)
+	if getEnvBool("WAITLIST_ENABLED", false) {
+		if purchaseTokens == nil {
+			logger.Fatal("WAITLIST_ENABLED requires PURCHASE_TOKEN_SECRET")
+		}
+		waitlist = NewWaitlist(redisRouter, purchaseTokens, getEnvDuration("WAITLIST_OFFER_TTL", 10*time.Minute))
+	}
+
+	// Notification preferences read by the notifier (NOTIFICATION_PREFERENCES_ENABLED, default: false)
+	// are kept in the order store database (ORDER_STORE_DSN) and only served to the user's own
+	// bearer token, signed by the account system with USER_TOKEN_SECRET
+	if getEnvBool("NOTIFICATION_PREFERENCES_ENABLED", false) {
+		if userTokens == nil {
+			logger.Fatal("NOTIFICATION_PREFERENCES_ENABLED requires USER_TOKEN_SECRET")
+		}
+		dsn := os.Getenv("ORDER_STORE_DSN")
+		if dsn == "" {
+			logger.Fatal("NOTIFICATION_PREFERENCES_ENABLED requires ORDER_STORE_DSN")
+		}
+		notificationPreferences, err = common.NewNotificationPreferencesStore(ctx, dsn)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to connect to the order store")
+		}
+		a.OnShutdown("notification preferences", func(context.Context) error { return notificationPreferences.Close() })
+		logger.Info("Notification preferences initialized")
+	}
+
+	// Load deployment-specific validation rules (optional)
+	if rulesFile := os.Getenv("VALIDATION_RULES_FILE"); rulesFile != "" {
+		count, err := LoadValidationRules(rulesFile)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to load validation rules")
+		}
+		logger.WithFields(map[string]interface{}{
+			"rules_file": rulesFile,
+			"rule_count": count,
+		}).Info("Validation rules loaded")
+	}
+
+	// Redis OOM degradation: non-essential writes (order status, metadata) are skipped for
+	// REDIS_OOM_HOLD (default: 30s) after the last OOM error
+	redisHealth = a.NewRedisDegradation(metrics.RedisDegraded)
 
-	// Wait for shutdown signal
-	<-shutdown
-	logger.Info("Shutdown signal received, draining connections...")
+	// Outage buffer: accept orders while the circuit is open and publish them once Kafka recovers
+	// Configurable via environment: OUTAGE_BUFFER_ENABLED (default: false), OUTAGE_BUFFER_CAPACITY (default: 1000),
+	// OUTAGE_BUFFER_FILE (default: memory only), OUTAGE_BUFFER_FLUSH_INTERVAL (default: 1s)
+	if getEnvBool("OUTAGE_BUFFER_ENABLED", false) {
+		bufferFile := os.Getenv("OUTAGE_BUFFER_FILE")
+		outageBuffer, err = NewOutageBuffer(getEnvInt("OUTAGE_BUFFER_CAPACITY", 1000), bufferFile)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to load outage buffer")
+		}
+		go outageBuffer.Run(monitorCtx, producer, getEnvDuration("OUTAGE_BUFFER_FLUSH_INTERVAL", 1*time.Second), logger)
+		logger.WithFields(map[string]interface{}{
+			"capacity": getEnvInt("OUTAGE_BUFFER_CAPACITY", 1000),
+			"file":     bufferFile,
+			"pending":  outageBuffer.Len(),
+		}).Info("Outage buffer enabled")
+	}
 
-	// Create shutdown context with timeout (30 seconds to drain)
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer shutdownCancel()
+	// Per-campaign order topics registered via the processor admin API
+	// Configurable via environment: CAMPAIGN_TOPICS_ENABLED (default: false), CAMPAIGN_TOPICS_REFRESH (default: 10s),
+	// ORDER_SALE_END_GRACE (default: 5m, how long after the campaign ends its queued orders may still be processed)
+	if getEnvBool("CAMPAIGN_TOPICS_ENABLED", false) {
+		campaignRouter = NewCampaignRouter(redisClient)
+		if err := campaignRouter.Refresh(ctx); err != nil {
+			logger.WithError(err).Warn("Failed to load campaign topics, orders use the shared topic until the next refresh")
+		}
+		go campaignRouter.Run(monitorCtx, getEnvDuration("CAMPAIGN_TOPICS_REFRESH", 10*time.Second), logger)
+		saleEndGrace = getEnvDuration("ORDER_SALE_END_GRACE", saleEndGrace)
+		logger.Info("Campaign topic routing enabled")
+	}
 
-	// Gracefully shutdown server (stops accepting new connections, waits for existing)
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		logger.WithError(err).Error("Error during server shutdown")
+	http.HandleFunc("/buy", handleBuy)
+	http.HandleFunc("GET /order/{request_id}", handleGetOrder)
+	// Plural alias for clients polling the orders collection; same resource as /order/{request_id}
+	http.HandleFunc("GET /orders/{request_id}", handleGetOrder)
+	http.HandleFunc("GET /order/{request_id}/events", handleOrderEvents)
+	if purchaseTokens != nil {
+		http.HandleFunc("/session", handleSession)
+	}
+	if purchaseAdmission.RegistrationEnabled() {
+		http.HandleFunc("/register", handleRegister)
+	}
+	if orderAmendmentsEnabled {
+		http.HandleFunc("PATCH /order/{request_id}", handleAmendOrder)
+	}
+	if notificationPreferences != nil {
+		http.HandleFunc("GET /users/{user_id}/notification-preferences", userTokens.RequireUser(handleGetNotificationPreferences))
+		http.HandleFunc("PUT /users/{user_id}/notification-preferences", userTokens.RequireUser(handlePutNotificationPreferences))
+	}
+	if waitlist != nil {
+		http.HandleFunc("POST /waitlist/{item_id}", handleJoinWaitlist)
+		http.HandleFunc("GET /waitlist/{item_id}", handleWaitlistStatus)
+		go waitlist.Run(monitorCtx, getEnvDuration("WAITLIST_DISPATCH_INTERVAL", 1*time.Second), logger)
 	}
 
-	// Close connections
-	if err := producer.Close(); err != nil {
-		logger.WithError(err).Error("Error closing Kafka producer")
+	// /metrics, /version, /health and, with ADMIN_TOKEN_SECRET, the read-only admin API
+	// (GET /admin/config, GET /admin/campaigns/metrics, POST /admin/admission/evaluate) using the
+	// processor's bearer tokens
+	adminAuth = a.AdminAuth()
+	a.RegisterEndpoints(adminAuth)
+	if adminAuth != nil {
+		a.Mux.HandleFunc("GET /admin/campaigns/metrics", adminAuth.Require(common.RoleViewer, metrics.Orders.Campaigns.SummaryHandler()))
+		a.Mux.HandleFunc("POST /admin/admission/evaluate", adminAuth.Require(common.RoleOperator, handleAdminEvaluateAdmission))
+		logger.Info("Admin API enabled on :8080/admin")
 	}
-	if err := redisClient.Close(); err != nil {
-		logger.WithError(err).Error("Error closing Redis client")
+
+	// Shutdown stops accepting connections first and drains in-flight requests (up to 30s)
+	// before the producer and Redis are closed
+	var wrapListener func(net.Listener) net.Listener
+	if proxyProtocol {
+		wrapListener = func(listener net.Listener) net.Listener { return &ProxyProtocolListener{Listener: listener} }
 	}
+	a.Serve(&http.Server{
+		Addr:    ":8080",
+		Handler: RealIPMiddleware(a.Mux),
+	}, wrapListener)
+	// Registered after the server so it runs first on shutdown: new orders are refused while the
+	// in-flight ones finish, then the server drains everything else
+	a.OnShutdown("in-flight /buy requests", func(ctx context.Context) error {
+		return buyTracker.Drain(ctx, logger)
+	})
+	logger.Info("Gateway running on :8080")
 
-	logger.Info("Gateway shutdown complete")
+	a.Run(nil)
 }
 
 func handleBuy(w http.ResponseWriter, r *http.Request) {
-	// Add request timeout context (30 seconds)
-	reqCtx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	// Request budget (BUY_REQUEST_TIMEOUT): bounds every Redis call and the Kafka send below
+	reqCtx, cancel := context.WithTimeout(r.Context(), buyRequestTimeout)
 	defer cancel()
 
 	// Track processing time for metrics
 	startTime := time.Now()
 
-	// Generate correlation ID for request tracing
+	// Generate correlation ID for request tracing; Redis slow-command logs read it from reqCtx
 	correlationID := uuid.New().String()
 	logEntry := common.WithEvent(correlationID, "order_received")
+	reqCtx = common.ContextWithCorrelationID(reqCtx, correlationID)
+
+	// Draining on shutdown: refuse the order so the client retries on another instance
+	if !buyTracker.Begin(correlationID) {
+		metrics.BuyRequestsRefusedDraining.Inc()
+		logEntry.WithField("event", "order_refused_draining").Warn("Gateway shutting down, order refused")
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "1")
+		writeError(w, r, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, correlationID, map[string]interface{}{
+			"retry_after_seconds": 1,
+		})
+		return
+	}
+	defer buyTracker.End(correlationID)
 
 	// Log request details
+	ip := clientIP(r)
 	logEntry.WithFields(map[string]interface{}{
 		"method":      r.Method,
 		"path":        r.URL.Path,
 		"remote_addr": r.RemoteAddr,
+		"client_ip":   ip,
 		"user_agent":  r.UserAgent(),
 	}).Info("Received buy request")
 
 	// Set content type for JSON responses
 	w.Header().Set("Content-Type", "application/json")
 
-	// Decode request body
+	// Per-IP limits run before the body is read, so rejected clients cost as little as possible
+	if ipConcurrency != nil {
+		if !ipConcurrency.Acquire(ip) {
+			metrics.IPLimited.WithLabelValues("concurrency").Inc()
+			logEntry.WithField("event", "ip_concurrency_exceeded").Warn("Too many concurrent requests from IP")
+			writeError(w, r, http.StatusTooManyRequests, ErrCodeTooManyConcurrent, correlationID, nil)
+			return
+		}
+		defer ipConcurrency.Release(ip)
+	}
+	if ipRateLimiter != nil {
+		allowed, err := ipRateLimiter.Allow(reqCtx, "ip:"+ip)
+		if budgetExceeded(reqCtx, BudgetStageRateLimit, err) {
+			logEntry.WithError(err).WithField("event", "request_budget_exceeded").Error("Request budget exceeded during IP rate limit check")
+			writeError(w, r, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, correlationID, nil)
+			return
+		} else if err != nil {
+			redisHealth.Observe(err)
+			logEntry.WithError(err).Warn("IP rate limiter check failed, allowing request")
+		} else if !allowed {
+			metrics.IPLimited.WithLabelValues("rate").Inc()
+			metrics.Orders.Record(common.OrderOutcomeRejectedRateLimit, "", "")
+			logEntry.WithField("event", "ip_rate_limit_exceeded").Warn("IP rate limit exceeded")
+			writeError(w, r, http.StatusTooManyRequests, ErrCodeRateLimited, correlationID, map[string]interface{}{
+				"retry_after_seconds": int(ipRateLimitWindow.Seconds()),
+			})
+			return
+		}
+	}
+
+	// Device token: verified before the body is read, like the per-IP limits
+	var device *DeviceFingerprint
+	if deviceTokens != nil {
+		token := r.Header.Get(DeviceTokenHeader)
+		var tokenErr error
+		if token != "" {
+			device, tokenErr = deviceTokens.Verify(token, time.Now())
+		}
+		switch {
+		case tokenErr != nil:
+			result := "invalid"
+			if errors.Is(tokenErr, ErrDeviceTokenExpired) {
+				result = "expired"
+			}
+			metrics.DeviceTokens.WithLabelValues(result).Inc()
+			logEntry.WithError(tokenErr).WithField("event", "device_token_rejected").Warn("Invalid device token")
+			writeError(w, r, http.StatusForbidden, ErrCodeInvalidDevice, correlationID, nil)
+			return
+		case device == nil:
+			metrics.DeviceTokens.WithLabelValues("missing").Inc()
+			if deviceTokenRequired {
+				logEntry.WithField("event", "device_token_missing").Warn("Device token required")
+				writeError(w, r, http.StatusForbidden, ErrCodeInvalidDevice, correlationID, nil)
+				return
+			}
+		default:
+			metrics.DeviceTokens.WithLabelValues("valid").Inc()
+		}
+	}
+
+	// Decode request body strictly (unknown fields, wrong types and oversized bodies are rejected)
 	var order OrderRequest
-	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
-		logEntry.WithError(err).Warn("Invalid request body")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error":          "Invalid request body",
-			"correlation_id": correlationID,
+	if decodeErrors := DecodeOrderRequest(w, r, &order); len(decodeErrors) > 0 {
+		recordValidationFailures(decodeErrors)
+		logEntry.WithField("errors", decodeErrors).Warn("Invalid request body")
+		writeError(w, r, http.StatusBadRequest, ErrCodeInvalidBody, correlationID, map[string]interface{}{
+			"errors": decodeErrors,
 		})
 		return
 	}
 
 	// Track order received
 	metrics.OrdersReceived.Inc()
+	applyCartLines(&order)
 
-	// Rate limiting: Check if user has exceeded rate limit
+	order.DeviceID = ""
+	if device != nil {
+		order.DeviceID = device.ID
+	}
+
+	// Rate limiting: Check if user has exceeded rate limit, unless an exemption token decides
 	// Use request context with timeout
-	allowed, err := rateLimiter.Allow(reqCtx, order.UserID)
-	if err != nil {
+	logEntry, exempted, allowed := checkRateLimitExemption(reqCtx, r, logEntry)
+	var err error
+	if exempted {
+		if !allowed {
+			metrics.OrdersFailed.Inc()
+			metrics.Orders.Record(common.OrderOutcomeRejectedRateLimit, order.ItemID, orderCampaign(order.ItemID))
+			writeError(w, r, http.StatusTooManyRequests, ErrCodeRateLimited, correlationID, map[string]interface{}{
+				"retry_after_seconds": int(rateLimitWindow.Seconds()),
+			})
+			return
+		}
+	} else if allowed, err = rateLimiter.Allow(reqCtx, order.UserID); budgetExceeded(reqCtx, BudgetStageRateLimit, err) {
+		metrics.OrdersFailed.Inc()
+		logEntry.WithError(err).WithField("event", "request_budget_exceeded").Error("Request budget exceeded during rate limit check")
+		writeError(w, r, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, correlationID, nil)
+		return
+	} else if err != nil {
 		// Redis error - log but allow request (fail open)
+		redisHealth.Observe(err)
 		logEntry.WithError(err).Warn("Rate limiter check failed, allowing request")
 	} else if !allowed {
 		metrics.OrdersFailed.Inc()
+		metrics.Orders.Record(common.OrderOutcomeRejectedRateLimit, order.ItemID, orderCampaign(order.ItemID))
 		logEntry.WithField("event", "rate_limit_exceeded").Warn("Rate limit exceeded")
-		w.WriteHeader(http.StatusTooManyRequests)
 		remaining, _ := rateLimiter.GetRemainingRequests(reqCtx, order.UserID)
 		rateLimitWindowDuration := getEnvDuration("RATE_LIMIT_WINDOW", 1*time.Minute)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error":               "Rate limit exceeded",
-			"correlation_id":      correlationID,
+		writeError(w, r, http.StatusTooManyRequests, ErrCodeRateLimited, correlationID, map[string]interface{}{
 			"retry_after_seconds": int(rateLimitWindowDuration.Seconds()),
 			"remaining_requests":  remaining,
 		})
 		return
 	}
 
-	// Validate input fields (user_id, item_id, amount, request_id)
+	// Generate request_id server-side if omitted so simple clients still get dedupe protection
+	// and a handle for status lookup; the generated ID is returned in the response
+	requestIDGenerated := false
+	if order.RequestID == "" && generateRequestIDs {
+		order.RequestID = uuid.New().String()
+		requestIDGenerated = true
+	}
+
+	if order.Address != nil {
+		sanitizeAddress(order.Address)
+	}
+
+	// Validate input fields (user_id, item_id, amount, request_id, channel)
 	// Returns 400 Bad Request with detailed error messages if validation fails
-	if validationErrors := ValidateOrderRequest(&order); len(validationErrors) > 0 {
-		metrics.OrdersValidationFailed.Inc()
+	validationErrors := ValidateOrderRequest(&order)
+	ackLevel, ackErr := parseAckLevel(r.URL.Query().Get("ack"))
+	if ackErr != nil {
+		validationErrors = append(validationErrors, *ackErr)
+	}
+	if len(validationErrors) > 0 {
+		recordValidationFailures(validationErrors)
 		logEntry.WithField("errors", validationErrors).Warn("Validation failed")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error":          "Validation failed",
-			"errors":         validationErrors,
-			"correlation_id": correlationID,
+		writeError(w, r, http.StatusBadRequest, ErrCodeValidationFailed, correlationID, map[string]interface{}{
+			"errors": validationErrors,
 		})
 		return
 	}
 
+	// The channel comes from the verified device token; a different (valid) body channel is ignored
+	if channel := orderChannel(device); order.Channel != channel {
+		if order.Channel != "" {
+			logEntry.WithFields(logrus.Fields{
+				"event":             "order_channel_unverified",
+				"requested_channel": order.Channel,
+				"channel":           channel,
+			}).Debug("Order channel not vouched for by a device token")
+		}
+		order.Channel = channel
+	}
+
 	logEntry = logEntry.WithFields(map[string]interface{}{
-		"user_id":    order.UserID,
-		"item_id":    order.ItemID,
-		"amount":     order.Amount,
-		"request_id": order.RequestID,
+		"user_id":              order.UserID,
+		"recipient_user_id":    order.RecipientUserID,
+		"item_id":              order.ItemID,
+		"amount":               order.Amount,
+		"channel":              order.Channel,
+		"request_id":           order.RequestID,
+		"request_id_generated": requestIDGenerated,
+		"device_id":            order.DeviceID,
 	})
+	if len(order.Lines) > 0 {
+		logEntry = logEntry.WithFields(map[string]interface{}{
+			"cart_lines":  len(order.Lines),
+			"cart_policy": order.CartPolicy,
+		})
+	}
+
+	// Echo the request ID so clients can look up status (especially when server-generated)
+	w.Header().Set("X-Request-ID", order.RequestID)
+
+	// Admission policies (ADMISSION_POLICIES): purchase token, geo, risk scoring, registration and
+	// purchase cap by default; the first rejection answers the request
+	// With a valid X-Admission-Debug token, every policy's decision is returned in the response
+	admission := &AdmissionRequest{Order: &order, HTTP: r, ClientIP: ip, Log: logEntry}
+	admissionDebug := admissionDebugAllowed(r, logEntry)
+	rejection := admissionChain.Admit(reqCtx, admission)
+	if rejection == nil {
+		rejection = admitCartLines(reqCtx, admission)
+	}
+	if rejection != nil {
+		details := rejection.Details
+		if admissionDebug {
+			details = map[string]interface{}{"admission_decisions": admission.Decisions}
+			for k, v := range rejection.Details {
+				details[k] = v
+			}
+		}
+		if rejection.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(rejection.RetryAfter.Seconds())))
+		}
+		writeError(w, r, rejection.Status, rejection.Code, correlationID, details)
+		return
+	}
+	admittedAt := time.Now()
+	logEntry = admission.Log
+	// releaseAdmission undoes the policies' side effects (e.g. a counted item admission) when the
+	// order is rolled back before being queued
+	// Rollbacks run on rollbackContext, so they still happen once the request budget is spent
+	releaseAdmission := func() {
+		ctx, cancel := rollbackContext(reqCtx)
+		defer cancel()
+		admission.Rollback(ctx)
+	}
+	// rollback undoes the idempotency key, intent and admission of an order that wasn't queued
+	rollback := func() {
+		ctx, cancel := rollbackContext(reqCtx)
+		defer cancel()
+		redisClient.Del(ctx, common.IdempotencyKey(order.RequestID))
+		intents.Release(ctx, order.UserID, order.ItemID, order.RequestID)
+		releaseAdmission()
+	}
+
+	// Duplicate-intent check: catch clients that regenerate request IDs when retrying the same purchase
+	// Fails open on Redis errors, like the rate limiter
+	duplicateIntent, previousRequestID, err := intents.Check(reqCtx, order.UserID, order.ItemID, order.RequestID)
+	if err != nil {
+		redisHealth.Observe(err)
+		logEntry.WithError(err).Warn("Duplicate-intent check failed, allowing request")
+	} else if duplicateIntent {
+		metrics.OrdersDuplicateIntent.Inc()
+		logEntry.WithFields(map[string]interface{}{
+			"event":               "duplicate_intent_detected",
+			"previous_request_id": previousRequestID,
+			"mode":                intents.Mode(),
+		}).Warn("Duplicate purchase intent detected")
+		if intents.Mode() == DuplicateIntentBlock {
+			metrics.Orders.Record(common.OrderOutcomeDuplicate, order.ItemID, orderCampaign(order.ItemID))
+			releaseAdmission()
+			writeError(w, r, http.StatusConflict, ErrCodeDuplicateIntent, correlationID, map[string]interface{}{
+				"previous_request_id": previousRequestID,
+			})
+			return
+		}
+	}
 
 	// Idempotency check: Use Redis SETNX to prevent duplicate order processing
 	// If request_id already exists, return 409 Conflict
-	// TTL of 10 minutes ensures idempotency keys don't accumulate indefinitely
-	// Use request context with timeout
-	isNew, err := redisClient.SetNX(reqCtx, "idempotency:"+order.RequestID, "processing", 10*time.Minute).Result()
+	// The TTL (common.IdempotencyTTL) keeps keys from accumulating; processors extend it while
+	// the order is in flight. Use request context with timeout
+	isNew, err := redisClient.SetNX(reqCtx, common.IdempotencyKey(order.RequestID), "processing", common.IdempotencyTTL).Result()
 	if err != nil {
 		logEntry.WithError(err).Error("Redis idempotency check failed")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error":          "Internal server error",
-			"correlation_id": correlationID,
-		})
+		ctx, cancelRollback := rollbackContext(reqCtx)
+		intents.Release(ctx, order.UserID, order.ItemID, order.RequestID)
+		cancelRollback()
+		releaseAdmission()
+		if budgetExceeded(reqCtx, BudgetStageIdempotency, err) {
+			writeError(w, r, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, correlationID, nil)
+			return
+		}
+		// Without an idempotency key the order can't be accepted safely; OOM is transient, so
+		// tell the client to retry instead of reporting an internal error
+		if redisHealth.Observe(err) {
+			writeError(w, r, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, correlationID, nil)
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, correlationID, nil)
 		return
 	}
 	if !isNew {
 		metrics.OrdersIdempotencyRejected.Inc()
+		metrics.Orders.Record(common.OrderOutcomeDuplicate, order.ItemID, orderCampaign(order.ItemID))
+		releaseAdmission()
 		logEntry.Warn("Duplicate request detected")
-		w.WriteHeader(http.StatusConflict)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error":          "Duplicate Request Detected",
-			"correlation_id": correlationID,
-		})
+		writeError(w, r, http.StatusConflict, ErrCodeDuplicateRequest, correlationID, nil)
 		return
 	}
 
-	// Update order status to PROCESSING when queued
-	orderStatusKey := "order_status:" + order.RequestID
-	redisClient.Set(reqCtx, orderStatusKey, "PROCESSING", 30*time.Minute)
+	// Status and metadata are non-essential: skip them while Redis is out of memory so the
+	// remaining memory goes to inventory and idempotency keys (orders accepted then aren't amendable)
+	amendable := false
+	if redisHealth.Degraded() {
+		logEntry.WithField("event", "redis_degraded_write_skipped").Warn("Redis degraded, skipping order status and metadata")
+	} else {
+		// Update order status to PROCESSING when queued
+		if err := statusStore.SetStatus(reqCtx, order.RequestID, common.StatusProcessing, common.OrderStatusTTL); err != nil {
+			redisHealth.Observe(err)
+			logEntry.WithError(err).Warn("Failed to update order status")
+		}
+
+		// Store metadata alongside the order status (same TTL) so it can be returned with results
+		if len(order.Metadata) > 0 {
+			metadataBytes, _ := json.Marshal(order.Metadata)
+			if err := redisClient.Set(reqCtx, "order_metadata:"+order.RequestID, metadataBytes, 30*time.Minute).Err(); err != nil {
+				redisHealth.Observe(err)
+				logEntry.WithError(err).Warn("Failed to store order metadata")
+			}
+		}
+
+		// The address is personal data: it is only stored encrypted, so it is skipped when no
+		// encryption keys are configured (it still travels in the order payload)
+		if order.Address != nil && payloadCipher != nil {
+			addressBytes, _ := json.Marshal(order.Address)
+			encrypted, err := payloadCipher.EncryptValue(addressBytes)
+			if err == nil {
+				err = redisClient.Set(reqCtx, "order_address:"+order.RequestID, encrypted, 30*time.Minute).Err()
+			}
+			if err != nil {
+				redisHealth.Observe(err)
+				logEntry.WithError(err).Warn("Failed to store order address")
+			}
+		}
+
+		// Cart orders aren't amendable: an amendment changes the quantity of a single item
+		if orderAmendmentsEnabled && len(order.Lines) == 0 {
+			if err := recordAmendableOrder(reqCtx, &order); err != nil {
+				redisHealth.Observe(err)
+				logEntry.WithError(err).Warn("Failed to store amendable order, order can't be amended")
+			} else {
+				amendable = true
+			}
+		}
+	}
+	// The writes above fail on their own when the budget runs out; don't go on to publish then
+	if budgetExceeded(reqCtx, BudgetStageStatus, reqCtx.Err()) {
+		logEntry.WithField("event", "request_budget_exceeded").Error("Request budget exceeded while storing order status")
+		rollback()
+		writeError(w, r, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, correlationID, nil)
+		return
+	}
 
 	// Publish order to Kafka for async processing
 	// Include correlation ID in message headers for request tracing across services
-	orderBytes, _ := json.Marshal(order)
+	orderBytes, contentHeaders := encodeOrderPayload(&order)
+	topic, saleEndsAt := common.TopicOrders, time.Time{}
+	if campaignRouter != nil {
+		topic, saleEndsAt = campaignRouter.Route(order.ItemID)
+	}
 	msg := &sarama.ProducerMessage{
-		Topic: "orders",
-		Value: sarama.StringEncoder(orderBytes),
-		Headers: []sarama.RecordHeader{
+		Topic: topic,
+		Key:   orderKeyer.Key(&order),
+		Value: sarama.ByteEncoder(orderBytes),
+		Headers: append([]sarama.RecordHeader{
 			{Key: []byte("correlation_id"), Value: []byte(correlationID)},
 			{Key: []byte("request_id"), Value: []byte(order.RequestID)},
-		},
-	}
-
-	// Check circuit breaker state before attempting to send
-	// If circuit is open, Kafka is unavailable - return 503 and rollback idempotency key
-	cbState := producer.State()
-	if cbState.String() == "Open" {
-		logEntry.WithField("circuit_state", cbState.String()).Error("Circuit breaker is open")
-		// Rollback idempotency key since we're not processing this request
-		redisClient.Del(reqCtx, "idempotency:"+order.RequestID)
-		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error":          "Service temporarily unavailable",
-			"correlation_id": correlationID,
-		})
+			{Key: []byte("accepted_at"), Value: []byte(startTime.UTC().Format(time.RFC3339Nano))},
+			{Key: []byte("client_ip"), Value: []byte(ip)},
+			{Key: []byte(common.HeaderItemID), Value: []byte(order.ItemID)},
+		}, contentHeaders...),
+	}
+	if campaign := common.CampaignFromTopic(topic); campaign != "" {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(common.HeaderCampaign), Value: []byte(campaign)})
+	}
+	if amendable {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(common.HeaderAmendable), Value: []byte("1")})
+	}
+	// Campaign orders still queued when the sale window (plus ORDER_SALE_END_GRACE) is over expire
+	if !saleEndsAt.IsZero() {
+		expiresAt := saleEndsAt.Add(saleEndGrace).UTC().Format(time.RFC3339Nano)
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(common.HeaderExpiresAt), Value: []byte(expiresAt)})
+	}
+
+	// Encrypt before buffering or sending so the plaintext never leaves the gateway, then sign
+	// the final payload and headers
+	if err := sealOrderMessage(msg); err != nil {
+		logEntry.WithError(err).Error("Failed to encrypt or sign order message")
+		rollback()
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, correlationID, nil)
 		return
 	}
 
-	// Send message through circuit breaker (handles failures gracefully)
-	_, _, err = producer.SendMessage(msg)
+	// While buffered orders are still being flushed, new ones queue behind them so orders reach
+	// Kafka in arrival order; if the buffer can't take the order it is published directly
+	if outageBuffer != nil && outageBuffer.Len() > 0 {
+		if bufferOrder(w, logEntry, msg, &order, correlationID, requestIDGenerated, duplicateIntent, startTime) {
+			recordGatewayTimeline(reqCtx, logEntry, order.RequestID, startTime, admittedAt, "buffered")
+			return
+		}
+	}
+
+	// ack=reserved: subscribe to the order's result channel before publishing so the
+	// reservation result cannot arrive before we listen; falls back to queued on Redis errors
+	var resultSub *redis.PubSub
+	if ackLevel == AckReserved {
+		resultSub, err = subscribeOrderResult(reqCtx, order.RequestID)
+		if err != nil {
+			logEntry.WithError(err).Warn("Failed to subscribe to order results, acknowledging as queued")
+			ackLevel = AckQueued
+		} else {
+			defer resultSub.Close()
+		}
+	}
+
+	// Send message through circuit breaker (handles failures gracefully), within the request budget
+	// If the send times out (KAFKA_SEND_TIMEOUT or the budget) the outcome is unknown: the order is
+	// neither rolled back nor reported queued, and the client polls status_url
+	err = publishWithinBudget(reqCtx, msg, logEntry, rollback)
+	if errors.Is(err, errPublishPending) {
+		budgetExceeded(reqCtx, BudgetStagePublish, err)
+		logEntry.WithField("event", "order_publish_timeout").Error("Kafka send timed out, order outcome unknown")
+		writeError(w, r, http.StatusGatewayTimeout, ErrCodeQueueTimeout, correlationID, map[string]interface{}{
+			"request_id": order.RequestID,
+			"status_url": orderStatusURL(order.RequestID),
+		})
+		return
+	}
+	if err != nil && err == reqCtx.Err() {
+		budgetExceeded(reqCtx, BudgetStagePublish, err)
+		logEntry.WithError(err).WithField("event", "request_budget_exceeded").Error("Request budget exceeded before sending order to Kafka")
+		rollback()
+		writeError(w, r, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, correlationID, nil)
+		return
+	}
 	if err != nil {
 		metrics.OrdersFailed.Inc()
-		logEntry.WithError(err).WithField("circuit_state", producer.State().String()).Error("Failed to send message to Kafka")
+		refused := errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrCircuitHalfOpen)
+		if refused {
+			logEntry.WithError(err).WithField("circuit_state", producer.State().String()).Error("Circuit breaker refused the order")
+		} else {
+			logEntry.WithError(err).WithField("circuit_state", producer.State().String()).Error("Failed to send message to Kafka")
+		}
+		if bufferOrder(w, logEntry, msg, &order, correlationID, requestIDGenerated, duplicateIntent, startTime) {
+			recordGatewayTimeline(reqCtx, logEntry, order.RequestID, startTime, admittedAt, "buffered")
+			return
+		}
 		// Rollback idempotency key since message wasn't queued
-		redisClient.Del(reqCtx, "idempotency:"+order.RequestID)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error":          "Failed to queue order",
-			"correlation_id": correlationID,
-		})
+		rollback()
+		if refused {
+			// Kafka is unavailable: tell the client when the circuit lets orders through again
+			retryAfter := int(producer.RetryAfter().Seconds())
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			writeError(w, r, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, correlationID, map[string]interface{}{
+				"retry_after_seconds": retryAfter,
+			})
+			return
+		}
+		// The producer failed this order only; retrying it with the same request_id is safe
+		writeError(w, r, http.StatusInternalServerError, ErrCodeQueueFailed, correlationID, nil)
 		return
 	}
 
 	// Record metrics
 	processingTime := time.Since(startTime)
 	metrics.OrdersSuccessful.Inc()
+	metrics.OrdersQueuedByChannel.WithLabelValues(order.Channel).Inc()
+	metrics.Orders.Record(common.OrderOutcomeQueued, order.ItemID, orderCampaign(order.ItemID))
 	metrics.RequestDuration.Observe(processingTime.Seconds())
+	recordGatewayTimeline(reqCtx, logEntry, order.RequestID, startTime, admittedAt, "")
 
 	// Update circuit breaker state metric (0=closed, 1=open, 2=half-open)
-	cbState = producer.State()
 	stateValue := 0.0
-	if cbState.String() == "Open" {
+	switch producer.State() {
+	case gobreaker.StateOpen:
 		stateValue = 1.0
-	} else if cbState.String() == "HalfOpen" {
+	case gobreaker.StateHalfOpen:
 		stateValue = 2.0
 	}
 	metrics.CircuitBreakerState.Set(stateValue)
@@ -304,41 +1146,104 @@ func handleBuy(w http.ResponseWriter, r *http.Request) {
 		"event":              "order_queued",
 	}).Info("Order queued successfully")
 
-	w.WriteHeader(http.StatusAccepted)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":             "Order Queued",
-		"correlation_id":     correlationID,
-		"processing_time_ms": processingTime.Milliseconds(),
-	})
-}
-
-// handleHealth provides a health check endpoint for Kubernetes liveness/readiness probes
-// Returns 200 OK if all services are healthy, 503 Service Unavailable otherwise
-func handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+	response := map[string]interface{}{
+		"status":               "Order Queued",
+		"ack":                  AckQueued,
+		"request_id":           order.RequestID,
+		"request_id_generated": requestIDGenerated,
+		"duplicate_intent":     duplicateIntent,
+		"amendable":            amendable,
+		"metadata":             order.Metadata,
+		"status_url":           orderStatusURL(order.RequestID),
+		"events_url":           orderEventsURL(order.RequestID),
+		"correlation_id":       correlationID,
+	}
+	if admissionDebug {
+		response["admission_decisions"] = admission.Decisions
+	}
+	statusCode := http.StatusAccepted
 
-	// Check Redis connection health with timeout
-	healthCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
-	redisHealthy := true
-	if err := redisClient.Ping(healthCtx).Err(); err != nil {
-		redisHealthy = false
+	// ack=reserved: wait (bounded) for the processor's reservation result
+	// A terminal result is returned with 200 OK; on timeout the response degrades to queued
+	if resultSub != nil {
+		result, err := awaitOrderResult(reqCtx, resultSub, ackReservedTimeout)
+		if err != nil {
+			logEntry.WithError(err).Warn("Failed to read order result")
+		}
+		if result != nil {
+			statusCode = http.StatusOK
+			response["ack"] = AckReserved
+			response["result"] = result
+			response["status"] = "Order Reserved"
+			if result.Status != common.ResultReserved {
+				response["status"] = "Order Failed"
+			}
+		} else {
+			response["ack_timeout"] = true
+		}
+		logEntry.WithFields(map[string]interface{}{
+			"event":       "order_ack_wait_completed",
+			"ack":         response["ack"],
+			"ack_wait_ms": time.Since(startTime).Milliseconds() - processingTime.Milliseconds(),
+		}).Info("Reservation acknowledgment wait completed")
 	}
 
-	// Check Kafka health via circuit breaker state
-	// Circuit breaker open indicates Kafka is unavailable
-	kafkaHealthy := producer.State().String() != "Open"
+	response["processing_time_ms"] = time.Since(startTime).Milliseconds()
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
 
-	status := http.StatusOK
-	if !redisHealthy || !kafkaHealthy {
-		status = http.StatusServiceUnavailable
+// bufferOrder places msg in the outage buffer (if enabled) and writes the 202 response
+// Returns false if buffering is disabled or the buffer is full/unwritable; the caller then
+// rolls back and rejects the order as before
+// The idempotency key and intent are kept so retries during the outage are still deduplicated
+func bufferOrder(w http.ResponseWriter, logEntry *logrus.Entry, msg *sarama.ProducerMessage, order *OrderRequest, correlationID string, requestIDGenerated, duplicateIntent bool, startTime time.Time) bool {
+	if outageBuffer == nil {
+		return false
 	}
+	if err := outageBuffer.Enqueue(msg); err != nil {
+		logEntry.WithError(err).Warn("Failed to buffer order during Kafka outage")
+		return false
+	}
+
+	processingTime := time.Since(startTime)
+	metrics.OrdersBuffered.Inc()
+	metrics.OrdersQueuedByChannel.WithLabelValues(order.Channel).Inc()
+	metrics.Orders.Record(common.OrderOutcomeQueued, order.ItemID, orderCampaign(order.ItemID))
+	metrics.OutageBufferSize.Set(float64(outageBuffer.Len()))
+	metrics.RequestDuration.Observe(processingTime.Seconds())
+	logEntry.WithFields(map[string]interface{}{
+		"processing_time_ms": processingTime.Milliseconds(),
+		"buffered_orders":    outageBuffer.Len(),
+		"event":              "order_buffered",
+	}).Warn("Order buffered during Kafka outage")
 
-	w.WriteHeader(status)
+	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":                "healthy",
-		"redis":                 redisHealthy,
-		"kafka":                 kafkaHealthy,
-		"circuit_breaker_state": producer.State().String(),
+		"status":               "Order Buffered",
+		"buffered":             true,
+		"request_id":           order.RequestID,
+		"request_id_generated": requestIDGenerated,
+		"duplicate_intent":     duplicateIntent,
+		"metadata":             order.Metadata,
+		"status_url":           orderStatusURL(order.RequestID),
+		"events_url":           orderEventsURL(order.RequestID),
+		"correlation_id":       correlationID,
+		"processing_time_ms":   processingTime.Milliseconds(),
 	})
+	return true
+}
+
+// sealOrderMessage applies the configured payload encryption and signature to msg
+// Signing comes last so the signature covers the ciphertext and encryption headers
+func sealOrderMessage(msg *sarama.ProducerMessage) error {
+	if payloadCipher != nil {
+		if err := payloadCipher.EncryptMessage(msg); err != nil {
+			return err
+		}
+	}
+	if signer != nil {
+		return signer.SignMessage(msg)
+	}
+	return nil
 }
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// notificationPreferences is nil unless NOTIFICATION_PREFERENCES_ENABLED is set
+var notificationPreferences *common.NotificationPreferencesStore
+
+// defaultNotificationChannels are the channels the notifier uses for users without preferences
+var defaultNotificationChannels = []string{common.NotificationChannelWebhook, common.NotificationChannelEmail}
+
+// NotificationPreferencesRequest is the body of PUT /users/{user_id}/notification-preferences
+type NotificationPreferencesRequest struct {
+	Channels []string `json:"channels"`
+	OptOut   []string `json:"opt_out"`
+}
+
+// validateNotificationPreferences checks channels and opt-out statuses against the known values
+func validateNotificationPreferences(req NotificationPreferencesRequest) []ValidationError {
+	var errors []ValidationError
+	if req.Channels == nil {
+		errors = append(errors, ValidationError{
+			Field:   "channels",
+			Code:    CodeRequired,
+			Message: "channels is required (an empty list opts out of every channel)",
+		})
+	}
+	for _, channel := range req.Channels {
+		if !slices.Contains(common.NotificationChannels, channel) {
+			errors = append(errors, ValidationError{
+				Field:   "channels",
+				Code:    CodeValueNotAllowed,
+				Message: "unknown channel " + channel,
+			})
+		}
+	}
+	for _, status := range req.OptOut {
+		if !slices.Contains(common.OrderResultStatuses, status) {
+			errors = append(errors, ValidationError{
+				Field:   "opt_out",
+				Code:    CodeValueNotAllowed,
+				Message: "unknown order status " + status,
+			})
+		}
+	}
+	return errors
+}
+
+// handleGetNotificationPreferences returns a user's notification preferences, or the defaults
+// ("default": true) if they never set any
+func handleGetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	correlationID := uuid.New().String()
+	userID := r.PathValue("user_id")
+	w.Header().Set("Content-Type", "application/json")
+
+	if validationErrors := validateID("user_id", userID, maxUserIDLength); len(validationErrors) > 0 {
+		writeError(w, r, http.StatusBadRequest, ErrCodeValidationFailed, correlationID, map[string]interface{}{
+			"errors": validationErrors,
+		})
+		return
+	}
+
+	preferences, err := notificationPreferences.Load(r.Context(), userID)
+	if err != nil {
+		common.WithCorrelationID(correlationID).WithError(err).Error("Failed to read notification preferences")
+		writeError(w, r, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, correlationID, nil)
+		return
+	}
+	response := map[string]interface{}{
+		"user_id":        userID,
+		"correlation_id": correlationID,
+	}
+	if preferences == nil {
+		response["channels"] = defaultNotificationChannels
+		response["opt_out"] = []string{}
+		response["default"] = true
+	} else {
+		response["channels"] = preferences.Channels
+		response["opt_out"] = preferences.OptOut
+		response["updated_at"] = preferences.UpdatedAt
+		response["default"] = false
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// handlePutNotificationPreferences replaces a user's notification preferences
+func handlePutNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	correlationID := uuid.New().String()
+	userID := r.PathValue("user_id")
+	logEntry := common.WithEvent(correlationID, "notification_preferences_requested").WithField("client_ip", clientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+
+	var req NotificationPreferencesRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		logEntry.WithError(err).Warn("Invalid notification preferences body")
+		writeError(w, r, http.StatusBadRequest, ErrCodeInvalidBody, correlationID, map[string]interface{}{
+			"errors": []ValidationError{decodeErrorToValidationError(err)},
+		})
+		return
+	}
+	validationErrors := append(validateID("user_id", userID, maxUserIDLength), validateNotificationPreferences(req)...)
+	if len(validationErrors) > 0 {
+		writeError(w, r, http.StatusBadRequest, ErrCodeValidationFailed, correlationID, map[string]interface{}{
+			"errors": validationErrors,
+		})
+		return
+	}
+
+	preferences := common.NotificationPreferences{
+		UserID:    userID,
+		Channels:  slices.Compact(slices.Sorted(slices.Values(req.Channels))),
+		OptOut:    slices.Compact(slices.Sorted(slices.Values(req.OptOut))),
+		UpdatedAt: time.Now().UTC(),
+	}
+	// Keep empty lists as [] rather than null; an empty channel list is a deliberate opt-out
+	if preferences.Channels == nil {
+		preferences.Channels = []string{}
+	}
+	if preferences.OptOut == nil {
+		preferences.OptOut = []string{}
+	}
+	if err := notificationPreferences.Save(r.Context(), preferences); err != nil {
+		logEntry.WithError(err).Error("Failed to store notification preferences")
+		writeError(w, r, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, correlationID, nil)
+		return
+	}
+	logEntry.WithFields(map[string]interface{}{
+		"event":    "notification_preferences_updated",
+		"user_id":  userID,
+		"channels": preferences.Channels,
+		"opt_out":  preferences.OptOut,
+	}).Info("Notification preferences updated")
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id":        userID,
+		"channels":       preferences.Channels,
+		"opt_out":        preferences.OptOut,
+		"updated_at":     preferences.UpdatedAt,
+		"default":        false,
+		"correlation_id": correlationID,
+	})
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// Order amendment outcomes
+const (
+	AmendmentApplied    = "AMENDED"
+	AmendmentNotFound   = "NOT_FOUND"
+	AmendmentProcessing = "ALREADY_PROCESSING"
+	AmendmentCancelled  = "ALREADY_CANCELLED"
+	AmendmentConflict   = "CONFLICT"
+)
+
+// amendableOrderTTL matches the order status TTL
+const amendableOrderTTL = 30 * time.Minute
+
+// luaAmendOrderScript records an amendment unless the processor has claimed the order
+// KEYS[1] is the order hash amendable_order:{request_id} (user_id, item_id, amount, cancelled),
+// KEYS[2] order_claimed:{request_id}, KEYS[3] order_amendment:{request_id}
+// ARGV: user_id, amendment JSON, new amount ("0" to cancel), expected current amount, TTL in seconds
+// The expected amount makes concurrent amendments fail (CONFLICT) instead of overwriting each other
+const luaAmendOrderScript = `
+if redis.call('EXISTS', KEYS[2]) == 1 then
+    return 'ALREADY_PROCESSING'
+end
+if redis.call('HGET', KEYS[1], 'user_id') ~= ARGV[1] then
+    return 'NOT_FOUND'
+end
+if redis.call('HGET', KEYS[1], 'cancelled') == '1' then
+    return 'ALREADY_CANCELLED'
+end
+if redis.call('HGET', KEYS[1], 'amount') ~= ARGV[4] then
+    return 'CONFLICT'
+end
+
+redis.call('SET', KEYS[3], ARGV[2], 'EX', ARGV[5])
+if ARGV[3] == '0' then
+    redis.call('HSET', KEYS[1], 'cancelled', '1')
+else
+    redis.call('HSET', KEYS[1], 'amount', ARGV[3])
+end
+return 'AMENDED'
+`
+
+var amendOrderScript = redis.NewScript(luaAmendOrderScript)
+
+// orderAmendmentsEnabled makes queued orders amendable (ORDER_AMENDMENTS_ENABLED)
+var orderAmendmentsEnabled bool
+
+// amendableOrderKey holds what PATCH /order needs to authorize and apply an amendment
+func amendableOrderKey(requestID string) string {
+	return "amendable_order:" + requestID
+}
+
+// recordAmendableOrder stores a newly accepted order so its client can amend it while it is queued
+func recordAmendableOrder(ctx context.Context, order *OrderRequest) error {
+	key := amendableOrderKey(order.RequestID)
+	_, err := redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, map[string]interface{}{
+			"user_id": order.UserID,
+			"item_id": order.ItemID,
+			"amount":  order.Amount,
+		})
+		pipe.Expire(ctx, key, amendableOrderTTL)
+		return nil
+	})
+	return err
+}
+
+// OrderAmendmentRequest is the body of PATCH /order/{request_id}
+// Exactly one of Amount and Cancel must be set
+type OrderAmendmentRequest struct {
+	UserID string `json:"user_id"` // Must match the order's buyer
+	Amount int64  `json:"amount,omitempty"`
+	Cancel bool   `json:"cancel,omitempty"`
+}
+
+// handleAmendOrder changes the quantity of, or cancels, an order that is still queued
+// The processor applies the amendment when it picks the order up; once it has, 409 is returned
+func handleAmendOrder(w http.ResponseWriter, r *http.Request) {
+	correlationID := uuid.New().String()
+	requestID := r.PathValue("request_id")
+	logEntry := common.WithEvent(correlationID, "order_amendment_requested").WithFields(map[string]interface{}{
+		"client_ip":  clientIP(r),
+		"request_id": requestID,
+	})
+	w.Header().Set("Content-Type", "application/json")
+
+	var amendment OrderAmendmentRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&amendment); err != nil {
+		logEntry.WithError(err).Warn("Invalid order amendment body")
+		writeError(w, r, http.StatusBadRequest, ErrCodeInvalidBody, correlationID, map[string]interface{}{
+			"errors": []ValidationError{decodeErrorToValidationError(err)},
+		})
+		return
+	}
+	validationErrors := validateID("user_id", amendment.UserID, maxUserIDLength)
+	switch {
+	case amendment.Cancel && amendment.Amount != 0:
+		validationErrors = append(validationErrors, ValidationError{
+			Field:   "amount",
+			Code:    CodeValueNotAllowed,
+			Message: "amount cannot be combined with cancel",
+		})
+	case !amendment.Cancel && amendment.Amount < minAmount:
+		validationErrors = append(validationErrors, ValidationError{
+			Field:   "amount",
+			Code:    CodeTooSmall,
+			Message: fmt.Sprintf("amount must be at least %d", minAmount),
+			Params:  []interface{}{minAmount},
+		})
+	case !amendment.Cancel && amendment.Amount > maxAmount:
+		validationErrors = append(validationErrors, ValidationError{
+			Field:   "amount",
+			Code:    CodeTooLarge,
+			Message: fmt.Sprintf("amount must be at most %d", maxAmount),
+			Params:  []interface{}{maxAmount},
+		})
+	}
+	if len(validationErrors) > 0 {
+		writeError(w, r, http.StatusBadRequest, ErrCodeValidationFailed, correlationID, map[string]interface{}{
+			"errors": validationErrors,
+		})
+		return
+	}
+	logEntry = logEntry.WithField("user_id", amendment.UserID)
+
+	reqCtx := r.Context()
+	stored, err := redisClient.HGetAll(reqCtx, amendableOrderKey(requestID)).Result()
+	if err != nil {
+		redisHealth.Observe(err)
+		logEntry.WithError(err).Error("Failed to read amendable order")
+		writeError(w, r, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, correlationID, nil)
+		return
+	}
+	// Orders of other users are reported as missing so request IDs can't be probed
+	if stored["user_id"] != amendment.UserID {
+		writeError(w, r, http.StatusNotFound, ErrCodeOrderNotFound, correlationID, nil)
+		return
+	}
+	itemID := stored["item_id"]
+	currentAmount, _ := strconv.ParseInt(stored["amount"], 10, 64)
+
+	// Growing a capped order must still fit the cap; the processor counts the amended quantity
+	// when it reserves it
+	if !amendment.Cancel && purchaseAdmission.CapFor(itemID) > 0 && amendment.Amount > currentAmount {
+		admission, purchased, err := purchaseAdmission.Check(reqCtx, amendment.UserID, itemID, amendment.Amount-currentAmount)
+		if err != nil {
+			redisHealth.Observe(err)
+			logEntry.WithError(err).Error("Purchase admission check failed")
+			writeError(w, r, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, correlationID, nil)
+			return
+		}
+		if admission != AdmissionAdmitted {
+			metrics.PurchaseAdmission.WithLabelValues("cap_exceeded").Inc()
+			writeError(w, r, http.StatusForbidden, ErrCodePurchaseCap, correlationID, map[string]interface{}{
+				"limit":     purchaseAdmission.CapFor(itemID),
+				"purchased": purchased,
+			})
+			return
+		}
+	}
+
+	marker := common.OrderAmendment{Action: common.AmendmentQuantity, Amount: amendment.Amount, AmendedAt: time.Now().UTC()}
+	newAmount := amendment.Amount
+	if amendment.Cancel {
+		marker = common.OrderAmendment{Action: common.AmendmentCancel, AmendedAt: marker.AmendedAt}
+		newAmount = 0
+	}
+	markerBytes, _ := json.Marshal(marker)
+	outcome, err := amendOrderScript.Run(reqCtx, redisClient,
+		[]string{amendableOrderKey(requestID), common.OrderClaimKey(requestID), common.OrderAmendmentKey(requestID)},
+		amendment.UserID, string(markerBytes), newAmount, currentAmount, int64(amendableOrderTTL.Seconds())).Text()
+	if err != nil {
+		redisHealth.Observe(err)
+		logEntry.WithError(err).Error("Failed to record order amendment")
+		writeError(w, r, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, correlationID, nil)
+		return
+	}
+	metrics.OrderAmendments.WithLabelValues(marker.Action, outcome).Inc()
+	switch outcome {
+	case AmendmentNotFound:
+		writeError(w, r, http.StatusNotFound, ErrCodeOrderNotFound, correlationID, nil)
+		return
+	case AmendmentProcessing, AmendmentCancelled, AmendmentConflict:
+		logEntry.WithField("outcome", outcome).Warn("Order amendment refused")
+		writeError(w, r, http.StatusConflict, ErrCodeOrderNotAmendable, correlationID, map[string]interface{}{
+			"reason": outcome,
+		})
+		return
+	}
+
+	// Applied: the queued order no longer holds what it gave up
+	status := "AMENDED"
+	if amendment.Cancel {
+		status = "CANCELLED"
+		intents.Release(reqCtx, amendment.UserID, itemID, requestID)
+		if err := statusStore.SetStatus(reqCtx, requestID, status, amendableOrderTTL); err != nil {
+			redisHealth.Observe(err)
+			logEntry.WithError(err).Warn("Failed to update order status")
+		}
+	}
+	logEntry.WithFields(map[string]interface{}{
+		"event":           "order_amended",
+		"action":          marker.Action,
+		"item_id":         itemID,
+		"previous_amount": currentAmount,
+		"amount":          newAmount,
+	}).Info("Order amended while queued")
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"request_id":     requestID,
+		"status":         status,
+		"amount":         newAmount,
+		"correlation_id": correlationID,
+	})
+}
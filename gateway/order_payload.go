@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/IBM/sarama"
+	orderpb "github.com/yourname/flash-sale-engine/common/proto"
+)
+
+// Order payload encodings (ORDER_PAYLOAD_FORMAT)
+const (
+	OrderPayloadJSON     = "json"     // Read by every processor release (default)
+	OrderPayloadProtobuf = "protobuf" // common/proto/order.proto, smaller; only once every processor reads it
+)
+
+// orderPayloadFormat is how orders are encoded on the orders topics
+// JSON stays the default so a rolling upgrade never sends protobuf to a processor that can't read it
+var orderPayloadFormat = OrderPayloadJSON
+
+// encodeOrderPayload encodes order for Kafka and returns the header naming its encoding, if any
+// JSON orders carry no content_type header, like those of earlier releases
+func encodeOrderPayload(order *OrderRequest) ([]byte, []sarama.RecordHeader) {
+	if orderPayloadFormat == OrderPayloadJSON {
+		payload, _ := json.Marshal(order)
+		return payload, nil
+	}
+	payload := (&orderpb.Order{
+		UserID:          order.UserID,
+		ItemID:          order.ItemID,
+		Amount:          order.Amount,
+		RequestID:       order.RequestID,
+		Channel:         order.Channel,
+		RecipientUserID: order.RecipientUserID,
+		Address:         order.Address,
+		DeviceID:        order.DeviceID,
+		Metadata:        order.Metadata,
+		Lines:           order.Lines,
+		CartPolicy:      order.CartPolicy,
+	}).Marshal()
+	return payload, []sarama.RecordHeader{{Key: []byte(orderpb.HeaderContentType), Value: []byte(orderpb.ContentType)}}
+}
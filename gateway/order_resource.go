@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// publicBaseURL prefixes the status_url/events_url links returned to clients (PUBLIC_BASE_URL)
+// Empty yields relative links, which suits clients that call the gateway directly
+var publicBaseURL = ""
+
+// orderEventsTimeout bounds a single long-poll or SSE stream on the events endpoint (ORDER_EVENTS_TIMEOUT)
+var orderEventsTimeout = 30 * time.Second
+
+// orderTimelineEnabled records each order's received, admitted and queued times in its timeline
+// (ORDER_TIMELINE_ENABLED); processors record the later stages
+var orderTimelineEnabled bool
+
+// orderStatusURL is the link to GET /order/{request_id}
+func orderStatusURL(requestID string) string {
+	return publicBaseURL + "/order/" + requestID
+}
+
+// orderEventsURL is the link to GET /order/{request_id}/events
+func orderEventsURL(requestID string) string {
+	return orderStatusURL(requestID) + "/events"
+}
+
+// orderResource is the JSON representation of an order's tracked status
+func orderResource(requestID, status, correlationID string) map[string]interface{} {
+	return map[string]interface{}{
+		"request_id":     requestID,
+		"status":         status,
+		"terminal":       common.IsTerminalStatus(status),
+		"status_url":     orderStatusURL(requestID),
+		"events_url":     orderEventsURL(requestID),
+		"correlation_id": correlationID,
+	}
+}
+
+// handleGetOrder returns the current status of an order
+func handleGetOrder(w http.ResponseWriter, r *http.Request) {
+	correlationID := uuid.New().String()
+	requestID := r.PathValue("request_id")
+	logEntry := common.WithEvent(correlationID, "order_status_requested").WithFields(map[string]interface{}{
+		"client_ip":  clientIP(r),
+		"request_id": requestID,
+	})
+	w.Header().Set("Content-Type", "application/json")
+
+	status, err := statusStore.GetStatus(r.Context(), requestID)
+	if err != nil {
+		redisHealth.Observe(err)
+		logEntry.WithError(err).Error("Failed to read order status")
+		writeError(w, r, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, correlationID, nil)
+		return
+	}
+	if status == "" {
+		writeError(w, r, http.StatusNotFound, ErrCodeOrderNotFound, correlationID, nil)
+		return
+	}
+	response := orderResource(requestID, status, correlationID)
+	// The latest result adds the reason, remaining stock and latency; the status alone still answers
+	if status != common.StatusProcessing {
+		result, err := statusStore.GetResult(r.Context(), requestID)
+		if err != nil {
+			logEntry.WithError(err).Warn("Failed to read order result")
+		} else if result != nil && result.Status == status {
+			response["result"] = result
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// recordGatewayTimeline appends the gateway's stages of a queued order to its timeline
+// Like the status it is non-essential: skipped while Redis is degraded, and failures only log
+func recordGatewayTimeline(ctx context.Context, logEntry *logrus.Entry, requestID string, receivedAt, admittedAt time.Time, detail string) {
+	if !orderTimelineEnabled || redisHealth.Degraded() {
+		return
+	}
+	ctx, cancel := rollbackContext(ctx)
+	defer cancel()
+	err := common.AppendOrderTimeline(ctx, redisClient, requestID,
+		common.TimelineEvent{Stage: common.TimelineReceived, At: receivedAt, Service: "gateway"},
+		common.TimelineEvent{Stage: common.TimelineAdmitted, At: admittedAt, Service: "gateway"},
+		common.TimelineEvent{Stage: common.TimelineQueued, At: time.Now(), Service: "gateway", Detail: detail},
+	)
+	if err != nil {
+		redisHealth.Observe(err)
+		logEntry.WithError(err).Warn("Failed to record order timeline")
+	}
+}
+
+// timelineEntry is a timeline event with the time spent since the previous stage
+type timelineEntry struct {
+	common.TimelineEvent
+	SincePreviousMs int64 `json:"since_previous_ms"`
+}
+
+// handleOrderTimeline returns the stages an order went through with their times
+// (GET /order/{request_id}/events?timeline=true); it never waits for new events
+func handleOrderTimeline(w http.ResponseWriter, r *http.Request, logEntry *logrus.Entry, requestID, correlationID string) {
+	status, err := statusStore.GetStatus(r.Context(), requestID)
+	if err != nil {
+		redisHealth.Observe(err)
+		logEntry.WithError(err).Error("Failed to read order status")
+		writeError(w, r, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, correlationID, nil)
+		return
+	}
+	events, err := statusStore.GetTimeline(r.Context(), requestID)
+	if err != nil {
+		redisHealth.Observe(err)
+		logEntry.WithError(err).Error("Failed to read order timeline")
+		writeError(w, r, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, correlationID, nil)
+		return
+	}
+	if status == "" && len(events) == 0 {
+		writeError(w, r, http.StatusNotFound, ErrCodeOrderNotFound, correlationID, nil)
+		return
+	}
+
+	entries := make([]timelineEntry, len(events))
+	for i, event := range events {
+		entries[i] = timelineEntry{TimelineEvent: event}
+		if i > 0 {
+			entries[i].SincePreviousMs = event.At.Sub(events[i-1].At).Milliseconds()
+		}
+	}
+	response := orderResource(requestID, status, correlationID)
+	response["timeline"] = entries
+	if len(events) > 1 {
+		response["total_ms"] = events[len(events)-1].At.Sub(events[0].At).Milliseconds()
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleOrderEvents delivers status changes for an order
+// Clients sending Accept: text/event-stream get an SSE stream that ends at a terminal status;
+// everyone else gets a long-poll that returns on the next result or after ORDER_EVENTS_TIMEOUT
+// With ?timeline=true the order's recorded stages are returned at once instead
+func handleOrderEvents(w http.ResponseWriter, r *http.Request) {
+	correlationID := uuid.New().String()
+	requestID := r.PathValue("request_id")
+	logEntry := common.WithEvent(correlationID, "order_events_requested").WithFields(map[string]interface{}{
+		"client_ip":  clientIP(r),
+		"request_id": requestID,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	reqCtx := r.Context()
+
+	if timeline, _ := strconv.ParseBool(r.URL.Query().Get("timeline")); timeline {
+		handleOrderTimeline(w, r, logEntry, requestID, correlationID)
+		return
+	}
+
+	// Subscribe before reading the status so a result published in between is not missed
+	sub, err := subscribeOrderResult(reqCtx, requestID)
+	if err != nil {
+		redisHealth.Observe(err)
+		logEntry.WithError(err).Error("Failed to subscribe to order results")
+		writeError(w, r, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, correlationID, nil)
+		return
+	}
+	defer sub.Close()
+
+	status, err := statusStore.GetStatus(reqCtx, requestID)
+	if err != nil {
+		redisHealth.Observe(err)
+		logEntry.WithError(err).Error("Failed to read order status")
+		writeError(w, r, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, correlationID, nil)
+		return
+	}
+	if status == "" {
+		writeError(w, r, http.StatusNotFound, ErrCodeOrderNotFound, correlationID, nil)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		streamOrderEvents(w, r, sub, requestID, status, correlationID)
+		return
+	}
+
+	response := orderResource(requestID, status, correlationID)
+	if common.IsTerminalStatus(status) {
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	result, err := awaitOrderResult(reqCtx, sub, orderEventsTimeout)
+	if err != nil {
+		logEntry.WithError(err).Warn("Failed to read order result")
+	}
+	if result != nil {
+		response = orderResource(requestID, result.Status, correlationID)
+		response["result"] = result
+	} else {
+		response["timed_out"] = true
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// streamOrderEvents writes the current status and every following result as SSE status events
+// The stream closes after a terminal status, ORDER_EVENTS_TIMEOUT, or client disconnect
+func streamOrderEvents(w http.ResponseWriter, r *http.Request, sub *redis.PubSub, requestID, status, correlationID string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, correlationID, nil)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	writeEvent := func(payload map[string]interface{}) {
+		data, _ := json.Marshal(payload)
+		fmt.Fprintf(w, "event: status\ndata: %s\n\n", data)
+		flusher.Flush()
+	}
+
+	writeEvent(orderResource(requestID, status, correlationID))
+	if common.IsTerminalStatus(status) {
+		return
+	}
+
+	timeout := time.NewTimer(orderEventsTimeout)
+	defer timeout.Stop()
+	results := sub.Channel()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-timeout.C:
+			fmt.Fprint(w, "event: timeout\ndata: {}\n\n")
+			flusher.Flush()
+			return
+		case msg, ok := <-results:
+			if !ok {
+				return
+			}
+			var result common.OrderResult
+			if err := json.Unmarshal([]byte(msg.Payload), &result); err != nil {
+				continue
+			}
+			payload := orderResource(requestID, result.Status, correlationID)
+			payload["result"] = result
+			writeEvent(payload)
+			if common.IsTerminalStatus(result.Status) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sirupsen/logrus"
+	"github.com/sony/gobreaker"
+)
+
+// ErrOutageBufferFull is returned when the outage buffer has reached its capacity
+var ErrOutageBufferFull = errors.New("outage buffer full")
+
+// bufferedMessage is the persisted form of a Kafka message held during an outage
+type bufferedMessage struct {
+	Topic      string          `json:"topic"`
+	Key        []byte          `json:"key,omitempty"`
+	Value      []byte          `json:"value"`
+	Headers    bufferedHeaders `json:"headers"`
+	BufferedAt time.Time       `json:"buffered_at"`
+}
+
+// bufferedHeader is one record header, kept as bytes like Kafka does
+type bufferedHeader struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// bufferedHeaders keeps a message's headers in order, duplicates included
+type bufferedHeaders []bufferedHeader
+
+// UnmarshalJSON also reads buffer files written when headers were persisted as an object
+func (h *bufferedHeaders) UnmarshalJSON(data []byte) error {
+	var headers []bufferedHeader
+	if err := json.Unmarshal(data, &headers); err == nil {
+		*h = headers
+		return nil
+	}
+	var legacy map[string]string
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return err
+	}
+	*h = make(bufferedHeaders, 0, len(legacy))
+	for key, value := range legacy {
+		*h = append(*h, bufferedHeader{Key: key, Value: []byte(value)})
+	}
+	sort.Slice(*h, func(i, j int) bool { return (*h)[i].Key < (*h)[j].Key })
+	return nil
+}
+
+// OutageBuffer holds orders accepted while Kafka is unavailable (circuit open) and publishes
+// them in arrival order once the circuit closes; new orders are buffered behind them until the
+// buffer is empty (see handleBuy)
+// Idempotency keys are kept for buffered orders, so duplicates are still rejected during the outage
+// With a file path configured the buffer is persisted (JSON lines) and reloaded on restart
+type OutageBuffer struct {
+	flushing sync.Mutex // Held by Flush, so the head is sent by one flush at a time
+	mu       sync.Mutex // Guards queue and the file; never held across a Kafka send
+	queue    []bufferedMessage
+	capacity int
+	path     string // Empty for memory-only buffering
+}
+
+// NewOutageBuffer creates a buffer holding at most capacity messages
+// If path is set, messages persisted by a previous run are loaded
+func NewOutageBuffer(capacity int, path string) (*OutageBuffer, error) {
+	ob := &OutageBuffer{capacity: capacity, path: path}
+	if path != "" {
+		if err := ob.load(); err != nil {
+			return nil, err
+		}
+	}
+	return ob, nil
+}
+
+// Enqueue adds msg to the end of the buffer
+// Returns ErrOutageBufferFull when at capacity; the caller should reject the order
+func (ob *OutageBuffer) Enqueue(msg *sarama.ProducerMessage) error {
+	buffered, err := toBufferedMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	if len(ob.queue) >= ob.capacity {
+		return ErrOutageBufferFull
+	}
+	if ob.path != "" {
+		if err := ob.appendToFile(buffered); err != nil {
+			return err
+		}
+	}
+	ob.queue = append(ob.queue, buffered)
+	return nil
+}
+
+// Len returns the number of buffered messages
+func (ob *OutageBuffer) Len() int {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return len(ob.queue)
+}
+
+// Run flushes the buffer every interval while the circuit is not open, until ctx is cancelled
+func (ob *OutageBuffer) Run(ctx context.Context, cb *CircuitBreaker, interval time.Duration, logger *logrus.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if cb.State() == gobreaker.StateOpen || ob.Len() == 0 {
+				continue
+			}
+			sent, err := ob.Flush(ctx, cb)
+			metrics.OutageBufferSize.Set(float64(ob.Len()))
+			entry := logger.WithFields(logrus.Fields{
+				"event":     "outage_buffer_flush",
+				"sent":      sent,
+				"remaining": ob.Len(),
+			})
+			if err != nil {
+				entry.WithError(err).Warn("Outage buffer flush interrupted")
+			} else if sent > 0 {
+				entry.Info("Outage buffer flushed")
+			}
+		}
+	}
+}
+
+// Flush publishes buffered messages in order through the circuit breaker
+// Stops at the first failure, or when ctx is done, so ordering is preserved; the failed message
+// stays at the head. Each send is bounded by the breaker's KAFKA_SEND_TIMEOUT
+// The head is sent without holding the buffer lock, so orders are enqueued behind it meanwhile
+func (ob *OutageBuffer) Flush(ctx context.Context, cb *CircuitBreaker) (int, error) {
+	ob.flushing.Lock()
+	defer ob.flushing.Unlock()
+
+	sent := 0
+	var flushErr error
+	for {
+		ob.mu.Lock()
+		if len(ob.queue) == 0 {
+			ob.mu.Unlock()
+			break
+		}
+		head := ob.queue[0]
+		ob.mu.Unlock()
+
+		// A timed-out message stays at the head; if it was delivered after all, the processor
+		// drops the resend as a duplicate
+		if _, _, err := cb.SendMessage(ctx, head.toProducerMessage()); err != nil {
+			flushErr = err
+			break
+		}
+		// Only Flush removes messages, so the head is still the message just sent
+		ob.mu.Lock()
+		ob.queue = ob.queue[1:]
+		ob.mu.Unlock()
+		sent++
+	}
+
+	if sent > 0 && ob.path != "" {
+		ob.mu.Lock()
+		err := ob.rewriteFile()
+		ob.mu.Unlock()
+		if err != nil && flushErr == nil {
+			flushErr = err
+		}
+	}
+	return sent, flushErr
+}
+
+func toBufferedMessage(msg *sarama.ProducerMessage) (bufferedMessage, error) {
+	buffered := bufferedMessage{
+		Topic:      msg.Topic,
+		Headers:    make(bufferedHeaders, 0, len(msg.Headers)),
+		BufferedAt: time.Now(),
+	}
+	if msg.Key != nil {
+		key, err := msg.Key.Encode()
+		if err != nil {
+			return buffered, err
+		}
+		buffered.Key = key
+	}
+	if msg.Value != nil {
+		value, err := msg.Value.Encode()
+		if err != nil {
+			return buffered, err
+		}
+		buffered.Value = value
+	}
+	for _, header := range msg.Headers {
+		buffered.Headers = append(buffered.Headers, bufferedHeader{Key: string(header.Key), Value: header.Value})
+	}
+	return buffered, nil
+}
+
+func (bm bufferedMessage) toProducerMessage() *sarama.ProducerMessage {
+	msg := &sarama.ProducerMessage{
+		Topic: bm.Topic,
+		Value: sarama.ByteEncoder(bm.Value),
+	}
+	if bm.Key != nil {
+		msg.Key = sarama.ByteEncoder(bm.Key)
+	}
+	for _, header := range bm.Headers {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(header.Key), Value: header.Value})
+	}
+	msg.Headers = append(msg.Headers, sarama.RecordHeader{
+		Key:   []byte("buffered_at"),
+		Value: []byte(bm.BufferedAt.Format(time.RFC3339)),
+	})
+	return msg
+}
+
+// load reads persisted messages from the buffer file, if it exists
+func (ob *OutageBuffer) load() error {
+	file, err := os.Open(ob.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var buffered bufferedMessage
+		if err := json.Unmarshal(scanner.Bytes(), &buffered); err != nil {
+			return err
+		}
+		ob.queue = append(ob.queue, buffered)
+	}
+	return scanner.Err()
+}
+
+func (ob *OutageBuffer) appendToFile(buffered bufferedMessage) error {
+	file, err := os.OpenFile(ob.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	line, err := json.Marshal(buffered)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// rewriteFile replaces the buffer file with the remaining queue (write to temp + rename)
+func (ob *OutageBuffer) rewriteFile() error {
+	tmpPath := ob.path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	for _, buffered := range ob.queue {
+		line, err := json.Marshal(buffered)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		if _, err := writer.Write(append(line, '\n')); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, ob.path)
+}
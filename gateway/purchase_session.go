@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// PurchaseTokenHeader carries the purchase token issued by /session on /buy requests
+const PurchaseTokenHeader = "X-Purchase-Token"
+
+// Purchase token errors
+var (
+	ErrPurchaseTokenMissing  = errors.New("purchase token missing")
+	ErrPurchaseTokenInvalid  = errors.New("purchase token invalid")
+	ErrPurchaseTokenExpired  = errors.New("purchase token expired")
+	ErrPurchaseTokenMismatch = errors.New("purchase token issued for another user or item")
+)
+
+// PurchaseToken binds a purchase attempt to the user and item admitted by /session
+type PurchaseToken struct {
+	SessionID string `json:"sid"`
+	UserID    string `json:"uid"`
+	ItemID    string `json:"iid"`
+	ExpiresAt int64  `json:"exp"` // Unix seconds
+}
+
+// PurchaseTokenIssuer issues and verifies purchase tokens
+// Tokens are stateless (HMAC-signed), so any gateway instance can verify tokens issued by another
+type PurchaseTokenIssuer struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewPurchaseTokenIssuer creates an issuer whose tokens are valid for ttl
+func NewPurchaseTokenIssuer(secret string, ttl time.Duration) (*PurchaseTokenIssuer, error) {
+	if len(secret) < 32 {
+		return nil, errors.New("purchase token secret must be at least 32 bytes")
+	}
+	return &PurchaseTokenIssuer{secret: []byte(secret), ttl: ttl}, nil
+}
+
+// Issue returns a signed token for userID and itemID
+func (p *PurchaseTokenIssuer) Issue(userID, itemID string, now time.Time) (string, *PurchaseToken) {
+	return p.IssueUntil(userID, itemID, now.Add(p.ttl))
+}
+
+// IssueUntil returns a signed token for userID and itemID valid until expiresAt (e.g. waitlist offers)
+func (p *PurchaseTokenIssuer) IssueUntil(userID, itemID string, expiresAt time.Time) (string, *PurchaseToken) {
+	claims := &PurchaseToken{
+		SessionID: uuid.New().String(),
+		UserID:    userID,
+		ItemID:    itemID,
+		ExpiresAt: expiresAt.Unix(),
+	}
+	payload, _ := json.Marshal(claims)
+	return common.EncodeSignedToken(p.secret, payload), claims
+}
+
+// Verify checks token's signature and expiry and that it was issued for userID and itemID
+func (p *PurchaseTokenIssuer) Verify(token, userID, itemID string, now time.Time) (*PurchaseToken, error) {
+	if token == "" {
+		return nil, ErrPurchaseTokenMissing
+	}
+	payload, err := common.DecodeSignedToken(p.secret, token)
+	if err != nil {
+		return nil, ErrPurchaseTokenInvalid
+	}
+	var claims PurchaseToken
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrPurchaseTokenInvalid
+	}
+	if now.Unix() > claims.ExpiresAt {
+		return nil, ErrPurchaseTokenExpired
+	}
+	if claims.UserID != userID || claims.ItemID != itemID {
+		return nil, ErrPurchaseTokenMismatch
+	}
+	return &claims, nil
+}
+
+// purchaseTokenResult maps a Verify error to a metric/log label
+func purchaseTokenResult(err error) string {
+	switch {
+	case err == nil:
+		return "valid"
+	case errors.Is(err, ErrPurchaseTokenMissing):
+		return "missing"
+	case errors.Is(err, ErrPurchaseTokenExpired):
+		return "expired"
+	case errors.Is(err, ErrPurchaseTokenMismatch):
+		return "mismatch"
+	default:
+		return "invalid"
+	}
+}
+
+// SessionRequest is the body of POST /session
+type SessionRequest struct {
+	UserID string `json:"user_id"`
+	ItemID string `json:"item_id"`
+}
+
+// SessionGate decides whether a client may enter the purchase flow
+// Waiting rooms and challenge providers register gates; a token is only issued once every gate
+// admits the request
+type SessionGate interface {
+	Name() string
+	Admit(r *http.Request, session SessionRequest) (bool, error)
+}
+
+var (
+	sessionGatesMu sync.RWMutex
+	sessionGates   []SessionGate
+)
+
+// RegisterSessionGate adds a gate consulted by /session
+func RegisterSessionGate(gate SessionGate) {
+	sessionGatesMu.Lock()
+	defer sessionGatesMu.Unlock()
+	sessionGates = append(sessionGates, gate)
+}
+
+// sessionGateCount returns the number of registered session gates
+func sessionGateCount() int {
+	sessionGatesMu.RLock()
+	defer sessionGatesMu.RUnlock()
+	return len(sessionGates)
+}
+
+// UserTokenGate admits a session only for the user its bearer token was issued to, so /session
+// can't mint purchase tokens for arbitrary user_ids
+type UserTokenGate struct {
+	verifier *UserTokenVerifier
+}
+
+// NewUserTokenGate creates a gate checking bearer tokens with verifier
+func NewUserTokenGate(verifier *UserTokenVerifier) *UserTokenGate {
+	return &UserTokenGate{verifier: verifier}
+}
+
+// Name identifies the gate in logs
+func (g *UserTokenGate) Name() string { return "user_token" }
+
+// Admit reports whether the request's bearer token is valid and belongs to session.UserID
+func (g *UserTokenGate) Admit(r *http.Request, session SessionRequest) (bool, error) {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	claims, err := g.verifier.Verify(strings.TrimSpace(token), time.Now())
+	if err != nil {
+		return false, nil
+	}
+	return claims.UserID == session.UserID, nil
+}
+
+// admitSession runs the registered gates in order and returns the first gate that refused or failed
+func admitSession(r *http.Request, session SessionRequest) (string, bool, error) {
+	sessionGatesMu.RLock()
+	defer sessionGatesMu.RUnlock()
+	for _, gate := range sessionGates {
+		admitted, err := gate.Admit(r, session)
+		if err != nil || !admitted {
+			return gate.Name(), admitted, err
+		}
+	}
+	return "", true, nil
+}
+
+// handleSession issues a purchase token for POST {"user_id", "item_id"} once all gates admit the client
+// The per-IP and per-user rate limits of /buy apply too, so tokens can't be fetched in bulk
+func handleSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	correlationID := uuid.New().String()
+	ip := clientIP(r)
+	logEntry := common.WithEvent(correlationID, "session_requested").WithField("client_ip", ip)
+	w.Header().Set("Content-Type", "application/json")
+
+	if ipConcurrency != nil {
+		if !ipConcurrency.Acquire(ip) {
+			metrics.IPLimited.WithLabelValues("concurrency").Inc()
+			logEntry.WithField("event", "ip_concurrency_exceeded").Warn("Too many concurrent requests from IP")
+			writeError(w, r, http.StatusTooManyRequests, ErrCodeTooManyConcurrent, correlationID, nil)
+			return
+		}
+		defer ipConcurrency.Release(ip)
+	}
+	if ipRateLimiter != nil {
+		allowed, err := ipRateLimiter.Allow(r.Context(), "ip:"+ip)
+		if err != nil {
+			redisHealth.Observe(err)
+			logEntry.WithError(err).Warn("IP rate limiter check failed, allowing request")
+		} else if !allowed {
+			metrics.IPLimited.WithLabelValues("rate").Inc()
+			logEntry.WithField("event", "ip_rate_limit_exceeded").Warn("IP rate limit exceeded")
+			writeError(w, r, http.StatusTooManyRequests, ErrCodeRateLimited, correlationID, map[string]interface{}{
+				"retry_after_seconds": int(ipRateLimitWindow.Seconds()),
+			})
+			return
+		}
+	}
+
+	var session SessionRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&session); err != nil {
+		logEntry.WithError(err).Warn("Invalid session request body")
+		writeError(w, r, http.StatusBadRequest, ErrCodeInvalidBody, correlationID, map[string]interface{}{
+			"errors": []ValidationError{decodeErrorToValidationError(err)},
+		})
+		return
+	}
+	validationErrors := append(validateID("user_id", session.UserID, maxUserIDLength),
+		validateID("item_id", session.ItemID, maxItemIDLength)...)
+	if len(validationErrors) > 0 {
+		writeError(w, r, http.StatusBadRequest, ErrCodeValidationFailed, correlationID, map[string]interface{}{
+			"errors": validationErrors,
+		})
+		return
+	}
+	logEntry = logEntry.WithFields(map[string]interface{}{
+		"user_id": session.UserID,
+		"item_id": session.ItemID,
+	})
+
+	// Sessions count against the user's own limit, separately from their /buy requests
+	if allowed, err := rateLimiter.Allow(r.Context(), "session:"+session.UserID); err != nil {
+		redisHealth.Observe(err)
+		logEntry.WithError(err).Warn("Rate limiter check failed, allowing request")
+	} else if !allowed {
+		metrics.PurchaseTokens.WithLabelValues("rate_limited").Inc()
+		logEntry.WithField("event", "session_rate_limit_exceeded").Warn("Session rate limit exceeded")
+		writeError(w, r, http.StatusTooManyRequests, ErrCodeRateLimited, correlationID, map[string]interface{}{
+			"retry_after_seconds": int(rateLimitWindow.Seconds()),
+		})
+		return
+	}
+
+	gate, admitted, err := admitSession(r, session)
+	if err != nil {
+		metrics.PurchaseTokens.WithLabelValues("gate_error").Inc()
+		logEntry.WithError(err).WithField("gate", gate).Error("Session gate failed")
+		writeError(w, r, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, correlationID, nil)
+		return
+	}
+	if !admitted {
+		metrics.PurchaseTokens.WithLabelValues("denied").Inc()
+		logEntry.WithFields(map[string]interface{}{
+			"event": "session_denied",
+			"gate":  gate,
+		}).Warn("Session not admitted")
+		writeError(w, r, http.StatusForbidden, ErrCodeSessionDenied, correlationID, nil)
+		return
+	}
+
+	token, claims := purchaseTokens.Issue(session.UserID, session.ItemID, time.Now())
+	metrics.PurchaseTokens.WithLabelValues("issued").Inc()
+	logEntry.WithFields(map[string]interface{}{
+		"event":      "session_issued",
+		"session_id": claims.SessionID,
+	}).Info("Purchase token issued")
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"purchase_token": token,
+		"expires_at":     time.Unix(claims.ExpiresAt, 0).UTC().Format(time.RFC3339),
+		"correlation_id": correlationID,
+	})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// rateLimitWindow is the user rate limit window (RATE_LIMIT_WINDOW), also the exemption quota window
+var rateLimitWindow time.Duration
+
+// Results of presenting an exemption token, the result label of gateway_rate_limit_exemptions_total
+const (
+	ExemptionExempted      = "exempted"
+	ExemptionQuotaExceeded = "quota_exceeded"
+	ExemptionInvalid       = "invalid"
+	ExemptionExpired       = "expired"
+	ExemptionRevoked       = "revoked"
+	ExemptionError         = "error"
+)
+
+// checkRateLimitExemption applies the exemption token of r, if any, in place of the per-user limit
+// handled reports whether the token decided the request: exempted (allowed is true, and the
+// returned entry carries the exemption) or over its quota (allowed is false)
+// Invalid, expired and revoked tokens are logged and fall back to the regular user limit, as do
+// Redis errors, so a token never lets a request through without being counted
+func checkRateLimitExemption(ctx context.Context, r *http.Request, logEntry *logrus.Entry) (entry *logrus.Entry, handled, allowed bool) {
+	token := r.Header.Get(common.RateLimitExemptionHeader)
+	if rateLimitExemptions == nil || token == "" {
+		return logEntry, false, false
+	}
+	now := time.Now()
+	exemption, err := rateLimitExemptions.Verify(ctx, token, now)
+	if err != nil {
+		result := ExemptionError
+		switch {
+		case errors.Is(err, common.ErrExemptionInvalid):
+			result = ExemptionInvalid
+		case errors.Is(err, common.ErrExemptionExpired):
+			result = ExemptionExpired
+		case errors.Is(err, common.ErrExemptionRevoked):
+			result = ExemptionRevoked
+		default:
+			redisHealth.Observe(err)
+		}
+		metrics.RateLimitExemptions.WithLabelValues(result).Inc()
+		fields := logrus.Fields{"event": "rate_limit_exemption_rejected", "result": result}
+		if exemption != nil {
+			fields["exemption_id"] = exemption.ID
+			fields["exemption_name"] = exemption.Name
+		}
+		logEntry.WithError(err).WithFields(fields).Warn("Rate limit exemption not accepted, applying user limit")
+		return logEntry, false, false
+	}
+
+	logEntry = logEntry.WithFields(logrus.Fields{
+		"exemption_id":   exemption.ID,
+		"exemption_name": exemption.Name,
+	})
+	within, used, err := rateLimitExemptions.Use(ctx, exemption, rateLimitWindow, now)
+	if err != nil {
+		redisHealth.Observe(err)
+		metrics.RateLimitExemptions.WithLabelValues(ExemptionError).Inc()
+		logEntry.WithError(err).WithField("event", "rate_limit_exemption_rejected").Warn("Rate limit exemption quota check failed, applying user limit")
+		return logEntry, false, false
+	}
+	if !within {
+		metrics.RateLimitExemptions.WithLabelValues(ExemptionQuotaExceeded).Inc()
+		logEntry.WithFields(logrus.Fields{
+			"event": "rate_limit_exemption_quota_exceeded",
+			"quota": exemption.Quota,
+			"used":  used,
+		}).Warn("Rate limit exemption quota exceeded")
+		return logEntry, true, false
+	}
+	metrics.RateLimitExemptions.WithLabelValues(ExemptionExempted).Inc()
+	logEntry.WithFields(logrus.Fields{
+		"event": "rate_limit_exempted",
+		"used":  used,
+	}).Info("User rate limit bypassed with exemption token")
+	return logEntry, true, true
+}
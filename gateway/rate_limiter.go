@@ -2,23 +2,106 @@ package main
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/bradfitz/gomemcache/memcache"
 	"github.com/redis/go-redis/v9"
 )
 
-// RateLimiter implements per-user rate limiting using Redis sliding window
-type RateLimiter struct {
+// Rate limiter backends (RATE_LIMIT_BACKEND)
+const (
+	RateLimitBackendRedis     = "redis"     // Shared across gateways (default)
+	RateLimitBackendMemcached = "memcached" // Shared across gateways, no Redis needed (MEMCACHED_ADDRS)
+	RateLimitBackendMemory    = "memory"    // Per gateway instance; limits multiply by the instance count
+)
+
+// RateLimiter limits requests per key (user_id) within a fixed window
+// Implementations fail open: on backend errors Allow returns true together with the error
+type RateLimiter interface {
+	// Allow records a request for key and reports whether it is within the limit
+	Allow(ctx context.Context, key string) (bool, error)
+	// GetRemainingRequests returns how many requests key has left in the current window
+	GetRemainingRequests(ctx context.Context, key string) (int, error)
+}
+
+// Rate limit policies, the policy label of the rate limiter metrics
+const (
+	RateLimitPolicyUser = "user" // Per user_id (RATE_LIMIT_MAX_REQUESTS)
+	RateLimitPolicyIP   = "ip"   // Per client IP (IP_RATE_LIMIT_MAX_REQUESTS)
+)
+
+// windowCounter is implemented by every backend: it counts a request in key's current window
+// and returns the window's count so far
+type windowCounter interface {
+	RateLimiter
+	increment(ctx context.Context, key string) (int64, error)
+}
+
+// NewRateLimiter creates the limiter for backend, instrumented with the policy's metrics
+// maxRequests: maximum requests allowed per window
+// windowSize: time window (e.g., 1 minute)
+func NewRateLimiter(policy, backend string, redisClient *redis.Client, memcachedAddrs []string, maxRequests int, windowSize time.Duration) (RateLimiter, error) {
+	var counter windowCounter
+	switch backend {
+	case "", RateLimitBackendRedis:
+		counter = NewRedisRateLimiter(redisClient, maxRequests, windowSize)
+	case RateLimitBackendMemcached:
+		if len(memcachedAddrs) == 0 {
+			return nil, errors.New("memcached rate limiter requires MEMCACHED_ADDRS")
+		}
+		counter = NewMemcachedRateLimiter(memcache.New(memcachedAddrs...), maxRequests, windowSize)
+	case RateLimitBackendMemory:
+		counter = NewMemoryRateLimiter(maxRequests, windowSize)
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", backend)
+	}
+	return &meteredRateLimiter{windowCounter: counter, policy: policy, maxRequests: maxRequests, windowSize: windowSize}, nil
+}
+
+// meteredRateLimiter records every decision of a backend in the rate limiter metrics:
+// allowed, rejected and error (failed open) counts per policy, and the request rate each
+// request observed for its key
+type meteredRateLimiter struct {
+	windowCounter
+	policy      string
+	maxRequests int
+	windowSize  time.Duration
+}
+
+// Allow counts the request and applies the limit; backend errors fail open
+func (rl *meteredRateLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	count, err := rl.increment(ctx, key)
+	if err != nil {
+		metrics.RateLimitDecisions.WithLabelValues(rl.policy, "error").Inc()
+		return true, err
+	}
+	// Requests per minute in the key's window so far, observed once per request, so heavy
+	// users weigh in proportion to their traffic
+	metrics.RateLimitObservedRate.WithLabelValues(rl.policy).Observe(float64(count) / rl.windowSize.Minutes())
+	if count > int64(rl.maxRequests) {
+		metrics.RateLimitDecisions.WithLabelValues(rl.policy, "rejected").Inc()
+		return false, nil
+	}
+	metrics.RateLimitDecisions.WithLabelValues(rl.policy, "allowed").Inc()
+	return true, nil
+}
+
+// RedisRateLimiter implements per-user rate limiting using Redis sliding window
+type RedisRateLimiter struct {
 	redisClient *redis.Client
 	maxRequests int
 	windowSize  time.Duration
 }
 
-// NewRateLimiter creates a new rate limiter
-// maxRequests: maximum requests allowed per window
-// windowSize: time window (e.g., 1 minute)
-func NewRateLimiter(redisClient *redis.Client, maxRequests int, windowSize time.Duration) *RateLimiter {
-	return &RateLimiter{
+// NewRedisRateLimiter creates a Redis-backed rate limiter
+func NewRedisRateLimiter(redisClient *redis.Client, maxRequests int, windowSize time.Duration) *RedisRateLimiter {
+	return &RedisRateLimiter{
 		redisClient: redisClient,
 		maxRequests: maxRequests,
 		windowSize:  windowSize,
@@ -27,33 +110,35 @@ func NewRateLimiter(redisClient *redis.Client, maxRequests int, windowSize time.
 
 // Allow checks if a request from userID should be allowed
 // Returns true if request is allowed, false if rate limit exceeded
-// Uses Redis sliding window algorithm with INCR and EXPIRE
-func (rl *RateLimiter) Allow(ctx context.Context, userID string) (bool, error) {
+func (rl *RedisRateLimiter) Allow(ctx context.Context, userID string) (bool, error) {
+	count, err := rl.increment(ctx, userID)
+	if err != nil {
+		// If Redis fails, allow request (fail open)
+		// In production, you might want to fail closed or use local cache
+		return true, err
+	}
+	return count <= int64(rl.maxRequests), nil
+}
+
+// increment counts the request with INCR, setting the window's EXPIRE on its first request
+func (rl *RedisRateLimiter) increment(ctx context.Context, userID string) (int64, error) {
 	key := "ratelimit:" + userID
 
 	// Increment counter for this user
 	count, err := rl.redisClient.Incr(ctx, key).Result()
 	if err != nil {
-		// If Redis fails, allow request (fail open)
-		// In production, you might want to fail closed or use local cache
-		return true, err
+		return 0, err
 	}
 
 	// Set expiration on first request (sliding window)
 	if count == 1 {
 		rl.redisClient.Expire(ctx, key, rl.windowSize)
 	}
-
-	// Check if limit exceeded
-	if count > int64(rl.maxRequests) {
-		return false, nil
-	}
-
-	return true, nil
+	return count, nil
 }
 
 // GetRemainingRequests returns how many requests the user has remaining in current window
-func (rl *RateLimiter) GetRemainingRequests(ctx context.Context, userID string) (int, error) {
+func (rl *RedisRateLimiter) GetRemainingRequests(ctx context.Context, userID string) (int, error) {
 	key := "ratelimit:" + userID
 	count, err := rl.redisClient.Get(ctx, key).Int()
 	if err == redis.Nil {
@@ -64,9 +149,157 @@ func (rl *RateLimiter) GetRemainingRequests(ctx context.Context, userID string)
 		return 0, err
 	}
 
-	remaining := rl.maxRequests - count
+	return remainingRequests(rl.maxRequests, int64(count)), nil
+}
+
+// MemcachedRateLimiter implements the same fixed window as RedisRateLimiter with memcached
+// counters (INCR on a key added with the window as expiry)
+type MemcachedRateLimiter struct {
+	client      *memcache.Client
+	maxRequests int
+	windowSize  time.Duration
+}
+
+// NewMemcachedRateLimiter creates a memcached-backed rate limiter
+func NewMemcachedRateLimiter(client *memcache.Client, maxRequests int, windowSize time.Duration) *MemcachedRateLimiter {
+	return &MemcachedRateLimiter{client: client, maxRequests: maxRequests, windowSize: windowSize}
+}
+
+// Allow increments the key's counter and applies the limit, failing open on errors
+func (rl *MemcachedRateLimiter) Allow(ctx context.Context, userID string) (bool, error) {
+	count, err := rl.increment(ctx, userID)
+	if err != nil {
+		return true, err
+	}
+	return count <= int64(rl.maxRequests), nil
+}
+
+// increment increments the key's counter, creating it for a new window if it doesn't exist
+// The client's context is not used: gomemcache applies its own per-operation timeout
+func (rl *MemcachedRateLimiter) increment(ctx context.Context, userID string) (int64, error) {
+	key := memcacheKey("ratelimit:" + userID)
+
+	count, err := rl.client.Increment(key, 1)
+	if err == memcache.ErrCacheMiss {
+		// First request in the window; Add loses to a concurrent first request, so retry the INCR
+		err = rl.client.Add(&memcache.Item{Key: key, Value: []byte("1"), Expiration: int32(rl.windowSize.Seconds())})
+		if err == nil {
+			count = 1
+		} else if err == memcache.ErrNotStored {
+			count, err = rl.client.Increment(key, 1)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int64(count), nil
+}
+
+// GetRemainingRequests returns how many requests the user has remaining in current window
+func (rl *MemcachedRateLimiter) GetRemainingRequests(ctx context.Context, userID string) (int, error) {
+	item, err := rl.client.Get(memcacheKey("ratelimit:" + userID))
+	if err == memcache.ErrCacheMiss {
+		return rl.maxRequests, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	count, err := strconv.ParseInt(string(item.Value), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return remainingRequests(rl.maxRequests, count), nil
+}
+
+// memcacheKey returns key if memcached accepts it, otherwise a hash of it
+// user_id is not validated yet when the limiter runs, so it may contain spaces or be too long
+func memcacheKey(key string) string {
+	valid := len(key) <= 250
+	for i := 0; valid && i < len(key); i++ {
+		valid = key[i] > ' ' && key[i] != 0x7f
+	}
+	if valid {
+		return key
+	}
+	sum := sha1.Sum([]byte(key))
+	return "ratelimit:h:" + hex.EncodeToString(sum[:])
+}
+
+// maxMemoryRateLimitKeys bounds the in-process limiter; expired windows are pruned once reached
+const maxMemoryRateLimitKeys = 100000
+
+// MemoryRateLimiter keeps fixed-window counters in process
+// Nothing is shared between gateway instances, so the effective limit is maxRequests per
+// instance; intended for single-instance deployments or as a cheap first line of defence
+type MemoryRateLimiter struct {
+	mu          sync.Mutex
+	windows     map[string]*memoryWindow
+	maxRequests int
+	windowSize  time.Duration
+}
+
+type memoryWindow struct {
+	count     int64
+	expiresAt time.Time
+}
+
+// NewMemoryRateLimiter creates an in-process rate limiter
+func NewMemoryRateLimiter(maxRequests int, windowSize time.Duration) *MemoryRateLimiter {
+	return &MemoryRateLimiter{
+		windows:     make(map[string]*memoryWindow),
+		maxRequests: maxRequests,
+		windowSize:  windowSize,
+	}
+}
+
+// Allow counts the request in userID's current window; it never returns an error
+func (rl *MemoryRateLimiter) Allow(ctx context.Context, userID string) (bool, error) {
+	count, _ := rl.increment(ctx, userID)
+	return count <= int64(rl.maxRequests), nil
+}
+
+// increment counts the request in userID's current window, starting a new one if it expired
+func (rl *MemoryRateLimiter) increment(ctx context.Context, userID string) (int64, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	window, ok := rl.windows[userID]
+	if !ok || now.After(window.expiresAt) {
+		if len(rl.windows) >= maxMemoryRateLimitKeys {
+			rl.prune(now)
+		}
+		window = &memoryWindow{expiresAt: now.Add(rl.windowSize)}
+		rl.windows[userID] = window
+	}
+	window.count++
+	return window.count, nil
+}
+
+// GetRemainingRequests returns how many requests the user has remaining in current window
+func (rl *MemoryRateLimiter) GetRemainingRequests(ctx context.Context, userID string) (int, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	window, ok := rl.windows[userID]
+	if !ok || time.Now().After(window.expiresAt) {
+		return rl.maxRequests, nil
+	}
+	return remainingRequests(rl.maxRequests, window.count), nil
+}
+
+func (rl *MemoryRateLimiter) prune(now time.Time) {
+	for key, window := range rl.windows {
+		if now.After(window.expiresAt) {
+			delete(rl.windows, key)
+		}
+	}
+}
+
+func remainingRequests(maxRequests int, count int64) int {
+	remaining := int64(maxRequests) - count
 	if remaining < 0 {
-		return 0, nil
+		return 0
 	}
-	return remaining, nil
+	return int(remaining)
 }
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// trustedProxies are the networks of load balancers/proxies allowed to report client addresses
+// (TRUSTED_PROXIES, comma-separated CIDRs or IPs); X-Forwarded-For, X-Real-IP and PROXY protocol
+// headers from any other peer are ignored
+var trustedProxies []*net.IPNet
+
+// forwardedHops is the number of proxies in front of the gateway (IP_FORWARDED_HOPS), used when
+// TRUSTED_PROXIES is unset; each proxy appends the address it received the request from to
+// X-Forwarded-For, so the client is the Nth entry from the right
+var forwardedHops int
+
+// ParseTrustedProxies parses comma-separated CIDRs; bare IPs are treated as single-host networks
+func ParseTrustedProxies(value string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+type clientIPContextKey struct{}
+
+// RealIPMiddleware resolves the client address once per request so every consumer (logs,
+// Kafka headers, per-IP limits) sees the same value
+func RealIPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), clientIPContextKey{}, resolveClientIP(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// clientIP returns the resolved client address of r
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPContextKey{}).(string); ok {
+		return ip
+	}
+	return resolveClientIP(r)
+}
+
+// resolveClientIP determines the client address of r
+// r.RemoteAddr already reflects a PROXY protocol header (see ProxyProtocolListener)
+//   - With TRUSTED_PROXIES: if the peer is trusted, X-Forwarded-For is walked right to left
+//     skipping trusted proxies; the first untrusted hop is the client. Without X-Forwarded-For,
+//     X-Real-IP set by a trusted peer is used
+//   - Otherwise with IP_FORWARDED_HOPS: the Nth X-Forwarded-For entry from the right
+//   - Otherwise the connection address
+func resolveClientIP(r *http.Request) string {
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+	hops := forwardedFor(r)
+
+	if len(trustedProxies) > 0 {
+		peer := net.ParseIP(remoteIP)
+		if peer == nil || !isTrustedProxy(peer) {
+			return remoteIP
+		}
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(hops[i])
+			if ip == nil {
+				// Garbage in the chain: stop at the last address a trusted proxy vouched for
+				break
+			}
+			if !isTrustedProxy(ip) || i == 0 {
+				return ip.String()
+			}
+		}
+		if len(hops) == 0 {
+			if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+				return ip.String()
+			}
+		}
+		return remoteIP
+	}
+
+	if forwardedHops <= 0 || len(hops) < forwardedHops {
+		// Fewer hops than proxies: the request bypassed part of the proxy chain
+		return remoteIP
+	}
+	if ip := net.ParseIP(hops[len(hops)-forwardedHops]); ip != nil {
+		return ip.String()
+	}
+	return remoteIP
+}
+
+// forwardedFor returns the X-Forwarded-For entries of r, left (client) to right (nearest proxy)
+func forwardedFor(r *http.Request) []string {
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	return hops
+}
+
+// proxyProtocolTimeout bounds how long a connection may take to send its PROXY header
+const proxyProtocolTimeout = 5 * time.Second
+
+// proxyProtocolV2Signature starts every PROXY protocol v2 header
+var proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ProxyProtocolListener accepts PROXY protocol (v1 and v2) headers from trusted proxies, so
+// TCP load balancers that can't add X-Forwarded-For still report the client address
+// Connections from untrusted peers are served as-is
+type ProxyProtocolListener struct {
+	net.Listener
+}
+
+// Accept wraps the connection; the header is read lazily by the connection's own goroutine
+// so a slow peer can't block accepting other connections
+func (l *ProxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr); !ok || !isTrustedProxy(tcpAddr.IP) {
+		return conn, nil
+	}
+	return &proxyProtocolConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// proxyProtocolConn reads the PROXY header on first use and reports its source address
+type proxyProtocolConn struct {
+	net.Conn
+	reader     *bufio.Reader
+	once       sync.Once
+	remoteAddr net.Addr
+	err        error
+}
+
+func (c *proxyProtocolConn) init() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(proxyProtocolTimeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+		c.remoteAddr, c.err = readProxyHeader(c.reader)
+		if c.remoteAddr == nil {
+			c.remoteAddr = c.Conn.RemoteAddr()
+		}
+	})
+}
+
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.init()
+	return c.remoteAddr
+}
+
+// readProxyHeader parses a v1 or v2 PROXY header; a nil address means the proxy sent
+// UNKNOWN/LOCAL (e.g. health checks) and the connection address should be used
+func readProxyHeader(reader *bufio.Reader) (net.Addr, error) {
+	signature, err := reader.Peek(len(proxyProtocolV2Signature))
+	if err == nil && bytes.Equal(signature, proxyProtocolV2Signature) {
+		return readProxyHeaderV2(reader)
+	}
+
+	// v1: "PROXY TCP4 <src> <dst> <srcport> <dstport>\r\n", at most 107 bytes
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("read PROXY header: %w", err)
+	}
+	if len(line) > 107 || !strings.HasPrefix(line, "PROXY ") || !strings.HasSuffix(line, "\r\n") {
+		return nil, errors.New("invalid PROXY header")
+	}
+	fields := strings.Fields(line)
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errors.New("invalid PROXY header")
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil {
+		return nil, errors.New("invalid PROXY header address")
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+func readProxyHeaderV2(reader *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, fmt.Errorf("read PROXY v2 header: %w", err)
+	}
+	if header[12]>>4 != 2 {
+		return nil, errors.New("unsupported PROXY protocol version")
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, fmt.Errorf("read PROXY v2 addresses: %w", err)
+	}
+
+	// LOCAL command (health checks from the proxy itself) carries no client address
+	if header[12]&0x0f == 0 {
+		return nil, nil
+	}
+	switch header[13] >> 4 {
+	case 1: // AF_INET: src(4) dst(4) srcport(2) dstport(2)
+		if len(payload) < 12 {
+			return nil, errors.New("short PROXY v2 IPv4 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 2: // AF_INET6: src(16) dst(16) srcport(2) dstport(2)
+		if len(payload) < 36 {
+			return nil, errors.New("short PROXY v2 IPv6 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	default:
+		// Unix sockets or unspecified: keep the connection address
+		return nil, nil
+	}
+}
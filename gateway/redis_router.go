@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisRouter routes read-heavy traffic (order status and timeline, purchase cap counts, denylist
+// and waitlist reads) to Redis replicas while all mutations go to the primary
+// Replicas whose replication link is down or lagging beyond maxLag are skipped; when no
+// replica is healthy, reads fall back to the primary
+type RedisRouter struct {
+	primary  *redis.Client
+	replicas []*redis.Client
+	maxLag   time.Duration
+
+	mu      sync.RWMutex
+	healthy []bool // Parallel to replicas; updated by the lag monitor
+	next    uint32 // Round-robin cursor
+}
+
+// NewRedisRouter creates a router over primary and replicas
+// maxLag: replicas whose last contact with the primary is older than this are not used
+func NewRedisRouter(primary *redis.Client, replicas []*redis.Client, maxLag time.Duration) *RedisRouter {
+	healthy := make([]bool, len(replicas))
+	return &RedisRouter{
+		primary:  primary,
+		replicas: replicas,
+		maxLag:   maxLag,
+		healthy:  healthy,
+	}
+}
+
+// Primary returns the client for mutations and reads that require the latest data
+func (rr *RedisRouter) Primary() *redis.Client {
+	return rr.primary
+}
+
+// HasReplicas reports whether any replicas are configured
+func (rr *RedisRouter) HasReplicas() bool {
+	return len(rr.replicas) > 0
+}
+
+// ReadClient returns a healthy replica (round-robin) or the primary if none is healthy
+func (rr *RedisRouter) ReadClient() *redis.Client {
+	if len(rr.replicas) == 0 {
+		return rr.primary
+	}
+
+	rr.mu.RLock()
+	defer rr.mu.RUnlock()
+
+	start := atomic.AddUint32(&rr.next, 1)
+	for i := 0; i < len(rr.replicas); i++ {
+		idx := (int(start) + i) % len(rr.replicas)
+		if rr.healthy[idx] {
+			return rr.replicas[idx]
+		}
+	}
+	return rr.primary
+}
+
+// Replicas returns the number of configured replicas
+func (rr *RedisRouter) Replicas() int {
+	return len(rr.replicas)
+}
+
+// HealthyReplicas returns the number of replicas currently eligible for reads
+func (rr *RedisRouter) HealthyReplicas() int {
+	rr.mu.RLock()
+	defer rr.mu.RUnlock()
+
+	count := 0
+	for _, ok := range rr.healthy {
+		if ok {
+			count++
+		}
+	}
+	return count
+}
+
+// MonitorLag checks replica health every interval until ctx is cancelled
+// Runs one check immediately so replicas are usable as soon as the router starts
+func (rr *RedisRouter) MonitorLag(ctx context.Context, interval time.Duration) {
+	if len(rr.replicas) == 0 {
+		return
+	}
+
+	rr.checkReplicas(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rr.checkReplicas(ctx)
+		}
+	}
+}
+
+func (rr *RedisRouter) checkReplicas(ctx context.Context) {
+	healthy := make([]bool, len(rr.replicas))
+	for i, replica := range rr.replicas {
+		checkCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+		info, err := replica.Info(checkCtx, "replication").Result()
+		cancel()
+		healthy[i] = err == nil && replicaWithinLag(info, rr.maxLag)
+	}
+
+	rr.mu.Lock()
+	rr.healthy = healthy
+	rr.mu.Unlock()
+}
+
+// replicaWithinLag parses INFO replication output from a replica and reports whether its
+// link to the primary is up and its last contact is within maxLag
+func replicaWithinLag(info string, maxLag time.Duration) bool {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(info, "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), ":"); ok {
+			fields[key] = value
+		}
+	}
+
+	if fields["role"] != "slave" || fields["master_link_status"] != "up" {
+		return false
+	}
+	lastIO, err := strconv.Atoi(fields["master_last_io_seconds_ago"])
+	if err != nil || lastIO < 0 {
+		return false
+	}
+	return time.Duration(lastIO)*time.Second <= maxLag
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// Purchase admission outcomes
+const (
+	AdmissionAdmitted      = "ADMITTED"
+	AdmissionNotRegistered = "NOT_REGISTERED"
+	AdmissionCapExceeded   = "CAP_EXCEEDED"
+)
+
+// registrationKey is the allowlist of users registered for itemID's campaign
+func registrationKey(itemID string) string {
+	return "registrations:" + itemID
+}
+
+// PurchaseAdmission enforces pre-registration (REGISTRATION_ITEMS) on /buy and turns away
+// orders that would exceed the buyer's purchase cap (see common.PurchaseCaps)
+// The cap is only read here, from a replica when one is healthy: the processor counts units when
+// it reserves them, atomically with the stock, so failed orders never use it up and a lagging
+// count only lets an order through to be rejected there
+type PurchaseAdmission struct {
+	router          *RedisRouter
+	registration    map[string]bool
+	registrationAll bool
+	caps            common.PurchaseCaps
+}
+
+// NewPurchaseAdmission requires registration for itemIDs ("*" for every item) and checks caps
+func NewPurchaseAdmission(router *RedisRouter, itemIDs []string, caps common.PurchaseCaps) *PurchaseAdmission {
+	pa := &PurchaseAdmission{
+		router:       router,
+		registration: make(map[string]bool, len(itemIDs)),
+		caps:         caps,
+	}
+	for _, itemID := range itemIDs {
+		if itemID == "*" {
+			pa.registrationAll = true
+		}
+		pa.registration[itemID] = true
+	}
+	return pa
+}
+
+// Enabled reports whether any check is configured
+func (pa *PurchaseAdmission) Enabled() bool {
+	return pa.RegistrationEnabled() || pa.caps.Enabled()
+}
+
+// CapFor returns the units one user may buy of itemID within the window, 0 when unlimited
+func (pa *PurchaseAdmission) CapFor(itemID string) int64 {
+	return pa.caps.For(itemID)
+}
+
+// RegistrationEnabled reports whether any item requires registration
+func (pa *PurchaseAdmission) RegistrationEnabled() bool {
+	return len(pa.registration) > 0
+}
+
+// RequiresRegistration reports whether itemID can only be bought by registered users
+func (pa *PurchaseAdmission) RequiresRegistration(itemID string) bool {
+	return pa.registrationAll || pa.registration[itemID]
+}
+
+// Check evaluates amount units of itemID for userID against registration and the cap
+// Returns the outcome and the units userID has bought within the window (including this order
+// when admitted). Nothing is counted, so Check has no side effect to roll back; concurrent
+// orders that pass together are settled by the processor's reservation
+func (pa *PurchaseAdmission) Check(ctx context.Context, userID, itemID string, amount int64) (string, int64, error) {
+	if pa.RequiresRegistration(itemID) {
+		// The primary, so a user who just registered is admitted
+		registered, err := pa.router.Primary().SIsMember(ctx, registrationKey(itemID), userID).Result()
+		if err != nil {
+			return "", 0, err
+		}
+		if !registered {
+			return AdmissionNotRegistered, 0, nil
+		}
+	}
+	limit := pa.CapFor(itemID)
+	if limit <= 0 {
+		return AdmissionAdmitted, 0, nil
+	}
+	purchased, err := pa.router.ReadClient().Get(ctx, common.PurchasedKey(itemID, userID)).Int64()
+	if err != nil && err != redis.Nil {
+		return "", 0, err
+	}
+	if purchased+amount > limit {
+		return AdmissionCapExceeded, purchased, nil
+	}
+	return AdmissionAdmitted, purchased + amount, nil
+}
+
+// Register adds userID to itemID's registration allowlist
+func (pa *PurchaseAdmission) Register(ctx context.Context, userID, itemID string) error {
+	return pa.router.Primary().SAdd(ctx, registrationKey(itemID), userID).Err()
+}
+
+// RegistrationRequest is the body of POST /register
+type RegistrationRequest struct {
+	UserID string `json:"user_id"`
+	ItemID string `json:"item_id"`
+}
+
+// handleRegister registers a user for an item's campaign; registering twice is a no-op
+// Only items listed in REGISTRATION_ITEMS accept registrations
+func handleRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	correlationID := uuid.New().String()
+	logEntry := common.WithEvent(correlationID, "registration_requested").WithField("client_ip", clientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+
+	var registration RegistrationRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&registration); err != nil {
+		logEntry.WithError(err).Warn("Invalid registration request body")
+		writeError(w, r, http.StatusBadRequest, ErrCodeInvalidBody, correlationID, map[string]interface{}{
+			"errors": []ValidationError{decodeErrorToValidationError(err)},
+		})
+		return
+	}
+	validationErrors := append(validateID("user_id", registration.UserID, maxUserIDLength),
+		validateID("item_id", registration.ItemID, maxItemIDLength)...)
+	if len(validationErrors) == 0 && !purchaseAdmission.RequiresRegistration(registration.ItemID) {
+		validationErrors = append(validationErrors, ValidationError{
+			Field:   "item_id",
+			Code:    CodeValueNotAllowed,
+			Message: "item_id does not take registrations",
+		})
+	}
+	if len(validationErrors) > 0 {
+		writeError(w, r, http.StatusBadRequest, ErrCodeValidationFailed, correlationID, map[string]interface{}{
+			"errors": validationErrors,
+		})
+		return
+	}
+	logEntry = logEntry.WithFields(map[string]interface{}{
+		"user_id": registration.UserID,
+		"item_id": registration.ItemID,
+	})
+
+	if err := purchaseAdmission.Register(r.Context(), registration.UserID, registration.ItemID); err != nil {
+		redisHealth.Observe(err)
+		logEntry.WithError(err).Error("Failed to record registration")
+		writeError(w, r, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, correlationID, nil)
+		return
+	}
+	metrics.PurchaseAdmission.WithLabelValues("registered").Inc()
+	logEntry.WithField("event", "user_registered").Info("User registered for campaign")
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"registered":     true,
+		"user_id":        registration.UserID,
+		"item_id":        registration.ItemID,
+		"correlation_id": correlationID,
+	})
+}
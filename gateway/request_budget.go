@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sirupsen/logrus"
+)
+
+// buyRequestTimeout is the budget of one /buy request (BUY_REQUEST_TIMEOUT); every Redis call
+// and the Kafka send run under it, so a slow dependency can't hold the handler longer
+var buyRequestTimeout = 30 * time.Second
+
+// rollbackTimeout bounds the cleanup of a rejected order, which still runs once the budget is spent
+const rollbackTimeout = 2 * time.Second
+
+// Request stages, the stage label of gateway_request_budget_exceeded_total
+const (
+	BudgetStageRateLimit   = "rate_limit"
+	BudgetStageAdmission   = "admission"
+	BudgetStageIdempotency = "idempotency"
+	BudgetStageStatus      = "status"
+	BudgetStagePublish     = "publish"
+)
+
+// budgetExceeded reports whether err came from ctx running out of budget, counting it for stage
+func budgetExceeded(ctx context.Context, stage string, err error) bool {
+	if err == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return false
+	}
+	metrics.RequestBudgetExceeded.WithLabelValues(stage).Inc()
+	return true
+}
+
+// rollbackContext returns a context for undoing ctx's work that survives ctx's deadline
+func rollbackContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+}
+
+// errPublishPending is returned when the send timed out while still in flight, so its outcome is unknown
+var errPublishPending = errors.New("order publish still in flight when the request budget ran out")
+
+// publishWithinBudget sends msg through the circuit breaker within ctx
+// A timed-out send keeps running: if it fails afterwards, the order is buffered when the outage
+// buffer is enabled, otherwise late runs the rollback the handler would have done
+func publishWithinBudget(ctx context.Context, msg *sarama.ProducerMessage, logEntry *logrus.Entry, late func()) error {
+	_, _, err := producer.SendMessage(ctx, msg)
+	var timeout *SendTimeoutError
+	if !errors.As(err, &timeout) {
+		return err
+	}
+	go func() {
+		err := <-timeout.Late
+		if err == nil {
+			logEntry.WithField("event", "order_publish_late").Warn("Order queued after the send timed out")
+			return
+		}
+		if outageBuffer != nil && outageBuffer.Enqueue(msg) == nil {
+			metrics.OrdersBuffered.Inc()
+			logEntry.WithError(err).WithField("event", "order_publish_late").Warn("Order buffered after a timed-out send failed")
+			return
+		}
+		logEntry.WithError(err).WithField("event", "order_publish_late").Error("Timed-out send failed, rolling back")
+		late()
+	}()
+	return errPublishPending
+}
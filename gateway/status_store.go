@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// Status read consistency modes (STATUS_READ_CONSISTENCY)
+// Only relevant when Redis replicas are configured for reads (REDIS_REPLICA_ADDRS)
+const (
+	ConsistencyEventual      = "eventual"         // All status reads go to the replica
+	ConsistencyReadYourWrite = "read_your_writes" // Reads of recently-written request_ids go to the primary
+	ConsistencyWait          = "wait"             // Writes block on WAIT until replicas acknowledge them
+)
+
+// maxRecentWrites bounds the recent-write tracker; expired entries are pruned once it is reached
+const maxRecentWrites = 100000
+
+// OrderStatusStore reads and writes order_status keys
+// With replicas configured, reads are offloaded from the primary; the consistency mode
+// prevents clients from seeing a stale status (e.g. missing or PROCESSING) right after a write
+type OrderStatusStore struct {
+	router       *RedisRouter
+	consistency  string
+	rywWindow    time.Duration // How long a written request_id keeps reading from the primary
+	waitReplicas int           // Replicas that must acknowledge a write in wait mode
+	waitTimeout  time.Duration
+
+	mu     sync.Mutex
+	recent map[string]time.Time // request_id -> time of last write by this gateway
+}
+
+// NewOrderStatusStore creates a new status store
+// Without replicas all reads go to the primary and consistency is irrelevant
+func NewOrderStatusStore(router *RedisRouter, consistency string, rywWindow time.Duration, waitReplicas int, waitTimeout time.Duration) *OrderStatusStore {
+	switch consistency {
+	case ConsistencyReadYourWrite, ConsistencyWait:
+	default:
+		consistency = ConsistencyEventual
+	}
+	return &OrderStatusStore{
+		router:       router,
+		consistency:  consistency,
+		rywWindow:    rywWindow,
+		waitReplicas: waitReplicas,
+		waitTimeout:  waitTimeout,
+		recent:       make(map[string]time.Time),
+	}
+}
+
+// Consistency returns the configured consistency mode
+func (s *OrderStatusStore) Consistency() string {
+	return s.consistency
+}
+
+// SetStatus writes the status for requestID to the primary
+// In read_your_writes mode the request_id is tracked so subsequent reads go to the primary;
+// in wait mode the write blocks (bounded by waitTimeout) until replicas have it
+func (s *OrderStatusStore) SetStatus(ctx context.Context, requestID string, status string, ttl time.Duration) error {
+	primary := s.router.Primary()
+	if err := primary.Set(ctx, orderStatusKey(requestID), status, ttl).Err(); err != nil {
+		return err
+	}
+	if !s.router.HasReplicas() {
+		return nil
+	}
+
+	switch s.consistency {
+	case ConsistencyReadYourWrite:
+		s.trackWrite(requestID)
+	case ConsistencyWait:
+		// WAIT returns the number of replicas that acknowledged; fewer than requested
+		// means the timeout elapsed, which only weakens the guarantee for this write
+		if err := primary.Wait(ctx, s.waitReplicas, s.waitTimeout).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetStatus reads the status for requestID, returning "" if no status exists
+func (s *OrderStatusStore) GetStatus(ctx context.Context, requestID string) (string, error) {
+	status, err := s.readClient(requestID).Get(ctx, orderStatusKey(requestID)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return status, err
+}
+
+// GetResult reads the latest result recorded for requestID; nil before the first result
+func (s *OrderStatusStore) GetResult(ctx context.Context, requestID string) (*common.OrderResult, error) {
+	return common.LoadOrderResult(ctx, s.readClient(requestID), requestID)
+}
+
+// GetTimeline returns the order's timeline, read with the same consistency as its status
+func (s *OrderStatusStore) GetTimeline(ctx context.Context, requestID string) ([]common.TimelineEvent, error) {
+	return common.LoadOrderTimeline(ctx, s.readClient(requestID), requestID)
+}
+
+// readClient chooses the primary or a replica for a status read
+func (s *OrderStatusStore) readClient(requestID string) *redis.Client {
+	if s.consistency == ConsistencyReadYourWrite && s.router.HasReplicas() && s.recentlyWritten(requestID) {
+		return s.router.Primary()
+	}
+	return s.router.ReadClient()
+}
+
+func (s *OrderStatusStore) trackWrite(requestID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if len(s.recent) >= maxRecentWrites {
+		for id, writtenAt := range s.recent {
+			if now.Sub(writtenAt) > s.rywWindow {
+				delete(s.recent, id)
+			}
+		}
+	}
+	s.recent[requestID] = now
+}
+
+func (s *OrderStatusStore) recentlyWritten(requestID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writtenAt, ok := s.recent[requestID]
+	if !ok {
+		return false
+	}
+	if time.Since(writtenAt) > s.rywWindow {
+		delete(s.recent, requestID)
+		return false
+	}
+	return true
+}
+
+func orderStatusKey(requestID string) string {
+	return common.OrderStatusKey(requestID)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// User token errors
+var (
+	ErrUserTokenMissing = errors.New("user token missing")
+	ErrUserTokenInvalid = errors.New("user token invalid")
+	ErrUserTokenExpired = errors.New("user token expired")
+)
+
+// UserClaims identify the end user calling a per-user endpoint
+type UserClaims struct {
+	UserID    string `json:"uid"`
+	ExpiresAt int64  `json:"exp"` // Unix seconds
+}
+
+// UserTokenVerifier verifies user bearer tokens (HMAC-signed UserClaims) issued by the account
+// system with the shared USER_TOKEN_SECRET
+type UserTokenVerifier struct {
+	secret []byte
+}
+
+// userTokens is nil unless USER_TOKEN_SECRET is set
+var userTokens *UserTokenVerifier
+
+// NewUserTokenVerifier creates a verifier from USER_TOKEN_SECRET
+func NewUserTokenVerifier(secret string) (*UserTokenVerifier, error) {
+	if len(secret) < 32 {
+		return nil, errors.New("user token secret must be at least 32 bytes")
+	}
+	return &UserTokenVerifier{secret: []byte(secret)}, nil
+}
+
+// Issue returns a token for userID valid for ttl (-issue-user-token, tests)
+func (v *UserTokenVerifier) Issue(userID string, ttl time.Duration) string {
+	payload, _ := json.Marshal(UserClaims{UserID: userID, ExpiresAt: time.Now().Add(ttl).Unix()})
+	return common.EncodeSignedToken(v.secret, payload)
+}
+
+// Verify checks token's signature and expiry and returns its claims
+func (v *UserTokenVerifier) Verify(token string, now time.Time) (*UserClaims, error) {
+	if token == "" {
+		return nil, ErrUserTokenMissing
+	}
+	payload, err := common.DecodeSignedToken(v.secret, token)
+	if err != nil {
+		return nil, ErrUserTokenInvalid
+	}
+	var claims UserClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.UserID == "" {
+		return nil, ErrUserTokenInvalid
+	}
+	if now.Unix() > claims.ExpiresAt {
+		return nil, ErrUserTokenExpired
+	}
+	return &claims, nil
+}
+
+// RequireUser wraps next so it only runs when the bearer token was issued for the {user_id} in
+// the path: missing or invalid tokens get 401, another user's token 403
+func (v *UserTokenVerifier) RequireUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		claims, err := v.Verify(strings.TrimSpace(token), time.Now())
+		if err != nil {
+			correlationID := uuid.New().String()
+			common.WithEvent(correlationID, "user_unauthenticated").WithError(err).WithFields(map[string]interface{}{
+				"path":      r.URL.Path,
+				"client_ip": clientIP(r),
+			}).Warn("User request rejected")
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="user"`)
+			writeError(w, r, http.StatusUnauthorized, ErrCodeUnauthorized, correlationID, nil)
+			return
+		}
+		if claims.UserID != r.PathValue("user_id") {
+			correlationID := uuid.New().String()
+			common.WithEvent(correlationID, "user_forbidden").WithFields(map[string]interface{}{
+				"path":       r.URL.Path,
+				"token_user": claims.UserID,
+				"client_ip":  clientIP(r),
+			}).Warn("User request for another user forbidden")
+			w.Header().Set("Content-Type", "application/json")
+			writeError(w, r, http.StatusForbidden, ErrCodeForbidden, correlationID, nil)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -3,7 +3,10 @@ package main
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
+
+	"github.com/yourname/flash-sale-engine/common"
 )
 
 const (
@@ -12,6 +15,11 @@ const (
 	maxRequestIDLength = 200
 	maxAmount          = 1000
 	minAmount          = 1
+
+	// Metadata limits keep the passthrough map small enough to carry in every Kafka message
+	maxMetadataKeys        = 16
+	maxMetadataKeyLength   = 64
+	maxMetadataValueLength = 256
 )
 
 var (
@@ -22,9 +30,12 @@ var (
 )
 
 // ValidationError represents a validation error
+// Code is a stable machine-readable identifier; Message is human-readable and may be localized
 type ValidationError struct {
-	Field   string `json:"field"`
-	Message string `json:"message"`
+	Field   string        `json:"field"`
+	Code    string        `json:"code"`
+	Message string        `json:"message"`
+	Params  []interface{} `json:"-"` // Values substituted into localized message templates
 }
 
 func (e ValidationError) Error() string {
@@ -35,65 +46,38 @@ func (e ValidationError) Error() string {
 func ValidateOrderRequest(order *OrderRequest) []ValidationError {
 	var errors []ValidationError
 
-	// Validate UserID
-	if order.UserID == "" {
-		errors = append(errors, ValidationError{
-			Field:   "user_id",
-			Message: "user_id is required",
-		})
-	} else if len(order.UserID) > maxUserIDLength {
-		errors = append(errors, ValidationError{
-			Field:   "user_id",
-			Message: fmt.Sprintf("user_id must be at most %d characters", maxUserIDLength),
-		})
-	} else if !idPattern.MatchString(order.UserID) {
-		errors = append(errors, ValidationError{
-			Field:   "user_id",
-			Message: "user_id contains invalid characters (only alphanumeric, underscore, and hyphen allowed)",
-		})
-	}
+	// Validate UserID and ItemID
+	errors = append(errors, validateID("user_id", order.UserID, maxUserIDLength)...)
+	errors = append(errors, validateID("item_id", order.ItemID, maxItemIDLength)...)
 
-	// Validate ItemID
-	if order.ItemID == "" {
-		errors = append(errors, ValidationError{
-			Field:   "item_id",
-			Message: "item_id is required",
-		})
-	} else if len(order.ItemID) > maxItemIDLength {
-		errors = append(errors, ValidationError{
-			Field:   "item_id",
-			Message: fmt.Sprintf("item_id must be at most %d characters", maxItemIDLength),
-		})
-	} else if !idPattern.MatchString(order.ItemID) {
-		errors = append(errors, ValidationError{
-			Field:   "item_id",
-			Message: "item_id contains invalid characters (only alphanumeric, underscore, and hyphen allowed)",
-		})
+	// Validate RecipientUserID (optional, gift orders)
+	if order.RecipientUserID != "" {
+		errors = append(errors, validateID("recipient_user_id", order.RecipientUserID, maxUserIDLength)...)
+		if order.RecipientUserID == order.UserID {
+			errors = append(errors, ValidationError{
+				Field:   "recipient_user_id",
+				Code:    CodeSameAsBuyer,
+				Message: "recipient_user_id must differ from user_id",
+			})
+		}
 	}
 
 	// Validate Amount
-	if order.Amount < minAmount {
-		errors = append(errors, ValidationError{
-			Field:   "amount",
-			Message: fmt.Sprintf("amount must be at least %d", minAmount),
-		})
-	} else if order.Amount > maxAmount {
-		errors = append(errors, ValidationError{
-			Field:   "amount",
-			Message: fmt.Sprintf("amount must be at most %d", maxAmount),
-		})
-	}
+	errors = append(errors, validateAmount("amount", order.Amount)...)
 
 	// Validate RequestID
 	if order.RequestID == "" {
 		errors = append(errors, ValidationError{
 			Field:   "request_id",
+			Code:    CodeRequired,
 			Message: "request_id is required for idempotency",
 		})
 	} else if len(order.RequestID) > maxRequestIDLength {
 		errors = append(errors, ValidationError{
 			Field:   "request_id",
+			Code:    CodeTooLong,
 			Message: fmt.Sprintf("request_id must be at most %d characters", maxRequestIDLength),
+			Params:  []interface{}{maxRequestIDLength},
 		})
 	} else {
 		// RequestID format is more flexible (allows UUIDs, timestamps, etc.)
@@ -102,10 +86,153 @@ func ValidateOrderRequest(order *OrderRequest) []ValidationError {
 		if trimmed == "" {
 			errors = append(errors, ValidationError{
 				Field:   "request_id",
+				Code:    CodeWhitespaceOnly,
 				Message: "request_id cannot be empty or whitespace only",
 			})
 		}
 	}
 
+	// Validate Channel (the handler then attributes the order to the device token's channel)
+	if order.Channel != "" && !common.IsValidChannel(order.Channel) {
+		channels := strings.Join(common.Channels, ", ")
+		errors = append(errors, ValidationError{
+			Field:   "channel",
+			Code:    CodeValueNotAllowed,
+			Message: fmt.Sprintf("channel must be one of: %s", channels),
+			Params:  []interface{}{channels},
+		})
+	}
+
+	// Validate Lines and CartPolicy (optional, cart orders)
+	errors = append(errors, validateCartLines(order)...)
+
+	// Validate Metadata (optional)
+	errors = append(errors, validateMetadata(order.Metadata)...)
+
+	// Validate Address (optional, sanitized by the handler first)
+	errors = append(errors, validateAddress(order.Address)...)
+
+	// Run deployment-specific rules (registered in code or loaded from VALIDATION_RULES_FILE)
+	errors = append(errors, runValidationRules(order)...)
+
+	return errors
+}
+
+// validateID checks a required identifier (user_id, item_id) against length and format limits
+func validateID(field string, value string, maxLength int) []ValidationError {
+	switch {
+	case value == "":
+		return []ValidationError{{
+			Field:   field,
+			Code:    CodeRequired,
+			Message: field + " is required",
+		}}
+	case len(value) > maxLength:
+		return []ValidationError{{
+			Field:   field,
+			Code:    CodeTooLong,
+			Message: fmt.Sprintf("%s must be at most %d characters", field, maxLength),
+			Params:  []interface{}{maxLength},
+		}}
+	case !idPattern.MatchString(value):
+		return []ValidationError{{
+			Field:   field,
+			Code:    CodeInvalidFormat,
+			Message: field + " contains invalid characters (only alphanumeric, underscore, and hyphen allowed)",
+		}}
+	}
+	return nil
+}
+
+// validateAmount checks an order quantity against the per-order limits
+func validateAmount(field string, amount int64) []ValidationError {
+	if amount < minAmount {
+		return []ValidationError{{
+			Field:   field,
+			Code:    CodeTooSmall,
+			Message: fmt.Sprintf("%s must be at least %d", field, minAmount),
+			Params:  []interface{}{minAmount},
+		}}
+	}
+	if amount > maxAmount {
+		return []ValidationError{{
+			Field:   field,
+			Code:    CodeTooLarge,
+			Message: fmt.Sprintf("%s must be at most %d", field, maxAmount),
+			Params:  []interface{}{maxAmount},
+		}}
+	}
+	return nil
+}
+
+// validateMetadata checks the optional metadata map against size and key format limits
+// Keys follow the same format as IDs so they are safe to use in logs and downstream systems
+func validateMetadata(metadata map[string]string) []ValidationError {
+	var errors []ValidationError
+
+	if len(metadata) > maxMetadataKeys {
+		errors = append(errors, ValidationError{
+			Field:   "metadata",
+			Code:    CodeTooManyEntries,
+			Message: fmt.Sprintf("metadata must have at most %d entries", maxMetadataKeys),
+			Params:  []interface{}{maxMetadataKeys},
+		})
+		return errors
+	}
+
+	// Sort keys so error ordering is deterministic
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		field := "metadata." + key
+		if len(key) > maxMetadataKeyLength {
+			errors = append(errors, ValidationError{
+				Field:   "metadata",
+				Code:    CodeTooLong,
+				Message: fmt.Sprintf("metadata keys must be at most %d characters", maxMetadataKeyLength),
+				Params:  []interface{}{maxMetadataKeyLength},
+			})
+			continue
+		}
+		if !idPattern.MatchString(key) {
+			errors = append(errors, ValidationError{
+				Field:   field,
+				Code:    CodeInvalidFormat,
+				Message: fmt.Sprintf("%s contains invalid characters (only alphanumeric, underscore, and hyphen allowed)", field),
+			})
+			continue
+		}
+		if len(metadata[key]) > maxMetadataValueLength {
+			errors = append(errors, ValidationError{
+				Field:   field,
+				Code:    CodeTooLong,
+				Message: fmt.Sprintf("%s must be at most %d characters", field, maxMetadataValueLength),
+				Params:  []interface{}{maxMetadataValueLength},
+			})
+		}
+	}
+
 	return errors
 }
+
+// recordValidationFailures counts each error under its field and rule (error code)
+// Field names sent by the client (unknown fields, metadata keys, cart line indexes) would be
+// unbounded label values, so they are collapsed to "unknown", "metadata" and "lines"
+func recordValidationFailures(errors []ValidationError) {
+	for _, e := range errors {
+		field := e.Field
+		switch {
+		case e.Code == CodeUnknownField:
+			field = "unknown"
+		case strings.HasPrefix(field, "metadata."):
+			field = "metadata"
+		case strings.HasPrefix(field, "lines["):
+			field = "lines"
+		}
+		metrics.OrdersValidationFailed.WithLabelValues(field, e.Code).Inc()
+	}
+}
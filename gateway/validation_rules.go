@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ValidationRule is an additional check executed by ValidateOrderRequest after the built-in checks
+// Deployments register rules for storefront-specific constraints instead of editing validation.go
+type ValidationRule interface {
+	Validate(order *OrderRequest) []ValidationError
+}
+
+// ValidationRuleFunc adapts a plain function (custom predicate) to the ValidationRule interface
+type ValidationRuleFunc func(order *OrderRequest) []ValidationError
+
+// Validate calls f(order)
+func (f ValidationRuleFunc) Validate(order *OrderRequest) []ValidationError {
+	return f(order)
+}
+
+var (
+	validationRulesMu sync.RWMutex
+	validationRules   []ValidationRule
+)
+
+// RegisterValidationRule adds a rule to the set executed for every order request
+// Rules run in registration order; all rules run even if an earlier rule fails
+func RegisterValidationRule(rule ValidationRule) {
+	validationRulesMu.Lock()
+	defer validationRulesMu.Unlock()
+	validationRules = append(validationRules, rule)
+}
+
+// runValidationRules executes all registered rules and collects their errors
+func runValidationRules(order *OrderRequest) []ValidationError {
+	validationRulesMu.RLock()
+	defer validationRulesMu.RUnlock()
+
+	var errors []ValidationError
+	for _, rule := range validationRules {
+		errors = append(errors, rule.Validate(order)...)
+	}
+	return errors
+}
+
+// ValidationRuleConfig describes a rule loaded from the rules file (VALIDATION_RULES_FILE)
+// Each entry targets a single string field and may combine several constraints
+//
+// Example file:
+//
+//	[
+//	  {"field": "item_id", "allowed_prefixes": ["sku-", "promo-"]},
+//	  {"field": "user_id", "pattern": "^u[0-9]+$", "message": "user_id must look like u123"}
+//	]
+type ValidationRuleConfig struct {
+	Field            string   `json:"field"`
+	Pattern          string   `json:"pattern,omitempty"`
+	AllowedPrefixes  []string `json:"allowed_prefixes,omitempty"`
+	DisallowedValues []string `json:"disallowed_values,omitempty"`
+	Message          string   `json:"message,omitempty"` // Overrides the generated error message
+}
+
+// fieldRule is the compiled form of a ValidationRuleConfig
+type fieldRule struct {
+	field           string
+	pattern         *regexp.Regexp
+	allowedPrefixes []string
+	disallowed      map[string]bool
+	message         string
+}
+
+// Validate checks the configured field against the compiled constraints
+// Empty values are skipped; required-ness is enforced by the built-in checks
+func (fr *fieldRule) Validate(order *OrderRequest) []ValidationError {
+	value, _ := orderFieldValue(order, fr.field)
+	if value == "" {
+		return nil
+	}
+
+	var errors []ValidationError
+	if fr.pattern != nil && !fr.pattern.MatchString(value) {
+		errors = append(errors, fr.newError(CodePatternMismatch, fmt.Sprintf("%s does not match required pattern %s", fr.field, fr.pattern.String()), fr.pattern.String()))
+	}
+	if len(fr.allowedPrefixes) > 0 && !hasAnyPrefix(value, fr.allowedPrefixes) {
+		prefixes := strings.Join(fr.allowedPrefixes, ", ")
+		errors = append(errors, fr.newError(CodePrefixNotAllowed, fmt.Sprintf("%s must start with one of: %s", fr.field, prefixes), prefixes))
+	}
+	if fr.disallowed[value] {
+		errors = append(errors, fr.newError(CodeValueNotAllowed, fmt.Sprintf("%s value is not allowed", fr.field)))
+	}
+	return errors
+}
+
+// newError builds a rule violation; a configured message override is returned verbatim
+// under CodeRuleViolation since the catalogs cannot translate deployment-specific text
+func (fr *fieldRule) newError(code string, message string, params ...interface{}) ValidationError {
+	if fr.message != "" {
+		return ValidationError{Field: fr.field, Code: CodeRuleViolation, Message: fr.message}
+	}
+	return ValidationError{Field: fr.field, Code: code, Message: message, Params: params}
+}
+
+// LoadValidationRules reads rule definitions from a JSON file and registers them
+// Returns an error for unreadable files, unknown fields or invalid regex patterns so
+// misconfiguration fails at startup rather than silently disabling a rule
+func LoadValidationRules(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("read validation rules: %w", err)
+	}
+
+	var configs []ValidationRuleConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&configs); err != nil {
+		return 0, fmt.Errorf("parse validation rules: %w", err)
+	}
+
+	rules := make([]ValidationRule, 0, len(configs))
+	for i, cfg := range configs {
+		rule, err := compileFieldRule(cfg)
+		if err != nil {
+			return 0, fmt.Errorf("validation rule %d: %w", i, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	for _, rule := range rules {
+		RegisterValidationRule(rule)
+	}
+	return len(rules), nil
+}
+
+func compileFieldRule(cfg ValidationRuleConfig) (*fieldRule, error) {
+	if _, ok := orderFieldValue(&OrderRequest{}, cfg.Field); !ok {
+		return nil, fmt.Errorf("unsupported field %q", cfg.Field)
+	}
+
+	rule := &fieldRule{
+		field:           cfg.Field,
+		allowedPrefixes: cfg.AllowedPrefixes,
+		message:         cfg.Message,
+	}
+	if cfg.Pattern != "" {
+		pattern, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern for %s: %w", cfg.Field, err)
+		}
+		rule.pattern = pattern
+	}
+	if len(cfg.DisallowedValues) > 0 {
+		rule.disallowed = make(map[string]bool, len(cfg.DisallowedValues))
+		for _, v := range cfg.DisallowedValues {
+			rule.disallowed[v] = true
+		}
+	}
+	return rule, nil
+}
+
+// orderFieldValue returns the value of a string field by its JSON name
+func orderFieldValue(order *OrderRequest, field string) (string, bool) {
+	switch field {
+	case "user_id":
+		return order.UserID, true
+	case "recipient_user_id":
+		return order.RecipientUserID, true
+	case "item_id":
+		return order.ItemID, true
+	case "request_id":
+		return order.RequestID, true
+	case "channel":
+		return order.Channel, true
+	default:
+		return "", false
+	}
+}
+
+func hasAnyPrefix(value string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
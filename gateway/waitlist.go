@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// luaOfferWaitlistScript pops up to one waitlisted user per restocked unit, oldest first
+// KEYS[1] is waitlist:{item_id}, KEYS[2] waitlist_restock:{item_id}, KEYS[3] waitlist_items
+// ARGV[1] is the item_id, ARGV[2] the maximum number of users to pop
+// Returns the popped user IDs; gateways run it concurrently, and each user is popped only once
+const luaOfferWaitlistScript = `
+local restock = tonumber(redis.call('GET', KEYS[2]) or '0')
+local offered = {}
+while restock > 0 and #offered < tonumber(ARGV[2]) do
+    local popped = redis.call('ZPOPMIN', KEYS[1])
+    if #popped == 0 then
+        break
+    end
+    table.insert(offered, popped[1])
+    restock = restock - 1
+end
+
+if redis.call('ZCARD', KEYS[1]) == 0 then
+    redis.call('SREM', KEYS[3], ARGV[1])
+    redis.call('DEL', KEYS[2])
+elseif restock > 0 then
+    redis.call('SET', KEYS[2], restock)
+else
+    redis.call('DEL', KEYS[2])
+end
+return offered
+`
+
+// waitlistBatchSize bounds the offers one dispatcher pass issues per item
+const waitlistBatchSize = 100
+
+// waitlistOfferKey holds the purchase token offered to userID for itemID until it expires
+func waitlistOfferKey(itemID, userID string) string {
+	return "waitlist_offer:" + itemID + ":" + userID
+}
+
+// Waitlist lets users wait for sold-out items and offers restocked units to them in join order
+// Offers are purchase tokens valid for offerTTL; they give priority admission but don't hold
+// stock, so they only take effect with PURCHASE_TOKEN_REQUIRED=true
+// Positions and the waitlisted items are read from a replica when one is healthy
+type Waitlist struct {
+	router      *RedisRouter
+	tokens      *PurchaseTokenIssuer
+	offerTTL    time.Duration
+	offerScript *redis.Script
+}
+
+// waitlist is nil unless WAITLIST_ENABLED is set (requires PURCHASE_TOKEN_SECRET)
+var waitlist *Waitlist
+
+// NewWaitlist creates a waitlist whose offers are tokens from tokens, valid for offerTTL
+func NewWaitlist(router *RedisRouter, tokens *PurchaseTokenIssuer, offerTTL time.Duration) *Waitlist {
+	return &Waitlist{
+		router:      router,
+		tokens:      tokens,
+		offerTTL:    offerTTL,
+		offerScript: redis.NewScript(luaOfferWaitlistScript),
+	}
+}
+
+// Join adds userID to itemID's waitlist and returns the 1-based position
+// Joining again keeps the original position
+func (wl *Waitlist) Join(ctx context.Context, userID, itemID string) (int64, error) {
+	_, err := wl.router.Primary().TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAddNX(ctx, common.WaitlistKey(itemID), redis.Z{Score: float64(time.Now().UnixMilli()), Member: userID})
+		pipe.SAdd(ctx, common.WaitlistItemsKey, itemID)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	// The primary, which has the entry just added
+	rank, err := wl.router.Primary().ZRank(ctx, common.WaitlistKey(itemID), userID).Result()
+	if err != nil {
+		return 0, err
+	}
+	return rank + 1, nil
+}
+
+// Status returns userID's position (0 when not waiting) and pending offer token, if any
+func (wl *Waitlist) Status(ctx context.Context, userID, itemID string) (int64, string, time.Duration, error) {
+	pipe := wl.router.ReadClient().Pipeline()
+	rank := pipe.ZRank(ctx, common.WaitlistKey(itemID), userID)
+	offer := pipe.Get(ctx, waitlistOfferKey(itemID, userID))
+	ttl := pipe.TTL(ctx, waitlistOfferKey(itemID, userID))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, "", 0, err
+	}
+	position := int64(0)
+	if rank.Err() == nil {
+		position = rank.Val() + 1
+	}
+	return position, offer.Val(), ttl.Val(), nil
+}
+
+// Run offers restocked units to waitlisted users every interval until ctx is cancelled
+func (wl *Waitlist) Run(ctx context.Context, interval time.Duration, logger *logrus.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			wl.dispatch(ctx, logger)
+		}
+	}
+}
+
+// dispatch runs one offer pass over every item with a waitlist
+func (wl *Waitlist) dispatch(ctx context.Context, logger *logrus.Logger) {
+	itemIDs, err := wl.router.ReadClient().SMembers(ctx, common.WaitlistItemsKey).Result()
+	if err != nil {
+		logger.WithError(err).Warn("Failed to list waitlisted items")
+		return
+	}
+	for _, itemID := range itemIDs {
+		userIDs, err := wl.offerScript.Run(ctx, wl.router.Primary(),
+			[]string{common.WaitlistKey(itemID), common.WaitlistRestockKey(itemID), common.WaitlistItemsKey},
+			itemID, waitlistBatchSize).StringSlice()
+		if err != nil {
+			logger.WithError(err).WithField("item_id", itemID).Warn("Waitlist dispatch failed")
+			continue
+		}
+		now := time.Now()
+		for _, userID := range userIDs {
+			token, claims := wl.tokens.IssueUntil(userID, itemID, now.Add(wl.offerTTL))
+			if err := wl.router.Primary().Set(ctx, waitlistOfferKey(itemID, userID), token, wl.offerTTL).Err(); err != nil {
+				logger.WithError(err).WithFields(map[string]interface{}{
+					"item_id": itemID,
+					"user_id": userID,
+				}).Error("Failed to store waitlist offer")
+				continue
+			}
+			metrics.Waitlist.WithLabelValues("offered").Inc()
+			logger.WithFields(map[string]interface{}{
+				"event":      "waitlist_offer_issued",
+				"item_id":    itemID,
+				"user_id":    userID,
+				"session_id": claims.SessionID,
+			}).Info("Restocked unit offered to waitlisted user")
+		}
+	}
+}
+
+// WaitlistRequest is the body of POST /waitlist/{item_id}
+type WaitlistRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// handleJoinWaitlist adds a user to a sold-out item's waitlist
+func handleJoinWaitlist(w http.ResponseWriter, r *http.Request) {
+	correlationID := uuid.New().String()
+	itemID := r.PathValue("item_id")
+	logEntry := common.WithEvent(correlationID, "waitlist_join_requested").WithFields(map[string]interface{}{
+		"client_ip": clientIP(r),
+		"item_id":   itemID,
+	})
+	w.Header().Set("Content-Type", "application/json")
+
+	var join WaitlistRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&join); err != nil {
+		logEntry.WithError(err).Warn("Invalid waitlist request body")
+		writeError(w, r, http.StatusBadRequest, ErrCodeInvalidBody, correlationID, map[string]interface{}{
+			"errors": []ValidationError{decodeErrorToValidationError(err)},
+		})
+		return
+	}
+	validationErrors := append(validateID("user_id", join.UserID, maxUserIDLength),
+		validateID("item_id", itemID, maxItemIDLength)...)
+	if len(validationErrors) > 0 {
+		writeError(w, r, http.StatusBadRequest, ErrCodeValidationFailed, correlationID, map[string]interface{}{
+			"errors": validationErrors,
+		})
+		return
+	}
+	logEntry = logEntry.WithField("user_id", join.UserID)
+
+	position, err := waitlist.Join(r.Context(), join.UserID, itemID)
+	if err != nil {
+		redisHealth.Observe(err)
+		logEntry.WithError(err).Error("Failed to join waitlist")
+		writeError(w, r, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, correlationID, nil)
+		return
+	}
+	metrics.Waitlist.WithLabelValues("joined").Inc()
+	logEntry.WithFields(map[string]interface{}{
+		"event":    "waitlist_joined",
+		"position": position,
+	}).Info("User joined waitlist")
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"item_id":        itemID,
+		"user_id":        join.UserID,
+		"position":       position,
+		"correlation_id": correlationID,
+	})
+}
+
+// handleWaitlistStatus returns a user's waitlist position, or their offer once one is issued
+// Query parameter: user_id
+func handleWaitlistStatus(w http.ResponseWriter, r *http.Request) {
+	correlationID := uuid.New().String()
+	itemID := r.PathValue("item_id")
+	userID := r.URL.Query().Get("user_id")
+	w.Header().Set("Content-Type", "application/json")
+
+	validationErrors := append(validateID("user_id", userID, maxUserIDLength),
+		validateID("item_id", itemID, maxItemIDLength)...)
+	if len(validationErrors) > 0 {
+		writeError(w, r, http.StatusBadRequest, ErrCodeValidationFailed, correlationID, map[string]interface{}{
+			"errors": validationErrors,
+		})
+		return
+	}
+
+	position, offer, ttl, err := waitlist.Status(r.Context(), userID, itemID)
+	if err != nil {
+		redisHealth.Observe(err)
+		common.WithCorrelationID(correlationID).WithError(err).Error("Failed to read waitlist status")
+		writeError(w, r, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, correlationID, nil)
+		return
+	}
+	response := map[string]interface{}{
+		"item_id":        itemID,
+		"user_id":        userID,
+		"position":       position,
+		"correlation_id": correlationID,
+	}
+	if offer != "" {
+		response["purchase_token"] = offer
+		response["expires_at"] = time.Now().Add(ttl).UTC().Format(time.RFC3339)
+	}
+	json.NewEncoder(w).Encode(response)
+}
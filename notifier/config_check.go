@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// startupConfig is the configuration resolved at startup, served at GET /admin/config
+var startupConfig *common.ConfigReport
+
+// notifierConfig resolves the notifier's configuration without connecting to Redis or Kafka
+// and checks the combinations main can't catch on its own (-validate-config)
+// Defaults mirror main; keep both in step when adding a setting
+func notifierConfig() *common.ConfigReport {
+	r := common.NewConfigReport("notifier")
+	common.ReportSharedConfig(r)
+
+	r.String("NOTIFIER_GROUP", "notifier")
+	known := make(map[string]bool, len(common.OrderResultStatuses))
+	for _, status := range common.OrderResultStatuses {
+		known[status] = true
+	}
+	for _, status := range r.List("NOTIFIER_STATUSES", strings.Join(defaultNotifyStatuses, ",")) {
+		if !known[status] {
+			r.Errorf("NOTIFIER_STATUSES entry %q is not an order result status; it would never match", status)
+		}
+	}
+	r.Duration("NOTIFIER_DEDUP_TTL", 24*time.Hour)
+	if r.Secret("ORDER_STORE_DSN") == "" {
+		r.Warnf("ORDER_STORE_DSN is not set; users' notification preferences are ignored")
+	}
+
+	// Channels
+	webhookURL := r.URL("NOTIFIER_WEBHOOK_URL")
+	if webhookURL != "" {
+		r.Duration("NOTIFIER_WEBHOOK_TIMEOUT", 5*time.Second)
+		r.Int("NOTIFIER_WEBHOOK_RETRIES", 5)
+	}
+	provider := emailProviderName()
+	switch provider {
+	case "":
+		r.Set("NOTIFIER_EMAIL_PROVIDER", "", common.ConfigSourceDefault)
+	case EmailProviderSMTP, EmailProviderSES, EmailProviderSendGrid:
+		r.String("NOTIFIER_EMAIL_PROVIDER", EmailProviderSMTP)
+	default:
+		r.OneOf("NOTIFIER_EMAIL_PROVIDER", EmailProviderSMTP, EmailProviderSES, EmailProviderSendGrid)
+	}
+	if _, known := defaultEmailRateLimits[provider]; known {
+		// Record the provider's settings; NewEmailProviderFromEnv reports what's missing
+		switch provider {
+		case EmailProviderSMTP:
+			r.String("NOTIFIER_SMTP_ADDR", "")
+			r.String("NOTIFIER_SMTP_USERNAME", "")
+			r.Secret("NOTIFIER_SMTP_PASSWORD")
+		case EmailProviderSES:
+			r.String("NOTIFIER_SES_REGION", "")
+			r.URL("NOTIFIER_SES_ENDPOINT")
+			r.String("AWS_ACCESS_KEY_ID", "")
+			r.Secret("AWS_SECRET_ACCESS_KEY")
+			r.Secret("AWS_SESSION_TOKEN")
+		case EmailProviderSendGrid:
+			r.Secret("NOTIFIER_SENDGRID_API_KEY")
+			r.URL("NOTIFIER_SENDGRID_URL")
+		}
+		emailProvider, err := NewEmailProviderFromEnv(provider, nil)
+		r.Check("NOTIFIER_EMAIL_PROVIDER", err)
+		templates, err := LoadEmailTemplates(r.String("NOTIFIER_EMAIL_TEMPLATES", ""))
+		r.Check("NOTIFIER_EMAIL_TEMPLATES", err)
+		rateLimit := r.Float("NOTIFIER_"+strings.ToUpper(provider)+"_RATE_LIMIT", defaultEmailRateLimits[provider])
+		if rateLimit < 0 {
+			r.Errorf("NOTIFIER_%s_RATE_LIMIT must not be negative", strings.ToUpper(provider))
+		}
+		_, err = NewEmailSender(emailProvider, r.String("NOTIFIER_EMAIL_FROM", ""), templates, rateLimit, 0)
+		r.Check("NOTIFIER_EMAIL_FROM", err)
+		r.Duration("NOTIFIER_EMAIL_TIMEOUT", 10*time.Second)
+		r.Int("NOTIFIER_EMAIL_RETRIES", 3)
+	}
+	accountSID := r.String("NOTIFIER_SMS_ACCOUNT_SID", "")
+	if accountSID != "" {
+		budgets, err := parseSMSBudgets(r.String("NOTIFIER_SMS_CAMPAIGN_BUDGETS", ""))
+		r.Check("NOTIFIER_SMS_CAMPAIGN_BUDGETS", err)
+		cfg := SMSConfig{
+			BaseURL:     r.URL("NOTIFIER_SMS_URL"),
+			AccountSID:  accountSID,
+			AuthToken:   r.Secret("NOTIFIER_SMS_AUTH_TOKEN"),
+			From:        r.String("NOTIFIER_SMS_FROM", ""),
+			Items:       r.List("NOTIFIER_SMS_ITEMS", ""),
+			MinQuantity: int64(r.Int("NOTIFIER_SMS_MIN_QUANTITY", 1)),
+			Cost:        r.Float("NOTIFIER_SMS_COST", 0),
+			Budget:      r.Float("NOTIFIER_SMS_CAMPAIGN_BUDGET", 0),
+			Budgets:     budgets,
+		}
+		_, err = NewSMSSender(cfg, nil)
+		r.Check("NOTIFIER_SMS_ACCOUNT_SID", err)
+		if cfg.Cost == 0 && (cfg.Budget > 0 || len(budgets) > 0) {
+			r.Warnf("SMS campaign budgets are set but NOTIFIER_SMS_COST is 0; budgets are not enforced")
+		}
+		r.Duration("NOTIFIER_SMS_TIMEOUT", 10*time.Second)
+		r.Int("NOTIFIER_SMS_RETRIES", 3)
+	}
+	if webhookURL == "" && provider == "" && accountSID == "" {
+		r.Warnf("No notification channel (NOTIFIER_WEBHOOK_URL, NOTIFIER_EMAIL_PROVIDER, NOTIFIER_SMS_ACCOUNT_SID) is set; notifications are only logged")
+	}
+
+	if secret := r.Secret("ADMIN_TOKEN_SECRET"); secret != "" {
+		_, err := common.NewAdminAuth(secret)
+		r.Check("ADMIN_TOKEN_SECRET", err)
+	}
+	return r
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"sync/atomic"
+
+	"github.com/IBM/sarama"
+)
+
+// resultConsumer feeds the order-results partitions claimed by this instance to the notifier
+// Offsets are committed per message after its notifications are handled, so a restart
+// resumes where it stopped and redelivered results are caught by the dedup markers
+type resultConsumer struct {
+	notifier *Notifier
+	active   atomic.Bool // In a consumer group session (false while rebalancing or disconnected)
+}
+
+func (c *resultConsumer) Setup(sarama.ConsumerGroupSession) error {
+	c.active.Store(true)
+	return nil
+}
+
+func (c *resultConsumer) Cleanup(sarama.ConsumerGroupSession) error {
+	c.active.Store(false)
+	return nil
+}
+
+func (c *resultConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			c.notifier.Handle(session.Context(), msg.Value)
+			session.MarkMessage(msg, "")
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// userEmailKey holds a user's email address, written by the account system
+// Users without one get no email; other channels are unaffected
+func userEmailKey(userID string) string {
+	return "user_email:" + userID
+}
+
+// Email is one rendered message handed to a provider
+type Email struct {
+	From    string
+	To      string
+	Subject string // Single line
+	Body    string // Plain text, \n line endings
+}
+
+// EmailSender renders notification emails and sends them through the configured provider,
+// at most the provider's rate limit per second, retrying transient failures
+type EmailSender struct {
+	provider  EmailProvider
+	from      string
+	templates *EmailTemplates
+	limiter   *sendLimiter
+	retries   int
+	backoff   time.Duration
+}
+
+// NewEmailSender creates a sender for provider
+// ratePerSecond caps sends from this instance (0 = unlimited); retries is the number of
+// attempts after the first, with exponential backoff starting at 500ms
+func NewEmailSender(provider EmailProvider, from string, templates *EmailTemplates, ratePerSecond float64, retries int) (*EmailSender, error) {
+	if from == "" || strings.ContainsAny(from, "\r\n") {
+		return nil, errors.New("NOTIFIER_EMAIL_FROM is required")
+	}
+	return &EmailSender{
+		provider:  provider,
+		from:      from,
+		templates: templates,
+		limiter:   newSendLimiter(ratePerSecond),
+		retries:   retries,
+		backoff:   500 * time.Millisecond,
+	}, nil
+}
+
+func (s *EmailSender) Channel() string { return ChannelEmail }
+
+func (s *EmailSender) Send(ctx context.Context, notification Notification) error {
+	to, err := s.recipient(ctx, notification.UserID)
+	if err != nil {
+		return err
+	}
+	subject, body, err := s.templates.Render(notification)
+	if err != nil {
+		return err
+	}
+	email := Email{From: s.from, To: to, Subject: subject, Body: body}
+
+	provider := s.provider.Name()
+	backoff := s.backoff
+	for attempt := 0; ; attempt++ {
+		waited, err := s.limiter.Wait(ctx)
+		if err != nil {
+			return err
+		}
+		if waited {
+			metrics.EmailThrottled.WithLabelValues(provider).Inc()
+		}
+
+		start := time.Now()
+		err = s.provider.Send(ctx, email)
+		metrics.EmailSendDuration.WithLabelValues(provider).Observe(time.Since(start).Seconds())
+		if err == nil {
+			metrics.EmailDeliveries.WithLabelValues(provider, "accepted").Inc()
+			return nil
+		}
+		if permanent, ok := err.(permanentError); ok {
+			metrics.EmailDeliveries.WithLabelValues(provider, "rejected").Inc()
+			return permanent.err
+		}
+		metrics.EmailDeliveries.WithLabelValues(provider, "failed").Inc()
+		if attempt >= s.retries {
+			return err
+		}
+		metrics.Notifications.WithLabelValues(ChannelEmail, "retried").Inc()
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// recipient looks up the user's email address; errNoRecipient if there is none
+func (s *EmailSender) recipient(ctx context.Context, userID string) (string, error) {
+	if userID == "" {
+		return "", errNoRecipient
+	}
+	to, err := redisClient.Get(ctx, userEmailKey(userID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", errNoRecipient
+	}
+	if err != nil {
+		return "", err
+	}
+	if to = strings.TrimSpace(to); to == "" || strings.ContainsAny(to, "\r\n") {
+		return "", errNoRecipient
+	}
+	return to, nil
+}
+
+// sendLimiter spaces sends evenly at a fixed rate on this instance
+// Provider quotas are per account: divide them across notifier instances
+type sendLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// newSendLimiter creates a limiter for perSecond sends; nil (unlimited) if perSecond <= 0
+func newSendLimiter(perSecond float64) *sendLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &sendLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// Wait blocks until the next send slot and reports whether it had to wait
+func (l *sendLimiter) Wait(ctx context.Context) (bool, error) {
+	if l == nil {
+		return false, nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := time.Until(slot)
+	if delay <= 0 {
+		return false, nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true, nil
+	case <-ctx.Done():
+		return true, ctx.Err()
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// Email providers (NOTIFIER_EMAIL_PROVIDER)
+const (
+	EmailProviderSMTP     = "smtp"
+	EmailProviderSES      = "ses"      // Amazon SES v2 API
+	EmailProviderSendGrid = "sendgrid" // SendGrid v3 mail send API
+)
+
+// defaultEmailRateLimits are the per-instance sends per second when NOTIFIER_<PROVIDER>_RATE_LIMIT
+// is unset; SES matches its default account sending rate
+var defaultEmailRateLimits = map[string]float64{
+	EmailProviderSMTP:     10,
+	EmailProviderSES:      14,
+	EmailProviderSendGrid: 100,
+}
+
+// EmailProvider hands a rendered email to a mail service
+// Errors wrapped in permanentError are not retried (e.g. a rejected address)
+type EmailProvider interface {
+	Name() string
+	Send(ctx context.Context, email Email) error
+}
+
+// emailProviderName returns NOTIFIER_EMAIL_PROVIDER; smtp when only NOTIFIER_SMTP_ADDR is set,
+// empty when email is off
+func emailProviderName() string {
+	if name := os.Getenv("NOTIFIER_EMAIL_PROVIDER"); name != "" {
+		return name
+	}
+	if os.Getenv("NOTIFIER_SMTP_ADDR") != "" {
+		return EmailProviderSMTP
+	}
+	return ""
+}
+
+// NewEmailProviderFromEnv creates the named provider from its NOTIFIER_<PROVIDER>_* settings
+// client is used by the HTTP API providers (SES, SendGrid)
+func NewEmailProviderFromEnv(name string, client *http.Client) (EmailProvider, error) {
+	switch name {
+	case EmailProviderSMTP:
+		return NewSMTPProvider(os.Getenv("NOTIFIER_SMTP_ADDR"), os.Getenv("NOTIFIER_SMTP_USERNAME"), os.Getenv("NOTIFIER_SMTP_PASSWORD"))
+	case EmailProviderSES:
+		return NewSESProvider(os.Getenv("NOTIFIER_SES_REGION"), os.Getenv("NOTIFIER_SES_ENDPOINT"),
+			common.AWSCredentialsFromEnv(), client)
+	case EmailProviderSendGrid:
+		return NewSendGridProvider(os.Getenv("NOTIFIER_SENDGRID_API_KEY"), os.Getenv("NOTIFIER_SENDGRID_URL"), client)
+	default:
+		return nil, fmt.Errorf("unknown email provider %q", name)
+	}
+}
+
+// SMTPProvider sends through an SMTP relay; without a username the relay must accept
+// unauthenticated mail
+type SMTPProvider struct {
+	addr string
+	auth smtp.Auth
+}
+
+// NewSMTPProvider creates a provider for the relay at addr (host:port)
+func NewSMTPProvider(addr, username, password string) (*SMTPProvider, error) {
+	if addr == "" {
+		return nil, errors.New("NOTIFIER_SMTP_ADDR is required")
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	p := &SMTPProvider{addr: addr}
+	if username != "" {
+		p.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return p, nil
+}
+
+func (p *SMTPProvider) Name() string { return EmailProviderSMTP }
+
+func (p *SMTPProvider) Send(_ context.Context, email Email) error {
+	msg := "From: " + email.From + "\r\n" +
+		"To: " + email.To + "\r\n" +
+		"Subject: " + email.Subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + strings.ReplaceAll(email.Body, "\n", "\r\n")
+	err := smtp.SendMail(p.addr, p.auth, email.From, []string{email.To}, []byte(msg))
+	// 5xx replies (unknown mailbox, policy rejections) won't succeed on retry
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return permanentError{err}
+	}
+	return err
+}
+
+// SendGridProvider sends through the SendGrid v3 mail send API
+type SendGridProvider struct {
+	apiKey string
+	url    string
+	client *http.Client
+}
+
+// NewSendGridProvider creates a provider; apiURL defaults to the public API
+func NewSendGridProvider(apiKey, apiURL string, client *http.Client) (*SendGridProvider, error) {
+	if apiKey == "" {
+		return nil, errors.New("NOTIFIER_SENDGRID_API_KEY is required")
+	}
+	if apiURL == "" {
+		apiURL = "https://api.sendgrid.com/v3/mail/send"
+	}
+	return &SendGridProvider{apiKey: apiKey, url: apiURL, client: client}, nil
+}
+
+func (p *SendGridProvider) Name() string { return EmailProviderSendGrid }
+
+func (p *SendGridProvider) Send(ctx context.Context, email Email) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"personalizations": []map[string]interface{}{{"to": []map[string]string{{"email": email.To}}}},
+		"from":             map[string]string{"email": email.From},
+		"subject":          email.Subject,
+		"content":          []map[string]string{{"type": "text/plain", "value": email.Body}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	return doProviderRequest(p.client, req, EmailProviderSendGrid)
+}
+
+// SESProvider sends through the Amazon SES v2 API, signing requests with AWS Signature Version 4
+type SESProvider struct {
+	region   string
+	endpoint *url.URL
+	creds    common.AWSCredentials
+	client   *http.Client
+}
+
+// NewSESProvider creates a provider for region; endpoint defaults to https://email.<region>.amazonaws.com
+func NewSESProvider(region, endpoint string, creds common.AWSCredentials, client *http.Client) (*SESProvider, error) {
+	if region == "" {
+		return nil, errors.New("NOTIFIER_SES_REGION is required")
+	}
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		return nil, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required")
+	}
+	if endpoint == "" {
+		endpoint = "https://email." + region + ".amazonaws.com"
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid NOTIFIER_SES_ENDPOINT %q", endpoint)
+	}
+	return &SESProvider{
+		region:   region,
+		endpoint: parsed,
+		creds:    creds,
+		client:   client,
+	}, nil
+}
+
+func (p *SESProvider) Name() string { return EmailProviderSES }
+
+func (p *SESProvider) Send(ctx context.Context, email Email) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"FromEmailAddress": email.From,
+		"Destination":      map[string][]string{"ToAddresses": {email.To}},
+		"Content": map[string]interface{}{
+			"Simple": map[string]interface{}{
+				"Subject": map[string]string{"Data": email.Subject, "Charset": "UTF-8"},
+				"Body":    map[string]interface{}{"Text": map[string]string{"Data": email.Body, "Charset": "UTF-8"}},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	endpoint := *p.endpoint
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + "/v2/email/outbound-emails"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	common.SignAWSRequest(req, body, "ses", p.region, p.creds, time.Now())
+	return doProviderRequest(p.client, req, EmailProviderSES)
+}
+
+// doProviderRequest sends an email or SMS API request; 429 and 5xx responses are retryable,
+// other 4xx responses are permanent
+func doProviderRequest(client *http.Client, req *http.Request, provider string) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("%s returned %s: %s", provider, resp.Status, strings.TrimSpace(string(detail)))
+	default:
+		return permanentError{fmt.Errorf("%s rejected the message: %s: %s", provider, resp.Status, strings.TrimSpace(string(detail)))}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// Email template names; NOTIFIER_EMAIL_TEMPLATES/<name>.tmpl replaces the built-in one
+const (
+	TemplateOrderConfirmation = "order_confirmation"
+	TemplateCodeDelivered     = "code_delivered"
+	TemplateSoldOut           = "sold_out"
+	TemplatePaymentFailed     = "payment_failed"
+	TemplateOrderCancelled    = "order_cancelled"
+	TemplateOrderExpired      = "order_expired"
+	TemplateOrderFailed       = "order_failed" // FAILED and any other status
+)
+
+// templateForStatus picks the template for a result status
+var templateForStatus = map[string]string{
+	common.ResultCompleted:     TemplateOrderConfirmation,
+	common.ResultDelivered:     TemplateCodeDelivered,
+	common.ResultFailedSoldOut: TemplateSoldOut,
+	common.ResultFailedPayment: TemplatePaymentFailed,
+	common.ResultCancelled:     TemplateOrderCancelled,
+	common.ResultExpired:       TemplateOrderExpired,
+}
+
+// orderFooter identifies the order at the end of every built-in template
+const orderFooter = "\n\nOrder: {{.RequestID}}\n{{with .ItemID}}Item: {{.}}\n{{end}}"
+
+// defaultEmailTemplates are used for templates without an override file
+// The first line is the subject; the body follows a blank line
+var defaultEmailTemplates = map[string]string{
+	TemplateOrderConfirmation: "Your order is confirmed\n\nYour order is confirmed and on its way to fulfillment." + orderFooter,
+	TemplateCodeDelivered:     "Your code is ready\n\nYour code: {{.DeliveryCode}}" + orderFooter,
+	TemplateSoldOut:           "Sold out\n\nSorry, the item sold out before your order could be reserved. You have not been charged." + orderFooter,
+	TemplatePaymentFailed:     "Payment failed\n\nYour payment didn't go through, so the item was released. You have not been charged." + orderFooter,
+	TemplateOrderCancelled:    "Order cancelled\n\nYour order was cancelled as requested." + orderFooter,
+	TemplateOrderExpired:      "Order expired\n\nYour order couldn't be processed in time and has expired. You have not been charged." + orderFooter,
+	TemplateOrderFailed:       "Order update\n\nYour order could not be processed. Please contact support if you were charged." + orderFooter,
+}
+
+// EmailTemplates renders notification emails with text/template; templates see the
+// Notification fields (.RequestID, .UserID, .ItemID, .Status, .Reason, .DeliveryCode, .Timestamp)
+type EmailTemplates struct {
+	templates map[string]*template.Template
+}
+
+// LoadEmailTemplates parses the built-in templates, replaced by <name>.tmpl files in dir if set
+func LoadEmailTemplates(dir string) (*EmailTemplates, error) {
+	t := &EmailTemplates{templates: make(map[string]*template.Template, len(defaultEmailTemplates))}
+	for name, text := range defaultEmailTemplates {
+		if dir != "" {
+			data, err := os.ReadFile(filepath.Join(dir, name+".tmpl"))
+			if err == nil {
+				text = string(data)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+		parsed, err := template.New(name).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("email template %s: %w", name, err)
+		}
+		t.templates[name] = parsed
+	}
+	return t, nil
+}
+
+// Render returns the subject and body for notification
+func (t *EmailTemplates) Render(notification Notification) (string, string, error) {
+	name, ok := templateForStatus[notification.Status]
+	if !ok {
+		name = TemplateOrderFailed
+	}
+	var out bytes.Buffer
+	if err := t.templates[name].Execute(&out, notification); err != nil {
+		return "", "", fmt.Errorf("email template %s: %w", name, err)
+	}
+	subject, body, _ := strings.Cut(out.String(), "\n")
+	subject = strings.TrimSpace(subject)
+	if subject == "" {
+		return "", "", fmt.Errorf("email template %s rendered an empty subject", name)
+	}
+	return subject, strings.TrimLeft(body, "\n"), nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+	"github.com/yourname/flash-sale-engine/common/app"
+)
+
+var (
+	redisClient   *redis.Client
+	logger        *logrus.Logger
+	metrics       *common.NotifierMetrics
+	payloadCipher *common.PayloadCipher // Decrypts digital delivery codes; nil without payload encryption keys
+)
+
+func main() {
+	a := app.New("notifier", notifierConfig)
+	bootstrapOnly := flag.Bool("bootstrap-topics", false, "Create required Kafka topics and exit")
+	a.Parse()
+
+	// Logger, build info, startup configuration (GET /admin/config) and signal handling
+	a.Start()
+	logger = a.Logger
+	startupConfig = a.Config
+
+	// Initialize Prometheus metrics before anything that records them (HTTP clients)
+	metrics = common.InitNotifierMetrics()
+
+	// Create required Kafka topics if bootstrap is enabled (KAFKA_TOPIC_BOOTSTRAP=true)
+	if *bootstrapOnly || getEnvBool("KAFKA_TOPIC_BOOTSTRAP", false) {
+		a.BootstrapTopics()
+		if *bootstrapOnly {
+			logger.Info("Kafka topics bootstrapped")
+			return
+		}
+	}
+
+	// Redis holds the dedup markers, user contacts and channel preferences, SMS spend and
+	// undeliverable notifications
+	redisClient = a.NewRedisClient(metrics.Redis)
+	if err := redisClient.Ping(context.Background()).Err(); err != nil {
+		logger.WithError(err).Fatal("Failed to connect to Redis")
+	}
+
+	// Digital delivery codes arrive encrypted with the processors' payload encryption keys
+	// (PAYLOAD_ENCRYPTION_KEYS / PAYLOAD_ENCRYPTION_KEYS_FILE)
+	var err error
+	payloadCipher, err = common.LoadPayloadCipher()
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid payload encryption configuration")
+	}
+
+	// Users' notification preferences live in the order store database (ORDER_STORE_DSN), written
+	// by the gateway; without it every user gets the default channels
+	if dsn := os.Getenv("ORDER_STORE_DSN"); dsn != "" {
+		preferenceStore, err = common.NewNotificationPreferencesStore(context.Background(), dsn)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to connect to the order store")
+		}
+		a.OnShutdown("notification preferences", func(context.Context) error { return preferenceStore.Close() })
+	} else {
+		logger.Warn("ORDER_STORE_DSN not set, notification preferences are not applied")
+	}
+
+	// Shared connection pool for the webhook and provider APIs (HTTP_CLIENT_*, see common.HTTPTransportConfigFromEnv)
+	httpTransport := common.NewHTTPTransport(common.HTTPTransportConfigFromEnv(), metrics.HTTPClients)
+	a.OnShutdown("outbound HTTP clients", func(context.Context) error {
+		httpTransport.CloseIdleConnections()
+		return nil
+	})
+
+	// Channels: NOTIFIER_WEBHOOK_URL (NOTIFIER_WEBHOOK_TIMEOUT, default: 5s; NOTIFIER_WEBHOOK_RETRIES,
+	// default: 5) and email through NOTIFIER_EMAIL_PROVIDER (smtp|ses|sendgrid)
+	// Without either, notifications are only logged
+	var senders []Sender
+	if webhookURL := os.Getenv("NOTIFIER_WEBHOOK_URL"); webhookURL != "" {
+		client := httpTransport.Client("notification_webhook", getEnvDuration("NOTIFIER_WEBHOOK_TIMEOUT", 5*time.Second))
+		senders = append(senders, NewWebhookSender(webhookURL, client, getEnvInt("NOTIFIER_WEBHOOK_RETRIES", 5)))
+	}
+
+	// Email: provider settings (NOTIFIER_SMTP_*, NOTIFIER_SES_* with AWS_*, NOTIFIER_SENDGRID_*),
+	// NOTIFIER_<PROVIDER>_RATE_LIMIT sends per second, NOTIFIER_EMAIL_TIMEOUT (default: 10s),
+	// NOTIFIER_EMAIL_RETRIES (default: 3) and template overrides in NOTIFIER_EMAIL_TEMPLATES
+	if providerName := emailProviderName(); providerName != "" {
+		client := httpTransport.Client("email_"+providerName, getEnvDuration("NOTIFIER_EMAIL_TIMEOUT", 10*time.Second))
+		provider, err := NewEmailProviderFromEnv(providerName, client)
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid email provider configuration")
+		}
+		templates, err := LoadEmailTemplates(os.Getenv("NOTIFIER_EMAIL_TEMPLATES"))
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to load email templates")
+		}
+		rateLimit := getEnvFloat("NOTIFIER_"+strings.ToUpper(providerName)+"_RATE_LIMIT", defaultEmailRateLimits[providerName])
+		email, err := NewEmailSender(provider, os.Getenv("NOTIFIER_EMAIL_FROM"), templates, rateLimit, getEnvInt("NOTIFIER_EMAIL_RETRIES", 3))
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid email configuration")
+		}
+		senders = append(senders, email)
+		logger.WithFields(map[string]interface{}{
+			"provider":   providerName,
+			"rate_limit": rateLimit,
+		}).Info("Email notifications enabled")
+	}
+
+	// SMS: high-value confirmations through a Twilio-compatible API (NOTIFIER_SMS_*), opt-in per user
+	if accountSID := os.Getenv("NOTIFIER_SMS_ACCOUNT_SID"); accountSID != "" {
+		budgets, err := parseSMSBudgets(os.Getenv("NOTIFIER_SMS_CAMPAIGN_BUDGETS"))
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid NOTIFIER_SMS_CAMPAIGN_BUDGETS")
+		}
+		client := httpTransport.Client("sms", getEnvDuration("NOTIFIER_SMS_TIMEOUT", 10*time.Second))
+		sms, err := NewSMSSender(SMSConfig{
+			BaseURL:     os.Getenv("NOTIFIER_SMS_URL"),
+			AccountSID:  accountSID,
+			AuthToken:   os.Getenv("NOTIFIER_SMS_AUTH_TOKEN"),
+			From:        os.Getenv("NOTIFIER_SMS_FROM"),
+			Items:       getEnvList("NOTIFIER_SMS_ITEMS", nil),
+			MinQuantity: int64(getEnvInt("NOTIFIER_SMS_MIN_QUANTITY", 1)),
+			Cost:        getEnvFloat("NOTIFIER_SMS_COST", 0),
+			Budget:      getEnvFloat("NOTIFIER_SMS_CAMPAIGN_BUDGET", 0),
+			Budgets:     budgets,
+			Retries:     getEnvInt("NOTIFIER_SMS_RETRIES", 3),
+		}, client)
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid SMS configuration")
+		}
+		senders = append(senders, sms)
+	}
+	if len(senders) == 0 {
+		senders = append(senders, LogSender{})
+		logger.Warn("No notification channel configured, notifications are only logged")
+	}
+
+	// NOTIFIER_STATUSES (default: final outcomes and DELIVERED) selects the results to notify about;
+	// NOTIFIER_DEDUP_TTL (default: 24h) is how long sent notifications are remembered
+	statuses := getEnvList("NOTIFIER_STATUSES", defaultNotifyStatuses)
+	notifier := NewNotifier(senders, statuses, getEnvDuration("NOTIFIER_DEDUP_TTL", 24*time.Hour))
+	logger.WithFields(map[string]interface{}{
+		"channels": notifier.Channels(),
+		"statuses": statuses,
+	}).Info("Notification channels initialized")
+
+	// Instances share the order-results partitions through the NOTIFIER_GROUP consumer group
+	// (default: notifier); a new group starts at the newest results instead of notifying history
+	groupID := os.Getenv("NOTIFIER_GROUP")
+	if groupID == "" {
+		groupID = "notifier"
+	}
+	config := a.KafkaConfig()
+	config.Consumer.Offsets.Initial = sarama.OffsetNewest
+	group, err := sarama.NewConsumerGroup([]string{a.KafkaAddr}, groupID, config)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to create consumer group")
+	}
+	a.OnShutdown("consumer group", func(context.Context) error { return group.Close() })
+
+	handler := &resultConsumer{notifier: notifier}
+	a.Health.Register("kafka", func(context.Context) error {
+		if !handler.active.Load() {
+			return errors.New("not in a consumer group session")
+		}
+		return nil
+	})
+
+	consumeCtx, stopConsuming := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			// Consume returns on every rebalance; rejoin until shutdown
+			err := group.Consume(consumeCtx, []string{common.TopicOrderResults}, handler)
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) || consumeCtx.Err() != nil {
+				return
+			}
+			if err != nil {
+				logger.WithError(err).WithField("event", "notifier_consume_failed").Error("Consumer group session failed")
+				time.Sleep(time.Second)
+			}
+		}
+	}()
+
+	// On shutdown the current notification finishes before the group leaves and Redis closes
+	a.OnShutdown("in-flight notifications", func(ctx context.Context) error {
+		stopConsuming()
+		select {
+		case <-stopped:
+			return nil
+		case <-ctx.Done():
+			return errors.New("shutdown timeout reached, a notification may be sent again after restart")
+		}
+	})
+	logger.WithField("group", groupID).Info("Consuming order results")
+
+	// Metrics, health and the read-only admin API (ADMIN_TOKEN_SECRET, optional)
+	a.RegisterEndpoints(a.AdminAuth())
+	a.Serve(&http.Server{Addr: ":9091"}, nil)
+	logger.Info("Notifier running on :9091")
+
+	a.Run(stopped)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// Notification channels
+const (
+	ChannelWebhook = common.NotificationChannelWebhook
+	ChannelEmail   = common.NotificationChannelEmail
+	ChannelSMS     = common.NotificationChannelSMS
+	ChannelLog     = "log" // Used when no other channel is configured
+)
+
+// defaultNotifyStatuses are the results customers hear about: final outcomes, digital codes and
+// failed orders being retried after all
+// RESERVED is left out since a COMPLETED or failure result always follows it
+var defaultNotifyStatuses = []string{
+	common.ResultCompleted,
+	common.ResultDelivered,
+	common.ResultFailedSoldOut,
+	common.ResultFailedPayment,
+	common.ResultFailed,
+	common.ResultCancelled,
+	common.ResultExpired,
+	common.ResultRetrying,
+}
+
+const (
+	// notifiedKeyPrefix marks notifications already sent, since results are delivered at least once
+	notifiedKeyPrefix = "notified:"
+	// notificationsFailedKey holds notifications that exhausted their retries, for replay
+	notificationsFailedKey = "notifier:failed"
+)
+
+// optInChannels are only used for users who chose them in their channel preferences
+var optInChannels = map[string]bool{ChannelSMS: true}
+
+// errNoRecipient means the channel has nowhere to send the notification (e.g. no email on file)
+var errNoRecipient = errors.New("no recipient")
+
+// Notification is what every channel delivers: the order result plus a stable ID
+type Notification struct {
+	// NotificationID is request_id:status; receivers deduplicate on it
+	NotificationID string `json:"notification_id"`
+	common.OrderResult
+}
+
+// Sender delivers notifications over one channel
+type Sender interface {
+	Channel() string
+	Send(ctx context.Context, notification Notification) error
+}
+
+// filteringSender is a Sender that only handles some notifications (e.g. SMS for high-value orders)
+// Notifications it doesn't accept are skipped without a metric
+type filteringSender interface {
+	Accepts(notification Notification) bool
+}
+
+// Notifier turns order results into customer notifications on every configured channel
+type Notifier struct {
+	senders  []Sender
+	statuses map[string]bool
+	dedupTTL time.Duration
+}
+
+// NewNotifier creates a notifier for results with one of statuses
+// dedupTTL is how long a sent notification is remembered so redelivered results are skipped
+func NewNotifier(senders []Sender, statuses []string, dedupTTL time.Duration) *Notifier {
+	n := &Notifier{
+		senders:  senders,
+		statuses: make(map[string]bool, len(statuses)),
+		dedupTTL: dedupTTL,
+	}
+	for _, status := range statuses {
+		n.statuses[status] = true
+	}
+	return n
+}
+
+// Channels returns the configured channel names
+func (n *Notifier) Channels() []string {
+	channels := make([]string, 0, len(n.senders))
+	for _, sender := range n.senders {
+		channels = append(channels, sender.Channel())
+	}
+	return channels
+}
+
+// Handle notifies about one order-results message
+// Other events on the topic (restocks) and statuses not in NOTIFIER_STATUSES are ignored
+func (n *Notifier) Handle(ctx context.Context, value []byte) {
+	var result common.OrderResult
+	if err := json.Unmarshal(value, &result); err != nil {
+		logger.WithError(err).WithField("event", "notifier_result_invalid").Warn("Skipping unreadable order result")
+		return
+	}
+	if result.EventType != common.OrderResultEventType {
+		return
+	}
+	metrics.ResultsConsumed.WithLabelValues(result.Status).Inc()
+	if !n.statuses[result.Status] || result.RequestID == "" {
+		return
+	}
+
+	logEntry := logger.WithFields(map[string]interface{}{
+		"request_id": result.RequestID,
+		"user_id":    result.UserID,
+		"item_id":    result.ItemID,
+		"status":     result.Status,
+	})
+	result.DeliveryCode = decryptDeliveryCode(logEntry, result.DeliveryCodeEncrypted)
+	result.DeliveryCodeEncrypted = ""
+	notification := Notification{
+		NotificationID: result.RequestID + ":" + result.Status,
+		OrderResult:    result,
+	}
+	preferences, err := loadPreferences(ctx, result.UserID)
+	if err != nil {
+		// Default channels only: an opt-in channel is never used without a known preference
+		logEntry.WithError(err).Warn("Failed to load notification preferences, using default channels")
+	}
+	for _, sender := range n.senders {
+		channel := sender.Channel()
+		if filter, ok := sender.(filteringSender); ok && !filter.Accepts(notification) {
+			continue
+		}
+		if !preferences.Allows(channel, result.Status) {
+			metrics.Notifications.WithLabelValues(channel, "opted_out").Inc()
+			continue
+		}
+		n.send(ctx, logEntry.WithField("channel", channel), sender, notification)
+	}
+}
+
+// decryptDeliveryCode returns the plaintext of a digital delivery code; "" if there is none or
+// it can't be decrypted, in which case the notification goes out without the code
+func decryptDeliveryCode(logEntry *logrus.Entry, encrypted string) string {
+	if encrypted == "" {
+		return ""
+	}
+	if payloadCipher == nil {
+		logEntry.WithField("event", "delivery_code_undecryptable").Warn("No payload encryption keys, sending notification without the delivery code")
+		return ""
+	}
+	code, err := payloadCipher.DecryptValue(encrypted)
+	if err != nil {
+		logEntry.WithError(err).WithField("event", "delivery_code_undecryptable").Warn("Failed to decrypt delivery code, sending notification without it")
+		return ""
+	}
+	return string(code)
+}
+
+func (n *Notifier) send(ctx context.Context, logEntry *logrus.Entry, sender Sender, notification Notification) {
+	channel := sender.Channel()
+	first, err := redisClient.SetNX(ctx, notifiedKeyPrefix+channel+":"+notification.NotificationID, 1, n.dedupTTL).Result()
+	if err != nil {
+		// Sending twice beats not sending: receivers deduplicate on notification_id
+		logEntry.WithError(err).Warn("Notification dedup check failed, sending anyway")
+	} else if !first {
+		metrics.Notifications.WithLabelValues(channel, "duplicate").Inc()
+		return
+	}
+
+	err = sender.Send(ctx, notification)
+	switch {
+	case errors.Is(err, errNoRecipient):
+		metrics.Notifications.WithLabelValues(channel, "skipped").Inc()
+		logEntry.WithField("event", "notification_skipped").Debug("No recipient for notification")
+	case errors.Is(err, errBudgetExhausted):
+		metrics.Notifications.WithLabelValues(channel, "over_budget").Inc()
+		logEntry.WithField("event", "notification_over_budget").Warn("Campaign notification budget exhausted")
+	case err != nil:
+		metrics.Notifications.WithLabelValues(channel, "failed").Inc()
+		logEntry = logEntry.WithError(err).WithField("event", "notification_failed")
+		logEntry.Error("Notification delivery failed")
+		storeFailed(logEntry, channel, notification, err)
+	default:
+		metrics.Notifications.WithLabelValues(channel, "sent").Inc()
+		logEntry.WithField("event", "notification_sent").Info("Notification sent")
+	}
+}
+
+// storeFailed keeps an undeliverable notification in Redis so it can be replayed
+func storeFailed(logEntry *logrus.Entry, channel string, notification Notification, cause error) {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"channel":      channel,
+		"notification": notification,
+		"error":        cause.Error(),
+		"failed_at":    time.Now().UTC(),
+	})
+	if err := redisClient.RPush(context.Background(), notificationsFailedKey, payload).Err(); err != nil {
+		logEntry.WithError(err).WithField("payload", string(payload)).Error("Failed to store undelivered notification")
+	}
+}
+
+// LogSender writes notifications to the log, so results are visible before a channel is set up
+type LogSender struct{}
+
+func (LogSender) Channel() string { return ChannelLog }
+
+func (LogSender) Send(_ context.Context, notification Notification) error {
+	logger.WithFields(map[string]interface{}{
+		"event":           "notification",
+		"notification_id": notification.NotificationID,
+		"request_id":      notification.RequestID,
+		"user_id":         notification.UserID,
+		"status":          notification.Status,
+		"reason":          notification.Reason,
+	}).Info("Order notification")
+	return nil
+}
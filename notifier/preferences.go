@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"slices"
+
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// preferences is a user's notification preferences (set through the gateway); nil means none
+// were stored and the default channels apply
+type preferences struct {
+	*common.NotificationPreferences
+}
+
+// preferenceStore is nil unless ORDER_STORE_DSN is set; every user then gets the defaults
+var preferenceStore *common.NotificationPreferencesStore
+
+// loadPreferences reads userID's notification preferences
+func loadPreferences(ctx context.Context, userID string) (preferences, error) {
+	if userID == "" || preferenceStore == nil {
+		return preferences{}, nil
+	}
+	stored, err := preferenceStore.Load(ctx, userID)
+	return preferences{stored}, err
+}
+
+// Allows reports whether a status notification may go out on channel
+// The log channel is always allowed; it's an operator view, not a customer message
+func (p preferences) Allows(channel, status string) bool {
+	if channel == ChannelLog {
+		return true
+	}
+	if p.NotificationPreferences == nil {
+		return !optInChannels[channel]
+	}
+	return slices.Contains(p.Channels, channel) && !slices.Contains(p.OptOut, status)
+}
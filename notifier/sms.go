@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// userPhoneKey holds a user's phone number (E.164), written by the account system
+func userPhoneKey(userID string) string {
+	return "user_phone:" + userID
+}
+
+// smsSpendKey holds the SMS spend of a campaign (item) in micro-units; it has no TTL, so
+// deleting it resets the budget
+func smsSpendKey(campaign string) string {
+	return "sms_spend:" + campaign
+}
+
+// smsStatuses are the confirmations worth a text message; other results go to the other channels
+var smsStatuses = map[string]bool{
+	common.ResultCompleted: true,
+	common.ResultDelivered: true,
+}
+
+// errBudgetExhausted means the campaign has spent its SMS budget
+var errBudgetExhausted = errors.New("sms budget exhausted")
+
+// SMSSender texts high-value order confirmations through a Twilio-compatible Messages API
+// SMS is opt-in: users only get it with "sms" in their channel preferences
+type SMSSender struct {
+	url         string // .../2010-04-01/Accounts/{sid}/Messages.json
+	accountSID  string
+	authToken   string
+	from        string // Sender number or messaging service SID (MG...)
+	client      *http.Client
+	items       map[string]bool // High-value items; empty means every item
+	minQuantity int64
+	budget      *smsBudget
+	retries     int
+	backoff     time.Duration
+}
+
+// SMSConfig configures an SMSSender
+type SMSConfig struct {
+	BaseURL     string // Default: https://api.twilio.com
+	AccountSID  string
+	AuthToken   string
+	From        string
+	Items       []string // Items whose confirmations are texted; empty means all
+	MinQuantity int64    // Smallest order quantity that is texted
+	Cost        float64  // Price of one message; 0 disables budgets
+	Budget      float64  // Default budget per campaign; 0 is unlimited
+	Budgets     map[string]float64
+	Retries     int
+}
+
+// NewSMSSender creates a sender from cfg
+func NewSMSSender(cfg SMSConfig, client *http.Client) (*SMSSender, error) {
+	if cfg.AccountSID == "" || cfg.AuthToken == "" {
+		return nil, errors.New("NOTIFIER_SMS_ACCOUNT_SID and NOTIFIER_SMS_AUTH_TOKEN are required")
+	}
+	if cfg.From == "" {
+		return nil, errors.New("NOTIFIER_SMS_FROM is required")
+	}
+	if cfg.Cost < 0 || cfg.Budget < 0 {
+		return nil, errors.New("SMS cost and budget must not be negative")
+	}
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.twilio.com"
+	}
+	if _, err := url.Parse(baseURL); err != nil {
+		return nil, fmt.Errorf("invalid NOTIFIER_SMS_URL: %w", err)
+	}
+	s := &SMSSender{
+		url:         strings.TrimSuffix(baseURL, "/") + "/2010-04-01/Accounts/" + url.PathEscape(cfg.AccountSID) + "/Messages.json",
+		accountSID:  cfg.AccountSID,
+		authToken:   cfg.AuthToken,
+		from:        cfg.From,
+		client:      client,
+		items:       make(map[string]bool, len(cfg.Items)),
+		minQuantity: cfg.MinQuantity,
+		retries:     cfg.Retries,
+		backoff:     500 * time.Millisecond,
+	}
+	for _, itemID := range cfg.Items {
+		s.items[itemID] = true
+	}
+	if cfg.Cost > 0 {
+		s.budget = newSMSBudget(cfg.Cost, cfg.Budget, cfg.Budgets)
+	}
+	return s, nil
+}
+
+func (s *SMSSender) Channel() string { return ChannelSMS }
+
+// Accepts limits SMS to confirmations of high-value orders
+func (s *SMSSender) Accepts(notification Notification) bool {
+	if !smsStatuses[notification.Status] {
+		return false
+	}
+	if len(s.items) > 0 && !s.items[notification.ItemID] {
+		return false
+	}
+	return notification.Quantity >= s.minQuantity
+}
+
+func (s *SMSSender) Send(ctx context.Context, notification Notification) error {
+	to, err := s.recipient(ctx, notification.UserID)
+	if err != nil {
+		return err
+	}
+	// The campaign is charged before sending and refunded if the message isn't accepted
+	if err := s.budget.Reserve(ctx, notification.ItemID); err != nil {
+		return err
+	}
+	err = s.send(ctx, to, smsBody(notification))
+	if err != nil {
+		s.budget.Refund(notification.ItemID)
+		return err
+	}
+	s.budget.Record()
+	return nil
+}
+
+func (s *SMSSender) send(ctx context.Context, to, body string) error {
+	form := url.Values{"To": {to}, "Body": {body}}
+	if strings.HasPrefix(s.from, "MG") {
+		form.Set("MessagingServiceSid", s.from)
+	} else {
+		form.Set("From", s.from)
+	}
+
+	backoff := s.backoff
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, strings.NewReader(form.Encode()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(s.accountSID, s.authToken)
+		err = doProviderRequest(s.client, req, ChannelSMS)
+		if err == nil {
+			return nil
+		}
+		if permanent, ok := err.(permanentError); ok {
+			return permanent.err
+		}
+		if attempt >= s.retries {
+			return err
+		}
+		metrics.Notifications.WithLabelValues(ChannelSMS, "retried").Inc()
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// recipient looks up the user's phone number; errNoRecipient if there is none
+func (s *SMSSender) recipient(ctx context.Context, userID string) (string, error) {
+	if userID == "" {
+		return "", errNoRecipient
+	}
+	to, err := redisClient.Get(ctx, userPhoneKey(userID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", errNoRecipient
+	}
+	if err != nil {
+		return "", err
+	}
+	if to = strings.TrimSpace(to); to == "" {
+		return "", errNoRecipient
+	}
+	return to, nil
+}
+
+// smsBody is the text of a confirmation; kept short to fit one segment where possible
+func smsBody(notification Notification) string {
+	if notification.Status == common.ResultDelivered && notification.DeliveryCode != "" {
+		return "Your code for order " + notification.RequestID + ": " + notification.DeliveryCode
+	}
+	return "Your order " + notification.RequestID + " is confirmed."
+}
+
+// luaReserveSMSBudget adds the message cost to a campaign's spend unless that exceeds the budget
+// KEYS[1]: spend key, ARGV[1]: cost, ARGV[2]: budget (micro-units)
+const luaReserveSMSBudget = `
+local spent = tonumber(redis.call('GET', KEYS[1]) or '0')
+if spent + tonumber(ARGV[1]) > tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('INCRBY', KEYS[1], ARGV[1])
+return 1
+`
+
+var reserveSMSBudgetScript = redis.NewScript(luaReserveSMSBudget)
+
+// smsBudget caps the SMS spend of each campaign across notifier instances
+// Amounts are kept in micro-units so Redis can add them exactly
+type smsBudget struct {
+	cost          int64
+	defaultBudget int64 // 0 is unlimited
+	budgets       map[string]int64
+}
+
+func newSMSBudget(cost, defaultBudget float64, budgets map[string]float64) *smsBudget {
+	b := &smsBudget{
+		cost:          toMicros(cost),
+		defaultBudget: toMicros(defaultBudget),
+		budgets:       make(map[string]int64, len(budgets)),
+	}
+	for campaign, budget := range budgets {
+		b.budgets[campaign] = toMicros(budget)
+	}
+	return b
+}
+
+func toMicros(amount float64) int64 {
+	return int64(math.Round(amount * 1e6))
+}
+
+// limit returns campaign's budget; 0 is unlimited
+func (b *smsBudget) limit(campaign string) int64 {
+	if budget, ok := b.budgets[campaign]; ok {
+		return budget
+	}
+	return b.defaultBudget
+}
+
+// Reserve charges one message to campaign; errBudgetExhausted if it doesn't fit
+// A nil budget and campaigns without a budget are unlimited
+func (b *smsBudget) Reserve(ctx context.Context, campaign string) error {
+	if b == nil {
+		return nil
+	}
+	budget := b.limit(campaign)
+	if budget == 0 {
+		return nil
+	}
+	allowed, err := reserveSMSBudgetScript.Run(ctx, redisClient, []string{smsSpendKey(campaign)}, b.cost, budget).Int()
+	if err != nil {
+		return err
+	}
+	if allowed == 0 {
+		return errBudgetExhausted
+	}
+	return nil
+}
+
+// Refund returns the cost of a message that wasn't sent
+func (b *smsBudget) Refund(campaign string) {
+	if b == nil || b.limit(campaign) == 0 {
+		return
+	}
+	if err := redisClient.DecrBy(context.Background(), smsSpendKey(campaign), b.cost).Err(); err != nil {
+		logger.WithError(err).WithField("campaign", campaign).Warn("Failed to refund SMS budget")
+	}
+}
+
+// Record counts the cost of a sent message
+func (b *smsBudget) Record() {
+	if b == nil {
+		return
+	}
+	metrics.SMSSpend.Add(float64(b.cost) / 1e6)
+}
+
+// parseSMSBudgets parses NOTIFIER_SMS_CAMPAIGN_BUDGETS: comma-separated item_id:budget pairs
+func parseSMSBudgets(value string) (map[string]float64, error) {
+	budgets := make(map[string]float64)
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		campaign, amount, ok := strings.Cut(pair, ":")
+		budget, err := strconv.ParseFloat(strings.TrimSpace(amount), 64)
+		if !ok || campaign == "" || err != nil || budget < 0 {
+			return nil, fmt.Errorf("invalid campaign budget %q, expected item_id:budget", pair)
+		}
+		budgets[strings.TrimSpace(campaign)] = budget
+	}
+	return budgets, nil
+}
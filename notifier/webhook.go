@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WebhookSender POSTs notifications as JSON to NOTIFIER_WEBHOOK_URL
+// Failures and 5xx/429 responses are retried with exponential backoff starting at 500ms
+type WebhookSender struct {
+	url     string
+	client  *http.Client
+	retries int
+	backoff time.Duration
+}
+
+// NewWebhookSender creates a sender retrying each notification retries times after the first attempt
+func NewWebhookSender(url string, client *http.Client, retries int) *WebhookSender {
+	return &WebhookSender{
+		url:     url,
+		client:  client,
+		retries: retries,
+		backoff: 500 * time.Millisecond,
+	}
+}
+
+func (s *WebhookSender) Channel() string { return ChannelWebhook }
+
+func (s *WebhookSender) Send(ctx context.Context, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	backoff := s.backoff
+	for attempt := 0; ; attempt++ {
+		err = s.post(ctx, body, notification.NotificationID)
+		if err == nil || attempt >= s.retries {
+			return err
+		}
+		if permanent, ok := err.(permanentError); ok {
+			return permanent.err
+		}
+		metrics.Notifications.WithLabelValues(ChannelWebhook, "retried").Inc()
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// permanentError marks webhook responses that retrying can't fix (4xx other than 429)
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+
+func (s *WebhookSender) post(ctx context.Context, body []byte, notificationID string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", notificationID)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("notification webhook returned %s", resp.Status)
+	default:
+		return permanentError{fmt.Errorf("notification webhook rejected notification: %s", resp.Status)}
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// registerAdminAPI adds the admin endpoints to the processor's HTTP server (:9090)
+// Every endpoint requires a bearer token issued with ADMIN_TOKEN_SECRET (see -issue-admin-token)
+//   - viewer: GET /admin/inventory?item_id=, GET /admin/dlq, GET /admin/control, GET /admin/audit,
+//     GET /admin/gifts?user_id=&direction=, GET /admin/digital-codes?item_id= (looking up an order's code with request_id needs operator)
+//   - viewer: GET /admin/dlq/replay (last replay and failure classes)
+//   - operator: POST /admin/control (pause/resume items, drain, reload scripts), POST /admin/dlq/reset,
+//     POST /admin/selftest (synthetic end-to-end order), POST /admin/dlq/replay (republish or quarantine DLQ orders)
+//   - admin: POST /admin/inventory (set stock), POST /admin/inventory/restock (add stock), POST /admin/control with cutover_inventory
+//   - with RATE_LIMIT_EXEMPTION_SECRET: GET /admin/rate-limit-exemptions (viewer), POST /admin/rate-limit-exemptions and
+//     DELETE /admin/rate-limit-exemptions/{id} (admin)
+//   - with DELIVERY_AUDIT_ENABLED: GET /admin/delivery-audit (viewer, orders that never reached a terminal status)
+func registerAdminAPI(mux *http.ServeMux, auth *common.AdminAuth) {
+	mux.HandleFunc("GET /admin/inventory", auth.Require(common.RoleViewer, handleAdminGetInventory))
+	mux.HandleFunc("POST /admin/inventory", auth.Require(common.RoleAdmin, handleAdminSetInventory))
+	mux.HandleFunc("POST /admin/inventory/restock", auth.Require(common.RoleAdmin, handleAdminRestock))
+	mux.HandleFunc("GET /admin/dlq", auth.Require(common.RoleViewer, handleAdminGetDLQ))
+	mux.HandleFunc("POST /admin/dlq/reset", auth.Require(common.RoleOperator, handleAdminResetDLQ))
+	mux.HandleFunc("GET /admin/dlq/replay", auth.Require(common.RoleViewer, handleAdminGetDLQReplay))
+	mux.HandleFunc("POST /admin/dlq/replay", auth.Require(common.RoleOperator, handleAdminReplayDLQ))
+	mux.HandleFunc("GET /admin/control", auth.Require(common.RoleViewer, handleAdminGetControl))
+	mux.HandleFunc("POST /admin/control", auth.Require(common.RoleOperator, handleAdminControl))
+	mux.HandleFunc("GET /admin/audit", auth.Require(common.RoleViewer, handleAdminGetAudit))
+	mux.HandleFunc("GET /admin/gifts", auth.Require(common.RoleViewer, handleAdminGetGifts))
+	mux.HandleFunc("GET /admin/digital-codes", auth.Require(common.RoleViewer, handleAdminGetDigitalCodes))
+	mux.HandleFunc("POST /admin/selftest", auth.Require(common.RoleOperator, handleAdminSelftest))
+	mux.HandleFunc("GET /admin/config", auth.Require(common.RoleViewer, common.ConfigHandler(startupConfig)))
+	mux.HandleFunc("GET /admin/campaigns/metrics", auth.Require(common.RoleViewer, metrics.Orders.Campaigns.SummaryHandler()))
+	if orderStore != nil {
+		mux.HandleFunc("GET /admin/orders", auth.Require(common.RoleViewer, handleAdminSearchOrders))
+	}
+	if rateLimitExemptions != nil {
+		mux.HandleFunc("GET /admin/rate-limit-exemptions", auth.Require(common.RoleViewer, handleAdminListExemptions))
+		mux.HandleFunc("POST /admin/rate-limit-exemptions", auth.Require(common.RoleAdmin, handleAdminIssueExemption))
+		mux.HandleFunc("DELETE /admin/rate-limit-exemptions/{id}", auth.Require(common.RoleAdmin, handleAdminRevokeExemption))
+	}
+	if deliveryAuditor != nil {
+		mux.HandleFunc("GET /admin/delivery-audit", auth.Require(common.RoleViewer, handleAdminGetDeliveryAudit))
+	}
+	if campaignTopics != nil {
+		mux.HandleFunc("GET /admin/campaigns", auth.Require(common.RoleViewer, handleAdminListCampaigns))
+		mux.HandleFunc("POST /admin/campaigns", auth.Require(common.RoleAdmin, handleAdminCreateCampaign))
+		mux.HandleFunc("DELETE /admin/campaigns/{campaign}", auth.Require(common.RoleAdmin, handleAdminEndCampaign))
+	}
+}
+
+// Every mutation below is recorded with recordAdminAction (see admin_audit.go)
+
+// adminLog returns a log entry for an admin request carrying the caller's identity
+func adminLog(r *http.Request, event string) *logrus.Entry {
+	claims := common.AdminClaimsFromContext(r.Context())
+	return logger.WithFields(map[string]interface{}{
+		"event": event,
+		"actor": claims.Subject,
+		"role":  claims.Role,
+	})
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func handleAdminGetInventory(w http.ResponseWriter, r *http.Request) {
+	itemID := r.URL.Query().Get("item_id")
+	if itemID == "" {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "item_id is required"})
+		return
+	}
+	projection, exists, err := inventory.Projection(r.Context(), itemID)
+	if err != nil {
+		adminLog(r, "admin_inventory_read").WithError(err).Error("Failed to read inventory")
+		writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read inventory"})
+		return
+	}
+	if exists {
+		recordInventoryProjection(itemID, projection)
+	}
+	// reserved units are held by unpaid orders: available 0 with units reserved is hold
+	// exhaustion, not a sell-out, since failed payments return them
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{
+		"item_id":     itemID,
+		"stock":       projection.Available,
+		"initialized": exists,
+		"total":       projection.Total(),
+		"available":   projection.Available,
+		"reserved":    projection.Reserved,
+		"sold":        projection.Sold,
+	})
+}
+
+func handleAdminSetInventory(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ItemID string `json:"item_id"`
+		Stock  int64  `json:"stock"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ItemID == "" || req.Stock < 0 {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "body must be {\"item_id\": string, \"stock\": non-negative integer}"})
+		return
+	}
+	logEntry := adminLog(r, "admin_inventory_set").WithFields(map[string]interface{}{
+		"item_id": req.ItemID,
+		"stock":   req.Stock,
+	})
+	previous, initialized, err := inventory.Stock(r.Context(), req.ItemID)
+	if err != nil {
+		logEntry.WithError(err).Error("Failed to read inventory")
+		writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read inventory"})
+		return
+	}
+	if _, err := inventory.Restock(r.Context(), req.ItemID, req.Stock, false); err != nil {
+		logEntry.WithError(err).Error("Failed to set inventory")
+		writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to set inventory"})
+		return
+	}
+	publishInventoryState(logEntry, req.ItemID, req.Stock)
+	refreshInventoryProjection(logEntry, req.ItemID)
+	var before interface{}
+	if initialized {
+		before = map[string]int64{"stock": previous}
+	}
+	recordAdminAction(r, "set_inventory", req.ItemID, before, map[string]int64{"stock": req.Stock})
+	logEntry.Info("Inventory set by admin")
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{"item_id": req.ItemID, "stock": req.Stock})
+}
+
+// handleAdminRestock adds units to an item in one step: the stock is incremented atomically, the
+// inventory state (sold_out flag) is republished, the units are offered to the item's waitlist and
+// a restock event is published to the order-results topic
+// The gateway has no sold-out gate, so re-opening admission means clearing sold_out and handing
+// waitlisted users purchase tokens; the projector counts the event in the item's sales summary
+func handleAdminRestock(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ItemID string `json:"item_id"`
+		Units  int64  `json:"units"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ItemID == "" || req.Units <= 0 {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "body must be {\"item_id\": string, \"units\": positive integer}"})
+		return
+	}
+	logEntry := adminLog(r, "admin_inventory_restock").WithFields(map[string]interface{}{
+		"item_id": req.ItemID,
+		"units":   req.Units,
+	})
+	before, after, ok, err := inventory.AddStock(r.Context(), req.ItemID, req.Units)
+	if err != nil {
+		logEntry.WithError(err).Error("Failed to restock inventory")
+		writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to restock inventory"})
+		return
+	}
+	if !ok {
+		writeAdminJSON(w, http.StatusNotFound, map[string]string{"error": "item has no stock level; set it with POST /admin/inventory"})
+		return
+	}
+	recordAdminAction(r, "restock_inventory", req.ItemID, map[string]int64{"stock": before}, map[string]int64{"stock": after})
+	logEntry = logEntry.WithFields(map[string]interface{}{
+		"stock_before": before,
+		"stock_after":  after,
+	})
+
+	// The stock change is committed; the notifications below are best effort
+	publishInventoryState(logEntry, req.ItemID, after)
+	refreshInventoryProjection(logEntry, req.ItemID)
+	if err := common.NotifyRestock(r.Context(), redisClient, req.ItemID, req.Units); err != nil {
+		logEntry.WithError(err).Warn("Failed to notify waitlist of restocked units")
+	}
+	msg, err := common.NewRestockMessage(common.RestockEvent{
+		ItemID:      req.ItemID,
+		Units:       req.Units,
+		StockBefore: before,
+		StockAfter:  after,
+		Actor:       common.AdminClaimsFromContext(r.Context()).Subject,
+	})
+	if err == nil {
+		_, _, err = producer.SendMessage(msg)
+	}
+	if err != nil {
+		logEntry.WithError(err).Warn("Failed to publish restock event")
+	}
+
+	logEntry.Info("Inventory restocked by admin")
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{
+		"item_id":      req.ItemID,
+		"units":        req.Units,
+		"stock_before": before,
+		"stock":        after,
+	})
+}
+
+func handleAdminGetDLQ(w http.ResponseWriter, r *http.Request) {
+	total, byReason, sinceLast, lastFailure := GetDLQMetrics()
+	body := map[string]interface{}{
+		"total_failures":             total,
+		"failures_by_reason":         byReason,
+		"seconds_since_last_failure": int64(sinceLast.Seconds()),
+	}
+	if !lastFailure.IsZero() {
+		body["last_failure"] = lastFailure.UTC()
+	}
+	writeAdminJSON(w, http.StatusOK, body)
+}
+
+func handleAdminResetDLQ(w http.ResponseWriter, r *http.Request) {
+	total, byReason, _, _ := GetDLQMetrics()
+	ResetDLQMetrics()
+	recordAdminAction(r, "reset_dlq_counters", "",
+		map[string]interface{}{"total_failures": total, "failures_by_reason": byReason},
+		map[string]interface{}{"total_failures": 0})
+	adminLog(r, "admin_dlq_reset").Info("DLQ counters reset by admin")
+	writeAdminJSON(w, http.StatusOK, map[string]string{"status": "reset"})
+}
+
+func handleAdminGetControl(w http.ResponseWriter, r *http.Request) {
+	paused, err := redisClient.SMembers(r.Context(), pausedItemsKey).Result()
+	if err != nil {
+		adminLog(r, "admin_control_read").WithError(err).Error("Failed to read paused items")
+		writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read paused items"})
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{
+		"control_enabled": control != nil,
+		"paused_items":    paused,
+	})
+}
+
+// handleAdminControl publishes a control command to every processor instance
+func handleAdminControl(w http.ResponseWriter, r *http.Request) {
+	if control == nil {
+		writeAdminJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "runtime control is disabled (PROCESSOR_CONTROL_ENABLED)"})
+		return
+	}
+	var cmd ControlCommand
+	if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid control command"})
+		return
+	}
+	switch cmd.Command {
+	case CommandPauseItem, CommandResumeItem, CommandCutoverInventory:
+		if cmd.ItemID == "" {
+			writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "item_id is required"})
+			return
+		}
+	case CommandDrain, CommandResume, CommandReloadScripts:
+	default:
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "unknown command"})
+		return
+	}
+	// Cutover changes which stock is sold, so it needs the same role as setting stock
+	if cmd.Command == CommandCutoverInventory && !common.AdminClaimsFromContext(r.Context()).Allows(common.RoleAdmin) {
+		writeAdminJSON(w, http.StatusForbidden, map[string]string{"error": "role admin required"})
+		return
+	}
+
+	logEntry := adminLog(r, "admin_control").WithFields(map[string]interface{}{
+		"command": cmd.Command,
+		"item_id": cmd.ItemID,
+		"version": cmd.Version,
+	})
+
+	// Before/after describe the requested change; processors apply the command asynchronously
+	var before, after interface{}
+	switch cmd.Command {
+	case CommandPauseItem, CommandResumeItem:
+		paused, err := redisClient.SIsMember(r.Context(), pausedItemsKey, cmd.ItemID).Result()
+		if err != nil {
+			logEntry.WithError(err).Error("Failed to read paused items")
+			writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read paused items"})
+			return
+		}
+		before = map[string]bool{"paused": paused}
+		after = map[string]bool{"paused": cmd.Command == CommandPauseItem}
+	case CommandCutoverInventory:
+		version, err := redisClient.Get(r.Context(), common.InventoryVersionKey(cmd.ItemID)).Int64()
+		if err != nil && err != redis.Nil {
+			logEntry.WithError(err).Error("Failed to read inventory version")
+			writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read inventory version"})
+			return
+		}
+		before = map[string]int64{"version": version}
+		after = map[string]int64{"version": cmd.Version}
+	}
+
+	payload, _ := json.Marshal(cmd)
+	if err := redisClient.Publish(r.Context(), control.channel, payload).Err(); err != nil {
+		logEntry.WithError(err).Error("Failed to publish control command")
+		writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to publish control command"})
+		return
+	}
+	recordAdminAction(r, cmd.Command, cmd.ItemID, before, after)
+	logEntry.Info("Control command published by admin")
+	writeAdminJSON(w, http.StatusAccepted, map[string]string{"status": "published"})
+}
+
+// handleAdminGetDigitalCodes reports an item's code pool, and with request_id the code assigned
+// to that order (support lookups; codes are secrets, so this needs operator)
+func handleAdminGetDigitalCodes(w http.ResponseWriter, r *http.Request) {
+	itemID := r.URL.Query().Get("item_id")
+	if itemID == "" {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "item_id is required"})
+		return
+	}
+	status, err := digitalCodeStatus(r.Context(), itemID)
+	if err != nil {
+		adminLog(r, "admin_digital_codes_read").WithError(err).Error("Failed to read digital code pool")
+		writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read digital code pool"})
+		return
+	}
+	body := map[string]interface{}{"item_id": itemID, "codes": status}
+
+	if requestID := r.URL.Query().Get("request_id"); requestID != "" {
+		if !common.AdminClaimsFromContext(r.Context()).Allows(common.RoleOperator) {
+			writeAdminJSON(w, http.StatusForbidden, map[string]string{"error": "role operator required"})
+			return
+		}
+		code, err := redisClient.HGet(r.Context(), digitalCodeAssignmentsKey(itemID), requestID).Result()
+		if err != nil && err != redis.Nil {
+			adminLog(r, "admin_digital_codes_read").WithError(err).Error("Failed to read digital code assignment")
+			writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read digital code assignment"})
+			return
+		}
+		adminLog(r, "admin_digital_code_lookup").WithFields(map[string]interface{}{
+			"item_id":    itemID,
+			"request_id": requestID,
+		}).Info("Digital code looked up by admin")
+		body["request_id"] = requestID
+		body["code"] = code
+	}
+	writeAdminJSON(w, http.StatusOK, body)
+}
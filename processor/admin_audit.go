@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// adminAuditStream is the append-only Redis stream of admin mutations
+const adminAuditStream = "admin:audit"
+
+// adminAuditMaxEntries caps the audit stream (ADMIN_AUDIT_MAX_ENTRIES); 0 keeps every entry
+var adminAuditMaxEntries int64
+
+// AdminAuditEntry records one admin mutation
+type AdminAuditEntry struct {
+	ID        string          `json:"id"` // Stream entry ID, usable as the "before" cursor when paging
+	Timestamp time.Time       `json:"timestamp"`
+	Actor     string          `json:"actor"`
+	Role      string          `json:"role"`
+	Action    string          `json:"action"`
+	ItemID    string          `json:"item_id,omitempty"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+}
+
+// recordAdminAction appends a mutation made by the caller of r to the audit stream
+// The mutation has already been applied, so a failed write is logged with the full entry
+// rather than failing the request
+func recordAdminAction(r *http.Request, action, itemID string, before, after interface{}) {
+	claims := common.AdminClaimsFromContext(r.Context())
+	beforeJSON, _ := json.Marshal(before)
+	afterJSON, _ := json.Marshal(after)
+	values := map[string]interface{}{
+		"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+		"actor":     claims.Subject,
+		"role":      claims.Role,
+		"action":    action,
+		"item_id":   itemID,
+		"before":    string(beforeJSON),
+		"after":     string(afterJSON),
+	}
+
+	args := &redis.XAddArgs{Stream: adminAuditStream, Values: values}
+	if adminAuditMaxEntries > 0 {
+		args.MaxLen = adminAuditMaxEntries
+		args.Approx = true
+	}
+	if err := redisClient.XAdd(r.Context(), args).Err(); err != nil {
+		logger.WithError(err).WithFields(values).WithField("event", "admin_audit_failed").Error("Failed to record admin action")
+	}
+}
+
+// handleAdminGetAudit returns audit entries, newest first
+// Query parameters: count (default 100, max 1000), before (stream ID cursor from a previous page),
+// item_id and actor filter the returned page
+func handleAdminGetAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	count := int64(100)
+	if value := query.Get("count"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 1 || parsed > 1000 {
+			writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "count must be between 1 and 1000"})
+			return
+		}
+		count = parsed
+	}
+	end := "+"
+	if before := query.Get("before"); before != "" {
+		end = "(" + before // Exclusive range
+	}
+
+	messages, err := redisClient.XRevRangeN(r.Context(), adminAuditStream, end, "-", count).Result()
+	if err != nil {
+		adminLog(r, "admin_audit_read").WithError(err).Error("Failed to read admin audit stream")
+		writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read audit log"})
+		return
+	}
+
+	entries := make([]AdminAuditEntry, 0, len(messages))
+	for _, message := range messages {
+		entry := adminAuditEntryFromMessage(message)
+		if (query.Get("item_id") != "" && entry.ItemID != query.Get("item_id")) ||
+			(query.Get("actor") != "" && entry.Actor != query.Get("actor")) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	body := map[string]interface{}{"entries": entries}
+	if len(messages) == int(count) {
+		body["next_before"] = messages[len(messages)-1].ID
+	}
+	writeAdminJSON(w, http.StatusOK, body)
+}
+
+func adminAuditEntryFromMessage(message redis.XMessage) AdminAuditEntry {
+	field := func(name string) string {
+		value, _ := message.Values[name].(string)
+		return value
+	}
+	entry := AdminAuditEntry{
+		ID:     message.ID,
+		Actor:  field("actor"),
+		Role:   field("role"),
+		Action: field("action"),
+		ItemID: field("item_id"),
+	}
+	entry.Timestamp, _ = time.Parse(time.RFC3339Nano, field("timestamp"))
+	if before := field("before"); before != "" && before != "null" {
+		entry.Before = json.RawMessage(before)
+	}
+	if after := field("after"); after != "" && after != "null" {
+		entry.After = json.RawMessage(after)
+	}
+	return entry
+}
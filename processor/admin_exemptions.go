@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// rateLimitExemptions issues and revokes the gateway's rate limit exemption tokens
+// nil unless RATE_LIMIT_EXEMPTION_SECRET is set (the same secret as on the gateways)
+var rateLimitExemptions *common.RateLimitExemptions
+
+// maxExemptionTTL bounds how long an exemption token stays valid
+const maxExemptionTTL = 90 * 24 * time.Hour
+
+// handleAdminListExemptions returns the unexpired exemptions, revoked ones included; tokens are never returned again
+func handleAdminListExemptions(w http.ResponseWriter, r *http.Request) {
+	exemptions, err := rateLimitExemptions.List(r.Context(), time.Now())
+	if err != nil {
+		adminLog(r, "admin_exemptions_read").WithError(err).Error("Failed to read rate limit exemptions")
+		writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read rate limit exemptions"})
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{"exemptions": exemptions})
+}
+
+// handleAdminIssueExemption issues a token for trusted automation (load tests, retail partners)
+// Body: {"name": "...", "quota": requests per RATE_LIMIT_WINDOW (0 unlimited), "ttl": "24h"}
+func handleAdminIssueExemption(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name  string `json:"name"`
+		Quota int64  `json:"quota"`
+		TTL   string `json:"ttl"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" || req.Quota < 0 {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "body must be {\"name\": string, \"quota\": non-negative integer, \"ttl\": duration}"})
+		return
+	}
+	ttl := 24 * time.Hour
+	if req.TTL != "" {
+		parsed, err := time.ParseDuration(req.TTL)
+		if err != nil || parsed <= 0 || parsed > maxExemptionTTL {
+			writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "ttl must be a positive duration of at most 2160h"})
+			return
+		}
+		ttl = parsed
+	}
+	logEntry := adminLog(r, "admin_exemption_issue").WithFields(map[string]interface{}{
+		"name":  req.Name,
+		"quota": req.Quota,
+		"ttl":   ttl.String(),
+	})
+	claims := common.AdminClaimsFromContext(r.Context())
+	token, exemption, err := rateLimitExemptions.Issue(r.Context(), req.Name, req.Quota, ttl, claims.Subject, time.Now())
+	if err != nil {
+		logEntry.WithError(err).Error("Failed to issue rate limit exemption")
+		writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to issue rate limit exemption"})
+		return
+	}
+	recordAdminAction(r, "issue_rate_limit_exemption", "", nil, exemption)
+	logEntry.WithField("exemption_id", exemption.ID).Info("Rate limit exemption issued by admin")
+	writeAdminJSON(w, http.StatusCreated, map[string]interface{}{
+		"exemption": exemption,
+		"token":     token,
+		"header":    common.RateLimitExemptionHeader,
+	})
+}
+
+// handleAdminRevokeExemption revokes an exemption on every gateway at once
+func handleAdminRevokeExemption(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	logEntry := adminLog(r, "admin_exemption_revoke").WithField("exemption_id", id)
+	exemption, found, err := rateLimitExemptions.Revoke(r.Context(), id, time.Now())
+	if err != nil {
+		logEntry.WithError(err).Error("Failed to revoke rate limit exemption")
+		writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to revoke rate limit exemption"})
+		return
+	}
+	if !found {
+		writeAdminJSON(w, http.StatusNotFound, map[string]string{"error": "no such exemption"})
+		return
+	}
+	recordAdminAction(r, "revoke_rate_limit_exemption", "", map[string]bool{"revoked": false}, map[string]bool{"revoked": true})
+	logEntry.WithField("name", exemption.Name).Info("Rate limit exemption revoked by admin")
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{"exemption": exemption})
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// Redis keys of campaign exports
+const (
+	campaignExportedKeyPrefix = "campaign_exported:"    // Manifest key of a completed export
+	campaignExportLockKey     = "campaign_export_lock:" // Held by the processor exporting a campaign
+)
+
+// campaignExportLockTTL is how long a failed or abandoned export blocks the next attempt
+const campaignExportLockTTL = 30 * time.Minute
+
+// Export datasets; each is partitioned by item
+const (
+	exportOrders = "orders" // Latest result of every order (order store)
+	exportDLQ    = "dlq"    // Orders moved to the DLQ with their failure reason
+)
+
+// exportPartRows bounds the rows per file so consumers can read parts in parallel
+const exportPartRows = 100000
+
+// exportOrderPageSize is the order store page read per query
+const exportOrderPageSize = 5000
+
+// ExportManifest describes a completed campaign export; it is written last, so a campaign
+// without one was not (fully) exported
+type ExportManifest struct {
+	Campaign   string       `json:"campaign"`
+	ItemIDs    []string     `json:"item_ids"`
+	From       time.Time    `json:"from"` // Campaign start
+	To         time.Time    `json:"to"`   // Campaign end plus the export delay
+	ExportedAt time.Time    `json:"exported_at"`
+	Format     string       `json:"format"`
+	Files      []ExportFile `json:"files"`
+}
+
+// ExportFile is one part of a dataset partition
+type ExportFile struct {
+	Key     string `json:"key"`
+	Dataset string `json:"dataset"`
+	ItemID  string `json:"item_id"`
+	Rows    int    `json:"rows"`
+	Bytes   int    `json:"bytes"`
+	SHA256  string `json:"sha256"`
+}
+
+// DLQExportRecord is an order from the DLQ, without its shipping address and metadata
+type DLQExportRecord struct {
+	RequestID     string    `json:"request_id,omitempty"`
+	UserID        string    `json:"user_id,omitempty"`
+	ItemID        string    `json:"item_id"`
+	Quantity      int64     `json:"quantity"`
+	Channel       string    `json:"channel,omitempty"`
+	Error         string    `json:"error"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	FailedAt      time.Time `json:"failed_at"`
+	Partition     int32     `json:"partition"`
+	Offset        int64     `json:"offset"`
+}
+
+// CampaignExporter writes an ended campaign's orders and DLQ entries to object storage for
+// analysis without database access
+// Files are gzipped NDJSON laid out Hive-style, so Athena, BigQuery or Spark can read them as
+// one table per dataset: {prefix}campaign={name}/dataset={orders|dlq}/item_id={item}/part-NNNNN.ndjson.gz
+type CampaignExporter struct {
+	archive *ObjectArchive
+	prefix  string
+	orders  *OrderStore // nil: only the DLQ is exported
+	client  sarama.Client
+	delay   time.Duration // After the campaign end, for in-flight orders to settle
+}
+
+// NewCampaignExporter creates an exporter writing below prefix in archive; orders may be nil
+func NewCampaignExporter(archive *ObjectArchive, prefix string, orders *OrderStore, client sarama.Client, delay time.Duration) *CampaignExporter {
+	return &CampaignExporter{archive: archive, prefix: prefix, orders: orders, client: client, delay: delay}
+}
+
+// Due reports whether campaign has settled long enough to be exported at now
+func (e *CampaignExporter) Due(campaign common.CampaignTopic, now time.Time) bool {
+	return !now.Before(campaign.EndsAt.Add(e.delay))
+}
+
+// Exported reports whether campaign's export completed
+func (e *CampaignExporter) Exported(ctx context.Context, campaign common.CampaignTopic) bool {
+	exists, err := redisClient.Exists(ctx, campaignExportedKeyPrefix+campaign.Name).Result()
+	return err == nil && exists > 0
+}
+
+// ExportOnce exports campaign unless that was done or another processor is doing it
+func (e *CampaignExporter) ExportOnce(ctx context.Context, campaign common.CampaignTopic) {
+	if e.Exported(ctx, campaign) {
+		return
+	}
+	acquired, err := redisClient.SetNX(ctx, campaignExportLockKey+campaign.Name, 1, campaignExportLockTTL).Result()
+	if err != nil || !acquired {
+		return
+	}
+	logEntry := logger.WithField("campaign", campaign.Name)
+	start := time.Now()
+	manifestKey, manifest, err := e.Export(ctx, campaign)
+	if err != nil {
+		// The lock stays until it expires, spacing out retries
+		metrics.CampaignExports.WithLabelValues("failed").Inc()
+		logEntry.WithError(err).WithField("event", "campaign_export_failed").Error("Campaign export failed")
+		return
+	}
+	redisClient.Set(ctx, campaignExportedKeyPrefix+campaign.Name, manifestKey, 0)
+	redisClient.Del(ctx, campaignExportLockKey+campaign.Name)
+	metrics.CampaignExports.WithLabelValues("completed").Inc()
+	logEntry.WithFields(logrus.Fields{
+		"event":       "campaign_exported",
+		"manifest":    manifestKey,
+		"files":       len(manifest.Files),
+		"duration_ms": time.Since(start).Milliseconds(),
+	}).Info("Campaign exported")
+}
+
+// Export writes campaign's datasets and then its manifest; it returns the manifest's key
+func (e *CampaignExporter) Export(ctx context.Context, campaign common.CampaignTopic) (string, ExportManifest, error) {
+	base := e.prefix + "campaign=" + campaign.Name + "/"
+	manifest := ExportManifest{
+		Campaign: campaign.Name,
+		ItemIDs:  campaign.ItemIDs,
+		From:     campaign.CreatedAt,
+		To:       campaign.EndsAt.Add(e.delay),
+		Format:   "ndjson+gzip",
+	}
+	writer := &exportWriter{ctx: ctx, archive: e.archive, base: base, parts: make(map[string]*exportPart)}
+
+	if e.orders != nil {
+		for _, itemID := range campaign.ItemIDs {
+			if err := e.exportOrders(ctx, writer, itemID, manifest.From, manifest.To); err != nil {
+				return "", manifest, fmt.Errorf("orders of %s: %w", itemID, err)
+			}
+		}
+	}
+	if err := e.exportDLQ(ctx, writer, campaign.ItemIDs, manifest.From, manifest.To); err != nil {
+		return "", manifest, fmt.Errorf("dlq: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return "", manifest, err
+	}
+
+	manifest.Files = writer.files
+	sort.Slice(manifest.Files, func(i, j int) bool { return manifest.Files[i].Key < manifest.Files[j].Key })
+	manifest.ExportedAt = time.Now().UTC()
+	body, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", manifest, err
+	}
+	manifestKey := base + "manifest.json"
+	if err := e.archive.put(ctx, manifestKey, "application/json", body); err != nil {
+		return "", manifest, fmt.Errorf("manifest: %w", err)
+	}
+	return manifestKey, manifest, nil
+}
+
+// exportOrders pages through itemID's stored orders whose latest result falls in [from, to)
+func (e *CampaignExporter) exportOrders(ctx context.Context, writer *exportWriter, itemID string, from, to time.Time) error {
+	query := OrderQuery{ItemID: itemID, From: from, To: to, Ascending: true, Limit: exportOrderPageSize}
+	for {
+		orders, next, err := e.orders.Search(ctx, query)
+		if err != nil {
+			return err
+		}
+		for _, order := range orders {
+			if err := writer.Write(exportOrders, itemID, order); err != nil {
+				return err
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		query.Cursor = next
+	}
+}
+
+// exportDLQ reads the DLQ messages published in [from, to) and keeps those of items
+func (e *CampaignExporter) exportDLQ(ctx context.Context, writer *exportWriter, items []string, from, to time.Time) error {
+	wanted := make(map[string]bool, len(items))
+	for _, itemID := range items {
+		wanted[itemID] = true
+	}
+	ranges, err := replayRanges(e.client, ReplayOptions{Topic: common.TopicOrdersDLQ, From: from, To: to})
+	if err != nil {
+		return err
+	}
+	// A consumer of its own: the DLQ may already be read elsewhere in this process
+	consumer, err := sarama.NewConsumerFromClient(e.client)
+	if err != nil {
+		return err
+	}
+	defer consumer.Close()
+	unreadable := 0
+	for i := range ranges {
+		r := &ranges[i]
+		pc, err := consumer.ConsumePartition(common.TopicOrdersDLQ, r.Partition, r.From)
+		if err != nil {
+			return fmt.Errorf("partition %d: %w", r.Partition, err)
+		}
+		for msg := nextReplayMessage(ctx, pc, r); msg != nil; msg = nextReplayMessage(ctx, pc, r) {
+			record, ok := dlqExportRecord(msg)
+			if !ok {
+				unreadable++
+			} else if wanted[record.ItemID] {
+				if err := writer.Write(exportDLQ, record.ItemID, record); err != nil {
+					pc.Close()
+					return err
+				}
+			}
+		}
+		pc.Close()
+	}
+	if unreadable > 0 {
+		logger.WithFields(logrus.Fields{
+			"event":      "campaign_export_dlq_unreadable",
+			"unreadable": unreadable,
+		}).Warn("Skipped DLQ messages that could not be decoded")
+	}
+	return nil
+}
+
+// dlqExportRecord decodes a DLQ message; false if its payload can't be read (e.g. no key)
+func dlqExportRecord(msg *sarama.ConsumerMessage) (DLQExportRecord, bool) {
+	payload, err := decryptOrderPayload(msg)
+	if err != nil {
+		return DLQExportRecord{}, false
+	}
+	order, err := decodeOrder(msg, payload)
+	if err != nil || order.ItemID == "" {
+		return DLQExportRecord{}, false
+	}
+	record := DLQExportRecord{
+		RequestID: extractRequestID(msg.Headers),
+		UserID:    order.UserID,
+		ItemID:    order.ItemID,
+		Quantity:  order.Amount,
+		Channel:   order.Channel,
+		FailedAt:  msg.Timestamp.UTC(),
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+	}
+	if record.Quantity == 0 {
+		record.Quantity = 1
+	}
+	for _, header := range msg.Headers {
+		switch string(header.Key) {
+		case "error":
+			record.Error = string(header.Value)
+		case "correlation_id":
+			record.CorrelationID = string(header.Value)
+		}
+	}
+	return record, true
+}
+
+// exportWriter buffers rows per dataset partition and uploads a part every exportPartRows
+type exportWriter struct {
+	ctx     context.Context
+	archive *ObjectArchive
+	base    string
+	parts   map[string]*exportPart // By partition path
+	files   []ExportFile
+}
+
+// exportPart is the file being filled for one partition
+type exportPart struct {
+	dataset string
+	itemID  string
+	number  int
+	rows    int
+	buf     bytes.Buffer
+	gz      *gzip.Writer
+}
+
+// Write appends record to the dataset's partition for itemID
+func (w *exportWriter) Write(dataset, itemID string, record interface{}) error {
+	path := "dataset=" + dataset + "/item_id=" + itemID + "/"
+	part := w.parts[path]
+	if part == nil {
+		part = &exportPart{dataset: dataset, itemID: itemID}
+		part.gz = gzip.NewWriter(&part.buf)
+		w.parts[path] = part
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	part.gz.Write(append(line, '\n'))
+	part.rows++
+	if part.rows >= exportPartRows {
+		return w.upload(path, part)
+	}
+	return nil
+}
+
+// Close uploads every partially filled part
+func (w *exportWriter) Close() error {
+	paths := make([]string, 0, len(w.parts))
+	for path := range w.parts {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if part := w.parts[path]; part.rows > 0 {
+			if err := w.upload(path, part); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// upload writes part as the partition's next file and resets it
+func (w *exportWriter) upload(path string, part *exportPart) error {
+	if err := part.gz.Close(); err != nil {
+		return err
+	}
+	body := part.buf.Bytes()
+	key := fmt.Sprintf("%s%spart-%05d.ndjson.gz", w.base, path, part.number)
+	if err := w.archive.put(w.ctx, key, "application/gzip", body); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	sum := sha256.Sum256(body)
+	w.files = append(w.files, ExportFile{
+		Key:     key,
+		Dataset: part.dataset,
+		ItemID:  part.itemID,
+		Rows:    part.rows,
+		Bytes:   len(body),
+		SHA256:  hex.EncodeToString(sum[:]),
+	})
+	metrics.CampaignExportRows.WithLabelValues(part.dataset).Add(float64(part.rows))
+	part.number++
+	part.rows = 0
+	part.buf.Reset()
+	part.gz.Reset(&part.buf)
+	return nil
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// campaignTopicCleanupLockKey is held by the processor deleting an ended campaign's topic
+const campaignTopicCleanupLockKey = "campaign_topic_cleanup:"
+
+// campaignTopics is nil unless CAMPAIGN_TOPICS_ENABLED is set
+var campaignTopics *CampaignTopicManager
+
+// CampaignTopicManager creates per-campaign order topics and deletes them once their campaign
+// is over; processors consume them through their TopicSubscription
+// Topics are created with the orders topic settings, and every partition is consumed by the
+// processor consumer group (group), whose committed offsets decide when a topic is drained
+type CampaignTopicManager struct {
+	brokers      []string
+	client       sarama.Client
+	subscription *TopicSubscription
+	group        string
+	grace        time.Duration     // How long a topic is kept after its campaign ends
+	exporter     *CampaignExporter // nil unless CAMPAIGN_EXPORT_BUCKET is set
+}
+
+// NewCampaignTopicManager creates a manager whose topics are consumed through subscription by group
+func NewCampaignTopicManager(brokers []string, client sarama.Client, subscription *TopicSubscription, group string, grace time.Duration) *CampaignTopicManager {
+	return &CampaignTopicManager{brokers: brokers, client: client, subscription: subscription, group: group, grace: grace}
+}
+
+// DeleteAfter returns when campaign's topic is deleted
+func (m *CampaignTopicManager) DeleteAfter(campaign common.CampaignTopic) time.Time {
+	return campaign.EndsAt.Add(m.grace)
+}
+
+// Create creates campaign's topic, registers the campaign for gateway routing and starts
+// consuming the topic here; other processors pick it up on their next subscription sync
+func (m *CampaignTopicManager) Create(ctx context.Context, campaign common.CampaignTopic) error {
+	if err := common.CreateTopic(m.brokers, m.client.Config(), common.CampaignTopicSpec(campaign.Name)); err != nil {
+		return err
+	}
+	if err := m.client.RefreshMetadata(campaign.Topic); err != nil {
+		return err
+	}
+	if m.subscription.Matches(campaign.Topic) {
+		if _, err := m.subscription.consumers.Add(campaign.Topic); err != nil {
+			return err
+		}
+	}
+	return common.SaveCampaignTopic(ctx, redisClient, campaign)
+}
+
+// CleanupEnded exports ended campaigns and deletes the topics of campaigns that ended more
+// than the grace period ago; with an exporter, a campaign is only deleted once exported
+func (m *CampaignTopicManager) CleanupEnded(ctx context.Context) error {
+	campaigns, err := common.LoadCampaignTopics(ctx, redisClient)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, campaign := range campaigns {
+		if m.exporter != nil && m.exporter.Due(campaign, now) {
+			m.exporter.ExportOnce(ctx, campaign)
+		}
+		if now.Before(m.DeleteAfter(campaign)) {
+			continue
+		}
+		if m.exporter != nil && !m.exporter.Exported(ctx, campaign) {
+			continue
+		}
+		m.cleanup(ctx, campaign)
+	}
+	return nil
+}
+
+// cleanup deletes an ended campaign's topic and registration once the consumer group has
+// committed every order in it; a topic with orders left is kept and checked again next time
+// A short Redis lock keeps every processor from issuing the same deletion
+func (m *CampaignTopicManager) cleanup(ctx context.Context, campaign common.CampaignTopic) {
+	logEntry := logger.WithFields(logrus.Fields{
+		"campaign": campaign.Name,
+		"topic":    campaign.Topic,
+		"ended_at": campaign.EndsAt,
+	})
+	acquired, err := redisClient.SetNX(ctx, campaignTopicCleanupLockKey+campaign.Name, 1, time.Minute).Result()
+	if err != nil || !acquired {
+		return
+	}
+	lag, err := m.committedLag(campaign.Topic)
+	if err != nil {
+		logEntry.WithError(err).Warn("Failed to read campaign topic lag, keeping the topic")
+		return
+	}
+	if lag > 0 {
+		logEntry.WithFields(logrus.Fields{
+			"event": "campaign_topic_not_drained",
+			"lag":   lag,
+		}).Warn("Campaign topic still has unprocessed orders, keeping the topic")
+		return
+	}
+	m.subscription.consumers.Remove(campaign.Topic)
+	if err := common.DeleteTopic(m.brokers, m.client.Config(), campaign.Topic); err != nil {
+		logEntry.WithError(err).Error("Failed to delete campaign topic")
+		return
+	}
+	if err := redisClient.HDel(ctx, common.CampaignTopicsKey, campaign.Name).Err(); err != nil {
+		logEntry.WithError(err).Error("Failed to remove campaign registration")
+		return
+	}
+	redisClient.Del(ctx, campaignExportedKeyPrefix+campaign.Name)
+	logEntry.WithField("event", "campaign_topic_deleted").Info("Campaign ended, topic deleted")
+}
+
+// committedLag returns the orders in topic the consumer group has not committed yet
+// Partitions the group never committed count from their oldest retained offset
+func (m *CampaignTopicManager) committedLag(topic string) (int64, error) {
+	if err := m.client.RefreshMetadata(topic); err != nil {
+		return 0, err
+	}
+	partitions, err := m.client.Partitions(topic)
+	if err != nil {
+		return 0, err
+	}
+	admin, err := sarama.NewClusterAdminFromClient(m.client)
+	if err != nil {
+		return 0, fmt.Errorf("create cluster admin: %w", err)
+	}
+	// The admin shares the client, which stays open; only the admin's own state is dropped
+	offsets, err := admin.ListConsumerGroupOffsets(m.group, map[string][]int32{topic: partitions})
+	if err != nil {
+		return 0, fmt.Errorf("list %s offsets: %w", m.group, err)
+	}
+	var lag int64
+	for _, partition := range partitions {
+		newest, err := m.client.GetOffset(topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return 0, err
+		}
+		committed := int64(-1)
+		if block := offsets.GetBlock(topic, partition); block != nil {
+			committed = block.Offset
+		}
+		if committed < 0 {
+			if committed, err = m.client.GetOffset(topic, partition, sarama.OffsetOldest); err != nil {
+				return 0, err
+			}
+		}
+		lag += max(newest-committed, 0)
+	}
+	return lag, nil
+}
+
+// Run calls CleanupEnded every interval until ctx is done
+func (m *CampaignTopicManager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := m.CleanupEnded(ctx); err != nil {
+			logger.WithError(err).WithField("event", "campaign_topics_cleanup_failed").Warn("Failed to clean up ended campaigns")
+		}
+	}
+}
+
+func handleAdminListCampaigns(w http.ResponseWriter, r *http.Request) {
+	campaigns, err := common.LoadCampaignTopics(r.Context(), redisClient)
+	if err != nil {
+		adminLog(r, "admin_campaigns_read").WithError(err).Error("Failed to read campaigns")
+		writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read campaigns"})
+		return
+	}
+	sort.Slice(campaigns, func(i, j int) bool { return campaigns[i].Name < campaigns[j].Name })
+	consumed := make(map[string]bool)
+	for _, topic := range campaignTopics.subscription.consumers.Topics() {
+		consumed[topic] = true
+	}
+	now := time.Now()
+	body := make([]map[string]interface{}, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		body = append(body, map[string]interface{}{
+			"name":         campaign.Name,
+			"topic":        campaign.Topic,
+			"item_ids":     campaign.ItemIDs,
+			"created_at":   campaign.CreatedAt,
+			"ends_at":      campaign.EndsAt,
+			"active":       campaign.Active(now),
+			"consumed":     consumed[campaign.Topic],
+			"delete_after": campaignTopics.DeleteAfter(campaign),
+		})
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{"campaigns": body})
+}
+
+func handleAdminCreateCampaign(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name    string    `json:"name"`
+		ItemIDs []string  `json:"item_ids"`
+		EndsAt  time.Time `json:"ends_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.ItemIDs) == 0 || req.EndsAt.IsZero() {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "body must be {\"name\": string, \"item_ids\": [string], \"ends_at\": RFC 3339 time}"})
+		return
+	}
+	if err := common.ValidateCampaignName(req.Name); err != nil {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	now := time.Now()
+	if !req.EndsAt.After(now) {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "ends_at must be in the future"})
+		return
+	}
+	logEntry := adminLog(r, "admin_campaign_create").WithFields(map[string]interface{}{
+		"campaign": req.Name,
+		"item_ids": req.ItemIDs,
+		"ends_at":  req.EndsAt,
+	})
+
+	// An item routed to two topics would be reserved by whichever order arrives first on
+	// either; reject overlaps instead of picking one silently
+	campaigns, err := common.LoadCampaignTopics(r.Context(), redisClient)
+	if err != nil {
+		logEntry.WithError(err).Error("Failed to read campaigns")
+		writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read campaigns"})
+		return
+	}
+	items := make(map[string]bool, len(req.ItemIDs))
+	for _, itemID := range req.ItemIDs {
+		items[itemID] = true
+	}
+	for _, campaign := range campaigns {
+		if campaign.Name == req.Name {
+			writeAdminJSON(w, http.StatusConflict, map[string]string{"error": "campaign already exists"})
+			return
+		}
+		if !campaign.Active(now) {
+			continue
+		}
+		for _, itemID := range campaign.ItemIDs {
+			if items[itemID] {
+				writeAdminJSON(w, http.StatusConflict, map[string]string{"error": "item " + itemID + " belongs to active campaign " + campaign.Name})
+				return
+			}
+		}
+	}
+
+	campaign := common.CampaignTopic{
+		Name:      req.Name,
+		Topic:     common.CampaignTopicName(req.Name),
+		ItemIDs:   req.ItemIDs,
+		CreatedAt: now.UTC(),
+		EndsAt:    req.EndsAt.UTC(),
+	}
+	if err := campaignTopics.Create(r.Context(), campaign); err != nil {
+		logEntry.WithError(err).Error("Failed to create campaign topic")
+		writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create campaign topic"})
+		return
+	}
+	recordAdminAction(r, "create_campaign_topic", "", nil, campaign)
+	logEntry.WithField("topic", campaign.Topic).Info("Campaign topic created by admin")
+	writeAdminJSON(w, http.StatusCreated, campaign)
+}
+
+// handleAdminEndCampaign ends a campaign now: gateways route its items back to the shared
+// topic on their next refresh, and the topic is deleted after the grace period
+func handleAdminEndCampaign(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("campaign")
+	logEntry := adminLog(r, "admin_campaign_end").WithField("campaign", name)
+	campaigns, err := common.LoadCampaignTopics(r.Context(), redisClient)
+	if err != nil {
+		logEntry.WithError(err).Error("Failed to read campaigns")
+		writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read campaigns"})
+		return
+	}
+	for _, campaign := range campaigns {
+		if campaign.Name != name {
+			continue
+		}
+		before := campaign
+		if now := time.Now().UTC(); campaign.EndsAt.After(now) {
+			campaign.EndsAt = now
+			if err := common.SaveCampaignTopic(r.Context(), redisClient, campaign); err != nil {
+				logEntry.WithError(err).Error("Failed to end campaign")
+				writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to end campaign"})
+				return
+			}
+			recordAdminAction(r, "end_campaign_topic", "", before, campaign)
+		}
+		logEntry.Info("Campaign ended by admin")
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{
+			"name":         campaign.Name,
+			"topic":        campaign.Topic,
+			"ends_at":      campaign.EndsAt,
+			"delete_after": campaignTopics.DeleteAfter(campaign),
+		})
+		return
+	}
+	writeAdminJSON(w, http.StatusNotFound, map[string]string{"error": "campaign not found"})
+}
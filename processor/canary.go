@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// runCanary submits a synthetic order every interval and records how long it takes to come
+// back processed: an always-on black-box signal, unlike dependency pings a canary fails when
+// consumers stall, partitions go unconsumed or scripts break
+// Each processor instance runs its own canary; the order lands on whichever instance consumes
+// the test item's partition
+func runCanary(interval, timeout time.Duration) {
+	logEntry := logger.WithField("event", "canary_order")
+	if _, err := inventory.Restock(ctx, common.SyntheticItemID, syntheticStock, true); err != nil {
+		logEntry.WithError(err).Warn("Failed to initialize canary test item")
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		latency, err := canaryOnce(timeout)
+		switch {
+		case err == nil:
+			metrics.CanaryLatency.Observe(latency.Seconds())
+			metrics.CanaryRuns.WithLabelValues("success").Inc()
+			metrics.CanaryLastSuccess.SetToCurrentTime()
+		case errors.Is(err, errSyntheticTimeout):
+			metrics.CanaryRuns.WithLabelValues("timeout").Inc()
+			logEntry.WithError(err).Warn("Canary order timed out")
+		default:
+			metrics.CanaryRuns.WithLabelValues("failed").Inc()
+			logEntry.WithError(err).Warn("Canary order failed")
+		}
+	}
+}
+
+// canaryOnce publishes one canary order and waits for its result
+// Latency runs from publishing to the processor's result
+func canaryOnce(timeout time.Duration) (time.Duration, error) {
+	requestID := "canary-" + uuid.New().String()
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	sub := redisClient.Subscribe(runCtx, common.OrderResultChannel(requestID))
+	defer sub.Close()
+	if _, err := sub.Receive(runCtx); err != nil {
+		return 0, err
+	}
+	msg, err := newSyntheticOrderMessage(requestID, common.SyntheticCanary)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	if _, _, err := producer.SendMessage(msg); err != nil {
+		return 0, err
+	}
+	_, err = awaitSyntheticResult(runCtx, sub, timeout)
+	return time.Since(start), err
+}
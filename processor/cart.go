@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// validCartLines reports whether a cart order's lines can be processed: every line names an item
+// once with a positive amount, and the first is the order's item (which keyed and routed it)
+// Orders without lines are valid
+func validCartLines(order *OrderRequest) bool {
+	if len(order.Lines) == 0 {
+		return true
+	}
+	if order.Lines[0].ItemID != order.ItemID || order.Lines[0].Amount != order.Amount {
+		return false
+	}
+	seen := make(map[string]bool, len(order.Lines))
+	for _, line := range order.Lines {
+		if line.ItemID == "" || line.Amount <= 0 || seen[line.ItemID] {
+			return false
+		}
+		seen[line.ItemID] = true
+	}
+	return true
+}
+
+// orderItems returns the items of order: its lines' for a cart order, else its item
+func orderItems(order *OrderRequest) []string {
+	if len(order.Lines) == 0 {
+		return []string{order.ItemID}
+	}
+	items := make([]string, len(order.Lines))
+	for i, line := range order.Lines {
+		items[i] = line.ItemID
+	}
+	return items
+}
+
+// orderQuantity returns the units of order, over every line of a cart order
+func orderQuantity(order *OrderRequest) int64 {
+	if len(order.Lines) == 0 {
+		return order.Amount
+	}
+	var quantity int64
+	for _, line := range order.Lines {
+		quantity += line.Amount
+	}
+	return quantity
+}
+
+// cartLineOrder returns line i of a cart order as a single-item order of the same buyer, so it
+// reserves, refunds, confirms and is fulfilled like one
+func cartLineOrder(order *OrderRequest, i int) *OrderRequest {
+	line := *order
+	line.ItemID, line.Amount = order.Lines[i].ItemID, order.Lines[i].Amount
+	line.Lines, line.CartPolicy = nil, ""
+	return &line
+}
+
+// processCartOrder reserves, charges and confirms the lines of a cart order
+// Each line reserves under its own request ID (common.CartLineRequestID), so lines are refunded
+// and confirmed on their own and a retried cart continues with the lines it already reserved.
+// When a line can't be reserved, an all-or-nothing cart fails and releases the other lines; a
+// best-effort cart goes on with the lines that reserved, unless none did. The buyer is charged
+// once, for the lines kept, and the results list every line's outcome
+func processCartOrder(ctx context.Context, logEntry *logrus.Entry, msg *sarama.ConsumerMessage, order *OrderRequest, requestID, correlationID string, startTime time.Time) {
+	policy := order.CartPolicy
+	if policy == "" {
+		policy = common.CartAllOrNothing
+	}
+	logEntry = logEntry.WithFields(logrus.Fields{
+		"cart_lines":  len(order.Lines),
+		"cart_policy": policy,
+	})
+
+	lines := make([]common.CartLineResult, len(order.Lines))
+	var kept []int // Lines holding a reservation
+	for i := range order.Lines {
+		line := cartLineOrder(order, i)
+		lineRequestID := common.CartLineRequestID(requestID, i)
+		lines[i] = common.CartLineResult{ItemID: line.ItemID, Quantity: line.Amount}
+		lineLog := logEntry.WithFields(logrus.Fields{"cart_line": i, "item_id": line.ItemID, "amount": line.Amount})
+
+		// Codes are assigned per order (see digital_delivery.go), not per line
+		if digital != nil && digital.IsDigital(line.ItemID) {
+			lines[i].Status, lines[i].Reason = common.ResultFailedSoldOut, "DIGITAL_ITEM"
+			lineLog.WithField("event", "cart_line_digital").Warn("Digital items can't be ordered in a cart")
+			continue
+		}
+
+		reservation, err := reserveCartLine(ctx, msg, line, lineRequestID)
+		if err != nil {
+			// As for a single order, the lines reserved so far stay recorded: a retry continues with
+			// them, and only a cart given up on releases them
+			forgetOrderProcessing(requestID)
+			failure := reservationFailure(lineLog, err)
+			if !retryOrder(logEntry, msg, failure) {
+				for j := 0; j <= i; j++ {
+					releaseUncertainReservation(logEntry, cartLineOrder(order, j), common.CartLineRequestID(requestID, j))
+				}
+				moveToDLQ(msg, failure, correlationID)
+			}
+			return
+		}
+
+		if !reservation.Reserved {
+			if reservation.Reason == "SOLD_OUT" || reservation.Reason == "CHANNEL_RESERVED" {
+				publishInventoryState(lineLog, line.ItemID, reservation.Stock+line.Amount)
+			}
+			lines[i].Status, lines[i].Reason = common.ResultFailedSoldOut, reservation.Reason
+			lineLog.WithField("reason", reservation.Reason).Info("Cart line unavailable")
+			continue
+		}
+		publishInventoryState(lineLog, line.ItemID, reservation.Stock)
+		if reservation.Reason == "ALREADY_RESERVED" {
+			lineLog.WithField("event", "reservation_reused").Info("Continuing with the line's earlier reservation")
+		} else if auditor != nil {
+			auditor.RecordReservation(ctx, line.ItemID, line.Amount)
+		}
+		lines[i].Status = common.CartLineReserved
+		kept = append(kept, i)
+	}
+
+	if len(kept) < len(order.Lines) && (policy == common.CartAllOrNothing || len(kept) == 0) {
+		for _, i := range kept {
+			refundCartLine(ctx, logEntry, order, requestID, i)
+			lines[i].Status = common.CartLineReleased
+		}
+		sendOrderResult(msg, cartResult(msg, order, common.ResultFailedSoldOut, common.ReasonCartLineFailed, lines))
+		recordOrderSLA(msg, order.ItemID, outcomeSoldOut)
+		metrics.Orders.Record(common.OrderOutcomeSoldOut, order.ItemID, extractCampaign(msg))
+		metrics.OrdersByChannel.WithLabelValues(order.Channel, outcomeSoldOut).Inc()
+		metrics.OrdersProcessedFailed.Inc()
+		logEntry.WithFields(logrus.Fields{
+			"event":        "cart_order_failed",
+			"failed_lines": len(order.Lines) - len(kept),
+		}).Warn("Cart order failed: lines unavailable")
+		return
+	}
+
+	logEntry.WithField("reserved_lines", len(kept)).Info("Cart lines reserved successfully")
+	sendOrderResult(msg, cartResult(msg, order, common.ResultReserved, "", lines))
+
+	// One charge for the lines kept; its idempotency key is the cart's, like a single order's
+	charged := *order
+	charged.Lines = make([]common.CartLine, len(kept))
+	for n, i := range kept {
+		charged.Lines[n] = order.Lines[i]
+	}
+	charged.ItemID, charged.Amount = charged.Lines[0].ItemID, charged.Lines[0].Amount
+	charge, chargeErr := chargeOrder(logEntry, msg, &charged)
+	if chargeErr != nil || charge.Status != ChargeSucceeded {
+		dlqReason := paymentFailure(logEntry, charge, chargeErr)
+		holdsNoStock := true
+		for _, i := range kept {
+			if err := refundCartLine(ctx, logEntry, order, requestID, i); err != nil && !errors.Is(err, ErrNoReservation) {
+				holdsNoStock = false
+			}
+		}
+		// Refunded payment timeouts are retried, like a single order's; the retry reserves the lines again
+		if holdsNoStock && retryOrder(logEntry, msg, dlqReason) {
+			return
+		}
+		metrics.OrdersByChannel.WithLabelValues(order.Channel, outcomePaymentFailed).Inc()
+		moveToDLQ(msg, dlqReason, correlationID)
+		return
+	}
+
+	recordTimelineStage(msg, common.TimelineCharged, time.Now(), charge.ChargeID)
+
+	// Paid: each kept line's units are sold and fulfilled as an event of its own
+	for _, i := range kept {
+		line := cartLineOrder(order, i)
+		lineRequestID := common.CartLineRequestID(requestID, i)
+		confirmInventory(logEntry, line.ItemID, lineRequestID, line.Amount)
+		publishFulfillmentEvent(logEntry, line, requestID, lineRequestID)
+		lines[i].Status = common.CartLineCompleted
+	}
+	sendOrderResult(msg, cartResult(msg, order, common.ResultCompleted, "", lines))
+
+	recordOrderSLA(msg, order.ItemID, outcomeCompleted)
+	metrics.OrdersByChannel.WithLabelValues(order.Channel, outcomeCompleted).Inc()
+	metrics.Orders.Record(common.OrderOutcomeConfirmed, order.ItemID, extractCampaign(msg))
+	logEntry.WithFields(logrus.Fields{
+		"event":              "order_processed_success",
+		"completed_lines":    len(kept),
+		"processing_time_ms": time.Since(startTime).Milliseconds(),
+	}).Info("Cart order processed successfully")
+}
+
+// reserveCartLine reserves one line of a cart order, counted against the buyer's purchase cap
+// of the line's item
+func reserveCartLine(ctx context.Context, msg *sarama.ConsumerMessage, line *OrderRequest, lineRequestID string) (ReserveResult, error) {
+	scriptCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return inventory.Reserve(scriptCtx, ReserveRequest{
+		ItemID:    line.ItemID,
+		Channel:   line.Channel,
+		Amount:    line.Amount,
+		Reserves:  channelReserves(line.ItemID, line.Channel),
+		RequestID: lineRequestID,
+		UserID:    line.UserID,
+		Cap:       reserveCap(msg, line, lineRequestID),
+		CapWindow: purchaseCaps.Window,
+	})
+}
+
+// refundCartLine gives back the units reserved by line i of a cart order
+// ErrNoReservation (nothing held) is returned but not logged as a failure
+func refundCartLine(ctx context.Context, logEntry *logrus.Entry, order *OrderRequest, requestID string, i int) error {
+	line := cartLineOrder(order, i)
+	logEntry = logEntry.WithFields(logrus.Fields{"cart_line": i, "item_id": line.ItemID})
+	refundCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	newStock, err := inventory.Refund(refundCtx, RefundRequest{
+		ItemID:    line.ItemID,
+		Channel:   line.Channel,
+		UserID:    line.UserID,
+		RequestID: common.CartLineRequestID(requestID, i),
+		Amount:    line.Amount,
+	})
+	switch {
+	case errors.Is(err, ErrNoReservation):
+		logEntry.WithField("event", "refund_nothing_reserved").Warn("Cart line holds no reservation, nothing to refund")
+		return err
+	case err != nil:
+		redisHealth.Observe(err)
+		logEntry.WithError(err).Error("Failed to refund cart line inventory")
+		return err
+	}
+	logEntry.WithField("new_stock", newStock).Info("Cart line inventory refunded")
+	publishInventoryState(logEntry, line.ItemID, newStock)
+	refreshInventoryProjection(logEntry, line.ItemID)
+	if err := common.NotifyRestock(ctx, redisClient, line.ItemID, line.Amount); err != nil {
+		logEntry.WithError(err).Warn("Failed to notify waitlist of refunded units")
+	}
+	if auditor != nil {
+		auditor.RecordReservation(ctx, line.ItemID, -line.Amount)
+	}
+	return nil
+}
+
+// cartResult is a cart order's result with the outcome of each line
+func cartResult(msg *sarama.ConsumerMessage, order *OrderRequest, status, reason string, lines []common.CartLineResult) common.OrderResult {
+	return common.OrderResult{
+		RequestID: extractRequestID(msg.Headers),
+		ItemID:    order.ItemID,
+		Status:    status,
+		Reason:    reason,
+		Lines:     slices.Clone(lines),
+	}
+}
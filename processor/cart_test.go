@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// recordingPaymentProvider approves every charge and keeps the requests
+type recordingPaymentProvider struct {
+	charges []ChargeRequest
+}
+
+func (p *recordingPaymentProvider) Name() string { return "recording" }
+
+func (p *recordingPaymentProvider) Charge(_ context.Context, req ChargeRequest) (ChargeResult, error) {
+	p.charges = append(p.charges, req)
+	return ChargeResult{Status: ChargeSucceeded, ChargeID: req.IdempotencyKey}, nil
+}
+
+func (p *recordingPaymentProvider) ChargeStatus(context.Context, string) (ChargeResult, bool, error) {
+	return ChargeResult{}, false, nil
+}
+
+func TestProcessCartOrderPolicies(t *testing.T) {
+	tests := []struct {
+		policy    string
+		status    string
+		lines     []string
+		available int64 // Of item 101 afterwards
+		charged   int64
+	}{
+		{common.CartAllOrNothing, common.ResultFailedSoldOut, []string{common.CartLineReleased, common.ResultFailedSoldOut}, 5, 0},
+		{common.CartBestEffort, common.ResultCompleted, []string{common.CartLineCompleted, common.ResultFailedSoldOut}, 3, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			store := newTestInventoryStore(t, map[string]int64{"101": 5, "102": 1})
+			provider := &recordingPaymentProvider{}
+			previousInventory, previousPayments, previousHealth := inventory, payments, redisHealth
+			inventory, payments = store, provider
+			redisHealth = common.NewRedisDegradation(time.Minute, metrics.RedisDegraded, logger)
+			t.Cleanup(func() { inventory, payments, redisHealth = previousInventory, previousPayments, previousHealth })
+
+			// Item 102 has 1 unit left for a line of 3
+			order := &OrderRequest{
+				UserID: "user-1", ItemID: "101", Amount: 2, Channel: common.DefaultChannel,
+				Lines:      []common.CartLine{{ItemID: "101", Amount: 2}, {ItemID: "102", Amount: 3}},
+				CartPolicy: tt.policy,
+			}
+			msg := &sarama.ConsumerMessage{Headers: []*sarama.RecordHeader{{Key: []byte("request_id"), Value: []byte("cart-1")}}}
+			processCartOrder(context.Background(), logger.WithField("test", true), msg, order, "cart-1", "corr-1", time.Now())
+
+			result, err := common.LoadOrderResult(context.Background(), redisClient, "cart-1")
+			if err != nil || result == nil {
+				t.Fatalf("LoadOrderResult = %v, %v", result, err)
+			}
+			if result.Status != tt.status || len(result.Lines) != len(tt.lines) {
+				t.Fatalf("result = %+v, want %s with %d lines", result, tt.status, len(tt.lines))
+			}
+			for i, status := range tt.lines {
+				if result.Lines[i].Status != status {
+					t.Errorf("line %d = %+v, want %s", i, result.Lines[i], status)
+				}
+			}
+
+			projection, _, err := store.Projection(context.Background(), "101")
+			if err != nil {
+				t.Fatalf("Projection: %v", err)
+			}
+			if projection.Available != tt.available || projection.Reserved != 0 || projection.Sold != 5-tt.available {
+				t.Errorf("item 101 = %+v, want %d available and the rest sold", projection, tt.available)
+			}
+
+			var charged int64
+			for _, charge := range provider.charges {
+				if len(charge.Lines) != 1 || charge.Lines[0].ItemID != "101" {
+					t.Errorf("charged lines %+v, want item 101 only", charge.Lines)
+				}
+				charged += charge.Quantity
+			}
+			if charged != tt.charged {
+				t.Errorf("charged %d units, want %d", charged, tt.charged)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+// Per-channel stock allocation buckets
+//
+// inventory_buckets:{item_id} is a hash of channel -> units allocated to that channel, plus an
+// optional spill_after field (unix seconds). The item's inventory counter stays the total; the
+// buckets only partition it:
+//   - before spill_after an order may take from its own channel's bucket and from stock not
+//     allocated to any bucket (total minus the sum of buckets)
+//   - from spill_after on, unsold allocations of every channel are available to all channels
+//
+// "App-exclusive first hour" for 500 units is therefore:
+//
+//	SET inventory:101 500
+//	HSET inventory_buckets:101 app 500 spill_after <sale start + 3600>
+//
+// Enforcement happens inside the reserve script (common.LuaCheckInventoryScript) so allocations
+// are consumed atomically with the stock itself. Buckets are not versioned: re-stage them
+// together with a stock cutover
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// CampaignChannelPolicy reserves part of each campaign item's stock for specific channels
+// The reserve is a share of the item's own units (available, reserved and sold) less what the
+// channel already bought of it, and orders from other channels cannot take stock below what is
+// still reserved, e.g. with 1000 units and {"app": 20} web and partner orders stop at 200
+// remaining units until app orders bought some; after 50 app units they stop at 150
+//
+// Example file (CHANNEL_POLICY_FILE):
+//
+//	[
+//	  {"campaign": "spring-drop", "item_ids": ["101", "102"], "reserve_percent": {"app": 20}}
+//	]
+type CampaignChannelPolicy struct {
+	Campaign       string             `json:"campaign"`
+	ItemIDs        []string           `json:"item_ids"`
+	TotalStock     int64              `json:"total_stock,omitempty"` // Deprecated: ignored, reserves follow each item's stock
+	ReservePercent map[string]float64 `json:"reserve_percent"`
+}
+
+// channelPolicies maps item_id to its campaign policy; nil when no policy file is configured
+var channelPolicies map[string]*CampaignChannelPolicy
+
+// LoadChannelPolicies reads campaign channel policies from a JSON file
+// Unknown channels, percentages over 100 in total and items listed in more than one campaign
+// are rejected so misconfiguration fails at startup
+func LoadChannelPolicies(path string) (map[string]*CampaignChannelPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read channel policies: %w", err)
+	}
+
+	var campaigns []*CampaignChannelPolicy
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&campaigns); err != nil {
+		return nil, fmt.Errorf("parse channel policies: %w", err)
+	}
+
+	policies := make(map[string]*CampaignChannelPolicy)
+	for _, campaign := range campaigns {
+		var total float64
+		for channel, percent := range campaign.ReservePercent {
+			if !common.IsValidChannel(channel) {
+				return nil, fmt.Errorf("campaign %q: unknown channel %q", campaign.Campaign, channel)
+			}
+			if percent < 0 {
+				return nil, fmt.Errorf("campaign %q: reserve_percent for %s must not be negative", campaign.Campaign, channel)
+			}
+			total += percent
+		}
+		if total > 100 {
+			return nil, fmt.Errorf("campaign %q: reserve_percent adds up to more than 100", campaign.Campaign)
+		}
+		for _, itemID := range campaign.ItemIDs {
+			if existing, ok := policies[itemID]; ok {
+				return nil, fmt.Errorf("item %s is in campaigns %q and %q", itemID, existing.Campaign, campaign.Campaign)
+			}
+			policies[itemID] = campaign
+		}
+	}
+	return policies, nil
+}
+
+// OtherReserves returns the reserve percentages of every channel other than channel, the stock
+// an order from channel may not take
+func (p *CampaignChannelPolicy) OtherReserves(channel string) map[string]float64 {
+	reserves := make(map[string]float64, len(p.ReservePercent))
+	for reservedChannel, percent := range p.ReservePercent {
+		if reservedChannel != channel && percent > 0 {
+			reserves[reservedChannel] = percent
+		}
+	}
+	return reserves
+}
+
+// channelReserves returns the reserves an order of itemID from channel may not take (nil without a policy)
+func channelReserves(itemID, channel string) map[string]float64 {
+	if policy, ok := channelPolicies[itemID]; ok {
+		return policy.OtherReserves(channel)
+	}
+	return nil
+}
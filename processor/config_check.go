@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// startupConfig is the configuration resolved at startup, served at GET /admin/config
+var startupConfig *common.ConfigReport
+
+// processorConfig resolves the processor's configuration without connecting to Redis or
+// Kafka and checks the combinations main can't catch on its own (-validate-config)
+// Defaults mirror main; keep both in step when adding a setting
+func processorConfig() *common.ConfigReport {
+	r := common.NewConfigReport("processor")
+	common.ReportSharedConfig(r)
+
+	// Order consumption
+	campaignTopicsEnabled := r.Bool("CAMPAIGN_TOPICS_ENABLED", false)
+	defaultPattern := defaultOrderTopicPattern
+	if campaignTopicsEnabled {
+		defaultPattern = defaultCampaignOrderTopicPattern
+	}
+	if pattern, err := regexp.Compile("^(?:" + r.String("ORDER_TOPIC_PATTERN", defaultPattern) + ")$"); err != nil {
+		r.Errorf("ORDER_TOPIC_PATTERN: %v", err)
+	} else if campaignTopicsEnabled && !pattern.MatchString(common.CampaignTopicName("campaign")) {
+		r.Warnf("ORDER_TOPIC_PATTERN doesn't match campaign topics; their orders won't be processed by this instance")
+	}
+	r.String("PROCESSOR_GROUP", defaultProcessorGroup)
+	r.OneOf("PROCESSOR_GROUP_INITIAL_OFFSET", "oldest", "newest")
+	if os.Getenv("ORDER_PARTITIONS") != "" {
+		r.Warnf("ORDER_PARTITIONS is no longer supported and is ignored; partitions are assigned by the PROCESSOR_GROUP consumer group")
+	}
+	if r.Int("PROCESSOR_WORKERS", 1) < 1 {
+		r.Errorf("PROCESSOR_WORKERS must be at least 1")
+	}
+	r.Duration("ORDER_TOPICS_REFRESH", 10*time.Second)
+	if campaignTopicsEnabled {
+		r.Duration("CAMPAIGN_TOPICS_REFRESH", 10*time.Second)
+		grace := r.Duration("CAMPAIGN_TOPIC_GRACE", 24*time.Hour)
+		if bucket := r.String("CAMPAIGN_EXPORT_BUCKET", ""); bucket != "" {
+			r.String("CAMPAIGN_EXPORT_PREFIX", "")
+			r.Duration("CAMPAIGN_EXPORT_TIMEOUT", 60*time.Second)
+			if delay := r.Duration("CAMPAIGN_EXPORT_DELAY", 15*time.Minute); delay >= grace {
+				r.Warnf("CAMPAIGN_EXPORT_DELAY is not below CAMPAIGN_TOPIC_GRACE; ended campaigns are kept until exported")
+			}
+			_, err := NewObjectArchive(r.URL("CAMPAIGN_EXPORT_ENDPOINT"), bucket, "",
+				r.String("CAMPAIGN_EXPORT_REGION", ""), common.AWSCredentials{
+					AccessKey: r.String("AWS_ACCESS_KEY_ID", ""),
+					SecretKey: r.Secret("AWS_SECRET_ACCESS_KEY"),
+				}, nil)
+			r.Check("CAMPAIGN_EXPORT_BUCKET", err)
+		}
+	} else if r.String("CAMPAIGN_EXPORT_BUCKET", "") != "" {
+		r.Warnf("CAMPAIGN_EXPORT_BUCKET is ignored without CAMPAIGN_TOPICS_ENABLED")
+	}
+
+	// Inventory
+	dsn := r.Secret("INVENTORY_POSTGRES_DSN")
+	if postgresItems := r.List("INVENTORY_POSTGRES_ITEMS", ""); len(postgresItems) > 0 && dsn == "" {
+		r.Warnf("INVENTORY_POSTGRES_ITEMS is ignored without INVENTORY_POSTGRES_DSN; those items stay in Redis")
+	}
+	orderStoreDSN := r.Secret("ORDER_STORE_DSN")
+	if orderStoreDSN != "" {
+		if r.Int("ORDER_STORE_QUEUE_SIZE", 10000) < 1 {
+			r.Errorf("ORDER_STORE_QUEUE_SIZE must be at least 1")
+		}
+		if r.Duration("ORDER_STORE_FLUSH_INTERVAL", time.Second) <= 0 {
+			r.Errorf("ORDER_STORE_FLUSH_INTERVAL must be positive")
+		}
+	}
+	orderRetention := r.Int("ORDER_RETENTION_DAYS", 0)
+	auditRetention := r.Int("AUDIT_RETENTION_DAYS", 0)
+	if orderRetention < 0 || auditRetention < 0 {
+		r.Errorf("ORDER_RETENTION_DAYS and AUDIT_RETENTION_DAYS must not be negative")
+	}
+	if orderRetention > 0 {
+		if orderStoreDSN == "" {
+			r.Warnf("ORDER_RETENTION_DAYS is set without ORDER_STORE_DSN; there are no orders to purge")
+		}
+		if r.Int("ORDER_PURGE_GRACE_DAYS", 7) < 0 {
+			r.Errorf("ORDER_PURGE_GRACE_DAYS must not be negative")
+		}
+	}
+	if orderRetention > 0 || auditRetention > 0 {
+		if r.Duration("RETENTION_INTERVAL", time.Hour) < time.Minute {
+			r.Errorf("RETENTION_INTERVAL must be at least 1m")
+		}
+		if bucket := r.String("RETENTION_ARCHIVE_BUCKET", ""); bucket != "" {
+			r.String("RETENTION_ARCHIVE_PREFIX", "")
+			r.Duration("RETENTION_ARCHIVE_TIMEOUT", 30*time.Second)
+			_, err := NewObjectArchive(r.URL("RETENTION_ARCHIVE_ENDPOINT"), bucket, "",
+				r.String("RETENTION_ARCHIVE_REGION", ""), common.AWSCredentials{
+					AccessKey: r.String("AWS_ACCESS_KEY_ID", ""),
+					SecretKey: r.Secret("AWS_SECRET_ACCESS_KEY"),
+				}, nil)
+			r.Check("RETENTION_ARCHIVE_BUCKET", err)
+		} else {
+			r.Warnf("RETENTION_ARCHIVE_BUCKET is not set; purged records are not archived")
+		}
+	}
+	r.Bool("INVENTORY_STATE_PUBLISH", false)
+	r.Bool("INVENTORY_STATE_RESTORE", false)
+	r.Int("PURCHASE_CAP_PER_USER", 0)
+	_, err := common.ParsePurchaseCaps(r.String("PURCHASE_CAP_ITEMS", ""))
+	r.Check("PURCHASE_CAP_ITEMS", err)
+	r.Duration("PURCHASE_CAP_WINDOW", 24*time.Hour)
+	if policyFile := r.File("CHANNEL_POLICY_FILE"); policyFile != "" {
+		policies, err := LoadChannelPolicies(policyFile)
+		r.Check("CHANNEL_POLICY_FILE", err)
+		if err == nil {
+			r.Set("channel_policies", fmt.Sprintf("%d items", len(policies)), common.ConfigSourceFile)
+		}
+	}
+
+	// Message protection
+	if r.Bool("PAYLOAD_ENCRYPTION_REQUIRED", false) {
+		if cipher, err := common.LoadPayloadCipher(); err == nil && cipher == nil {
+			r.Errorf("PAYLOAD_ENCRYPTION_REQUIRED needs PAYLOAD_ENCRYPTION_KEYS or PAYLOAD_ENCRYPTION_KEYS_FILE; every order would be rejected")
+		}
+	}
+	r.OneOf("MESSAGE_SIGNATURE_FAILURE_ACTION", "dlq", "drop")
+
+	// Order lifecycle
+	sla := r.Duration("ORDER_SLA_TARGET", slaTarget)
+	r.Bool("SLA_BREACH_PUBLISH", false)
+	r.Bool("ORDER_TIMELINE_ENABLED", false)
+	publishResults := r.Bool("ORDER_RESULTS_PUBLISH", false)
+	if r.Bool("DELIVERY_AUDIT_ENABLED", false) {
+		deadline := r.Duration("DELIVERY_AUDIT_DEADLINE", 5*time.Minute)
+		if deadline <= 0 {
+			r.Errorf("DELIVERY_AUDIT_DEADLINE must be positive")
+		} else if deadline >= common.OrderStatusTTL && orderStoreDSN == "" {
+			r.Warnf("DELIVERY_AUDIT_DEADLINE (%s) is not below the %s order status TTL and ORDER_STORE_DSN is unset; every order will be reported stuck", deadline, common.OrderStatusTTL)
+		}
+		if r.Duration("DELIVERY_AUDIT_INTERVAL", 30*time.Second) <= 0 {
+			r.Errorf("DELIVERY_AUDIT_INTERVAL must be positive")
+		}
+	}
+	if r.Int("DLQ_SPILL_MAX", 10000) < 1 {
+		r.Errorf("DLQ_SPILL_MAX must be at least 1")
+	}
+	if r.Duration("DLQ_SPILL_REPUBLISH_INTERVAL", 10*time.Second) <= 0 {
+		r.Errorf("DLQ_SPILL_REPUBLISH_INTERVAL must be positive")
+	}
+	if r.Bool("ORDER_STORE_OUTBOX", false) {
+		switch {
+		case !publishResults:
+			r.Warnf("ORDER_STORE_OUTBOX is ignored without ORDER_RESULTS_PUBLISH; there are no result events to relay")
+		case orderStoreDSN == "":
+			r.Errorf("ORDER_STORE_OUTBOX requires ORDER_STORE_DSN")
+		case r.Duration("ORDER_OUTBOX_POLL_INTERVAL", 500*time.Millisecond) <= 0:
+			r.Errorf("ORDER_OUTBOX_POLL_INTERVAL must be positive")
+		}
+	}
+	maxAge := r.Duration("ORDER_MAX_AGE", 0)
+	if maxAge > 0 && maxAge <= sla {
+		r.Errorf("ORDER_MAX_AGE (%s) must be above ORDER_SLA_TARGET (%s), or orders still within their SLA expire", maxAge, sla)
+	}
+	processedTTL := r.Duration("ORDER_PROCESSED_TTL", processedOrderTTL)
+	if retention := getEnvDuration("KAFKA_TOPIC_RETENTION", 168*time.Hour); processedTTL < retention {
+		r.Warnf("ORDER_PROCESSED_TTL (%s) is shorter than the order topic retention (%s); replays of the oldest orders can't skip processed ones", processedTTL, retention)
+	}
+	if r.Int("DLQ_REPLAY_MAX_ATTEMPTS", 3) < 1 {
+		r.Errorf("DLQ_REPLAY_MAX_ATTEMPTS must be at least 1, or no DLQ order is ever retried")
+	}
+	if retries := r.Int("ORDER_RETRY_MAX_ATTEMPTS", 0); retries < 0 {
+		r.Errorf("ORDER_RETRY_MAX_ATTEMPTS must not be negative")
+	} else if retries > 0 && os.Getenv("MESSAGE_SIGNING_KEYS") != "" && os.Getenv("MESSAGE_SIGNING_KEY_ID") == "" {
+		r.Warnf("ORDER_RETRY_MAX_ATTEMPTS is set but MESSAGE_SIGNING_KEY_ID is not; retried orders can't be signed and go to the DLQ")
+	}
+
+	// Integrations
+	paymentTimeout := r.Duration("PAYMENT_PROVIDER_TIMEOUT", 5*time.Second)
+	if r.URL("PAYMENT_PROVIDER_URL") != "" && paymentTimeout >= sla {
+		r.Warnf("PAYMENT_PROVIDER_TIMEOUT (%s) is not below ORDER_SLA_TARGET (%s); one slow charge breaches the SLA", paymentTimeout, sla)
+	}
+	mode := r.OneOf("FULFILLMENT_MODE", FulfillmentOff, FulfillmentKafka, FulfillmentWebhook)
+	webhookURL := r.URL("FULFILLMENT_WEBHOOK_URL")
+	if mode == FulfillmentWebhook {
+		if webhookURL == "" {
+			r.Errorf("FULFILLMENT_MODE=webhook requires FULFILLMENT_WEBHOOK_URL")
+		}
+		r.Duration("FULFILLMENT_WEBHOOK_TIMEOUT", 5*time.Second)
+		r.Int("FULFILLMENT_WEBHOOK_RETRIES", 5)
+	}
+	if mode != FulfillmentOff && r.Int("FULFILLMENT_QUEUE_SIZE", 10000) == 0 {
+		r.Errorf("FULFILLMENT_QUEUE_SIZE must be at least 1")
+	}
+	if len(r.List("DIGITAL_ITEMS", "")) > 0 {
+		r.Int("DIGITAL_CODES_LOW_WATERMARK", 100)
+		if cipher, err := common.LoadPayloadCipher(); err == nil && cipher == nil {
+			r.Warnf("DIGITAL_ITEMS is set without PAYLOAD_ENCRYPTION_KEYS; delivery codes are left out of DELIVERED results and never reach customers")
+		}
+	}
+
+	// Operations
+	r.Bool("PROCESSOR_SAFETY_AUDIT", false)
+	adminSecret := r.Secret("ADMIN_TOKEN_SECRET")
+	if adminSecret != "" {
+		_, err := common.NewAdminAuth(adminSecret)
+		r.Check("ADMIN_TOKEN_SECRET", err)
+		r.Int("ADMIN_AUDIT_MAX_ENTRIES", 0)
+		r.Duration("SELFTEST_TIMEOUT", selftestTimeout)
+	}
+	if secret := r.Secret("RATE_LIMIT_EXEMPTION_SECRET"); secret != "" {
+		_, err := common.NewRateLimitExemptions(secret, nil)
+		r.Check("RATE_LIMIT_EXEMPTION_SECRET", err)
+		if adminSecret == "" {
+			r.Warnf("RATE_LIMIT_EXEMPTION_SECRET has no effect without ADMIN_TOKEN_SECRET; exemptions are managed through the admin API")
+		}
+	}
+	if r.Bool("PROCESSOR_CONTROL_ENABLED", false) {
+		r.String("CONTROL_CHANNEL", "processor:control")
+		r.Int("CONTROL_MAX_PARKED", 10000)
+	}
+	if interval := r.Duration("CANARY_INTERVAL", 0); interval > 0 {
+		if timeout := r.Duration("CANARY_TIMEOUT", 10*time.Second); timeout >= interval {
+			r.Warnf("CANARY_TIMEOUT (%s) is not below CANARY_INTERVAL (%s); canaries overlap", timeout, interval)
+		}
+	}
+	return r
+}
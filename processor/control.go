@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// Control commands accepted on the control channel (CONTROL_CHANNEL)
+// Example: redis-cli PUBLISH processor:control '{"command":"pause_item","item_id":"101"}'
+const (
+	CommandPauseItem        = "pause_item"        // Park orders for item_id in Redis until resumed
+	CommandResumeItem       = "resume_item"       // Process parked orders for item_id (in order) and unpause it
+	CommandDrain            = "drain"             // Stop consuming new orders; in-flight orders finish
+	CommandResume           = "resume"            // Resume consuming after a drain
+	CommandReloadScripts    = "reload_scripts"    // Reload Lua scripts into Redis (e.g. after SCRIPT FLUSH or failover)
+	CommandCutoverInventory = "cutover_inventory" // Switch item_id to the staged inventory counter for version
+)
+
+// pausedItemsKey persists paused items so restarted or additional instances honor them
+const pausedItemsKey = "control:paused_items"
+
+// parkedItemsKey is the set of items with orders in a parked list, so a release interrupted
+// by a restart is finished by the next processor to start
+const parkedItemsKey = "control:parked_items"
+
+// parkedReleaseLockTTL bounds how long a crashed processor blocks the release of parked orders
+const parkedReleaseLockTTL = 30 * time.Second
+
+// errParkedFull is returned when an item already has CONTROL_MAX_PARKED parked orders
+var errParkedFull = errors.New("parked orders full")
+
+// parkedOrdersKey is the Redis list of orders parked for itemID, oldest first
+func parkedOrdersKey(itemID string) string {
+	return "control:parked:" + itemID
+}
+
+// parkedReleaseLockKey is held by the processor releasing itemID's parked orders
+func parkedReleaseLockKey(itemID string) string {
+	return "control:parked:" + itemID + ":lock"
+}
+
+// parkedOrder is the persisted form of an order held for a paused item
+type parkedOrder struct {
+	Topic     string          `json:"topic"`
+	Partition int32           `json:"partition"`
+	Offset    int64           `json:"offset"`
+	Key       []byte          `json:"key,omitempty"`
+	Value     []byte          `json:"value"`
+	Headers   []spilledHeader `json:"headers,omitempty"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// ControlCommand is a runtime command published by operators
+type ControlCommand struct {
+	Command string `json:"command"`
+	ItemID  string `json:"item_id,omitempty"`
+	Version int64  `json:"version,omitempty"` // Target inventory version for cutover_inventory
+}
+
+// ProcessorControl applies runtime control commands to the processing loop
+// Commands are delivered on Commands() and applied by the dispatch loop while no worker is
+// processing an order, so pausing and resuming never race with processOrder
+// Parked orders are pushed to a Redis list shared by all processors before their offset is
+// committed, so a restart or rebalance while an item is paused doesn't lose them
+type ProcessorControl struct {
+	channel    string
+	maxParked  int
+	commands   chan ControlCommand
+	consumers  OrderSource
+	parkScript *redis.Script
+
+	paused   map[string]bool
+	draining bool
+}
+
+// NewProcessorControl creates the controller and loads paused items persisted in Redis
+// maxParked bounds the orders held per paused item; beyond it orders go to the DLQ
+func NewProcessorControl(channel string, maxParked int, consumers OrderSource) *ProcessorControl {
+	pc := &ProcessorControl{
+		channel:    channel,
+		maxParked:  maxParked,
+		commands:   make(chan ControlCommand),
+		consumers:  consumers,
+		parkScript: redis.NewScript(luaSpillPushScript),
+		paused:     make(map[string]bool),
+	}
+
+	items, err := redisClient.SMembers(ctx, pausedItemsKey).Result()
+	if err != nil {
+		logger.WithError(err).Warn("Failed to load paused items")
+	}
+	for _, itemID := range items {
+		pc.paused[itemID] = true
+	}
+	if len(items) > 0 {
+		logger.WithField("paused_items", items).Info("Restored paused items")
+	}
+	return pc
+}
+
+// Commands returns the channel of commands to apply from the processing loop
+func (pc *ProcessorControl) Commands() <-chan ControlCommand {
+	return pc.commands
+}
+
+// Listen subscribes to the control channel and forwards valid commands until the
+// subscription is closed
+// Items that were resumed while their parked orders were still being released are resumed
+// again first, so the orders left by a crashed processor are processed
+func (pc *ProcessorControl) Listen() {
+	sub := redisClient.Subscribe(ctx, pc.channel)
+	defer sub.Close()
+
+	orphaned, err := redisClient.SDiff(ctx, parkedItemsKey, pausedItemsKey).Result()
+	if err != nil {
+		logger.WithError(err).Warn("Failed to load items with parked orders")
+	}
+	for _, itemID := range orphaned {
+		pc.commands <- ControlCommand{Command: CommandResumeItem, ItemID: itemID}
+	}
+
+	for msg := range sub.Channel() {
+		var cmd ControlCommand
+		if err := json.Unmarshal([]byte(msg.Payload), &cmd); err != nil {
+			logger.WithError(err).WithField("payload", msg.Payload).Warn("Ignoring malformed control command")
+			continue
+		}
+		pc.commands <- cmd
+	}
+}
+
+// Apply executes cmd; must be called from the processing goroutine
+func (pc *ProcessorControl) Apply(cmd ControlCommand) {
+	logEntry := logger.WithFields(map[string]interface{}{
+		"event":   "control_command",
+		"command": cmd.Command,
+		"item_id": cmd.ItemID,
+		"version": cmd.Version,
+	})
+
+	switch cmd.Command {
+	case CommandPauseItem, CommandResumeItem:
+		if cmd.ItemID == "" {
+			logEntry.Warn("Control command requires item_id")
+			return
+		}
+		if cmd.Command == CommandPauseItem {
+			pc.pauseItem(cmd.ItemID)
+		} else {
+			pc.resumeItem(cmd.ItemID)
+		}
+	case CommandCutoverInventory:
+		if cmd.ItemID == "" {
+			logEntry.Warn("Control command requires item_id")
+			return
+		}
+		if err := cutoverInventory(ctx, cmd.ItemID, cmd.Version); err != nil {
+			logEntry.WithError(err).Error("Inventory cutover failed")
+			return
+		}
+	case CommandDrain:
+		pc.setDraining(true)
+	case CommandResume:
+		pc.setDraining(false)
+	case CommandReloadScripts:
+		loader, ok := inventory.(interface{ ReloadScripts(context.Context) error })
+		if !ok {
+			logEntry.Warn("Inventory store has no scripts to reload")
+			return
+		}
+		if err := loader.ReloadScripts(ctx); err != nil {
+			logEntry.WithError(err).Error("Failed to reload Lua scripts")
+			return
+		}
+	default:
+		logEntry.Warn("Unknown control command")
+		return
+	}
+	logEntry.Info("Control command applied")
+}
+
+// Park holds msg if its item is paused; returns false if the order should be processed now
+// The order is in Redis when Park returns true, so its offset can be committed
+func (pc *ProcessorControl) Park(logEntry *logrus.Entry, itemID string, msg *sarama.ConsumerMessage) bool {
+	if !pc.paused[itemID] {
+		return false
+	}
+	if err := pc.push(itemID, msg); err != nil {
+		if errors.Is(err, errParkedFull) {
+			logEntry.WithField("event", "order_park_overflow").Warn("Item paused and parking limit reached, moving order to DLQ")
+		} else {
+			redisHealth.Observe(err)
+			logEntry.WithError(err).WithField("event", "order_park_failed").Error("Failed to park order, moving it to DLQ")
+		}
+		moveToDLQ(msg, "Item Paused", extractCorrelationID(msg.Headers))
+		return true
+	}
+	metrics.ParkedOrders.Inc()
+	logEntry.WithField("event", "order_parked").Info("Item paused, order parked")
+	return true
+}
+
+// push appends msg to itemID's parked list, returning errParkedFull when it is at capacity
+func (pc *ProcessorControl) push(itemID string, msg *sarama.ConsumerMessage) error {
+	parked := parkedOrder{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       msg.Key,
+		Value:     msg.Value,
+		Timestamp: msg.Timestamp,
+	}
+	for _, header := range msg.Headers {
+		parked.Headers = append(parked.Headers, spilledHeader{Key: string(header.Key), Value: header.Value})
+	}
+	data, err := json.Marshal(parked)
+	if err != nil {
+		return err
+	}
+	if err := redisClient.SAdd(ctx, parkedItemsKey, itemID).Err(); err != nil {
+		return err
+	}
+	length, err := pc.parkScript.Run(ctx, redisClient, []string{parkedOrdersKey(itemID)}, data, pc.maxParked).Int64()
+	if err != nil {
+		return err
+	}
+	if length < 0 {
+		return errParkedFull
+	}
+	return nil
+}
+
+// Run extends the idempotency and status keys of every parked order each interval until ctx is
+// done, so a retried /buy isn't accepted while the original waits for its item to be resumed
+func (pc *ProcessorControl) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		pc.refreshParked(ctx)
+	}
+}
+
+// refreshParked extends the keys of the orders in every parked list
+func (pc *ProcessorControl) refreshParked(ctx context.Context) {
+	items, err := redisClient.SMembers(ctx, parkedItemsKey).Result()
+	if err != nil {
+		redisHealth.Observe(err)
+		return
+	}
+	for _, itemID := range items {
+		entries, err := redisClient.LRange(ctx, parkedOrdersKey(itemID), 0, -1).Result()
+		if err != nil {
+			redisHealth.Observe(err)
+			return
+		}
+		_, err = redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, data := range entries {
+				var parked parkedOrder
+				if json.Unmarshal([]byte(data), &parked) != nil {
+					continue
+				}
+				if requestID := extractRequestID(parked.message().Headers); requestID != "" {
+					extendOrderKeys(pipe, requestID)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			redisHealth.Observe(err)
+			logger.WithError(err).WithFields(map[string]interface{}{
+				"event":   "parked_orders_refresh_failed",
+				"item_id": itemID,
+			}).Warn("Failed to extend the keys of parked orders")
+		}
+	}
+}
+
+func (pc *ProcessorControl) pauseItem(itemID string) {
+	pc.paused[itemID] = true
+	if err := redisClient.SAdd(ctx, pausedItemsKey, itemID).Err(); err != nil {
+		logger.WithError(err).WithField("item_id", itemID).Warn("Failed to persist paused item")
+	}
+}
+
+// resumeItem unpauses itemID and processes its parked orders in arrival order
+func (pc *ProcessorControl) resumeItem(itemID string) {
+	delete(pc.paused, itemID)
+	if err := redisClient.SRem(ctx, pausedItemsKey, itemID).Err(); err != nil {
+		logger.WithError(err).WithField("item_id", itemID).Warn("Failed to clear paused item")
+	}
+	pc.releaseParked(itemID)
+}
+
+// releaseParked processes itemID's parked orders oldest first unless another processor is
+// already releasing them; each entry is removed only after it was processed, so a crash in
+// between processes it again (deduplicated by its request_id) rather than losing it
+func (pc *ProcessorControl) releaseParked(itemID string) {
+	logEntry := logger.WithFields(map[string]interface{}{
+		"event":   "parked_orders_released",
+		"item_id": itemID,
+	})
+	lockKey := parkedReleaseLockKey(itemID)
+	acquired, err := redisClient.SetNX(ctx, lockKey, 1, parkedReleaseLockTTL).Result()
+	if err != nil || !acquired {
+		return
+	}
+	defer redisClient.Del(ctx, lockKey)
+
+	key := parkedOrdersKey(itemID)
+	released := 0
+	for {
+		data, err := redisClient.LIndex(ctx, key, 0).Bytes()
+		if err == redis.Nil {
+			redisClient.SRem(ctx, parkedItemsKey, itemID)
+			break
+		}
+		if err != nil {
+			logEntry.WithError(err).Warn("Failed to read parked orders, left for the next resume")
+			break
+		}
+		var parked parkedOrder
+		if err := json.Unmarshal(data, &parked); err != nil {
+			logEntry.WithError(err).WithField("event", "parked_order_invalid").Error("Dropping undecodable parked order")
+		} else {
+			processOrder(parked.message())
+		}
+		if err := redisClient.LPop(ctx, key).Err(); err != nil {
+			logEntry.WithError(err).Warn("Failed to remove a released parked order")
+			break
+		}
+		redisClient.Expire(ctx, lockKey, parkedReleaseLockTTL)
+		metrics.ParkedOrders.Dec()
+		released++
+	}
+	if released > 0 {
+		logEntry.WithField("released", released).Info("Released parked orders")
+	}
+}
+
+// message rebuilds the consumed order as it was parked
+func (p parkedOrder) message() *sarama.ConsumerMessage {
+	msg := &sarama.ConsumerMessage{
+		Topic:     p.Topic,
+		Partition: p.Partition,
+		Offset:    p.Offset,
+		Key:       p.Key,
+		Value:     p.Value,
+		Timestamp: p.Timestamp,
+	}
+	for _, header := range p.Headers {
+		msg.Headers = append(msg.Headers, &sarama.RecordHeader{Key: []byte(header.Key), Value: header.Value})
+	}
+	return msg
+}
+
+func (pc *ProcessorControl) setDraining(draining bool) {
+	if pc.draining == draining {
+		return
+	}
+	pc.draining = draining
+	if draining {
+		pc.consumers.Pause()
+	} else {
+		pc.consumers.Resume()
+	}
+}
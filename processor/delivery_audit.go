@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/redis/go-redis/v9"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// Redis keys of the delivery audit
+const (
+	deliveryAuditPendingKey = "delivery_audit:pending" // ZSET request_id -> first consumed (unix ms)
+	deliveryAuditStuckKey   = "delivery_audit:stuck"   // ZSET request_id -> first consumed, past the deadline without a terminal status
+	deliveryAuditLockKey    = "delivery_audit:lock"    // Held by the processor running the current check
+)
+
+// deliveryAuditGroup is the audit's own consumer group, so it sees every order whatever the
+// processors' partitioning
+const deliveryAuditGroup = "flash-sale-delivery-audit"
+
+// deliveryAuditBatchSize bounds the orders one ZSET read and status pipeline covers; a check
+// reads batches until no overdue order is left
+const deliveryAuditBatchSize = 1000
+
+// deliveryAuditTopicsRefresh is how often the audit consumer compares its topics with the
+// processor's and rejoins when they changed
+const deliveryAuditTopicsRefresh = 10 * time.Second
+
+// deliveryAuditStuckMax bounds the stuck orders kept for GET /admin/delivery-audit; the oldest go first
+const deliveryAuditStuckMax = 10000
+
+// Delivery audit results, the result label of processor_delivery_audit_orders_total
+const (
+	DeliveryAuditTerminal = "terminal" // Reached a terminal status within the deadline
+	DeliveryAuditStuck    = "stuck"    // No terminal status by the deadline
+	DeliveryAuditLate     = "late"     // A stuck order that reached a terminal status afterwards
+)
+
+// DeliveryAuditor continuously checks the at-least-once guarantee: every order consumed from
+// the orders topic must reach a terminal status (see common.IsTerminalStatus) within deadline
+// It tails every order topic in its own consumer group, noting each request_id, and a periodic
+// check on one processor at a time looks the overdue ones up in Redis (then the order store)
+type DeliveryAuditor struct {
+	client   *redis.Client
+	deadline time.Duration
+	active   atomic.Bool // In a consumer group session
+}
+
+// deliveryAuditor is nil unless DELIVERY_AUDIT_ENABLED is set
+var deliveryAuditor *DeliveryAuditor
+
+// NewDeliveryAuditor creates an auditor reporting orders without a terminal status after deadline
+func NewDeliveryAuditor(client *redis.Client, deadline time.Duration) *DeliveryAuditor {
+	return &DeliveryAuditor{client: client, deadline: deadline}
+}
+
+// Consume tails the topics returned by topics in the audit consumer group until ctx is done
+// The topics are checked every deliveryAuditTopicsRefresh, so campaign topics created or deleted
+// while running are followed by a rejoin
+func (d *DeliveryAuditor) Consume(ctx context.Context, group sarama.ConsumerGroup, topics func() []string) {
+	for ctx.Err() == nil {
+		current := topics()
+		sessionCtx, rejoin := context.WithCancel(ctx)
+		go func() {
+			ticker := time.NewTicker(deliveryAuditTopicsRefresh)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-sessionCtx.Done():
+					return
+				case <-ticker.C:
+				}
+				if !slices.Equal(topics(), current) {
+					rejoin()
+					return
+				}
+			}
+		}()
+		err := group.Consume(sessionCtx, current, d)
+		rejoin()
+		if err != nil && ctx.Err() == nil {
+			logger.WithError(err).WithField("event", "delivery_audit_consume_failed").Warn("Delivery audit consumer error, rejoining")
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+// Active reports whether the audit consumer is in a group session
+func (d *DeliveryAuditor) Active() bool {
+	return d.active.Load()
+}
+
+func (d *DeliveryAuditor) Setup(sarama.ConsumerGroupSession) error {
+	d.active.Store(true)
+	return nil
+}
+
+func (d *DeliveryAuditor) Cleanup(sarama.ConsumerGroupSession) error {
+	d.active.Store(false)
+	return nil
+}
+
+// ConsumeClaim notes each order's request_id; synthetic orders and orders without one are skipped
+// A redelivered order keeps its first consume time (ZADD NX)
+func (d *DeliveryAuditor) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			if requestID := extractRequestID(msg.Headers); requestID != "" && !isSyntheticOrder(msg) {
+				member := redis.Z{Score: float64(time.Now().UnixMilli()), Member: requestID}
+				if err := d.client.ZAddNX(session.Context(), deliveryAuditPendingKey, member).Err(); err != nil {
+					redisHealth.Observe(err)
+					logger.WithError(err).WithFields(map[string]interface{}{
+						"event":      "delivery_audit_track_failed",
+						"request_id": requestID,
+					}).Warn("Failed to track order for the delivery audit")
+				}
+			}
+			session.MarkMessage(msg, "")
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// Run checks overdue orders every interval until ctx is done
+func (d *DeliveryAuditor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		d.RunOnce(ctx, interval)
+	}
+}
+
+// RunOnce checks the orders consumed more than deadline ago unless another processor holds the
+// lock: terminal ones are dropped, the rest move to the stuck set and are reported; stuck orders
+// are re-checked so ones that finished late leave the set
+// Overdue orders are read in batches until none is left, so a check keeps up with any order rate;
+// the lock is extended after every batch
+func (d *DeliveryAuditor) RunOnce(ctx context.Context, interval time.Duration) {
+	lockTTL := interval * 9 / 10
+	acquired, err := d.client.SetNX(ctx, deliveryAuditLockKey, 1, lockTTL).Result()
+	if err != nil || !acquired {
+		return
+	}
+	cutoff := strconv.FormatInt(time.Now().Add(-d.deadline).UnixMilli(), 10)
+	for ctx.Err() == nil {
+		overdue, err := d.client.ZRangeByScoreWithScores(ctx, deliveryAuditPendingKey, &redis.ZRangeBy{
+			Min: "-inf", Max: cutoff, Count: deliveryAuditBatchSize,
+		}).Result()
+		if err != nil {
+			logger.WithError(err).WithField("event", "delivery_audit_failed").Warn("Failed to read orders pending the delivery audit")
+			return
+		}
+		if len(overdue) == 0 {
+			break
+		}
+		if err := d.checkOverdue(ctx, overdue); err != nil {
+			logger.WithError(err).WithField("event", "delivery_audit_failed").Warn("Failed to check overdue orders")
+			return
+		}
+		if len(overdue) < deliveryAuditBatchSize {
+			break
+		}
+		d.client.Expire(ctx, deliveryAuditLockKey, lockTTL)
+	}
+	d.recheckStuck(ctx)
+}
+
+// checkOverdue removes one batch of overdue orders from the pending set, moving the ones without
+// a terminal status to the stuck set
+func (d *DeliveryAuditor) checkOverdue(ctx context.Context, overdue []redis.Z) error {
+	requestIDs := make([]string, len(overdue))
+	for i, entry := range overdue {
+		requestIDs[i] = entry.Member.(string)
+	}
+	statuses, err := d.statuses(ctx, requestIDs)
+	if err != nil {
+		return err
+	}
+	var stuck []redis.Z
+	for i, entry := range overdue {
+		if !common.IsTerminalStatus(statuses[i]) {
+			stuck = append(stuck, entry)
+		}
+	}
+	_, err = d.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if len(stuck) > 0 {
+			pipe.ZAdd(ctx, deliveryAuditStuckKey, stuck...)
+		}
+		members := make([]interface{}, len(requestIDs))
+		for i, requestID := range requestIDs {
+			members[i] = requestID
+		}
+		pipe.ZRem(ctx, deliveryAuditPendingKey, members...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	metrics.DeliveryAudit.WithLabelValues(DeliveryAuditTerminal).Add(float64(len(overdue) - len(stuck)))
+	metrics.DeliveryAudit.WithLabelValues(DeliveryAuditStuck).Add(float64(len(stuck)))
+	for i, entry := range overdue {
+		if common.IsTerminalStatus(statuses[i]) {
+			continue
+		}
+		logger.WithFields(map[string]interface{}{
+			"event":       "order_not_terminal",
+			"request_id":  requestIDs[i],
+			"status":      statuses[i],
+			"consumed_at": time.UnixMilli(int64(entry.Score)).UTC().Format(time.RFC3339),
+			"deadline":    d.deadline.String(),
+		}).Error("Delivery audit: order consumed but never reached a terminal status")
+	}
+	return nil
+}
+
+// recheckStuck drops stuck orders that have since reached a terminal status and bounds the set
+func (d *DeliveryAuditor) recheckStuck(ctx context.Context) {
+	d.client.ZRemRangeByRank(ctx, deliveryAuditStuckKey, 0, -deliveryAuditStuckMax-1)
+	for start := int64(0); ctx.Err() == nil; start += deliveryAuditBatchSize {
+		stuck, err := d.client.ZRange(ctx, deliveryAuditStuckKey, start, start+deliveryAuditBatchSize-1).Result()
+		if err != nil || len(stuck) == 0 {
+			break
+		}
+		statuses, err := d.statuses(ctx, stuck)
+		if err != nil {
+			break
+		}
+		var late []interface{}
+		for i, requestID := range stuck {
+			if !common.IsTerminalStatus(statuses[i]) {
+				continue
+			}
+			late = append(late, requestID)
+			logger.WithFields(map[string]interface{}{
+				"event":      "order_terminal_late",
+				"request_id": requestID,
+				"status":     statuses[i],
+			}).Warn("Delivery audit: stuck order reached a terminal status late")
+		}
+		if len(late) > 0 {
+			if err := d.client.ZRem(ctx, deliveryAuditStuckKey, late...).Err(); err != nil {
+				break
+			}
+			metrics.DeliveryAudit.WithLabelValues(DeliveryAuditLate).Add(float64(len(late)))
+			// The removed orders shifted the rest of the set down
+			start -= int64(len(late))
+		}
+		if len(stuck) < deliveryAuditBatchSize {
+			break
+		}
+	}
+	if count, err := d.client.ZCard(ctx, deliveryAuditStuckKey).Result(); err == nil {
+		metrics.DeliveryAuditStuck.Set(float64(count))
+	}
+}
+
+// statuses returns the latest status of each request_id, read from Redis in one pipeline with
+// the order store as fallback for expired ones; "" where neither has one
+func (d *DeliveryAuditor) statuses(ctx context.Context, requestIDs []string) ([]string, error) {
+	pipe := d.client.Pipeline()
+	gets := make([]*redis.StringCmd, len(requestIDs))
+	for i, requestID := range requestIDs {
+		gets[i] = pipe.Get(ctx, common.OrderStatusKey(requestID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	statuses := make([]string, len(requestIDs))
+	for i, get := range gets {
+		status, err := get.Result()
+		switch {
+		case err == nil:
+			statuses[i] = status
+		case !errors.Is(err, redis.Nil):
+			return nil, err
+		case orderStore != nil:
+			if statuses[i], err = orderStore.Status(ctx, requestIDs[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return statuses, nil
+}
+
+// Report returns the pending count and the oldest limit stuck orders with their current status
+func (d *DeliveryAuditor) Report(ctx context.Context, limit int64) (map[string]interface{}, error) {
+	pending, err := d.client.ZCard(ctx, deliveryAuditPendingKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	stuckCount, err := d.client.ZCard(ctx, deliveryAuditStuckKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := d.client.ZRangeWithScores(ctx, deliveryAuditStuckKey, 0, limit-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	stuck := make([]map[string]interface{}, 0, len(entries))
+	requestIDs := make([]string, len(entries))
+	for i, entry := range entries {
+		requestIDs[i] = entry.Member.(string)
+	}
+	statuses, err := d.statuses(ctx, requestIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i, entry := range entries {
+		stuck = append(stuck, map[string]interface{}{
+			"request_id":  requestIDs[i],
+			"consumed_at": time.UnixMilli(int64(entry.Score)).UTC(),
+			"status":      statuses[i],
+		})
+	}
+	return map[string]interface{}{
+		"deadline":    d.deadline.String(),
+		"pending":     pending,
+		"stuck_count": stuckCount,
+		"stuck":       stuck,
+	}, nil
+}
+
+// handleAdminGetDeliveryAudit lists the oldest stuck orders with their current status
+// Query parameters: limit (default 100, max 1000)
+func handleAdminGetDeliveryAudit(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > deliveryAuditBatchSize {
+			writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 1000"})
+			return
+		}
+		limit = parsed
+	}
+	report, err := deliveryAuditor.Report(r.Context(), int64(limit))
+	if err != nil {
+		adminLog(r, "admin_delivery_audit_read").WithError(err).Error("Failed to read the delivery audit")
+		writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read the delivery audit"})
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, report)
+}
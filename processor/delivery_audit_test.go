@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// trackOrders adds n orders consumed at consumedAt to the pending set; every other one completed
+func trackOrders(t *testing.T, prefix string, n int, consumedAt time.Time) {
+	t.Helper()
+	ctx := context.Background()
+	for i := 0; i < n; i++ {
+		requestID := prefix + strconv.Itoa(i)
+		if err := redisClient.ZAddNX(ctx, deliveryAuditPendingKey, redis.Z{Score: float64(consumedAt.UnixMilli()), Member: requestID}).Err(); err != nil {
+			t.Fatalf("ZADD: %v", err)
+		}
+		if i%2 == 0 {
+			redisClient.Set(ctx, common.OrderStatusKey(requestID), common.ResultCompleted, common.OrderStatusTTL)
+		}
+	}
+}
+
+func TestDeliveryAuditChecksEveryOverdueOrder(t *testing.T) {
+	newTestRedis(t)
+	ctx := context.Background()
+	auditor := NewDeliveryAuditor(redisClient, 5*time.Minute)
+	// More overdue orders than one batch, plus recent ones that aren't due yet
+	overdue := 2*deliveryAuditBatchSize + 500
+	trackOrders(t, "old-", overdue, time.Now().Add(-10*time.Minute))
+	trackOrders(t, "new-", 10, time.Now())
+
+	auditor.RunOnce(ctx, 30*time.Second)
+
+	if pending := redisClient.ZCard(ctx, deliveryAuditPendingKey).Val(); pending != 10 {
+		t.Fatalf("pending = %d after the check, want only the 10 recent orders", pending)
+	}
+	if stuck := redisClient.ZCard(ctx, deliveryAuditStuckKey).Val(); stuck != int64(overdue/2) {
+		t.Fatalf("stuck = %d, want %d", stuck, overdue/2)
+	}
+}
+
+func TestDeliveryAuditRechecksEveryStuckOrder(t *testing.T) {
+	newTestRedis(t)
+	ctx := context.Background()
+	auditor := NewDeliveryAuditor(redisClient, 5*time.Minute)
+	stuck := deliveryAuditBatchSize + 200
+	consumedAt := float64(time.Now().Add(-time.Hour).UnixMilli())
+	for i := 0; i < stuck; i++ {
+		redisClient.ZAdd(ctx, deliveryAuditStuckKey, redis.Z{Score: consumedAt, Member: "late-" + strconv.Itoa(i)})
+	}
+	// Every other stuck order has finished since the previous check
+	for i := 0; i < stuck; i += 2 {
+		redisClient.Set(ctx, common.OrderStatusKey("late-"+strconv.Itoa(i)), common.ResultCompleted, common.OrderStatusTTL)
+	}
+
+	auditor.RunOnce(ctx, 30*time.Second)
+
+	remaining := redisClient.ZRange(ctx, deliveryAuditStuckKey, 0, -1).Val()
+	if len(remaining) != stuck/2 {
+		t.Fatalf("stuck = %d after the recheck, want %d", len(remaining), stuck/2)
+	}
+	for _, requestID := range remaining {
+		n, _ := strconv.Atoi(requestID[len("late-"):])
+		if n%2 == 0 {
+			t.Fatalf("%s finished but is still reported stuck", requestID)
+		}
+	}
+}
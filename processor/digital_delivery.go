@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/IBM/sarama"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// digitalCodesKey is the list of codes available for itemID, loaded by operators (LPUSH)
+func digitalCodesKey(itemID string) string {
+	return "digital_codes:" + itemID
+}
+
+// digitalCodesDeliveredKey is the list of codes handed out for itemID, kept for auditing
+func digitalCodesDeliveredKey(itemID string) string {
+	return "digital_codes_delivered:" + itemID
+}
+
+// digitalCodeAssignmentsKey maps request_id to the code assigned to that order
+func digitalCodeAssignmentsKey(itemID string) string {
+	return "digital_code_assignments:" + itemID
+}
+
+// digitalDeliveryPendingKey is the set of confirmed orders that got no code because the pool was empty
+func digitalDeliveryPendingKey(itemID string) string {
+	return "digital_delivery_pending:" + itemID
+}
+
+// DigitalDelivery assigns codes/licenses from preloaded Redis lists to confirmed orders of
+// digital items (DIGITAL_ITEMS)
+type DigitalDelivery struct {
+	items        map[string]bool
+	all          bool
+	lowWatermark int64
+	assignScript *redis.Script
+	pendScript   *redis.Script
+
+	mu      sync.Mutex
+	lowSeen map[string]bool // Items already warned about, so the warning fires once per crossing
+}
+
+// digital is nil unless DIGITAL_ITEMS is set
+var digital *DigitalDelivery
+
+// NewDigitalDelivery handles itemIDs ("*" for every item), warning when an item's pool drops
+// below lowWatermark codes
+func NewDigitalDelivery(itemIDs []string, lowWatermark int64) *DigitalDelivery {
+	dd := &DigitalDelivery{
+		items:        make(map[string]bool, len(itemIDs)),
+		lowWatermark: lowWatermark,
+		assignScript: redis.NewScript(luaAssignDigitalCodeScript),
+		pendScript:   redis.NewScript(luaPendDigitalDeliveryScript),
+		lowSeen:      make(map[string]bool),
+	}
+	for _, itemID := range itemIDs {
+		if itemID == "*" {
+			dd.all = true
+		}
+		dd.items[itemID] = true
+	}
+	return dd
+}
+
+// IsDigital reports whether itemID is delivered as a code
+func (dd *DigitalDelivery) IsDigital(itemID string) bool {
+	return dd.all || dd.items[itemID]
+}
+
+// Assign returns the code for requestID, assigning one if the order has none yet
+// Returns an empty code when the item's pool is exhausted
+func (dd *DigitalDelivery) Assign(ctx context.Context, itemID, requestID string) (string, int64, string, error) {
+	result, err := dd.assignScript.Run(ctx, redisClient,
+		[]string{digitalCodesKey(itemID), digitalCodesDeliveredKey(itemID), digitalCodeAssignmentsKey(itemID),
+			digitalDeliveryPendingKey(itemID)},
+		requestID).Slice()
+	if err != nil {
+		return "", 0, "", err
+	}
+	if len(result) < 3 {
+		return "", 0, "", fmt.Errorf("unexpected digital code script result: %v", result)
+	}
+	code, _ := result[0].(string)
+	remaining, _ := result[1].(int64)
+	reason, _ := result[2].(string)
+	return code, remaining, reason, nil
+}
+
+// checkWatermark logs once when itemID's pool falls below the low watermark, and again after a refill
+func (dd *DigitalDelivery) checkWatermark(logEntry *logrus.Entry, itemID string, remaining int64) {
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+	if remaining >= dd.lowWatermark {
+		delete(dd.lowSeen, itemID)
+		return
+	}
+	if dd.lowSeen[itemID] {
+		return
+	}
+	dd.lowSeen[itemID] = true
+	logEntry.WithFields(map[string]interface{}{
+		"event":           "digital_codes_low",
+		"codes_remaining": remaining,
+		"low_watermark":   dd.lowWatermark,
+	}).Warn("Digital code pool running low")
+}
+
+// deliverDigitalCode assigns a code to a confirmed order and publishes it with a DELIVERED result
+// Exhaustion doesn't undo the confirmed order: the request_id is added to the set
+// digital_delivery_pending:{item_id} for manual delivery once codes are loaded
+func deliverDigitalCode(logEntry *logrus.Entry, msg *sarama.ConsumerMessage, itemID string) {
+	requestID := extractRequestID(msg.Headers)
+	if requestID == "" {
+		// Without a request_id the assignment can't be made idempotent
+		logEntry.WithField("event", "digital_delivery_skipped").Error("Digital item order has no request_id, code not assigned")
+		return
+	}
+
+	code, remaining, reason, err := digital.Assign(ctx, itemID, requestID)
+	if err != nil {
+		redisHealth.Observe(err)
+		logEntry.WithError(err).WithField("event", "digital_delivery_failed").Error("Failed to assign digital code")
+		pendDigitalDelivery(logEntry, itemID, requestID)
+		return
+	}
+	metrics.DigitalCodesRemaining.WithLabelValues(itemID).Set(float64(remaining))
+
+	if reason == "EXHAUSTED" {
+		metrics.DigitalCodesExhausted.WithLabelValues(itemID).Inc()
+		logEntry.WithField("event", "digital_codes_exhausted").Error("Digital code pool exhausted, order pending delivery")
+		pendDigitalDelivery(logEntry, itemID, requestID)
+		return
+	}
+	digital.checkWatermark(logEntry, itemID, remaining)
+
+	publishOrderResultWithCode(logEntry, msg, itemID, code)
+	logEntry.WithFields(map[string]interface{}{
+		"event":           "digital_code_assigned",
+		"assignment":      reason,
+		"codes_remaining": remaining,
+	}).Info("Digital code delivered")
+}
+
+// pendDigitalDelivery records requestID as waiting for a code; a set, so redeliveries don't
+// repeat it, and skipped when a failed-looking Assign actually assigned a code
+func pendDigitalDelivery(logEntry *logrus.Entry, itemID, requestID string) {
+	pended, err := digital.pendScript.Run(ctx, redisClient,
+		[]string{digitalCodeAssignmentsKey(itemID), digitalDeliveryPendingKey(itemID)}, requestID).Int()
+	if err != nil {
+		logEntry.WithError(err).Error("Failed to record pending digital delivery")
+		return
+	}
+	if pended == 0 {
+		logEntry.WithField("event", "digital_delivery_already_assigned").Warn("Order already has a digital code, not marked pending")
+	}
+}
+
+// publishOrderResultWithCode publishes the DELIVERED result carrying the assigned code,
+// encrypted with the payload encryption keys so only the notifier can read it
+// Without keys the code is withheld from the result; operators look it up with
+// GET /admin/digital-codes
+func publishOrderResultWithCode(logEntry *logrus.Entry, msg *sarama.ConsumerMessage, itemID, code string) {
+	result := common.OrderResult{
+		RequestID: extractRequestID(msg.Headers),
+		ItemID:    itemID,
+		Status:    common.ResultDelivered,
+	}
+	if payloadCipher == nil {
+		logEntry.WithField("event", "digital_code_withheld").Warn("No payload encryption keys, digital code left out of the result")
+	} else if encrypted, err := payloadCipher.EncryptValue([]byte(code)); err != nil {
+		logEntry.WithError(err).WithField("event", "digital_code_withheld").Error("Failed to encrypt digital code, left out of the result")
+	} else {
+		result.DeliveryCodeEncrypted = encrypted
+	}
+	sendOrderResult(msg, result)
+}
+
+// digitalCodeStatus is the admin view of an item's code pool
+func digitalCodeStatus(ctx context.Context, itemID string) (map[string]int64, error) {
+	pipe := redisClient.Pipeline()
+	available := pipe.LLen(ctx, digitalCodesKey(itemID))
+	delivered := pipe.LLen(ctx, digitalCodesDeliveredKey(itemID))
+	pending := pipe.LLen(ctx, digitalDeliveryPendingKey(itemID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	return map[string]int64{
+		"available": available.Val(),
+		"delivered": delivered.Val(),
+		"pending":   pending.Val(),
+	}, nil
+}
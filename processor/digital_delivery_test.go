@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPendDigitalDeliveryIsIdempotentAndSkipsAssignedOrders(t *testing.T) {
+	newTestRedis(t)
+	previous := digital
+	digital = NewDigitalDelivery([]string{"101"}, 0)
+	t.Cleanup(func() { digital = previous })
+	logEntry := logger.WithField("test", true)
+	pending := digitalDeliveryPendingKey("101")
+
+	// A redelivered order that still finds the pool empty is pending once
+	pendDigitalDelivery(logEntry, "101", "req-1")
+	pendDigitalDelivery(logEntry, "101", "req-1")
+	if n := redisClient.SCard(context.Background(), pending).Val(); n != 1 {
+		t.Fatalf("pending orders = %d, want 1", n)
+	}
+
+	// Codes arrive and the redelivered order gets one: it leaves the pending set
+	redisClient.LPush(context.Background(), digitalCodesKey("101"), "CODE-1", "CODE-2")
+	if _, _, reason, err := digital.Assign(context.Background(), "101", "req-1"); err != nil || reason != "ASSIGNED" {
+		t.Fatalf("Assign = %q, %v; want ASSIGNED", reason, err)
+	}
+	if redisClient.SIsMember(context.Background(), pending, "req-1").Val() {
+		t.Fatal("assigned order is still pending")
+	}
+
+	// An Assign that timed out on the client but ran in Redis doesn't make the order pending
+	if _, _, _, err := digital.Assign(context.Background(), "101", "req-2"); err != nil {
+		t.Fatalf("Assign: %v", err)
+	}
+	pendDigitalDelivery(logEntry, "101", "req-2")
+	if redisClient.SIsMember(context.Background(), pending, "req-2").Val() {
+		t.Fatal("order with an assigned code was marked pending")
+	}
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+	orderpb "github.com/yourname/flash-sale-engine/common/proto"
+)
+
+// DLQ failure classes, decided by the error header of a DLQ message
+const (
+	DLQRetryable = "retryable" // The order may succeed on another attempt; a reservation it still holds is continued
+	DLQPermanent = "permanent" // Retrying can't help (bad payload, forged message, declined payment)
+)
+
+// dlqRetryableReasons are the DLQ reasons worth retrying; any other reason, including ones
+// unknown to this version, is permanent
+var dlqRetryableReasons = map[string]bool{
+	"Redis Failure":   true,
+	"Redis Timeout":   true,
+	"Redis OOM":       true,
+	"Item Paused":     true,
+	"Payment Timeout": true,
+}
+
+// classifyDLQReason returns the failure class of a DLQ reason
+func classifyDLQReason(reason string) string {
+	if dlqRetryableReasons[reason] {
+		return DLQRetryable
+	}
+	return DLQPermanent
+}
+
+// dlqReplayedKeyPrefix marks DLQ messages a replay already routed (dlq_replayed:{partition}:{offset}),
+// so overlapping replays don't publish an order twice
+const dlqReplayedKeyPrefix = "dlq_replayed:"
+
+// Replay outcomes of a DLQ message, the result label of processor_dlq_replay_messages_total
+const (
+	DLQReplayRepublished   = "republished"
+	DLQReplayQuarantined   = "quarantined"
+	DLQReplayAlreadyRouted = "already_routed"
+	DLQReplayFailed        = "failed"
+	dlqReplayNotMatched    = "not_matched" // Filtered out by reason, not counted
+)
+
+// headerQuarantineReason tells why a message was quarantined: permanent or max_attempts
+const headerQuarantineReason = "quarantine_reason"
+
+// QuarantineMaxAttempts quarantines a retryable order that was replayed DLQ_REPLAY_MAX_ATTEMPTS times
+const QuarantineMaxAttempts = "max_attempts"
+
+// QuarantineUnauthenticated quarantines a DLQ message whose original signature doesn't verify,
+// so a message written straight to the DLQ is never signed by a replay
+const QuarantineUnauthenticated = "unauthenticated"
+
+// headerDLQSourceTopic names the topic a DLQ message was consumed from, the topic its signature covers
+const headerDLQSourceTopic = "source_topic"
+
+// defaultReplayMaxMessages bounds the DLQ messages one replay request reads
+const defaultReplayMaxMessages = 10000
+
+// errReplayRunning is returned when a replay is requested while another is in progress
+var errReplayRunning = errors.New("a DLQ replay is already running")
+
+// DLQReplayRequest selects the DLQ messages a replay routes
+type DLQReplayRequest struct {
+	Reason      string    `json:"reason,omitempty"` // Only messages with this error header; empty for all
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	DryRun      bool      `json:"dry_run"`
+	MaxMessages int       `json:"max_messages"`
+}
+
+// DLQReplaySummary reports the outcome of a DLQ replay
+type DLQReplaySummary struct {
+	DLQReplayRequest
+	StartedAt     time.Time      `json:"started_at"`
+	Partitions    []ReplayRange  `json:"partitions"`
+	Messages      int            `json:"messages"`       // Read from the DLQ
+	Matched       int            `json:"matched"`        // Matching the reason filter
+	Republished   int            `json:"republished"`    // Sent back to their orders topic (dry run: would be)
+	Quarantined   int            `json:"quarantined"`    // Sent to orders-quarantine (dry run: would be)
+	AlreadyRouted int            `json:"already_routed"` // Routed by an earlier replay, skipped
+	Failed        int            `json:"failed"`         // Publish or marker errors; rerun the replay to retry them
+	ByReason      map[string]int `json:"by_reason"`
+	Truncated     bool           `json:"truncated"` // Stopped at max_messages; rerun from the last offset
+	DurationMs    int64          `json:"duration_ms"`
+}
+
+// DLQReplayer re-publishes retryable DLQ orders to their orders topic and moves permanently
+// failed ones to the quarantine topic, on request from the admin API
+// A replayed order carries a replay_attempt counter; once it reaches maxAttempts the order is
+// quarantined instead of being retried again
+type DLQReplayer struct {
+	client      sarama.Client
+	maxAttempts int
+	running     sync.Mutex
+
+	mu   sync.Mutex
+	last *DLQReplaySummary
+}
+
+// NewDLQReplayer creates a replayer reading the DLQ through client
+func NewDLQReplayer(client sarama.Client, maxAttempts int) *DLQReplayer {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &DLQReplayer{client: client, maxAttempts: maxAttempts}
+}
+
+// Last returns the summary of the most recent replay, nil if none ran since startup
+func (d *DLQReplayer) Last() *DLQReplaySummary {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.last
+}
+
+// Replay routes the DLQ messages published in [req.From, req.To)
+// Only one replay runs at a time; ctx cancellation stops it between messages
+func (d *DLQReplayer) Replay(ctx context.Context, req DLQReplayRequest) (*DLQReplaySummary, error) {
+	if !d.running.TryLock() {
+		return nil, errReplayRunning
+	}
+	defer d.running.Unlock()
+	// Replayed orders must pass the processor's signature check like any other order
+	if signer != nil && !signer.CanSign() && !req.DryRun {
+		return nil, errors.New("order signature verification is on: set MESSAGE_SIGNING_KEY_ID so replayed orders can be signed")
+	}
+
+	summary := &DLQReplaySummary{DLQReplayRequest: req, StartedAt: time.Now().UTC(), ByReason: map[string]int{}}
+	ranges, err := replayRanges(d.client, ReplayOptions{Topic: common.TopicOrdersDLQ, From: req.From, To: req.To})
+	if err != nil {
+		return nil, err
+	}
+	summary.Partitions = ranges
+	// A consumer of its own, like campaign exports
+	consumer, err := sarama.NewConsumerFromClient(d.client)
+	if err != nil {
+		return nil, err
+	}
+	defer consumer.Close()
+
+	for i := range ranges {
+		if err := d.replayPartition(ctx, consumer, &ranges[i], summary); err != nil {
+			return nil, err
+		}
+		if summary.Truncated || ctx.Err() != nil {
+			break
+		}
+	}
+	summary.DurationMs = time.Since(summary.StartedAt).Milliseconds()
+	if !req.DryRun {
+		d.mu.Lock()
+		d.last = summary
+		d.mu.Unlock()
+	}
+	return summary, ctx.Err()
+}
+
+func (d *DLQReplayer) replayPartition(ctx context.Context, consumer sarama.Consumer, r *ReplayRange, summary *DLQReplaySummary) error {
+	pc, err := consumer.ConsumePartition(common.TopicOrdersDLQ, r.Partition, r.From)
+	if err != nil {
+		return fmt.Errorf("partition %d: %w", r.Partition, err)
+	}
+	defer pc.Close()
+	for msg := nextReplayMessage(ctx, pc, r); msg != nil; msg = nextReplayMessage(ctx, pc, r) {
+		if summary.Messages >= summary.MaxMessages {
+			summary.Truncated = true
+			return nil
+		}
+		summary.Messages++
+		result := d.route(ctx, msg, summary)
+		if result != dlqReplayNotMatched && !summary.DryRun {
+			metrics.DLQReplayed.WithLabelValues(result).Inc()
+		}
+		switch result {
+		case DLQReplayRepublished:
+			summary.Republished++
+		case DLQReplayQuarantined:
+			summary.Quarantined++
+		case DLQReplayAlreadyRouted:
+			summary.AlreadyRouted++
+		case DLQReplayFailed:
+			summary.Failed++
+		}
+	}
+	logger.WithFields(logrus.Fields{
+		"event":          "dlq_replay_partition_done",
+		"partition":      r.Partition,
+		"from_offset":    r.From,
+		"to_offset":      r.To,
+		"read_to_offset": r.ReadTo,
+		"stopped":        r.Stopped,
+		"dry_run":        summary.DryRun,
+	}).Info("Replayed DLQ partition")
+	return nil
+}
+
+// route sends one DLQ message back to the orders topic or to quarantine and returns the outcome
+func (d *DLQReplayer) route(ctx context.Context, msg *sarama.ConsumerMessage, summary *DLQReplaySummary) string {
+	reason := extractHeader(msg.Headers, "error")
+	if summary.Reason != "" && reason != summary.Reason {
+		return dlqReplayNotMatched
+	}
+	summary.Matched++
+	summary.ByReason[reason]++
+	attempts, _ := strconv.Atoi(extractHeader(msg.Headers, common.HeaderReplayAttempt))
+	logEntry := common.WithEvent(extractCorrelationID(msg.Headers), "dlq_replay").WithFields(logrus.Fields{
+		"request_id":      extractRequestID(msg.Headers),
+		"reason":          reason,
+		"replay_attempt":  attempts,
+		"kafka_partition": msg.Partition,
+		"kafka_offset":    msg.Offset,
+	})
+
+	quarantineReason := ""
+	var order OrderRequest
+	switch {
+	case classifyDLQReason(reason) == DLQPermanent:
+		quarantineReason = DLQPermanent
+	case !verifyDLQOrigin(msg):
+		quarantineReason = QuarantineUnauthenticated
+	case attempts >= d.maxAttempts:
+		quarantineReason = QuarantineMaxAttempts
+	default:
+		// A replayed order must still decode, and copies without the original key (written before
+		// the DLQ kept it) are keyed by the payload's item
+		payload, err := decryptOrderPayload(msg)
+		if err == nil {
+			order, err = decodeOrder(msg, payload)
+		}
+		if err != nil || order.ItemID == "" {
+			quarantineReason = DLQPermanent
+		}
+	}
+	if summary.DryRun {
+		if quarantineReason != "" {
+			return DLQReplayQuarantined
+		}
+		return DLQReplayRepublished
+	}
+
+	marker := dlqReplayedKeyPrefix + strconv.FormatInt(int64(msg.Partition), 10) + ":" + strconv.FormatInt(msg.Offset, 10)
+	first, err := redisClient.SetNX(ctx, marker, time.Now().UTC().Format(time.RFC3339Nano), processedOrderTTL).Result()
+	if err != nil {
+		redisHealth.Observe(err)
+		logEntry.WithError(err).Error("Failed to mark DLQ message replayed")
+		return DLQReplayFailed
+	}
+	if !first {
+		return DLQReplayAlreadyRouted
+	}
+
+	var out *sarama.ProducerMessage
+	if quarantineReason != "" {
+		out = &sarama.ProducerMessage{
+			Topic: common.TopicOrdersQuarantine,
+			Value: sarama.ByteEncoder(msg.Value),
+		}
+		for _, header := range msg.Headers {
+			out.Headers = append(out.Headers, *header)
+		}
+		out.Headers = append(out.Headers, sarama.RecordHeader{Key: []byte(headerQuarantineReason), Value: []byte(quarantineReason)})
+	} else {
+		key := sarama.Encoder(sarama.StringEncoder(order.ItemID))
+		if len(msg.Key) > 0 {
+			key = sarama.ByteEncoder(msg.Key)
+		}
+		out = &sarama.ProducerMessage{
+			Topic: d.replayTopic(msg),
+			Key:   key,
+			Value: sarama.ByteEncoder(msg.Value),
+			Headers: []sarama.RecordHeader{
+				{Key: []byte(common.HeaderReplayAttempt), Value: []byte(strconv.Itoa(attempts + 1))},
+			},
+		}
+		for _, header := range msg.Headers {
+			switch string(header.Key) {
+			case "request_id", "correlation_id", common.HeaderItemID, common.HeaderEncryption, common.HeaderEncryptionKeyID, common.HeaderEncryptedDEK, common.HeaderCampaign, orderpb.HeaderContentType:
+				out.Headers = append(out.Headers, *header)
+			}
+		}
+		if signer != nil {
+			if err := signer.SignMessage(out); err != nil {
+				redisClient.Del(ctx, marker)
+				logEntry.WithError(err).Error("Failed to sign replayed order")
+				return DLQReplayFailed
+			}
+		}
+		// The DLQ move told the buyer the order failed: reopen its status before the order can
+		// produce a new result, so that result isn't overwritten
+		sendOrderResult(msg, common.OrderResult{
+			RequestID: extractRequestID(msg.Headers),
+			ItemID:    order.ItemID,
+			Status:    common.ResultRetrying,
+			Reason:    reason,
+		})
+	}
+	if _, _, err := producer.SendMessage(out); err != nil {
+		redisClient.Del(ctx, marker)
+		logEntry.WithError(err).WithField("topic", out.Topic).Error("Failed to route DLQ message")
+		if quarantineReason == "" {
+			// Still in the DLQ: restore the failure (the notifier already sent it)
+			publishOrderResult(msg, order.ItemID, dlqResultStatus(reason), reason)
+		}
+		return DLQReplayFailed
+	}
+	if quarantineReason != "" {
+		logEntry.WithFields(logrus.Fields{
+			"event":             "dlq_message_quarantined",
+			"quarantine_reason": quarantineReason,
+		}).Warn("DLQ message quarantined")
+		return DLQReplayQuarantined
+	}
+	logEntry.WithField("event", "dlq_order_republished").Info("DLQ order republished for another attempt")
+	return DLQReplayRepublished
+}
+
+// replayTopic returns the orders topic a replayed order goes back to: the topic it failed on, or
+// for orders that failed on a retry topic, their campaign topic
+// Falls back to the shared orders topic for copies without a source topic and for campaign
+// topics that no longer exist
+func (d *DLQReplayer) replayTopic(msg *sarama.ConsumerMessage) string {
+	topic := extractHeader(msg.Headers, headerDLQSourceTopic)
+	if topic != common.TopicOrders && !common.IsCampaignTopic(topic) {
+		topic = common.TopicOrders
+		if campaign := extractHeader(msg.Headers, common.HeaderCampaign); campaign != "" {
+			topic = common.CampaignTopicName(campaign)
+		}
+	}
+	if topic == common.TopicOrders {
+		return topic
+	}
+	topics, err := d.client.Topics()
+	if err == nil && slices.Contains(topics, topic) {
+		return topic
+	}
+	return common.TopicOrders
+}
+
+// verifyDLQOrigin reports whether msg carries the signature of the order it was copied from
+// The signature covers the source topic and key, so the original message is rebuilt from the DLQ
+// copy; copies written before the source topic header existed are checked against the orders topic
+func verifyDLQOrigin(msg *sarama.ConsumerMessage) bool {
+	if signer == nil {
+		return true
+	}
+	topic := extractHeader(msg.Headers, headerDLQSourceTopic)
+	if topic == "" {
+		topic = common.TopicOrders
+	}
+	original := &sarama.ConsumerMessage{Topic: topic, Key: msg.Key, Value: msg.Value, Headers: msg.Headers}
+	return signer.VerifyMessage(original) == nil
+}
+
+// extractHeader returns the value of the first header named key, empty if absent
+func extractHeader(headers []*sarama.RecordHeader, key string) string {
+	for _, header := range headers {
+		if string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+// dlqReplayer serves the DLQ replay endpoints; nil until the admin API is enabled
+var dlqReplayer *DLQReplayer
+
+// handleAdminReplayDLQ routes the DLQ messages of a time range and/or reason
+// Body: {"reason": "Redis OOM", "from": RFC 3339, "to": RFC 3339, "dry_run": true, "max_messages": 10000}
+// from defaults to the start of the DLQ and to to now; the replay runs before the response is written
+func handleAdminReplayDLQ(w http.ResponseWriter, r *http.Request) {
+	var req DLQReplayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "body must be {\"reason\": string, \"from\": time, \"to\": time, \"dry_run\": bool, \"max_messages\": int}"})
+		return
+	}
+	if req.From.IsZero() {
+		req.From = time.UnixMilli(0)
+	}
+	if req.To.IsZero() {
+		req.To = time.Now()
+	}
+	if !req.From.Before(req.To) {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "from must be before to"})
+		return
+	}
+	if req.MaxMessages <= 0 {
+		req.MaxMessages = defaultReplayMaxMessages
+	}
+	logEntry := adminLog(r, "admin_dlq_replay").WithFields(logrus.Fields{
+		"reason":  req.Reason,
+		"from":    req.From.UTC(),
+		"to":      req.To.UTC(),
+		"dry_run": req.DryRun,
+	})
+	summary, err := dlqReplayer.Replay(r.Context(), req)
+	if errors.Is(err, errReplayRunning) {
+		writeAdminJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return
+	}
+	if summary == nil {
+		logEntry.WithError(err).Error("DLQ replay failed")
+		writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "DLQ replay failed: " + err.Error()})
+		return
+	}
+	if !req.DryRun {
+		recordAdminAction(r, "replay_dlq", "", nil, summary)
+	}
+	logEntry.WithFields(logrus.Fields{
+		"messages":    summary.Messages,
+		"republished": summary.Republished,
+		"quarantined": summary.Quarantined,
+		"failed":      summary.Failed,
+		"truncated":   summary.Truncated,
+	}).Info("DLQ replay completed")
+	writeAdminJSON(w, http.StatusOK, summary)
+}
+
+// handleAdminGetDLQReplay returns the last replay that routed messages and the failure classes
+func handleAdminGetDLQReplay(w http.ResponseWriter, r *http.Request) {
+	retryable := make([]string, 0, len(dlqRetryableReasons))
+	for reason := range dlqRetryableReasons {
+		retryable = append(retryable, reason)
+	}
+	sort.Strings(retryable)
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{
+		"last_replay":       dlqReplayer.Last(),
+		"retryable_reasons": retryable,
+		"max_attempts":      dlqReplayer.maxAttempts,
+	})
+}
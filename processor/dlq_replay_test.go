@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// dlqCopy turns a signed order into the consumer view of its DLQ copy, as sendToDLQ writes it
+func dlqCopy(t *testing.T, order *sarama.ProducerMessage) *sarama.ConsumerMessage {
+	t.Helper()
+	key, _ := order.Key.Encode()
+	value, _ := order.Value.Encode()
+	msg := &sarama.ConsumerMessage{Topic: common.TopicOrdersDLQ, Key: key, Value: value}
+	msg.Headers = append(msg.Headers,
+		&sarama.RecordHeader{Key: []byte("error"), Value: []byte("Redis Failure")},
+		&sarama.RecordHeader{Key: []byte(headerDLQSourceTopic), Value: []byte(order.Topic)},
+	)
+	for i := range order.Headers {
+		msg.Headers = append(msg.Headers, &order.Headers[i])
+	}
+	return msg
+}
+
+func TestVerifyDLQOrigin(t *testing.T) {
+	var err error
+	signer, err = common.NewMessageSigner(map[string]string{"k1": "0123456789abcdef0123456789abcdef"}, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { signer = nil }()
+
+	signed := func(topic string) *sarama.ProducerMessage {
+		msg := &sarama.ProducerMessage{
+			Topic: topic,
+			Key:   sarama.StringEncoder("item-1"),
+			Value: sarama.StringEncoder(`{"user_id":"u1","item_id":"item-1"}`),
+			Headers: []sarama.RecordHeader{
+				{Key: []byte("correlation_id"), Value: []byte("c1")},
+				{Key: []byte("request_id"), Value: []byte("r1")},
+				{Key: []byte("accepted_at"), Value: []byte("2026-10-16T09:00:00Z")},
+			},
+		}
+		if err := signer.SignMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	if !verifyDLQOrigin(dlqCopy(t, signed(common.TopicOrders))) {
+		t.Error("DLQ copy of a signed order should verify")
+	}
+	if !verifyDLQOrigin(dlqCopy(t, signed("orders-retry-1"))) {
+		t.Error("DLQ copy of a re-signed retry should verify against its source topic")
+	}
+
+	forged := dlqCopy(t, &sarama.ProducerMessage{
+		Topic: common.TopicOrders,
+		Key:   sarama.StringEncoder("item-1"),
+		Value: sarama.StringEncoder(`{"user_id":"u1","item_id":"item-1"}`),
+	})
+	if verifyDLQOrigin(forged) {
+		t.Error("unsigned DLQ message should not verify")
+	}
+
+	tampered := dlqCopy(t, signed(common.TopicOrders))
+	tampered.Value = []byte(`{"user_id":"u2","item_id":"item-1"}`)
+	if verifyDLQOrigin(tampered) {
+		t.Error("DLQ message with a changed payload should not verify")
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/redis/go-redis/v9"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// dlqSpillKey is the Redis list of DLQ messages whose publish failed, oldest first
+const dlqSpillKey = "dlq:spill"
+
+// dlqSpillLockKey is held by the processor republishing the spill, so entries go out once and in order
+const dlqSpillLockKey = "dlq:spill:lock"
+
+// errDLQSpillFull is returned when the spill already holds DLQ_SPILL_MAX messages
+var errDLQSpillFull = errors.New("DLQ spill full")
+
+// spilledHeader is a Kafka header kept in order, values as sent
+type spilledHeader struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// spilledMessage is the persisted form of a DLQ message waiting for Kafka
+type spilledMessage struct {
+	Topic     string          `json:"topic"`
+	Value     []byte          `json:"value"`
+	Headers   []spilledHeader `json:"headers"`
+	SpilledAt time.Time       `json:"spilled_at"`
+}
+
+// DLQSpill keeps DLQ messages that couldn't be published in Redis and republishes them once
+// Kafka is back, so an order that failed while Kafka was down still reaches the DLQ
+type DLQSpill struct {
+	client     *redis.Client
+	pushScript *redis.Script
+	capacity   int64
+}
+
+// dlqSpill is always set; its capacity is DLQ_SPILL_MAX
+var dlqSpill *DLQSpill
+
+// NewDLQSpill creates a spill holding at most capacity messages
+func NewDLQSpill(client *redis.Client, capacity int64) *DLQSpill {
+	return &DLQSpill{client: client, pushScript: redis.NewScript(luaSpillPushScript), capacity: capacity}
+}
+
+// Spill appends msg to the spill, returning errDLQSpillFull when it is at capacity
+func (s *DLQSpill) Spill(ctx context.Context, msg *sarama.ProducerMessage) error {
+	spilled := spilledMessage{Topic: msg.Topic, SpilledAt: time.Now().UTC()}
+	value, err := msg.Value.Encode()
+	if err != nil {
+		return err
+	}
+	spilled.Value = value
+	for _, header := range msg.Headers {
+		spilled.Headers = append(spilled.Headers, spilledHeader{Key: string(header.Key), Value: header.Value})
+	}
+	data, err := json.Marshal(spilled)
+	if err != nil {
+		return err
+	}
+	length, err := s.pushScript.Run(ctx, s.client, []string{dlqSpillKey}, data, s.capacity).Int64()
+	if err != nil {
+		return err
+	}
+	if length < 0 {
+		return errDLQSpillFull
+	}
+	return nil
+}
+
+// Run republishes the spill every interval until ctx is done
+func (s *DLQSpill) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.RunOnce(ctx, interval)
+	}
+}
+
+// RunOnce republishes spilled messages oldest first unless another processor holds the lock,
+// stopping at the first failed send; each entry is removed only after Kafka acknowledged it,
+// so a crash in between publishes it twice rather than losing it
+func (s *DLQSpill) RunOnce(ctx context.Context, interval time.Duration) {
+	pending, err := s.client.LLen(ctx, dlqSpillKey).Result()
+	if err != nil {
+		redisHealth.Observe(err)
+		return
+	}
+	metrics.DLQSpillPending.Set(float64(pending))
+	if pending == 0 {
+		return
+	}
+	acquired, err := s.client.SetNX(ctx, dlqSpillLockKey, 1, interval*9/10).Result()
+	if err != nil || !acquired {
+		return
+	}
+
+	var republished int64
+	for ; republished < pending; republished++ {
+		data, err := s.client.LIndex(ctx, dlqSpillKey, 0).Bytes()
+		if err == redis.Nil {
+			break
+		}
+		if err != nil {
+			logger.WithError(err).WithField("event", "dlq_spill_republish_failed").Warn("Failed to read the DLQ spill")
+			break
+		}
+		var spilled spilledMessage
+		if err := json.Unmarshal(data, &spilled); err != nil {
+			// Never publishable: drop it so it doesn't block the spill
+			metrics.DLQSpilled.WithLabelValues("lost").Inc()
+			logger.WithError(err).WithField("event", "dlq_spill_invalid").Error("Dropping undecodable DLQ spill entry")
+			s.client.LPop(ctx, dlqSpillKey)
+			continue
+		}
+		msg := &sarama.ProducerMessage{Topic: spilled.Topic, Value: sarama.ByteEncoder(spilled.Value)}
+		for _, header := range spilled.Headers {
+			msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(header.Key), Value: header.Value})
+		}
+		if _, _, err := producer.SendMessage(msg); err != nil {
+			logger.WithError(err).WithFields(map[string]interface{}{
+				"event":   "dlq_spill_republish_failed",
+				"pending": pending - republished,
+			}).Warn("Kafka still unavailable, DLQ spill kept")
+			break
+		}
+		if err := s.client.LPop(ctx, dlqSpillKey).Err(); err != nil {
+			logger.WithError(err).WithField("event", "dlq_spill_republish_failed").Warn("Failed to remove a republished DLQ spill entry")
+			break
+		}
+		metrics.DLQSpilled.WithLabelValues("republished").Inc()
+	}
+	metrics.DLQSpillPending.Set(float64(pending - republished))
+	if republished > 0 {
+		logger.WithFields(map[string]interface{}{
+			"event":       "dlq_spill_republished",
+			"republished": republished,
+			"pending":     pending - republished,
+		}).Info("Republished spilled DLQ messages")
+	}
+}
+
+// spillDLQMessage keeps dlqMsg after its publish failed with sendErr
+// If the spill fails too, the order's source position is logged so it can be recovered from
+// the orders topic; nothing is dropped without an error log and the lost count
+func spillDLQMessage(dlqMsg *sarama.ProducerMessage, msg *sarama.ConsumerMessage, correlationID string, sendErr error) {
+	logEntry := common.WithCorrelationID(correlationID).WithFields(map[string]interface{}{
+		"topic":     msg.Topic,
+		"partition": msg.Partition,
+		"offset":    msg.Offset,
+	})
+	err := dlqSpill.Spill(ctx, dlqMsg)
+	if err != nil {
+		if !errors.Is(err, errDLQSpillFull) {
+			redisHealth.Observe(err)
+		}
+		metrics.DLQSpilled.WithLabelValues("lost").Inc()
+		logEntry.WithError(err).WithFields(map[string]interface{}{
+			"event":      "dlq_message_lost",
+			"send_error": sendErr.Error(),
+		}).Error("DLQ publish and spill both failed, recover the order from its source offset")
+		return
+	}
+	metrics.DLQSpilled.WithLabelValues("spilled").Inc()
+	logEntry.WithError(sendErr).WithField("event", "dlq_message_spilled").Warn("DLQ publish failed, message spilled to Redis for republishing")
+}
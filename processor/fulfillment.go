@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// Fulfillment delivery modes (FULFILLMENT_MODE)
+const (
+	FulfillmentOff     = "off"
+	FulfillmentKafka   = "kafka"   // Publish to the fulfillment topic
+	FulfillmentWebhook = "webhook" // POST to FULFILLMENT_WEBHOOK_URL with retries
+)
+
+// fulfillmentFailedKey holds webhook events that exhausted their retries, for replay
+const fulfillmentFailedKey = "fulfillment:failed"
+
+// FulfillmentPublisher hands confirmed orders to fulfillment systems
+// Webhook deliveries run on a background worker so a slow warehouse endpoint never stalls
+// order processing; events that can't be delivered are kept in Redis (fulfillment:failed)
+type FulfillmentPublisher struct {
+	mode       string
+	webhookURL string
+	client     *http.Client
+	retries    int
+	backoff    time.Duration
+	queue      chan common.FulfillmentEvent
+	done       chan struct{}
+}
+
+// fulfillment is nil when FULFILLMENT_MODE is off
+var fulfillment *FulfillmentPublisher
+
+// NewFulfillmentPublisher creates a publisher for mode; webhook mode starts the delivery worker
+// retries is the number of attempts after the first, with exponential backoff starting at 500ms
+func NewFulfillmentPublisher(mode, webhookURL string, client *http.Client, retries, queueSize int) (*FulfillmentPublisher, error) {
+	fp := &FulfillmentPublisher{mode: mode}
+	switch mode {
+	case FulfillmentKafka:
+	case FulfillmentWebhook:
+		if webhookURL == "" {
+			return nil, fmt.Errorf("FULFILLMENT_WEBHOOK_URL is required in %s mode", mode)
+		}
+		fp.webhookURL = webhookURL
+		fp.client = client
+		fp.retries = retries
+		fp.backoff = 500 * time.Millisecond
+		fp.queue = make(chan common.FulfillmentEvent, queueSize)
+		fp.done = make(chan struct{})
+		go fp.run()
+	default:
+		return nil, fmt.Errorf("unknown fulfillment mode %q", mode)
+	}
+	return fp, nil
+}
+
+// Mode returns the delivery mode
+func (fp *FulfillmentPublisher) Mode() string {
+	return fp.mode
+}
+
+// Publish delivers event (Kafka) or queues it for the webhook worker
+func (fp *FulfillmentPublisher) Publish(logEntry *logrus.Entry, event common.FulfillmentEvent) {
+	if fp.mode == FulfillmentKafka {
+		msg, err := common.NewFulfillmentMessage(event)
+		if err == nil {
+			_, _, err = producer.SendMessage(msg)
+		}
+		if err != nil {
+			metrics.FulfillmentEvents.WithLabelValues("failed").Inc()
+			logEntry.WithError(err).WithField("event", "fulfillment_publish_failed").Error("Failed to publish fulfillment event")
+			return
+		}
+		metrics.FulfillmentEvents.WithLabelValues("published").Inc()
+		return
+	}
+
+	select {
+	case fp.queue <- event:
+	default:
+		// Worker is behind: park the event for replay rather than blocking the partition
+		logEntry.WithField("event", "fulfillment_queue_full").Warn("Fulfillment queue full, storing event for replay")
+		fp.storeFailed(event, fmt.Errorf("queue full"))
+	}
+}
+
+// Close stops accepting events and waits for queued webhook deliveries until ctx expires
+func (fp *FulfillmentPublisher) Close(ctx context.Context) {
+	if fp.queue == nil {
+		return
+	}
+	close(fp.queue)
+	select {
+	case <-fp.done:
+	case <-ctx.Done():
+		logger.WithField("pending", len(fp.queue)).Warn("Fulfillment worker did not drain before shutdown")
+	}
+}
+
+func (fp *FulfillmentPublisher) run() {
+	defer close(fp.done)
+	for event := range fp.queue {
+		if err := fp.deliver(event); err != nil {
+			fp.storeFailed(event, err)
+			continue
+		}
+		metrics.FulfillmentEvents.WithLabelValues("published").Inc()
+	}
+}
+
+// deliver POSTs event to the webhook, retrying failures and 5xx/429 responses
+func (fp *FulfillmentPublisher) deliver(event common.FulfillmentEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	backoff := fp.backoff
+	for attempt := 0; ; attempt++ {
+		err = fp.post(body, event.EventID)
+		if err == nil || attempt >= fp.retries {
+			return err
+		}
+		if permanent, ok := err.(permanentError); ok {
+			return permanent.err
+		}
+		metrics.FulfillmentEvents.WithLabelValues("retried").Inc()
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// permanentError marks webhook responses that retrying can't fix (4xx other than 429)
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+
+func (fp *FulfillmentPublisher) post(body []byte, eventID string) error {
+	req, err := http.NewRequest(http.MethodPost, fp.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", eventID)
+	resp, err := fp.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("fulfillment webhook returned %s", resp.Status)
+	default:
+		return permanentError{fmt.Errorf("fulfillment webhook rejected event: %s", resp.Status)}
+	}
+}
+
+// storeFailed keeps an undeliverable event in Redis so it can be replayed
+func (fp *FulfillmentPublisher) storeFailed(event common.FulfillmentEvent, cause error) {
+	metrics.FulfillmentEvents.WithLabelValues("failed").Inc()
+	logEntry := logger.WithError(cause).WithFields(map[string]interface{}{
+		"event":      "fulfillment_delivery_failed",
+		"request_id": event.RequestID,
+		"item_id":    event.ItemID,
+	})
+	logEntry.Error("Fulfillment delivery failed")
+	payload, _ := json.Marshal(event)
+	if err := redisClient.RPush(ctx, fulfillmentFailedKey, payload).Err(); err != nil {
+		logEntry.WithError(err).WithField("payload", string(payload)).Error("Failed to store undelivered fulfillment event")
+	}
+}
+
+// publishFulfillment sends a confirmed order to the fulfillment systems, if enabled
+func publishFulfillment(logEntry *logrus.Entry, msg *sarama.ConsumerMessage, order *OrderRequest) {
+	requestID := extractRequestID(msg.Headers)
+	publishFulfillmentEvent(logEntry, order, requestID, requestID)
+}
+
+// publishFulfillmentEvent sends order's fulfillment event under eventID, if enabled
+// Each line of a cart order is its own event (see cart.go)
+func publishFulfillmentEvent(logEntry *logrus.Entry, order *OrderRequest, requestID, eventID string) {
+	if fulfillment == nil {
+		return
+	}
+	fulfillment.Publish(logEntry, common.FulfillmentEvent{
+		SchemaVersion:   common.FulfillmentSchemaVersion,
+		EventID:         eventID,
+		RequestID:       requestID,
+		UserID:          order.UserID,
+		RecipientUserID: order.RecipientUserID,
+		ItemID:          order.ItemID,
+		Quantity:        order.Amount,
+		Channel:         order.Channel,
+		ConfirmedAt:     time.Now().UTC(),
+		Metadata:        order.Metadata,
+		Address:         order.Address,
+	})
+}
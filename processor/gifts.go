@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// giftKey is the hash recording a confirmed gift order
+func giftKey(requestID string) string {
+	return "gift:" + requestID
+}
+
+// giftsSentKey indexes the gift orders bought by userID, scored by confirmation time (unix ms)
+func giftsSentKey(userID string) string {
+	return "gifts_sent:" + userID
+}
+
+// giftsReceivedKey indexes the gift orders entitling userID, scored by confirmation time (unix ms)
+func giftsReceivedKey(userID string) string {
+	return "gifts_received:" + userID
+}
+
+// GiftRecord is a confirmed order bought by one user for another
+type GiftRecord struct {
+	RequestID       string    `json:"request_id"`
+	BuyerUserID     string    `json:"buyer_user_id"`
+	RecipientUserID string    `json:"recipient_user_id"`
+	ItemID          string    `json:"item_id"`
+	Quantity        int64     `json:"quantity"`
+	Channel         string    `json:"channel"`
+	ConfirmedAt     time.Time `json:"confirmed_at"`
+}
+
+// recordGift stores a confirmed gift order and indexes it under the buyer and the recipient
+// The order is already confirmed, so a failed write is logged with the full record rather than retried
+func recordGift(logEntry *logrus.Entry, msg *sarama.ConsumerMessage, order *OrderRequest) {
+	confirmedAt := time.Now().UTC()
+	requestID := extractRequestID(msg.Headers)
+	values := map[string]interface{}{
+		"buyer_user_id":     order.UserID,
+		"recipient_user_id": order.RecipientUserID,
+		"item_id":           order.ItemID,
+		"quantity":          order.Amount,
+		"channel":           order.Channel,
+		"confirmed_at":      confirmedAt.Format(time.RFC3339Nano),
+	}
+
+	_, err := redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, giftKey(requestID), values)
+		member := redis.Z{Score: float64(confirmedAt.UnixMilli()), Member: requestID}
+		pipe.ZAdd(ctx, giftsSentKey(order.UserID), member)
+		pipe.ZAdd(ctx, giftsReceivedKey(order.RecipientUserID), member)
+		return nil
+	})
+	if err != nil {
+		redisHealth.Observe(err)
+		logEntry.WithError(err).WithFields(values).WithField("event", "gift_record_failed").Error("Failed to record gift order")
+		return
+	}
+	logEntry.WithField("event", "gift_confirmed").Info("Gift order confirmed for recipient")
+}
+
+// handleAdminGetGifts lists a user's gift orders, newest first
+// Query parameters: user_id (required), direction (received, the default, or sent) and count
+// (default 100, max 1000)
+func handleAdminGetGifts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	userID := query.Get("user_id")
+	if userID == "" {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "user_id is required"})
+		return
+	}
+	indexKey := giftsReceivedKey(userID)
+	switch query.Get("direction") {
+	case "", "received":
+	case "sent":
+		indexKey = giftsSentKey(userID)
+	default:
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "direction must be received or sent"})
+		return
+	}
+	count := int64(100)
+	if value := query.Get("count"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 1 || parsed > 1000 {
+			writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "count must be between 1 and 1000"})
+			return
+		}
+		count = parsed
+	}
+
+	requestIDs, err := redisClient.ZRevRange(r.Context(), indexKey, 0, count-1).Result()
+	if err != nil {
+		adminLog(r, "admin_gifts_read").WithError(err).Error("Failed to read gift index")
+		writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read gifts"})
+		return
+	}
+	pipe := redisClient.Pipeline()
+	reads := make([]*redis.MapStringStringCmd, len(requestIDs))
+	for i, requestID := range requestIDs {
+		reads[i] = pipe.HGetAll(r.Context(), giftKey(requestID))
+	}
+	if _, err := pipe.Exec(r.Context()); err != nil && err != redis.Nil {
+		adminLog(r, "admin_gifts_read").WithError(err).Error("Failed to read gift records")
+		writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read gifts"})
+		return
+	}
+
+	gifts := make([]GiftRecord, 0, len(requestIDs))
+	for i, read := range reads {
+		fields := read.Val()
+		if len(fields) == 0 {
+			continue
+		}
+		gift := GiftRecord{
+			RequestID:       requestIDs[i],
+			BuyerUserID:     fields["buyer_user_id"],
+			RecipientUserID: fields["recipient_user_id"],
+			ItemID:          fields["item_id"],
+			Channel:         fields["channel"],
+		}
+		gift.Quantity, _ = strconv.ParseInt(fields["quantity"], 10, 64)
+		gift.ConfirmedAt, _ = time.Parse(time.RFC3339Nano, fields["confirmed_at"])
+		gifts = append(gifts, gift)
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{"user_id": userID, "gifts": gifts})
+}
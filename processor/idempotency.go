@@ -0,0 +1,130 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// orderCopyPrefix starts the processed marker value of an order copy: the copy's accepted_at header
+// Markers without it were written by older processors or for orders without the header
+const orderCopyPrefix = "copy:"
+
+// orderKeyRefreshInterval is how often the keys of an order in flight or parked are extended,
+// well within common.IdempotencyTTL so they never expire before the order is settled
+var orderKeyRefreshInterval = common.IdempotencyTTL / 3
+
+// claimOrderCopy marks the order as processed by this copy and extends its idempotency and
+// status keys, so an order waiting in a Kafka backlog past common.IdempotencyTTL doesn't let a
+// retried /buy in once it's picked up
+// A retry accepted while the order was still queued is a second copy of the same request_id,
+// told apart by its accepted_at header: the first copy processed wins, later ones are skipped
+// without touching stock and give their purchase cap units back. Redeliveries of the winning
+// copy carry the same header and are processed as before. Returns false for a skipped copy;
+// Redis errors are only logged, like the plain marker write, so they never block live traffic
+func claimOrderCopy(logEntry *logrus.Entry, msg *sarama.ConsumerMessage, order *OrderRequest, key, requestID string) bool {
+	acceptedAt := extractHeader(msg.Headers, "accepted_at")
+	if acceptedAt == "" {
+		// No copy identity (DLQ replays, orders published before the header existed): mark as before
+		if err := redisClient.Set(ctx, key, time.Now().UTC().Format(time.RFC3339Nano), processedOrderTTL).Err(); err != nil {
+			redisHealth.Observe(err)
+			logEntry.WithError(err).Warn("Failed to mark order processed")
+		}
+		return true
+	}
+
+	copyID := orderCopyPrefix + acceptedAt
+	var claim *redis.BoolCmd
+	_, err := redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		claim = pipe.SetNX(ctx, key, copyID, processedOrderTTL)
+		extendOrderKeys(pipe, requestID)
+		return nil
+	})
+	if err != nil {
+		redisHealth.Observe(err)
+		logEntry.WithError(err).Warn("Failed to claim order copy")
+		return true
+	}
+	if claim.Val() {
+		return true
+	}
+
+	owner, err := redisClient.Get(ctx, key).Result()
+	if err != nil {
+		redisHealth.Observe(err)
+		logEntry.WithError(err).Warn("Failed to read processed marker")
+		return true
+	}
+	if !strings.HasPrefix(owner, orderCopyPrefix) || owner == copyID {
+		return true
+	}
+	metrics.DuplicateOrderCopies.Inc()
+	logEntry.WithFields(logrus.Fields{
+		"event":             "order_duplicate_copy_skipped",
+		"accepted_at":       acceptedAt,
+		"first_accepted_at": strings.TrimPrefix(owner, orderCopyPrefix),
+	}).Warn("Another copy of this order was already processed, skipping")
+	releasePurchaseCap(logEntry, msg, order)
+	restoreOrderResult(logEntry, requestID)
+	return false
+}
+
+// extendOrderKeys queues the commands that re-create requestID's idempotency key if it expired
+// and extend it and the order's status key
+func extendOrderKeys(pipe redis.Pipeliner, requestID string) {
+	idempotencyKey := common.IdempotencyKey(requestID)
+	pipe.SetNX(ctx, idempotencyKey, "processing", common.IdempotencyTTL)
+	pipe.Expire(ctx, idempotencyKey, common.IdempotencyTTL)
+	pipe.Expire(ctx, common.OrderStatusKey(requestID), common.OrderStatusTTL)
+}
+
+// keepOrderKeys extends requestID's keys every orderKeyRefreshInterval until stop is called, so
+// a retried /buy isn't let in while the order waits on a slow payment or fulfillment step
+func keepOrderKeys(requestID string) (stop func()) {
+	if requestID == "" {
+		return func() {}
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(orderKeyRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			_, err := redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				extendOrderKeys(pipe, requestID)
+				return nil
+			})
+			if err != nil {
+				redisHealth.Observe(err)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// restoreOrderResult puts back the stored result of the processed copy, which the gateway
+// overwrote with PROCESSING when it accepted the skipped one, and notifies clients waiting on it
+// If the first copy is still in flight its result is recorded when it finishes
+func restoreOrderResult(logEntry *logrus.Entry, requestID string) {
+	result, err := common.LoadOrderResult(ctx, redisClient, requestID)
+	if err == nil && result != nil {
+		err = common.RecordOrderResult(ctx, redisClient, *result)
+	}
+	if err != nil {
+		redisHealth.Observe(err)
+		logEntry.WithError(err).Warn("Failed to restore order result")
+	}
+}
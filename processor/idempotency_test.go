@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+var initMetrics sync.Once
+
+// newTestRedis starts an in-process Redis and points redisClient at it for the test
+// Its clock only moves with FastForward, so TTL races run without real waits
+func newTestRedis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	m := miniredis.RunT(t)
+	initMetrics.Do(func() { metrics = common.InitProcessorMetrics() })
+	previous := redisClient
+	redisClient = redis.NewClient(&redis.Options{Addr: m.Addr(), DisableIndentity: true})
+	t.Cleanup(func() {
+		redisClient.Close()
+		redisClient = previous
+	})
+	return m
+}
+
+func orderCopy(requestID, acceptedAt string) *sarama.ConsumerMessage {
+	return &sarama.ConsumerMessage{Headers: []*sarama.RecordHeader{
+		{Key: []byte("request_id"), Value: []byte(requestID)},
+		{Key: []byte("accepted_at"), Value: []byte(acceptedAt)},
+	}}
+}
+
+// retryBuy is the gateway's idempotency check for a retried /buy; true if it is accepted
+func retryBuy(t *testing.T, requestID string) bool {
+	t.Helper()
+	accepted, err := redisClient.SetNX(context.Background(), common.IdempotencyKey(requestID), "processing", common.IdempotencyTTL).Result()
+	if err != nil {
+		t.Fatalf("SETNX: %v", err)
+	}
+	return accepted
+}
+
+func claim(msg *sarama.ConsumerMessage, requestID string) bool {
+	order := &OrderRequest{UserID: "u1", ItemID: "101", Amount: 1}
+	return claimOrderCopy(logger.WithField("test", true), msg, order, processedOrderKeyPrefix+requestID, requestID)
+}
+
+func TestClaimOrderCopyRecreatesIdempotencyKeyExpiredWhileQueued(t *testing.T) {
+	m := newTestRedis(t)
+	const requestID = "req-queued"
+	if !retryBuy(t, requestID) {
+		t.Fatal("first /buy rejected")
+	}
+	// The order waits in a Kafka backlog past the key's TTL
+	m.FastForward(common.IdempotencyTTL + time.Second)
+	if m.Exists(common.IdempotencyKey(requestID)) {
+		t.Fatal("idempotency key still present after its TTL")
+	}
+
+	if !claim(orderCopy(requestID, "t1"), requestID) {
+		t.Fatal("first copy skipped")
+	}
+	if ttl := m.TTL(common.IdempotencyKey(requestID)); ttl != common.IdempotencyTTL {
+		t.Fatalf("idempotency key ttl = %v after pickup, want %v", ttl, common.IdempotencyTTL)
+	}
+	if retryBuy(t, requestID) {
+		t.Fatal("retried /buy accepted while the order is processed")
+	}
+}
+
+func TestClaimOrderCopySkipsRetryAcceptedAfterExpiry(t *testing.T) {
+	m := newTestRedis(t)
+	const requestID = "req-race"
+	// The key expired while the first copy was queued and a retry was accepted as a second copy;
+	// the first copy is then picked up first
+	if !claim(orderCopy(requestID, "t1"), requestID) {
+		t.Fatal("first copy skipped")
+	}
+	m.FastForward(time.Minute)
+
+	if claim(orderCopy(requestID, "t2"), requestID) {
+		t.Fatal("second copy of the same request_id processed")
+	}
+	if !claim(orderCopy(requestID, "t1"), requestID) {
+		t.Fatal("redelivery of the winning copy skipped")
+	}
+}
+
+func TestKeepOrderKeysExtendsKeysWhileOrderInFlight(t *testing.T) {
+	m := newTestRedis(t)
+	const requestID = "req-slow"
+	previous := orderKeyRefreshInterval
+	orderKeyRefreshInterval = 5 * time.Millisecond
+	t.Cleanup(func() { orderKeyRefreshInterval = previous })
+
+	if !claim(orderCopy(requestID, "t1"), requestID) {
+		t.Fatal("copy skipped")
+	}
+	stop := keepOrderKeys(requestID)
+	// A slow payment: most of the TTL passes while the order is still in flight
+	m.FastForward(common.IdempotencyTTL - time.Second)
+	waitForTTL(t, m, common.IdempotencyKey(requestID), common.IdempotencyTTL)
+	stop()
+
+	m.FastForward(common.IdempotencyTTL - time.Second)
+	if retryBuy(t, requestID) {
+		t.Fatal("retried /buy accepted although the order's key was extended")
+	}
+	m.FastForward(2 * time.Second)
+	if !retryBuy(t, requestID) {
+		t.Fatal("key still extended after the order was settled")
+	}
+}
+
+func TestRefreshParkedExtendsParkedOrderKeys(t *testing.T) {
+	m := newTestRedis(t)
+	const requestID = "req-parked"
+	if !retryBuy(t, requestID) {
+		t.Fatal("first /buy rejected")
+	}
+	data, err := json.Marshal(parkedOrder{Topic: "orders", Headers: []spilledHeader{{Key: "request_id", Value: []byte(requestID)}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bg := context.Background()
+	redisClient.SAdd(bg, parkedItemsKey, "101")
+	redisClient.RPush(bg, parkedOrdersKey("101"), data)
+
+	pc := &ProcessorControl{paused: map[string]bool{"101": true}}
+	m.FastForward(common.IdempotencyTTL - time.Second)
+	pc.refreshParked(bg)
+	if ttl := m.TTL(common.IdempotencyKey(requestID)); ttl != common.IdempotencyTTL {
+		t.Fatalf("parked order's idempotency key ttl = %v, want %v", ttl, common.IdempotencyTTL)
+	}
+	m.FastForward(common.IdempotencyTTL - time.Second)
+	if retryBuy(t, requestID) {
+		t.Fatal("retried /buy accepted while the order is parked")
+	}
+}
+
+// waitForTTL waits for the refresh goroutine to reset key's TTL to want
+func waitForTTL(t *testing.T, m *miniredis.Miniredis, key string, want time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if m.TTL(key) == want {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("ttl of %s = %v, want %v", key, m.TTL(key), want)
+}
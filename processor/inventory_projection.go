@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Inventory projection
+//
+// inventory_counts:{item_id} is a hash of units taken out of the item's counter:
+//   - reserved: held by orders that were reserved but not yet paid
+//   - sold:     paid orders
+//   - channel:{name}: units reserved or sold by orders from that channel, against which
+//     channel reserves are measured (see channel_policy.go)
+//
+// The reservation, refund and confirm scripts update it atomically with the counter, so
+// total = available + reserved + sold holds at every step. Dashboards can then tell a true
+// sell-out (available and reserved both 0) from hold exhaustion (available 0 but units still
+// reserved by orders whose payment may fail and return them)
+// Counts are not versioned: a blue/green cutover or admin SET only changes available
+
+// InventoryProjection is an item's unit breakdown
+type InventoryProjection struct {
+	Available int64
+	Reserved  int64 // Held by orders awaiting payment
+	Sold      int64
+}
+
+// Total returns every unit the item has: available, held and sold
+func (p InventoryProjection) Total() int64 {
+	return p.Available + p.Reserved + p.Sold
+}
+
+// recordInventoryProjection exports the projection as processor_inventory_units
+// Only items with their own metric label are exported; a shared "other" gauge would be meaningless
+func recordInventoryProjection(itemID string, projection InventoryProjection) {
+	if !metrics.ItemLabels.Labeled(itemID) {
+		return
+	}
+	metrics.InventoryUnits.WithLabelValues(itemID, "available").Set(float64(projection.Available))
+	metrics.InventoryUnits.WithLabelValues(itemID, "reserved").Set(float64(projection.Reserved))
+	metrics.InventoryUnits.WithLabelValues(itemID, "sold").Set(float64(projection.Sold))
+}
+
+// confirmInventory moves a paid order's units from reserved to sold
+// Failures are logged only: the order is paid, and the units merely stay counted as reserved
+func confirmInventory(logEntry *logrus.Entry, itemID, requestID string, amount int64) {
+	confirmCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	projection, err := inventory.Confirm(confirmCtx, itemID, requestID, amount)
+	if err != nil {
+		redisHealth.Observe(err)
+		logEntry.WithError(err).WithField("event", "inventory_confirm_failed").Warn("Failed to confirm reserved inventory as sold")
+		return
+	}
+	recordInventoryProjection(itemID, projection)
+}
+
+// refreshInventoryProjection re-reads and exports the projection after units were returned
+func refreshInventoryProjection(logEntry *logrus.Entry, itemID string) {
+	readCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	projection, exists, err := inventory.Projection(readCtx, itemID)
+	if err != nil {
+		logEntry.WithError(err).Warn("Failed to read inventory projection")
+		return
+	}
+	if exists {
+		recordInventoryProjection(itemID, projection)
+	}
+}
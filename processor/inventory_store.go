@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// ErrInvalidRefund is returned when a refund amount is rejected by the store
+var ErrInvalidRefund = errors.New("invalid refund amount")
+
+// ErrNoReservation is returned by Refund when nothing is reserved under the request ID: it was
+// never reserved, or was already refunded or sold. Stock is left unchanged
+var ErrNoReservation = errors.New("no reservation for request")
+
+// inventoryVersionChanged is the error the inventory scripts reply with when the item was cut
+// over between resolving its active counter and running the script
+const inventoryVersionChanged = "VERSION_CHANGED"
+
+// inventoryVersionAttempts bounds how often an operation is retried after concurrent cutovers
+const inventoryVersionAttempts = 3
+
+// ReserveRequest describes an inventory reservation for one order
+type ReserveRequest struct {
+	ItemID  string
+	Channel string
+	Amount  int64
+	// Reserves are the percentages of the item's units reserved for other channels; the order may
+	// not take what those channels have not bought of their share yet
+	Reserves map[string]float64
+	// RequestID, if set, records the reservation so its refund returns exactly the allocation
+	// buckets it drew from, and makes it idempotent: a request that already holds its units is
+	// reported as reserved (ALREADY_RESERVED) without taking them again
+	RequestID string
+	// Cap, if positive, is the units UserID may buy of the item within CapWindow; the reservation
+	// is rejected with PURCHASE_LIMIT if it would exceed it, and counted otherwise. Requires RequestID
+	UserID    string
+	Cap       int64
+	CapWindow time.Duration
+}
+
+// RefundRequest gives back the units of one order's reservation
+type RefundRequest struct {
+	ItemID    string
+	Channel   string
+	UserID    string
+	RequestID string
+	Amount    int64
+}
+
+// ReserveResult is the outcome of a reservation
+// Rejected reservations leave stock unchanged; Stock is then the level the order would have left
+type ReserveResult struct {
+	Reserved bool
+	Stock    int64  // Stock after the reservation
+	Reason   string // SUCCESS, ALREADY_RESERVED, SOLD_OUT, CHANNEL_RESERVED, PURCHASE_LIMIT, NOT_INITIALIZED or INVALID_QUANTITY
+	Version  int64  // Inventory version the reservation was made against
+}
+
+// InventoryStore performs the processor's inventory operations
+// Implementations must make Reserve atomic: stock never goes negative and concurrent
+// reservations never oversell, whatever the number of processor instances
+// Reserve, Refund and Confirm also keep the reserved and sold counts (see inventory_projection.go)
+// in step with the stock
+type InventoryStore interface {
+	// Reserve takes req.Amount units of req.ItemID if enough stock is available to req.Channel
+	Reserve(ctx context.Context, req ReserveRequest) (ReserveResult, error)
+	// Refund returns req.Amount units of req.ItemID, and the purchase cap units the reservation
+	// counted, and returns the new stock; ErrNoReservation if req.RequestID holds no units
+	Refund(ctx context.Context, req RefundRequest) (int64, error)
+	// Restock sets itemID's stock; with onlyIfMissing an existing stock level is kept
+	// Returns whether the stock was written
+	Restock(ctx context.Context, itemID string, stock int64, onlyIfMissing bool) (bool, error)
+	// Stock returns itemID's current stock; false if the item has no stock level
+	Stock(ctx context.Context, itemID string) (int64, bool, error)
+	// AddStock atomically adds units to an initialized item and returns the stock before and after
+	// Returns false (and changes nothing) if the item has no stock level
+	AddStock(ctx context.Context, itemID string, units int64) (before, after int64, ok bool, err error)
+	// Confirm moves amount units of itemID from reserved to sold once requestID's order is paid
+	Confirm(ctx context.Context, itemID, requestID string, amount int64) (InventoryProjection, error)
+	// Projection returns itemID's available, reserved and sold units; false if the item has no stock level
+	Projection(ctx context.Context, itemID string) (InventoryProjection, bool, error)
+}
+
+// inventory is the processor's inventory store (RedisInventoryStore by default)
+var inventory InventoryStore
+
+// RedisInventoryStore is the default InventoryStore: counters in Redis updated by Lua scripts
+// (see common/inventory_scripts.go), with blue/green versioned keys and channel allocation buckets
+type RedisInventoryStore struct {
+	client           *redis.Client
+	checkScript      *redis.Script
+	refundScript     *redis.Script
+	addStockScript   *redis.Script
+	confirmScript    *redis.Script
+	projectionScript *redis.Script
+}
+
+// NewRedisInventoryStore creates the Redis-backed store
+func NewRedisInventoryStore(client *redis.Client) *RedisInventoryStore {
+	return &RedisInventoryStore{
+		client:           client,
+		checkScript:      redis.NewScript(common.LuaCheckInventoryScript),
+		refundScript:     redis.NewScript(common.LuaRefundInventoryScript),
+		addStockScript:   redis.NewScript(common.LuaAddStockScript),
+		confirmScript:    redis.NewScript(common.LuaConfirmInventoryScript),
+		projectionScript: redis.NewScript(common.LuaInventoryProjectionScript),
+	}
+}
+
+// withActiveCounter runs op with itemID's active version and counter key, retrying when the
+// script reports a cutover in between (see common.LuaCheckInventoryScript)
+func (s *RedisInventoryStore) withActiveCounter(ctx context.Context, itemID string, op func(version int64, inventoryKey string) error) error {
+	var err error
+	for attempt := 0; attempt < inventoryVersionAttempts; attempt++ {
+		var version int64
+		version, err = s.client.Get(ctx, common.InventoryVersionKey(itemID)).Int64()
+		if err == redis.Nil {
+			version, err = 0, nil
+		}
+		if err != nil {
+			return err
+		}
+		err = op(version, common.InventoryKeyForVersion(itemID, version))
+		if err == nil || !strings.HasPrefix(err.Error(), inventoryVersionChanged) {
+			return err
+		}
+	}
+	return err
+}
+
+// Reserve runs the check-and-decrement script against the active counter
+// The script verifies the version it was given, so a cutover is atomic per order
+func (s *RedisInventoryStore) Reserve(ctx context.Context, req ReserveRequest) (ReserveResult, error) {
+	var result []interface{}
+	err := s.withActiveCounter(ctx, req.ItemID, func(version int64, inventoryKey string) error {
+		var err error
+		result, err = s.checkScript.Run(ctx, s.client,
+			[]string{common.InventoryVersionKey(req.ItemID), inventoryKey, common.InventoryBucketsKey(req.ItemID), common.InventoryCountsKey(req.ItemID),
+				common.InventoryReservationsKey(req.ItemID), common.PurchasedKey(req.ItemID, req.UserID)},
+			req.Amount, version, encodeChannelReserves(req.Reserves), req.Channel, req.RequestID, req.Cap, int64(req.CapWindow.Seconds())).Slice()
+		return err
+	})
+	if err != nil {
+		return ReserveResult{}, err
+	}
+	return reserveResultFromScript(result)
+}
+
+// reserveResultFromScript decodes {success: 0|1, stock: int, reason: string, version: int}
+// success=0 means the order was rejected (any decrement already refunded by the script)
+func reserveResultFromScript(result []interface{}) (ReserveResult, error) {
+	if len(result) < 3 {
+		return ReserveResult{}, fmt.Errorf("unexpected inventory script result: %v", result)
+	}
+	success, ok := result[0].(int64)
+	stock, stockOK := result[1].(int64)
+	if !ok || !stockOK {
+		return ReserveResult{}, fmt.Errorf("unexpected inventory script result: %v", result)
+	}
+	reserved := ReserveResult{Reason: "UNKNOWN", Reserved: success == 1, Stock: stock}
+	// Handle both string and []byte types from Redis
+	switch v := result[2].(type) {
+	case string:
+		reserved.Reason = v
+	case []byte:
+		reserved.Reason = string(v)
+	}
+	if len(result) > 3 {
+		version, ok := result[3].(int64)
+		if !ok {
+			return ReserveResult{}, fmt.Errorf("unexpected inventory script result: %v", result)
+		}
+		reserved.Version = version
+	}
+	return reserved, nil
+}
+
+// encodeChannelReserves formats reserves as the reserve script's "channel:percent,..." argument
+func encodeChannelReserves(reserves map[string]float64) string {
+	pairs := make([]string, 0, len(reserves))
+	for _, channel := range slices.Sorted(maps.Keys(reserves)) {
+		pairs = append(pairs, channel+":"+strconv.FormatFloat(reserves[channel], 'f', -1, 64))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Refund returns units to the item's active counter and the allocation buckets they came from
+// Refunds go to the active counter: after a cutover the previous one is no longer sold from
+func (s *RedisInventoryStore) Refund(ctx context.Context, req RefundRequest) (int64, error) {
+	var result []interface{}
+	err := s.withActiveCounter(ctx, req.ItemID, func(version int64, inventoryKey string) error {
+		var err error
+		// Script result: {success: 0|1|2, new_stock: int}
+		result, err = s.refundScript.Run(ctx, s.client,
+			[]string{common.InventoryVersionKey(req.ItemID), inventoryKey, common.InventoryBucketsKey(req.ItemID), common.InventoryCountsKey(req.ItemID),
+				common.InventoryReservationsKey(req.ItemID), common.PurchasedKey(req.ItemID, req.UserID)},
+			req.Amount, req.Channel, version, req.RequestID).Slice()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return refundResultFromScript(result)
+}
+
+// refundResultFromScript decodes {success: 0|1|2, new_stock: int}
+func refundResultFromScript(result []interface{}) (int64, error) {
+	if len(result) < 2 {
+		return 0, fmt.Errorf("unexpected refund script result: %v", result)
+	}
+	success, ok := result[0].(int64)
+	newStock, stockOK := result[1].(int64)
+	if !ok || !stockOK {
+		return 0, fmt.Errorf("unexpected refund script result: %v", result)
+	}
+	switch success {
+	case 1:
+		return newStock, nil
+	case 2:
+		return newStock, ErrNoReservation
+	}
+	return 0, ErrInvalidRefund
+}
+
+// Restock writes the item's active counter
+func (s *RedisInventoryStore) Restock(ctx context.Context, itemID string, stock int64, onlyIfMissing bool) (bool, error) {
+	inventoryKey, err := activeInventoryKey(ctx, s.client, itemID)
+	if err != nil {
+		return false, err
+	}
+	if onlyIfMissing {
+		return s.client.SetNX(ctx, inventoryKey, stock, 0).Result()
+	}
+	return true, s.client.Set(ctx, inventoryKey, stock, 0).Err()
+}
+
+// Stock reads the item's active counter
+func (s *RedisInventoryStore) Stock(ctx context.Context, itemID string) (int64, bool, error) {
+	inventoryKey, err := activeInventoryKey(ctx, s.client, itemID)
+	if err != nil {
+		return 0, false, err
+	}
+	stock, err := s.client.Get(ctx, inventoryKey).Int64()
+	if err == redis.Nil {
+		return 0, false, nil
+	}
+	return stock, err == nil, err
+}
+
+// AddStock increments the item's active counter
+func (s *RedisInventoryStore) AddStock(ctx context.Context, itemID string, units int64) (int64, int64, bool, error) {
+	var result []int64
+	err := s.withActiveCounter(ctx, itemID, func(version int64, inventoryKey string) error {
+		var err error
+		// Script result: {success: 0|1, stock_before: int, stock_after: int}
+		result, err = s.addStockScript.Run(ctx, s.client, []string{common.InventoryVersionKey(itemID), inventoryKey}, units, version).Int64Slice()
+		return err
+	})
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if len(result) < 3 {
+		return 0, 0, false, fmt.Errorf("unexpected add stock script result: %v", result)
+	}
+	if result[0] != 1 {
+		return 0, 0, false, nil
+	}
+	return result[1], result[2], true, nil
+}
+
+// Confirm runs the confirm script, which also reads the projection after the move
+func (s *RedisInventoryStore) Confirm(ctx context.Context, itemID, requestID string, amount int64) (InventoryProjection, error) {
+	var result []int64
+	err := s.withActiveCounter(ctx, itemID, func(version int64, inventoryKey string) error {
+		var err error
+		result, err = s.confirmScript.Run(ctx, s.client,
+			[]string{common.InventoryVersionKey(itemID), inventoryKey, common.InventoryCountsKey(itemID), common.InventoryReservationsKey(itemID)},
+			amount, version, requestID).Int64Slice()
+		return err
+	})
+	if err != nil {
+		return InventoryProjection{}, err
+	}
+	projection, _, err := projectionFromScript(result)
+	return projection, err
+}
+
+// Projection reads the active counter and the unit counts in one script
+func (s *RedisInventoryStore) Projection(ctx context.Context, itemID string) (InventoryProjection, bool, error) {
+	var result []int64
+	err := s.withActiveCounter(ctx, itemID, func(version int64, inventoryKey string) error {
+		var err error
+		result, err = s.projectionScript.Run(ctx, s.client, []string{common.InventoryVersionKey(itemID), inventoryKey, common.InventoryCountsKey(itemID)}, version).Int64Slice()
+		return err
+	})
+	if err != nil {
+		return InventoryProjection{}, false, err
+	}
+	return projectionFromScript(result)
+}
+
+// projectionFromScript decodes {available, reserved, sold}; available is -1 for a missing counter
+func projectionFromScript(result []int64) (InventoryProjection, bool, error) {
+	if len(result) < 3 {
+		return InventoryProjection{}, false, fmt.Errorf("unexpected inventory projection script result: %v", result)
+	}
+	projection := InventoryProjection{Available: result[0], Reserved: result[1], Sold: result[2]}
+	if projection.Available < 0 {
+		projection.Available = 0
+		return projection, false, nil
+	}
+	return projection, true, nil
+}
+
+// ReloadScripts loads the Lua scripts into Redis (e.g. after SCRIPT FLUSH or a failover)
+func (s *RedisInventoryStore) ReloadScripts(ctx context.Context) error {
+	if err := s.checkScript.Load(ctx, s.client).Err(); err != nil {
+		return err
+	}
+	if err := s.addStockScript.Load(ctx, s.client).Err(); err != nil {
+		return err
+	}
+	if err := s.confirmScript.Load(ctx, s.client).Err(); err != nil {
+		return err
+	}
+	if err := s.projectionScript.Load(ctx, s.client).Err(); err != nil {
+		return err
+	}
+	return s.refundScript.Load(ctx, s.client).Err()
+}
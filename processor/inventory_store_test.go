@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+func init() {
+	// Helpers under test log through the processor's logger
+	logger = logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+}
+
+func TestReserveResultFromScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  []interface{}
+		want    ReserveResult
+		wantErr bool
+	}{
+		{"success", []interface{}{int64(1), int64(9), "SUCCESS", int64(2)}, ReserveResult{Reserved: true, Stock: 9, Reason: "SUCCESS", Version: 2}, false},
+		{"rejected bytes reason", []interface{}{int64(0), int64(-1), []byte("SOLD_OUT")}, ReserveResult{Stock: -1, Reason: "SOLD_OUT"}, false},
+		{"unknown reason type", []interface{}{int64(0), int64(0), int64(7)}, ReserveResult{Reason: "UNKNOWN"}, false},
+		{"short", []interface{}{int64(1), int64(9)}, ReserveResult{}, true},
+		{"string success", []interface{}{"1", int64(9), "SUCCESS"}, ReserveResult{}, true},
+		{"string stock", []interface{}{int64(1), "9", "SUCCESS"}, ReserveResult{}, true},
+		{"string version", []interface{}{int64(1), int64(9), "SUCCESS", "2"}, ReserveResult{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reserveResultFromScript(tt.result)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefundResultFromScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  []interface{}
+		want    int64
+		wantErr error
+	}{
+		{"refunded", []interface{}{int64(1), int64(10)}, 10, nil},
+		{"nothing reserved", []interface{}{int64(2), int64(8)}, 8, ErrNoReservation},
+		{"invalid amount", []interface{}{int64(0), int64(0)}, 0, ErrInvalidRefund},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := refundResultFromScript(tt.result)
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Errorf("got (%d, %v), want (%d, %v)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+	for _, result := range [][]interface{}{{int64(1)}, {nil, int64(1)}, {int64(1), "10"}} {
+		if _, err := refundResultFromScript(result); err == nil || errors.Is(err, ErrInvalidRefund) {
+			t.Errorf("refundResultFromScript(%v) = %v, want a decode error", result, err)
+		}
+	}
+}
+
+func TestEncodeChannelReserves(t *testing.T) {
+	if got := encodeChannelReserves(nil); got != "" {
+		t.Errorf("nil reserves encoded as %q", got)
+	}
+	got := encodeChannelReserves(map[string]float64{"partner-api": 5, "app": 12.5})
+	if want := "app:12.5,partner-api:5"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestOtherReserves(t *testing.T) {
+	policy := &CampaignChannelPolicy{ReservePercent: map[string]float64{"app": 20, "partner-api": 5, "web": 0}}
+	got := policy.OtherReserves("app")
+	if len(got) != 1 || got["partner-api"] != 5 {
+		t.Errorf("OtherReserves(app) = %v, want only partner-api", got)
+	}
+	if got := policy.OtherReserves("web"); len(got) != 2 {
+		t.Errorf("OtherReserves(web) = %v, want app and partner-api", got)
+	}
+}
+
+// newTestInventoryStore runs a RedisInventoryStore, with its Lua scripts, on an in-process Redis
+// holding stock
+func newTestInventoryStore(t *testing.T, stock map[string]int64) *RedisInventoryStore {
+	t.Helper()
+	newTestRedis(t)
+	store := NewRedisInventoryStore(redisClient)
+	for itemID, units := range stock {
+		if _, err := store.Restock(context.Background(), itemID, units, false); err != nil {
+			t.Fatalf("restock %s: %v", itemID, err)
+		}
+	}
+	return store
+}
+
+func TestRedisStoreChannelReserveShrinks(t *testing.T) {
+	store := newTestInventoryStore(t, map[string]int64{"101": 10})
+	ctx := context.Background()
+	webReserves := map[string]float64{"app": 20}
+
+	// 2 of 10 units are held for app: web may take 8
+	for i := 0; i < 8; i++ {
+		if r, err := store.Reserve(ctx, ReserveRequest{ItemID: "101", Channel: "web", Amount: 1, Reserves: webReserves}); err != nil || !r.Reserved {
+			t.Fatalf("web unit %d rejected: %+v, %v", i, r, err)
+		}
+	}
+	if r, _ := store.Reserve(ctx, ReserveRequest{ItemID: "101", Channel: "web", Amount: 1, Reserves: webReserves}); r.Reason != "CHANNEL_RESERVED" {
+		t.Fatalf("web took reserved stock: %+v", r)
+	}
+	// Once app bought one unit, only one remains reserved
+	if r, err := store.Reserve(ctx, ReserveRequest{ItemID: "101", Channel: "app", Amount: 1}); err != nil || !r.Reserved {
+		t.Fatalf("app rejected: %+v, %v", r, err)
+	}
+	if r, _ := store.Reserve(ctx, ReserveRequest{ItemID: "101", Channel: "web", Amount: 1, Reserves: webReserves}); r.Reason != "CHANNEL_RESERVED" {
+		t.Fatalf("web took the last reserved unit: %+v", r)
+	}
+	if stock, _, _ := store.Stock(ctx, "101"); stock != 1 {
+		t.Errorf("stock %d after rejected reservations, want 1", stock)
+	}
+}
+
+func TestRedisStoreReservationIdempotentAndRefundExact(t *testing.T) {
+	store := newTestInventoryStore(t, map[string]int64{"101": 5})
+	ctx := context.Background()
+	// One unit is allocated to web's bucket: the reservation takes it and one unallocated unit
+	if err := redisClient.HSet(ctx, common.InventoryBucketsKey("101"), "web", 1).Err(); err != nil {
+		t.Fatal(err)
+	}
+	req := ReserveRequest{ItemID: "101", Channel: "web", Amount: 2, RequestID: "r1", UserID: "u1", Cap: 3, CapWindow: time.Hour}
+
+	for i, want := range []string{"SUCCESS", "ALREADY_RESERVED"} {
+		r, err := store.Reserve(ctx, req)
+		if err != nil || !r.Reserved || r.Reason != want {
+			t.Fatalf("attempt %d: %+v, %v; want %s", i, r, err, want)
+		}
+	}
+	if stock, _, _ := store.Stock(ctx, "101"); stock != 3 {
+		t.Fatalf("retry reserved again: stock %d, want 3", stock)
+	}
+	// The cap counts the reservation once
+	if r, _ := store.Reserve(ctx, ReserveRequest{ItemID: "101", Amount: 2, RequestID: "r2", UserID: "u1", Cap: 3, CapWindow: time.Hour}); r.Reason != "PURCHASE_LIMIT" {
+		t.Fatalf("cap not enforced: %+v", r)
+	}
+
+	refund := RefundRequest{ItemID: "101", Channel: "web", UserID: "u1", RequestID: "r1", Amount: 2}
+	if stock, err := store.Refund(ctx, refund); err != nil || stock != 5 {
+		t.Fatalf("refund: %d, %v", stock, err)
+	}
+	if _, err := store.Refund(ctx, refund); !errors.Is(err, ErrNoReservation) {
+		t.Fatalf("second refund: %v, want ErrNoReservation", err)
+	}
+	if stock, _, _ := store.Stock(ctx, "101"); stock != 5 {
+		t.Errorf("second refund returned units: stock %d", stock)
+	}
+	if got, _ := redisClient.Get(ctx, common.PurchasedKey("101", "u1")).Int64(); got != 0 {
+		t.Errorf("cap not released: %d", got)
+	}
+	if got, _ := redisClient.HGet(ctx, common.InventoryBucketsKey("101"), "web").Int64(); got != 1 {
+		t.Errorf("web bucket %d after the refund, want 1", got)
+	}
+	if projection, _, err := store.Projection(ctx, "101"); err != nil || projection.Reserved != 0 {
+		t.Errorf("projection %+v, %v after the refund, want nothing reserved", projection, err)
+	}
+}
+
+// inventoryOp is one step of a generated order sequence: Kind picks reserve, a retried reserve,
+// refund or confirm, Order the request and Amount the quantity (0 is an invalid quantity)
+type inventoryOp struct {
+	Kind   uint8
+	Order  uint8
+	Amount uint8
+}
+
+// TestRedisStoreNeverOversells runs random reserve/refund/confirm sequences through the inventory
+// scripts and checks after every step that available stock never goes negative and that no unit
+// is created or lost: available+reserved+sold stays the item's total
+func TestRedisStoreNeverOversells(t *testing.T) {
+	store := newTestInventoryStore(t, nil)
+	ctx := context.Background()
+	const total = 20
+	webReserves := map[string]float64{"app": 20}
+
+	run := func(ops []inventoryOp) bool {
+		redisClient.FlushAll(ctx)
+		if _, err := store.Restock(ctx, "101", total, false); err != nil {
+			t.Fatalf("restock: %v", err)
+		}
+		open := make(map[string]ReserveRequest) // Reservations neither refunded nor confirmed
+		for i, op := range ops {
+			n := int(op.Order % 8)
+			req := ReserveRequest{ItemID: "101", Channel: "web", Amount: int64(op.Amount % 6), RequestID: "r" + strconv.Itoa(n),
+				UserID: "u" + strconv.Itoa(n%3), Cap: 8, CapWindow: time.Hour, Reserves: webReserves}
+			if n%2 == 1 {
+				req.Channel, req.Reserves = "app", nil
+			}
+			held, isOpen := open[req.RequestID]
+			switch op.Kind % 4 {
+			case 0, 1:
+				if op.Kind%4 == 1 && isOpen {
+					req.Amount = held.Amount // A retry after a timeout
+				}
+				r, err := store.Reserve(ctx, req)
+				if err != nil {
+					t.Fatalf("op %d reserve: %v", i, err)
+				}
+				if r.Reason == "SUCCESS" {
+					open[req.RequestID] = req
+				} else if isOpen != (r.Reason == "ALREADY_RESERVED") {
+					t.Errorf("op %d: reservation of %s answered %s", i, req.RequestID, r.Reason)
+					return false
+				}
+			case 2:
+				refund := RefundRequest{ItemID: "101", Channel: req.Channel, UserID: req.UserID, RequestID: req.RequestID, Amount: max(1, req.Amount)}
+				if isOpen {
+					refund.Channel, refund.Amount = held.Channel, held.Amount
+				}
+				_, err := store.Refund(ctx, refund)
+				if isOpen && err != nil || !isOpen && !errors.Is(err, ErrNoReservation) {
+					t.Errorf("op %d: refund of %s (open %v): %v", i, req.RequestID, isOpen, err)
+					return false
+				}
+				delete(open, req.RequestID)
+			case 3:
+				// Confirming an order without an open reservation (redelivered, refunded) moves nothing
+				amount := max(1, req.Amount)
+				if isOpen {
+					amount = held.Amount
+				}
+				if _, err := store.Confirm(ctx, "101", req.RequestID, amount); err != nil {
+					t.Fatalf("op %d confirm: %v", i, err)
+				}
+				delete(open, req.RequestID)
+			}
+
+			projection, _, err := store.Projection(ctx, "101")
+			if err != nil {
+				t.Fatalf("op %d projection: %v", i, err)
+			}
+			var reserved int64
+			for _, r := range open {
+				reserved += r.Amount
+			}
+			if projection.Available < 0 || projection.Available+projection.Reserved+projection.Sold != total || projection.Reserved != reserved {
+				t.Errorf("op %d %+v: projection %+v, want available >= 0, %d units in total and %d reserved", i, op, projection, total, reserved)
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(run, &quick.Config{MaxCount: 200}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRedisStoreConfirmIsIdempotent(t *testing.T) {
+	store := newTestInventoryStore(t, map[string]int64{"101": 10})
+	ctx := context.Background()
+	if r, err := store.Reserve(ctx, ReserveRequest{ItemID: "101", Amount: 3, RequestID: "req-1"}); err != nil || r.Reason != "SUCCESS" {
+		t.Fatalf("reserve: %+v, %v", r, err)
+	}
+	want := InventoryProjection{Available: 7, Reserved: 0, Sold: 3}
+	// A confirm redelivered after a crash finds the reservation gone and changes nothing
+	for attempt := 1; attempt <= 2; attempt++ {
+		projection, err := store.Confirm(ctx, "101", "req-1", 3)
+		if err != nil || projection != want {
+			t.Fatalf("confirm %d: %+v, %v; want %+v", attempt, projection, err, want)
+		}
+	}
+	if projection, _, err := store.Projection(ctx, "101"); err != nil || projection != want {
+		t.Fatalf("projection %+v, %v; want %+v", projection, err, want)
+	}
+}
+
+func TestRestoreInventory(t *testing.T) {
+	store := newTestInventoryStore(t, map[string]int64{"101": 7})
+	states := map[string]common.InventoryState{
+		"101": {ItemID: "101", Stock: 50},
+		"102": {ItemID: "102", Stock: 20},
+		"103": {ItemID: "103", Stock: -3},
+	}
+	if restored := restoreInventory(context.Background(), store, states); restored != 2 {
+		t.Fatalf("restored %d items, want 2", restored)
+	}
+	for itemID, want := range map[string]int64{"101": 7, "102": 20, "103": 0} {
+		if got, _, _ := store.Stock(context.Background(), itemID); got != want {
+			t.Errorf("item %s stock %d, want %d", itemID, got, want)
+		}
+	}
+
+	// A Redis that fails every command restores nothing
+	m := newTestRedis(t)
+	failing := NewRedisInventoryStore(redisClient)
+	m.SetError("redis down")
+	if restored := restoreInventory(context.Background(), failing, states); restored != 0 {
+		t.Errorf("restored %d items on a failing store", restored)
+	}
+}
+
+func TestReserveSyntheticUnit(t *testing.T) {
+	ctx := context.Background()
+	store := newTestInventoryStore(t, map[string]int64{common.SyntheticItemID: 1})
+	status, reason, err := reserveSyntheticUnit(ctx, store)
+	if err != nil || status != common.ResultReserved || reason != common.SyntheticResultReason {
+		t.Fatalf("got (%s, %s, %v)", status, reason, err)
+	}
+	if stock, _, _ := store.Stock(ctx, common.SyntheticItemID); stock != 1 {
+		t.Errorf("synthetic unit not returned: stock %d", stock)
+	}
+
+	store = newTestInventoryStore(t, map[string]int64{common.SyntheticItemID: 0})
+	if status, reason, _ := reserveSyntheticUnit(ctx, store); status != common.ResultFailedSoldOut || reason != "SOLD_OUT" {
+		t.Errorf("sold out: got (%s, %s)", status, reason)
+	}
+
+	m := newTestRedis(t)
+	store = NewRedisInventoryStore(redisClient)
+	m.SetError("redis down")
+	if status, reason, err := reserveSyntheticUnit(ctx, store); err == nil || status != common.ResultFailed || reason != "RESERVE_ERROR" {
+		t.Errorf("store error: got (%s, %s, %v)", status, reason, err)
+	}
+}
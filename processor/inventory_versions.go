@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// Blue/green inventory keys
+//
+// inventory_version:{item_id} names the active counter for an item:
+//   - absent or 0: the legacy key inventory:{item_id}
+//   - N >= 1:      inventory:v{N}:{item_id}
+//
+// Stock corrections are staged by writing the next versioned key (e.g. SET inventory:v2:101 95)
+// while orders keep decrementing the active one, then flipped with the cutover_inventory control command
+// The inventory scripts are given the counter of the version the caller read and check that
+// version again inside Lua, failing with VERSION_CHANGED (and being retried) after a cutover, so
+// every order decrements exactly one counter and there is no window where both are decremented
+
+// luaInventoryCutoverScript atomically switches an item to a staged inventory version
+// KEYS[1] = inventory_version:{item_id}, KEYS[2] = staged key inventory:v{N}:{item_id}
+// ARGV[1] = N
+// Returns {1, previous_version, staged_stock}, {2, version, 'ALREADY_ACTIVE'} or {0, current_version, reason}
+// ALREADY_ACTIVE lets every processor instance apply the same broadcast cutover command
+const luaInventoryCutoverScript = `
+local version = tonumber(ARGV[1])
+if not version or version < 1 or version % 1 ~= 0 then
+    return {0, 0, 'INVALID_VERSION'}
+end
+
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+if version == current then
+    return {2, current, 'ALREADY_ACTIVE'}
+end
+if version < current then
+    return {0, current, 'VERSION_NOT_NEWER'}
+end
+
+local staged = redis.call('GET', KEYS[2])
+if not staged then
+    return {0, current, 'NOT_STAGED'}
+end
+
+redis.call('SET', KEYS[1], version)
+return {1, current, tonumber(staged)}
+`
+
+// activeInventoryKey returns the counter key currently used for itemID
+func activeInventoryKey(ctx context.Context, client *redis.Client, itemID string) (string, error) {
+	version, err := client.Get(ctx, common.InventoryVersionKey(itemID)).Int64()
+	if err == redis.Nil {
+		return common.InventoryKeyForVersion(itemID, 0), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return common.InventoryKeyForVersion(itemID, version), nil
+}
+
+// cutoverInventory makes the staged counter for version the active one for itemID
+// The previous counter is left in place for audit; it is no longer decremented
+func cutoverInventory(ctx context.Context, itemID string, version int64) error {
+	stagedKey := common.InventoryKeyForVersion(itemID, version)
+	result, err := redis.NewScript(luaInventoryCutoverScript).Run(ctx, redisClient,
+		[]string{common.InventoryVersionKey(itemID), stagedKey}, version).Slice()
+	if err != nil {
+		return err
+	}
+	status, ok := int64(0), false
+	if len(result) >= 3 {
+		status, ok = result[0].(int64)
+	}
+	if !ok {
+		return fmt.Errorf("unexpected cutover result: %v", result)
+	}
+	switch status {
+	case 0:
+		return fmt.Errorf("cutover of %s to version %d rejected: %v (active version %d)", itemID, version, result[2], result[1])
+	case 2:
+		logger.WithField("item_id", itemID).WithField("version", version).Debug("Inventory version already active")
+		return nil
+	}
+
+	logger.WithFields(map[string]interface{}{
+		"event":            "inventory_cutover",
+		"item_id":          itemID,
+		"previous_version": result[1],
+		"version":          version,
+		"stock":            result[2],
+		"inventory_key":    stagedKey,
+	}).Info("Inventory version cut over")
+	return nil
+}
@@ -3,137 +3,642 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"net/http"
 	"os"
-	"os/signal"
 	"strconv"
-	"syscall"
+	"strings"
 	"time"
 
 	"github.com/IBM/sarama"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 	"github.com/yourname/flash-sale-engine/common"
+	"github.com/yourname/flash-sale-engine/common/app"
+	orderpb "github.com/yourname/flash-sale-engine/common/proto"
 )
 
 var (
-	redisClient          *redis.Client
-	producer             sarama.SyncProducer // Kafka producer for publishing failed orders to DLQ
-	ctx                  = context.Background()
-	logger               *logrus.Logger
-	metrics              *common.ProcessorMetrics
-	checkInventoryScript *redis.Script
+	redisClient         *redis.Client
+	producer            sarama.SyncProducer // Kafka producer for publishing failed orders to DLQ
+	ctx                 = context.Background()
+	logger              *logrus.Logger
+	metrics             *common.ProcessorMetrics
+	auditor             *SafetyAuditor        // Non-nil in safety audit mode (PROCESSOR_SAFETY_AUDIT=true)
+	publishInventory    bool                  // Publish stock changes to the compacted inventory-state topic
+	publishResults      bool                  // Publish order results to the order-results topic (ORDER_RESULTS_PUBLISH=true)
+	control             *ProcessorControl     // Non-nil when runtime control commands are enabled (PROCESSOR_CONTROL_ENABLED=true)
+	payloadCipher       *common.PayloadCipher // Non-nil when payload encryption keys are configured
+	redisHealth         *common.RedisDegradation
+	requireEncryption   bool                  // Reject plaintext orders (PAYLOAD_ENCRYPTION_REQUIRED=true)
+	signer              *common.MessageSigner // Non-nil when order signatures are verified (MESSAGE_SIGNING_KEYS)
+	dropUnauthenticated bool                  // Drop instead of DLQ-ing unauthenticated orders
+	httpTransport       *common.HTTPTransport // Connection pool shared by outbound HTTP clients
+	purchaseCaps        common.PurchaseCaps   // Per-buyer caps counted with each reservation (PURCHASE_CAP_*)
 )
 
 type OrderRequest struct {
 	UserID string `json:"user_id"`
 	ItemID string `json:"item_id"`
+	Amount int64  `json:"amount"` // Quantity to reserve; 0 in legacy messages means 1
+
+	// RecipientUserID is set on gift orders: UserID pays (and is capped), the recipient is entitled
+	RecipientUserID string `json:"recipient_user_id,omitempty"`
+
+	// Channel is the order source (web, app, partner-api); empty in legacy messages means web
+	Channel string `json:"channel,omitempty"`
+
+	// Address is the optional shipping address (validated by the gateway); never logged
+	Address *common.ShippingAddress `json:"address,omitempty"`
+
+	// DeviceID is the gateway-verified device fingerprint, empty without a device token
+	DeviceID string `json:"device_id,omitempty"`
+
+	// Metadata is passed through from the client untouched (cart IDs, campaign tags, ...)
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Lines is set on cart orders (see cart.go); ItemID and Amount repeat the first line
+	Lines []common.CartLine `json:"lines,omitempty"`
+	// CartPolicy is common.CartAllOrNothing (also when empty) or common.CartBestEffort
+	CartPolicy string `json:"cart_policy,omitempty"`
 }
 
 func main() {
-	// Initialize structured logger with service name
-	logger = common.InitLogger("processor")
-	logger.Info("Processor starting...")
+	a := app.New("processor", processorConfig)
+	issueAdminToken := flag.String("issue-admin-token", "", "Print an admin API token for this subject and exit (uses ADMIN_TOKEN_SECRET)")
+	adminRole := flag.String("admin-role", common.RoleViewer, "Role of the token printed by -issue-admin-token (viewer|operator|admin)")
+	adminTokenTTL := flag.Duration("admin-token-ttl", 30*24*time.Hour, "Lifetime of the token printed by -issue-admin-token")
+	replayFrom := flag.String("replay-from", "", "Replay orders published since this RFC 3339 time, print a summary and exit")
+	replayTo := flag.String("replay-to", "", "End of the -replay-from range, RFC 3339 (default: now)")
+	replayMode := flag.String("replay-mode", ReplayDryRun, "dry-run (report only) or live (process orders not processed before)")
+	replayTopic := flag.String("replay-topic", common.TopicOrders, "Order topic to replay")
+	a.Parse()
+
+	if *issueAdminToken != "" {
+		auth, err := common.NewAdminAuth(os.Getenv("ADMIN_TOKEN_SECRET"))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		token, err := auth.Issue(*issueAdminToken, *adminRole, *adminTokenTTL)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(token)
+		return
+	}
 
-	// Get service addresses from environment or use defaults
-	redisAddr := os.Getenv("REDIS_ADDR")
-	if redisAddr == "" {
-		redisAddr = "redis-service:6379" // Default for k8s
+	var replay *ReplayOptions
+	if *replayFrom != "" {
+		opts, err := parseReplayOptions(*replayFrom, *replayTo, *replayMode, *replayTopic)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		replay = &opts
 	}
 
-	kafkaAddr := os.Getenv("KAFKA_ADDR")
-	if kafkaAddr == "" {
-		kafkaAddr = "kafka-service:9092" // Default for k8s
+	// Logger, build info, startup configuration (GET /admin/config) and signal handling
+	a.Start()
+	logger = a.Logger
+	startupConfig = a.Config
+
+	// Initialize Prometheus metrics before anything that records them (HTTP clients, consumers)
+	metrics = common.InitProcessorMetrics()
+	a.ConfigureItemLabels(metrics.ItemLabels)
+	a.ConfigureCampaignLabels(metrics.Orders.Campaigns)
+
+	// Redis OOM tracking (REDIS_OOM_HOLD, default: 30s after the last OOM error)
+	redisHealth = a.NewRedisDegradation(metrics.RedisDegraded)
+
+	// Create required Kafka topics if bootstrap is enabled (KAFKA_TOPIC_BOOTSTRAP=true)
+	if getEnvBool("KAFKA_TOPIC_BOOTSTRAP", false) {
+		a.BootstrapTopics()
 	}
 
-	redisClient = redis.NewClient(&redis.Options{Addr: redisAddr})
+	// Shutdown hooks run in reverse: consumers stop and in-flight orders drain before the
+	// Kafka client, fulfillment queue, DLQ producer and Redis are closed
+	redisClient = a.NewRedisClient(metrics.Redis)
 
-	// Load Lua scripts
-	checkInventoryScript = redis.NewScript(luaCheckInventoryScript)
+	// Inventory operations go through the InventoryStore (Redis + Lua scripts)
+	// Items needing durable inventory can use Postgres instead (INVENTORY_POSTGRES_DSN with
+	// INVENTORY_POSTGRES_ITEMS, comma-separated item IDs or "*" for all)
+	inventory = NewRedisInventoryStore(redisClient)
+	if dsn := os.Getenv("INVENTORY_POSTGRES_DSN"); dsn != "" {
+		var postgresItems []string
+		for _, itemID := range strings.Split(os.Getenv("INVENTORY_POSTGRES_ITEMS"), ",") {
+			if itemID = strings.TrimSpace(itemID); itemID != "" {
+				postgresItems = append(postgresItems, itemID)
+			}
+		}
+		postgresStore, err := NewPostgresInventoryStore(ctx, dsn)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to connect to Postgres inventory store")
+		}
+		a.OnShutdown("Postgres inventory store", func(context.Context) error { return postgresStore.Close() })
+		inventory = NewRoutedInventoryStore(inventory, postgresStore, postgresItems)
+		logger.WithField("items", postgresItems).Info("Postgres inventory store enabled")
+	}
+
+	// Order store for support searches (GET /admin/orders): every result is upserted into the
+	// Postgres orders table at ORDER_STORE_DSN, by a background writer queueing up to
+	// ORDER_STORE_QUEUE_SIZE results (default: 10000) flushed every ORDER_STORE_FLUSH_INTERVAL (default: 1s)
+	// With ORDER_STORE_OUTBOX (default: false) and ORDER_RESULTS_PUBLISH, result events go through
+	// the order_outbox table, written in the same transaction as the orders rows (relay started
+	// with the producer below)
+	if dsn := os.Getenv("ORDER_STORE_DSN"); dsn != "" {
+		store, err := NewOrderStore(ctx, dsn, getEnvInt("ORDER_STORE_QUEUE_SIZE", 10000), getEnvDuration("ORDER_STORE_FLUSH_INTERVAL", time.Second),
+			getEnvBool("ORDER_STORE_OUTBOX", false) && getEnvBool("ORDER_RESULTS_PUBLISH", false))
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to connect to the order store")
+		}
+		orderStore = store
+		a.OnShutdown("order store", store.Close)
+		logger.WithField("outbox", store.Outbox()).Info("Order store enabled")
+	}
 
 	// Setup DLQ Producer
-	config := sarama.NewConfig()
+	config := a.KafkaConfig()
 	config.Producer.Return.Successes = true
 	var err error
-	producer, err = sarama.NewSyncProducer([]string{kafkaAddr}, config)
+	producer, err = sarama.NewSyncProducer([]string{a.KafkaAddr}, config)
 	if err != nil {
 		logger.WithError(err).Fatal("DLQ Producer failed")
 	}
+	a.OnShutdown("DLQ producer", func(context.Context) error { return producer.Close() })
+
+	// DLQ messages that fail to publish are spilled to the Redis list dlq:spill (up to
+	// DLQ_SPILL_MAX, default: 10000) and republished every DLQ_SPILL_REPUBLISH_INTERVAL (default: 10s)
+	dlqSpill = NewDLQSpill(redisClient, int64(getEnvInt("DLQ_SPILL_MAX", 10000)))
+	go dlqSpill.Run(ctx, getEnvDuration("DLQ_SPILL_REPUBLISH_INTERVAL", 10*time.Second))
+
+	// Outbox relay (ORDER_OUTBOX_POLL_INTERVAL, default: 500ms), stopped before the producer closes
+	if orderStore != nil && orderStore.Outbox() {
+		relayCtx, stopRelay := context.WithCancel(ctx)
+		relayDone := make(chan struct{})
+		go func() {
+			defer close(relayDone)
+			NewOrderOutboxRelay(orderStore, producer, getEnvDuration("ORDER_OUTBOX_POLL_INTERVAL", 500*time.Millisecond)).Run(relayCtx)
+		}()
+		a.OnShutdown("order outbox relay", func(shutdownCtx context.Context) error {
+			stopRelay()
+			select {
+			case <-relayDone:
+				return nil
+			case <-shutdownCtx.Done():
+				return shutdownCtx.Err()
+			}
+		})
+	}
+
+	// Shared connection pool for outbound HTTP clients (payment provider, fulfillment webhook)
+	// Configurable via environment: HTTP_CLIENT_* (see common.HTTPTransportConfigFromEnv)
+	httpTransport = common.NewHTTPTransport(common.HTTPTransportConfigFromEnv(), metrics.HTTPClients)
+	a.OnShutdown("outbound HTTP clients", func(context.Context) error {
+		httpTransport.CloseIdleConnections()
+		return nil
+	})
+
+	// Retention: orders older than ORDER_RETENTION_DAYS are soft-deleted and purged after
+	// ORDER_PURGE_GRACE_DAYS (default: 7); admin audit entries older than AUDIT_RETENTION_DAYS are
+	// purged. Passes run every RETENTION_INTERVAL (default: 1h) on one processor at a time
+	// Purged records are first archived to RETENTION_ARCHIVE_BUCKET when it is set
+	retentionPolicy := RetentionPolicy{
+		Orders:      time.Duration(getEnvInt("ORDER_RETENTION_DAYS", 0)) * 24 * time.Hour,
+		OrdersGrace: time.Duration(getEnvInt("ORDER_PURGE_GRACE_DAYS", 7)) * 24 * time.Hour,
+		AdminAudit:  time.Duration(getEnvInt("AUDIT_RETENTION_DAYS", 0)) * 24 * time.Hour,
+	}
+	if retentionPolicy.Orders > 0 || retentionPolicy.AdminAudit > 0 {
+		var archive *ObjectArchive
+		if bucket := os.Getenv("RETENTION_ARCHIVE_BUCKET"); bucket != "" {
+			archive, err = NewObjectArchive(os.Getenv("RETENTION_ARCHIVE_ENDPOINT"), bucket,
+				os.Getenv("RETENTION_ARCHIVE_PREFIX"), os.Getenv("RETENTION_ARCHIVE_REGION"), common.AWSCredentialsFromEnv(),
+				httpTransport.Client("retention_archive", getEnvDuration("RETENTION_ARCHIVE_TIMEOUT", 30*time.Second)))
+			if err != nil {
+				logger.WithError(err).Fatal("Invalid RETENTION_ARCHIVE_* configuration")
+			}
+		}
+		if retentionPolicy.Orders > 0 && orderStore == nil {
+			logger.Warn("ORDER_RETENTION_DAYS is set without ORDER_STORE_DSN, orders are not purged")
+		}
+		go NewRetentionJob(retentionPolicy, orderStore, archive, getEnvDuration("RETENTION_INTERVAL", time.Hour)).Run()
+		logger.WithFields(map[string]interface{}{
+			"order_retention": retentionPolicy.Orders.String(),
+			"audit_retention": retentionPolicy.AdminAudit.String(),
+			"archived":        archive != nil,
+		}).Info("Retention job enabled")
+	}
+
+	// Fulfillment integration for confirmed orders
+	// Configurable via environment: FULFILLMENT_MODE (off|kafka|webhook, default: off), FULFILLMENT_WEBHOOK_URL,
+	// FULFILLMENT_WEBHOOK_TIMEOUT (default: 5s), FULFILLMENT_WEBHOOK_RETRIES (default: 5),
+	// FULFILLMENT_QUEUE_SIZE (default: 10000)
+	if mode := os.Getenv("FULFILLMENT_MODE"); mode != "" && mode != FulfillmentOff {
+		fulfillment, err = NewFulfillmentPublisher(mode, os.Getenv("FULFILLMENT_WEBHOOK_URL"),
+			httpTransport.Client("fulfillment_webhook", getEnvDuration("FULFILLMENT_WEBHOOK_TIMEOUT", 5*time.Second)),
+			getEnvInt("FULFILLMENT_WEBHOOK_RETRIES", 5),
+			getEnvInt("FULFILLMENT_QUEUE_SIZE", 10000))
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to initialize fulfillment publisher")
+		}
+		// Queued webhooks are delivered before Redis closes (undeliverable events are stored there)
+		a.OnShutdown("fulfillment publisher", func(ctx context.Context) error {
+			fulfillment.Close(ctx)
+			return nil
+		})
+		logger.WithField("mode", fulfillment.Mode()).Info("Fulfillment publishing enabled")
+	}
+
+	// Payment provider: PAYMENT_PROVIDER_URL (default: simulated), PAYMENT_PROVIDER_TIMEOUT (default: 5s)
+	if providerURL := os.Getenv("PAYMENT_PROVIDER_URL"); providerURL != "" {
+		payments = NewHTTPPaymentProvider(providerURL, httpTransport.Client("payment", getEnvDuration("PAYMENT_PROVIDER_TIMEOUT", 5*time.Second)))
+	}
+	logger.WithField("provider", payments.Name()).Info("Payment provider initialized")
+
+	// Digital goods: confirmed orders get a code from digital_codes:{item_id}
+	// Configurable via environment: DIGITAL_ITEMS (comma-separated item IDs or "*"),
+	// DIGITAL_CODES_LOW_WATERMARK (default: 100)
+	var digitalItems []string
+	for _, itemID := range strings.Split(os.Getenv("DIGITAL_ITEMS"), ",") {
+		if itemID = strings.TrimSpace(itemID); itemID != "" {
+			digitalItems = append(digitalItems, itemID)
+		}
+	}
+	if len(digitalItems) > 0 {
+		digital = NewDigitalDelivery(digitalItems, int64(getEnvInt("DIGITAL_CODES_LOW_WATERMARK", 100)))
+		logger.WithField("items", digitalItems).Info("Digital goods delivery enabled")
+	}
 
 	// Consumer Setup
-	consumer, err := sarama.NewConsumer([]string{kafkaAddr}, nil)
+	// The client is kept separately so campaign topics can be discovered by refreshing its metadata
+	kafkaClient, err := sarama.NewClient([]string{a.KafkaAddr}, a.KafkaConfig())
 	if err != nil {
 		logger.WithError(err).Fatal("Consumer failed")
 	}
+	a.OnShutdown("Kafka client", func(context.Context) error { return kafkaClient.Close() })
+	consumer, err := sarama.NewConsumerFromClient(kafkaClient)
+	if err != nil {
+		logger.WithError(err).Fatal("Consumer failed")
+	}
+	a.OnShutdown("consumer", func(context.Context) error { return consumer.Close() })
+
+	// Inventory state publishing (INVENTORY_STATE_PUBLISH, default: false)
+	// Restore missing inventory keys from the compacted topic on startup (INVENTORY_STATE_RESTORE, default: false)
+	publishInventory = getEnvBool("INVENTORY_STATE_PUBLISH", false)
+	if getEnvBool("INVENTORY_STATE_RESTORE", false) {
+		restoreInventoryState(a.KafkaAddr, a.KafkaConfig())
+	}
 
-	partitionConsumer, err := consumer.ConsumePartition("orders", 0, sarama.OffsetNewest)
+	// Transparent decryption of order payloads encrypted by the gateway
+	// Keys: PAYLOAD_ENCRYPTION_KEYS / PAYLOAD_ENCRYPTION_KEYS_FILE (every key ID still in flight must be present)
+	payloadCipher, err = common.LoadPayloadCipher()
 	if err != nil {
-		logger.WithError(err).Fatal("Partition failed")
+		logger.WithError(err).Fatal("Failed to load payload encryption keys")
 	}
+	requireEncryption = getEnvBool("PAYLOAD_ENCRYPTION_REQUIRED", false)
 
-	// Initialize Prometheus metrics
-	metrics = common.InitProcessorMetrics()
+	// Verify gateway signatures so orders injected by other producers are never processed
+	// MESSAGE_SIGNATURE_FAILURE_ACTION (dlq|drop, default: dlq) controls what happens to them
+	signer, err = common.LoadMessageSigner()
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load message signing keys")
+	}
+	dropUnauthenticated = os.Getenv("MESSAGE_SIGNATURE_FAILURE_ACTION") == "drop"
+	if signer != nil {
+		logger.WithField("drop_unauthenticated", dropUnauthenticated).Info("Order signature verification enabled")
+	}
 
-	// Start metrics HTTP server for Prometheus scraping
-	go func() {
-		http.Handle("/metrics", promhttp.Handler())
-		if err := http.ListenAndServe(":9090", nil); err != nil {
-			logger.WithError(err).Error("Metrics server failed")
+	// Per-campaign channel reservations (CHANNEL_POLICY_FILE, optional)
+	if policyFile := os.Getenv("CHANNEL_POLICY_FILE"); policyFile != "" {
+		channelPolicies, err = LoadChannelPolicies(policyFile)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to load channel policies")
 		}
-	}()
+		logger.WithFields(map[string]interface{}{
+			"policy_file": policyFile,
+			"items":       len(channelPolicies),
+		}).Info("Channel policies loaded")
+	}
 
-	logger.Info("Processor started and ready to process orders")
+	// Per-buyer purchase caps, shared with the gateway (PURCHASE_CAP_PER_USER, PURCHASE_CAP_ITEMS,
+	// PURCHASE_CAP_WINDOW); the reservation checks and counts them
+	purchaseCaps, err = common.LoadPurchaseCaps()
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid PURCHASE_CAP_ITEMS")
+	}
+	if purchaseCaps.Enabled() {
+		logger.WithFields(map[string]interface{}{
+			"cap_per_user": purchaseCaps.PerUser,
+			"item_caps":    purchaseCaps.Items,
+			"window":       purchaseCaps.Window.String(),
+		}).Info("Purchase caps enabled")
+	}
 
-	// Setup graceful shutdown
-	shutdown := make(chan os.Signal, 1)
-	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
+	// Order SLA: target from gateway acceptance to terminal state (ORDER_SLA_TARGET, default: 30s)
+	// Breach events go to the order-sla-breaches topic when SLA_BREACH_PUBLISH=true (default: false)
+	slaTarget = getEnvDuration("ORDER_SLA_TARGET", slaTarget)
 
-	// Process messages in goroutine
-	done := make(chan bool)
-	go func() {
-		for msg := range partitionConsumer.Messages() {
-			processOrder(msg)
+	// Orders older than ORDER_MAX_AGE when consumed expire instead of reserving stock (default: 0, off)
+	orderMaxAge = getEnvDuration("ORDER_MAX_AGE", 0)
+	publishSLABreaches = getEnvBool("SLA_BREACH_PUBLISH", false)
+
+	// Consumed, reserved, charged and terminal stages in order timelines (ORDER_TIMELINE_ENABLED, default: false)
+	recordTimeline = getEnvBool("ORDER_TIMELINE_ENABLED", false)
+
+	// Order results go to the order-results topic for the notifier when ORDER_RESULTS_PUBLISH=true (default: false)
+	publishResults = getEnvBool("ORDER_RESULTS_PUBLISH", false)
+
+	// Processed markers let replays skip orders that already touched inventory (ORDER_PROCESSED_TTL, default: 7d)
+	processedOrderTTL = getEnvDuration("ORDER_PROCESSED_TTL", processedOrderTTL)
+
+	// Replay mode (-replay-from): re-read a time range after a bug fix, then exit without
+	// joining regular consumption
+	if replay != nil {
+		summary, err := runReplay(ctx, kafkaClient, consumer, *replay)
+		if err != nil {
+			logger.WithError(err).Fatal("Replay failed")
 		}
-		done <- true
-	}()
+		a.Shutdown()
+		out, _ := json.MarshalIndent(summary, "", "  ")
+		fmt.Println(string(out))
+		logger.WithFields(map[string]interface{}{
+			"event":             "replay_completed",
+			"mode":              summary.Mode,
+			"messages":          summary.Messages,
+			"processed":         summary.Processed,
+			"would_process":     summary.WouldProcess,
+			"already_processed": summary.AlreadyProcessed,
+		}).Info("Replay completed")
+		return
+	}
 
-	// Wait for shutdown signal or consumer to stop
-	select {
-	case <-shutdown:
-		logger.Info("Shutdown signal received, draining in-flight orders...")
+	// Consume every topic matching ORDER_TOPIC_PATTERN (default: orders, or orders plus
+	// orders-<campaign> with campaign topics); new matching topics are picked up every
+	// ORDER_TOPICS_REFRESH (default: 10s)
+	// Replicas share the partitions through the PROCESSOR_GROUP consumer group (default:
+	// flash-sale-processor), rebalance on scale-up and resume from committed offsets; partitions
+	// without a committed offset start at PROCESSOR_GROUP_INITIAL_OFFSET (oldest|newest, default: oldest)
+	campaignTopicsEnabled := getEnvBool("CAMPAIGN_TOPICS_ENABLED", false)
+	topicPattern := os.Getenv("ORDER_TOPIC_PATTERN")
+	if topicPattern == "" {
+		topicPattern = defaultOrderTopicPattern
+		if campaignTopicsEnabled {
+			topicPattern = defaultCampaignOrderTopicPattern
+		}
+	}
+	// Orders are processed by PROCESSOR_WORKERS workers (default: 1), routed by item_id
+	workerCount := max(getEnvInt("PROCESSOR_WORKERS", 1), 1)
+
+	groupID := os.Getenv("PROCESSOR_GROUP")
+	if groupID == "" {
+		groupID = defaultProcessorGroup
+	}
+	groupConfig := a.KafkaConfig()
+	groupConfig.Consumer.Offsets.Initial = sarama.OffsetOldest
+	if os.Getenv("PROCESSOR_GROUP_INITIAL_OFFSET") == "newest" {
+		groupConfig.Consumer.Offsets.Initial = sarama.OffsetNewest
+	}
+	groupConfig.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategySticky()}
+	group, err := sarama.NewConsumerGroup([]string{a.KafkaAddr}, groupID, groupConfig)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to create consumer group")
+	}
+	orderGroup := NewOrderGroup(group, kafkaClient, workerCount*workerQueueSize)
+	var orderConsumers OrderSource = orderGroup
+	a.Health.Register("kafka", func(context.Context) error {
+		if len(orderGroup.Topics()) == 0 {
+			return errors.New("no order topics consumed")
+		}
+		if !orderGroup.Active() {
+			return errors.New("not in a consumer group session")
+		}
+		return nil
+	})
+	consumeFields := map[string]interface{}{"group": groupID}
+	a.Health.Detail("topics", func() interface{} { return orderConsumers.Topics() })
+	subscription, err := NewTopicSubscription(topicPattern, kafkaClient, orderConsumers)
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid ORDER_TOPIC_PATTERN")
+	}
+	if err := subscription.Start(); err != nil {
+		logger.WithError(err).Fatal("Partition failed")
+	}
+	topicsCtx, stopTopics := context.WithCancel(ctx)
+	a.OnShutdown("order topics", func(context.Context) error {
+		stopTopics()
+		return nil
+	})
+	go subscription.Run(topicsCtx, getEnvDuration("ORDER_TOPICS_REFRESH", 10*time.Second))
+	consumeFields["pattern"] = subscription.Pattern()
+	consumeFields["topics"] = orderConsumers.Topics()
+	logger.WithFields(consumeFields).Info("Consuming order partitions")
 
-		// Close consumer (stops receiving new messages)
-		if err := partitionConsumer.Close(); err != nil {
-			logger.WithError(err).Error("Error closing partition consumer")
+	// Per-campaign order topics (orders-<campaign>) created and retired through the admin API
+	// Configurable via environment: CAMPAIGN_TOPICS_ENABLED (default: false),
+	// CAMPAIGN_TOPICS_REFRESH (default: 10s), CAMPAIGN_TOPIC_GRACE (default: 24h after the campaign ends)
+	if campaignTopicsEnabled {
+		if !subscription.Matches(common.CampaignTopicName("campaign")) {
+			logger.WithField("pattern", subscription.Pattern()).Warn("ORDER_TOPIC_PATTERN doesn't match campaign topics, their orders won't be processed here")
 		}
-		if err := consumer.Close(); err != nil {
-			logger.WithError(err).Error("Error closing consumer")
+		campaignTopics = NewCampaignTopicManager([]string{a.KafkaAddr}, kafkaClient, subscription, groupID, getEnvDuration("CAMPAIGN_TOPIC_GRACE", 24*time.Hour))
+		// Ended campaigns' orders and DLQ entries are exported to CAMPAIGN_EXPORT_BUCKET (optional)
+		// CAMPAIGN_EXPORT_DELAY (default: 15m) after they end; CAMPAIGN_EXPORT_REGION,
+		// CAMPAIGN_EXPORT_ENDPOINT, CAMPAIGN_EXPORT_PREFIX, CAMPAIGN_EXPORT_TIMEOUT (default: 60s)
+		if bucket := os.Getenv("CAMPAIGN_EXPORT_BUCKET"); bucket != "" {
+			archive, err := NewObjectArchive(os.Getenv("CAMPAIGN_EXPORT_ENDPOINT"), bucket, "",
+				os.Getenv("CAMPAIGN_EXPORT_REGION"), common.AWSCredentialsFromEnv(),
+				httpTransport.Client("campaign_export", getEnvDuration("CAMPAIGN_EXPORT_TIMEOUT", 60*time.Second)))
+			if err != nil {
+				logger.WithError(err).Fatal("Invalid CAMPAIGN_EXPORT_* configuration")
+			}
+			if orderStore == nil {
+				logger.Warn("ORDER_STORE_DSN not set, campaign exports only include the DLQ")
+			}
+			campaignTopics.exporter = NewCampaignExporter(archive, os.Getenv("CAMPAIGN_EXPORT_PREFIX"), orderStore, kafkaClient,
+				getEnvDuration("CAMPAIGN_EXPORT_DELAY", 15*time.Minute))
+			logger.WithField("bucket", bucket).Info("Campaign exports enabled")
 		}
+		go campaignTopics.Run(topicsCtx, getEnvDuration("CAMPAIGN_TOPICS_REFRESH", 10*time.Second))
+		logger.Info("Campaign topics enabled")
+	}
 
-		// Wait for current message processing to complete (with timeout)
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
+	// Safety audit mode records cross-instance processing facts for the multi-instance harness
+	if getEnvBool("PROCESSOR_SAFETY_AUDIT", false) {
+		auditor = NewSafetyAuditor(redisClient)
+		logger.Warn("Safety audit mode enabled - not intended for production")
+	}
 
-		select {
-		case <-done:
-			logger.Info("All orders processed")
-		case <-shutdownCtx.Done():
-			logger.Warn("Shutdown timeout reached, some orders may not be processed")
+	// Retry topics (ORDER_RETRY_MAX_ATTEMPTS, default: 0, disabled): orders failing on a Redis
+	// timeout or failure or a payment timeout are retried after 5s, 1m, then every 10m before
+	// they go to the DLQ; every processor consumes the retry topics in one consumer group
+	orderRetryMaxAttempts = getEnvInt("ORDER_RETRY_MAX_ATTEMPTS", 0)
+	// Retried orders are run by the order workers; nil (never ready) without retry topics
+	var retryOrders chan queuedRetry
+	if orderRetryMaxAttempts > 0 {
+		retryOrders = make(chan queuedRetry)
+		config := a.KafkaConfig()
+		config.Consumer.Offsets.Initial = sarama.OffsetOldest
+		group, err := sarama.NewConsumerGroup([]string{a.KafkaAddr}, orderRetryGroup, config)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to create order retry consumer group")
 		}
+		retryConsumer := NewOrderRetryConsumer(retryOrders)
+		retryCtx, stopRetries := context.WithCancel(ctx)
+		retriesStopped := make(chan struct{})
+		go func() {
+			retryConsumer.Consume(retryCtx, group)
+			close(retriesStopped)
+		}()
+		// Registered after the producer, so retried orders finish before it closes
+		a.OnShutdown("order retry consumer", func(shutdownCtx context.Context) error {
+			stopRetries()
+			select {
+			case <-retriesStopped:
+			case <-shutdownCtx.Done():
+			}
+			return group.Close()
+		})
+		a.Health.Detail("order_retry_active", func() interface{} { return retryConsumer.Active() })
+		logger.WithField("max_attempts", orderRetryMaxAttempts).Info("Order retry topics enabled")
+	}
 
-		// Close connections
-		if err := producer.Close(); err != nil {
-			logger.WithError(err).Error("Error closing DLQ producer")
+	// Delivery audit (DELIVERY_AUDIT_ENABLED, default: false): tails every order topic this
+	// processor consumes (campaign topics included) and the retry topics in its own consumer group and reports orders without a terminal status DELIVERY_AUDIT_DEADLINE
+	// (default: 5m) after they were consumed, checked every DELIVERY_AUDIT_INTERVAL (default: 30s)
+	if getEnvBool("DELIVERY_AUDIT_ENABLED", false) {
+		config := a.KafkaConfig()
+		config.Consumer.Offsets.Initial = sarama.OffsetNewest
+		group, err := sarama.NewConsumerGroup([]string{a.KafkaAddr}, deliveryAuditGroup, config)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to create delivery audit consumer group")
 		}
-		if err := redisClient.Close(); err != nil {
-			logger.WithError(err).Error("Error closing Redis client")
+		a.OnShutdown("delivery audit consumer group", func(context.Context) error { return group.Close() })
+		deliveryAuditor = NewDeliveryAuditor(redisClient, getEnvDuration("DELIVERY_AUDIT_DEADLINE", 5*time.Minute))
+		auditCtx, stopAudit := context.WithCancel(ctx)
+		a.OnShutdown("delivery audit", func(context.Context) error {
+			stopAudit()
+			return nil
+		})
+		go deliveryAuditor.Consume(auditCtx, group, func() []string {
+			topics := orderConsumers.Topics()
+			if orderRetryMaxAttempts > 0 {
+				for _, tier := range orderRetryTiers {
+					topics = append(topics, tier.Topic)
+				}
+			}
+			return topics
+		})
+		go deliveryAuditor.Run(auditCtx, getEnvDuration("DELIVERY_AUDIT_INTERVAL", 30*time.Second))
+		a.Health.Detail("delivery_audit_active", func() interface{} { return deliveryAuditor.Active() })
+		logger.WithField("deadline", deliveryAuditor.deadline.String()).Info("Delivery audit enabled")
+	}
+
+	// Admin API on the metrics server, protected by role-based bearer tokens (ADMIN_TOKEN_SECRET, optional)
+	adminAuth := a.AdminAuth()
+	a.RegisterEndpoints(adminAuth)
+	if adminAuth != nil {
+		// Gateway rate limit exemption tokens are issued here (RATE_LIMIT_EXEMPTION_SECRET, optional)
+		if secret := os.Getenv("RATE_LIMIT_EXEMPTION_SECRET"); secret != "" {
+			rateLimitExemptions, err = common.NewRateLimitExemptions(secret, redisClient)
+			if err != nil {
+				logger.WithError(err).Fatal("Invalid RATE_LIMIT_EXEMPTION_SECRET")
+			}
 		}
+		// POST /admin/dlq/replay retries an order at most DLQ_REPLAY_MAX_ATTEMPTS times (default: 3)
+		dlqReplayer = NewDLQReplayer(kafkaClient, getEnvInt("DLQ_REPLAY_MAX_ATTEMPTS", 3))
+		registerAdminAPI(a.Mux, adminAuth)
+		// Admin mutations are appended to the admin:audit stream (ADMIN_AUDIT_MAX_ENTRIES, default: 0, unbounded)
+		adminAuditMaxEntries = int64(getEnvInt("ADMIN_AUDIT_MAX_ENTRIES", 0))
+		// POST /admin/selftest waits SELFTEST_TIMEOUT (default: 10s) for its synthetic order
+		selftestTimeout = getEnvDuration("SELFTEST_TIMEOUT", selftestTimeout)
+		logger.Info("Admin API enabled on :9090/admin")
+	}
+
+	// Metrics, health and admin server
+	a.Serve(&http.Server{Addr: ":9090"}, nil)
+
+	// Runtime control channel: pause/resume items, drain, reload scripts without restarting
+	// Configurable via environment: PROCESSOR_CONTROL_ENABLED (default: false),
+	// CONTROL_CHANNEL (default: processor:control), CONTROL_MAX_PARKED (default: 10000 per item)
+	var controlCommands <-chan ControlCommand
+	if getEnvBool("PROCESSOR_CONTROL_ENABLED", false) {
+		channel := os.Getenv("CONTROL_CHANNEL")
+		if channel == "" {
+			channel = "processor:control"
+		}
+		control = NewProcessorControl(channel, getEnvInt("CONTROL_MAX_PARKED", 10000), orderConsumers)
+		controlCommands = control.Commands()
+		go control.Listen()
+		parkedCtx, stopParked := context.WithCancel(ctx)
+		a.OnShutdown("parked orders", func(context.Context) error {
+			stopParked()
+			return nil
+		})
+		go control.Run(parkedCtx, orderKeyRefreshInterval)
+		logger.WithField("channel", channel).Info("Processor control channel enabled")
+	}
 
-		logger.Info("Processor shutdown complete")
-	case <-done:
-		logger.Info("Consumer stopped")
+	// Canary: a synthetic order every CANARY_INTERVAL (default: 0, off), waiting up to
+	// CANARY_TIMEOUT (default: 10s) for its result
+	if interval := getEnvDuration("CANARY_INTERVAL", 0); interval > 0 {
+		go runCanary(interval, getEnvDuration("CANARY_TIMEOUT", 10*time.Second))
+		logger.WithField("interval", interval.String()).Info("Canary orders enabled")
 	}
+
+	logger.Info("Processor started and ready to process orders")
+
+	// Messages from every consumed topic and partition and retried orders, dispatched to the
+	// workers by item_id
+	messages := orderConsumers.Messages()
+	workers := NewOrderWorkers(workerCount, orderConsumers)
+	logger.WithField("workers", workerCount).Info("Order workers started")
+
+	// Dispatch messages in goroutine; drained is closed once the consumers have stopped and
+	// the workers have finished
+	drained := make(chan struct{})
+	// Control commands are applied while no order is processing so they never race with it
+	go func() {
+		for {
+			select {
+			case msg, ok := <-messages:
+				if !ok {
+					workers.Close()
+					close(drained)
+					return
+				}
+				// Offsets are audited here, in partition order, since workers finish out of order
+				if auditor != nil {
+					auditConsumedOffset(msg)
+				}
+				workers.Submit(msg)
+			case retry := <-retryOrders:
+				workers.SubmitFunc(retry.msg, func() { close(retry.done) })
+			case cmd := <-controlCommands:
+				workers.Idle()
+				control.Apply(cmd)
+			}
+		}
+	}()
+
+	// On shutdown the consumers stop receiving first, then the queued orders finish
+	a.OnShutdown("in-flight orders", func(ctx context.Context) error {
+		select {
+		case <-drained:
+			logger.Info("All orders processed")
+			return nil
+		case <-ctx.Done():
+			return errors.New("shutdown timeout reached, some orders may not be processed")
+		}
+	})
+	a.OnShutdown("order consumers", func(context.Context) error {
+		orderConsumers.Close()
+		return nil
+	})
+
+	a.Run(drained)
 }
 
 func processOrder(msg *sarama.ConsumerMessage) {
@@ -143,130 +648,578 @@ func processOrder(msg *sarama.ConsumerMessage) {
 	// Extract correlation ID from Kafka headers
 	correlationID := extractCorrelationID(msg.Headers)
 	logEntry := common.WithEvent(correlationID, "order_processing_started")
+	// Redis calls made with ctx below (reservation, confirmation, refunds) carry the correlation
+	// ID into slow-command logs
+	ctx := common.ContextWithCorrelationID(ctx, correlationID)
+
+	// Verify before anything else reads the message: an unauthenticated message must not be able to
+	// notify gateways or affect inventory
+	if signer != nil {
+		if err := signer.VerifyMessage(msg); err != nil {
+			rejectUnauthenticated(logEntry, msg, err, correlationID)
+			return
+		}
+	}
+
+	payload, err := decryptOrderPayload(msg)
+	if err != nil {
+		logEntry.WithError(err).WithField("event", "order_decrypt_failed").Error("Failed to decrypt order")
+		moveToDLQ(msg, "Decryption Failed", correlationID)
+		return
+	}
 
-	var order OrderRequest
-	if err := json.Unmarshal(msg.Value, &order); err != nil {
+	order, err := decodeOrder(msg, payload)
+	if err != nil {
 		logEntry.WithError(err).WithField("event", "order_unmarshal_failed").Error("Failed to unmarshal order")
 		moveToDLQ(msg, "Invalid Order Format", correlationID)
 		return
 	}
 
+	// Messages published before quantities were carried through the pipeline have no amount
+	if order.Amount == 0 {
+		order.Amount = 1
+	}
+	if order.Channel == "" {
+		order.Channel = common.DefaultChannel
+	}
+	if order.Amount < 0 {
+		logEntry.WithField("amount", order.Amount).WithField("event", "order_invalid_quantity").Error("Order has negative quantity")
+		moveToDLQ(msg, "Invalid Order Format", correlationID)
+		return
+	}
+	if !validCartLines(&order) {
+		logEntry.WithField("event", "order_invalid_cart").Error("Cart order lines are invalid")
+		moveToDLQ(msg, "Invalid Order Format", correlationID)
+		return
+	}
+
 	logEntry = logEntry.WithFields(map[string]interface{}{
 		"user_id":            order.UserID,
+		"recipient_user_id":  order.RecipientUserID,
 		"item_id":            order.ItemID,
+		"amount":             order.Amount,
+		"channel":            order.Channel,
+		"device_id":          order.DeviceID,
+		"metadata":           order.Metadata,
 		"message_size_bytes": len(msg.Value),
 		"kafka_offset":       msg.Offset,
 		"kafka_partition":    msg.Partition,
+		"client_ip":          extractClientIP(msg.Headers),
 	})
 
+	// Sharded keys (item_id#shard) only spread a hot item across partitions; the key must
+	// still name the payload's item so every shard reserves from the same inventory key
+	if keyItemID := itemIDFromKey(msg.Key); keyItemID != "" && keyItemID != order.ItemID {
+		logEntry.WithFields(map[string]interface{}{
+			"event":       "order_key_mismatch",
+			"key_item_id": keyItemID,
+		}).Error("Message key does not match order item")
+		releasePurchaseCap(logEntry, msg, &order)
+		moveToDLQ(msg, "Invalid Order Format", correlationID)
+		return
+	}
+	if keyUserID, ok := strings.CutPrefix(string(msg.Key), common.UserKeyPrefix); ok && keyUserID != order.UserID {
+		logEntry.WithFields(map[string]interface{}{
+			"event":       "order_key_mismatch",
+			"key_user_id": keyUserID,
+		}).Error("Message key does not match order user")
+		releasePurchaseCap(logEntry, msg, &order)
+		moveToDLQ(msg, "Invalid Order Format", correlationID)
+		return
+	}
+
+	// Synthetic orders (self-test) only exercise the pipeline; see selftest.go
+	if isSyntheticOrder(msg) {
+		processSyntheticOrder(logEntry, msg, &order)
+		return
+	}
+
+	// Paused items: hold the order until an operator resumes the item (any item of a cart)
+	if control != nil {
+		for _, itemID := range orderItems(&order) {
+			if control.Park(logEntry, itemID, msg) {
+				return
+			}
+		}
+	}
+
+	// Amendments: claim the order so the client can no longer change it, then apply any change
+	// made while it was queued
+	amendment, err := claimOrder(msg)
+	if err != nil {
+		redisHealth.Observe(err)
+		logEntry.WithError(err).Error("Failed to claim order for processing")
+		if !retryOrder(logEntry, msg, "Redis Failure") {
+			releasePurchaseCap(logEntry, msg, &order)
+			moveToDLQ(msg, "Redis Failure", correlationID)
+		}
+		return
+	}
+	if amendment != nil {
+		if !applyAmendment(logEntry, msg, &order, amendment) {
+			return
+		}
+		logEntry = logEntry.WithField("amount", order.Amount)
+	}
+
+	// Mark the order processed so replays can skip it; during a live replay this skips
+	// orders that were processed before (see replay.go), otherwise duplicate copies of the
+	// order (see idempotency.go)
+	requestID := extractRequestID(msg.Headers)
+	if !recordOrderProcessing(logEntry, msg, &order, requestID) {
+		return
+	}
+	defer keepOrderKeys(requestID)()
+	recordTimelineStage(msg, common.TimelineConsumed, startTime, "")
+
+	// Stale orders (e.g. a backlog drained hours after an outage) must not take stock the sale
+	// has since moved past; the order is settled as EXPIRED instead
+	if reason := orderExpiry(msg, time.Now()); reason != "" {
+		expireOrder(logEntry, msg, &order, reason)
+		return
+	}
+
 	logEntry.Info("Processing order")
 
+	// Safety audit: detect double-processing across instances (offsets are audited on dispatch)
+	if auditor != nil {
+		auditOrder(logEntry, msg)
+	}
+
 	// Track order processing
 	metrics.OrdersProcessed.Inc()
 
-	// Atomic inventory check using Redis Lua script
-	// Lua script ensures DECR and conditional INCR (refund) are atomic
-	// This prevents race conditions where inventory could go negative
+	if len(order.Lines) > 0 {
+		processCartOrder(ctx, logEntry, msg, &order, requestID, correlationID, startTime)
+		return
+	}
+
+	// Atomic inventory reservation: the store guarantees the check and decrement can't race,
+	// so inventory never goes negative
 	// Edge cases handled: missing keys, Redis OOM, timeouts
-	inventoryKey := "inventory:" + order.ItemID
 
-	// Add timeout context for script execution (5 seconds)
-	// Prevents hanging if Redis is slow or unresponsive
+	// Add timeout context for the reservation (5 seconds)
+	// Prevents hanging if the store is slow or unresponsive
 	scriptCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	result, err := checkInventoryScript.Run(scriptCtx, redisClient, []string{inventoryKey}).Result()
+	reservation, err := inventory.Reserve(scriptCtx, ReserveRequest{
+		ItemID:   order.ItemID,
+		Channel:  order.Channel,
+		Amount:   order.Amount,
+		Reserves: channelReserves(order.ItemID, order.Channel),
+		// Recorded so the refund returns exactly the buckets the reservation drew from
+		RequestID: requestID,
+		UserID:    order.UserID,
+		Cap:       reserveCap(msg, &order, requestID),
+		CapWindow: purchaseCaps.Window,
+	})
 
 	if err != nil {
-		// Handle Redis errors (OOM, timeout, connection issues)
-		if err == context.DeadlineExceeded {
-			logEntry.WithError(err).Error("Redis script execution timeout")
-			moveToDLQ(msg, "Redis Timeout", correlationID)
-		} else {
-			logEntry.WithError(err).Error("Redis script execution failed")
-			moveToDLQ(msg, "Redis Failure", correlationID)
+		// The reservation may still have run (a timeout after Redis applied it); it is recorded under
+		// request_id, so a retry or replay continues with it rather than reserving again
+		forgetOrderProcessing(requestID)
+		// Timeouts and failures are retried on the retry topics first (see retry_topics.go)
+		failure := reservationFailure(logEntry, err)
+		if !retryOrder(logEntry, msg, failure) {
+			releaseUncertainReservation(logEntry, &order, requestID)
+			releasePurchaseCap(logEntry, msg, &order)
+			moveToDLQ(msg, failure, correlationID)
 		}
 		return
 	}
 
-	// Parse Lua script result: {success: 0|1, stock: int, reason: string}
-	// success=0 means sold out or not initialized (already refunded by script)
-	// success=1 means inventory reserved successfully
-	results := result.([]interface{})
-	success := results[0].(int64)
-	stock := results[1].(int64)
-	reason := "UNKNOWN"
-	if len(results) > 2 {
-		// Handle both string and []byte types from Redis
-		switch v := results[2].(type) {
-		case string:
-			reason = v
-		case []byte:
-			reason = string(v)
-		default:
-			reason = "UNKNOWN"
-		}
-	}
-
-	if success == 0 {
-		// Item sold out or not initialized - Lua script already handled refund
-		metrics.OrdersSoldOut.Inc()
+	stock := reservation.Stock
+	reason := reservation.Reason
+	logEntry = logEntry.WithField("inventory_version", reservation.Version)
+
+	if !reservation.Reserved {
+		// Item sold out or not initialized - stock was left unchanged
+		if reason == "SOLD_OUT" || reason == "CHANNEL_RESERVED" {
+			// Stock is unchanged by the refund, so the current level is stock + amount
+			publishInventoryState(logEntry, order.ItemID, stock+order.Amount)
+		}
+		publishOrderResultWithStock(msg, order.ItemID, common.ResultFailedSoldOut, reason, stock+order.Amount)
+		releasePurchaseCap(logEntry, msg, &order)
+		recordOrderSLA(msg, order.ItemID, outcomeSoldOut)
+		event := "order_sold_out"
+		if reason == "PURCHASE_LIMIT" {
+			// The buyer's cap is used up by reservations since the gateway admitted the order
+			event = "order_purchase_limit"
+		} else {
+			metrics.OrdersSoldOut.Inc()
+		}
+		metrics.Orders.Record(common.OrderOutcomeSoldOut, order.ItemID, extractCampaign(msg))
+		metrics.OrdersByChannel.WithLabelValues(order.Channel, outcomeSoldOut).Inc()
 		metrics.OrdersProcessedFailed.Inc()
 		logEntry.WithFields(map[string]interface{}{
 			"stock":  stock,
 			"reason": reason,
-			"event":  "order_sold_out",
+			"event":  event,
 		}).Warn("Order failed: Item unavailable")
 		return
 	}
 
-	// Update inventory level metric
-	metrics.InventoryLevels.WithLabelValues(order.ItemID).Set(float64(stock))
+	// Update inventory level metric (busiest items only, see ItemLabelGuard)
+	if metrics.ItemLabels.Labeled(order.ItemID) {
+		metrics.InventoryLevels.WithLabelValues(order.ItemID).Set(float64(stock))
+	}
+	publishInventoryState(logEntry, order.ItemID, stock)
+
+	if reason == "ALREADY_RESERVED" {
+		// An earlier attempt reserved before its call failed; its units are this order's
+		logEntry.WithField("event", "reservation_reused").Info("Continuing with the order's earlier reservation")
+	} else if auditor != nil {
+		auditor.RecordReservation(ctx, order.ItemID, order.Amount)
+	}
 
 	logEntry.WithField("stock_after", stock).Info("Inventory reserved successfully")
+	publishOrderResultWithStock(msg, order.ItemID, common.ResultReserved, "", stock)
 
-	// Simulate payment processing (in production, this would call payment service)
-	// For demonstration: 10% of orders fail to simulate payment service timeouts
-	if time.Now().Unix()%10 == 0 {
-		logEntry.Warn("Payment Service Timeout! Moving to DLQ.")
+	// Charge the order; the idempotency key derived from request_id guarantees retries and DLQ
+	// redrives never charge twice (the simulated provider fails 10% of charges with a timeout)
+	charge, chargeErr := chargeOrder(logEntry, msg, &order)
+	if chargeErr != nil || charge.Status != ChargeSucceeded {
+		dlqReason := paymentFailure(logEntry, charge, chargeErr)
 
-		// Refund inventory atomically using Lua script
+		// Refund inventory atomically
 		// Ensures inventory is restored even if refund operation is interrupted
-		refundScript := redis.NewScript(luaRefundInventoryScript)
 		refundCtx, refundCancel := context.WithTimeout(ctx, 5*time.Second)
 		defer refundCancel()
 
-		refundResult, refundErr := refundScript.Run(refundCtx, redisClient, []string{inventoryKey}, 1).Result()
+		newStock, refundErr := inventory.Refund(refundCtx, RefundRequest{
+			ItemID:    order.ItemID,
+			Channel:   order.Channel,
+			UserID:    order.UserID,
+			RequestID: requestID,
+			Amount:    order.Amount,
+		})
 		if refundErr != nil {
-			if refundErr == context.DeadlineExceeded {
+			if errors.Is(refundErr, ErrNoReservation) {
+				logEntry.WithField("event", "refund_nothing_reserved").Warn("Order holds no reservation, nothing to refund")
+			} else if refundErr == context.DeadlineExceeded {
 				logEntry.WithError(refundErr).Error("Inventory refund timeout")
 			} else {
+				redisHealth.Observe(refundErr)
 				logEntry.WithError(refundErr).Error("Failed to refund inventory")
 			}
 		} else {
-			// Parse refund result: {success: 0|1, new_stock: int}
-			if refundResult != nil {
-				refundResults := refundResult.([]interface{})
-				if len(refundResults) >= 2 {
-					newStock := refundResults[1].(int64)
-					logEntry.WithField("new_stock", newStock).Info("Inventory refunded successfully")
-				}
+			logEntry.WithField("new_stock", newStock).Info("Inventory refunded successfully")
+			publishInventoryState(logEntry, order.ItemID, newStock)
+			refreshInventoryProjection(logEntry, order.ItemID)
+			if err := common.NotifyRestock(ctx, redisClient, order.ItemID, order.Amount); err != nil {
+				logEntry.WithError(err).Warn("Failed to notify waitlist of refunded units")
+			}
+			if auditor != nil {
+				auditor.RecordReservation(ctx, order.ItemID, -order.Amount)
 			}
 		}
 
-		// Move failed order to Dead Letter Queue for manual review/retry
-		moveToDLQ(msg, "Payment Timeout", correlationID)
+		// Refunded payment timeouts are retried: the refund took the units off the purchase cap and
+		// the retry counts them again when it reserves. Otherwise move the failed order to the Dead
+		// Letter Queue for manual review/retry
+		holdsNoStock := refundErr == nil || errors.Is(refundErr, ErrNoReservation)
+		if holdsNoStock && retryOrder(logEntry, msg, dlqReason) {
+			return
+		}
+		releasePurchaseCap(logEntry, msg, &order)
+		metrics.OrdersByChannel.WithLabelValues(order.Channel, outcomePaymentFailed).Inc()
+		moveToDLQ(msg, dlqReason, correlationID)
 		return
 	}
 
+	recordTimelineStage(msg, common.TimelineCharged, time.Now(), charge.ChargeID)
+
+	// Paid: the held units are now sold
+	confirmInventory(logEntry, order.ItemID, requestID, order.Amount)
+
+	if order.RecipientUserID != "" {
+		recordGift(logEntry, msg, &order)
+	}
+
+	// Digital items are delivered immediately as a code; physical ones go to fulfillment systems
+	if digital != nil && digital.IsDigital(order.ItemID) {
+		deliverDigitalCode(logEntry, msg, order.ItemID)
+	} else {
+		publishFulfillment(logEntry, msg, &order)
+	}
+
+	publishOrderResultWithStock(msg, order.ItemID, common.ResultCompleted, "", stock)
+
 	// Log success with processing time
 	processingTime := time.Since(startTime)
+	recordOrderSLA(msg, order.ItemID, outcomeCompleted)
+	metrics.OrdersByChannel.WithLabelValues(order.Channel, outcomeCompleted).Inc()
+	metrics.Orders.Record(common.OrderOutcomeConfirmed, order.ItemID, extractCampaign(msg))
 	logEntry.WithFields(map[string]interface{}{
 		"event":              "order_processed_success",
 		"processing_time_ms": processingTime.Milliseconds(),
 	}).Info("Order processed successfully")
 }
 
+// reservationFailure logs a failed reservation call and returns its DLQ reason
+// Redis errors are OOM, timeouts and connection issues
+func reservationFailure(logEntry *logrus.Entry, err error) string {
+	switch {
+	case err == context.DeadlineExceeded:
+		logEntry.WithError(err).Error("Redis script execution timeout")
+		return "Redis Timeout"
+	case redisHealth.Observe(err):
+		// The script was rejected before it ran: the order can be replayed from the DLQ once
+		// memory is freed
+		logEntry.WithError(err).WithField("event", "redis_oom").Error("Redis out of memory, inventory not reserved")
+		return "Redis OOM"
+	default:
+		logEntry.WithError(err).Error("Redis script execution failed")
+		return "Redis Failure"
+	}
+}
+
+// paymentFailure logs a charge that didn't succeed and returns its DLQ reason
+// An unknown outcome (error or pending charge) is a timeout: a redrive looks the charge up under
+// the same key instead of charging again
+func paymentFailure(logEntry *logrus.Entry, charge ChargeResult, chargeErr error) string {
+	switch {
+	case chargeErr != nil:
+		logEntry.WithError(chargeErr).Warn("Payment Service Timeout! Moving to DLQ.")
+	case charge.Status == ChargePending:
+		logEntry.WithField("charge_id", charge.ChargeID).Warn("Payment still pending! Moving to DLQ.")
+	default:
+		logEntry.WithField("payment_status", charge.Status).Warn("Payment declined! Moving to DLQ.")
+		return "Payment Declined"
+	}
+	return "Payment Timeout"
+}
+
+// rejectUnauthenticated drops or dead-letters a message that failed signature verification
+// Its headers are untrusted, so no order result or SLA outcome is published for it
+func rejectUnauthenticated(logEntry *logrus.Entry, msg *sarama.ConsumerMessage, err error, correlationID string) {
+	metrics.UnauthenticatedOrders.Inc()
+	logEntry.WithError(err).WithFields(map[string]interface{}{
+		"event":           "order_signature_invalid",
+		"kafka_offset":    msg.Offset,
+		"kafka_partition": msg.Partition,
+		"dropped":         dropUnauthenticated,
+	}).Error("Rejecting unauthenticated order message")
+	if dropUnauthenticated {
+		return
+	}
+	RecordFailure("Invalid Signature")
+	sendToDLQ(msg, "Invalid Signature", correlationID)
+}
+
+// decryptOrderPayload returns the plaintext order of msg
+// Plaintext messages pass through unless PAYLOAD_ENCRYPTION_REQUIRED is set
+func decryptOrderPayload(msg *sarama.ConsumerMessage) ([]byte, error) {
+	if !common.IsEncrypted(msg.Headers) {
+		if requireEncryption {
+			return nil, common.ErrPayloadNotEncrypted
+		}
+		return msg.Value, nil
+	}
+	if payloadCipher == nil {
+		return nil, fmt.Errorf("%w: no decryption keys configured", common.ErrUnknownKeyID)
+	}
+	return payloadCipher.DecryptMessage(msg)
+}
+
+// auditOrder records that a consumed order is processed and logs double-processing
+// Audit failures are logged but never block order processing
+func auditOrder(logEntry *logrus.Entry, msg *sarama.ConsumerMessage) {
+	requestID := extractRequestID(msg.Headers)
+	if requestID == "" {
+		return
+	}
+	duplicate, err := auditor.RecordProcessed(ctx, requestID)
+	if err != nil {
+		logEntry.WithError(err).Warn("Safety audit double-processing check failed")
+	} else if duplicate {
+		logEntry.WithFields(map[string]interface{}{
+			"event":      "audit_double_processed",
+			"request_id": requestID,
+		}).Error("Safety audit: order processed more than once")
+	}
+}
+
+// auditConsumedOffset checks msg's offset for regressions and gaps in its partition
+func auditConsumedOffset(msg *sarama.ConsumerMessage) {
+	offsetStatus, err := auditor.RecordConsumed(ctx, msg.Topic, msg.Partition, msg.Offset)
+	logEntry := common.WithCorrelationID(extractCorrelationID(msg.Headers)).WithFields(map[string]interface{}{
+		"topic":     msg.Topic,
+		"partition": msg.Partition,
+		"offset":    msg.Offset,
+	})
+	if err != nil {
+		logEntry.WithError(err).Warn("Safety audit offset check failed")
+	} else if offsetStatus != "ok" {
+		logEntry.WithFields(map[string]interface{}{
+			"event":        "audit_offset_anomaly",
+			"offset_check": offsetStatus,
+		}).Error("Safety audit: offset anomaly detected")
+	}
+}
+
+// publishInventoryState publishes the item's current stock to the compacted inventory-state topic
+// Failures are logged only: Redis remains the source of truth and the next change republishes
+func publishInventoryState(logEntry *logrus.Entry, itemID string, stock int64) {
+	if !publishInventory {
+		return
+	}
+	msg, err := common.NewInventoryStateMessage(itemID, stock)
+	if err == nil {
+		_, _, err = producer.SendMessage(msg)
+	}
+	if err != nil {
+		logEntry.WithError(err).WithField("event", "inventory_state_publish_failed").Warn("Failed to publish inventory state")
+	}
+}
+
+// publishOrderResult fans the order's outcome out to gateways waiting on its request_id
+// Failures are logged only: waiting gateways fall back to their ack timeout
+func publishOrderResult(msg *sarama.ConsumerMessage, itemID, status, reason string) {
+	sendOrderResult(msg, common.OrderResult{
+		RequestID: extractRequestID(msg.Headers),
+		ItemID:    itemID,
+		Status:    status,
+		Reason:    reason,
+	})
+}
+
+// publishOrderResultWithStock publishes a result carrying the item's stock after the order
+func publishOrderResultWithStock(msg *sarama.ConsumerMessage, itemID, status, reason string, stock int64) {
+	sendOrderResult(msg, common.OrderResult{
+		RequestID:      extractRequestID(msg.Headers),
+		ItemID:         itemID,
+		Status:         status,
+		Reason:         reason,
+		StockRemaining: &stock,
+	})
+}
+
+// sendOrderResult records result as the order's status (GET /order/{request_id}) and publishes it
+// The status is non-essential and skipped while Redis is out of memory, like the gateway's;
+// synthetic orders only publish
+func sendOrderResult(msg *sarama.ConsumerMessage, result common.OrderResult) {
+	if result.RequestID == "" {
+		return
+	}
+	if acceptedAt := extractAcceptedAt(msg); !acceptedAt.IsZero() {
+		result.LatencyMs = time.Since(acceptedAt).Milliseconds()
+	}
+	stage, detail := common.TimelineStageForResult(result.Status, result.Reason)
+	recordTimelineStage(msg, stage, time.Now(), detail)
+	var err error
+	if redisHealth.Degraded() || isSyntheticOrder(msg) {
+		err = common.PublishOrderResult(ctx, redisClient, result)
+	} else {
+		err = common.RecordOrderResult(ctx, redisClient, result)
+	}
+	if err != nil {
+		redisHealth.Observe(err)
+		common.WithCorrelationID(extractCorrelationID(msg.Headers)).
+			WithError(err).
+			WithField("event", "order_result_publish_failed").
+			Warn("Failed to publish order result")
+	}
+	if (publishResults || orderStore != nil) && !isSyntheticOrder(msg) {
+		result = withOrderDetails(msg, result)
+		// With the outbox the order store publishes the event once the result is committed
+		if publishResults && (orderStore == nil || !orderStore.Outbox()) {
+			publishResultEvent(msg, result)
+		}
+		if orderStore != nil {
+			orderStore.Record(result)
+		}
+	}
+}
+
+// withOrderDetails adds the buyer and quantity from the order payload to result, and the item
+// for results published without one (DLQ)
+// Results of orders whose payload can't be read (e.g. DLQ'd as invalid) have no user_id
+func withOrderDetails(msg *sarama.ConsumerMessage, result common.OrderResult) common.OrderResult {
+	if payload, err := decryptOrderPayload(msg); err == nil {
+		if order, err := decodeOrder(msg, payload); err == nil {
+			if result.ItemID == "" {
+				result.ItemID = order.ItemID
+			}
+			result.UserID = order.UserID
+			result.Quantity = orderQuantity(&order)
+			if result.Quantity == 0 {
+				result.Quantity = 1
+			}
+		}
+	}
+	return result
+}
+
+// publishResultEvent publishes result to the order-results topic
+func publishResultEvent(msg *sarama.ConsumerMessage, result common.OrderResult) {
+	resultMsg, err := common.NewOrderResultMessage(result)
+	if err == nil {
+		_, _, err = producer.SendMessage(resultMsg)
+	}
+	if err != nil {
+		common.WithCorrelationID(extractCorrelationID(msg.Headers)).
+			WithError(err).
+			WithField("event", "order_result_event_publish_failed").
+			Warn("Failed to publish order result event")
+	}
+}
+
+// restoreInventoryState rebuilds missing inventory keys from the compacted inventory-state topic
+// Existing keys are never overwritten (SETNX), so a live Redis always wins over the topic
+func restoreInventoryState(kafkaAddr string, config *sarama.Config) {
+	client, err := sarama.NewClient([]string{kafkaAddr}, config)
+	if err != nil {
+		logger.WithError(err).Error("Inventory state restore failed: cannot connect to Kafka")
+		return
+	}
+	defer client.Close()
+
+	states, err := common.ReadInventoryState(client)
+	if err != nil {
+		logger.WithError(err).Error("Inventory state restore failed")
+		return
+	}
+
+	restored := restoreInventory(ctx, inventory, states)
+	logger.WithFields(map[string]interface{}{
+		"items_in_topic": len(states),
+		"items_restored": restored,
+	}).Info("Inventory state restored from compacted topic")
+}
+
+// restoreInventory creates the stock level of every item in states that store has none for and
+// returns how many it created; negative levels are restored as 0
+func restoreInventory(ctx context.Context, store InventoryStore, states map[string]common.InventoryState) int {
+	restored := 0
+	for itemID, state := range states {
+		ok, err := store.Restock(ctx, itemID, max(state.Stock, 0), true)
+		if err != nil {
+			logger.WithError(err).WithField("item_id", itemID).Error("Failed to restore inventory key")
+			continue
+		}
+		if ok {
+			restored++
+		}
+	}
+	return restored
+}
+
+// itemIDFromKey returns the item_id encoded in a message key
+// Keys are either empty, "item_id", "item_id#shard" or "user:user_id" (see gateway
+// ORDER_PARTITION_KEY_MODE); user keys carry no item
+func itemIDFromKey(key []byte) string {
+	itemID := string(key)
+	if strings.HasPrefix(itemID, common.UserKeyPrefix) {
+		return ""
+	}
+	if i := strings.Index(itemID, "#"); i >= 0 {
+		itemID = itemID[:i]
+	}
+	return itemID
+}
+
 // extractCorrelationID extracts correlation ID from Kafka message headers
 // If not found, generates a new one for processor-originated logs
 // This ensures all logs can be traced even if correlation ID wasn't propagated
@@ -291,26 +1244,109 @@ func extractRequestID(headers []*sarama.RecordHeader) string {
 	return ""
 }
 
+// extractClientIP extracts the gateway-resolved client address from Kafka message headers
+// Informational only (fraud analysis); it is not covered by the message signature
+func extractClientIP(headers []*sarama.RecordHeader) string {
+	for _, header := range headers {
+		if string(header.Key) == "client_ip" {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+// extractCampaign returns the order's campaign from the campaign header, falling back to its
+// campaign topic; "" for orders outside campaigns
+func extractCampaign(msg *sarama.ConsumerMessage) string {
+	for _, header := range msg.Headers {
+		if string(header.Key) == common.HeaderCampaign {
+			return string(header.Value)
+		}
+	}
+	return common.CampaignFromTopic(msg.Topic)
+}
+
+// reserveCap returns the purchase cap the order's reservation is checked and counted against
+// Orders the gateway already counted (purchase_cap header) and orders without a request_id, whose
+// reservation can't be refunded by record, are not counted again
+func reserveCap(msg *sarama.ConsumerMessage, order *OrderRequest, requestID string) int64 {
+	if requestID == "" || extractHeader(msg.Headers, common.HeaderPurchaseCap) != "" {
+		return 0
+	}
+	return purchaseCaps.For(order.ItemID)
+}
+
+// releasePurchaseCap gives a failed order's units back to the buyer's purchase cap, if the
+// gateway counted them (purchase_cap header); caps counted by the reservation go with its refund
+// The order's amount is released rather than the header's: quantity amendments adjust the counter
+func releasePurchaseCap(logEntry *logrus.Entry, msg *sarama.ConsumerMessage, order *OrderRequest) {
+	for _, header := range msg.Headers {
+		if string(header.Key) != common.HeaderPurchaseCap {
+			continue
+		}
+		if err := common.ReleasePurchaseCap(ctx, redisClient, order.ItemID, order.UserID, order.Amount); err != nil {
+			redisHealth.Observe(err)
+			logEntry.WithError(err).Warn("Failed to release purchase cap")
+		}
+		return
+	}
+}
+
 func moveToDLQ(msg *sarama.ConsumerMessage, reason string, correlationID string) {
 	// Record DLQ metrics
 	RecordFailure(reason)
 
+	// Notify waiting gateways of the terminal failure
+	resultStatus := dlqResultStatus(reason)
+	publishOrderResult(msg, "", resultStatus, reason)
+	slaOutcome := outcomeFailed
+	if resultStatus == common.ResultFailedPayment {
+		slaOutcome = outcomePaymentFailed
+	}
+	recordOrderSLA(msg, "", slaOutcome)
+	metrics.Orders.Record(common.OrderOutcomeDLQ, itemIDFromKey(msg.Key), extractCampaign(msg))
+
+	sendToDLQ(msg, reason, correlationID)
+}
+
+// dlqResultStatus returns the result status of an order moved to the DLQ for reason
+func dlqResultStatus(reason string) string {
+	if reason == "Payment Timeout" || reason == "Payment Declined" {
+		return common.ResultFailedPayment
+	}
+	return common.ResultFailed
+}
+
+// sendToDLQ copies msg to the DLQ topic with the failure reason
+func sendToDLQ(msg *sarama.ConsumerMessage, reason string, correlationID string) {
 	dlqMsg := &sarama.ProducerMessage{
-		Topic: "orders-dlq",
+		Topic: common.TopicOrdersDLQ,
 		Value: sarama.ByteEncoder(msg.Value),
 		Headers: []sarama.RecordHeader{
 			{Key: []byte("error"), Value: []byte(reason)},
 			{Key: []byte("correlation_id"), Value: []byte(correlationID)},
 			{Key: []byte("timestamp"), Value: []byte(time.Now().Format(time.RFC3339))},
+			{Key: []byte(headerDLQSourceTopic), Value: []byte(msg.Topic)},
 		},
 	}
+	// The original key, source topic, accepted_at and signature let a replay verify that the
+	// order came from a signing producer before signing it again
+	if msg.Key != nil {
+		dlqMsg.Key = sarama.ByteEncoder(msg.Key)
+	}
+	// Keep encrypted payloads decryptable for replay by carrying their encryption headers along,
+	// the payload's content_type, the request_id so a replayed order reuses its payment idempotency key, the replay and
+	// retry attempts and the campaign
+	for _, header := range msg.Headers {
+		switch string(header.Key) {
+		case "request_id", "accepted_at", common.HeaderSignature, common.HeaderSignatureKeyID, common.HeaderEncryption, common.HeaderEncryptionKeyID, common.HeaderEncryptedDEK, common.HeaderReplayAttempt, common.HeaderRetryAttempt, common.HeaderCampaign, orderpb.HeaderContentType:
+			dlqMsg.Headers = append(dlqMsg.Headers, *header)
+		}
+	}
 
 	_, _, err := producer.SendMessage(dlqMsg)
 	if err != nil {
-		common.WithCorrelationID(correlationID).
-			WithError(err).
-			WithField("event", "dlq_send_failed").
-			Error("Failed to send message to DLQ")
+		spillDLQMessage(dlqMsg, msg, correlationID, err)
 		return
 	}
 
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// orderClaimTTL keeps the claim as long as gateways keep amendable orders
+const orderClaimTTL = 30 * time.Minute
+
+var claimOrderScript = redis.NewScript(luaClaimOrderScript)
+
+// claimOrder claims an amendable order (amendable header) and returns its amendment, if any
+// Orders without the header were accepted without amendment support and are not claimed
+func claimOrder(msg *sarama.ConsumerMessage) (*common.OrderAmendment, error) {
+	amendable := false
+	for _, header := range msg.Headers {
+		if string(header.Key) == common.HeaderAmendable {
+			amendable = true
+			break
+		}
+	}
+	requestID := extractRequestID(msg.Headers)
+	if !amendable || requestID == "" {
+		return nil, nil
+	}
+
+	value, err := claimOrderScript.Run(ctx, redisClient,
+		[]string{common.OrderClaimKey(requestID), common.OrderAmendmentKey(requestID)},
+		int64(orderClaimTTL.Seconds())).Text()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var amendment common.OrderAmendment
+	if err := json.Unmarshal([]byte(value), &amendment); err != nil {
+		return nil, err
+	}
+	return &amendment, nil
+}
+
+// applyAmendment applies a client amendment to order before it is acted on
+// Returns false when the order was cancelled and must not be processed
+func applyAmendment(logEntry *logrus.Entry, msg *sarama.ConsumerMessage, order *OrderRequest, amendment *common.OrderAmendment) bool {
+	switch amendment.Action {
+	case common.AmendmentCancel:
+		// Nothing was counted against the purchase cap yet; the gateway released the intent
+		publishOrderResult(msg, order.ItemID, common.ResultCancelled, "cancelled by client")
+		metrics.OrdersByChannel.WithLabelValues(order.Channel, outcomeCancelled).Inc()
+		logEntry.WithFields(map[string]interface{}{
+			"event":      "order_cancelled",
+			"amended_at": amendment.AmendedAt,
+		}).Info("Order cancelled by client before processing")
+		return false
+	case common.AmendmentQuantity:
+		logEntry.WithFields(map[string]interface{}{
+			"event":           "order_amended",
+			"original_amount": order.Amount,
+			"amended_at":      amendment.AmendedAt,
+		}).Info("Order quantity amended by client")
+		order.Amount = amendment.Amount
+	default:
+		logEntry.WithField("action", amendment.Action).Warn("Unknown order amendment ignored")
+	}
+	return true
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/IBM/sarama"
+)
+
+var errOrderConsumersClosed = errors.New("order consumers closed")
+
+// OrderSource delivers orders from a changing set of order topics
+// Implemented by OrderGroup (consumer group)
+type OrderSource interface {
+	// Add starts consuming topic and returns its partitions; adding a topic twice is a no-op
+	Add(topic string) ([]int32, error)
+	Remove(topic string)
+	Topics() []string
+	Messages() <-chan *sarama.ConsumerMessage
+	// Done reports that msg has been handled and its offset may be committed
+	Done(msg *sarama.ConsumerMessage)
+	Pause()
+	Resume()
+	Close()
+}
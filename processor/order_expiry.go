@@ -0,0 +1,51 @@
+package main
+
+import (
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// Expiry reasons, used as the reason of EXPIRED results and as metric labels
+const (
+	expiryMaxAge    = "max_age"    // Older than ORDER_MAX_AGE, e.g. consumed after an outage
+	expirySaleEnded = "sale_ended" // Consumed after its campaign's sale window (expires_at header)
+)
+
+// orderMaxAge is the oldest an order may be when consumed (ORDER_MAX_AGE); 0 disables the check
+var orderMaxAge time.Duration
+
+// orderExpiry reports why msg is too old to process, or "" if it may still be processed
+// Age is measured from the gateway's accepted_at header, falling back to the Kafka timestamp
+// Live replays re-run old orders on purpose, so nothing expires during one
+func orderExpiry(msg *sarama.ConsumerMessage, now time.Time) string {
+	if replaying {
+		return ""
+	}
+	if expiresAt := common.OrderExpiresAt(msg.Headers); !expiresAt.IsZero() && now.After(expiresAt) {
+		return expirySaleEnded
+	}
+	if orderMaxAge > 0 {
+		if acceptedAt := extractAcceptedAt(msg); !acceptedAt.IsZero() && now.Sub(acceptedAt) > orderMaxAge {
+			return expiryMaxAge
+		}
+	}
+	return ""
+}
+
+// expireOrder settles an order consumed too late: no stock is touched, the buyer's purchase
+// cap is given back and EXPIRED is published so the client can place a new order
+func expireOrder(logEntry *logrus.Entry, msg *sarama.ConsumerMessage, order *OrderRequest, reason string) {
+	releasePurchaseCap(logEntry, msg, order)
+	publishOrderResult(msg, order.ItemID, common.ResultExpired, reason)
+	metrics.OrdersExpired.WithLabelValues(reason).Inc()
+	metrics.Orders.Record(common.OrderOutcomeExpired, order.ItemID, extractCampaign(msg))
+	metrics.OrdersByChannel.WithLabelValues(order.Channel, outcomeExpired).Inc()
+	logEntry.WithFields(map[string]interface{}{
+		"event":  "order_expired",
+		"reason": reason,
+		"age_ms": time.Since(extractAcceptedAt(msg)).Milliseconds(),
+	}).Warn("Order expired before processing, inventory not reserved")
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultProcessorGroup is the order consumer group of processors without PROCESSOR_GROUP
+const defaultProcessorGroup = "flash-sale-processor"
+
+type claimKey struct {
+	topic     string
+	partition int32
+}
+
+// OrderGroup consumes order topics through a Kafka consumer group, so processor replicas
+// share partitions, take over a departed replica's partitions on rebalance and resume from
+// committed offsets after a restart
+// Each claim hands up to window messages to the processing loop before waiting for them to be
+// Done, and commits an offset once every order up to it is Done; a rebalance waits for the
+// handed-over orders, so it never moves a partition while one of its orders is still being
+// processed here
+type OrderGroup struct {
+	group  sarama.ConsumerGroup
+	client sarama.Client
+
+	messages chan *sarama.ConsumerMessage
+	active   atomic.Bool // In a consumer group session (false while rebalancing or disconnected)
+	stop     context.CancelFunc
+	stopped  chan struct{}
+
+	mu      sync.Mutex
+	topics  map[string][]int32
+	acks    map[claimKey]chan int64 // Offsets of Done messages per claim
+	window  int
+	rejoin  context.CancelFunc // Ends the current session so a changed topic set is subscribed
+	resumed chan struct{}      // Closed unless paused
+	closed  bool
+}
+
+// NewOrderGroup joins the group lazily: consumption starts once the first topic is added
+// window is the number of orders a claim may have in flight (at least 1)
+func NewOrderGroup(group sarama.ConsumerGroup, client sarama.Client, window int) *OrderGroup {
+	resumed := make(chan struct{})
+	close(resumed)
+	og := &OrderGroup{
+		group:    group,
+		client:   client,
+		messages: make(chan *sarama.ConsumerMessage),
+		stopped:  make(chan struct{}),
+		topics:   make(map[string][]int32),
+		acks:     make(map[claimKey]chan int64),
+		window:   max(window, 1),
+		resumed:  resumed,
+	}
+	consumeCtx, stop := context.WithCancel(context.Background())
+	og.stop = stop
+	go og.consume(consumeCtx)
+	return og
+}
+
+func (og *OrderGroup) consume(consumeCtx context.Context) {
+	defer close(og.stopped)
+	for consumeCtx.Err() == nil {
+		topics := og.Topics()
+		if len(topics) == 0 {
+			select {
+			case <-time.After(time.Second):
+			case <-consumeCtx.Done():
+			}
+			continue
+		}
+		sessionCtx, rejoin := context.WithCancel(consumeCtx)
+		og.mu.Lock()
+		og.rejoin = rejoin
+		og.mu.Unlock()
+		// Consume returns on every rebalance or topic change; rejoin until closed
+		err := og.group.Consume(sessionCtx, topics, og)
+		rejoin()
+		if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+			return
+		}
+		if err != nil && consumeCtx.Err() == nil {
+			logger.WithError(err).WithField("event", "order_group_consume_failed").Error("Consumer group session failed")
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+// Add subscribes the group to topic; partitions without a committed offset start at the
+// group's configured initial offset
+func (og *OrderGroup) Add(topic string) ([]int32, error) {
+	partitions, err := og.client.Partitions(topic)
+	if err != nil {
+		return nil, err
+	}
+	og.mu.Lock()
+	defer og.mu.Unlock()
+	if og.closed {
+		return nil, errOrderConsumersClosed
+	}
+	if _, ok := og.topics[topic]; ok {
+		return nil, nil
+	}
+	og.topics[topic] = partitions
+	metrics.SubscribedTopics.Set(float64(len(og.topics)))
+	og.rejoinLocked()
+	return partitions, nil
+}
+
+// Remove unsubscribes the group from topic, e.g. after it was deleted
+func (og *OrderGroup) Remove(topic string) {
+	og.mu.Lock()
+	_, ok := og.topics[topic]
+	delete(og.topics, topic)
+	metrics.SubscribedTopics.Set(float64(len(og.topics)))
+	if ok {
+		og.rejoinLocked()
+	}
+	og.mu.Unlock()
+	if !ok {
+		return
+	}
+	metrics.TopicMessages.DeletePartialMatch(prometheus.Labels{"topic": topic})
+	metrics.TopicLag.DeletePartialMatch(prometheus.Labels{"topic": topic})
+}
+
+func (og *OrderGroup) rejoinLocked() {
+	if og.rejoin != nil {
+		og.rejoin()
+	}
+}
+
+// Topics returns the subscribed topics in name order
+func (og *OrderGroup) Topics() []string {
+	og.mu.Lock()
+	defer og.mu.Unlock()
+	topics := make([]string, 0, len(og.topics))
+	for topic := range og.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// Active reports whether the instance is in a consumer group session
+func (og *OrderGroup) Active() bool {
+	return og.active.Load()
+}
+
+// Messages returns the messages of every claimed partition; closed after Close once the group has left
+func (og *OrderGroup) Messages() <-chan *sarama.ConsumerMessage {
+	return og.messages
+}
+
+// Done lets the claim that delivered msg commit it and hand over its next message
+func (og *OrderGroup) Done(msg *sarama.ConsumerMessage) {
+	og.mu.Lock()
+	ack := og.acks[claimKey{msg.Topic, msg.Partition}]
+	og.mu.Unlock()
+	if ack != nil {
+		select {
+		case ack <- msg.Offset:
+		default:
+		}
+	}
+}
+
+// Pause stops handing over messages; fetching stops once the claims' buffers are full
+// The pause outlives rebalances, since newly claimed partitions wait on the same gate
+func (og *OrderGroup) Pause() {
+	og.mu.Lock()
+	defer og.mu.Unlock()
+	select {
+	case <-og.resumed:
+		og.resumed = make(chan struct{})
+	default:
+	}
+}
+
+// Resume undoes Pause
+func (og *OrderGroup) Resume() {
+	og.mu.Lock()
+	defer og.mu.Unlock()
+	select {
+	case <-og.resumed:
+	default:
+		close(og.resumed)
+	}
+}
+
+func (og *OrderGroup) gate() <-chan struct{} {
+	og.mu.Lock()
+	defer og.mu.Unlock()
+	return og.resumed
+}
+
+// Close leaves the group once the in-flight order is Done; Messages is closed afterwards
+func (og *OrderGroup) Close() {
+	og.mu.Lock()
+	og.closed = true
+	og.mu.Unlock()
+	og.stop()
+	go func() {
+		<-og.stopped
+		if err := og.group.Close(); err != nil {
+			logger.WithError(err).Error("Error closing order consumer group")
+		}
+		close(og.messages)
+	}()
+}
+
+func (og *OrderGroup) Setup(session sarama.ConsumerGroupSession) error {
+	og.active.Store(true)
+	logger.WithFields(map[string]interface{}{
+		"event":  "order_partitions_assigned",
+		"claims": session.Claims(),
+	}).Info("Order partitions assigned")
+	return nil
+}
+
+func (og *OrderGroup) Cleanup(sarama.ConsumerGroupSession) error {
+	og.active.Store(false)
+	return nil
+}
+
+func (og *OrderGroup) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	key := claimKey{claim.Topic(), claim.Partition()}
+	ack := make(chan int64, og.window)
+	og.mu.Lock()
+	og.acks[key] = ack
+	og.mu.Unlock()
+	defer func() {
+		og.mu.Lock()
+		if og.acks[key] == ack {
+			delete(og.acks, key)
+		}
+		og.mu.Unlock()
+	}()
+
+	// Offsets handed over and not yet committed, in order; orders may finish out of order
+	var inFlight []int64
+	done := make(map[int64]bool)
+	complete := func(offset int64) {
+		done[offset] = true
+		n := 0
+		for n < len(inFlight) && done[inFlight[n]] {
+			delete(done, inFlight[n])
+			n++
+		}
+		if n > 0 {
+			session.MarkOffset(claim.Topic(), claim.Partition(), inFlight[n-1]+1, "")
+			inFlight = inFlight[n:]
+		}
+	}
+	// The processing loop always finishes a handed-over order, even while shutting down
+	finish := func() error {
+		for len(inFlight) > 0 {
+			complete(<-ack)
+		}
+		return nil
+	}
+
+	partition := strconv.Itoa(int(claim.Partition()))
+	for {
+		if len(inFlight) >= og.window {
+			complete(<-ack)
+			continue
+		}
+		select {
+		case <-og.gate():
+		case offset := <-ack:
+			complete(offset)
+			continue
+		case <-session.Context().Done():
+			return finish()
+		}
+		var msg *sarama.ConsumerMessage
+		select {
+		case m, ok := <-claim.Messages():
+			if !ok {
+				return finish()
+			}
+			msg = m
+		case offset := <-ack:
+			complete(offset)
+			continue
+		case <-session.Context().Done():
+			return finish()
+		}
+		handed := false
+		for !handed {
+			select {
+			case og.messages <- msg:
+				handed = true
+			case offset := <-ack:
+				complete(offset)
+			case <-session.Context().Done():
+				// Not handed over, so not committed; the next owner consumes it again
+				return finish()
+			}
+		}
+		inFlight = append(inFlight, msg.Offset)
+		metrics.TopicMessages.WithLabelValues(msg.Topic).Inc()
+		metrics.TopicLag.WithLabelValues(msg.Topic, partition).Set(float64(claim.HighWaterMarkOffset() - msg.Offset - 1))
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/lib/pq"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// orderOutboxBatchSize bounds the events one relay pass publishes
+const orderOutboxBatchSize = 200
+
+// orderOutboxRelayLock is the Postgres advisory lock held by the processor relaying a batch
+const orderOutboxRelayLock = 4_210_002
+
+// OrderOutboxRelay publishes the order store's outbox to the order-results topic
+// One relay at a time publishes: each pass takes an advisory lock, publishes the oldest events in
+// id order and deletes the published ones in the same transaction. Processors that miss the lock
+// skip the pass, so an order's events are never published out of order by parallel relays
+// Delivery is at least once: events published before a failed commit are sent again
+type OrderOutboxRelay struct {
+	db       *sql.DB
+	producer sarama.SyncProducer
+	interval time.Duration
+}
+
+// NewOrderOutboxRelay creates a relay for store's outbox polling every interval
+func NewOrderOutboxRelay(store *OrderStore, producer sarama.SyncProducer, interval time.Duration) *OrderOutboxRelay {
+	return &OrderOutboxRelay{db: store.db, producer: producer, interval: interval}
+}
+
+// Run relays events until ctx is done; a full batch is followed by another pass right away
+func (r *OrderOutboxRelay) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		published, err := r.relay(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.WithError(err).WithFields(map[string]interface{}{
+				"event":     "order_outbox_relay_failed",
+				"published": published,
+			}).Error("Failed to relay order outbox")
+		}
+		r.reportPending(ctx)
+		next := r.interval
+		if err == nil && published == orderOutboxBatchSize {
+			next = 0
+		}
+		timer.Reset(next)
+	}
+}
+
+// relay publishes one batch and returns how many events were published and deleted
+func (r *OrderOutboxRelay) relay(ctx context.Context) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	// Released with the transaction, after the published events are deleted
+	var relaying bool
+	if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, orderOutboxRelayLock).Scan(&relaying); err != nil {
+		return 0, err
+	}
+	if !relaying {
+		return 0, nil
+	}
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, payload FROM order_outbox ORDER BY id LIMIT $1`, orderOutboxBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	type outboxEvent struct {
+		id      int64
+		payload []byte
+	}
+	var events []outboxEvent
+	for rows.Next() {
+		var event outboxEvent
+		if err := rows.Scan(&event.id, &event.payload); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		events = append(events, event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	// Stop at the first failure so an order's events are never published out of order
+	published := make([]int64, 0, len(events))
+	var sendErr error
+	for _, event := range events {
+		var result common.OrderResult
+		if err := json.Unmarshal(event.payload, &result); err != nil {
+			// Never publishable: dropped so it doesn't block the outbox
+			metrics.OrderOutboxEvents.WithLabelValues("invalid").Inc()
+			logger.WithError(err).WithField("outbox_id", event.id).Error("Dropping undecodable order outbox event")
+			published = append(published, event.id)
+			continue
+		}
+		msg, err := common.NewOrderResultMessage(result)
+		if err == nil {
+			_, _, err = r.producer.SendMessage(msg)
+		}
+		if err != nil {
+			metrics.OrderOutboxEvents.WithLabelValues("failed").Inc()
+			sendErr = err
+			break
+		}
+		metrics.OrderOutboxEvents.WithLabelValues("published").Inc()
+		published = append(published, event.id)
+	}
+	if len(published) > 0 {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM order_outbox WHERE id = ANY($1)`, pq.Array(published)); err != nil {
+			return 0, err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+	}
+	return len(published), sendErr
+}
+
+// reportPending updates the outbox backlog gauge
+func (r *OrderOutboxRelay) reportPending(ctx context.Context) {
+	var pending int64
+	if err := r.db.QueryRowContext(ctx, `SELECT count(*) FROM order_outbox`).Scan(&pending); err == nil {
+		metrics.OrderOutboxPending.Set(float64(pending))
+	}
+}
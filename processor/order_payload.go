@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/IBM/sarama"
+	orderpb "github.com/yourname/flash-sale-engine/common/proto"
+)
+
+// decodeOrder decodes the plaintext payload of msg (see decryptOrderPayload)
+// Protobuf orders are marked by their content_type header; anything else is JSON, so orders
+// published before the protobuf schema or by gateways with ORDER_PAYLOAD_FORMAT=json still decode
+func decodeOrder(msg *sarama.ConsumerMessage, payload []byte) (OrderRequest, error) {
+	var order OrderRequest
+	if !orderpb.IsProtobuf(msg.Headers) {
+		err := json.Unmarshal(payload, &order)
+		return order, err
+	}
+	var decoded orderpb.Order
+	if err := decoded.Unmarshal(payload); err != nil {
+		return order, err
+	}
+	return OrderRequest{
+		UserID:          decoded.UserID,
+		ItemID:          decoded.ItemID,
+		Amount:          decoded.Amount,
+		RecipientUserID: decoded.RecipientUserID,
+		Channel:         decoded.Channel,
+		Address:         decoded.Address,
+		DeviceID:        decoded.DeviceID,
+		Metadata:        decoded.Metadata,
+		Lines:           decoded.Lines,
+		CartPolicy:      decoded.CartPolicy,
+	}, nil
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// OrderRecord is an order's latest result as kept in the order store
+type OrderRecord struct {
+	RequestID string    `json:"request_id"`
+	UserID    string    `json:"user_id,omitempty"`
+	ItemID    string    `json:"item_id,omitempty"`
+	Quantity  int64     `json:"quantity,omitempty"`
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"` // First result stored
+	UpdatedAt time.Time `json:"updated_at"` // Latest result's timestamp
+	// Set on soft-deleted orders, which only the retention job reads
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// OrderQuery filters and pages an order search; zero values don't filter
+type OrderQuery struct {
+	ItemID    string
+	UserID    string
+	Statuses  []string
+	From, To  time.Time // updated_at range, From inclusive and To exclusive
+	Ascending bool      // Oldest first; newest first by default
+	Limit     int
+	Cursor    string // next_cursor of the previous page
+}
+
+// orderStoreBatchSize bounds the rows one upsert writes
+const orderStoreBatchSize = 500
+
+// OrderStore keeps the latest result of every order in Postgres for support searches
+// Results are queued and written in batches by a background worker, so a slow database never
+// stalls order processing; results that don't fit in the queue are dropped and counted
+// With the outbox (see order_outbox.go) each batch also writes the results' events in the same
+// transaction, and results are never dropped: a full queue blocks processing instead
+type OrderStore struct {
+	db            *sql.DB
+	queue         chan queuedOrder
+	flushInterval time.Duration
+	outbox        bool
+	done          chan struct{}
+}
+
+// queuedOrder is a result waiting for the writer; event is set only with the outbox
+type queuedOrder struct {
+	record OrderRecord
+	event  []byte
+}
+
+// orderStore is nil unless ORDER_STORE_DSN is set
+var orderStore *OrderStore
+
+// NewOrderStore connects to dsn, applies pending order store migrations (orders and order_outbox
+// tables, see common/migrations) and starts the writer
+func NewOrderStore(ctx context.Context, dsn string, queueSize int, flushInterval time.Duration, outbox bool) (*OrderStore, error) {
+	db, err := common.OpenOrderStore(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	s := &OrderStore{
+		db:            db,
+		queue:         make(chan queuedOrder, queueSize),
+		flushInterval: flushInterval,
+		outbox:        outbox,
+		done:          make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Outbox reports whether results are published through the outbox rather than directly
+func (s *OrderStore) Outbox() bool {
+	return s.outbox
+}
+
+// Record queues result for the store; see withOrderDetails for its buyer and quantity
+// With the outbox the result's event is queued with it and Record waits for room in the queue
+func (s *OrderStore) Record(result common.OrderResult) {
+	record := OrderRecord{
+		RequestID: result.RequestID,
+		UserID:    result.UserID,
+		ItemID:    result.ItemID,
+		Quantity:  result.Quantity,
+		Status:    result.Status,
+		Reason:    result.Reason,
+		// Postgres keeps microseconds; truncating keeps cursors exact
+		UpdatedAt: result.Timestamp.UTC().Truncate(time.Microsecond),
+	}
+	if record.UpdatedAt.IsZero() {
+		record.UpdatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	}
+	if s.outbox {
+		event, err := json.Marshal(result)
+		if err != nil {
+			metrics.OrderStoreWrites.WithLabelValues("failed").Inc()
+			logger.WithError(err).WithField("request_id", result.RequestID).Error("Failed to encode order result event")
+			return
+		}
+		s.queue <- queuedOrder{record: record, event: event}
+		return
+	}
+	select {
+	case s.queue <- queuedOrder{record: record}:
+	default:
+		metrics.OrderStoreWrites.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Close stops accepting results, writes the queued ones until ctx expires and closes the database
+func (s *OrderStore) Close(ctx context.Context) error {
+	close(s.queue)
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		logger.WithField("pending", len(s.queue)).Warn("Order store writer did not drain before shutdown")
+	}
+	return s.db.Close()
+}
+
+func (s *OrderStore) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+	batch := make([]queuedOrder, 0, orderStoreBatchSize)
+	for {
+		// With the outbox a failed batch is kept and retried; once it is full, new results stay
+		// in the queue until the next tick
+		queue := s.queue
+		if len(batch) >= orderStoreBatchSize {
+			queue = nil
+		}
+		select {
+		case entry, ok := <-queue:
+			if !ok {
+				s.flush(batch)
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) < orderStoreBatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		if s.flush(batch) || !s.outbox {
+			batch = batch[:0]
+		}
+	}
+}
+
+// flush upserts batch, keeping the newest result of each order, and reports whether it was written
+// With the outbox every result's event is inserted in the same transaction
+func (s *OrderStore) flush(batch []queuedOrder) bool {
+	if len(batch) == 0 {
+		return true
+	}
+	// One statement can't update a row twice: keep each order's newest result
+	latest := make(map[string]int, len(batch))
+	rows := make([]OrderRecord, 0, len(batch))
+	for _, entry := range batch {
+		record := entry.record
+		if i, seen := latest[record.RequestID]; seen {
+			if !record.UpdatedAt.Before(rows[i].UpdatedAt) {
+				rows[i] = record
+			}
+			continue
+		}
+		latest[record.RequestID] = len(rows)
+		rows = append(rows, record)
+	}
+
+	var values strings.Builder
+	args := make([]interface{}, 0, len(rows)*7)
+	for i, row := range rows {
+		if i > 0 {
+			values.WriteString(",")
+		}
+		n := len(args)
+		fmt.Fprintf(&values, "($%d,$%d,$%d,$%d,$%d,$%d,$%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7)
+		args = append(args, row.RequestID, row.UserID, row.ItemID, row.Quantity, row.Status, row.Reason, row.UpdatedAt)
+	}
+	// Results can arrive out of order (redeliveries, DLQ redrives): an older one never overwrites
+	// Buyer and quantity are kept from whichever result carried them; a newer result revives a
+	// soft-deleted order
+	query := `INSERT INTO orders (request_id, user_id, item_id, quantity, status, reason, updated_at)
+VALUES ` + values.String() + `
+ON CONFLICT (request_id) DO UPDATE SET
+    user_id = COALESCE(NULLIF(EXCLUDED.user_id, ''), orders.user_id),
+    item_id = COALESCE(NULLIF(EXCLUDED.item_id, ''), orders.item_id),
+    quantity = COALESCE(NULLIF(EXCLUDED.quantity, 0), orders.quantity),
+    status = EXCLUDED.status,
+    reason = EXCLUDED.reason,
+    updated_at = EXCLUDED.updated_at,
+    deleted_at = NULL
+WHERE orders.updated_at <= EXCLUDED.updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var err error
+	if s.outbox {
+		err = s.writeWithEvents(ctx, query, args, batch)
+	} else {
+		_, err = s.db.ExecContext(ctx, query, args...)
+	}
+	if err != nil {
+		metrics.OrderStoreWrites.WithLabelValues("failed").Add(float64(len(rows)))
+		logger.WithError(err).WithFields(map[string]interface{}{
+			"event":    "order_store_write_failed",
+			"rows":     len(rows),
+			"retained": s.outbox,
+		}).Error("Failed to write orders to the order store")
+		return false
+	}
+	metrics.OrderStoreWrites.WithLabelValues("written").Add(float64(len(rows)))
+	return true
+}
+
+// writeWithEvents runs the orders upsert and inserts batch's events into the outbox in one
+// transaction, in the order the results were recorded
+func (s *OrderStore) writeWithEvents(ctx context.Context, upsert string, args []interface{}, batch []queuedOrder) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, upsert, args...); err != nil {
+		return err
+	}
+	var values strings.Builder
+	events := make([]interface{}, 0, len(batch)*2)
+	for i, entry := range batch {
+		if i > 0 {
+			values.WriteString(",")
+		}
+		fmt.Fprintf(&values, "($%d,$%d)", len(events)+1, len(events)+2)
+		events = append(events, entry.record.RequestID, string(entry.event))
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO order_outbox (request_id, payload) VALUES "+values.String(), events...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Status returns requestID's latest stored status, "" if the order isn't stored
+func (s *OrderStore) Status(ctx context.Context, requestID string) (string, error) {
+	var status string
+	err := s.db.QueryRowContext(ctx, `SELECT status FROM orders WHERE request_id = $1`, requestID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return status, err
+}
+
+// errInvalidCursor is returned for a cursor that wasn't produced by Search
+var errInvalidCursor = errors.New("invalid cursor")
+
+// Search returns one page of orders matching q and the cursor of the next page ("" on the last)
+func (s *OrderStore) Search(ctx context.Context, q OrderQuery) ([]OrderRecord, string, error) {
+	conditions := []string{"deleted_at IS NULL"}
+	var args []interface{}
+	add := func(condition string, values ...interface{}) {
+		placeholders := make([]interface{}, len(values))
+		for i, value := range values {
+			args = append(args, value)
+			placeholders[i] = len(args)
+		}
+		conditions = append(conditions, fmt.Sprintf(condition, placeholders...))
+	}
+	if q.ItemID != "" {
+		add("item_id = $%d", q.ItemID)
+	}
+	if q.UserID != "" {
+		add("user_id = $%d", q.UserID)
+	}
+	if len(q.Statuses) == 1 {
+		add("status = $%d", q.Statuses[0])
+	} else if len(q.Statuses) > 1 {
+		add("status = ANY($%d)", pq.Array(q.Statuses))
+	}
+	if !q.From.IsZero() {
+		add("updated_at >= $%d", q.From)
+	}
+	if !q.To.IsZero() {
+		add("updated_at < $%d", q.To)
+	}
+	direction, comparison := "DESC", "<"
+	if q.Ascending {
+		direction, comparison = "ASC", ">"
+	}
+	if q.Cursor != "" {
+		updatedAt, requestID, err := decodeOrderCursor(q.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		add("(updated_at, request_id) "+comparison+" ($%d, $%d)", updatedAt, requestID)
+	}
+
+	query := "SELECT request_id, user_id, item_id, quantity, status, reason, created_at, updated_at FROM orders" +
+		" WHERE " + strings.Join(conditions, " AND ")
+	args = append(args, q.Limit+1) // One extra row tells whether another page follows
+	query += fmt.Sprintf(" ORDER BY updated_at %s, request_id %s LIMIT $%d", direction, direction, len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+	orders := make([]OrderRecord, 0, q.Limit)
+	for rows.Next() {
+		var order OrderRecord
+		if err := rows.Scan(&order.RequestID, &order.UserID, &order.ItemID, &order.Quantity,
+			&order.Status, &order.Reason, &order.CreatedAt, &order.UpdatedAt); err != nil {
+			return nil, "", err
+		}
+		order.CreatedAt, order.UpdatedAt = order.CreatedAt.UTC(), order.UpdatedAt.UTC()
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+	if len(orders) <= q.Limit {
+		return orders, "", nil
+	}
+	orders = orders[:q.Limit]
+	last := orders[len(orders)-1]
+	return orders, encodeOrderCursor(last.UpdatedAt, last.RequestID), nil
+}
+
+// encodeOrderCursor encodes the sort key of a page's last order
+func encodeOrderCursor(updatedAt time.Time, requestID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(updatedAt.Format(time.RFC3339Nano) + "|" + requestID))
+}
+
+func decodeOrderCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", errInvalidCursor
+	}
+	timestamp, requestID, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, "", errInvalidCursor
+	}
+	updatedAt, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return time.Time{}, "", errInvalidCursor
+	}
+	return updatedAt, requestID, nil
+}
+
+// handleAdminSearchOrders searches the order store
+// Query parameters: item_id, user_id, status (comma-separated), from and to (RFC 3339, on the
+// latest result's time), sort (-updated_at newest first, default, or updated_at), limit
+// (default 100, max 1000) and cursor (next_cursor from the previous page)
+func handleAdminSearchOrders(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := OrderQuery{
+		ItemID: query.Get("item_id"),
+		UserID: query.Get("user_id"),
+		Limit:  100,
+		Cursor: query.Get("cursor"),
+	}
+	for _, status := range strings.Split(query.Get("status"), ",") {
+		if status = strings.TrimSpace(status); status != "" {
+			q.Statuses = append(q.Statuses, status)
+		}
+	}
+	for name, bound := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": name + " must be an RFC 3339 time"})
+				return
+			}
+			*bound = parsed
+		}
+	}
+	switch query.Get("sort") {
+	case "", "-updated_at":
+	case "updated_at":
+		q.Ascending = true
+	default:
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "sort must be updated_at or -updated_at"})
+		return
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 1000 {
+			writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 1000"})
+			return
+		}
+		q.Limit = limit
+	}
+
+	orders, next, err := orderStore.Search(r.Context(), q)
+	if errors.Is(err, errInvalidCursor) {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid cursor"})
+		return
+	}
+	if err != nil {
+		adminLog(r, "admin_order_search").WithError(err).Error("Failed to search orders")
+		writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to search orders"})
+		return
+	}
+	body := map[string]interface{}{"orders": orders}
+	if next != "" {
+		body["next_cursor"] = next
+	}
+	writeAdminJSON(w, http.StatusOK, body)
+}
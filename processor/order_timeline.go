@@ -0,0 +1,32 @@
+package main
+
+import (
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// recordTimeline enables the processor's stages in order timelines (ORDER_TIMELINE_ENABLED)
+// Gateways record received, admitted and queued; GET /order/{request_id}/events?timeline=true reads them
+var recordTimeline bool
+
+// recordTimelineStage appends one stage of msg's order to its timeline
+// Non-essential like the status: skipped while Redis is degraded and for synthetic orders
+func recordTimelineStage(msg *sarama.ConsumerMessage, stage string, at time.Time, detail string) {
+	if !recordTimeline || redisHealth.Degraded() || isSyntheticOrder(msg) {
+		return
+	}
+	requestID := extractRequestID(msg.Headers)
+	if requestID == "" {
+		return
+	}
+	event := common.TimelineEvent{Stage: stage, At: at, Service: "processor", Detail: detail}
+	if err := common.AppendOrderTimeline(ctx, redisClient, requestID, event); err != nil {
+		redisHealth.Observe(err)
+		common.WithCorrelationID(extractCorrelationID(msg.Headers)).
+			WithError(err).
+			WithField("event", "order_timeline_failed").
+			Warn("Failed to record order timeline")
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// Charge statuses reported by payment providers
+const (
+	ChargeSucceeded = "succeeded"
+	ChargeDeclined  = "declined"
+	ChargePending   = "pending" // Outcome not known yet; must not be charged again
+)
+
+// ErrPaymentTimeout is returned when a charge's outcome is unknown (timeout, network error)
+var ErrPaymentTimeout = errors.New("payment provider timeout")
+
+// ChargeRequest asks a provider to charge for an order
+// The provider prices the order; IdempotencyKey makes repeated requests return the first charge
+type ChargeRequest struct {
+	IdempotencyKey string `json:"idempotency_key"`
+	RequestID      string `json:"request_id"`
+	UserID         string `json:"user_id"`
+	ItemID         string `json:"item_id"`
+	Quantity       int64  `json:"quantity"` // Units of every line of a cart order
+
+	// Lines are the lines of a cart order that are charged; ItemID is the first
+	Lines []common.CartLine `json:"lines,omitempty"`
+}
+
+// ChargeResult is a provider's view of a charge
+type ChargeResult struct {
+	Status   string `json:"status"`
+	ChargeID string `json:"charge_id,omitempty"`
+}
+
+// PaymentProvider charges confirmed reservations
+// Implementations must honour the idempotency key: a repeated Charge with the same key returns
+// the original charge instead of creating a new one
+type PaymentProvider interface {
+	Name() string
+	Charge(ctx context.Context, req ChargeRequest) (ChargeResult, error)
+	// ChargeStatus looks up the charge made with idempotencyKey; found is false if there is none
+	ChargeStatus(ctx context.Context, idempotencyKey string) (result ChargeResult, found bool, err error)
+}
+
+// payments is the configured provider (PAYMENT_PROVIDER_URL), or the simulated one
+var payments PaymentProvider = simulatedPaymentProvider{}
+
+// paymentAttemptKey counts the declined charges of an order; the next charge uses a new key
+func paymentAttemptKey(requestID string) string {
+	return "payment_attempt:" + requestID
+}
+
+// paymentIdempotencyKey derives the provider key for an order's charge attempt
+// Retries and DLQ redrives of the same order reuse it until a charge is definitively declined
+func paymentIdempotencyKey(requestID string, attempt int64) string {
+	return "order-" + requestID + "-" + strconv.FormatInt(attempt, 10)
+}
+
+// chargeOrder charges an order at most once across retries, redeliveries and redrives
+// The current attempt's charge is looked up first: a succeeded charge is not repeated, a pending
+// one is reported as a timeout, and only a declined one moves on to a new attempt (and key)
+func chargeOrder(logEntry *logrus.Entry, msg *sarama.ConsumerMessage, order *OrderRequest) (ChargeResult, error) {
+	requestID := extractRequestID(msg.Headers)
+	if requestID == "" {
+		// Without a request_id no stable key can be derived; every delivery charges anew
+		return payments.Charge(ctx, ChargeRequest{UserID: order.UserID, ItemID: order.ItemID, Quantity: orderQuantity(order), Lines: order.Lines})
+	}
+
+	attempt, err := redisClient.Get(ctx, paymentAttemptKey(requestID)).Int64()
+	if err != nil && err != redis.Nil {
+		return ChargeResult{}, fmt.Errorf("read payment attempt: %w", err)
+	}
+	attempt++ // Attempts are 1-based; the key holds the number of declined attempts
+	key := paymentIdempotencyKey(requestID, attempt)
+	logEntry = logEntry.WithFields(map[string]interface{}{
+		"payment_provider":        payments.Name(),
+		"payment_attempt":         attempt,
+		"payment_idempotency_key": key,
+	})
+
+	existing, found, err := payments.ChargeStatus(ctx, key)
+	if err != nil {
+		return ChargeResult{}, fmt.Errorf("%w: status lookup: %v", ErrPaymentTimeout, err)
+	}
+	if found {
+		switch existing.Status {
+		case ChargeSucceeded:
+			metrics.PaymentCharges.WithLabelValues("already_charged").Inc()
+			logEntry.WithField("event", "payment_already_charged").Info("Order already charged, not charging again")
+			return existing, nil
+		case ChargePending:
+			return ChargeResult{}, fmt.Errorf("%w: charge %s still pending", ErrPaymentTimeout, existing.ChargeID)
+		default:
+			// Previous attempt declined: a redrive may charge again, under a new key
+			if attempt, err = redisClient.Incr(ctx, paymentAttemptKey(requestID)).Result(); err != nil {
+				return ChargeResult{}, fmt.Errorf("advance payment attempt: %w", err)
+			}
+			redisClient.Expire(ctx, paymentAttemptKey(requestID), 7*24*time.Hour)
+			attempt++
+			key = paymentIdempotencyKey(requestID, attempt)
+			logEntry = logEntry.WithFields(map[string]interface{}{
+				"payment_attempt":         attempt,
+				"payment_idempotency_key": key,
+			})
+		}
+	}
+
+	result, err := payments.Charge(ctx, ChargeRequest{
+		IdempotencyKey: key,
+		RequestID:      requestID,
+		UserID:         order.UserID,
+		ItemID:         order.ItemID,
+		Quantity:       orderQuantity(order),
+		Lines:          order.Lines,
+	})
+	if err != nil {
+		metrics.PaymentCharges.WithLabelValues("error").Inc()
+		return result, err
+	}
+	metrics.PaymentCharges.WithLabelValues(result.Status).Inc()
+	logEntry.WithFields(map[string]interface{}{
+		"event":          "payment_charged",
+		"charge_id":      result.ChargeID,
+		"payment_status": result.Status,
+	}).Info("Payment charge completed")
+	return result, nil
+}
+
+// simulatedPaymentProvider stands in for a payment service: 10% of charges time out
+type simulatedPaymentProvider struct{}
+
+func (simulatedPaymentProvider) Name() string {
+	return "simulated"
+}
+
+func (simulatedPaymentProvider) Charge(ctx context.Context, req ChargeRequest) (ChargeResult, error) {
+	if time.Now().Unix()%10 == 0 {
+		return ChargeResult{}, ErrPaymentTimeout
+	}
+	return ChargeResult{Status: ChargeSucceeded, ChargeID: req.IdempotencyKey}, nil
+}
+
+// ChargeStatus keeps no state: the simulation never finds an earlier charge
+func (simulatedPaymentProvider) ChargeStatus(ctx context.Context, idempotencyKey string) (ChargeResult, bool, error) {
+	return ChargeResult{}, false, nil
+}
+
+// HTTPPaymentProvider talks to a payment service over HTTP
+//   - POST {url}/charges with the ChargeRequest and an Idempotency-Key header
+//   - GET {url}/charges/{idempotency_key}, 404 when no charge exists
+//
+// Both return a ChargeResult; timeouts and 5xx responses are reported as ErrPaymentTimeout
+type HTTPPaymentProvider struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPPaymentProvider creates a provider for the service at baseURL using client
+func NewHTTPPaymentProvider(baseURL string, client *http.Client) *HTTPPaymentProvider {
+	return &HTTPPaymentProvider{url: baseURL, client: client}
+}
+
+func (p *HTTPPaymentProvider) Name() string {
+	return "http"
+}
+
+func (p *HTTPPaymentProvider) Charge(ctx context.Context, req ChargeRequest) (ChargeResult, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return ChargeResult{}, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url+"/charges", bytes.NewReader(body))
+	if err != nil {
+		return ChargeResult{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Idempotency-Key", req.IdempotencyKey)
+	result, _, err := p.do(httpReq)
+	return result, err
+}
+
+func (p *HTTPPaymentProvider) ChargeStatus(ctx context.Context, idempotencyKey string) (ChargeResult, bool, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url+"/charges/"+url.PathEscape(idempotencyKey), nil)
+	if err != nil {
+		return ChargeResult{}, false, err
+	}
+	return p.do(httpReq)
+}
+
+func (p *HTTPPaymentProvider) do(req *http.Request) (ChargeResult, bool, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return ChargeResult{}, false, fmt.Errorf("%w: %v", ErrPaymentTimeout, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ChargeResult{}, false, nil
+	case resp.StatusCode >= 500:
+		return ChargeResult{}, false, fmt.Errorf("%w: status %d", ErrPaymentTimeout, resp.StatusCode)
+	case resp.StatusCode >= 300:
+		return ChargeResult{}, false, fmt.Errorf("payment provider returned status %d", resp.StatusCode)
+	}
+	var result ChargeResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return ChargeResult{}, false, fmt.Errorf("%w: decode response: %v", ErrPaymentTimeout, err)
+	}
+	return result, true, nil
+}
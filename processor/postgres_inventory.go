@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+
+	_ "github.com/lib/pq" // Postgres driver for database/sql
+)
+
+// postgresInventorySchema is created on startup if missing
+// The CHECK constraint is a last line of defence; Reserve never lets stock go negative
+// reserved and sold are the projection counts (see inventory_projection.go), added to older tables
+// inventory_reservations holds the reservation of each request_id, which makes reservations
+// idempotent and refunds exact; confirmed (sold) rows stay and count against the buyer's
+// purchase cap and toward their channel's reserve. Rows older than the cap window can be pruned
+// by reserved_at once the sale is over
+const postgresInventorySchema = `
+CREATE TABLE IF NOT EXISTS inventory (
+    item_id    TEXT PRIMARY KEY,
+    stock      BIGINT NOT NULL CHECK (stock >= 0),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+ALTER TABLE inventory ADD COLUMN IF NOT EXISTS reserved BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE inventory ADD COLUMN IF NOT EXISTS sold BIGINT NOT NULL DEFAULT 0;
+CREATE TABLE IF NOT EXISTS inventory_reservations (
+    request_id  TEXT PRIMARY KEY,
+    item_id     TEXT NOT NULL,
+    user_id     TEXT NOT NULL DEFAULT '',
+    quantity    BIGINT NOT NULL,
+    sold        BOOLEAN NOT NULL DEFAULT false,
+    reserved_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+ALTER TABLE inventory_reservations ADD COLUMN IF NOT EXISTS channel TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS inventory_reservations_buyer ON inventory_reservations (item_id, user_id, reserved_at)`
+
+// PostgresInventoryStore keeps stock in a Postgres table for items that need durable inventory
+// Every reservation is a single conditional UPDATE ... RETURNING, in one transaction with its
+// reservation row, so it is atomic without explicit locks, at a far lower throughput than Redis
+// Blue/green versions and channel allocation buckets are Redis-only; channel reserves are
+// honoured, measured against the reservation rows of each channel
+type PostgresInventoryStore struct {
+	db *sql.DB
+}
+
+// NewPostgresInventoryStore connects to dsn and creates the inventory table if needed
+func NewPostgresInventoryStore(ctx context.Context, dsn string) (*PostgresInventoryStore, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, postgresInventorySchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &PostgresInventoryStore{db: db}, nil
+}
+
+// Reserve decrements stock if the order leaves at least the units still reserved for other channels
+// With a request ID the reservation row is inserted in the same transaction, so a request that
+// already holds its units gets ALREADY_RESERVED instead of a second decrement. With a cap the
+// buyer's rows within the window, this one included, must not exceed it; a per-buyer advisory
+// lock keeps concurrent orders of the same buyer from passing together
+// A rejected update is followed by a plain read only to report why it was rejected
+func (s *PostgresInventoryStore) Reserve(ctx context.Context, req ReserveRequest) (ReserveResult, error) {
+	if req.Amount <= 0 {
+		return ReserveResult{Reason: "INVALID_QUANTITY"}, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return ReserveResult{}, err
+	}
+	defer tx.Rollback()
+
+	var stock int64
+	capped := req.Cap > 0 && req.RequestID != ""
+	if capped {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1 || ':' || $2))`, req.ItemID, req.UserID); err != nil {
+			return ReserveResult{}, err
+		}
+	}
+	if req.RequestID != "" {
+		inserted, err := tx.ExecContext(ctx,
+			`INSERT INTO inventory_reservations (request_id, item_id, user_id, quantity, channel) VALUES ($1, $2, $3, $4, $5)
+			 ON CONFLICT (request_id) DO NOTHING`,
+			req.RequestID, req.ItemID, req.UserID, req.Amount, req.Channel)
+		if err != nil {
+			return ReserveResult{}, err
+		}
+		if n, err := inserted.RowsAffected(); err != nil {
+			return ReserveResult{}, err
+		} else if n == 0 {
+			if err := s.db.QueryRowContext(ctx, `SELECT stock FROM inventory WHERE item_id = $1`, req.ItemID).Scan(&stock); err != nil {
+				return ReserveResult{}, err
+			}
+			return ReserveResult{Reserved: true, Stock: stock, Reason: "ALREADY_RESERVED"}, nil
+		}
+	}
+	if capped {
+		var purchased int64
+		err := tx.QueryRowContext(ctx,
+			`SELECT COALESCE(SUM(quantity), 0) FROM inventory_reservations
+			 WHERE item_id = $1 AND user_id = $2 AND reserved_at > now() - make_interval(secs => $3)`,
+			req.ItemID, req.UserID, req.CapWindow.Seconds()).Scan(&purchased)
+		if err != nil {
+			return ReserveResult{}, err
+		}
+		if purchased > req.Cap {
+			tx.Rollback()
+			if err := s.db.QueryRowContext(ctx, `SELECT stock FROM inventory WHERE item_id = $1`, req.ItemID).Scan(&stock); err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return ReserveResult{}, err
+			}
+			return ReserveResult{Stock: stock - req.Amount, Reason: "PURCHASE_LIMIT"}, nil
+		}
+	}
+	floor, err := s.reservedFloor(ctx, tx, req)
+	if err != nil {
+		return ReserveResult{}, err
+	}
+	err = tx.QueryRowContext(ctx,
+		`UPDATE inventory SET stock = stock - $2, reserved = reserved + $2, updated_at = now()
+		 WHERE item_id = $1 AND stock - $2 >= GREATEST($3::BIGINT, 0)
+		 RETURNING stock`,
+		req.ItemID, req.Amount, floor).Scan(&stock)
+	if err == nil {
+		if err := tx.Commit(); err != nil {
+			return ReserveResult{}, err
+		}
+		return ReserveResult{Reserved: true, Stock: stock, Reason: "SUCCESS"}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return ReserveResult{}, err
+	}
+	tx.Rollback()
+
+	err = s.db.QueryRowContext(ctx, `SELECT stock FROM inventory WHERE item_id = $1`, req.ItemID).Scan(&stock)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ReserveResult{Stock: -1, Reason: "NOT_INITIALIZED"}, nil
+	}
+	if err != nil {
+		return ReserveResult{}, err
+	}
+	// Match the Redis store: Stock is the level the order would have left
+	result := ReserveResult{Stock: stock - req.Amount, Reason: "CHANNEL_RESERVED"}
+	if stock < req.Amount {
+		result.Reason = "SOLD_OUT"
+	}
+	return result, nil
+}
+
+// reservedFloor returns the units still reserved for other channels: each channel's share of the
+// item's units less what its reservation rows hold. The item row is locked until tx ends so the
+// floor cannot change before the update
+func (s *PostgresInventoryStore) reservedFloor(ctx context.Context, tx *sql.Tx, req ReserveRequest) (int64, error) {
+	if len(req.Reserves) == 0 {
+		return 0, nil
+	}
+	var units int64
+	err := tx.QueryRowContext(ctx, `SELECT stock + reserved + sold FROM inventory WHERE item_id = $1 FOR UPDATE`, req.ItemID).Scan(&units)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	rows, err := tx.QueryContext(ctx,
+		`SELECT channel, COALESCE(SUM(quantity), 0) FROM inventory_reservations WHERE item_id = $1 GROUP BY channel`, req.ItemID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	held := make(map[string]int64)
+	for rows.Next() {
+		var channel string
+		var quantity int64
+		if err := rows.Scan(&channel, &quantity); err != nil {
+			return 0, err
+		}
+		held[channel] = quantity
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	var floor int64
+	for channel, percent := range req.Reserves {
+		floor += max(0, int64(math.Ceil(float64(units)*percent/100))-held[channel])
+	}
+	return floor, nil
+}
+
+// Refund adds amount units back, creating the row if it doesn't exist (like Redis INCRBY)
+// With a request ID only a reservation row still open (not sold) is refunded, in the same
+// transaction that deletes it, which also takes its units off the buyer's purchase cap
+func (s *PostgresInventoryStore) Refund(ctx context.Context, req RefundRequest) (int64, error) {
+	itemID, requestID, amount := req.ItemID, req.RequestID, req.Amount
+	if amount <= 0 {
+		return 0, ErrInvalidRefund
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var stock int64
+	if requestID != "" {
+		deleted, err := tx.ExecContext(ctx, `DELETE FROM inventory_reservations WHERE request_id = $1 AND NOT sold`, requestID)
+		if err != nil {
+			return 0, err
+		}
+		if n, err := deleted.RowsAffected(); err != nil {
+			return 0, err
+		} else if n == 0 {
+			err := s.db.QueryRowContext(ctx, `SELECT stock FROM inventory WHERE item_id = $1`, itemID).Scan(&stock)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return 0, err
+			}
+			return stock, ErrNoReservation
+		}
+	}
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO inventory (item_id, stock) VALUES ($1, $2)
+		 ON CONFLICT (item_id) DO UPDATE SET stock = inventory.stock + EXCLUDED.stock,
+		     reserved = GREATEST(inventory.reserved - EXCLUDED.stock, 0), updated_at = now()
+		 RETURNING stock`,
+		itemID, amount).Scan(&stock)
+	if err != nil {
+		return 0, err
+	}
+	return stock, tx.Commit()
+}
+
+// Restock sets the item's stock, or only creates it when onlyIfMissing is set
+func (s *PostgresInventoryStore) Restock(ctx context.Context, itemID string, stock int64, onlyIfMissing bool) (bool, error) {
+	query := `INSERT INTO inventory (item_id, stock) VALUES ($1, $2)
+		 ON CONFLICT (item_id) DO UPDATE SET stock = EXCLUDED.stock, updated_at = now()`
+	if onlyIfMissing {
+		query = `INSERT INTO inventory (item_id, stock) VALUES ($1, $2) ON CONFLICT (item_id) DO NOTHING`
+	}
+	result, err := s.db.ExecContext(ctx, query, itemID, stock)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// Stock reads the item's row
+func (s *PostgresInventoryStore) Stock(ctx context.Context, itemID string) (int64, bool, error) {
+	var stock int64
+	err := s.db.QueryRowContext(ctx, `SELECT stock FROM inventory WHERE item_id = $1`, itemID).Scan(&stock)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return stock, err == nil, err
+}
+
+// AddStock increments an existing row in one statement
+func (s *PostgresInventoryStore) AddStock(ctx context.Context, itemID string, units int64) (int64, int64, bool, error) {
+	var after int64
+	err := s.db.QueryRowContext(ctx,
+		`UPDATE inventory SET stock = stock + $2, updated_at = now() WHERE item_id = $1 RETURNING stock`,
+		itemID, units).Scan(&after)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, false, nil
+	}
+	if err != nil {
+		return 0, 0, false, err
+	}
+	return after - units, after, true, nil
+}
+
+// Confirm moves the units from reserved to sold in one statement, once per reservation: the
+// request's row is marked sold with it, and a request confirmed before leaves the counts alone
+// A missing row is not an error: there is nothing left to project
+func (s *PostgresInventoryStore) Confirm(ctx context.Context, itemID, requestID string, amount int64) (InventoryProjection, error) {
+	var projection InventoryProjection
+	err := s.db.QueryRowContext(ctx,
+		`WITH closed AS (UPDATE inventory_reservations SET sold = true WHERE request_id = $3 AND NOT sold RETURNING 1)
+		 UPDATE inventory SET reserved = GREATEST(reserved - $2, 0), sold = sold + $2, updated_at = now()
+		 WHERE item_id = $1 AND ($3 = '' OR EXISTS (SELECT 1 FROM closed)) RETURNING stock, reserved, sold`,
+		itemID, amount, requestID).Scan(&projection.Available, &projection.Reserved, &projection.Sold)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Missing row, or the reservation was confirmed before: report the counts as they are
+		projection, _, err = s.Projection(ctx, itemID)
+	}
+	return projection, err
+}
+
+// Projection reads the item's row
+func (s *PostgresInventoryStore) Projection(ctx context.Context, itemID string) (InventoryProjection, bool, error) {
+	var projection InventoryProjection
+	err := s.db.QueryRowContext(ctx, `SELECT stock, reserved, sold FROM inventory WHERE item_id = $1`, itemID).
+		Scan(&projection.Available, &projection.Reserved, &projection.Sold)
+	if errors.Is(err, sql.ErrNoRows) {
+		return InventoryProjection{}, false, nil
+	}
+	return projection, err == nil, err
+}
+
+// Close releases the connection pool
+func (s *PostgresInventoryStore) Close() error {
+	return s.db.Close()
+}
+
+// RoutedInventoryStore sends each item to its configured store, falling back to a default
+// Used to keep most items in Redis while selected items use Postgres (INVENTORY_POSTGRES_ITEMS)
+type RoutedInventoryStore struct {
+	fallback InventoryStore
+	items    map[string]InventoryStore
+	all      InventoryStore // Non-nil when every item is routed to one store ("*")
+}
+
+// NewRoutedInventoryStore routes itemIDs to store and everything else to fallback
+// An item ID of "*" routes every item to store
+func NewRoutedInventoryStore(fallback, store InventoryStore, itemIDs []string) *RoutedInventoryStore {
+	routed := &RoutedInventoryStore{fallback: fallback, items: make(map[string]InventoryStore, len(itemIDs))}
+	for _, itemID := range itemIDs {
+		if itemID == "*" {
+			routed.all = store
+		}
+		routed.items[itemID] = store
+	}
+	return routed
+}
+
+func (s *RoutedInventoryStore) storeFor(itemID string) InventoryStore {
+	if s.all != nil {
+		return s.all
+	}
+	if store, ok := s.items[itemID]; ok {
+		return store
+	}
+	return s.fallback
+}
+
+// Reserve delegates to the item's store
+func (s *RoutedInventoryStore) Reserve(ctx context.Context, req ReserveRequest) (ReserveResult, error) {
+	return s.storeFor(req.ItemID).Reserve(ctx, req)
+}
+
+// Refund delegates to the item's store
+func (s *RoutedInventoryStore) Refund(ctx context.Context, req RefundRequest) (int64, error) {
+	return s.storeFor(req.ItemID).Refund(ctx, req)
+}
+
+// Restock delegates to the item's store
+func (s *RoutedInventoryStore) Restock(ctx context.Context, itemID string, stock int64, onlyIfMissing bool) (bool, error) {
+	return s.storeFor(itemID).Restock(ctx, itemID, stock, onlyIfMissing)
+}
+
+// Stock delegates to the item's store
+func (s *RoutedInventoryStore) Stock(ctx context.Context, itemID string) (int64, bool, error) {
+	return s.storeFor(itemID).Stock(ctx, itemID)
+}
+
+// ReloadScripts reloads the fallback store's scripts, if it has any
+func (s *RoutedInventoryStore) ReloadScripts(ctx context.Context) error {
+	if loader, ok := s.fallback.(interface{ ReloadScripts(context.Context) error }); ok {
+		return loader.ReloadScripts(ctx)
+	}
+	return nil
+}
+
+// AddStock delegates to the item's store
+func (s *RoutedInventoryStore) AddStock(ctx context.Context, itemID string, units int64) (int64, int64, bool, error) {
+	return s.storeFor(itemID).AddStock(ctx, itemID, units)
+}
+
+// Confirm delegates to the item's store
+func (s *RoutedInventoryStore) Confirm(ctx context.Context, itemID, requestID string, amount int64) (InventoryProjection, error) {
+	return s.storeFor(itemID).Confirm(ctx, itemID, requestID, amount)
+}
+
+// Projection delegates to the item's store
+func (s *RoutedInventoryStore) Projection(ctx context.Context, itemID string) (InventoryProjection, bool, error) {
+	return s.storeFor(itemID).Projection(ctx, itemID)
+}
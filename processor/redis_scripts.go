@@ -1,57 +1,12 @@
 package main
 
-// luaCheckInventoryScript atomically checks and decrements inventory
-// Returns {success: 0|1, stock: int} where:
-//   - success=0: Item sold out (stock < 0), inventory already refunded
-//   - success=1: Inventory reserved successfully
-//
-// This script ensures DECR and conditional refund are atomic, preventing race conditions
-// Edge cases handled:
-//   - Missing key: DECR on non-existent key initializes to -1, then refunds to 0
-//   - Redis OOM: Script fails with error (handled in Go code)
-//   - Timeout: Redis will timeout script execution (handled in Go code)
-const luaCheckInventoryScript = `
-local inventory_key = KEYS[1]
--- Check if key exists first to handle missing inventory gracefully
-local exists = redis.call('EXISTS', inventory_key)
-if exists == 0 then
-    -- Key doesn't exist - treat as sold out (inventory not initialized)
-    return {0, -1, 'NOT_INITIALIZED'}  -- {success, stock, reason}
-end
-
--- Atomically decrement inventory
-local current_stock = redis.call('DECR', inventory_key)
-
-if current_stock < 0 then
-    -- Sold out: refund the decrement immediately to keep inventory accurate
-    redis.call('INCR', inventory_key)
-    return {0, current_stock, 'SOLD_OUT'}  -- {success, stock, reason}
-else
-    return {1, current_stock, 'SUCCESS'}  -- {success, stock, reason}
-end
-`
-
-// luaRefundInventoryScript atomically refunds inventory
-// Used when payment processing fails or order needs to be cancelled
-// Returns {success: 0|1, new_stock: int} where:
-//   - success=1: Refund successful
-//   - success=0: Invalid refund amount
-//
-// Edge cases handled:
-//   - Missing key: INCRBY on non-existent key initializes to refund_amount
-//   - Invalid amount: Returns 0 if amount is nil or <= 0
-const luaRefundInventoryScript = `
-local inventory_key = KEYS[1]
-local refund_amount = tonumber(ARGV[1])
-
--- Validate refund amount
-if not refund_amount or refund_amount <= 0 then
-    return {0, 0}  -- {success, new_stock}
+// luaSpillPushScript appends a DLQ message to the spill list unless it already holds ARGV[2] entries
+// Returns the new length, or -1 when the spill is full
+const luaSpillPushScript = `
+if redis.call('LLEN', KEYS[1]) >= tonumber(ARGV[2]) then
+    return -1
 end
-
--- Atomically increment inventory (creates key if doesn't exist)
-local new_stock = redis.call('INCRBY', inventory_key, refund_amount)
-return {1, new_stock}  -- {success, new_stock}
+return redis.call('RPUSH', KEYS[1], ARGV[1])
 `
 
 // luaProcessOrder combines inventory check with order state tracking
@@ -77,3 +32,51 @@ redis.call('HSET', order_key .. ':meta', 'timestamp', timestamp, 'stock_after',
 
 return {1, current_stock, 'SUCCESS'}  -- {success, stock, status}
 `
+
+// luaAssignDigitalCodeScript assigns one preloaded code to an order, at most once per request_id
+// KEYS[1] is the available list digital_codes:{item_id}, KEYS[2] the delivered list
+// digital_codes_delivered:{item_id}, KEYS[3] the assignment hash digital_code_assignments:{item_id}
+// and KEYS[4] the pending set digital_delivery_pending:{item_id}
+// ARGV[1] is the request_id
+// Returns {code: string, remaining: int, reason: string} where reason is:
+//   - ASSIGNED: code moved from the available to the delivered list (RPOPLPUSH) and recorded;
+//     the order leaves the pending set if an earlier attempt put it there
+//   - ALREADY_ASSIGNED: the order was processed before (redelivery); its original code is returned
+//   - EXHAUSTED: no codes left, code is empty
+const luaAssignDigitalCodeScript = `
+local existing = redis.call('HGET', KEYS[3], ARGV[1])
+if existing then
+    redis.call('SREM', KEYS[4], ARGV[1])
+    return {existing, redis.call('LLEN', KEYS[1]), 'ALREADY_ASSIGNED'}
+end
+
+local code = redis.call('RPOPLPUSH', KEYS[1], KEYS[2])
+if not code then
+    return {'', 0, 'EXHAUSTED'}
+end
+redis.call('HSET', KEYS[3], ARGV[1], code)
+redis.call('SREM', KEYS[4], ARGV[1])
+return {code, redis.call('LLEN', KEYS[1]), 'ASSIGNED'}
+`
+
+// luaPendDigitalDeliveryScript marks an order as waiting for a code unless it already has one
+// (an assignment that timed out on the client but ran in Redis)
+// KEYS[1] is the assignment hash digital_code_assignments:{item_id}, KEYS[2] the pending set
+// digital_delivery_pending:{item_id}; ARGV[1] is the request_id
+// Returns 1 if the order is pending, 0 if it already has a code
+const luaPendDigitalDeliveryScript = `
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 1 then
+    return 0
+end
+redis.call('SADD', KEYS[2], ARGV[1])
+return 1
+`
+
+// luaClaimOrderScript marks an amendable order as claimed by the processor and returns its
+// amendment, so a gateway can't amend it between the read and the claim
+// KEYS[1] is order_claimed:{request_id}, KEYS[2] order_amendment:{request_id}; ARGV[1] the claim TTL in seconds
+// Returns the amendment JSON, or nil when the order was not amended
+const luaClaimOrderScript = `
+redis.call('SET', KEYS[1], '1', 'EX', ARGV[1])
+return redis.call('GET', KEYS[2])
+`
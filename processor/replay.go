@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sirupsen/logrus"
+)
+
+// Replay modes (-replay-mode)
+const (
+	ReplayDryRun = "dry-run" // Report what a live run would process; nothing is changed
+	ReplayLive   = "live"    // Process orders that never touched inventory, skip the rest
+)
+
+// processedOrderKeyPrefix marks orders that reached the inventory step (order_processed:{request_id})
+const processedOrderKeyPrefix = "order_processed:"
+
+// processedOrderTTL is how long processed markers are kept (ORDER_PROCESSED_TTL); replays
+// further back than this can't tell processed orders apart
+var processedOrderTTL = 7 * 24 * time.Hour
+
+// replaying is set during a live replay: orders already marked processed are skipped
+var replaying bool
+
+// replaySkipped counts orders a live replay skipped as already processed
+var replaySkipped int
+
+// ReplayOptions selects the messages a replay reads
+type ReplayOptions struct {
+	Mode  string
+	Topic string
+	From  time.Time
+	To    time.Time
+}
+
+// ReplaySummary reports the outcome of a replay run
+type ReplaySummary struct {
+	Mode             string        `json:"mode"`
+	Topic            string        `json:"topic"`
+	From             time.Time     `json:"from"`
+	To               time.Time     `json:"to"`
+	Partitions       []ReplayRange `json:"partitions"`
+	Messages         int           `json:"messages"`
+	Processed        int           `json:"processed"`         // live: processed again
+	WouldProcess     int           `json:"would_process"`     // dry-run: not marked processed
+	AlreadyProcessed int           `json:"already_processed"` // Marked processed, skipped
+	NoRequestID      int           `json:"no_request_id"`     // Can't be deduplicated, skipped
+	CheckErrors      int           `json:"check_errors"`      // dry-run: marker lookups that failed
+	DurationMs       int64         `json:"duration_ms"`
+}
+
+// ReplayRange is the offset range [From, To) replayed from one partition
+// ReadTo is the offset after the last message read; Stopped tells why a read ended before To
+type ReplayRange struct {
+	Partition int32  `json:"partition"`
+	From      int64  `json:"from_offset"`
+	To        int64  `json:"to_offset"`
+	ReadTo    int64  `json:"read_to_offset"`
+	Stopped   string `json:"stopped,omitempty"`
+}
+
+// Reasons a partition read ended before the end of its range (ReplayRange.Stopped)
+const (
+	replayStoppedCancelled = "cancelled"
+	replayStoppedIdle      = "idle"   // No message for replayIdleTimeout
+	replayStoppedClosed    = "closed" // The partition consumer closed (e.g. the partition was deleted)
+)
+
+// replayIdleTimeout ends a partition read that gets no message for this long; the last offsets
+// of a range may never arrive (compacted or deleted, transaction markers, aborted batches)
+var replayIdleTimeout = 10 * time.Second
+
+// nextReplayMessage returns the next message of r from pc, or nil once the read is over: the
+// range's last offset was read, ctx ended, pc closed or it stayed idle; r records where it stopped
+func nextReplayMessage(ctx context.Context, pc sarama.PartitionConsumer, r *ReplayRange) *sarama.ConsumerMessage {
+	if r.ReadTo < r.From {
+		r.ReadTo = r.From
+	}
+	if r.ReadTo >= r.To {
+		return nil
+	}
+	idle := time.NewTimer(replayIdleTimeout)
+	defer idle.Stop()
+	select {
+	case msg, ok := <-pc.Messages():
+		if !ok {
+			r.Stopped = replayStoppedClosed
+			return nil
+		}
+		r.ReadTo = msg.Offset + 1
+		return msg
+	case <-ctx.Done():
+		r.Stopped = replayStoppedCancelled
+	case <-idle.C:
+		r.Stopped = replayStoppedIdle
+	}
+	return nil
+}
+
+// parseReplayOptions validates the -replay-* flags
+func parseReplayOptions(from, to, mode, topic string) (ReplayOptions, error) {
+	opts := ReplayOptions{Mode: mode, Topic: topic, To: time.Now()}
+	if mode != ReplayDryRun && mode != ReplayLive {
+		return opts, fmt.Errorf("-replay-mode must be %s or %s", ReplayDryRun, ReplayLive)
+	}
+	var err error
+	if opts.From, err = time.Parse(time.RFC3339, from); err != nil {
+		return opts, fmt.Errorf("invalid -replay-from: %w", err)
+	}
+	if to != "" {
+		if opts.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return opts, fmt.Errorf("invalid -replay-to: %w", err)
+		}
+	}
+	if !opts.From.Before(opts.To) {
+		return opts, fmt.Errorf("-replay-from must be before -replay-to")
+	}
+	return opts, nil
+}
+
+// recordOrderProcessing marks the order as having reached the inventory step
+// Returns false if the order must not touch inventory: during a live replay that is when it
+// was marked before or the marker can't be checked, outside replays when another copy of it
+// was processed (see claimOrderCopy). Outside replays a failed write is only logged, since
+// the marker must never block live traffic
+func recordOrderProcessing(logEntry *logrus.Entry, msg *sarama.ConsumerMessage, order *OrderRequest, requestID string) bool {
+	if requestID == "" {
+		return !replaying
+	}
+	key := processedOrderKeyPrefix + requestID
+	if !replaying {
+		return claimOrderCopy(logEntry, msg, order, key, requestID)
+	}
+	first, err := redisClient.SetNX(ctx, key, time.Now().UTC().Format(time.RFC3339Nano), processedOrderTTL).Result()
+	if err != nil {
+		logEntry.WithError(err).Error("Failed to check processed marker, skipping replayed order")
+		return false
+	}
+	if !first {
+		replaySkipped++
+		logEntry.WithField("event", "replay_order_skipped").Info("Order already processed, skipping replay")
+	}
+	return first
+}
+
+// forgetOrderProcessing removes the marker of an order whose reservation failed, so a later retry
+// or replay may process it. A reservation that did run before the error surfaced is recorded
+// under the request ID, and the next attempt continues with it (ALREADY_RESERVED)
+func forgetOrderProcessing(requestID string) {
+	if requestID != "" {
+		redisClient.Del(ctx, processedOrderKeyPrefix+requestID)
+	}
+}
+
+// releaseUncertainReservation refunds whatever a failed reservation call may have taken before
+// its order goes to the DLQ; the refund is a no-op if the reservation never ran
+// If the refund fails too, a replay of the order finds the reservation and continues with it
+func releaseUncertainReservation(logEntry *logrus.Entry, order *OrderRequest, requestID string) {
+	if requestID == "" {
+		return
+	}
+	refundCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	newStock, err := inventory.Refund(refundCtx, RefundRequest{
+		ItemID:    order.ItemID,
+		Channel:   order.Channel,
+		UserID:    order.UserID,
+		RequestID: requestID,
+		Amount:    order.Amount,
+	})
+	switch {
+	case errors.Is(err, ErrNoReservation):
+	case err != nil:
+		logEntry.WithError(err).WithField("event", "reservation_release_failed").Warn("Failed to release possible reservation, a replay will continue with it")
+	default:
+		logEntry.WithFields(logrus.Fields{
+			"event":     "reservation_released",
+			"new_stock": newStock,
+		}).Warn("Released reservation held by the failed order")
+		publishInventoryState(logEntry, order.ItemID, newStock)
+		refreshInventoryProjection(logEntry, order.ItemID)
+	}
+}
+
+// replayRanges resolves opts' time range to offsets on every partition of the topic
+func replayRanges(client sarama.Client, opts ReplayOptions) ([]ReplayRange, error) {
+	partitions, err := client.Partitions(opts.Topic)
+	if err != nil {
+		return nil, err
+	}
+	var ranges []ReplayRange
+	for _, partition := range partitions {
+		from, err := client.GetOffset(opts.Topic, partition, opts.From.UnixMilli())
+		if err != nil {
+			return nil, fmt.Errorf("partition %d: %w", partition, err)
+		}
+		to, err := client.GetOffset(opts.Topic, partition, opts.To.UnixMilli())
+		if err != nil {
+			return nil, fmt.Errorf("partition %d: %w", partition, err)
+		}
+		// -1: no message at or after the timestamp
+		if to < 0 {
+			if to, err = client.GetOffset(opts.Topic, partition, sarama.OffsetNewest); err != nil {
+				return nil, fmt.Errorf("partition %d: %w", partition, err)
+			}
+		}
+		if from < 0 || from >= to {
+			continue
+		}
+		ranges = append(ranges, ReplayRange{Partition: partition, From: from, To: to})
+	}
+	return ranges, nil
+}
+
+// runReplay re-reads the orders published between opts.From and opts.To
+// A dry run only counts orders by whether they were processed before; a live run feeds the
+// unprocessed ones through processOrder, where recordOrderProcessing enforces the dedup
+// Partitions whose read ended early (ctx cancelled, idle) are reported with how far they got
+func runReplay(ctx context.Context, client sarama.Client, consumer sarama.Consumer, opts ReplayOptions) (ReplaySummary, error) {
+	start := time.Now()
+	summary := ReplaySummary{Mode: opts.Mode, Topic: opts.Topic, From: opts.From, To: opts.To}
+	ranges, err := replayRanges(client, opts)
+	if err != nil {
+		return summary, err
+	}
+	summary.Partitions = ranges
+	replaying = opts.Mode == ReplayLive
+
+	for i := range ranges {
+		r := &ranges[i]
+		pc, err := consumer.ConsumePartition(opts.Topic, r.Partition, r.From)
+		if err != nil {
+			return summary, fmt.Errorf("partition %d: %w", r.Partition, err)
+		}
+		for msg := nextReplayMessage(ctx, pc, r); msg != nil; msg = nextReplayMessage(ctx, pc, r) {
+			summary.Messages++
+			requestID := extractRequestID(msg.Headers)
+			switch {
+			case requestID == "":
+				summary.NoRequestID++
+			case opts.Mode == ReplayLive:
+				// processOrder skips the order if it was processed before
+				skipped := replaySkipped
+				processOrder(msg)
+				if replaySkipped > skipped {
+					summary.AlreadyProcessed++
+				} else {
+					summary.Processed++
+				}
+			default:
+				exists, err := redisClient.Exists(ctx, processedOrderKeyPrefix+requestID).Result()
+				switch {
+				case err != nil:
+					summary.CheckErrors++
+				case exists > 0:
+					summary.AlreadyProcessed++
+				default:
+					summary.WouldProcess++
+				}
+			}
+		}
+		if err := pc.Close(); err != nil {
+			logger.WithError(err).WithField("partition", r.Partition).Warn("Error closing replay consumer")
+		}
+		logger.WithFields(logrus.Fields{
+			"event":          "replay_partition_done",
+			"partition":      r.Partition,
+			"from_offset":    r.From,
+			"to_offset":      r.To,
+			"read_to_offset": r.ReadTo,
+			"stopped":        r.Stopped,
+		}).Info("Replayed partition")
+		if r.Stopped == replayStoppedCancelled {
+			break
+		}
+	}
+	summary.DurationMs = time.Since(start).Milliseconds()
+	return summary, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// channelPartitionConsumer serves messages from a channel; other methods are not used
+type channelPartitionConsumer struct {
+	sarama.PartitionConsumer
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c channelPartitionConsumer) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+func TestNextReplayMessageStopsWhenTheRangeEndNeverArrives(t *testing.T) {
+	previous := replayIdleTimeout
+	replayIdleTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { replayIdleTimeout = previous })
+
+	// Offsets 10-11 are readable, 12-13 were compacted away
+	pc := channelPartitionConsumer{messages: make(chan *sarama.ConsumerMessage, 2)}
+	pc.messages <- &sarama.ConsumerMessage{Offset: 10}
+	pc.messages <- &sarama.ConsumerMessage{Offset: 11}
+	r := &ReplayRange{From: 10, To: 14}
+	read := 0
+	for msg := nextReplayMessage(context.Background(), pc, r); msg != nil; msg = nextReplayMessage(context.Background(), pc, r) {
+		read++
+	}
+	if read != 2 || r.ReadTo != 12 || r.Stopped != replayStoppedIdle {
+		t.Fatalf("read %d, read_to %d, stopped %q; want 2, 12, idle", read, r.ReadTo, r.Stopped)
+	}
+
+	// A complete range ends at its last offset without waiting
+	pc.messages <- &sarama.ConsumerMessage{Offset: 20}
+	r = &ReplayRange{From: 20, To: 21}
+	if nextReplayMessage(context.Background(), pc, r) == nil || nextReplayMessage(context.Background(), pc, r) != nil || r.Stopped != "" {
+		t.Fatalf("complete range: read_to %d, stopped %q", r.ReadTo, r.Stopped)
+	}
+
+	// Cancellation interrupts the wait
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r = &ReplayRange{From: 30, To: 40}
+	if nextReplayMessage(ctx, pc, r) != nil || r.Stopped != replayStoppedCancelled {
+		t.Fatalf("cancelled: stopped %q", r.Stopped)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// Datasets covered by the retention job
+const (
+	retentionOrders     = "orders"      // Postgres orders table (order store)
+	retentionAdminAudit = "admin_audit" // admin:audit stream
+)
+
+// retentionLockKey is held by the processor running the current retention pass
+const retentionLockKey = "retention:lock"
+
+// retentionBatchSize bounds the records removed (and archived) per statement
+const retentionBatchSize = 1000
+
+// RetentionPolicy says how long each dataset is kept; a zero retention keeps it forever
+type RetentionPolicy struct {
+	Orders      time.Duration // Orders whose latest result is older are soft-deleted
+	OrdersGrace time.Duration // Soft-deleted orders are purged after this long
+	AdminAudit  time.Duration
+}
+
+// RetentionJob applies the retention policy every interval
+// Processors share the work through a Redis lock held for most of an interval, so one
+// instance runs each pass; purged records go to the archive first when one is configured
+type RetentionJob struct {
+	policy   RetentionPolicy
+	orders   *OrderStore    // nil without ORDER_STORE_DSN
+	archive  *ObjectArchive // nil: purged records are not archived
+	interval time.Duration
+}
+
+// NewRetentionJob creates a job applying policy; orders and archive may be nil
+func NewRetentionJob(policy RetentionPolicy, orders *OrderStore, archive *ObjectArchive, interval time.Duration) *RetentionJob {
+	return &RetentionJob{policy: policy, orders: orders, archive: archive, interval: interval}
+}
+
+// Run applies the policy every interval, starting now
+func (j *RetentionJob) Run() {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		j.RunOnce(ctx)
+		<-ticker.C
+	}
+}
+
+// RunOnce applies the policy unless another processor holds the lock
+func (j *RetentionJob) RunOnce(ctx context.Context) {
+	acquired, err := redisClient.SetNX(ctx, retentionLockKey, 1, j.interval*9/10).Result()
+	if err != nil || !acquired {
+		return
+	}
+	now := time.Now()
+	result := "completed"
+	if j.orders != nil && j.policy.Orders > 0 {
+		if err := j.applyOrders(ctx, now); err != nil {
+			result = "failed"
+			logger.WithError(err).WithField("event", "retention_failed").WithField("dataset", retentionOrders).Error("Order retention failed")
+		}
+	}
+	if j.policy.AdminAudit > 0 {
+		if err := j.applyAdminAudit(ctx, now); err != nil {
+			result = "failed"
+			logger.WithError(err).WithField("event", "retention_failed").WithField("dataset", retentionAdminAudit).Error("Admin audit retention failed")
+		}
+	}
+	metrics.RetentionRuns.WithLabelValues(result).Inc()
+}
+
+// applyOrders soft-deletes expired orders, then purges those past the grace period
+func (j *RetentionJob) applyOrders(ctx context.Context, now time.Time) error {
+	softDeleted, err := j.orders.SoftDeleteBefore(ctx, now.Add(-j.policy.Orders))
+	j.count(retentionOrders, "soft_deleted", softDeleted)
+	if err != nil {
+		return err
+	}
+	var purged int
+	for {
+		n, err := j.orders.PurgeDeletedBefore(ctx, now.Add(-j.policy.OrdersGrace), func(orders []OrderRecord) error {
+			return archiveRecords(ctx, j.archive, retentionOrders, orders)
+		})
+		purged += n
+		j.count(retentionOrders, "purged", n)
+		if err != nil || n < retentionBatchSize {
+			j.logPass(retentionOrders, softDeleted, purged)
+			return err
+		}
+	}
+}
+
+// applyAdminAudit removes audit entries older than the retention, oldest first
+// Stream IDs start with the entry's time in milliseconds, so the cutoff is an ID range
+func (j *RetentionJob) applyAdminAudit(ctx context.Context, now time.Time) error {
+	end := strconv.FormatInt(now.Add(-j.policy.AdminAudit).UnixMilli()-1, 10)
+	var purged int
+	for {
+		messages, err := redisClient.XRangeN(ctx, adminAuditStream, "-", end, retentionBatchSize).Result()
+		if err != nil || len(messages) == 0 {
+			j.logPass(retentionAdminAudit, 0, purged)
+			return err
+		}
+		entries := make([]AdminAuditEntry, len(messages))
+		ids := make([]string, len(messages))
+		for i, message := range messages {
+			entries[i] = adminAuditEntryFromMessage(message)
+			ids[i] = message.ID
+		}
+		if err := archiveRecords(ctx, j.archive, retentionAdminAudit, entries); err != nil {
+			return err
+		}
+		if err := redisClient.XDel(ctx, adminAuditStream, ids...).Err(); err != nil {
+			return err
+		}
+		purged += len(ids)
+		j.count(retentionAdminAudit, "purged", len(ids))
+	}
+}
+
+func (j *RetentionJob) count(dataset, action string, n int) {
+	if n > 0 {
+		metrics.RetentionRecords.WithLabelValues(dataset, action).Add(float64(n))
+	}
+}
+
+func (j *RetentionJob) logPass(dataset string, softDeleted, purged int) {
+	if softDeleted == 0 && purged == 0 {
+		return
+	}
+	logger.WithFields(map[string]interface{}{
+		"event":        "retention_applied",
+		"dataset":      dataset,
+		"soft_deleted": softDeleted,
+		"purged":       purged,
+		"archived":     j.archive != nil,
+	}).Info("Retention policy applied")
+}
+
+// SoftDeleteBefore marks orders whose latest result is older than cutoff as deleted
+func (s *OrderStore) SoftDeleteBefore(ctx context.Context, cutoff time.Time) (int, error) {
+	var total int
+	for {
+		result, err := s.db.ExecContext(ctx, `UPDATE orders SET deleted_at = now()
+WHERE request_id IN (
+    SELECT request_id FROM orders WHERE deleted_at IS NULL AND updated_at < $1 LIMIT $2
+)`, cutoff, retentionBatchSize)
+		if err != nil {
+			return total, err
+		}
+		n, _ := result.RowsAffected()
+		total += int(n)
+		if n < retentionBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// PurgeDeletedBefore deletes up to retentionBatchSize orders soft-deleted before cutoff
+// archive is called with the deleted rows before the transaction commits, so rows that
+// couldn't be archived stay in place
+func (s *OrderStore) PurgeDeletedBefore(ctx context.Context, cutoff time.Time, archive func([]OrderRecord) error) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, `DELETE FROM orders
+WHERE request_id IN (
+    SELECT request_id FROM orders WHERE deleted_at < $1 LIMIT $2 FOR UPDATE SKIP LOCKED
+)
+RETURNING request_id, user_id, item_id, quantity, status, reason, created_at, updated_at, deleted_at`, cutoff, retentionBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var orders []OrderRecord
+	for rows.Next() {
+		var order OrderRecord
+		if err := rows.Scan(&order.RequestID, &order.UserID, &order.ItemID, &order.Quantity,
+			&order.Status, &order.Reason, &order.CreatedAt, &order.UpdatedAt, &order.DeletedAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		orders = append(orders, order)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(orders) == 0 {
+		return 0, nil
+	}
+	if err := archive(orders); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(orders), nil
+}
+
+// ObjectArchive writes objects to an S3-compatible bucket: purged records (retention.go) and
+// campaign exports (campaign_export.go)
+type ObjectArchive struct {
+	endpoint *url.URL
+	bucket   string
+	prefix   string
+	region   string
+	creds    common.AWSCredentials
+	client   *http.Client
+}
+
+// NewObjectArchive creates an archive in bucket; endpoint defaults to https://s3.<region>.amazonaws.com
+// and objects are addressed path-style, which S3-compatible stores (MinIO, R2, GCS interop) accept
+func NewObjectArchive(endpoint, bucket, prefix, region string, creds common.AWSCredentials, client *http.Client) (*ObjectArchive, error) {
+	if bucket == "" || region == "" {
+		return nil, errors.New("bucket and region are required")
+	}
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		return nil, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required")
+	}
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q", endpoint)
+	}
+	return &ObjectArchive{
+		endpoint: parsed,
+		bucket:   bucket,
+		prefix:   prefix,
+		region:   region,
+		creds:    creds,
+		client:   client,
+	}, nil
+}
+
+// archiveRecords stores records in archive as {prefix}{dataset}/YYYY/MM/DD/{unix nanos}.jsonl.gz
+// A nil archive discards them
+func archiveRecords[T any](ctx context.Context, archive *ObjectArchive, dataset string, records []T) error {
+	if archive == nil || len(records) == 0 {
+		return nil
+	}
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	encoder := json.NewEncoder(gz)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	key := archive.prefix + dataset + "/" + now.Format("2006/01/02") + "/" + strconv.FormatInt(now.UnixNano(), 10) + ".jsonl.gz"
+	if err := archive.put(ctx, key, "application/gzip", body.Bytes()); err != nil {
+		return fmt.Errorf("archive %s: %w", key, err)
+	}
+	metrics.RetentionRecords.WithLabelValues(dataset, "archived").Add(float64(len(records)))
+	return nil
+}
+
+// put uploads body to key in the bucket; callers add the prefix
+func (a *ObjectArchive) put(ctx context.Context, key, contentType string, body []byte) error {
+	endpoint := *a.endpoint
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + "/" + a.bucket + "/" + key
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	common.SignAWSRequest(req, body, "s3", a.region, a.creds, time.Now())
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("object store returned %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// orderRetryGroup is the consumer group of the retry topics, shared by every processor
+const orderRetryGroup = "flash-sale-order-retry"
+
+// headerRetryReason carries the failure that sent an order to a retry topic, for logs
+const headerRetryReason = "retry_reason"
+
+// orderRetryTier is a retry topic and how long its orders wait before they are processed again
+type orderRetryTier struct {
+	Topic string
+	Delay time.Duration
+}
+
+// orderRetryTiers are used in order; attempts past the last tier stay on it
+var orderRetryTiers = []orderRetryTier{
+	{Topic: common.TopicOrdersRetry5s, Delay: 5 * time.Second},
+	{Topic: common.TopicOrdersRetry1m, Delay: time.Minute},
+	{Topic: common.TopicOrdersRetry10m, Delay: 10 * time.Minute},
+}
+
+// orderRetryMaxAttempts is how often a transiently failed order is retried before it goes to
+// the DLQ (ORDER_RETRY_MAX_ATTEMPTS); 0 sends it to the DLQ right away
+var orderRetryMaxAttempts int
+
+// isTransientFailure reports whether an order failing for reason may succeed unchanged later
+// Retrying never takes stock twice: a Redis call that failed after the reservation ran left it
+// recorded under the request_id, which the retry continues with (ALREADY_RESERVED), and payment
+// timeouts refund first. The payment idempotency key keeps a retry from charging twice
+func isTransientFailure(reason string) bool {
+	switch reason {
+	case "Redis Timeout", "Redis Failure", "Payment Timeout":
+		return true
+	}
+	return false
+}
+
+// retryAttempt returns how often msg was sent to a retry topic before
+func retryAttempt(msg *sarama.ConsumerMessage) int {
+	attempt, _ := strconv.Atoi(extractHeader(msg.Headers, common.HeaderRetryAttempt))
+	return attempt
+}
+
+// retryTierFor returns the tier of the given retry attempt (1 for the first retry)
+func retryTierFor(attempt int) orderRetryTier {
+	return orderRetryTiers[min(attempt, len(orderRetryTiers))-1]
+}
+
+// retryOrder sends a transiently failed order to its next retry topic instead of the DLQ
+// Returns false when the order must go to the DLQ: the failure isn't transient, retries are
+// disabled or used up, or the retry topic couldn't be written
+func retryOrder(logEntry *logrus.Entry, msg *sarama.ConsumerMessage, reason string) bool {
+	if orderRetryMaxAttempts <= 0 || !isTransientFailure(reason) {
+		return false
+	}
+	attempt := retryAttempt(msg) + 1
+	if attempt > orderRetryMaxAttempts {
+		metrics.OrderRetriesExhausted.WithLabelValues(reason).Inc()
+		logEntry.WithFields(logrus.Fields{
+			"event":    "order_retries_exhausted",
+			"reason":   reason,
+			"attempts": attempt - 1,
+		}).Warn("Order retries exhausted, moving to DLQ")
+		return false
+	}
+
+	tier := retryTierFor(attempt)
+	out := &sarama.ProducerMessage{
+		Topic:     tier.Topic,
+		Key:       sarama.ByteEncoder(msg.Key),
+		Value:     sarama.ByteEncoder(msg.Value),
+		Timestamp: time.Now(),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte(common.HeaderRetryAttempt), Value: []byte(strconv.Itoa(attempt))},
+			{Key: []byte(headerRetryReason), Value: []byte(reason)},
+		},
+	}
+	// Every other header travels along (accepted_at keeps the copy's identity, purchase_cap its
+	// units); signatures cover the topic, so the retry is signed again
+	for _, header := range msg.Headers {
+		switch string(header.Key) {
+		case common.HeaderRetryAttempt, headerRetryReason, common.HeaderSignature, common.HeaderSignatureKeyID:
+		default:
+			out.Headers = append(out.Headers, *header)
+		}
+	}
+	if signer != nil && signer.CanSign() {
+		if err := signer.SignMessage(out); err != nil {
+			logEntry.WithError(err).Error("Failed to sign retried order")
+			return false
+		}
+	}
+	if _, _, err := producer.SendMessage(out); err != nil {
+		logEntry.WithError(err).WithField("topic", tier.Topic).Error("Failed to publish order to retry topic")
+		return false
+	}
+
+	metrics.OrderRetries.WithLabelValues(tier.Topic, reason).Inc()
+	logEntry.WithFields(logrus.Fields{
+		"event":   "order_retry_scheduled",
+		"reason":  reason,
+		"attempt": attempt,
+		"topic":   tier.Topic,
+		"delay":   tier.Delay.String(),
+	}).Warn("Order failed transiently, scheduled for retry")
+	return true
+}
+
+// OrderRetryConsumer processes the orders on the retry topics once their tier's delay has passed
+// since they were published
+// Each tier's orders are published in delay order, so a claim waits for its oldest order and
+// then processes it; a rebalance during the wait leaves the order for the next session
+// Orders are handed to the order dispatcher, which runs them on their item's worker, so a retry
+// never races a live order of the same item or a control command
+type OrderRetryConsumer struct {
+	active   atomic.Bool // In a consumer group session
+	dispatch chan<- queuedRetry
+}
+
+// queuedRetry is a retried order waiting for the order workers; done is closed once processed
+type queuedRetry struct {
+	msg  *sarama.ConsumerMessage
+	done chan struct{}
+}
+
+// NewOrderRetryConsumer hands retried orders to dispatch
+func NewOrderRetryConsumer(dispatch chan<- queuedRetry) *OrderRetryConsumer {
+	return &OrderRetryConsumer{dispatch: dispatch}
+}
+
+// process runs msg on the order workers and waits for it; false if ctx ended first, in which
+// case the order is left uncommitted for the next session
+func (c *OrderRetryConsumer) process(ctx context.Context, msg *sarama.ConsumerMessage) bool {
+	order := queuedRetry{msg: msg, done: make(chan struct{})}
+	select {
+	case c.dispatch <- order:
+	case <-ctx.Done():
+		return false
+	}
+	select {
+	case <-order.done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Consume consumes the retry topics in group until ctx is done
+func (c *OrderRetryConsumer) Consume(ctx context.Context, group sarama.ConsumerGroup) {
+	topics := make([]string, len(orderRetryTiers))
+	for i, tier := range orderRetryTiers {
+		topics[i] = tier.Topic
+	}
+	for ctx.Err() == nil {
+		if err := group.Consume(ctx, topics, c); err != nil && ctx.Err() == nil {
+			logger.WithError(err).WithField("event", "order_retry_consume_failed").Warn("Order retry consumer error, rejoining")
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+// Active reports whether the retry consumer is in a group session
+func (c *OrderRetryConsumer) Active() bool {
+	return c.active.Load()
+}
+
+func (c *OrderRetryConsumer) Setup(sarama.ConsumerGroupSession) error {
+	c.active.Store(true)
+	return nil
+}
+
+func (c *OrderRetryConsumer) Cleanup(sarama.ConsumerGroupSession) error {
+	c.active.Store(false)
+	return nil
+}
+
+func (c *OrderRetryConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	delay := time.Duration(0)
+	for _, tier := range orderRetryTiers {
+		if tier.Topic == claim.Topic() {
+			delay = tier.Delay
+		}
+	}
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			if wait := time.Until(msg.Timestamp.Add(delay)); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-session.Context().Done():
+					timer.Stop()
+					return nil
+				}
+			}
+			if !c.process(session.Context(), msg) {
+				return nil
+			}
+			session.MarkMessage(msg, "")
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// luaRecordOffsetScript atomically compares a consumed offset with the last offset seen
+// for the partition (across all processor instances) and stores the new high-water mark
+// Returns {status, last_offset} where status is:
+//   - 0: In order (first offset seen, or exactly last+1)
+//   - 1: Regression (offset <= last, i.e. message redelivered or consumed twice)
+//   - 2: Gap (offset > last+1, i.e. messages skipped)
+const luaRecordOffsetScript = `
+local offset_key = KEYS[1]
+local offset = tonumber(ARGV[1])
+local last = tonumber(redis.call('GET', offset_key))
+
+if not last then
+    redis.call('SET', offset_key, offset)
+    return {0, -1}
+end
+
+if offset <= last then
+    return {1, last}
+end
+
+redis.call('SET', offset_key, offset)
+if offset > last + 1 then
+    return {2, last}
+end
+return {0, last}
+`
+
+// Redis keys written in safety audit mode
+// All keys share the "audit:" prefix so the harness can reset them with a single SCAN/DEL
+const (
+	auditProcessedPrefix   = "audit:processed:"       // INCR per request_id; >1 means double-processing
+	auditDoubleProcessed   = "audit:double_processed" // Count of double-processed orders
+	auditOffsetPrefix      = "audit:offset:"          // Last offset per topic/partition
+	auditOffsetRegressions = "audit:offset_regressions"
+	auditOffsetGaps        = "audit:offset_gaps"
+	auditReservedPrefix    = "audit:reserved:" // Net units reserved per item (reservations minus refunds)
+)
+
+// SafetyAuditor records cross-instance processing facts in Redis so an integration harness
+// can verify the horizontal scaling safety case: no oversell, no double-processing and
+// correct offset semantics while instances join, leave and rebalance
+// Enabled with PROCESSOR_SAFETY_AUDIT=true; adds Redis round-trips, so not for production
+type SafetyAuditor struct {
+	redisClient  *redis.Client
+	offsetScript *redis.Script
+}
+
+// NewSafetyAuditor creates a new auditor backed by redisClient
+func NewSafetyAuditor(redisClient *redis.Client) *SafetyAuditor {
+	return &SafetyAuditor{
+		redisClient:  redisClient,
+		offsetScript: redis.NewScript(luaRecordOffsetScript),
+	}
+}
+
+// RecordConsumed records that a message was consumed from topic/partition at offset
+// Returns "ok", "regression" or "gap" describing the offset relative to the last one seen
+func (a *SafetyAuditor) RecordConsumed(ctx context.Context, topic string, partition int32, offset int64) (string, error) {
+	key := auditOffsetPrefix + topic + ":" + strconv.Itoa(int(partition))
+	result, err := a.offsetScript.Run(ctx, a.redisClient, []string{key}, offset).Result()
+	if err != nil {
+		return "", err
+	}
+
+	switch result.([]interface{})[0].(int64) {
+	case 1:
+		a.redisClient.Incr(ctx, auditOffsetRegressions)
+		return "regression", nil
+	case 2:
+		a.redisClient.Incr(ctx, auditOffsetGaps)
+		return "gap", nil
+	default:
+		return "ok", nil
+	}
+}
+
+// RecordProcessed records that the order identified by requestID claimed its processed marker
+// and is about to reserve inventory (sold-out orders included)
+// Returns true if an earlier attempt already got this far (on this or another instance)
+func (a *SafetyAuditor) RecordProcessed(ctx context.Context, requestID string) (bool, error) {
+	count, err := a.redisClient.Incr(ctx, auditProcessedPrefix+requestID).Result()
+	if err != nil {
+		return false, err
+	}
+	if count > 1 {
+		a.redisClient.Incr(ctx, auditDoubleProcessed)
+		return true, nil
+	}
+	return false, nil
+}
+
+// RecordReservation adjusts the net reserved units for itemID
+// Use a positive delta for reservations and a negative delta for refunds
+// Harness invariant: initial stock - current stock == net reserved units
+func (a *SafetyAuditor) RecordReservation(ctx context.Context, itemID string, delta int64) error {
+	return a.redisClient.IncrBy(ctx, auditReservedPrefix+itemID, delta).Err()
+}
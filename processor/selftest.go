@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// syntheticStock is the test item's stock, reset before every self-test
+// Synthetic orders return their unit straight away, so this only needs to cover concurrent runs
+const syntheticStock = 1000
+
+// selftestTimeout bounds the wait for the synthetic order's result (SELFTEST_TIMEOUT)
+var selftestTimeout = 10 * time.Second
+
+// isSyntheticOrder reports whether msg carries the synthetic order flag
+func isSyntheticOrder(msg *sarama.ConsumerMessage) bool {
+	for _, header := range msg.Headers {
+		if string(header.Key) == common.HeaderSynthetic {
+			return true
+		}
+	}
+	return false
+}
+
+// processSyntheticOrder reserves and immediately refunds one unit of the test item, then
+// publishes the result; payments, fulfillment, purchase caps and order metrics are skipped
+// Failures are reported to the waiting caller only, never dead-lettered
+func processSyntheticOrder(logEntry *logrus.Entry, msg *sarama.ConsumerMessage, order *OrderRequest) {
+	logEntry = logEntry.WithField("event", "synthetic_order")
+	if order.ItemID != common.SyntheticItemID {
+		logEntry.Warn("Synthetic order for a sale item ignored")
+		publishOrderResult(msg, order.ItemID, common.ResultFailed, "SYNTHETIC_ITEM_MISMATCH")
+		return
+	}
+
+	scriptCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	status, reason, err := reserveSyntheticUnit(scriptCtx, inventory)
+	if err != nil {
+		redisHealth.Observe(err)
+		logEntry.WithError(err).WithField("reason", reason).Warn("Synthetic order failed")
+	} else if status != common.ResultReserved {
+		logEntry.WithField("reason", reason).Warn("Synthetic order not reserved")
+	} else {
+		logEntry.Debug("Synthetic order processed")
+	}
+	publishOrderResult(msg, order.ItemID, status, reason)
+}
+
+// reserveSyntheticUnit reserves one unit of the test item and refunds it straight away
+// Returns the result status and reason to publish, with the store error behind a failure
+func reserveSyntheticUnit(ctx context.Context, store InventoryStore) (string, string, error) {
+	reservation, err := store.Reserve(ctx, ReserveRequest{ItemID: common.SyntheticItemID, Channel: common.DefaultChannel, Amount: 1})
+	if err != nil {
+		return common.ResultFailed, "RESERVE_ERROR", err
+	}
+	if !reservation.Reserved {
+		return common.ResultFailedSoldOut, reservation.Reason, nil
+	}
+	if _, err := store.Refund(ctx, RefundRequest{ItemID: common.SyntheticItemID, Channel: common.DefaultChannel, Amount: 1}); err != nil {
+		return common.ResultFailed, "REFUND_ERROR", err
+	}
+	return common.ResultReserved, common.SyntheticResultReason, nil
+}
+
+// selftestStep is one check of a self-test run
+type selftestStep struct {
+	Name       string `json:"name"`
+	OK         bool   `json:"ok"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// handleAdminSelftest runs a synthetic order end to end before doors open: it resets the test
+// item's stock (Redis), publishes a flagged order to the orders topic (Kafka) and waits for a
+// processor to reserve it (processing)
+// The order is keyed by the test item, so the orders partition it hashes to must be consumed
+func handleAdminSelftest(w http.ResponseWriter, r *http.Request) {
+	logEntry := adminLog(r, "admin_selftest")
+	requestID := "selftest-" + uuid.New().String()
+	start := time.Now()
+	var steps []selftestStep
+	run := func(name string, check func() error) bool {
+		stepStart := time.Now()
+		err := check()
+		step := selftestStep{Name: name, OK: err == nil, DurationMS: time.Since(stepStart).Milliseconds()}
+		if err != nil {
+			step.Error = err.Error()
+		}
+		steps = append(steps, step)
+		return err == nil
+	}
+
+	passed := run("redis", func() error {
+		return redisClient.Ping(r.Context()).Err()
+	}) && run("inventory", func() error {
+		_, err := inventory.Restock(r.Context(), common.SyntheticItemID, syntheticStock, false)
+		return err
+	})
+
+	// Subscribe before publishing so the result can't arrive before we listen
+	var result *common.OrderResult
+	if passed {
+		sub := redisClient.Subscribe(r.Context(), common.OrderResultChannel(requestID))
+		defer sub.Close()
+		passed = run("kafka_publish", func() error {
+			if _, err := sub.Receive(r.Context()); err != nil {
+				return err
+			}
+			msg, err := newSyntheticOrderMessage(requestID, common.SyntheticSelftest)
+			if err != nil {
+				return err
+			}
+			_, _, err = producer.SendMessage(msg)
+			return err
+		}) && run("processing", func() error {
+			var err error
+			result, err = awaitSyntheticResult(r.Context(), sub, selftestTimeout)
+			return err
+		})
+	}
+
+	logEntry = logEntry.WithFields(map[string]interface{}{
+		"request_id":  requestID,
+		"passed":      passed,
+		"steps":       steps,
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+	status := http.StatusOK
+	if passed {
+		logEntry.Info("Self-test passed")
+	} else {
+		status = http.StatusServiceUnavailable
+		logEntry.Warn("Self-test failed")
+	}
+	body := map[string]interface{}{
+		"passed":      passed,
+		"request_id":  requestID,
+		"steps":       steps,
+		"duration_ms": time.Since(start).Milliseconds(),
+	}
+	if result != nil {
+		body["processed_at"] = result.Timestamp
+	}
+	writeAdminJSON(w, status, body)
+}
+
+// newSyntheticOrderMessage builds a flagged order for the test item, signed and encrypted like
+// a gateway's when keys are configured
+func newSyntheticOrderMessage(requestID, source string) (*sarama.ProducerMessage, error) {
+	payload, err := json.Marshal(OrderRequest{UserID: "synthetic", ItemID: common.SyntheticItemID, Amount: 1})
+	if err != nil {
+		return nil, err
+	}
+	msg := &sarama.ProducerMessage{
+		Topic: common.TopicOrders,
+		Key:   sarama.StringEncoder(common.SyntheticItemID),
+		Value: sarama.ByteEncoder(payload),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte("correlation_id"), Value: []byte(requestID)},
+			{Key: []byte("request_id"), Value: []byte(requestID)},
+			{Key: []byte("accepted_at"), Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))},
+			{Key: []byte(common.HeaderSynthetic), Value: []byte(source)},
+		},
+	}
+	if payloadCipher != nil {
+		if err := payloadCipher.EncryptMessage(msg); err != nil {
+			return nil, err
+		}
+	}
+	if signer != nil {
+		// Processors verify with the same keys; signing needs MESSAGE_SIGNING_KEY_ID here too
+		if err := signer.SignMessage(msg); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+// errSyntheticTimeout is returned when no processor reported a synthetic order's result in time
+var errSyntheticTimeout = errors.New("no result before timeout: check consumer lag and that a processor consumes the test item's partition")
+
+// awaitSyntheticResult waits for a synthetic order's result and checks it passed
+func awaitSyntheticResult(ctx context.Context, sub *redis.PubSub, timeout time.Duration) (*common.OrderResult, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	select {
+	case <-waitCtx.Done():
+		return nil, errSyntheticTimeout
+	case msg, ok := <-sub.Channel():
+		if !ok {
+			return nil, errors.New("result subscription closed")
+		}
+		var result common.OrderResult
+		if err := json.Unmarshal([]byte(msg.Payload), &result); err != nil {
+			return nil, err
+		}
+		if result.Status != common.ResultReserved || result.Reason != common.SyntheticResultReason {
+			return &result, fmt.Errorf("synthetic order failed: %s %s", result.Status, result.Reason)
+		}
+		return &result, nil
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// Terminal outcomes used as SLA metric labels (kept small for cardinality)
+const (
+	outcomeCompleted     = "completed"
+	outcomeSoldOut       = "sold_out"
+	outcomePaymentFailed = "payment_failed"
+	outcomeFailed        = "failed"
+	outcomeCancelled     = "cancelled" // Cancelled by the client before processing; no SLA applies
+	outcomeExpired       = "expired"   // Consumed too late to process (see order_expiry.go); no SLA applies
+)
+
+var (
+	// slaTarget is the maximum time from gateway acceptance to terminal state (ORDER_SLA_TARGET)
+	slaTarget = 30 * time.Second
+	// publishSLABreaches enables breach events on the order-sla-breaches topic (SLA_BREACH_PUBLISH)
+	publishSLABreaches bool
+)
+
+// recordOrderSLA measures the order's end-to-end latency once it reaches a terminal state
+// and records an SLA breach (counter + optional breach event) if it exceeded slaTarget
+// Acceptance time comes from the gateway's accepted_at header, falling back to the Kafka
+// message timestamp for messages published without it
+func recordOrderSLA(msg *sarama.ConsumerMessage, itemID, outcome string) {
+	acceptedAt := extractAcceptedAt(msg)
+	if acceptedAt.IsZero() {
+		return
+	}
+
+	elapsed := time.Since(acceptedAt)
+	metrics.OrderEndToEndDuration.Observe(elapsed.Seconds())
+	metrics.Orders.Campaigns.ObserveDuration(extractCampaign(msg), elapsed)
+	if elapsed <= slaTarget {
+		return
+	}
+
+	metrics.SLABreaches.WithLabelValues(outcome).Inc()
+	requestID := extractRequestID(msg.Headers)
+	logEntry := common.WithCorrelationID(extractCorrelationID(msg.Headers)).WithFields(map[string]interface{}{
+		"event":      "order_sla_breached",
+		"request_id": requestID,
+		"item_id":    itemID,
+		"outcome":    outcome,
+		"elapsed_ms": elapsed.Milliseconds(),
+		"target_ms":  slaTarget.Milliseconds(),
+	})
+	logEntry.Warn("Order exceeded SLA target")
+
+	if publishSLABreaches {
+		publishSLABreach(logEntry, common.SLABreachEvent{
+			RequestID:  requestID,
+			ItemID:     itemID,
+			Outcome:    outcome,
+			AcceptedAt: acceptedAt,
+			ElapsedMs:  elapsed.Milliseconds(),
+			TargetMs:   slaTarget.Milliseconds(),
+		})
+	}
+}
+
+func publishSLABreach(logEntry *logrus.Entry, event common.SLABreachEvent) {
+	breachMsg, err := common.NewSLABreachMessage(event)
+	if err == nil {
+		_, _, err = producer.SendMessage(breachMsg)
+	}
+	if err != nil {
+		logEntry.WithError(err).WithField("event", "sla_breach_publish_failed").Warn("Failed to publish SLA breach event")
+	}
+}
+
+// extractAcceptedAt returns when the gateway accepted the order
+func extractAcceptedAt(msg *sarama.ConsumerMessage) time.Time {
+	for _, header := range msg.Headers {
+		if string(header.Key) == "accepted_at" {
+			if acceptedAt, err := time.Parse(time.RFC3339Nano, string(header.Value)); err == nil {
+				return acceptedAt
+			}
+		}
+	}
+	return msg.Timestamp
+}
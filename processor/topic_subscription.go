@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// Default ORDER_TOPIC_PATTERN values
+const (
+	defaultOrderTopicPattern         = common.TopicOrders
+	defaultCampaignOrderTopicPattern = common.TopicOrders + "(-.+)?" // orders plus every orders-<campaign>
+)
+
+// TopicSubscription consumes every order topic whose name matches a pattern
+// Matching topics created while running are picked up on the next Sync and deleted ones
+// are released; the engine's own topics (orders-dlq, orders-retry-5s, ...) never match
+type TopicSubscription struct {
+	pattern   *regexp.Regexp
+	client    sarama.Client
+	consumers OrderSource
+}
+
+// NewTopicSubscription creates a subscription for pattern, which must match whole topic names
+func NewTopicSubscription(pattern string, client sarama.Client, consumers OrderSource) (*TopicSubscription, error) {
+	compiled, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid topic pattern %q: %w", pattern, err)
+	}
+	return &TopicSubscription{pattern: compiled, client: client, consumers: consumers}, nil
+}
+
+// Pattern returns the anchored pattern
+func (ts *TopicSubscription) Pattern() string {
+	return ts.pattern.String()
+}
+
+// Matches reports whether topic carries orders for this subscription
+func (ts *TopicSubscription) Matches(topic string) bool {
+	if topic != common.TopicOrders && common.IsSystemTopic(topic) {
+		return false
+	}
+	return ts.pattern.MatchString(topic)
+}
+
+// Start consumes the matching topics that exist now
+// Fails if none match, since the processor would otherwise sit idle without complaint
+func (ts *TopicSubscription) Start() error {
+	topics, err := ts.client.Topics()
+	if err != nil {
+		return err
+	}
+	for _, topic := range topics {
+		if !ts.Matches(topic) {
+			continue
+		}
+		if _, err := ts.consumers.Add(topic); err != nil {
+			return fmt.Errorf("consume %s: %w", topic, err)
+		}
+	}
+	if len(ts.consumers.Topics()) == 0 {
+		return fmt.Errorf("no topic matches %s", ts.Pattern())
+	}
+	return nil
+}
+
+// Sync consumes matching topics created since the last call and releases deleted ones
+// Partitions of new topics have no committed offset, so with the default initial offset (oldest)
+// orders sent before the topic was noticed aren't lost
+func (ts *TopicSubscription) Sync() error {
+	if err := ts.client.RefreshMetadata(); err != nil {
+		return err
+	}
+	topics, err := ts.client.Topics()
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool, len(topics))
+	for _, topic := range topics {
+		if !ts.Matches(topic) {
+			continue
+		}
+		existing[topic] = true
+		partitions, err := ts.consumers.Add(topic)
+		if err != nil {
+			logger.WithError(err).WithField("topic", topic).Warn("Failed to consume order topic")
+			continue
+		}
+		if partitions != nil {
+			logger.WithFields(logrus.Fields{
+				"event":      "order_topic_subscribed",
+				"topic":      topic,
+				"partitions": partitions,
+			}).Info("Consuming new order topic")
+		}
+	}
+	for _, topic := range ts.consumers.Topics() {
+		if !existing[topic] {
+			ts.consumers.Remove(topic)
+			logger.WithFields(logrus.Fields{
+				"event": "order_topic_released",
+				"topic": topic,
+			}).Info("Order topic deleted, stopped consuming")
+		}
+	}
+	return nil
+}
+
+// Run calls Sync every interval until ctx is done
+func (ts *TopicSubscription) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := ts.Sync(); err != nil {
+			logger.WithError(err).WithField("event", "order_topics_sync_failed").Warn("Failed to sync order topics")
+		}
+	}
+}
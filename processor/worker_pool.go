@@ -0,0 +1,104 @@
+package main
+
+import (
+	"hash/fnv"
+	"strconv"
+	"sync"
+
+	"github.com/IBM/sarama"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// workerQueueSize is the number of orders waiting per worker; an order group claim keeps at
+// most workers*workerQueueSize orders in flight
+const workerQueueSize = 16
+
+// OrderWorkers processes orders on a fixed number of goroutines (PROCESSOR_WORKERS)
+// Orders are routed to a worker by item_id, so orders of one item are processed in arrival
+// order while a slow item (e.g. Redis latency on its keys) only holds back the items sharing
+// its worker instead of the whole partition
+type OrderWorkers struct {
+	source   OrderSource
+	queues   []chan workerOrder
+	inFlight sync.WaitGroup // Submitted orders not yet Done
+	stopped  sync.WaitGroup
+}
+
+// workerOrder is one queued order; done reports it handled, nil for orders of source
+type workerOrder struct {
+	msg  *sarama.ConsumerMessage
+	done func()
+}
+
+// NewOrderWorkers starts size workers (at least 1) reporting handled orders to source
+func NewOrderWorkers(size int, source OrderSource) *OrderWorkers {
+	size = max(size, 1)
+	w := &OrderWorkers{source: source, queues: make([]chan workerOrder, size)}
+	for i := range w.queues {
+		queue := make(chan workerOrder, workerQueueSize)
+		w.queues[i] = queue
+		w.stopped.Add(1)
+		go w.run(queue)
+	}
+	metrics.Workers.Set(float64(size))
+	return w
+}
+
+func (w *OrderWorkers) run(queue <-chan workerOrder) {
+	defer w.stopped.Done()
+	for order := range queue {
+		metrics.WorkersBusy.Inc()
+		processOrder(order.msg)
+		metrics.WorkersBusy.Dec()
+		if order.done != nil {
+			order.done()
+		} else {
+			w.source.Done(order.msg)
+		}
+		w.inFlight.Done()
+	}
+}
+
+// Submit queues msg on its item's worker; blocks while that worker's queue is full
+// Must only be called from one goroutine, which keeps each item's orders in arrival order
+func (w *OrderWorkers) Submit(msg *sarama.ConsumerMessage) {
+	w.SubmitFunc(msg, nil)
+}
+
+// SubmitFunc queues msg like Submit but calls done instead of reporting msg to the source, for
+// orders that don't come from it (retry topics); same single-goroutine rule as Submit
+func (w *OrderWorkers) SubmitFunc(msg *sarama.ConsumerMessage, done func()) {
+	w.inFlight.Add(1)
+	w.queues[w.workerFor(msg)] <- workerOrder{msg: msg, done: done}
+}
+
+// workerFor hashes the order's item_id header; orders published without it (older gateways,
+// synthetic orders) are routed by message key, then by partition
+func (w *OrderWorkers) workerFor(msg *sarama.ConsumerMessage) int {
+	if len(w.queues) == 1 {
+		return 0
+	}
+	routing := extractHeader(msg.Headers, common.HeaderItemID)
+	if routing == "" {
+		routing = string(msg.Key)
+	}
+	if routing == "" {
+		routing = msg.Topic + "/" + strconv.Itoa(int(msg.Partition))
+	}
+	h := fnv.New32a()
+	h.Write([]byte(routing))
+	return int(h.Sum32() % uint32(len(w.queues)))
+}
+
+// Idle waits until every submitted order is Done; Submit must not be called meanwhile
+func (w *OrderWorkers) Idle() {
+	w.inFlight.Wait()
+}
+
+// Close lets the workers finish the queued orders and waits for them to stop
+func (w *OrderWorkers) Close() {
+	for _, queue := range w.queues {
+		close(queue)
+	}
+	w.stopped.Wait()
+}
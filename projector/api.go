@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// Query limits of the read API
+const (
+	defaultOrdersLimit  = 20
+	maxFailureHours     = 168 // Failure buckets are kept for failureBucketTTL
+	defaultFailureHours = 24
+)
+
+// registerReadAPI serves the read models to support and analytics (viewer role)
+func registerReadAPI(mux *http.ServeMux, auth *common.AdminAuth) {
+	mux.HandleFunc("GET /admin/users/{user_id}/orders", auth.Require(common.RoleViewer, handleUserOrders))
+	mux.HandleFunc("GET /admin/items/{item_id}/sales", auth.Require(common.RoleViewer, handleItemSales))
+	mux.HandleFunc("GET /admin/failures", auth.Require(common.RoleViewer, handleFailures))
+}
+
+// adminLog returns a log entry for an admin request, tagged with the caller's identity
+func adminLog(r *http.Request, event string) *logrus.Entry {
+	claims := common.AdminClaimsFromContext(r.Context())
+	return logger.WithFields(map[string]interface{}{
+		"event": event,
+		"actor": claims.Subject,
+		"role":  claims.Role,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// queryInt parses an optional positive integer parameter; ok is false if it is invalid or above max
+func queryInt(r *http.Request, name string, defaultValue, max int) (int, bool) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return defaultValue, true
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 1 || value > max {
+		return 0, false
+	}
+	return value, true
+}
+
+func handleUserOrders(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("user_id")
+	limit, ok := queryInt(r, "limit", defaultOrdersLimit, projector.historyLimit)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "limit must be between 1 and " + strconv.Itoa(projector.historyLimit),
+		})
+		return
+	}
+	orders, err := projector.UserOrders(r.Context(), userID, limit)
+	if err != nil {
+		adminLog(r, "read_model_query_failed").WithError(err).Error("Failed to read user orders")
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read orders"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"user_id": userID,
+		"orders":  orders,
+	})
+}
+
+func handleItemSales(w http.ResponseWriter, r *http.Request) {
+	sales, err := projector.ItemSales(r.Context(), r.PathValue("item_id"))
+	if err != nil {
+		adminLog(r, "read_model_query_failed").WithError(err).Error("Failed to read item sales")
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read item sales"})
+		return
+	}
+	writeJSON(w, http.StatusOK, sales)
+}
+
+func handleFailures(w http.ResponseWriter, r *http.Request) {
+	hours, ok := queryInt(r, "hours", defaultFailureHours, maxFailureHours)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "hours must be between 1 and " + strconv.Itoa(maxFailureHours),
+		})
+		return
+	}
+	itemID := r.URL.Query().Get("item_id")
+	scope := itemID
+	if scope == "" {
+		scope = failuresAllItems
+	}
+	failures, err := projector.Failures(r.Context(), scope, hours)
+	if err != nil {
+		adminLog(r, "read_model_query_failed").WithError(err).Error("Failed to read failures")
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read failures"})
+		return
+	}
+	var total int64
+	for _, failure := range failures {
+		total += failure.Count
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"item_id":  itemID,
+		"hours":    hours,
+		"total":    total,
+		"failures": failures,
+	})
+}
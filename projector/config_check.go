@@ -0,0 +1,61 @@
+package main
+
+import (
+	"time"
+
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// startupConfig is the configuration resolved at startup, served at GET /admin/config
+var startupConfig *common.ConfigReport
+
+// projectorConfig resolves the projector's configuration without connecting to Redis or Kafka
+// and checks the combinations main can't catch on its own (-validate-config)
+// Defaults mirror main; keep both in step when adding a setting
+func projectorConfig() *common.ConfigReport {
+	r := common.NewConfigReport("projector")
+	common.ReportSharedConfig(r)
+
+	r.String("PROJECTOR_GROUP", "projector")
+	if limit := r.Int("PROJECTOR_HISTORY_LIMIT", 100); limit < 1 {
+		r.Errorf("PROJECTOR_HISTORY_LIMIT must be at least 1")
+	}
+	if retention := r.Duration("PROJECTOR_RETENTION", 7*24*time.Hour); retention < time.Hour {
+		r.Errorf("PROJECTOR_RETENTION must be at least 1h")
+	}
+	sink := r.OneOf("WAREHOUSE_SINK", "", SinkClickHouse, SinkBigQuery)
+	switch sink {
+	case SinkClickHouse:
+		if r.URL("CLICKHOUSE_URL") == "" {
+			r.Errorf("CLICKHOUSE_URL is required with WAREHOUSE_SINK=clickhouse")
+		}
+		r.String("CLICKHOUSE_USER", "")
+		r.Secret("CLICKHOUSE_PASSWORD")
+	case SinkBigQuery:
+		if r.String("BIGQUERY_PROJECT", "") == "" || r.String("BIGQUERY_DATASET", "") == "" {
+			r.Errorf("BIGQUERY_PROJECT and BIGQUERY_DATASET are required with WAREHOUSE_SINK=bigquery")
+		}
+		if file := r.String("BIGQUERY_CREDENTIALS_FILE", ""); file != "" {
+			_, err := NewGoogleTokenSource(file, nil)
+			r.Check("BIGQUERY_CREDENTIALS_FILE", err)
+		}
+	}
+	if sink != "" {
+		r.String("WAREHOUSE_GROUP", "warehouse-sink")
+		r.String("WAREHOUSE_TABLE", "order_results")
+		if size := r.Int("WAREHOUSE_BATCH_SIZE", 500); size < 1 {
+			r.Errorf("WAREHOUSE_BATCH_SIZE must be at least 1")
+		}
+		if interval := r.Duration("WAREHOUSE_FLUSH_INTERVAL", 5*time.Second); interval <= 0 {
+			r.Errorf("WAREHOUSE_FLUSH_INTERVAL must be positive")
+		}
+		r.Duration("WAREHOUSE_TIMEOUT", 30*time.Second)
+	}
+	if secret := r.Secret("ADMIN_TOKEN_SECRET"); secret != "" {
+		_, err := common.NewAdminAuth(secret)
+		r.Check("ADMIN_TOKEN_SECRET", err)
+	} else {
+		r.Warnf("ADMIN_TOKEN_SECRET is not set; the read API is disabled")
+	}
+	return r
+}
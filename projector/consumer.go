@@ -0,0 +1,68 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// resultConsumer feeds the order-results partitions claimed by this instance to the projector
+// A result that can't be projected (Redis down) is retried before its offset is committed, so
+// the read models never skip a result; projecting is idempotent, so redeliveries are harmless
+type resultConsumer struct {
+	projector *Projector
+	active    atomic.Bool // In a consumer group session (false while rebalancing or disconnected)
+}
+
+func (c *resultConsumer) Setup(sarama.ConsumerGroupSession) error {
+	c.active.Store(true)
+	return nil
+}
+
+func (c *resultConsumer) Cleanup(sarama.ConsumerGroupSession) error {
+	c.active.Store(false)
+	return nil
+}
+
+func (c *resultConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			if !c.project(session, msg) {
+				return nil
+			}
+			session.MarkMessage(msg, "")
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// project applies msg, retrying with backoff up to 30s; false if the session ended first
+func (c *resultConsumer) project(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) bool {
+	backoff := 100 * time.Millisecond
+	for {
+		outcome, err := c.projector.Project(session.Context(), msg.Value)
+		metrics.EventsProjected.WithLabelValues(outcome).Inc()
+		if err == nil {
+			return true
+		}
+		logger.WithError(err).WithFields(map[string]interface{}{
+			"event":     "projection_failed",
+			"partition": msg.Partition,
+			"offset":    msg.Offset,
+		}).Error("Failed to project order result, retrying")
+		select {
+		case <-time.After(backoff):
+		case <-session.Context().Done():
+			return false
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
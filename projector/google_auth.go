@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	bigQueryScope       = "https://www.googleapis.com/auth/bigquery.insertdata"
+	defaultGoogleTokens = "https://oauth2.googleapis.com/token"
+	metadataTokenURL    = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// googleToken is an OAuth access token as returned by both token endpoints
+type googleToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// GoogleTokenSource hands out cached OAuth access tokens for Google APIs, refreshed a minute
+// before they expire
+// Tokens come from a service account key file when one is configured, otherwise from the
+// metadata server of the GCE/GKE instance (workload identity)
+type GoogleTokenSource struct {
+	client *http.Client
+	key    *serviceAccountKey // nil: metadata server
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+type serviceAccountKey struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+
+	signer *rsa.PrivateKey
+}
+
+// NewGoogleTokenSource loads the service account key at keyFile, or uses the metadata server if keyFile is ""
+func NewGoogleTokenSource(keyFile string, client *http.Client) (*GoogleTokenSource, error) {
+	ts := &GoogleTokenSource{client: client}
+	if keyFile == "" {
+		return ts, nil
+	}
+	raw, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	var key serviceAccountKey
+	if err := json.Unmarshal(raw, &key); err != nil {
+		return nil, fmt.Errorf("invalid service account key: %w", err)
+	}
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if key.ClientEmail == "" || block == nil {
+		return nil, errors.New("service account key has no client_email or private_key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account private key: %w", err)
+	}
+	signer, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("service account private key is not RSA")
+	}
+	key.signer = signer
+	if key.TokenURI == "" {
+		key.TokenURI = defaultGoogleTokens
+	}
+	ts.key = &key
+	return ts, nil
+}
+
+// Token returns a valid access token, fetching a new one when the cached one is about to expire
+func (ts *GoogleTokenSource) Token(ctx context.Context) (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.token != "" && time.Until(ts.expires) > time.Minute {
+		return ts.token, nil
+	}
+	var req *http.Request
+	var err error
+	if ts.key != nil {
+		req, err = ts.key.tokenRequest(ctx, time.Now())
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, metadataTokenURL+"?scopes="+url.QueryEscape(bigQueryScope), nil)
+		if req != nil {
+			req.Header.Set("Metadata-Flavor", "Google")
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	resp, err := ts.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetch access token: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetch access token: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var token googleToken
+	if err := json.Unmarshal(body, &token); err != nil || token.AccessToken == "" {
+		return "", errors.New("fetch access token: no access_token in response")
+	}
+	ts.token = token.AccessToken
+	ts.expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return ts.token, nil
+}
+
+// tokenRequest builds the JWT bearer grant (RFC 7523) exchanging a signed assertion for a token
+func (k *serviceAccountKey) tokenRequest(ctx context.Context, now time.Time) (*http.Request, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": k.PrivateKeyID})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   k.ClientEmail,
+		"scope": bigQueryScope,
+		"aud":   k.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, k.signer, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
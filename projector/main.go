@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sirupsen/logrus"
+	"github.com/yourname/flash-sale-engine/common"
+	"github.com/yourname/flash-sale-engine/common/app"
+)
+
+var (
+	logger    *logrus.Logger
+	metrics   *common.ProjectorMetrics
+	projector *Projector
+)
+
+func main() {
+	a := app.New("projector", projectorConfig)
+	bootstrapOnly := flag.Bool("bootstrap-topics", false, "Create required Kafka topics and exit")
+	a.Parse()
+
+	// Logger, build info, startup configuration (GET /admin/config) and signal handling
+	a.Start()
+	logger = a.Logger
+	startupConfig = a.Config
+
+	metrics = common.InitProjectorMetrics()
+
+	// Create required Kafka topics if bootstrap is enabled (KAFKA_TOPIC_BOOTSTRAP=true)
+	if *bootstrapOnly || getEnvBool("KAFKA_TOPIC_BOOTSTRAP", false) {
+		a.BootstrapTopics()
+		if *bootstrapOnly {
+			logger.Info("Kafka topics bootstrapped")
+			return
+		}
+	}
+
+	// Redis holds the read models; point REDIS_ADDR at an instance separate from the
+	// gateway/processor one so support and analytics queries never load the purchase path
+	redisClient := a.NewRedisClient(metrics.Redis)
+	if err := redisClient.Ping(context.Background()).Err(); err != nil {
+		logger.WithError(err).Fatal("Failed to connect to Redis")
+	}
+
+	// Shared connection pool for the warehouse APIs (HTTP_CLIENT_*, see common.HTTPTransportConfigFromEnv)
+	httpTransport := common.NewHTTPTransport(common.HTTPTransportConfigFromEnv(), metrics.HTTPClients)
+	a.OnShutdown("outbound HTTP clients", func(context.Context) error {
+		httpTransport.CloseIdleConnections()
+		return nil
+	})
+
+	// PROJECTOR_HISTORY_LIMIT (default: 100) orders are kept per user; order views and user
+	// histories expire PROJECTOR_RETENTION (default: 168h) after their last result
+	projector = NewProjector(redisClient,
+		getEnvInt("PROJECTOR_HISTORY_LIMIT", 100),
+		getEnvDuration("PROJECTOR_RETENTION", 7*24*time.Hour))
+
+	// Instances share the order-results partitions through the PROJECTOR_GROUP consumer group
+	// (default: projector); a new group starts at the oldest retained results, so renaming the
+	// group rebuilds the read models from the topic
+	groupID := os.Getenv("PROJECTOR_GROUP")
+	if groupID == "" {
+		groupID = "projector"
+	}
+	config := a.KafkaConfig()
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	group, err := sarama.NewConsumerGroup([]string{a.KafkaAddr}, groupID, config)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to create consumer group")
+	}
+	a.OnShutdown("consumer group", func(context.Context) error { return group.Close() })
+
+	handler := &resultConsumer{projector: projector}
+	a.Health.Register("kafka", func(context.Context) error {
+		if !handler.active.Load() {
+			return errors.New("not in a consumer group session")
+		}
+		return nil
+	})
+	stopped := consumeResults(a, group, handler, "projector_consume_failed", "in-flight results",
+		"shutdown timeout reached, the last result is projected again after restart")
+	logger.WithField("group", groupID).Info("Projecting order results")
+
+	// Optional warehouse sink (WAREHOUSE_SINK=clickhouse|bigquery) streaming order results to
+	// WAREHOUSE_TABLE for BI dashboards, through its own WAREHOUSE_GROUP consumer group
+	// (default: warehouse-sink) so a slow warehouse never holds back the read models
+	if sink := os.Getenv("WAREHOUSE_SINK"); sink != "" {
+		writer := newWarehouseWriter(sink, httpTransport)
+		sinkGroupID := os.Getenv("WAREHOUSE_GROUP")
+		if sinkGroupID == "" {
+			sinkGroupID = "warehouse-sink"
+		}
+		sinkGroup, err := sarama.NewConsumerGroup([]string{a.KafkaAddr}, sinkGroupID, config)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to create warehouse consumer group")
+		}
+		a.OnShutdown("warehouse consumer group", func(context.Context) error { return sinkGroup.Close() })
+
+		// Rows are inserted every WAREHOUSE_BATCH_SIZE (default: 500) results per partition or
+		// every WAREHOUSE_FLUSH_INTERVAL (default: 5s), whichever comes first
+		sinkHandler := &warehouseConsumer{
+			writer:    writer,
+			batchSize: getEnvInt("WAREHOUSE_BATCH_SIZE", 500),
+			interval:  getEnvDuration("WAREHOUSE_FLUSH_INTERVAL", 5*time.Second),
+		}
+		a.Health.Register("warehouse", func(context.Context) error {
+			if !sinkHandler.active.Load() {
+				return errors.New("warehouse sink not in a consumer group session")
+			}
+			return nil
+		})
+		sinkStopped := consumeResults(a, sinkGroup, sinkHandler, "warehouse_consume_failed", "warehouse batches",
+			"shutdown timeout reached, the pending batch is written again after restart")
+		stopped = firstClosed(stopped, sinkStopped)
+		logger.WithFields(map[string]interface{}{
+			"sink":  writer.Name(),
+			"group": sinkGroupID,
+		}).Info("Streaming order results to the warehouse")
+	}
+
+	// Metrics, health and the read API; the read models hold user data, so they are only
+	// served with ADMIN_TOKEN_SECRET set
+	adminAuth := a.AdminAuth()
+	a.RegisterEndpoints(adminAuth)
+	if adminAuth != nil {
+		registerReadAPI(a.Mux, adminAuth)
+	} else {
+		logger.Warn("ADMIN_TOKEN_SECRET not set, read API disabled")
+	}
+	a.Serve(&http.Server{Addr: ":9092"}, nil)
+	logger.Info("Projector running on :9092")
+
+	a.Run(stopped)
+}
+
+// consumeResults joins group on the order-results topic until shutdown; the returned channel is
+// closed once the group has stopped consuming
+// Consume returns on every rebalance, so the group is rejoined until the hook named hook runs,
+// which waits for the claim in progress to finish
+func consumeResults(a *app.App, group sarama.ConsumerGroup, handler sarama.ConsumerGroupHandler, failedEvent, hook, timeoutMessage string) chan struct{} {
+	consumeCtx, stopConsuming := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			err := group.Consume(consumeCtx, []string{common.TopicOrderResults}, handler)
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) || consumeCtx.Err() != nil {
+				return
+			}
+			if err != nil {
+				logger.WithError(err).WithField("event", failedEvent).Error("Consumer group session failed")
+				time.Sleep(time.Second)
+			}
+		}
+	}()
+	a.OnShutdown(hook, func(ctx context.Context) error {
+		stopConsuming()
+		select {
+		case <-stopped:
+			return nil
+		case <-ctx.Done():
+			return errors.New(timeoutMessage)
+		}
+	})
+	return stopped
+}
+
+// firstClosed returns a channel closed once a or b is closed, so either consumer stopping shuts the projector down
+func firstClosed(a, b <-chan struct{}) chan struct{} {
+	either := make(chan struct{})
+	go func() {
+		select {
+		case <-a:
+		case <-b:
+		}
+		close(either)
+	}()
+	return either
+}
+
+// newWarehouseWriter builds the writer for sink from its settings, exiting on invalid ones
+// clickhouse: CLICKHOUSE_URL, CLICKHOUSE_USER, CLICKHOUSE_PASSWORD
+// bigquery: BIGQUERY_PROJECT, BIGQUERY_DATASET, BIGQUERY_CREDENTIALS_FILE (default: the
+// instance's metadata server)
+// Both write to WAREHOUSE_TABLE (default: order_results) and time out after WAREHOUSE_TIMEOUT (default: 30s)
+func newWarehouseWriter(sink string, httpTransport *common.HTTPTransport) WarehouseWriter {
+	table := os.Getenv("WAREHOUSE_TABLE")
+	if table == "" {
+		table = "order_results"
+	}
+	client := httpTransport.Client("warehouse_"+sink, getEnvDuration("WAREHOUSE_TIMEOUT", 30*time.Second))
+	var writer WarehouseWriter
+	var err error
+	switch sink {
+	case SinkClickHouse:
+		writer, err = NewClickHouseWriter(os.Getenv("CLICKHOUSE_URL"), table,
+			os.Getenv("CLICKHOUSE_USER"), os.Getenv("CLICKHOUSE_PASSWORD"), client)
+	case SinkBigQuery:
+		var tokens *GoogleTokenSource
+		tokens, err = NewGoogleTokenSource(os.Getenv("BIGQUERY_CREDENTIALS_FILE"), client)
+		if err == nil {
+			writer, err = NewBigQueryWriter(os.Getenv("BIGQUERY_PROJECT"), os.Getenv("BIGQUERY_DATASET"), table, tokens, client)
+		}
+	default:
+		err = errors.New("unknown sink, expected clickhouse or bigquery")
+	}
+	if err != nil {
+		logger.WithError(err).WithField("sink", sink).Fatal("Invalid WAREHOUSE_* configuration")
+	}
+	return writer
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// Read model keys; all live in the projector's Redis (REDIS_ADDR), never read by the hot path
+func orderViewKey(requestID string) string { return "rm:order:" + requestID }
+func userOrdersKey(userID string) string   { return "rm:user_orders:" + userID }
+func itemSalesKey(itemID string) string    { return "rm:item_sales:" + itemID }
+
+// restockKey marks a restock of itemID at tsMs as projected, so a redelivery isn't counted twice
+func restockKey(itemID string, tsMs int64) string {
+	return "rm:restock:" + itemID + ":" + strconv.FormatInt(tsMs, 10)
+}
+
+// failuresKey counts failures of itemID (failuresAllItems for every item) in the hour of t
+func failuresKey(itemID string, t time.Time) string {
+	return "rm:failures:" + itemID + ":" + t.UTC().Format("2006010215")
+}
+
+// failuresAllItems aggregates the failure breakdown across items
+const failuresAllItems = "_all"
+
+// Outcomes of projecting one event
+const (
+	ProjectionApplied   = "applied"
+	ProjectionDuplicate = "duplicate" // Same status as already projected (redelivery)
+	ProjectionStale     = "stale"     // Older than the projected status (out-of-order redelivery)
+	ProjectionIgnored   = "ignored"   // Neither an order result nor a restock, or no request_id/item_id
+	ProjectionFailed    = "failed"
+)
+
+// Kinds of status change counted in the item and failure read models
+const (
+	changeSale      = "sale"
+	changeFailure   = "failure"
+	changeCancelled = "cancelled"
+)
+
+// statusChange returns how status counts in the aggregates; "" for intermediate statuses
+// (RESERVED) and DELIVERED, which follows a sale already counted
+func statusChange(status string) string {
+	switch status {
+	case common.ResultCompleted:
+		return changeSale
+	case common.ResultFailedSoldOut, common.ResultFailedPayment, common.ResultFailed, common.ResultExpired:
+		return changeFailure
+	case common.ResultCancelled:
+		return changeCancelled
+	}
+	return ""
+}
+
+// luaProjectResultScript applies one order result to every read model atomically
+// The order view holds the last projected status: a redelivered result (same status) or an
+// older one changes nothing, so aggregates count each status change exactly once
+// KEYS: order view, user history, item sales, item failures, all-items failures, then for a cart
+// order the sales of each completed line's item
+// ARGV: request_id, user_id, item_id, quantity, status, reason, timestamp (unix ms),
+// history limit, retention (seconds), change kind, failure bucket TTL (seconds), then the units
+// of each completed cart line
+// A completed cart is a sale of each completed line's item rather than of the order's item
+const luaProjectResultScript = `
+local previous = redis.call('HMGET', KEYS[1], 'status', 'updated_at_ms')
+local ts = tonumber(ARGV[7])
+if previous[1] == ARGV[5] then
+    return 'duplicate'
+end
+if previous[1] and ts < tonumber(previous[2]) then
+    return 'stale'
+end
+
+redis.call('HSET', KEYS[1], 'request_id', ARGV[1], 'user_id', ARGV[2], 'item_id', ARGV[3],
+    'quantity', ARGV[4], 'status', ARGV[5], 'reason', ARGV[6], 'updated_at_ms', ARGV[7])
+redis.call('EXPIRE', KEYS[1], ARGV[9])
+if ARGV[2] ~= '' then
+    redis.call('ZADD', KEYS[2], ts, ARGV[1])
+    redis.call('ZREMRANGEBYRANK', KEYS[2], 0, -(tonumber(ARGV[8]) + 1))
+    redis.call('EXPIRE', KEYS[2], ARGV[9])
+end
+
+local change = ARGV[10]
+local function sale(key, units)
+    redis.call('HINCRBY', key, 'completed_orders', 1)
+    redis.call('HINCRBY', key, 'units_sold', units)
+    redis.call('HSET', key, 'last_sale_at_ms', ARGV[7])
+end
+if change == 'sale' and #KEYS > 5 then
+    for i = 6, #KEYS do
+        sale(KEYS[i], ARGV[i + 6])
+    end
+elseif change == 'sale' then
+    sale(KEYS[3], ARGV[4])
+elseif change == 'failure' then
+    redis.call('HINCRBY', KEYS[3], 'failed_orders', 1)
+    local field = ARGV[5] .. '|' .. ARGV[6]
+    redis.call('HINCRBY', KEYS[4], field, 1)
+    redis.call('EXPIRE', KEYS[4], ARGV[11])
+    redis.call('HINCRBY', KEYS[5], field, 1)
+    redis.call('EXPIRE', KEYS[5], ARGV[11])
+elseif change == 'cancelled' then
+    redis.call('HINCRBY', KEYS[3], 'cancelled_orders', 1)
+end
+return 'applied'
+`
+
+var projectResultScript = redis.NewScript(luaProjectResultScript)
+
+// luaProjectRestockScript adds one restock to the item sales read model; the marker key makes a
+// redelivered restock event a no-op
+// KEYS: restock marker, item sales
+// ARGV: units, timestamp (unix ms), marker TTL (seconds)
+const luaProjectRestockScript = `
+if not redis.call('SET', KEYS[1], 1, 'NX', 'EX', ARGV[3]) then
+    return 'duplicate'
+end
+redis.call('HINCRBY', KEYS[2], 'restocks', 1)
+redis.call('HINCRBY', KEYS[2], 'units_restocked', ARGV[1])
+local last = tonumber(redis.call('HGET', KEYS[2], 'last_restock_at_ms') or '0')
+if tonumber(ARGV[2]) > last then
+    redis.call('HSET', KEYS[2], 'last_restock_at_ms', ARGV[2])
+end
+return 'applied'
+`
+
+var projectRestockScript = redis.NewScript(luaProjectRestockScript)
+
+// failureBucketTTL keeps hourly failure buckets for the longest breakdown served (7 days)
+const failureBucketTTL = 8 * 24 * time.Hour
+
+// Projector maintains the read models from the order-results topic
+type Projector struct {
+	client       *redis.Client
+	historyLimit int           // Orders kept per user
+	retention    time.Duration // How long order views and user histories outlive their last result
+}
+
+// NewProjector creates a projector writing to client
+func NewProjector(client *redis.Client, historyLimit int, retention time.Duration) *Projector {
+	return &Projector{client: client, historyLimit: historyLimit, retention: retention}
+}
+
+// Project applies one order-results message; it returns the outcome and, for "failed", the error
+func (p *Projector) Project(ctx context.Context, value []byte) (string, error) {
+	var result common.OrderResult
+	if err := json.Unmarshal(value, &result); err != nil {
+		logger.WithError(err).WithField("event", "projector_result_invalid").Warn("Skipping unreadable order result")
+		return ProjectionIgnored, nil
+	}
+	if result.EventType == common.RestockEventType {
+		return p.projectRestock(ctx, value)
+	}
+	if result.EventType != common.OrderResultEventType || result.RequestID == "" {
+		return ProjectionIgnored, nil
+	}
+	if result.Timestamp.IsZero() {
+		result.Timestamp = time.Now().UTC()
+	}
+
+	keys := []string{
+		orderViewKey(result.RequestID),
+		userOrdersKey(result.UserID),
+		itemSalesKey(itemOrUnknown(result.ItemID)),
+		failuresKey(itemOrUnknown(result.ItemID), result.Timestamp),
+		failuresKey(failuresAllItems, result.Timestamp),
+	}
+	args := []interface{}{
+		result.RequestID, result.UserID, result.ItemID, result.Quantity, result.Status, result.Reason,
+		result.Timestamp.UnixMilli(), p.historyLimit, int64(p.retention.Seconds()),
+		statusChange(result.Status), int64(failureBucketTTL.Seconds()),
+	}
+	for _, line := range result.Lines {
+		if line.Status == common.CartLineCompleted {
+			keys = append(keys, itemSalesKey(line.ItemID))
+			args = append(args, line.Quantity)
+		}
+	}
+	outcome, err := projectResultScript.Run(ctx, p.client, keys, args...).Text()
+	if err != nil {
+		return ProjectionFailed, err
+	}
+	if outcome == ProjectionApplied {
+		metrics.ProjectionDelay.Observe(time.Since(result.Timestamp).Seconds())
+	}
+	return outcome, nil
+}
+
+// projectRestock counts an admin restock in the item's sales summary
+func (p *Projector) projectRestock(ctx context.Context, value []byte) (string, error) {
+	var event common.RestockEvent
+	if err := json.Unmarshal(value, &event); err != nil || event.ItemID == "" {
+		logger.WithError(err).WithField("event", "projector_restock_invalid").Warn("Skipping unreadable restock event")
+		return ProjectionIgnored, nil
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	tsMs := event.Timestamp.UnixMilli()
+	keys := []string{restockKey(event.ItemID, tsMs), itemSalesKey(event.ItemID)}
+	outcome, err := projectRestockScript.Run(ctx, p.client, keys,
+		event.Units, tsMs, int64(p.retention.Seconds())).Text()
+	if err != nil {
+		return ProjectionFailed, err
+	}
+	return outcome, nil
+}
+
+// itemOrUnknown keeps results without an item (e.g. unreadable orders) out of real items' models
+func itemOrUnknown(itemID string) string {
+	if itemID == "" {
+		return common.ItemLabelUnknown
+	}
+	return itemID
+}
+
+// OrderView is one order in a user's history
+type OrderView struct {
+	RequestID string    `json:"request_id"`
+	ItemID    string    `json:"item_id,omitempty"`
+	Quantity  int64     `json:"quantity,omitempty"`
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// UserOrders returns up to limit of userID's orders, newest first
+func (p *Projector) UserOrders(ctx context.Context, userID string, limit int) ([]OrderView, error) {
+	requestIDs, err := p.client.ZRevRange(ctx, userOrdersKey(userID), 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	pipe := p.client.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(requestIDs))
+	for i, requestID := range requestIDs {
+		cmds[i] = pipe.HGetAll(ctx, orderViewKey(requestID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	orders := make([]OrderView, 0, len(requestIDs))
+	for _, cmd := range cmds {
+		fields := cmd.Val()
+		if len(fields) == 0 {
+			continue // Order view expired before the history entry
+		}
+		quantity, _ := strconv.ParseInt(fields["quantity"], 10, 64)
+		updatedAt, _ := strconv.ParseInt(fields["updated_at_ms"], 10, 64)
+		orders = append(orders, OrderView{
+			RequestID: fields["request_id"],
+			ItemID:    fields["item_id"],
+			Quantity:  quantity,
+			Status:    fields["status"],
+			Reason:    fields["reason"],
+			UpdatedAt: time.UnixMilli(updatedAt).UTC(),
+		})
+	}
+	return orders, nil
+}
+
+// ItemSales is the sales summary of one item
+type ItemSales struct {
+	ItemID          string     `json:"item_id"`
+	CompletedOrders int64      `json:"completed_orders"`
+	UnitsSold       int64      `json:"units_sold"`
+	FailedOrders    int64      `json:"failed_orders"`
+	CancelledOrders int64      `json:"cancelled_orders"`
+	LastSaleAt      *time.Time `json:"last_sale_at,omitempty"`
+	Restocks        int64      `json:"restocks"`
+	UnitsRestocked  int64      `json:"units_restocked"`
+	LastRestockAt   *time.Time `json:"last_restock_at,omitempty"`
+}
+
+// ItemSales returns itemID's sales summary (all zero for an item without results)
+func (p *Projector) ItemSales(ctx context.Context, itemID string) (ItemSales, error) {
+	fields, err := p.client.HGetAll(ctx, itemSalesKey(itemID)).Result()
+	if err != nil {
+		return ItemSales{}, err
+	}
+	count := func(name string) int64 {
+		value, _ := strconv.ParseInt(fields[name], 10, 64)
+		return value
+	}
+	sales := ItemSales{
+		ItemID:          itemID,
+		CompletedOrders: count("completed_orders"),
+		UnitsSold:       count("units_sold"),
+		FailedOrders:    count("failed_orders"),
+		CancelledOrders: count("cancelled_orders"),
+		Restocks:        count("restocks"),
+		UnitsRestocked:  count("units_restocked"),
+	}
+	if lastSale := count("last_sale_at_ms"); lastSale > 0 {
+		at := time.UnixMilli(lastSale).UTC()
+		sales.LastSaleAt = &at
+	}
+	if lastRestock := count("last_restock_at_ms"); lastRestock > 0 {
+		at := time.UnixMilli(lastRestock).UTC()
+		sales.LastRestockAt = &at
+	}
+	return sales, nil
+}
+
+// FailureCount is the number of failures with one status and reason
+type FailureCount struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+	Count  int64  `json:"count"`
+}
+
+// Failures sums the hourly failure buckets of itemID (failuresAllItems for every item) over the
+// last hours hours, including the current one
+func (p *Projector) Failures(ctx context.Context, itemID string, hours int) ([]FailureCount, error) {
+	pipe := p.client.Pipeline()
+	now := time.Now()
+	cmds := make([]*redis.MapStringStringCmd, hours)
+	for i := range cmds {
+		cmds[i] = pipe.HGetAll(ctx, failuresKey(itemID, now.Add(-time.Duration(i)*time.Hour)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	totals := make(map[string]int64)
+	for _, cmd := range cmds {
+		for field, value := range cmd.Val() {
+			count, _ := strconv.ParseInt(value, 10, 64)
+			totals[field] += count
+		}
+	}
+	breakdown := make([]FailureCount, 0, len(totals))
+	for field, count := range totals {
+		status, reason, _ := strings.Cut(field, "|")
+		breakdown = append(breakdown, FailureCount{Status: status, Reason: reason, Count: count})
+	}
+	// Most frequent first
+	sort.Slice(breakdown, func(i, j int) bool {
+		if breakdown[i].Count != breakdown[j].Count {
+			return breakdown[i].Count > breakdown[j].Count
+		}
+		return breakdown[i].Status+breakdown[i].Reason < breakdown[j].Status+breakdown[j].Reason
+	})
+	return breakdown, nil
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// Supported WAREHOUSE_SINK values
+const (
+	SinkClickHouse = "clickhouse"
+	SinkBigQuery   = "bigquery"
+)
+
+// WarehouseRow is one order result as written to the warehouse table
+// DedupKey identifies the status change, so a row redelivered after a failed commit or a
+// retried batch is written once; delivery codes never leave the engine
+type WarehouseRow struct {
+	DedupKey       string    `json:"dedup_key"`
+	RequestID      string    `json:"request_id"`
+	UserID         string    `json:"user_id"`
+	ItemID         string    `json:"item_id"`
+	Quantity       int64     `json:"quantity"`
+	Status         string    `json:"status"`
+	Reason         string    `json:"reason"`
+	StockRemaining *int64    `json:"stock_remaining"`
+	LatencyMs      int64     `json:"latency_ms"`
+	EventTime      time.Time `json:"event_time"`
+}
+
+// warehouseRow converts an order-results message; false for anything that isn't an order result
+func warehouseRow(value []byte) (WarehouseRow, bool) {
+	var result common.OrderResult
+	if err := json.Unmarshal(value, &result); err != nil {
+		return WarehouseRow{}, false
+	}
+	if result.EventType != common.OrderResultEventType || result.RequestID == "" {
+		return WarehouseRow{}, false
+	}
+	return WarehouseRow{
+		DedupKey:       result.RequestID + ":" + result.Status,
+		RequestID:      result.RequestID,
+		UserID:         result.UserID,
+		ItemID:         result.ItemID,
+		Quantity:       result.Quantity,
+		Status:         result.Status,
+		Reason:         result.Reason,
+		StockRemaining: result.StockRemaining,
+		LatencyMs:      result.LatencyMs,
+		EventTime:      result.Timestamp.UTC(),
+	}, true
+}
+
+// WarehouseWriter inserts a batch of rows; inserting the same batch again must not duplicate rows
+type WarehouseWriter interface {
+	Name() string
+	Insert(ctx context.Context, rows []WarehouseRow) error
+}
+
+// ClickHouseWriter inserts through the ClickHouse HTTP interface as JSONEachRow
+// Each batch carries an insert_deduplication_token derived from its dedup keys, so a retried
+// batch is dropped by ClickHouse; rows redelivered in a different batch are collapsed by a
+// ReplacingMergeTree ordered by dedup_key
+type ClickHouseWriter struct {
+	endpoint string
+	table    string
+	user     string
+	password string
+	client   *http.Client
+}
+
+// NewClickHouseWriter writes to table through the HTTP interface at endpoint (e.g. http://clickhouse:8123)
+func NewClickHouseWriter(endpoint, table, user, password string, client *http.Client) (*ClickHouseWriter, error) {
+	if _, err := url.ParseRequestURI(endpoint); err != nil || table == "" {
+		return nil, errors.New("endpoint and table are required")
+	}
+	return &ClickHouseWriter{endpoint: strings.TrimRight(endpoint, "/"), table: table, user: user, password: password, client: client}, nil
+}
+
+func (w *ClickHouseWriter) Name() string { return SinkClickHouse }
+
+func (w *ClickHouseWriter) Insert(ctx context.Context, rows []WarehouseRow) error {
+	var body bytes.Buffer
+	token := sha256.New()
+	encoder := json.NewEncoder(&body)
+	for _, row := range rows {
+		// DateTime64 columns accept this layout in JSONEachRow without best-effort parsing
+		if err := encoder.Encode(struct {
+			WarehouseRow
+			EventTime string `json:"event_time"`
+		}{row, row.EventTime.Format("2006-01-02 15:04:05.000")}); err != nil {
+			return err
+		}
+		token.Write([]byte(row.DedupKey + "\n"))
+	}
+	query := url.Values{
+		"query":                            {"INSERT INTO " + w.table + " FORMAT JSONEachRow"},
+		"insert_deduplication_token":       {hex.EncodeToString(token.Sum(nil))},
+		"input_format_skip_unknown_fields": {"1"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.endpoint+"/?"+query.Encode(), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if w.user != "" {
+		req.Header.Set("X-ClickHouse-User", w.user)
+		req.Header.Set("X-ClickHouse-Key", w.password)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("clickhouse insert: status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// BigQueryWriter streams rows with tabledata.insertAll, using the dedup key as insertId so
+// BigQuery drops rows it has seen in the last minute or so; rows redelivered later are
+// deduplicated in queries by dedup_key
+type BigQueryWriter struct {
+	url    string
+	tokens *GoogleTokenSource
+	client *http.Client
+}
+
+// NewBigQueryWriter streams into project.dataset.table
+func NewBigQueryWriter(project, dataset, table string, tokens *GoogleTokenSource, client *http.Client) (*BigQueryWriter, error) {
+	if project == "" || dataset == "" || table == "" {
+		return nil, errors.New("project, dataset and table are required")
+	}
+	return &BigQueryWriter{
+		url: fmt.Sprintf("https://bigquery.googleapis.com/bigquery/v2/projects/%s/datasets/%s/tables/%s/insertAll",
+			url.PathEscape(project), url.PathEscape(dataset), url.PathEscape(table)),
+		tokens: tokens,
+		client: client,
+	}, nil
+}
+
+func (w *BigQueryWriter) Name() string { return SinkBigQuery }
+
+func (w *BigQueryWriter) Insert(ctx context.Context, rows []WarehouseRow) error {
+	type insertRow struct {
+		InsertID string       `json:"insertId"`
+		JSON     WarehouseRow `json:"json"`
+	}
+	request := struct {
+		Rows []insertRow `json:"rows"`
+	}{Rows: make([]insertRow, len(rows))}
+	for i, row := range rows {
+		request.Rows[i] = insertRow{InsertID: row.DedupKey, JSON: row}
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	token, err := w.tokens.Token(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	payload, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bigquery insert: status %d: %s", resp.StatusCode, strings.TrimSpace(string(payload)))
+	}
+	// Rejected rows come back with a 200; the whole batch is retried, which insertId makes safe
+	var response struct {
+		InsertErrors []struct {
+			Index  int `json:"index"`
+			Errors []struct {
+				Reason  string `json:"reason"`
+				Message string `json:"message"`
+			} `json:"errors"`
+		} `json:"insertErrors"`
+	}
+	if err := json.Unmarshal(payload, &response); err == nil && len(response.InsertErrors) > 0 {
+		first := response.InsertErrors[0]
+		reason := "unknown"
+		if len(first.Errors) > 0 {
+			reason = first.Errors[0].Reason + ": " + first.Errors[0].Message
+		}
+		return fmt.Errorf("bigquery insert: %d rows rejected, row %d: %s", len(response.InsertErrors), first.Index, reason)
+	}
+	return nil
+}
+
+// warehouseConsumer streams the order-results partitions claimed by this instance to a warehouse
+// Rows are batched per partition and offsets are committed only after their batch is inserted,
+// so nothing is skipped when the warehouse is down; failed inserts are retried with backoff
+type warehouseConsumer struct {
+	writer    WarehouseWriter
+	batchSize int
+	interval  time.Duration
+	active    atomic.Bool // In a consumer group session (false while rebalancing or disconnected)
+}
+
+func (c *warehouseConsumer) Setup(sarama.ConsumerGroupSession) error {
+	c.active.Store(true)
+	return nil
+}
+
+func (c *warehouseConsumer) Cleanup(sarama.ConsumerGroupSession) error {
+	c.active.Store(false)
+	return nil
+}
+
+func (c *warehouseConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	var rows []WarehouseRow
+	var last *sarama.ConsumerMessage
+	flush := func() bool {
+		if last == nil {
+			return true
+		}
+		if len(rows) > 0 && !c.insert(session, rows) {
+			return false
+		}
+		session.MarkMessage(last, "")
+		rows, last = rows[:0], nil
+		return true
+	}
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				flush()
+				return nil
+			}
+			if row, ok := warehouseRow(msg.Value); ok {
+				rows = append(rows, row)
+			}
+			last = msg
+			if len(rows) >= c.batchSize && !flush() {
+				return nil
+			}
+		case <-ticker.C:
+			if !flush() {
+				return nil
+			}
+		case <-session.Context().Done():
+			// Unflushed rows aren't committed; the next owner of the partition writes them
+			return nil
+		}
+	}
+}
+
+// insert writes rows, retrying with backoff up to 30s; false if the session ended first
+func (c *warehouseConsumer) insert(session sarama.ConsumerGroupSession, rows []WarehouseRow) bool {
+	backoff := time.Second
+	for {
+		err := c.writer.Insert(session.Context(), rows)
+		if err == nil {
+			metrics.WarehouseBatches.WithLabelValues(c.writer.Name(), "inserted").Inc()
+			metrics.WarehouseRows.WithLabelValues(c.writer.Name()).Add(float64(len(rows)))
+			now := time.Now()
+			for _, row := range rows {
+				metrics.WarehouseDelay.Observe(now.Sub(row.EventTime).Seconds())
+			}
+			return true
+		}
+		metrics.WarehouseBatches.WithLabelValues(c.writer.Name(), "failed").Inc()
+		logger.WithError(err).WithFields(map[string]interface{}{
+			"event": "warehouse_insert_failed",
+			"sink":  c.writer.Name(),
+			"rows":  len(rows),
+		}).Error("Failed to write order results to the warehouse, retrying")
+		select {
+		case <-time.After(backoff):
+		case <-session.Context().Done():
+			return false
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
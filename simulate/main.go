@@ -0,0 +1,179 @@
+// Command simulate runs a flash sale with virtual users through the pipeline in process: the
+// gateway's rate limit and idempotency keys, an in-memory order queue, and the processor's
+// inventory Lua scripts and payment step, against an in-process Redis (miniredis) or, with
+// -redis, a Redis server. It reports oversell, latency and drop statistics. No Kafka, Redis
+// server or services are needed, so algorithms and limits can be tuned on a laptop before being
+// tried on a cluster
+//
+//	go run ./simulate -scenario bot_swarm -users 5000 -bots 50 -stock 200
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// Report is the outcome of one simulation, printed with -json
+type Report struct {
+	Scenario string                 `json:"scenario"`
+	Requests int                    `json:"requests"`
+	Elapsed  string                 `json:"elapsed"`
+	Stock    int64                  `json:"stock"`
+	Sold     int64                  `json:"sold"`
+	Reserved int64                  `json:"reserved"`
+	Left     int64                  `json:"left"`
+	Oversold int64                  `json:"oversold"`
+	Latency  Latency                `json:"latency"`
+	Classes  map[string]classCounts `json:"classes"`
+}
+
+func main() {
+	scenarioName := flag.String("scenario", "spike", "scenario: "+strings.Join(ScenarioNames(), ", "))
+	var load Load
+	flag.IntVar(&load.Users, "users", 1000, "human users, one order each")
+	flag.IntVar(&load.Bots, "bots", 20, "bot users (bot_swarm)")
+	flag.DurationVar(&load.BotInterval, "bot-interval", 10*time.Millisecond, "time between a bot's requests")
+	flag.DurationVar(&load.Duration, "duration", 5*time.Second, "length of the sale")
+	var config Config
+	flag.Int64Var(&config.Stock, "stock", 100, "units seeded for the item")
+	flag.IntVar(&config.QueueSize, "queue", 1000, "orders queued before the gateway drops new ones")
+	flag.IntVar(&config.Workers, "workers", 8, "processor consumers")
+	flag.IntVar(&config.RateLimit, "rate-limit", 60, "RATE_LIMIT_MAX_REQUESTS per user (0 = off)")
+	flag.DurationVar(&config.RateLimitWindow, "rate-limit-window", time.Minute, "RATE_LIMIT_WINDOW")
+	flag.DurationVar(&config.ProcessTime, "process-time", time.Millisecond, "inventory step per order")
+	flag.DurationVar(&config.PaymentTime, "payment-time", 5*time.Millisecond, "payment provider call per order")
+	flag.Float64Var(&config.PaymentFailureRate, "payment-failure-rate", 0.02, "share of payments declined outside an outage")
+	redisAddr := flag.String("redis", "", "Redis server the scripts run on; empty runs them on an in-process Redis")
+	redisDB := flag.Int("redis-db", 15, "Redis database; the run's keys are namespaced and deleted afterwards")
+	seed := flag.Int64("seed", 1, "random seed; equal seeds generate equal traffic")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	scenario, ok := Scenarios[*scenarioName]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown scenario %q (%s)\n", *scenarioName, strings.Join(ScenarioNames(), ", "))
+		os.Exit(2)
+	}
+	if load.Users < 0 || load.Bots < 0 || load.Duration <= 0 || load.BotInterval <= 0 || config.Stock < 0 || config.QueueSize < 0 || config.Workers < 1 {
+		fmt.Fprintln(os.Stderr, "users, bots and stock must not be negative; duration and bot-interval must be positive; workers at least 1")
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	addr := *redisAddr
+	if addr == "" {
+		server, err := miniredis.Run()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "start in-process redis: %v\n", err)
+			os.Exit(2)
+		}
+		defer server.Close()
+		addr = server.Addr()
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr, DB: *redisDB})
+	defer client.Close()
+	if err := client.Ping(ctx).Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "redis %s unavailable: %v\n", addr, err)
+		os.Exit(2)
+	}
+
+	report, err := run(ctx, client, scenario, load, config, *seed)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	} else {
+		printReport(report)
+	}
+	if report.Oversold > 0 || report.Left+report.Reserved+report.Sold != report.Stock {
+		os.Exit(1)
+	}
+}
+
+// run replays the scenario's arrivals in real time and waits for every queued order
+func run(ctx context.Context, client *redis.Client, scenario Scenario, load Load, config Config, seed int64) (Report, error) {
+	rng := rand.New(rand.NewSource(seed))
+	arrivals := scenario.Arrivals(load, rng)
+	stats := NewStats()
+	start := time.Now()
+	pipeline, err := NewPipeline(ctx, client, config, stats, func() bool { return scenario.Outage(time.Since(start), load.Duration) }, seed)
+	if err != nil {
+		return Report{}, err
+	}
+	defer pipeline.Cleanup()
+	pipeline.Start()
+
+	for _, order := range arrivals {
+		if wait := order.at - time.Since(start); wait > 0 {
+			time.Sleep(wait)
+		}
+		pipeline.Buy(order.requestID, order.userID, order.bot, 1)
+	}
+	pipeline.Close()
+
+	left, reserved, sold, err := pipeline.Inventory()
+	if err != nil {
+		return Report{}, fmt.Errorf("read inventory: %w", err)
+	}
+	oversold := sold - config.Stock
+	if left < 0 && -left > oversold {
+		oversold = -left
+	}
+	if oversold < 0 {
+		oversold = 0
+	}
+	return Report{
+		Scenario: scenario.Name,
+		Requests: len(arrivals),
+		Elapsed:  time.Since(start).Round(time.Millisecond).String(),
+		Stock:    config.Stock,
+		Sold:     sold,
+		Reserved: reserved,
+		Left:     left,
+		Oversold: oversold,
+		Latency:  stats.Latency(),
+		Classes:  stats.Classes(),
+	}, nil
+}
+
+func printReport(report Report) {
+	fmt.Printf("Scenario %s: %d requests in %s (%s)\n\n", report.Scenario, report.Requests, report.Elapsed, Scenarios[report.Scenario].Description)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "class\taccepted\trate_limited\tduplicate\tdropped\terror\tcompleted\tsold_out\tpayment_failed\tfailed\tunits\t")
+	for _, name := range []string{"human", "bot"} {
+		counts, ok := report.Classes[name]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t\n", name,
+			counts.Gateway[OutcomeAccepted], counts.Gateway[OutcomeRateLimited], counts.Gateway[OutcomeDuplicate], counts.Gateway[OutcomeDropped], counts.Gateway[OutcomeError],
+			counts.Results[common.ResultCompleted], counts.Results[common.ResultFailedSoldOut], counts.Results[common.ResultFailedPayment], counts.Results[common.ResultFailed], counts.Units)
+	}
+	w.Flush()
+	fmt.Printf("\nInventory: %d seeded, %d sold, %d reserved, %d left\n", report.Stock, report.Sold, report.Reserved, report.Left)
+	fmt.Printf("Latency (accepted to result): p50 %s, p95 %s, p99 %s, max %s\n",
+		report.Latency.P50.Round(time.Microsecond), report.Latency.P95.Round(time.Microsecond),
+		report.Latency.P99.Round(time.Microsecond), report.Latency.Max.Round(time.Microsecond))
+	if report.Oversold > 0 {
+		fmt.Printf("OVERSOLD by %d units\n", report.Oversold)
+	} else if report.Left+report.Reserved+report.Sold != report.Stock {
+		fmt.Println("INVENTORY MISMATCH: left + reserved + sold differs from the seeded stock")
+	} else {
+		fmt.Println("No oversell")
+	}
+}
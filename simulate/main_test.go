@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRunDoesNotOversell(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	load := Load{Users: 300, Bots: 5, BotInterval: 5 * time.Millisecond, Duration: 200 * time.Millisecond}
+	config := Config{Stock: 50, QueueSize: 1000, Workers: 8, RateLimit: 20, RateLimitWindow: time.Minute, PaymentFailureRate: 0.1}
+	for _, name := range []string{"spike", "bot_swarm", "payment_outage"} {
+		report, err := run(context.Background(), client, Scenarios[name], load, config, 1)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if report.Oversold != 0 {
+			t.Errorf("%s: oversold by %d", name, report.Oversold)
+		}
+		if report.Left+report.Reserved+report.Sold != report.Stock || report.Reserved != 0 {
+			t.Errorf("%s: %d left, %d reserved, %d sold of %d", name, report.Left, report.Reserved, report.Sold, report.Stock)
+		}
+		if report.Sold == 0 {
+			t.Errorf("%s: nothing sold", name)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yourname/flash-sale-engine/common"
+)
+
+// Gateway outcomes of a /buy request, as the client sees them
+const (
+	OutcomeAccepted    = "accepted"     // 202, queued
+	OutcomeRateLimited = "rate_limited" // 429, RATE_LIMIT_MAX_REQUESTS reached
+	OutcomeDuplicate   = "duplicate"    // 409, request_id already seen
+	OutcomeDropped     = "dropped"      // 503, queue full
+	OutcomeError       = "error"        // 500, idempotency check failed in Redis
+)
+
+// simOrder is an order on the in-memory queue
+type simOrder struct {
+	requestID  string
+	userID     string
+	bot        bool
+	amount     int64
+	acceptedAt time.Time
+}
+
+// Config tunes the simulated pipeline; the fields mirror the services' environment variables
+type Config struct {
+	Stock              int64         // Units seeded for the item
+	QueueSize          int           // Orders the queue holds before the gateway drops new ones
+	Workers            int           // Processor consumers
+	RateLimit          int           // RATE_LIMIT_MAX_REQUESTS (0 = off)
+	RateLimitWindow    time.Duration // RATE_LIMIT_WINDOW
+	ProcessTime        time.Duration // Bookkeeping per order besides the inventory script
+	PaymentTime        time.Duration // Payment provider call
+	PaymentFailureRate float64       // Share of payments declined outside an outage
+}
+
+// Pipeline is the gateway admission, order queue and processor inventory steps of one item,
+// run in process against Redis (in-process or a server) with the services' own keys and Lua scripts: the gateway's
+// rate limit counter and idempotency key, and the processor's reserve, refund and confirm
+// scripts (common/inventory_scripts.go). Only Kafka is replaced, by a bounded channel
+// Every key is namespaced by a run ID and deleted by Cleanup
+type Pipeline struct {
+	ctx    context.Context
+	config Config
+	client *redis.Client
+	runID  string
+	itemID string
+	queue  chan simOrder
+	stats  *Stats
+	outage func() bool // Reports whether the payment provider is currently down
+
+	reserveScript *redis.Script
+	refundScript  *redis.Script
+	confirmScript *redis.Script
+
+	mu   sync.Mutex
+	keys []string   // Idempotency and rate limit keys to delete on Cleanup
+	rng  *rand.Rand // Payment declines
+	wg   sync.WaitGroup
+}
+
+// NewPipeline creates a pipeline and seeds its item with config.Stock units
+func NewPipeline(ctx context.Context, client *redis.Client, config Config, stats *Stats, outage func() bool, seed int64) (*Pipeline, error) {
+	runID := "sim-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	p := &Pipeline{
+		ctx:           ctx,
+		config:        config,
+		client:        client,
+		runID:         runID,
+		itemID:        runID + "-item",
+		queue:         make(chan simOrder, config.QueueSize),
+		stats:         stats,
+		outage:        outage,
+		reserveScript: redis.NewScript(common.LuaCheckInventoryScript),
+		refundScript:  redis.NewScript(common.LuaRefundInventoryScript),
+		confirmScript: redis.NewScript(common.LuaConfirmInventoryScript),
+		rng:           rand.New(rand.NewSource(seed)),
+	}
+	if err := client.Set(ctx, common.InventoryKeyForVersion(p.itemID, 0), config.Stock, 0).Err(); err != nil {
+		return nil, fmt.Errorf("seed inventory: %w", err)
+	}
+	return p, nil
+}
+
+// Start runs the processor workers until Close
+func (p *Pipeline) Start() {
+	for i := 0; i < p.config.Workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for order := range p.queue {
+				p.process(order)
+			}
+		}()
+	}
+}
+
+// Close stops accepting orders and waits for the queued ones to finish
+func (p *Pipeline) Close() {
+	close(p.queue)
+	p.wg.Wait()
+}
+
+// Cleanup deletes every key the run wrote
+func (p *Pipeline) Cleanup() {
+	p.mu.Lock()
+	keys := append([]string{
+		common.InventoryKeyForVersion(p.itemID, 0),
+		common.InventoryCountsKey(p.itemID),
+		common.InventoryReservationsKey(p.itemID),
+	}, p.keys...)
+	p.mu.Unlock()
+	for start := 0; start < len(keys); start += 500 {
+		p.client.Del(p.ctx, keys[start:min(start+500, len(keys))]...)
+	}
+}
+
+func (p *Pipeline) track(key string) {
+	p.mu.Lock()
+	p.keys = append(p.keys, key)
+	p.mu.Unlock()
+}
+
+// Buy is the gateway's /buy: the per-user rate limit, the idempotency key, then the queue
+func (p *Pipeline) Buy(requestID, userID string, bot bool, amount int64) string {
+	requestID, userID = p.runID+"-"+requestID, p.runID+"-"+userID
+	if p.config.RateLimit > 0 {
+		// RedisRateLimiter: INCR, EXPIRE on the window's first request, fail open
+		rateKey := "ratelimit:" + userID
+		count, err := p.client.Incr(p.ctx, rateKey).Result()
+		if err == nil && count == 1 {
+			p.track(rateKey)
+			p.client.Expire(p.ctx, rateKey, p.config.RateLimitWindow)
+		}
+		if err == nil && count > int64(p.config.RateLimit) {
+			return p.stats.Gateway(OutcomeRateLimited, bot)
+		}
+	}
+
+	idempotencyKey := common.IdempotencyKey(requestID)
+	isNew, err := p.client.SetNX(p.ctx, idempotencyKey, "processing", common.IdempotencyTTL).Result()
+	if err != nil {
+		return p.stats.Gateway(OutcomeError, bot)
+	}
+	if !isNew {
+		return p.stats.Gateway(OutcomeDuplicate, bot)
+	}
+	p.track(idempotencyKey)
+
+	select {
+	case p.queue <- simOrder{requestID: requestID, userID: userID, bot: bot, amount: amount, acceptedAt: time.Now()}:
+		return p.stats.Gateway(OutcomeAccepted, bot)
+	default:
+		// Rolled back like a failed Kafka publish, so the client may retry the request_id
+		p.client.Del(p.ctx, idempotencyKey)
+		return p.stats.Gateway(OutcomeDropped, bot)
+	}
+}
+
+// process reserves, charges and confirms or refunds one order, as the processor does
+func (p *Pipeline) process(order simOrder) {
+	time.Sleep(p.config.ProcessTime)
+	reserved, err := p.reserve(order)
+	if err != nil {
+		p.stats.Result(common.ResultFailed, order, 0)
+		return
+	}
+	if !reserved {
+		p.stats.Result(common.ResultFailedSoldOut, order, 0)
+		return
+	}
+	time.Sleep(p.config.PaymentTime)
+	if p.paymentDeclined() {
+		if err := p.refund(order); err != nil {
+			p.stats.Result(common.ResultFailed, order, 0)
+			return
+		}
+		p.stats.Result(common.ResultFailedPayment, order, 0)
+		return
+	}
+	if err := p.confirm(order); err != nil {
+		p.stats.Result(common.ResultFailed, order, 0)
+		return
+	}
+	p.stats.Result(common.ResultCompleted, order, order.amount)
+}
+
+// inventoryKeys are the reserve and refund scripts' KEYS, as RedisInventoryStore passes them
+// for an item on the legacy (version 0) counter
+func (p *Pipeline) inventoryKeys(userID string) []string {
+	return []string{
+		common.InventoryVersionKey(p.itemID), common.InventoryKeyForVersion(p.itemID, 0), common.InventoryBucketsKey(p.itemID),
+		common.InventoryCountsKey(p.itemID), common.InventoryReservationsKey(p.itemID), common.PurchasedKey(p.itemID, userID),
+	}
+}
+
+// reserve runs the reserve script with the order's request_id, no channel reserves and no cap
+func (p *Pipeline) reserve(order simOrder) (bool, error) {
+	result, err := p.reserveScript.Run(p.ctx, p.client, p.inventoryKeys(order.userID),
+		order.amount, 0, "", common.DefaultChannel, order.requestID, 0, 0).Slice()
+	if err != nil {
+		return false, err
+	}
+	if len(result) < 1 {
+		return false, fmt.Errorf("unexpected inventory script result: %v", result)
+	}
+	success, ok := result[0].(int64)
+	if !ok {
+		return false, fmt.Errorf("unexpected inventory script result: %v", result)
+	}
+	return success == 1, nil
+}
+
+// refund runs the refund script for the order's reservation
+func (p *Pipeline) refund(order simOrder) error {
+	result, err := p.refundScript.Run(p.ctx, p.client, p.inventoryKeys(order.userID),
+		order.amount, common.DefaultChannel, 0, order.requestID).Slice()
+	if err != nil {
+		return err
+	}
+	if len(result) < 2 {
+		return fmt.Errorf("unexpected refund script result: %v", result)
+	}
+	if success, ok := result[0].(int64); !ok || success != 1 {
+		return fmt.Errorf("refund script rejected the refund: %v", result)
+	}
+	return nil
+}
+
+// confirm runs the confirm script, moving the order's units from reserved to sold
+func (p *Pipeline) confirm(order simOrder) error {
+	return p.confirmScript.Run(p.ctx, p.client,
+		[]string{common.InventoryVersionKey(p.itemID), common.InventoryKeyForVersion(p.itemID, 0),
+			common.InventoryCountsKey(p.itemID), common.InventoryReservationsKey(p.itemID)},
+		order.amount, 0, order.requestID).Err()
+}
+
+func (p *Pipeline) paymentDeclined() bool {
+	if p.outage() {
+		return true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.rng.Float64() < p.config.PaymentFailureRate
+}
+
+// Inventory reads the remaining, reserved and sold units from Redis
+func (p *Pipeline) Inventory() (stock, reserved, sold int64, err error) {
+	stock, err = p.client.Get(p.ctx, common.InventoryKeyForVersion(p.itemID, 0)).Int64()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	counts, err := p.client.HMGet(p.ctx, common.InventoryCountsKey(p.itemID), "reserved", "sold").Result()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	reserved, sold = countField(counts[0]), countField(counts[1])
+	return stock, reserved, sold, nil
+}
+
+// countField parses an HMGET reply field; missing fields are 0
+func countField(value interface{}) int64 {
+	text, _ := value.(string)
+	count, _ := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+	return count
+}
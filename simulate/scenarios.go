@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// arrival is one /buy request sent by a virtual user at an offset from the start
+type arrival struct {
+	at        time.Duration
+	requestID string
+	userID    string
+	bot       bool
+}
+
+// Load sizes the virtual user population of a scenario
+type Load struct {
+	Users       int           // Human users, one order each
+	Bots        int           // Bot users, bot_swarm only
+	BotInterval time.Duration // Time between a bot's requests
+	Duration    time.Duration // Length of the sale
+}
+
+// Scenario generates a sale's traffic and payment provider behaviour
+type Scenario struct {
+	Name        string
+	Description string
+	arrivals    func(load Load, rng *rand.Rand) []arrival
+	outage      [2]float64 // Payment outage from/to as fractions of the duration; zero for none
+}
+
+// Scenarios lists the built-in scenarios by name
+var Scenarios = map[string]Scenario{
+	"spike": {
+		Name:        "spike",
+		Description: "every user buys within the first second; 10% resend the same request_id",
+		arrivals:    spikeArrivals,
+	},
+	"sustained": {
+		Name:        "sustained",
+		Description: "users arrive evenly over the whole sale",
+		arrivals:    sustainedArrivals,
+	},
+	"bot_swarm": {
+		Name:        "bot_swarm",
+		Description: "sustained users plus bots sending a new order every bot interval",
+		arrivals:    botSwarmArrivals,
+	},
+	"payment_outage": {
+		Name:        "payment_outage",
+		Description: "sustained users; every payment fails from 5% to 35% of the sale",
+		arrivals:    sustainedArrivals,
+		outage:      [2]float64{0.05, 0.35},
+	},
+}
+
+// ScenarioNames returns the scenario names, sorted
+func ScenarioNames() []string {
+	names := make([]string, 0, len(Scenarios))
+	for name := range Scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Arrivals returns the scenario's requests ordered by time
+func (s Scenario) Arrivals(load Load, rng *rand.Rand) []arrival {
+	arrivals := s.arrivals(load, rng)
+	sort.Slice(arrivals, func(i, j int) bool { return arrivals[i].at < arrivals[j].at })
+	return arrivals
+}
+
+// Outage reports whether the payment provider is down at offset elapsed
+func (s Scenario) Outage(elapsed, duration time.Duration) bool {
+	if s.outage[1] == 0 {
+		return false
+	}
+	fraction := float64(elapsed) / float64(duration)
+	return fraction >= s.outage[0] && fraction < s.outage[1]
+}
+
+func spikeArrivals(load Load, rng *rand.Rand) []arrival {
+	window := time.Second
+	if load.Duration < window {
+		window = load.Duration
+	}
+	arrivals := make([]arrival, 0, load.Users+load.Users/10)
+	for i := 0; i < load.Users; i++ {
+		at := time.Duration(rng.Int63n(int64(window)))
+		order := arrival{at: at, requestID: fmt.Sprintf("sim-%d", i), userID: fmt.Sprintf("user-%d", i)}
+		arrivals = append(arrivals, order)
+		if rng.Intn(10) == 0 {
+			// Impatient users resend the same request, which idempotency absorbs
+			order.at += 200 * time.Millisecond
+			arrivals = append(arrivals, order)
+		}
+	}
+	return arrivals
+}
+
+func sustainedArrivals(load Load, rng *rand.Rand) []arrival {
+	arrivals := make([]arrival, 0, load.Users)
+	for i := 0; i < load.Users; i++ {
+		arrivals = append(arrivals, arrival{
+			at:        time.Duration(rng.Int63n(int64(load.Duration))),
+			requestID: fmt.Sprintf("sim-%d", i),
+			userID:    fmt.Sprintf("user-%d", i),
+		})
+	}
+	return arrivals
+}
+
+func botSwarmArrivals(load Load, rng *rand.Rand) []arrival {
+	arrivals := sustainedArrivals(load, rng)
+	for b := 0; b < load.Bots; b++ {
+		// Bots start within the first interval and then fire on a fixed cadence
+		at := time.Duration(rng.Int63n(int64(load.BotInterval)))
+		for n := 0; at < load.Duration; n++ {
+			arrivals = append(arrivals, arrival{
+				at:        at,
+				requestID: fmt.Sprintf("bot-%d-%d", b, n),
+				userID:    fmt.Sprintf("bot-%d", b),
+				bot:       true,
+			})
+			at += load.BotInterval
+		}
+	}
+	return arrivals
+}
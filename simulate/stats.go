@@ -0,0 +1,89 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// classCounts are the counts of one user class (humans or bots)
+type classCounts struct {
+	Gateway map[string]int64 `json:"gateway"` // Outcome -> requests
+	Results map[string]int64 `json:"results"` // Result status -> orders
+	Units   int64            `json:"units"`   // Units bought
+}
+
+// Stats collects the outcome of every request and order
+type Stats struct {
+	mu        sync.Mutex
+	classes   map[string]*classCounts // "human" or "bot"
+	latencies []time.Duration         // Accepted until terminal result
+}
+
+// NewStats creates empty stats
+func NewStats() *Stats {
+	return &Stats{classes: make(map[string]*classCounts)}
+}
+
+func (s *Stats) class(bot bool) *classCounts {
+	name := "human"
+	if bot {
+		name = "bot"
+	}
+	counts, ok := s.classes[name]
+	if !ok {
+		counts = &classCounts{Gateway: make(map[string]int64), Results: make(map[string]int64)}
+		s.classes[name] = counts
+	}
+	return counts
+}
+
+// Gateway records a /buy outcome and returns it
+func (s *Stats) Gateway(outcome string, bot bool) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.class(bot).Gateway[outcome]++
+	return outcome
+}
+
+// Result records an order's terminal status and the units it bought
+func (s *Stats) Result(status string, order simOrder, units int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := s.class(order.bot)
+	counts.Results[status]++
+	counts.Units += units
+	s.latencies = append(s.latencies, time.Since(order.acceptedAt))
+}
+
+// Latency summarizes the accepted-to-result latencies
+type Latency struct {
+	P50 time.Duration `json:"p50_ns"`
+	P95 time.Duration `json:"p95_ns"`
+	P99 time.Duration `json:"p99_ns"`
+	Max time.Duration `json:"max_ns"`
+}
+
+// Latency returns the latency percentiles of the orders processed so far
+func (s *Stats) Latency() Latency {
+	s.mu.Lock()
+	sorted := append([]time.Duration(nil), s.latencies...)
+	s.mu.Unlock()
+	if len(sorted) == 0 {
+		return Latency{}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	at := func(q float64) time.Duration { return sorted[int(q*float64(len(sorted)-1))] }
+	return Latency{P50: at(0.50), P95: at(0.95), P99: at(0.99), Max: sorted[len(sorted)-1]}
+}
+
+// Classes returns a copy of the per-class counts
+func (s *Stats) Classes() map[string]classCounts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	classes := make(map[string]classCounts, len(s.classes))
+	for name, counts := range s.classes {
+		classes[name] = *counts
+	}
+	return classes
+}
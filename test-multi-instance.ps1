@@ -0,0 +1,149 @@
+# Multi-Instance Processor Safety Verification
+# Runs three processors in one consumer group against a partitioned "orders" topic and asserts:
+#   - No oversell (inventory never negative, units reserved == units removed from stock)
+#   - No double-processing (each request_id reserved at most once across instances)
+#   - No lost orders (every accepted order processed, nothing left uncommitted in the group)
+#   - Correct offset semantics (no offset regressions or gaps per partition)
+# while a processor is restarted mid-run, so its partitions move to the others and back
+#
+# Requires the multi-instance override:
+#   docker-compose -f docker-compose.yml -f docker-compose.multi.yml up -d --build
+
+param(
+    [int]$Orders = 200,
+    [int]$Stock = 50,
+    [string]$ItemId = "safety-101",
+    [string]$Group = "flash-sale-processor",
+    [int]$DrainTimeoutSeconds = 60
+)
+
+$redis = "flash-sale-engine-redis-1"
+$redpanda = "flash-sale-engine-redpanda-1"
+$compose = @("-f", "docker-compose.yml", "-f", "docker-compose.multi.yml")
+$failures = 0
+
+Write-Host "========================================" -ForegroundColor Cyan
+Write-Host "Multi-Instance Processor Safety Test" -ForegroundColor Cyan
+Write-Host "========================================" -ForegroundColor Cyan
+Write-Host ""
+
+function Get-RedisInt([string]$key) {
+    $val = docker exec $redis redis-cli GET $key
+    if ([string]::IsNullOrEmpty($val)) { return 0 }
+    return [int]$val
+}
+
+# Partitions of the orders topic the group has assigned to a member, and its total lag
+function Get-GroupState {
+    $describe = docker exec $redpanda rpk group describe $Group 2>$null | Out-String
+    $lag = -1
+    if ($describe -match "TOTAL-LAG\s+(-?\d+)") { $lag = [int]$Matches[1] }
+    $assigned = ([regex]::Matches($describe, "(?m)^orders[ \t]+\d+[ \t]+\d+[ \t]+\d+[ \t]+\d+[ \t]+-?\d+[ \t]+\S+")).Count
+    return @{ Lag = $lag; Assigned = $assigned }
+}
+
+# Prepare topic and state; the group consumes every partition, whatever the topic has
+Write-Host "1. Preparing topic and inventory..." -ForegroundColor Yellow
+docker exec $redpanda rpk topic create orders -p 3 2>$null | Out-Null
+$partitions = ([regex]::Matches((docker exec $redpanda rpk topic describe orders -p | Out-String), "(?m)^[ \t]*\d+[ \t]+\d+")).Count
+$auditKeys = docker exec $redis redis-cli --scan --pattern "audit:*"
+foreach ($key in $auditKeys) {
+    if ($key) { docker exec $redis redis-cli DEL $key | Out-Null }
+}
+docker exec $redis redis-cli DEL "inventory_counts:$ItemId" "inventory_reservations:$ItemId" | Out-Null
+docker exec $redis redis-cli SET "inventory:$ItemId" $Stock | Out-Null
+Write-Host "   Seeded $Stock units for item '$ItemId'; orders has $partitions partitions" -ForegroundColor Green
+
+$deadline = (Get-Date).AddSeconds(30)
+do {
+    $state = Get-GroupState
+    if ($state.Assigned -ge $partitions) { break }
+    Start-Sleep -Seconds 2
+} while ((Get-Date) -lt $deadline)
+Write-Host "   Group '$Group' owns $($state.Assigned) of $partitions partitions" -ForegroundColor Green
+Write-Host ""
+
+# Send orders, forcing a processor restart (and two rebalances) halfway through
+Write-Host "2. Sending $Orders orders (restarting processor-2 halfway)..." -ForegroundColor Yellow
+$runId = Get-Date -Format "yyyyMMddHHmmss"
+$accepted = 0
+for ($i = 1; $i -le $Orders; $i++) {
+    $body = "{""user_id"":""safety-u$i"",""item_id"":""$ItemId"",""amount"":1,""request_id"":""safety-$runId-$i""}"
+    try {
+        $response = Invoke-WebRequest -Uri "http://localhost:8080/buy" -Method POST -Body $body -ContentType "application/json" -UseBasicParsing -ErrorAction Stop
+        if ($response.StatusCode -eq 202) { $accepted++ }
+    } catch { }
+
+    if ($i -eq [int]($Orders / 2)) {
+        Write-Host "   Restarting processor-2 to force a rebalance..." -ForegroundColor Gray
+        docker-compose @compose restart processor-2 | Out-Null
+    }
+}
+Write-Host "   $accepted orders accepted, waiting for the group to drain..." -ForegroundColor Gray
+
+$deadline = (Get-Date).AddSeconds($DrainTimeoutSeconds)
+do {
+    Start-Sleep -Seconds 3
+    $processed = @(docker exec $redis redis-cli --scan --pattern "audit:processed:safety-$runId-*" | Where-Object { $_ }).Count
+    $state = Get-GroupState
+} while (($processed -lt $accepted -or $state.Lag -ne 0) -and (Get-Date) -lt $deadline)
+Write-Host ""
+
+# Assertions
+Write-Host "3. Verifying safety invariants..." -ForegroundColor Yellow
+
+$finalStock = Get-RedisInt "inventory:$ItemId"
+$reserved = Get-RedisInt "audit:reserved:$ItemId"
+$doubleProcessed = Get-RedisInt "audit:double_processed"
+$regressions = Get-RedisInt "audit:offset_regressions"
+$gaps = Get-RedisInt "audit:offset_gaps"
+
+if ($finalStock -ge 0) {
+    Write-Host "   PASSED: Inventory never negative (final stock: $finalStock)" -ForegroundColor Green
+} else {
+    Write-Host "   FAILED: Inventory oversold (final stock: $finalStock)" -ForegroundColor Red
+    $failures++
+}
+
+if (($Stock - $finalStock) -eq $reserved) {
+    Write-Host "   PASSED: Units removed from stock match net reservations ($reserved)" -ForegroundColor Green
+} else {
+    Write-Host "   FAILED: Stock delta $($Stock - $finalStock) != net reservations $reserved" -ForegroundColor Red
+    $failures++
+}
+
+if ($doubleProcessed -eq 0) {
+    Write-Host "   PASSED: No order processed more than once" -ForegroundColor Green
+} else {
+    Write-Host "   FAILED: $doubleProcessed orders processed more than once" -ForegroundColor Red
+    $failures++
+}
+
+if ($processed -eq $accepted -and $state.Lag -eq 0) {
+    Write-Host "   PASSED: All $accepted accepted orders processed, group lag 0" -ForegroundColor Green
+} else {
+    Write-Host "   FAILED: $processed of $accepted accepted orders processed, group lag $($state.Lag)" -ForegroundColor Red
+    $failures++
+}
+
+if ($state.Assigned -ge $partitions) {
+    Write-Host "   PASSED: Every partition assigned after the rebalance ($($state.Assigned)/$partitions)" -ForegroundColor Green
+} else {
+    Write-Host "   FAILED: $($state.Assigned) of $partitions partitions assigned after the rebalance" -ForegroundColor Red
+    $failures++
+}
+
+if ($regressions -eq 0 -and $gaps -eq 0) {
+    Write-Host "   PASSED: Offsets consumed in order with no gaps" -ForegroundColor Green
+} else {
+    Write-Host "   FAILED: $regressions offset regressions, $gaps offset gaps" -ForegroundColor Red
+    $failures++
+}
+
+Write-Host ""
+if ($failures -eq 0) {
+    Write-Host "All safety checks passed" -ForegroundColor Green
+    exit 0
+}
+Write-Host "$failures safety check(s) failed - see processor logs for audit_* events" -ForegroundColor Red
+exit 1